@@ -0,0 +1,241 @@
+package cache
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// writeQueueSize bounds the number of writes waiting to be propagated
+	// to the Writer, Propagate blocking once it is full
+	writeQueueSize = 1024
+	// minMissSweep is the number of cached misses from which the expired
+	// ones are swept when a miss is added
+	minMissSweep = 1024
+)
+
+// Loader reads the keys missing from the cache from a backing store, such
+// as a SQL database or an object store
+type Loader interface {
+	// Load returns the value of key and how long it may be cached, zero
+	// meaning no expiry, or ErrNoSuchKey if the store has no such key
+	// It runs on a goroutine of its own and should honor ctx
+	Load(ctx context.Context, key string) ([]byte, time.Duration, error)
+}
+
+// LoaderFunc adapts a function to the Loader interface
+type LoaderFunc func(ctx context.Context, key string) ([]byte, time.Duration, error)
+
+func (f LoaderFunc) Load(ctx context.Context, key string) ([]byte, time.Duration, error) {
+	return f(ctx, key)
+}
+
+// Writer propagates the writes of the cache to a backing store
+// Its methods are called in the order of the writes, one at a time, on a
+// background goroutine, and should time out on their own
+type Writer interface {
+	Write(ctx context.Context, key string, value []byte) error
+	Delete(ctx context.Context, key string) error
+}
+
+// WithLoader populates the keys missing from the cache from l. Concurrent
+// loads of the same key share a single call of l
+func WithLoader(l Loader) Option {
+	return func(c *Cache) {
+		c.loader = l
+	}
+}
+
+// WithNegativeTTL caches for ttl the keys the Loader reports missing, so
+// that the reads of a key missing from the backing store do not reach it
+// again until ttl elapses or the key is written
+func WithNegativeTTL(ttl time.Duration) Option {
+	return func(c *Cache) {
+		c.negativeTTL = ttl
+	}
+}
+
+// WithWriter propagates the writes given to Propagate to w
+func WithWriter(w Writer) Option {
+	return func(c *Cache) {
+		c.writer = w
+	}
+}
+
+// HasLoader reports whether the cache was created with a Loader
+func (c *Cache) HasLoader() bool {
+	return c.loader != nil
+}
+
+// HasWriter reports whether the cache was created with a Writer
+func (c *Cache) HasWriter() bool {
+	return c.writer != nil
+}
+
+// loadCall is a call of the Loader shared by the loads of a key
+type loadCall struct {
+	done  chan struct{}
+	value []byte
+	ttl   time.Duration
+	err   error
+}
+
+// loadGroup deduplicates the concurrent loads of the same key and holds
+// the cached misses
+type loadGroup struct {
+	mu    sync.Mutex
+	calls map[string]*loadCall
+	// misses holds the expiry time of the cached misses, which are swept
+	// once they reach sweepAt
+	misses  map[string]time.Time
+	sweepAt int
+}
+
+// missed reports whether a miss of key is cached, g.mu being held
+func (g *loadGroup) missed(key string, now time.Time) bool {
+	expiresAt, ok := g.misses[key]
+	if ok && !now.Before(expiresAt) {
+		delete(g.misses, key)
+		return false
+	}
+	return ok
+}
+
+// addMiss caches a miss of key until expiresAt, g.mu being held
+func (g *loadGroup) addMiss(key string, now, expiresAt time.Time) {
+	if len(g.misses) >= g.sweepAt {
+		for k, at := range g.misses {
+			if !now.Before(at) {
+				delete(g.misses, k)
+			}
+		}
+		g.sweepAt = 2 * len(g.misses)
+		if g.sweepAt < minMissSweep {
+			g.sweepAt = minMissSweep
+		}
+	}
+	g.misses[key] = expiresAt
+}
+
+// Load reads key from the Loader, concurrent calls for the same key sharing
+// the result of a single call, which runs with the context of the first one
+// Misses are cached when the cache has a negative TTL
+// Load does not access the cache, so it can be called from any goroutine
+// while the goroutine owning the cache keeps serving, the value being
+// stored afterwards with StoreLoaded
+func (c *Cache) Load(ctx context.Context, key string) ([]byte, time.Duration, error) {
+	if c.loader == nil {
+		return nil, 0, ErrNoSuchKey
+	}
+
+	g := &c.loads
+	g.mu.Lock()
+	if g.missed(key, c.Now()) {
+		g.mu.Unlock()
+		return nil, 0, ErrNoSuchKey
+	}
+	call, ok := g.calls[key]
+	if !ok {
+		call = &loadCall{done: make(chan struct{})}
+		g.calls[key] = call
+	}
+	g.mu.Unlock()
+
+	if !ok {
+		call.value, call.ttl, call.err = c.loader.Load(ctx, key)
+		g.mu.Lock()
+		delete(g.calls, key)
+		if call.err == ErrNoSuchKey && c.negativeTTL > 0 {
+			now := c.Now()
+			g.addMiss(key, now, now.Add(c.negativeTTL))
+		}
+		g.mu.Unlock()
+		close(call.done)
+	}
+
+	select {
+	case <-call.done:
+		return call.value, call.ttl, call.err
+	case <-ctx.Done():
+		return nil, 0, ctx.Err()
+	}
+}
+
+// StoreLoaded stores a value returned by Load, unless the key was set in
+// the meantime, and reports whether it was stored
+func (c *Cache) StoreLoaded(key string, value []byte, ttl time.Duration) bool {
+	if _, ok := c.lookup(key); ok {
+		return false
+	}
+
+	c.storeLoaded(key, value, ttl)
+	return true
+}
+
+func (c *Cache) storeLoaded(key string, value []byte, ttl time.Duration) {
+	var expiresAt int64 = -1
+	if ttl > 0 {
+		expiresAt = c.expiry(ttl)
+	}
+	obj := c.newObjAt(c.encodeString(value), expiresAt)
+	if c.softTTL > 0 {
+		obj.staleAt = obj.accessedAt + c.softTTL.Milliseconds()
+	}
+	c.setObj(key, obj)
+}
+
+// ForgetMiss forgets the cached miss of key, if any, so that its next read
+// reaches the Loader
+func (c *Cache) ForgetMiss(key string) {
+	g := &c.loads
+	g.mu.Lock()
+	delete(g.misses, key)
+	g.mu.Unlock()
+}
+
+// pendingWrite is a write waiting to be propagated to the Writer
+type pendingWrite struct {
+	key   string
+	value []byte
+	// deleted propagates a deletion of the key rather than a write
+	deleted bool
+	done    func(error)
+}
+
+// Propagate queues the write of value to key, or its deletion if deleted
+// is set, for the Writer, once the key was changed in the cache. Writes are
+// propagated in the order they are queued, and done, if not nil, is called
+// with the result on the goroutine of the Writer. A write forgets the
+// cached miss of the key
+func (c *Cache) Propagate(key string, value []byte, deleted bool, done func(error)) {
+	if !deleted {
+		c.ForgetMiss(key)
+	}
+	if c.writer == nil {
+		if done != nil {
+			done(nil)
+		}
+		return
+	}
+	c.writes <- pendingWrite{key: key, value: value, deleted: deleted, done: done}
+}
+
+// runWriter propagates the queued writes until the cache is closed
+func (c *Cache) runWriter() {
+	for w := range c.writes {
+		var err error
+		if w.deleted {
+			err = c.writer.Delete(context.Background(), w.key)
+		} else {
+			err = c.writer.Write(context.Background(), w.key, w.value)
+		}
+		if err != nil {
+			log.Printf("write of %q to the backing store: %v\n", w.key, err)
+		}
+		if w.done != nil {
+			w.done(err)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package cache
+
+// Batch collects writes to apply to a cache at once with Cache.Apply.
+// Filling a batch does not touch the cache, so that it is done away from
+// the goroutine owning the cache, along with the decoding of the payloads
+// restored, leaving only the stores to Apply. A Batch is not safe for
+// concurrent use
+type Batch struct {
+	ops []batchOp
+}
+
+// batchOp is a write of a batch, deleting key if value is nil
+type batchOp struct {
+	key       string
+	value     any
+	expiresAt int64
+}
+
+// Len returns the number of writes in the batch
+func (b *Batch) Len() int {
+	return len(b.ops)
+}
+
+// Set adds the write of the string value at key, expiring at the given unix
+// time in milliseconds or never if expiresAt is -1
+func (b *Batch) Set(key string, value []byte, expiresAt int64) {
+	b.ops = append(b.ops, batchOp{key, value, expiresAt})
+}
+
+// Restore decodes a payload produced by Dump and adds the write of its
+// value at key, replacing any existing key as RESTORE with REPLACE does
+func (b *Batch) Restore(key string, payload []byte, expiresAt int64) error {
+	value, err := decodeValue(payload)
+	if err != nil {
+		return err
+	}
+	b.ops = append(b.ops, batchOp{key, value, expiresAt})
+	return nil
+}
+
+// Delete adds the deletion of key
+func (b *Batch) Delete(key string) {
+	b.ops = append(b.ops, batchOp{key: key})
+}
+
+// Apply applies the writes of the batch in order
+func (c *Cache) Apply(b *Batch) {
+	for _, op := range b.ops {
+		if op.value == nil {
+			c.deleteObj(op.key)
+			continue
+		}
+		c.store(op.key, op.value, op.expiresAt)
+	}
+}
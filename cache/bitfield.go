@@ -0,0 +1,183 @@
+package cache
+
+import "math"
+
+// BitFieldOverflow is how BITFIELD SET and INCRBY handle the values out of
+// the range of their integer type
+type BitFieldOverflow int
+
+const (
+	// OverflowWrap wraps the values around, as in two's complement
+	OverflowWrap BitFieldOverflow = iota
+	// OverflowSat saturates the values to the minimum or maximum
+	OverflowSat
+	// OverflowFail leaves the field unchanged, the operation failing
+	OverflowFail
+)
+
+// BitFieldOp is a GET, SET or INCRBY of the integer of Bits bits, signed
+// or not, starting at the bit Offset of a string, the first bit being the
+// most significant one of its first byte. Value is the value set or the
+// increment
+type BitFieldOp struct {
+	Set, Incr bool
+	Signed    bool
+	Bits      int
+	Offset    int64
+	Value     int64
+	Overflow  BitFieldOverflow
+}
+
+// BitFieldResult is the value read, set or incremented by a BitFieldOp,
+// Failed being set for the SET and INCRBY that overflowed with OverflowFail
+type BitFieldResult struct {
+	Value  int64
+	Failed bool
+}
+
+// BitField runs the ops in order on the string stored at key, missing
+// bits reading as zeros, and returns their results. SET returns the old
+// value of the field and INCRBY the new one. The string is zero padded to
+// hold the fields written, a missing key being created
+func (c *Cache) BitField(key string, ops []BitFieldOp) ([]BitFieldResult, error) {
+	obj, exists := c.lookup(key)
+	var buf []byte
+	if exists {
+		val, err := stringBytes(obj.value)
+		if err != nil {
+			return nil, err
+		}
+		buf = val
+	}
+
+	// strings are never modified in place, as they may be shared with
+	// replies being written, so the writes go to a copy
+	size, written := len(buf), false
+	for _, op := range ops {
+		if !op.Set && !op.Incr {
+			continue
+		}
+		written = true
+		if end := int((op.Offset + int64(op.Bits) + 7) / 8); end > size {
+			size = end
+		}
+	}
+	if written {
+		buf = append(make([]byte, 0, size), buf...)
+		buf = buf[:size]
+	}
+
+	results := make([]BitFieldResult, len(ops))
+	for i, op := range ops {
+		old := getBits(buf, op.Offset, op.Bits)
+		if op.Signed {
+			old = signExtend(old, op.Bits)
+		}
+		if !op.Set && !op.Incr {
+			results[i] = BitFieldResult{Value: int64(old)}
+			continue
+		}
+
+		value, incr := op.Value, int64(0)
+		if op.Incr {
+			value, incr = int64(old), op.Value
+		}
+		next, ok := bitFieldAdd(value, incr, op)
+		if !ok {
+			results[i] = BitFieldResult{Failed: true}
+			continue
+		}
+		setBits(buf, op.Offset, op.Bits, uint64(next))
+		if op.Set {
+			results[i] = BitFieldResult{Value: int64(old)}
+		} else {
+			results[i] = BitFieldResult{Value: next}
+		}
+	}
+
+	if written {
+		if exists {
+			c.setValue(key, obj, c.encodeString(buf))
+		} else {
+			c.setCreated(key, c.encodeString(buf))
+		}
+	}
+	return results, nil
+}
+
+// getBits returns the bits unsigned integer starting at the bit offset
+// of buf, the bits past its end reading as zeros
+func getBits(buf []byte, offset int64, bits int) uint64 {
+	var v uint64
+	for i := int64(0); i < int64(bits); i++ {
+		pos := offset + i
+		var bit byte
+		if pos/8 < int64(len(buf)) {
+			bit = buf[pos/8] >> (7 - pos%8) & 1
+		}
+		v = v<<1 | uint64(bit)
+	}
+	return v
+}
+
+// setBits stores the low bits of v starting at the bit offset of buf
+func setBits(buf []byte, offset int64, bits int, v uint64) {
+	for i := int64(0); i < int64(bits); i++ {
+		pos := offset + i
+		mask := byte(1) << (7 - pos%8)
+		if v>>(int64(bits)-1-i)&1 == 1 {
+			buf[pos/8] |= mask
+		} else {
+			buf[pos/8] &^= mask
+		}
+	}
+}
+
+// signExtend returns the bits signed integer v as an int64
+func signExtend(v uint64, bits int) uint64 {
+	if bits < 64 && v&(1<<(bits-1)) != 0 {
+		v |= math.MaxUint64 << bits
+	}
+	return v
+}
+
+// bitFieldAdd returns value plus incr handled according to the overflow
+// policy of op when out of the range of its type, and false if it failed
+func bitFieldAdd(value, incr int64, op BitFieldOp) (int64, bool) {
+	var min, max int64
+	switch {
+	case op.Signed && op.Bits == 64:
+		min, max = math.MinInt64, math.MaxInt64
+	case op.Signed:
+		max = 1<<(op.Bits-1) - 1
+		min = -max - 1
+	default:
+		max = 1<<op.Bits - 1
+	}
+
+	// the sum may wrap around the int64 range itself
+	sum := value + incr
+	wrappedUp, wrappedDown := incr > 0 && sum < value, incr < 0 && sum > value
+	overflow := wrappedUp || (!wrappedDown && sum > max)
+	underflow := wrappedDown || (!wrappedUp && sum < min)
+	if !overflow && !underflow {
+		return sum, true
+	}
+
+	switch op.Overflow {
+	case OverflowSat:
+		if overflow {
+			return max, true
+		}
+		return min, true
+	case OverflowFail:
+		return 0, false
+	}
+	wrapped := uint64(sum)
+	if op.Signed {
+		wrapped = signExtend(wrapped&(math.MaxUint64>>(64-op.Bits)), op.Bits)
+	} else {
+		wrapped &= math.MaxUint64 >> (64 - op.Bits)
+	}
+	return int64(wrapped), true
+}
@@ -0,0 +1,234 @@
+package cache
+
+import (
+	"errors"
+	"math"
+)
+
+const (
+	// DefaultBloomErrorRate and DefaultBloomCapacity are those of the
+	// bloom filters created by BFAdd, as in RedisBloom
+	DefaultBloomErrorRate = 0.01
+	DefaultBloomCapacity  = 100
+	// bloomExpansion is the growth of the capacity of the layers added to
+	// a full bloom filter, and bloomTightening the factor applied to their
+	// error rate, which bounds the overall rate to twice the requested one
+	bloomExpansion  = 2
+	bloomTightening = 0.5
+	// maxFilterBits bounds the size of a bloom filter layer or of a cuckoo
+	// filter, 512MB
+	maxFilterBits = 1 << 32
+)
+
+var (
+	// ErrItemExists is returned when reserving a filter at a key that exists
+	ErrItemExists = &Error{Kind: KindErr, Msg: "item exists"}
+	// ErrFilterFull is returned when a filter cannot take more items
+	ErrFilterFull   = &Error{Kind: KindErr, Msg: "Filter is full"}
+	errFilterTooBig = errors.New("filter capacity is too large")
+)
+
+// bloomFilter is a scalable bloom filter: once its last layer holds as many
+// items as its capacity, a layer of a larger capacity and a lower error
+// rate is added
+type bloomFilter struct {
+	errorRate float64
+	layers    []*bloomLayer
+}
+
+type bloomLayer struct {
+	// bits holds the bits of the layer, probed hashes times per item
+	bits     []uint64
+	hashes   uint64
+	capacity uint64
+	count    uint64
+}
+
+func newBloomFilter(errorRate float64, capacity uint64) (*bloomFilter, error) {
+	layer, err := newBloomLayer(errorRate, capacity)
+	if err != nil {
+		return nil, err
+	}
+	return &bloomFilter{errorRate: errorRate, layers: []*bloomLayer{layer}}, nil
+}
+
+// newBloomLayer sizes a layer holding capacity items with the given false
+// positive rate, using the optimal number of bits and of hashes
+func newBloomLayer(errorRate float64, capacity uint64) (*bloomLayer, error) {
+	bits := math.Ceil(-float64(capacity) * math.Log(errorRate) / (math.Ln2 * math.Ln2))
+	if bits > maxFilterBits {
+		return nil, errFilterTooBig
+	}
+	words := (uint64(bits) + 63) / 64
+	hashes := uint64(math.Ceil(math.Ln2 * bits / float64(capacity)))
+	if hashes < 1 {
+		hashes = 1
+	}
+	return &bloomLayer{bits: make([]uint64, words), hashes: hashes, capacity: capacity}, nil
+}
+
+// probes calls fn with the bits of item in a layer of n bits, derived from
+// two hashes as in Kirsch and Mitzenmacher, until fn returns false
+func (l *bloomLayer) probes(h1, h2 uint64, fn func(word int, mask uint64) bool) bool {
+	n := uint64(len(l.bits)) * 64
+	for i := uint64(0); i < l.hashes; i++ {
+		bit := (h1 + i*h2) % n
+		if !fn(int(bit/64), 1<<(bit%64)) {
+			return false
+		}
+	}
+	return true
+}
+
+func (l *bloomLayer) has(h1, h2 uint64) bool {
+	return l.probes(h1, h2, func(word int, mask uint64) bool {
+		return l.bits[word]&mask != 0
+	})
+}
+
+func (l *bloomLayer) add(h1, h2 uint64) {
+	l.probes(h1, h2, func(word int, mask uint64) bool {
+		l.bits[word] |= mask
+		return true
+	})
+	l.count++
+}
+
+func (bf *bloomFilter) has(item []byte) bool {
+	h1, h2 := filterHashes(item)
+	for _, l := range bf.layers {
+		if l.has(h1, h2) {
+			return true
+		}
+	}
+	return false
+}
+
+// add adds item and reports whether it was not in the filter already
+func (bf *bloomFilter) add(item []byte) (bool, error) {
+	if bf.has(item) {
+		return false, nil
+	}
+
+	last := bf.layers[len(bf.layers)-1]
+	if last.count >= last.capacity {
+		rate := bf.errorRate * math.Pow(bloomTightening, float64(len(bf.layers)))
+		l, err := newBloomLayer(rate, last.capacity*bloomExpansion)
+		if err != nil {
+			return false, ErrFilterFull
+		}
+		bf.layers = append(bf.layers, l)
+		last = l
+	}
+	h1, h2 := filterHashes(item)
+	last.add(h1, h2)
+	return true, nil
+}
+
+func (bf *bloomFilter) clone() *bloomFilter {
+	cp := &bloomFilter{errorRate: bf.errorRate, layers: make([]*bloomLayer, len(bf.layers))}
+	for i, l := range bf.layers {
+		layer := *l
+		layer.bits = append([]uint64(nil), l.bits...)
+		cp.layers[i] = &layer
+	}
+	return cp
+}
+
+// filterHashes returns two independent 64 bit hashes of item, FNV-1a and
+// its splitmix64 mix, which stay the same across restarts so that dumped
+// filters can be restored
+func filterHashes(item []byte) (uint64, uint64) {
+	h := uint64(14695981039346656037)
+	for _, b := range item {
+		h ^= uint64(b)
+		h *= 1099511628211
+	}
+	return h, mix64(h) | 1
+}
+
+// mix64 is the finalizer of splitmix64
+func mix64(h uint64) uint64 {
+	h ^= h >> 30
+	h *= 0xbf58476d1ce4e5b9
+	h ^= h >> 27
+	h *= 0x94d049bb133111eb
+	h ^= h >> 31
+	return h
+}
+
+// getBloomFilter returns the bloom filter stored at key or nil if the key
+// does not exist
+func (c *Cache) getBloomFilter(key string) (*bloomFilter, error) {
+	obj, ok := c.lookup(key)
+	if !ok {
+		return nil, nil
+	}
+
+	bf, ok := obj.value.(*bloomFilter)
+	if !ok {
+		return nil, ErrWrongType
+	}
+	return bf, nil
+}
+
+// BFReserve creates an empty bloom filter at key holding capacity items
+// with the given false positive rate before it grows
+func (c *Cache) BFReserve(key string, errorRate float64, capacity uint64) error {
+	if errorRate <= 0 || errorRate >= 1 {
+		return errors.New("(0 < error rate range < 1)")
+	}
+	if capacity == 0 {
+		return errors.New("(capacity should be larger than 0)")
+	}
+	if _, exists := c.lookup(key); exists {
+		return ErrItemExists
+	}
+
+	bf, err := newBloomFilter(errorRate, capacity)
+	if err != nil {
+		return err
+	}
+	c.setCreated(key, bf)
+	return nil
+}
+
+// BFAdd adds the items to the bloom filter stored at key, creating it with
+// the default error rate and capacity if needed, and reports for each
+// whether it was added, false meaning it may have been added before. It
+// fails with ErrFilterFull once the filter can no longer grow
+func (c *Cache) BFAdd(key string, items ...[]byte) ([]bool, error) {
+	bf, err := c.getBloomFilter(key)
+	if err != nil {
+		return nil, err
+	}
+	if bf == nil {
+		if bf, err = newBloomFilter(DefaultBloomErrorRate, DefaultBloomCapacity); err != nil {
+			return nil, err
+		}
+		c.setCreated(key, bf)
+	}
+
+	added := make([]bool, len(items))
+	for i, item := range items {
+		if added[i], err = bf.add(item); err != nil {
+			return nil, err
+		}
+	}
+	return added, nil
+}
+
+// BFExists reports for each item whether it may have been added to the
+// bloom filter stored at key
+func (c *Cache) BFExists(key string, items ...[]byte) ([]bool, error) {
+	bf, err := c.getBloomFilter(key)
+	if err != nil {
+		return nil, err
+	}
+
+	exists := make([]bool, len(items))
+	for i, item := range items {
+		exists[i] = bf != nil && bf.has(item)
+	}
+	return exists, nil
+}
@@ -1,51 +1,293 @@
 package cache
 
 import (
-	"fmt"
 	"log"
+	"math/rand"
+	"sync/atomic"
 	"time"
 )
 
 type obj struct {
-	value     string
+	// value is a string in one of the encodings of encodeString or a
+	// pointer to one of the collection types
+	value any
+	// expiresAt is the unix time in milliseconds at which the key expires
+	// or -1 if the key has no associated expire
 	expiresAt int64
+	// accessedAt is the unix time in milliseconds of the last access,
+	// createdAt that of the creation of the value and writtenAt that of
+	// its last write
+	accessedAt int64
+	createdAt  int64
+	writtenAt  int64
+	// staleAt is the unix time in milliseconds from which the value is
+	// stale, or 0 if it never is
+	staleAt int64
+	// version is the version given by the last write of the key
+	version uint64
 }
 
-func newObj(value string, duration int64) *obj {
+func (c *Cache) newObj(value any, duration int64) *obj {
 	var expiresAt int64 = -1
 	if duration > 0 {
-		expiresAt = time.Now().Unix() + duration
+		expiresAt = c.Now().UnixMilli() + duration*1000
 	}
 
-	return &obj{
-		value:     value,
-		expiresAt: expiresAt,
+	return c.newObjAt(value, expiresAt)
+}
+
+// newObjAt creates an object expiring at the given unix time in milliseconds
+func (c *Cache) newObjAt(value any, expiresAt int64) *obj {
+	now := c.Now().UnixMilli()
+	o := &obj{}
+	if c.objs != nil {
+		o = c.objs.alloc()
+	}
+	*o = obj{
+		value:      value,
+		expiresAt:  expiresAt,
+		accessedAt: now,
+		createdAt:  now,
+		writtenAt:  now,
 	}
+	return o
 }
 
 type Cache struct {
 	data map[string]*obj
+	// onEvict is called after a key expires or is evicted
+	onEvict func(key string, reason EvictReason)
+	// lazyFreeThreshold is the element count above which removed
+	// values are handed to the lazy-free worker
+	lazyFreeThreshold int
+	lazyFree          *lazyFreer
+	// loader and writer connect the cache to a backing store, loads
+	// deduplicating the concurrent loads and writes queuing the writes
+	// to propagate
+	loader Loader
+	writer Writer
+	loads  loadGroup
+	writes chan pendingWrite
+	// compressThreshold is the length from which strings are stored
+	// compressed, zero meaning they never are
+	compressThreshold int
+	// negativeTTL is how long the misses of the loader are cached, zero
+	// meaning they are not
+	negativeTTL time.Duration
+	// zsetMaxCompactEntries and zsetMaxCompactValue are the limits of the
+	// compact encoding of sorted sets
+	zsetMaxCompactEntries int
+	zsetMaxCompactValue   int
+	// softTTL is how long the keys loaded from the backing store stay
+	// fresh, zero meaning they do not go stale
+	softTTL time.Duration
+	// ttlJitter is the fraction of the relative TTLs by which they are
+	// randomly shortened
+	ttlJitter float64
+	// defaultTTL is the TTL of the keys written without one, and
+	// prefixTTLs those of the keys starting with their prefixes, set by
+	// WithDefaultTTL
+	defaultTTL time.Duration
+	prefixTTLs map[string]time.Duration
+	// crdtClock is the latest clock value tagging the adds to the sets of
+	// the CRDT commands
+	crdtClock int64
+	// expireMode is how the expired keys are treated
+	expireMode ExpireMode
+	// versionSeq is the latest version given to a key
+	versionSeq uint64
+	// prefixIndex holds the keys in a radix tree, nil unless
+	// WithPrefixIndex is given
+	prefixIndex *radixNode
+	// clock tells the time, the system clock unless WithClock is given,
+	// and appliedAt the time in unix milliseconds fixed by ApplyAt while
+	// it runs, 0 otherwise
+	clock     Clock
+	appliedAt atomic.Int64
+	// rand draws the random numbers of the cache, such as the TTL jitter,
+	// seeded by ApplyAt while it runs
+	rand *rand.Rand
+	// stats holds the counters reported by Stats
+	stats cacheStats
+	// checksums is set when the strings are stored with a checksum
+	checksums bool
+	// spill holds the strings spilled to disk, nil unless WithSpill is
+	// given
+	spill *spiller
+	// defrag holds the progress of Defrag
+	defrag defragger
+	// scrub holds the progress of Scrub
+	scrub scrubber
+	// objs allocates the headers of the keys, nil unless WithEntrySlabs
+	// is given
+	objs *objSlabs
+	// tenants hold the counters of the key prefixes of WithTenants
+	tenants []*tenant
+}
+
+func New(opts ...Option) *Cache {
+	c := &Cache{
+		data:                  make(map[string]*obj),
+		clock:                 systemClock{},
+		rand:                  rand.New(rand.NewSource(time.Now().UnixNano())),
+		lazyFreeThreshold:     defaultLazyFreeThreshold,
+		zsetMaxCompactEntries: defaultZSetMaxCompactEntries,
+		zsetMaxCompactValue:   defaultZSetMaxCompactValue,
+		versionSeq:            initialVersion(),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.lazyFree = newLazyFreer(c.lazyFreeThreshold)
+	c.loads.calls = make(map[string]*loadCall)
+	c.loads.misses = make(map[string]time.Time)
+	c.loads.sweepAt = minMissSweep
+	if c.writer != nil {
+		c.writes = make(chan pendingWrite, writeQueueSize)
+		go c.runWriter()
+	}
+	return c
+}
+
+// Close stops the background workers of the cache
+// The cache must not be used after calling Close
+func (c *Cache) Close() {
+	close(c.lazyFree.queue)
+	if c.writes != nil {
+		close(c.writes)
+	}
+	if c.spill != nil {
+		c.spill.store.Close()
+	}
 }
 
-func New() *Cache {
-	return &Cache{
-		data: make(map[string]*obj),
+// evict removes key from the cache, freeing big values in the
+// background, and notifies the OnEvict hook
+func (c *Cache) evict(key string, reason EvictReason) {
+	if obj, ok := c.data[key]; ok {
+		c.lazyFree.free(obj.value)
+	}
+	c.deleteObj(key)
+	if reason == ReasonExpired {
+		c.stats.expired.Add(1)
+	} else {
+		c.stats.evicted.Add(1)
+	}
+	if c.onEvict != nil {
+		c.onEvict(key, reason)
 	}
 }
 
-func (c *Cache) Get(key string) (string, error) {
+// lookup returns the object stored at key, passively deleting it
+// if it has already expired and the expire mode deletes the expired keys,
+// and reading its string back from disk if it was spilled
+func (c *Cache) lookup(key string) (*obj, bool) {
 	obj, ok := c.data[key]
 	if !ok {
-		return "", fmt.Errorf("key (%s) not found", key)
+		c.countLookup(key, false)
+		return nil, false
 	}
 
 	// passive deletion of expired keys when accessed
-	if obj.expiresAt != -1 && obj.expiresAt <= time.Now().Unix() {
-		delete(c.data, key)
-		return "", fmt.Errorf("key (%s) not found", key)
+	now := c.Now().UnixMilli()
+	if c.expired(obj, now) {
+		if c.expireMode == ExpireDelete {
+			c.evict(key, ReasonExpired)
+		}
+		c.countLookup(key, false)
+		return nil, false
+	}
+	if _, spilled := obj.value.(spilledString); spilled && !c.faultIn(key, obj) {
+		c.countLookup(key, false)
+		return nil, false
 	}
 
-	return obj.value, nil
+	c.countLookup(key, true)
+	obj.accessedAt = now
+	return obj, true
+}
+
+// Get returns the string stored at key. Strings are binary safe and the
+// returned slice may be shared with the cache, so it must not be modified
+func (c *Cache) Get(key string) ([]byte, error) {
+	obj, ok := c.lookup(key)
+	if !ok {
+		return nil, ErrNoSuchKey
+	}
+
+	val, err := stringBytes(obj.value)
+	if err != nil {
+		return nil, err
+	}
+	return val, nil
+}
+
+// GetDecoded returns the string stored at key as Get does, reporting
+// whether it was decoded into new bytes, such as the compressed,
+// checksummed and integer strings, rather than returned as stored
+func (c *Cache) GetDecoded(key string) ([]byte, bool, error) {
+	obj, ok := c.lookup(key)
+	if !ok {
+		return nil, false, ErrNoSuchKey
+	}
+
+	_, stored := obj.value.([]byte)
+	val, err := stringBytes(obj.value)
+	if err != nil {
+		return nil, false, err
+	}
+	return val, !stored, nil
+}
+
+// GetEx returns the string stored at key and updates its expiration
+// A positive expiresAt sets the expiration to that unix time in milliseconds,
+// -1 removes the expiration and 0 leaves it untouched
+// A deadline that is already in the past deletes the key after reading it
+func (c *Cache) GetEx(key string, expiresAt int64) ([]byte, error) {
+	val, err := c.Get(key)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case expiresAt == -1:
+		c.data[key].expiresAt = -1
+	case expiresAt > 0 && expiresAt <= c.Now().UnixMilli() && c.expireMode != ExpireKeep:
+		c.deleteObj(key)
+	case expiresAt > 0:
+		c.data[key].expiresAt = expiresAt
+	}
+
+	return val, nil
+}
+
+// ExpireAt sets the expiration of key to the given unix time in milliseconds
+// and reports whether the key exists. A deadline in the past deletes the key,
+// unless the expired keys are kept
+func (c *Cache) ExpireAt(key string, expiresAt int64) bool {
+	obj, ok := c.lookup(key)
+	if !ok {
+		return false
+	}
+
+	if expiresAt <= c.Now().UnixMilli() && c.expireMode != ExpireKeep {
+		c.deleteObj(key)
+		return true
+	}
+
+	obj.expiresAt = expiresAt
+	return true
+}
+
+// ExpireTime returns the unix time in milliseconds at which key expires,
+// -1 if the key exists but has no associated expire and -2 if it does not exist
+func (c *Cache) ExpireTime(key string) int64 {
+	obj, ok := c.lookup(key)
+	if !ok {
+		return -2
+	}
+
+	return obj.expiresAt
 }
 
 func (c *Cache) Has(key string) bool {
@@ -53,22 +295,83 @@ func (c *Cache) Has(key string) bool {
 	return isPresent
 }
 
-func (c *Cache) Set(key, val string) error {
-	c.data[key] = newObj(val, -1)
+// Exists returns the number of the given keys that exist, a key given
+// several times being counted as many times. It does not count as an
+// access of the keys
+func (c *Cache) Exists(keys ...string) int {
+	now := c.Now().UnixMilli()
+	exists := 0
+	for _, key := range keys {
+		if obj, ok := c.data[key]; ok && !c.expired(obj, now) {
+			exists++
+		}
+	}
+	return exists
+}
+
+// Len returns the number of keys, including those expired but not deleted yet
+func (c *Cache) Len() int {
+	return len(c.data)
+}
+
+// VolatileLen returns the number of keys with an associated expire
+// It walks the whole keyspace, so it is meant for reporting only
+func (c *Cache) VolatileLen() int {
+	n := 0
+	for _, obj := range c.data {
+		if obj.expiresAt != -1 {
+			n++
+		}
+	}
+	return n
+}
+
+// Set stores the string val at key. The cache may keep a reference to val,
+// so the caller must not modify it afterwards
+func (c *Cache) Set(key string, val []byte) error {
+	c.setCreated(key, c.encodeString(val))
+	return nil
+}
+
+// SetWithTTL stores the string val at key, expiring after ttl seconds
+// shortened by the jitter of WithTTLJitter
+func (c *Cache) SetWithTTL(key string, val []byte, ttl int64) error {
+	if ttl <= 0 {
+		c.setObj(key, c.newObj(c.encodeString(val), ttl))
+		return nil
+	}
+	c.setObj(key, c.newObjAt(c.encodeString(val), c.expiry(time.Duration(ttl)*time.Second)))
 	return nil
 }
 
-func (c *Cache) SetWithTTL(key, val string, ttl int64) error {
-	c.data[key] = newObj(val, ttl)
+// SetAt stores the string val at key, expiring at the given unix time in
+// milliseconds, without the jitter of WithTTLJitter
+func (c *Cache) SetAt(key string, val []byte, expiresAt int64) error {
+	c.setObj(key, c.newObjAt(c.encodeString(val), expiresAt))
 	return nil
 }
 
 func (c *Cache) Delete(key string) error {
-	delete(c.data, key)
+	c.deleteObj(key)
 	return nil
 }
 
-func (c *Cache) expireSample() float32 {
+// DeleteKeys removes the given keys and returns the number of keys
+// removed, the expired keys not counting
+func (c *Cache) DeleteKeys(keys ...string) int {
+	deleted := 0
+	for _, key := range keys {
+		if _, ok := c.lookup(key); ok {
+			c.deleteObj(key)
+			deleted++
+		}
+	}
+	return deleted
+}
+
+// expireSample deletes the expired keys among 20 keys having an expiry
+// and returns their number
+func (c *Cache) expireSample() int {
 	var limit int = 20
 	var expiredCount int = 0
 
@@ -77,8 +380,8 @@ func (c *Cache) expireSample() float32 {
 		if obj.expiresAt != -1 {
 			limit--
 			// if the key is expired
-			if obj.expiresAt <= time.Now().Unix() {
-				delete(c.data, key)
+			if obj.expiresAt <= c.Now().UnixMilli() {
+				c.evict(key, ReasonExpired)
 				expiredCount++
 			}
 		}
@@ -90,19 +393,35 @@ func (c *Cache) expireSample() float32 {
 		}
 	}
 
-	return float32(expiredCount) / float32(20.0)
+	return expiredCount
 }
 
 // Deletes all the expired keys - the active way
 // Sampling approach: https://redis.io/commands/expire/
-func (c *Cache) DeleteExpiredKeys() {
+// Nothing is deleted unless the expire mode deletes the expired keys.
+// The sampling stops once budget is spent, unless it is 0, and pressured
+// reports that the first sample was mostly expired, the keys expiring
+// faster than they are deleted
+func (c *Cache) DeleteExpiredKeys(budget time.Duration) (deleted int, pressured bool) {
+	if c.expireMode != ExpireDelete {
+		return 0, false
+	}
+	start := time.Now()
 	for {
-		frac := c.expireSample()
+		expired := c.expireSample()
+		deleted += expired
 		// if the sample had less than 25% keys expired
 		// we break the loop.
-		if frac < 0.25 {
+		if expired < 5 {
+			break
+		}
+		pressured = true
+		if budget > 0 && time.Since(start) >= budget {
 			break
 		}
 	}
-	log.Println("deleted the expired but undeleted keys. total keys", len(c.data))
+	if deleted > 0 {
+		log.Println("deleted", deleted, "expired keys. total keys", len(c.data))
+	}
+	return deleted, pressured
 }
@@ -0,0 +1,260 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/golang/snappy"
+)
+
+// CheckProblem is an inconsistency found by Check
+type CheckProblem struct {
+	// Key is the key found inconsistent, empty for the problems of the
+	// keyspace as a whole
+	Key string
+	// Problem describes the inconsistency, and Repair what Check did about
+	// it, empty unless repairing
+	Problem, Repair string
+}
+
+func (p CheckProblem) String() string {
+	s := p.Problem
+	if p.Key != "" {
+		s = fmt.Sprintf("%q: %s", p.Key, s)
+	}
+	if p.Repair != "" {
+		s += ", " + p.Repair
+	}
+	return s
+}
+
+// CheckReport is the outcome of Check
+type CheckReport struct {
+	// Keys is the number of keys checked
+	Keys int
+	// Problems are the inconsistencies found, in no particular order
+	Problems []CheckProblem
+}
+
+// Check walks the keyspace checking the invariants the commands rely on:
+// that the expire times are valid, that the strings match their checksum
+// and decompress, that the members of the sorted sets are sorted, unique
+// and agree with their index, that the entries of the streams are sorted
+// by ID and their pending entries held by existing consumers, and that the
+// counters of Stats and the prefix index agree with the keyspace. With
+// repair set, the expire times found invalid are dropped, the strings
+// corrupted deleted, the sorted sets and streams rebuilt from their
+// entries, and the counters and the prefix index recounted. It holds the
+// goroutine using the cache for a walk of every value, so it is meant for
+// the keyspace loaded before serving
+func (c *Cache) Check(repair bool) CheckReport {
+	r := CheckReport{Keys: len(c.data)}
+	problem := func(key, problem, fix string) {
+		p := CheckProblem{Key: key, Problem: problem}
+		if repair {
+			p.Repair = fix
+		}
+		r.Problems = append(r.Problems, p)
+	}
+
+	var bytes int64
+	for key, o := range c.data {
+		if c.checkKey(key, o, repair, problem) {
+			bytes += int64(len(key)) + storedSize(o.value)
+		}
+	}
+
+	if n := c.stats.entries.Load(); n != int64(len(c.data)) {
+		problem("", fmt.Sprintf("%d keys counted for %d keys held", n, len(c.data)), "recounted")
+		if repair {
+			c.stats.entries.Store(int64(len(c.data)))
+		}
+	}
+	if n := c.stats.bytes.Load(); n != bytes {
+		problem("", fmt.Sprintf("%d bytes counted for %d bytes held", n, bytes), "recounted")
+	}
+	if repair {
+		// the values rebuilt may have changed size
+		c.stats.bytes.Store(bytes)
+		c.recountTenants()
+	}
+	if c.prefixIndex != nil && c.prefixIndex.size != len(c.data) {
+		problem("", fmt.Sprintf("%d keys in the prefix index for %d keys held", c.prefixIndex.size, len(c.data)), "rebuilt")
+		if repair {
+			c.prefixIndex = &radixNode{}
+			for key := range c.data {
+				c.prefixIndex.insert(key)
+			}
+		}
+	}
+	return r
+}
+
+// checkKey checks the expire time and the value of key, held by o,
+// passing the inconsistencies found to problem and repairing them if
+// repair is set, and reports whether the key is still held
+func (c *Cache) checkKey(key string, o *obj, repair bool, problem func(key, problem, fix string)) bool {
+	if o.expiresAt == 0 || o.expiresAt < -1 {
+		problem(key, fmt.Sprintf("invalid expire time %d", o.expiresAt), "made persistent")
+		if repair {
+			o.expiresAt = -1
+		}
+	}
+
+	if err := checkValue(o.value); err != nil {
+		problem(key, err.Error(), "deleted")
+		if repair {
+			c.deleteObj(key)
+			return false
+		}
+		return true
+	}
+	switch v := o.value.(type) {
+	case *sortedSet:
+		if msg := v.check(); msg != "" {
+			problem(key, msg, "rebuilt from its members")
+			if repair {
+				if v.rebuild(); len(v.members) == 0 {
+					c.deleteObj(key)
+					return false
+				}
+			}
+		}
+	case *stream:
+		if msg := v.check(); msg != "" {
+			problem(key, msg, "rebuilt from its entries")
+			if repair {
+				v.rebuild()
+			}
+		}
+	}
+	return true
+}
+
+// checkValue returns an error if the string value no longer matches its
+// checksum or decompresses
+func checkValue(value any) error {
+	if v, ok := value.(checkedString); ok {
+		if _, err := v.bytes(); err != nil {
+			return errors.New("string not matching its checksum")
+		}
+		value = v.value
+	}
+	if v, ok := value.(compressedString); ok {
+		if _, err := snappy.Decode(nil, v); err != nil {
+			return fmt.Errorf("compressed string not decoding: %v", err)
+		}
+	}
+	return nil
+}
+
+// check returns what breaks the invariants of the sorted set, empty if
+// nothing does
+func (z *sortedSet) check() string {
+	seen := make(map[string]bool, len(z.members))
+	for i, m := range z.members {
+		if math.IsNaN(m.Score) {
+			return fmt.Sprintf("member %q scored NaN", m.Member)
+		}
+		if seen[m.Member] {
+			return fmt.Sprintf("member %q held twice", m.Member)
+		}
+		seen[m.Member] = true
+		if i > 0 && !z.members[i-1].less(m) {
+			return fmt.Sprintf("member %q out of order", m.Member)
+		}
+		if z.dict != nil {
+			if score, ok := z.dict[m.Member]; !ok || score != m.Score {
+				return fmt.Sprintf("member %q not matching the index of the members", m.Member)
+			}
+		}
+	}
+	if z.dict != nil && len(z.dict) != len(z.members) {
+		return fmt.Sprintf("%d members in the index for %d members", len(z.dict), len(z.members))
+	}
+	return ""
+}
+
+// rebuild sorts the members of the sorted set, keeping the first of those
+// held twice and dropping those scored NaN, and rebuilds its index
+func (z *sortedSet) rebuild() {
+	seen := make(map[string]bool, len(z.members))
+	members := z.members[:0]
+	for _, m := range z.members {
+		if !seen[m.Member] && !math.IsNaN(m.Score) {
+			seen[m.Member] = true
+			members = append(members, m)
+		}
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].less(members[j]) })
+	z.members = members
+	if z.dict != nil {
+		z.dict = make(map[string]float64, len(members))
+		for _, m := range members {
+			z.dict[m.Member] = m.Score
+		}
+	}
+}
+
+// check returns what breaks the invariants of the stream, empty if
+// nothing does
+func (st *stream) check() string {
+	for i, e := range st.entries {
+		if i > 0 && !st.entries[i-1].ID.Less(e.ID) {
+			return fmt.Sprintf("entry %s out of order", e.ID)
+		}
+	}
+	if n := len(st.entries); n > 0 && st.lastID.Less(st.entries[n-1].ID) {
+		return fmt.Sprintf("last ID %s older than entry %s", st.lastID, st.entries[n-1].ID)
+	}
+	for name, g := range st.groups {
+		for id, pe := range g.pending {
+			cons, ok := g.consumers[pe.consumer]
+			if !ok || cons.pending[id] != pe {
+				return fmt.Sprintf("pending entry %s of group %q not held by its consumer %q", id, name, pe.consumer)
+			}
+		}
+		for consName, cons := range g.consumers {
+			for id := range cons.pending {
+				if _, ok := g.pending[id]; !ok {
+					return fmt.Sprintf("entry %s pending for consumer %q not pending in group %q", id, consName, name)
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// rebuild sorts the entries of the stream, keeping the first of those
+// with the same ID, moves its last ID up to its last entry, and rebuilds
+// the pending entries of the consumers from those of their groups,
+// creating the consumers missing
+func (st *stream) rebuild() {
+	sort.SliceStable(st.entries, func(i, j int) bool { return st.entries[i].ID.Less(st.entries[j].ID) })
+	entries := st.entries[:0]
+	for i, e := range st.entries {
+		if i == 0 || entries[len(entries)-1].ID.Less(e.ID) {
+			entries = append(entries, e)
+		}
+	}
+	st.entries = entries
+	if n := len(entries); n > 0 && st.lastID.Less(entries[n-1].ID) {
+		st.lastID = entries[n-1].ID
+	}
+
+	for _, g := range st.groups {
+		for _, cons := range g.consumers {
+			cons.pending = make(map[StreamID]*pendingEntry)
+		}
+		for id, pe := range g.pending {
+			cons, ok := g.consumers[pe.consumer]
+			if !ok {
+				cons = &consumer{seenAt: pe.deliveredAt, pending: make(map[StreamID]*pendingEntry)}
+				g.consumers[pe.consumer] = cons
+			}
+			cons.pending[id] = pe
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package cache
+
+import "hash/crc32"
+
+// crc32c is the table of the Castagnoli polynomial, which modern CPUs
+// compute in hardware
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+// ErrCorrupt is returned when a string no longer matches the checksum it
+// was stored with
+var ErrCorrupt = &Error{Kind: KindCorrupt, Msg: "value does not match its checksum, the key is corrupt"}
+
+// checkedString is a string in one of the encodings of encodeString stored
+// along with the CRC-32C of its bytes
+type checkedString struct {
+	value any
+	crc   uint32
+}
+
+// WithChecksums stores a CRC-32C with every string, checked whenever the
+// string is read, so that a value corrupted in memory, by bad RAM or a bug,
+// fails with ErrCorrupt rather than being returned. It costs the checksum
+// of the whole string on every read and write. The other types are not
+// checked
+func WithChecksums() Option {
+	return func(c *Cache) {
+		c.checksums = true
+	}
+}
+
+// bytes returns the string held, or ErrCorrupt if it does not match its
+// checksum
+func (v checkedString) bytes() ([]byte, error) {
+	val, err := stringBytes(v.value)
+	if err != nil {
+		return nil, err
+	}
+	if crc32.Checksum(val, crc32c) != v.crc {
+		return nil, ErrCorrupt
+	}
+	return val, nil
+}
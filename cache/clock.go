@@ -0,0 +1,94 @@
+package cache
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Clock tells a cache the time, from which the TTLs of the keys, their
+// access and write times, the idle times of the stream and queue messages
+// and the IDs of the stream entries are computed. It is called from the
+// goroutine using the cache, and from those of Load
+type Clock interface {
+	Now() time.Time
+}
+
+// systemClock is the Clock of the caches created without WithClock
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// WithClock makes the cache tell the time with clock instead of the system
+// clock, such as with a ManualClock for tests to expire keys at will
+func WithClock(clock Clock) Option {
+	return func(c *Cache) {
+		c.clock = clock
+	}
+}
+
+// Clock returns the clock of the cache, for the server to compute the
+// deadlines it hands to the cache with the same time
+func (c *Cache) Clock() Clock {
+	return c.clock
+}
+
+// Now returns the current time as told by the clock of the cache, or the
+// time ApplyAt is running fn at
+func (c *Cache) Now() time.Time {
+	if at := c.appliedAt.Load(); at != 0 {
+		return time.UnixMilli(at)
+	}
+	return c.clock.Now()
+}
+
+// ApplyAt runs fn with the cache telling the time now, to the millisecond,
+// and drawing its random numbers, such as the TTL jitter, from a source
+// seeded with seed. The writes fn makes are then the same on every cache
+// holding the same keys given the same now and seed, such as the replicas
+// applying an entry of a replicated log, whatever their clocks, and again
+// when the log is replayed
+func (c *Cache) ApplyAt(now time.Time, seed int64, fn func()) {
+	r := c.rand
+	c.rand = rand.New(rand.NewSource(seed))
+	c.appliedAt.Store(now.UnixMilli())
+	defer func() {
+		c.rand = r
+		c.appliedAt.Store(0)
+	}()
+	fn()
+}
+
+// ManualClock is a Clock standing still until it is set or advanced, so
+// that tests expire keys deterministically rather than by sleeping
+type ManualClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewManualClock returns a ManualClock telling the time now
+func NewManualClock(now time.Time) *ManualClock {
+	return &ManualClock{now: now}
+}
+
+func (m *ManualClock) Now() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.now
+}
+
+// Set makes the clock tell the time now
+func (m *ManualClock) Set(now time.Time) {
+	m.mu.Lock()
+	m.now = now
+	m.mu.Unlock()
+}
+
+// Advance moves the clock forward by d
+func (m *ManualClock) Advance(d time.Duration) {
+	m.mu.Lock()
+	m.now = m.now.Add(d)
+	m.mu.Unlock()
+}
@@ -0,0 +1,67 @@
+package cache
+
+import "github.com/golang/snappy"
+
+// compressedString is a string value stored compressed with snappy, which
+// also records the length of the original string
+type compressedString []byte
+
+// WithCompression stores the strings of at least threshold bytes
+// compressed with snappy whenever that makes them smaller, trading the CPU
+// spent compressing on writes and decompressing on reads for memory
+func WithCompression(threshold int) Option {
+	return func(c *Cache) {
+		c.compressThreshold = threshold
+	}
+}
+
+// packString returns the value stored for the string val, compressed if
+// the cache compresses strings that long and compression makes it smaller
+func (c *Cache) packString(val []byte) any {
+	if c.compressThreshold <= 0 || len(val) < c.compressThreshold {
+		return val
+	}
+	packed := snappy.Encode(nil, val)
+	if len(packed) >= len(val) {
+		return val
+	}
+	return compressedString(packed)
+}
+
+// unpack returns the string held by a compressedString
+func (v compressedString) unpack() []byte {
+	// the data was compressed by packString, so it always decodes
+	val, _ := snappy.Decode(nil, v)
+	return val
+}
+
+// CompressionStats reports the strings stored compressed
+type CompressionStats struct {
+	// Values is the number of compressed strings
+	Values int
+	// RawBytes and CompressedBytes are their total length before and
+	// after compression
+	RawBytes        int64
+	CompressedBytes int64
+}
+
+// CompressionStats walks the keyspace to report the compressed strings,
+// so it is meant for reporting only
+func (c *Cache) CompressionStats() CompressionStats {
+	var stats CompressionStats
+	for _, obj := range c.data {
+		value := obj.value
+		if checked, ok := value.(checkedString); ok {
+			value = checked.value
+		}
+		v, ok := value.(compressedString)
+		if !ok {
+			continue
+		}
+		n, _ := snappy.DecodedLen(v)
+		stats.Values++
+		stats.RawBytes += int64(n)
+		stats.CompressedBytes += int64(len(v))
+	}
+	return stats
+}
@@ -0,0 +1,409 @@
+package cache
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrNotFloat is returned when a condition compares a string that does not
+// hold a number with a number
+var ErrNotFloat = &Error{Kind: KindErr, Msg: "value is not a valid float"}
+
+const (
+	// maxConditionLen bounds the length of the expression of a condition,
+	// and with it the depth of the chains of && and || evaluated
+	maxConditionLen = 4096
+	// maxConditionDepth bounds the nesting of the negations and the
+	// parentheses of a condition, parsed by recursion
+	maxConditionDepth = 128
+)
+
+// Condition is a guard on the string held by a key, parsed by
+// ParseCondition from expressions such as
+//
+//	value > 5 && value <= 10
+//	!exists || value == 'pending'
+//	len(value) < 64
+//
+// value is the string held by the key and len(value) its length in bytes,
+// and exists tells whether the key exists. The comparisons ==, !=, <, <=, >
+// and >= compare numerically when a side is a number or len(value), and as
+// strings otherwise, the strings being quoted with ' or ". They combine
+// with &&, || and !, or AND, OR and NOT, and parentheses. The comparisons
+// of the value of a key that does not exist are false
+type Condition struct {
+	root condNode
+	src  string
+}
+
+// String returns the expression the condition was parsed from
+func (c *Condition) String() string {
+	return c.src
+}
+
+// Eval tells whether the condition holds for value, the string held by a
+// key, exists being false when the key does not exist
+func (c *Condition) Eval(value []byte, exists bool) (bool, error) {
+	return c.root.eval(value, exists)
+}
+
+// condNode is a node of the tree of a condition
+type condNode interface {
+	eval(value []byte, exists bool) (bool, error)
+}
+
+type (
+	condAnd    struct{ l, r condNode }
+	condOr     struct{ l, r condNode }
+	condNot    struct{ n condNode }
+	condExists struct{}
+	condCmp    struct {
+		op   string
+		l, r condOperand
+	}
+)
+
+func (n condAnd) eval(value []byte, exists bool) (bool, error) {
+	ok, err := n.l.eval(value, exists)
+	if !ok || err != nil {
+		return false, err
+	}
+	return n.r.eval(value, exists)
+}
+
+func (n condOr) eval(value []byte, exists bool) (bool, error) {
+	ok, err := n.l.eval(value, exists)
+	if ok || err != nil {
+		return ok, err
+	}
+	return n.r.eval(value, exists)
+}
+
+func (n condNot) eval(value []byte, exists bool) (bool, error) {
+	ok, err := n.n.eval(value, exists)
+	return !ok, err
+}
+
+func (condExists) eval(_ []byte, exists bool) (bool, error) {
+	return exists, nil
+}
+
+// condOperand is a side of a comparison: the value of the key, its
+// length, a number or a string
+type condOperand struct {
+	kind byte // 'v' for value, 'l' for len(value), 'n' for a number and 's' for a string
+	num  float64
+	str  string
+}
+
+func (n condCmp) eval(value []byte, exists bool) (bool, error) {
+	if !exists && (n.l.kind == 'v' || n.l.kind == 'l' || n.r.kind == 'v' || n.r.kind == 'l') {
+		return false, nil
+	}
+
+	numeric := n.l.kind == 'n' || n.l.kind == 'l' || n.r.kind == 'n' || n.r.kind == 'l'
+	if !numeric {
+		side := func(o condOperand) []byte {
+			if o.kind == 'v' {
+				return value
+			}
+			return []byte(o.str)
+		}
+		return compared(n.op, bytes.Compare(side(n.l), side(n.r))), nil
+	}
+
+	side := func(o condOperand) (float64, error) {
+		switch o.kind {
+		case 'v':
+			f, err := strconv.ParseFloat(string(value), 64)
+			if err != nil {
+				return 0, ErrNotFloat
+			}
+			return f, nil
+		case 'l':
+			return float64(len(value)), nil
+		case 's':
+			f, err := strconv.ParseFloat(o.str, 64)
+			if err != nil {
+				return 0, ErrNotFloat
+			}
+			return f, nil
+		}
+		return o.num, nil
+	}
+	l, err := side(n.l)
+	if err != nil {
+		return false, err
+	}
+	r, err := side(n.r)
+	if err != nil {
+		return false, err
+	}
+	cmp := 0
+	switch {
+	case l < r:
+		cmp = -1
+	case l > r:
+		cmp = 1
+	}
+	return compared(n.op, cmp), nil
+}
+
+// compared tells whether op holds between two sides comparing as cmp
+func compared(op string, cmp int) bool {
+	switch op {
+	case "==":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	}
+	return cmp >= 0
+}
+
+// ParseCondition parses the expression of a Condition
+func ParseCondition(expr string) (*Condition, error) {
+	if len(expr) > maxConditionLen {
+		return nil, Errorf(KindErr, "invalid condition: longer than %d bytes", maxConditionLen)
+	}
+	p := &condParser{src: expr}
+	p.next()
+	root, err := p.parseOr()
+	if err == nil && p.tok != "" {
+		err = fmt.Errorf("unexpected %q", p.tok)
+	}
+	if err != nil {
+		return nil, Errorf(KindErr, "invalid condition: %v", err)
+	}
+	return &Condition{root: root, src: expr}, nil
+}
+
+// condParser is a recursive descent parser of conditions, tok being the
+// token read ahead, empty at the end of the expression
+type condParser struct {
+	src    string
+	pos    int
+	tok    string
+	quoted bool
+	err    error
+	// depth is the nesting of the negations and parentheses being parsed
+	depth int
+}
+
+// enter counts a level of nesting, failing past maxConditionDepth, and
+// leave returns from it
+func (p *condParser) enter() error {
+	if p.depth++; p.depth > maxConditionDepth {
+		return fmt.Errorf("too deeply nested")
+	}
+	return nil
+}
+
+func (p *condParser) leave() {
+	p.depth--
+}
+
+// next reads the next token
+func (p *condParser) next() {
+	for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t') {
+		p.pos++
+	}
+	p.quoted = false
+	if p.pos == len(p.src) {
+		p.tok = ""
+		return
+	}
+
+	start := p.pos
+	switch c := p.src[p.pos]; {
+	case c == '\'' || c == '"':
+		var b strings.Builder
+		p.pos++
+		for p.pos < len(p.src) && p.src[p.pos] != c {
+			if p.src[p.pos] == '\\' && p.pos+1 < len(p.src) {
+				p.pos++
+			}
+			b.WriteByte(p.src[p.pos])
+			p.pos++
+		}
+		if p.pos == len(p.src) {
+			p.err = fmt.Errorf("unterminated string")
+		}
+		p.pos++
+		p.tok, p.quoted = b.String(), true
+		return
+	case strings.IndexByte("()", c) >= 0:
+		p.pos++
+	case strings.IndexByte("=!<>&|", c) >= 0:
+		p.pos++
+		if p.pos < len(p.src) && strings.IndexByte("=&|", p.src[p.pos]) >= 0 {
+			p.pos++
+		}
+	default:
+		for p.pos < len(p.src) && strings.IndexByte(" \t()=!<>&|'\"", p.src[p.pos]) < 0 {
+			p.pos++
+		}
+	}
+	p.tok = p.src[start:p.pos]
+}
+
+// is tells whether the token read ahead is one of words, not quoted, the
+// words being matched regardless of case
+func (p *condParser) is(words ...string) bool {
+	if p.quoted {
+		return false
+	}
+	for _, w := range words {
+		if strings.EqualFold(p.tok, w) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *condParser) parseOr() (condNode, error) {
+	l, err := p.parseAnd()
+	for err == nil && p.is("||", "OR") {
+		p.next()
+		var r condNode
+		if r, err = p.parseAnd(); err == nil {
+			l = condOr{l, r}
+		}
+	}
+	return l, err
+}
+
+func (p *condParser) parseAnd() (condNode, error) {
+	l, err := p.parseNot()
+	for err == nil && p.is("&&", "AND") {
+		p.next()
+		var r condNode
+		if r, err = p.parseNot(); err == nil {
+			l = condAnd{l, r}
+		}
+	}
+	return l, err
+}
+
+func (p *condParser) parseNot() (condNode, error) {
+	if p.is("!", "NOT") {
+		if err := p.enter(); err != nil {
+			return nil, err
+		}
+		defer p.leave()
+		p.next()
+		n, err := p.parseNot()
+		return condNot{n}, err
+	}
+	return p.parsePrimary()
+}
+
+func (p *condParser) parsePrimary() (condNode, error) {
+	switch {
+	case p.err != nil:
+		return nil, p.err
+	case p.tok == "" && !p.quoted:
+		return nil, fmt.Errorf("unexpected end")
+	case p.is("("):
+		if err := p.enter(); err != nil {
+			return nil, err
+		}
+		defer p.leave()
+		p.next()
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.is(")") {
+			return nil, fmt.Errorf("missing )")
+		}
+		p.next()
+		return n, nil
+	case p.is("exists"):
+		p.next()
+		return condExists{}, nil
+	}
+
+	l, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	if !p.is("==", "!=", "<", "<=", ">", ">=") {
+		return nil, fmt.Errorf("expected a comparison after %q", l.str)
+	}
+	op := p.tok
+	p.next()
+	r, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	return condCmp{op, l, r}, nil
+}
+
+func (p *condParser) parseOperand() (condOperand, error) {
+	if p.err != nil {
+		return condOperand{}, p.err
+	}
+	tok, quoted := p.tok, p.quoted
+	p.next()
+	switch {
+	case tok == "" && !quoted:
+		return condOperand{}, fmt.Errorf("unexpected end")
+	case quoted:
+		return condOperand{kind: 's', str: tok}, nil
+	case strings.EqualFold(tok, "value"):
+		return condOperand{kind: 'v', str: tok}, nil
+	case strings.EqualFold(tok, "len"):
+		if !p.is("(") {
+			return condOperand{}, fmt.Errorf("expected ( after len")
+		}
+		p.next()
+		if !p.is("value") {
+			return condOperand{}, fmt.Errorf("len only applies to value")
+		}
+		p.next()
+		if !p.is(")") {
+			return condOperand{}, fmt.Errorf("missing )")
+		}
+		p.next()
+		return condOperand{kind: 'l', str: "len(value)"}, nil
+	}
+	num, err := strconv.ParseFloat(tok, 64)
+	if err != nil {
+		return condOperand{}, fmt.Errorf("unexpected %q", tok)
+	}
+	return condOperand{kind: 'n', num: num, str: tok}, nil
+}
+
+// SetIf sets the string value at key if cond holds for the string it holds,
+// keeping its expiry, or creates it if cond holds for a missing key. It
+// reports whether the value was set and returns the value held afterwards,
+// nil if the key does not exist
+func (c *Cache) SetIf(key string, cond *Condition, value []byte) ([]byte, bool, error) {
+	var current []byte
+	obj, exists := c.lookup(key)
+	if exists {
+		var err error
+		if current, err = stringBytes(obj.value); err != nil {
+			return nil, false, err
+		}
+	}
+
+	ok, err := cond.Eval(current, exists)
+	if err != nil || !ok {
+		return current, false, err
+	}
+	if exists {
+		c.setValue(key, obj, c.encodeString(value))
+	} else {
+		c.setCreated(key, c.encodeString(value))
+	}
+	return value, true, nil
+}
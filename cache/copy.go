@@ -0,0 +1,101 @@
+package cache
+
+import "errors"
+
+// Copy duplicates the value and TTL of src into dst and reports whether the
+// copy happened. It does nothing if src does not exist, or if dst exists
+// and replace is not set
+func (c *Cache) Copy(src, dst string, replace bool) (bool, error) {
+	if src == dst {
+		return false, errors.New("source and destination objects are the same")
+	}
+
+	obj, ok := c.lookup(src)
+	if !ok {
+		return false, nil
+	}
+	if _, exists := c.lookup(dst); exists && !replace {
+		return false, nil
+	}
+
+	cp := c.newObjAt(cloneValue(obj.value), obj.expiresAt)
+	cp.staleAt = obj.staleAt
+	c.setObj(dst, cp)
+	return true, nil
+}
+
+// cloneValue returns a deep copy of a value so that mutating the copy
+// never affects the original
+func cloneValue(value any) any {
+	switch v := value.(type) {
+	case *stream:
+		return v.clone()
+	case *sortedSet:
+		z := &sortedSet{members: append([]ZMember(nil), v.members...)}
+		if v.dict != nil {
+			z.dict = make(map[string]float64, len(v.dict))
+			for member, score := range v.dict {
+				z.dict[member] = score
+			}
+		}
+		return z
+	case *bloomFilter:
+		return v.clone()
+	case *cuckooFilter:
+		return v.clone()
+	case *countMinSketch:
+		return v.clone()
+	case *topK:
+		return v.clone()
+	case *gCounter:
+		return v.clone()
+	case *orSet:
+		return v.clone()
+	case *jsonDocument:
+		return &jsonDocument{root: cloneJSON(v.root)}
+	case *moduleValue:
+		if v.typ.Copy == nil {
+			return v
+		}
+		return &moduleValue{typ: v.typ, value: v.typ.Copy(v.value)}
+	case []byte:
+		return append([]byte{}, v...)
+	case compressedString:
+		return append(compressedString{}, v...)
+	case checkedString:
+		return checkedString{value: cloneValue(v.value), crc: v.crc}
+	default:
+		return v
+	}
+}
+
+func (st *stream) clone() *stream {
+	cp := &stream{
+		entries: make([]StreamEntry, len(st.entries)),
+		lastID:  st.lastID,
+	}
+	for i, entry := range st.entries {
+		cp.entries[i] = StreamEntry{ID: entry.ID, Fields: append([]string(nil), entry.Fields...)}
+	}
+
+	if st.groups == nil {
+		return cp
+	}
+	cp.groups = make(map[string]*consumerGroup, len(st.groups))
+	for name, g := range st.groups {
+		cg := newConsumerGroup(g.lastDelivered)
+		for consName, cons := range g.consumers {
+			cg.consumers[consName] = &consumer{
+				seenAt:  cons.seenAt,
+				pending: make(map[StreamID]*pendingEntry, len(cons.pending)),
+			}
+		}
+		for id, pe := range g.pending {
+			cpe := *pe
+			cg.pending[id] = &cpe
+			cg.consumers[pe.consumer].pending[id] = &cpe
+		}
+		cp.groups[name] = cg
+	}
+	return cp
+}
@@ -0,0 +1,138 @@
+package cache
+
+import (
+	"errors"
+	"math"
+)
+
+// countMinSketch estimates the counts of items with depth rows of width
+// counters, each item counted once per row in a counter picked by hashing.
+// Collisions only add to a counter, so the smallest of the counters of an
+// item is an estimate that never undercounts
+type countMinSketch struct {
+	width, depth uint64
+	counters     []uint64
+}
+
+func newCountMinSketch(width, depth uint64) (*countMinSketch, error) {
+	if width == 0 || depth == 0 {
+		return nil, errors.New("invalid width/depth")
+	}
+	if width > maxFilterBits/64/depth {
+		return nil, errFilterTooBig
+	}
+	return &countMinSketch{width: width, depth: depth, counters: make([]uint64, width*depth)}, nil
+}
+
+// cell returns the index in cms.counters of the counter of item in row i
+func (cms *countMinSketch) cell(h1, h2, i uint64) uint64 {
+	return i*cms.width + (h1+i*h2)%cms.width
+}
+
+func (cms *countMinSketch) incrBy(item []byte, n uint64) uint64 {
+	h1, h2 := filterHashes(item)
+	min := uint64(math.MaxUint64)
+	for i := uint64(0); i < cms.depth; i++ {
+		j := cms.cell(h1, h2, i)
+		if cms.counters[j] > math.MaxUint64-n {
+			cms.counters[j] = math.MaxUint64
+		} else {
+			cms.counters[j] += n
+		}
+		if cms.counters[j] < min {
+			min = cms.counters[j]
+		}
+	}
+	return min
+}
+
+func (cms *countMinSketch) query(item []byte) uint64 {
+	h1, h2 := filterHashes(item)
+	min := uint64(math.MaxUint64)
+	for i := uint64(0); i < cms.depth; i++ {
+		if n := cms.counters[cms.cell(h1, h2, i)]; n < min {
+			min = n
+		}
+	}
+	return min
+}
+
+func (cms *countMinSketch) clone() *countMinSketch {
+	cp := *cms
+	cp.counters = append([]uint64(nil), cms.counters...)
+	return &cp
+}
+
+func (c *Cache) getCountMinSketch(key string) (*countMinSketch, error) {
+	obj, ok := c.lookup(key)
+	if !ok {
+		return nil, ErrNoSuchKey
+	}
+
+	cms, ok := obj.value.(*countMinSketch)
+	if !ok {
+		return nil, ErrWrongType
+	}
+	return cms, nil
+}
+
+// CMSInitByDim creates an empty count-min sketch at key with depth rows of
+// width counters
+func (c *Cache) CMSInitByDim(key string, width, depth uint64) error {
+	if _, exists := c.lookup(key); exists {
+		return ErrItemExists
+	}
+
+	cms, err := newCountMinSketch(width, depth)
+	if err != nil {
+		return err
+	}
+	c.setCreated(key, cms)
+	return nil
+}
+
+// CMSInitByProb creates an empty count-min sketch at key sized, as in
+// RedisBloom, for its estimates to exceed the counts by at most errorRate
+// of the total count with the given probability of failure
+func (c *Cache) CMSInitByProb(key string, errorRate, probability float64) error {
+	if errorRate <= 0 || errorRate >= 1 || probability <= 0 || probability >= 1 {
+		return errors.New("invalid overestimation value")
+	}
+
+	width := math.Ceil(2 / errorRate)
+	depth := math.Ceil(math.Log(probability) / math.Log(0.5))
+	if width*depth > maxFilterBits/64 {
+		return errFilterTooBig
+	}
+	return c.CMSInitByDim(key, uint64(width), uint64(depth))
+}
+
+// CMSIncrBy increments the counts of items by the matching increments in
+// the count-min sketch stored at key and returns their new estimates
+func (c *Cache) CMSIncrBy(key string, items [][]byte, increments []uint64) ([]uint64, error) {
+	cms, err := c.getCountMinSketch(key)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make([]uint64, len(items))
+	for i, item := range items {
+		counts[i] = cms.incrBy(item, increments[i])
+	}
+	return counts, nil
+}
+
+// CMSQuery returns the estimated counts of items in the count-min sketch
+// stored at key
+func (c *Cache) CMSQuery(key string, items ...[]byte) ([]uint64, error) {
+	cms, err := c.getCountMinSketch(key)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make([]uint64, len(items))
+	for i, item := range items {
+		counts[i] = cms.query(item)
+	}
+	return counts, nil
+}
@@ -0,0 +1,324 @@
+package cache
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+// errNotCRDT is returned by CRDTMerge for payloads of other types
+var errNotCRDT = errors.New("the payload is not a counter or a set of the CRDT commands")
+
+// gCounter is a grow-only counter replicated without coordination: every
+// replica increments its own count only, and merging two states keeps the
+// largest count of each replica, so that the value, the sum of the counts,
+// converges whatever the order the states are merged in
+type gCounter struct {
+	counts map[string]uint64
+}
+
+func (gc *gCounter) value() uint64 {
+	var sum uint64
+	for _, n := range gc.counts {
+		sum += n
+	}
+	return sum
+}
+
+func (gc *gCounter) merge(other *gCounter) {
+	for replica, n := range other.counts {
+		if n > gc.counts[replica] {
+			gc.counts[replica] = n
+		}
+	}
+}
+
+func (gc *gCounter) clone() *gCounter {
+	cp := &gCounter{counts: make(map[string]uint64, len(gc.counts))}
+	for replica, n := range gc.counts {
+		cp.counts[replica] = n
+	}
+	return cp
+}
+
+// orSet is an observed-remove set replicated without coordination: every
+// add tags the member with a tag unique across the replicas, and a remove
+// deletes the tags of the member it observed, remembering them. A member is
+// in the set while it has a tag not removed, so that an add concurrent
+// with a remove wins. adds holds only the tags not removed
+type orSet struct {
+	adds    map[string]map[orTag]struct{}
+	removed map[orTag]struct{}
+}
+
+// orTag identifies an add by the replica and its CRDT clock at the time
+type orTag struct {
+	replica string
+	clock   int64
+}
+
+func newORSet() *orSet {
+	return &orSet{adds: make(map[string]map[orTag]struct{}), removed: make(map[orTag]struct{})}
+}
+
+func (s *orSet) add(member string, tag orTag) {
+	tags, ok := s.adds[member]
+	if !ok {
+		tags = make(map[orTag]struct{}, 1)
+		s.adds[member] = tags
+	}
+	tags[tag] = struct{}{}
+}
+
+func (s *orSet) remove(member string) bool {
+	tags, ok := s.adds[member]
+	if !ok {
+		return false
+	}
+	for tag := range tags {
+		s.removed[tag] = struct{}{}
+	}
+	delete(s.adds, member)
+	return true
+}
+
+func (s *orSet) merge(other *orSet) {
+	for tag := range other.removed {
+		s.removed[tag] = struct{}{}
+	}
+	for member, tags := range other.adds {
+		for tag := range tags {
+			if _, ok := s.removed[tag]; !ok {
+				s.add(member, tag)
+			}
+		}
+	}
+	// drop the local tags the other replica removed
+	for member, tags := range s.adds {
+		for tag := range tags {
+			if _, ok := s.removed[tag]; ok {
+				delete(tags, tag)
+			}
+		}
+		if len(tags) == 0 {
+			delete(s.adds, member)
+		}
+	}
+}
+
+func (s *orSet) members() []string {
+	members := make([]string, 0, len(s.adds))
+	for member := range s.adds {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	return members
+}
+
+func (s *orSet) clone() *orSet {
+	cp := newORSet()
+	for member, tags := range s.adds {
+		for tag := range tags {
+			cp.add(member, tag)
+		}
+	}
+	for tag := range s.removed {
+		cp.removed[tag] = struct{}{}
+	}
+	return cp
+}
+
+// crdtTick returns a clock value larger than any returned before, starting
+// from the current time so that the tags stay unique across restarts
+func (c *Cache) crdtTick() int64 {
+	now := time.Now().UnixNano()
+	if now <= c.crdtClock {
+		now = c.crdtClock + 1
+	}
+	c.crdtClock = now
+	return now
+}
+
+func (c *Cache) getGCounter(key string, create bool) (*gCounter, error) {
+	obj, ok := c.lookup(key)
+	if !ok {
+		if !create {
+			return nil, ErrNoSuchKey
+		}
+		gc := &gCounter{counts: make(map[string]uint64)}
+		c.setCreated(key, gc)
+		return gc, nil
+	}
+
+	gc, ok := obj.value.(*gCounter)
+	if !ok {
+		return nil, ErrWrongType
+	}
+	return gc, nil
+}
+
+func (c *Cache) getORSet(key string, create bool) (*orSet, error) {
+	obj, ok := c.lookup(key)
+	if !ok {
+		if !create {
+			return nil, ErrNoSuchKey
+		}
+		s := newORSet()
+		c.setCreated(key, s)
+		return s, nil
+	}
+
+	s, ok := obj.value.(*orSet)
+	if !ok {
+		return nil, ErrWrongType
+	}
+	return s, nil
+}
+
+// GCounterIncrBy adds n to the count of replica in the grow-only counter
+// stored at key, creating it if needed, and returns the new value of the
+// counter
+func (c *Cache) GCounterIncrBy(key, replica string, n uint64) (uint64, error) {
+	gc, err := c.getGCounter(key, true)
+	if err != nil {
+		return 0, err
+	}
+	gc.counts[replica] += n
+	return gc.value(), nil
+}
+
+// GCounterGet returns the value of the grow-only counter stored at key
+func (c *Cache) GCounterGet(key string) (uint64, error) {
+	gc, err := c.getGCounter(key, false)
+	if err != nil {
+		return 0, err
+	}
+	return gc.value(), nil
+}
+
+// ORSetAdd adds members to the observed-remove set stored at key, tagging
+// them for replica and creating the set if needed, and returns the number
+// of members that were not in the set
+func (c *Cache) ORSetAdd(key, replica string, members ...string) (int, error) {
+	s, err := c.getORSet(key, true)
+	if err != nil {
+		return 0, err
+	}
+
+	// the members already in the set are tagged again, for the add to win
+	// over the removes of the other replicas that did not observe it
+	added := 0
+	for _, member := range members {
+		if _, ok := s.adds[member]; !ok {
+			added++
+		}
+		s.add(member, orTag{replica: replica, clock: c.crdtTick()})
+	}
+	return added, nil
+}
+
+// ORSetRemove removes members from the observed-remove set stored at key
+// and returns the number of members that were in the set. The set is kept
+// once empty, to remember the removals for the other replicas
+func (c *Cache) ORSetRemove(key string, members ...string) (int, error) {
+	s, err := c.getORSet(key, false)
+	if err == ErrNoSuchKey {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, member := range members {
+		if s.remove(member) {
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// ORSetMembers returns the members of the observed-remove set stored at
+// key in lexicographical order
+func (c *Cache) ORSetMembers(key string) ([]string, error) {
+	s, err := c.getORSet(key, false)
+	if err == ErrNoSuchKey {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.members(), nil
+}
+
+// ORSetIsMember reports whether member is in the observed-remove set
+// stored at key
+func (c *Cache) ORSetIsMember(key, member string) (bool, error) {
+	s, err := c.getORSet(key, false)
+	if err == ErrNoSuchKey {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	_, ok := s.adds[member]
+	return ok, nil
+}
+
+// DumpCRDT serializes the counter or set of the CRDT commands stored at
+// key as Dump, reporting false if key holds no such value
+func (c *Cache) DumpCRDT(key string) ([]byte, bool) {
+	obj, ok := c.lookup(key)
+	if !ok {
+		return nil, false
+	}
+	switch obj.value.(type) {
+	case *gCounter, *orSet:
+		return encodeValue(obj.value), true
+	default:
+		return nil, false
+	}
+}
+
+// CRDTKeys returns the keys holding a counter or a set of the CRDT commands
+func (c *Cache) CRDTKeys() []string {
+	var keys []string
+	now := c.Now().UnixMilli()
+	for key, obj := range c.data {
+		if c.expired(obj, now) {
+			continue
+		}
+		switch obj.value.(type) {
+		case *gCounter, *orSet:
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// CRDTMerge merges the state of a counter or a set produced by DumpCRDT on
+// another replica into the one stored at key, creating it if needed
+func (c *Cache) CRDTMerge(key string, payload []byte) error {
+	value, err := decodeValue(payload)
+	if err != nil {
+		return err
+	}
+
+	switch v := value.(type) {
+	case *gCounter:
+		gc, err := c.getGCounter(key, true)
+		if err != nil {
+			return err
+		}
+		gc.merge(v)
+	case *orSet:
+		s, err := c.getORSet(key, true)
+		if err != nil {
+			return err
+		}
+		s.merge(v)
+	default:
+		return errNotCRDT
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+package cache
+
+import (
+	"errors"
+	"math/rand"
+)
+
+const (
+	// DefaultCuckooCapacity is that of the cuckoo filters created by CFAdd
+	DefaultCuckooCapacity = 1024
+	cuckooBucketSize      = 4
+	// cuckooMaxKicks bounds the fingerprints relocated to make room for
+	// a new one before the filter is deemed full
+	cuckooMaxKicks = 500
+)
+
+// cuckooFilter is a cuckoo filter of 16 bit fingerprints in buckets of
+// cuckooBucketSize slots. Each item may live in one of two buckets, the
+// second derived from the first and its fingerprint, so that fingerprints
+// can be moved between them without knowing the items. Unlike a bloom
+// filter it supports deletion, but has a fixed capacity
+type cuckooFilter struct {
+	// slots holds the fingerprints of the buckets in turn, 0 for empty
+	slots []uint16
+	count uint64
+}
+
+func newCuckooFilter(capacity uint64) (*cuckooFilter, error) {
+	buckets := uint64(1)
+	for buckets*cuckooBucketSize < capacity {
+		buckets <<= 1
+		if buckets*cuckooBucketSize*16 > maxFilterBits {
+			return nil, errFilterTooBig
+		}
+	}
+	return &cuckooFilter{slots: make([]uint16, buckets*cuckooBucketSize)}, nil
+}
+
+func (cf *cuckooFilter) buckets() uint64 {
+	return uint64(len(cf.slots)) / cuckooBucketSize
+}
+
+// locate returns the fingerprint of item and its first bucket
+func (cf *cuckooFilter) locate(item []byte) (uint16, uint64) {
+	h, _ := filterHashes(item)
+	fp := uint16(h >> 48)
+	if fp == 0 {
+		fp = 1
+	}
+	return fp, h & (cf.buckets() - 1)
+}
+
+// altBucket returns the other bucket of a fingerprint in bucket i, so that
+// altBucket(altBucket(i, fp), fp) is i
+func (cf *cuckooFilter) altBucket(i uint64, fp uint16) uint64 {
+	return (i ^ mix64(uint64(fp))) & (cf.buckets() - 1)
+}
+
+func (cf *cuckooFilter) bucket(i uint64) []uint16 {
+	return cf.slots[i*cuckooBucketSize : (i+1)*cuckooBucketSize]
+}
+
+func (cf *cuckooFilter) insertIn(i uint64, fp uint16) bool {
+	b := cf.bucket(i)
+	for j := range b {
+		if b[j] == 0 {
+			b[j] = fp
+			return true
+		}
+	}
+	return false
+}
+
+func (cf *cuckooFilter) removeFrom(i uint64, fp uint16) bool {
+	b := cf.bucket(i)
+	for j := range b {
+		if b[j] == fp {
+			b[j] = 0
+			return true
+		}
+	}
+	return false
+}
+
+func (cf *cuckooFilter) hasIn(i uint64, fp uint16) bool {
+	for _, f := range cf.bucket(i) {
+		if f == fp {
+			return true
+		}
+	}
+	return false
+}
+
+func (cf *cuckooFilter) has(item []byte) bool {
+	fp, i := cf.locate(item)
+	return cf.hasIn(i, fp) || cf.hasIn(cf.altBucket(i, fp), fp)
+}
+
+// add adds item to the filter, relocating fingerprints to make room for it
+// if both its buckets are full, picked with rnd. When no room can be made
+// the relocations are undone so that no item already added is lost
+func (cf *cuckooFilter) add(item []byte, rnd *rand.Rand) error {
+	fp, i := cf.locate(item)
+	alt := cf.altBucket(i, fp)
+	if cf.insertIn(i, fp) || cf.insertIn(alt, fp) {
+		cf.count++
+		return nil
+	}
+
+	if rnd.Intn(2) == 1 {
+		i = alt
+	}
+	kicked := make([]uint64, 0, cuckooMaxKicks)
+	for n := 0; n < cuckooMaxKicks; n++ {
+		j := i*cuckooBucketSize + uint64(rnd.Intn(cuckooBucketSize))
+		fp, cf.slots[j] = cf.slots[j], fp
+		kicked = append(kicked, j)
+		i = cf.altBucket(i, fp)
+		if cf.insertIn(i, fp) {
+			cf.count++
+			return nil
+		}
+	}
+
+	for n := len(kicked) - 1; n >= 0; n-- {
+		j := kicked[n]
+		fp, cf.slots[j] = cf.slots[j], fp
+	}
+	return ErrFilterFull
+}
+
+// remove removes one occurrence of item from the filter and reports
+// whether it was found. Removing an item that was never added may remove
+// another item sharing its fingerprint
+func (cf *cuckooFilter) remove(item []byte) bool {
+	fp, i := cf.locate(item)
+	if cf.removeFrom(i, fp) || cf.removeFrom(cf.altBucket(i, fp), fp) {
+		cf.count--
+		return true
+	}
+	return false
+}
+
+func (cf *cuckooFilter) clone() *cuckooFilter {
+	return &cuckooFilter{slots: append([]uint16(nil), cf.slots...), count: cf.count}
+}
+
+// getCuckooFilter returns the cuckoo filter stored at key or nil if the key
+// does not exist
+func (c *Cache) getCuckooFilter(key string) (*cuckooFilter, error) {
+	obj, ok := c.lookup(key)
+	if !ok {
+		return nil, nil
+	}
+
+	cf, ok := obj.value.(*cuckooFilter)
+	if !ok {
+		return nil, ErrWrongType
+	}
+	return cf, nil
+}
+
+// CFReserve creates an empty cuckoo filter at key holding at least
+// capacity items
+func (c *Cache) CFReserve(key string, capacity uint64) error {
+	if capacity == 0 {
+		return errors.New("(capacity should be larger than 0)")
+	}
+	if _, exists := c.lookup(key); exists {
+		return ErrItemExists
+	}
+
+	cf, err := newCuckooFilter(capacity)
+	if err != nil {
+		return err
+	}
+	c.setCreated(key, cf)
+	return nil
+}
+
+// CFAdd adds item to the cuckoo filter stored at key, creating it with the
+// default capacity if needed. Unless nx is set the item is added again if
+// it may be there already, so that it survives one deletion more, and the
+// result reports whether it was added
+func (c *Cache) CFAdd(key string, item []byte, nx bool) (bool, error) {
+	cf, err := c.getCuckooFilter(key)
+	if err != nil {
+		return false, err
+	}
+	if cf == nil {
+		if cf, err = newCuckooFilter(DefaultCuckooCapacity); err != nil {
+			return false, err
+		}
+		c.setCreated(key, cf)
+	}
+
+	if nx && cf.has(item) {
+		return false, nil
+	}
+	if err := cf.add(item, c.rand); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// CFExists reports whether item may have been added to the cuckoo filter
+// stored at key
+func (c *Cache) CFExists(key string, item []byte) (bool, error) {
+	cf, err := c.getCuckooFilter(key)
+	if err != nil || cf == nil {
+		return false, err
+	}
+	return cf.has(item), nil
+}
+
+// CFDel removes one occurrence of item from the cuckoo filter stored at
+// key and reports whether it was found, failing with ErrNoSuchKey if the
+// key does not exist
+func (c *Cache) CFDel(key string, item []byte) (bool, error) {
+	cf, err := c.getCuckooFilter(key)
+	if err != nil {
+		return false, err
+	}
+	if cf == nil {
+		return false, ErrNoSuchKey
+	}
+	return cf.remove(item), nil
+}
@@ -0,0 +1,43 @@
+package cache
+
+import (
+	"strings"
+	"time"
+)
+
+// WithDefaultTTL gives the keys written by a command without an expiry,
+// such as SET without EX or the first ZADD of a sorted set, the TTL of the
+// longest of the prefixes of prefixTTLs they start with, or ttl if they
+// start with none, so that the keys expire even when their writer forgets
+// to set a TTL. A TTL of zero leaves the keys without an expiry, to exempt
+// a prefix from the default. The TTLs are shortened by the jitter of
+// WithTTLJitter like the others. The keys restored, copied, loaded from
+// the backing store or written by a batch keep the expiry they are given,
+// and PERSIST still removes the expiry of a key, until its next write
+func WithDefaultTTL(ttl time.Duration, prefixTTLs map[string]time.Duration) Option {
+	return func(c *Cache) {
+		c.defaultTTL = ttl
+		c.prefixTTLs = prefixTTLs
+	}
+}
+
+// ttlOf returns the default TTL of key, zero for none
+func (c *Cache) ttlOf(key string) time.Duration {
+	ttl, longest := c.defaultTTL, -1
+	for prefix, prefixTTL := range c.prefixTTLs {
+		if strings.HasPrefix(key, prefix) && len(prefix) > longest {
+			ttl, longest = prefixTTL, len(prefix)
+		}
+	}
+	return ttl
+}
+
+// setCreated stores value at key for a command writing it without an
+// expiry, applying the default TTL of the key
+func (c *Cache) setCreated(key string, value any) {
+	expiresAt := int64(-1)
+	if ttl := c.ttlOf(key); ttl > 0 {
+		expiresAt = c.expiry(ttl)
+	}
+	c.setObj(key, c.newObjAt(value, expiresAt))
+}
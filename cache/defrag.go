@@ -0,0 +1,100 @@
+package cache
+
+import "time"
+
+const (
+	// defragBatch is the number of keys visited between two checks of the
+	// budget of Defrag
+	defragBatch = 64
+	// defragMaxEffort is the number of elements above which a collection
+	// is left in place, copying it holding the goroutine too long
+	defragMaxEffort = 1024
+)
+
+// defragger holds the progress of Defrag over the keyspace
+type defragger struct {
+	// visited is the number of keys visited by the current pass
+	visited int
+	// reallocated and passes count the keys reallocated and the passes
+	// completed
+	reallocated, passes int64
+}
+
+// DefragStats reports the activity of Defrag
+type DefragStats struct {
+	// Reallocated counts the keys whose value was moved to a fresh
+	// allocation, and Passes the passes over the keyspace completed
+	Reallocated, Passes int64
+}
+
+// DefragStats returns the counters of Defrag
+func (c *Cache) DefragStats() DefragStats {
+	return DefragStats{Reallocated: c.defrag.reallocated, Passes: c.defrag.passes}
+}
+
+// Defrag moves the keys and their values to fresh allocations, a batch at
+// a time until budget is spent. Go never moves the objects it allocates,
+// so the spans of the heap holding a few old keys among the memory freed
+// around them stay in use; moving those keys lets the garbage collector
+// free the spans and the runtime return them to the OS. The batches start
+// wherever the iteration of the keyspace does, at random, and a pass is
+// complete once it visited as many keys as the keyspace holds, which
+// Defrag reports. The strings spilled to disk, the module values and the
+// collections of more than 1024 elements are left in place, and so are
+// the headers of the keys with WithEntrySlabs
+func (c *Cache) Defrag(budget time.Duration) bool {
+	if len(c.data) == 0 {
+		return true
+	}
+
+	start := time.Now()
+	d := &c.defrag
+	for {
+		n := 0
+		for key, o := range c.data {
+			if n == defragBatch {
+				break
+			}
+			n++
+			switch o.value.(type) {
+			case spilledString, *moduleValue:
+				continue
+			}
+			if valueEffort(o.value) > defragMaxEffort {
+				continue
+			}
+			if c.objs != nil {
+				// the header stays in its slab, which moving it would not
+				// free
+				o.value = defragValue(o.value)
+			} else {
+				cp := *o
+				cp.value = defragValue(o.value)
+				c.data[key] = &cp
+			}
+			d.reallocated++
+		}
+
+		if d.visited += n; d.visited >= len(c.data) {
+			d.visited = 0
+			d.passes++
+			return true
+		}
+		if time.Since(start) >= budget {
+			return false
+		}
+	}
+}
+
+// defragValue returns a copy of value in fresh allocations, as cloneValue
+// does but for the embedded strings it shares
+func defragValue(value any) any {
+	switch v := value.(type) {
+	case embeddedString:
+		return newEmbeddedString(v.bytes())
+	case checkedString:
+		return checkedString{value: defragValue(v.value), crc: v.crc}
+	default:
+		return cloneValue(v)
+	}
+}
@@ -0,0 +1,652 @@
+package cache
+
+import (
+	"bytes"
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"hash/crc64"
+	"math"
+	"sort"
+	"time"
+)
+
+// The serialization format produced by Dump is
+//
+//	<type byte> <payload> <version uint16 LE> <crc64 uint64 LE>
+//
+// where the CRC (ECMA polynomial) covers everything before it. Integers in
+// the payload are uvarints and strings are uvarint length prefixed
+
+const dumpVersion uint16 = 1
+
+const (
+	dumpTypeString byte = iota
+	dumpTypeStream
+	dumpTypeSortedSet
+	// dumpTypeModule payloads hold the data type name followed by
+	// the output of its Encode function
+	dumpTypeModule
+	dumpTypeBloom
+	dumpTypeCuckoo
+	dumpTypeCountMin
+	dumpTypeTopK
+	dumpTypeJSON
+	dumpTypeGCounter
+	dumpTypeORSet
+)
+
+var (
+	// ErrBusyKey is returned by Restore when the target key already exists
+	ErrBusyKey = &Error{Kind: KindBusyKey, Msg: "Target key name already exists"}
+	// ErrBadDump is returned by Restore for corrupted or unsupported payloads
+	ErrBadDump = errors.New("DUMP payload version or checksum are wrong")
+)
+
+var crcTable = crc64.MakeTable(crc64.ECMA)
+
+// Dump serializes the value stored at key, reporting false if the key does
+// not exist. The TTL is not part of the payload. It fails with ErrCorrupt
+// for a string that no longer matches its checksum, rather than passing it
+// on with a payload checksum of its own
+func (c *Cache) Dump(key string) ([]byte, bool, error) {
+	obj, ok := c.lookup(key)
+	if !ok {
+		return nil, false, nil
+	}
+
+	if v, ok := obj.value.(checkedString); ok {
+		if _, err := v.bytes(); err != nil {
+			return nil, false, err
+		}
+	}
+	return encodeValue(obj.value), true, nil
+}
+
+// Restore creates key from a payload produced by Dump, expiring it at
+// the given unix time in milliseconds or never if expiresAt is -1
+// Unless replace is set an existing key makes Restore fail with ErrBusyKey
+func (c *Cache) Restore(key string, payload []byte, expiresAt int64, replace bool) error {
+	if _, exists := c.lookup(key); exists && !replace {
+		return ErrBusyKey
+	}
+
+	value, err := decodeValue(payload)
+	if err != nil {
+		return err
+	}
+	c.store(key, value, expiresAt)
+	return nil
+}
+
+// store stores a value restored or written by a batch at key, encoding it
+// as the values written by commands are
+func (c *Cache) store(key string, value any, expiresAt int64) {
+	if expiresAt != -1 && expiresAt <= c.Now().UnixMilli() && c.expireMode != ExpireKeep {
+		// restoring an already expired key is the same as deleting it
+		c.deleteObj(key)
+		return
+	}
+
+	switch v := value.(type) {
+	case []byte:
+		value = c.encodeString(v)
+	case *sortedSet:
+		c.fitSortedSet(v, v.members...)
+	}
+	c.setObj(key, c.newObjAt(value, expiresAt))
+}
+
+// encodeValue serializes a value of any supported type with its
+// version trailer and checksum
+func encodeValue(value any) []byte {
+	e := &encoder{}
+
+	switch v := value.(type) {
+	case []byte, intString, embeddedString, compressedString, checkedString:
+		str, _ := stringBytes(v)
+		e.buf.WriteByte(dumpTypeString)
+		e.bytes(str)
+	case *stream:
+		e.buf.WriteByte(dumpTypeStream)
+		e.stream(v)
+	case *sortedSet:
+		e.buf.WriteByte(dumpTypeSortedSet)
+		e.uint(uint64(len(v.members)))
+		for _, m := range v.members {
+			e.string(m.Member)
+			e.float(m.Score)
+		}
+	case *bloomFilter:
+		e.buf.WriteByte(dumpTypeBloom)
+		e.bloom(v)
+	case *cuckooFilter:
+		e.buf.WriteByte(dumpTypeCuckoo)
+		e.cuckoo(v)
+	case *countMinSketch:
+		e.buf.WriteByte(dumpTypeCountMin)
+		e.uint(v.width)
+		e.uint(v.depth)
+		for _, n := range v.counters {
+			e.uint(n)
+		}
+	case *topK:
+		e.buf.WriteByte(dumpTypeTopK)
+		e.topK(v)
+	case *gCounter:
+		e.buf.WriteByte(dumpTypeGCounter)
+		e.gCounter(v)
+	case *orSet:
+		e.buf.WriteByte(dumpTypeORSet)
+		e.orSet(v)
+	case *jsonDocument:
+		e.buf.WriteByte(dumpTypeJSON)
+		e.bytes(marshalJSON(v.root))
+	case *moduleValue:
+		e.buf.WriteByte(dumpTypeModule)
+		e.string(v.typ.Name)
+		e.bytes(v.typ.Encode(v.value))
+	}
+
+	binary.Write(&e.buf, binary.LittleEndian, dumpVersion)
+	binary.Write(&e.buf, binary.LittleEndian, crc64.Checksum(e.buf.Bytes(), crcTable))
+	return e.buf.Bytes()
+}
+
+// decodeValue verifies the trailer of a serialized value and decodes it
+func decodeValue(payload []byte) (any, error) {
+	if len(payload) < 11 {
+		return nil, ErrBadDump
+	}
+
+	body, trailer := payload[:len(payload)-8], payload[len(payload)-8:]
+	if crc64.Checksum(body, crcTable) != binary.LittleEndian.Uint64(trailer) {
+		return nil, ErrBadDump
+	}
+	if binary.LittleEndian.Uint16(body[len(body)-2:]) > dumpVersion {
+		return nil, ErrBadDump
+	}
+
+	d := &decoder{buf: body[1 : len(body)-2]}
+	var value any
+	switch body[0] {
+	case dumpTypeString:
+		value = d.bytes()
+	case dumpTypeStream:
+		value = d.stream()
+	case dumpTypeSortedSet:
+		value = d.sortedSet()
+	case dumpTypeBloom:
+		value = d.bloom()
+	case dumpTypeCuckoo:
+		value = d.cuckoo()
+	case dumpTypeCountMin:
+		value = d.countMin()
+	case dumpTypeTopK:
+		value = d.topK()
+	case dumpTypeGCounter:
+		value = d.gCounter()
+	case dumpTypeORSet:
+		value = d.orSet()
+	case dumpTypeJSON:
+		root, err := parseJSON(d.next())
+		if err != nil {
+			return nil, ErrBadDump
+		}
+		value = &jsonDocument{root: root}
+	case dumpTypeModule:
+		t, ok := dataTypes[d.string()]
+		if !ok {
+			return nil, ErrBadDump
+		}
+		data := d.bytes()
+		if d.err != nil {
+			return nil, ErrBadDump
+		}
+		v, err := t.Decode(data)
+		if err != nil {
+			return nil, ErrBadDump
+		}
+		value = &moduleValue{typ: t, value: v}
+	default:
+		return nil, ErrBadDump
+	}
+
+	if d.err != nil || len(d.buf) != 0 {
+		return nil, ErrBadDump
+	}
+	return value, nil
+}
+
+type encoder struct {
+	buf bytes.Buffer
+}
+
+func (e *encoder) uint(n uint64) {
+	var tmp [binary.MaxVarintLen64]byte
+	e.buf.Write(tmp[:binary.PutUvarint(tmp[:], n)])
+}
+
+func (e *encoder) int(n int64) {
+	var tmp [binary.MaxVarintLen64]byte
+	e.buf.Write(tmp[:binary.PutVarint(tmp[:], n)])
+}
+
+func (e *encoder) float(f float64) {
+	binary.Write(&e.buf, binary.LittleEndian, math.Float64bits(f))
+}
+
+func (e *encoder) string(s string) {
+	e.uint(uint64(len(s)))
+	e.buf.WriteString(s)
+}
+
+func (e *encoder) bytes(b []byte) {
+	e.uint(uint64(len(b)))
+	e.buf.Write(b)
+}
+
+func (e *encoder) id(id StreamID) {
+	e.uint(id.Ms)
+	e.uint(id.Seq)
+}
+
+// stream writes the groups, consumers and pending entries sorted, so that
+// equal streams have equal payloads
+func (e *encoder) stream(st *stream) {
+	e.id(st.lastID)
+	e.uint(uint64(len(st.entries)))
+	for _, entry := range st.entries {
+		e.id(entry.ID)
+		e.uint(uint64(len(entry.Fields)))
+		for _, field := range entry.Fields {
+			e.string(field)
+		}
+	}
+
+	names := make([]string, 0, len(st.groups))
+	for name := range st.groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	e.uint(uint64(len(names)))
+	for _, name := range names {
+		g := st.groups[name]
+		e.string(name)
+		e.id(g.lastDelivered)
+
+		consNames := make([]string, 0, len(g.consumers))
+		for consName := range g.consumers {
+			consNames = append(consNames, consName)
+		}
+		sort.Strings(consNames)
+		e.uint(uint64(len(consNames)))
+		for _, consName := range consNames {
+			e.string(consName)
+			e.int(g.consumers[consName].seenAt.UnixMilli())
+		}
+
+		ids := make([]StreamID, 0, len(g.pending))
+		for id := range g.pending {
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i].Less(ids[j]) })
+		e.uint(uint64(len(ids)))
+		for _, id := range ids {
+			pe := g.pending[id]
+			e.id(id)
+			e.string(pe.consumer)
+			e.int(pe.deliveredAt.UnixMilli())
+			e.uint(uint64(pe.deliveryCount))
+		}
+	}
+}
+
+func (e *encoder) bloom(bf *bloomFilter) {
+	e.float(bf.errorRate)
+	e.uint(uint64(len(bf.layers)))
+	for _, l := range bf.layers {
+		e.uint(l.capacity)
+		e.uint(l.count)
+		e.uint(l.hashes)
+		e.uint(uint64(len(l.bits)))
+		for _, w := range l.bits {
+			binary.Write(&e.buf, binary.LittleEndian, w)
+		}
+	}
+}
+
+func (e *encoder) cuckoo(cf *cuckooFilter) {
+	e.uint(cf.count)
+	e.uint(uint64(len(cf.slots)))
+	for _, fp := range cf.slots {
+		binary.Write(&e.buf, binary.LittleEndian, fp)
+	}
+}
+
+func (e *encoder) topK(tk *topK) {
+	e.uint(tk.k)
+	e.uint(tk.width)
+	e.uint(tk.depth)
+	e.float(tk.decay)
+	for _, b := range tk.buckets {
+		e.uint(b.fingerprint)
+		e.uint(b.count)
+	}
+	e.uint(uint64(len(tk.heap.items)))
+	for _, item := range tk.heap.items {
+		e.string(item.Item)
+		e.uint(item.Count)
+	}
+}
+
+// gCounter writes the counts sorted by replica, so that equal counters
+// have equal payloads
+func (e *encoder) gCounter(gc *gCounter) {
+	replicas := make([]string, 0, len(gc.counts))
+	for replica := range gc.counts {
+		replicas = append(replicas, replica)
+	}
+	sort.Strings(replicas)
+	e.uint(uint64(len(replicas)))
+	for _, replica := range replicas {
+		e.string(replica)
+		e.uint(gc.counts[replica])
+	}
+}
+
+func (e *encoder) orSet(s *orSet) {
+	members := s.members()
+	e.uint(uint64(len(members)))
+	for _, member := range members {
+		e.string(member)
+		e.orTags(s.adds[member])
+	}
+	e.orTags(s.removed)
+}
+
+func (e *encoder) orTags(tags map[orTag]struct{}) {
+	sorted := make([]orTag, 0, len(tags))
+	for tag := range tags {
+		sorted = append(sorted, tag)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].replica != sorted[j].replica {
+			return sorted[i].replica < sorted[j].replica
+		}
+		return sorted[i].clock < sorted[j].clock
+	})
+	e.uint(uint64(len(sorted)))
+	for _, tag := range sorted {
+		e.string(tag.replica)
+		e.int(tag.clock)
+	}
+}
+
+// decoder reads values written by encoder, recording the first error
+// so that callers only need to check it once at the end
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) uint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	n, size := binary.Uvarint(d.buf)
+	if size <= 0 {
+		d.err = ErrBadDump
+		return 0
+	}
+	d.buf = d.buf[size:]
+	return n
+}
+
+func (d *decoder) int() int64 {
+	if d.err != nil {
+		return 0
+	}
+	n, size := binary.Varint(d.buf)
+	if size <= 0 {
+		d.err = ErrBadDump
+		return 0
+	}
+	d.buf = d.buf[size:]
+	return n
+}
+
+func (d *decoder) float() float64 {
+	if d.err != nil {
+		return 0
+	}
+	if len(d.buf) < 8 {
+		d.err = ErrBadDump
+		return 0
+	}
+	f := math.Float64frombits(binary.LittleEndian.Uint64(d.buf))
+	d.buf = d.buf[8:]
+	return f
+}
+
+func (d *decoder) string() string {
+	return string(d.next())
+}
+
+// bytes returns a copy of the next length prefixed byte string,
+// so that decoded values do not alias the payload
+func (d *decoder) bytes() []byte {
+	return append([]byte{}, d.next()...)
+}
+
+// next consumes the next length prefixed byte string
+func (d *decoder) next() []byte {
+	n := d.uint()
+	if d.err != nil {
+		return nil
+	}
+	if uint64(len(d.buf)) < n {
+		d.err = ErrBadDump
+		return nil
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *decoder) id() StreamID {
+	return StreamID{Ms: d.uint(), Seq: d.uint()}
+}
+
+// sortedSet decodes the members of a sorted set, refusing the members
+// given twice and the NaN scores, which would break its order
+func (d *decoder) sortedSet() *sortedSet {
+	z := newSortedSet()
+	seen := make(map[string]bool)
+	for n := d.uint(); n > 0 && d.err == nil; n-- {
+		m := ZMember{Member: d.string(), Score: d.float()}
+		if d.err == nil && (seen[m.Member] || math.IsNaN(m.Score)) {
+			d.err = ErrBadDump
+			break
+		}
+		seen[m.Member] = true
+		z.insert(m)
+	}
+	return z
+}
+
+// stream decodes a stream, refusing the entries out of order, past the
+// last ID or with a field without its value
+func (d *decoder) stream() *stream {
+	st := &stream{lastID: d.id()}
+
+	var prev StreamID
+	for n := d.uint(); n > 0 && d.err == nil; n-- {
+		entry := StreamEntry{ID: d.id()}
+		f := d.uint()
+		if d.err == nil && (!prev.Less(entry.ID) || st.lastID.Less(entry.ID) || f%2 != 0) {
+			d.err = ErrBadDump
+			break
+		}
+		prev = entry.ID
+		for ; f > 0 && d.err == nil; f-- {
+			entry.Fields = append(entry.Fields, d.string())
+		}
+		st.entries = append(st.entries, entry)
+	}
+
+	for n := d.uint(); n > 0 && d.err == nil; n-- {
+		if st.groups == nil {
+			st.groups = make(map[string]*consumerGroup)
+		}
+		name := d.string()
+		g := newConsumerGroup(d.id())
+
+		for c := d.uint(); c > 0 && d.err == nil; c-- {
+			consName := d.string()
+			g.consumers[consName] = &consumer{
+				seenAt:  time.UnixMilli(d.int()),
+				pending: make(map[StreamID]*pendingEntry),
+			}
+		}
+
+		for p := d.uint(); p > 0 && d.err == nil; p-- {
+			id := d.id()
+			pe := &pendingEntry{
+				consumer:      d.string(),
+				deliveredAt:   time.UnixMilli(d.int()),
+				deliveryCount: int(d.uint()),
+			}
+			cons, ok := g.consumers[pe.consumer]
+			if !ok {
+				d.err = ErrBadDump
+				break
+			}
+			g.pending[id] = pe
+			cons.pending[id] = pe
+		}
+
+		st.groups[name] = g
+	}
+
+	return st
+}
+
+func (d *decoder) bloom() *bloomFilter {
+	bf := &bloomFilter{errorRate: d.float()}
+	n := d.uint()
+	if d.err == nil && (n == 0 || !(bf.errorRate > 0 && bf.errorRate < 1)) {
+		d.err = ErrBadDump
+	}
+	for ; n > 0 && d.err == nil; n-- {
+		l := &bloomLayer{capacity: d.uint(), count: d.uint(), hashes: d.uint()}
+		words := d.uint()
+		if d.err != nil || words == 0 || l.hashes == 0 || l.capacity == 0 || words > maxFilterBits/64 || uint64(len(d.buf)) < words*8 {
+			d.err = ErrBadDump
+			break
+		}
+		l.bits = make([]uint64, words)
+		for i := range l.bits {
+			l.bits[i] = binary.LittleEndian.Uint64(d.buf[i*8:])
+		}
+		d.buf = d.buf[words*8:]
+		bf.layers = append(bf.layers, l)
+	}
+	return bf
+}
+
+func (d *decoder) cuckoo() *cuckooFilter {
+	cf := &cuckooFilter{count: d.uint()}
+	n := d.uint()
+	buckets := n / cuckooBucketSize
+	if d.err != nil || n%cuckooBucketSize != 0 || buckets == 0 || buckets&(buckets-1) != 0 ||
+		n > maxFilterBits/16 || uint64(len(d.buf)) < n*2 {
+		d.err = ErrBadDump
+		return cf
+	}
+	cf.slots = make([]uint16, n)
+	for i := range cf.slots {
+		cf.slots[i] = binary.LittleEndian.Uint16(d.buf[i*2:])
+	}
+	d.buf = d.buf[n*2:]
+	return cf
+}
+
+func (d *decoder) countMin() *countMinSketch {
+	width, depth := d.uint(), d.uint()
+	if d.err != nil {
+		return nil
+	}
+	cms, err := newCountMinSketch(width, depth)
+	// every counter takes at least a byte
+	if err != nil || uint64(len(d.buf)) < width*depth {
+		d.err = ErrBadDump
+		return nil
+	}
+	for i := range cms.counters {
+		cms.counters[i] = d.uint()
+	}
+	return cms
+}
+
+func (d *decoder) topK() *topK {
+	k, width, depth, decay := d.uint(), d.uint(), d.uint(), d.float()
+	if d.err != nil {
+		return nil
+	}
+	tk, err := newTopK(k, width, depth, decay)
+	if err != nil || uint64(len(d.buf)) < 2*width*depth {
+		d.err = ErrBadDump
+		return nil
+	}
+	for i := range tk.buckets {
+		tk.buckets[i] = topKBucket{fingerprint: d.uint(), count: d.uint()}
+	}
+	n := d.uint()
+	if n > k {
+		d.err = ErrBadDump
+	}
+	for ; n > 0 && d.err == nil; n-- {
+		item := TopKItem{Item: d.string(), Count: d.uint()}
+		if _, dup := tk.heap.index[item.Item]; dup {
+			d.err = ErrBadDump
+			break
+		}
+		tk.heap.index[item.Item] = len(tk.heap.items)
+		tk.heap.items = append(tk.heap.items, item)
+	}
+	heap.Init(&tk.heap)
+	return tk
+}
+
+func (d *decoder) gCounter() *gCounter {
+	gc := &gCounter{counts: make(map[string]uint64)}
+	for n := d.uint(); n > 0 && d.err == nil; n-- {
+		gc.counts[d.string()] = d.uint()
+	}
+	return gc
+}
+
+func (d *decoder) orSet() *orSet {
+	s := newORSet()
+	for n := d.uint(); n > 0 && d.err == nil; n-- {
+		member := d.string()
+		tags := d.orTags()
+		if len(tags) == 0 {
+			// members without tags are not in the set
+			d.err = ErrBadDump
+			break
+		}
+		s.adds[member] = tags
+	}
+	s.removed = d.orTags()
+	return s
+}
+
+func (d *decoder) orTags() map[orTag]struct{} {
+	tags := make(map[orTag]struct{})
+	for n := d.uint(); n > 0 && d.err == nil; n-- {
+		tags[orTag{replica: d.string(), clock: d.int()}] = struct{}{}
+	}
+	return tags
+}
@@ -0,0 +1,187 @@
+package cache
+
+import (
+	"hash/crc32"
+	"strconv"
+	"unsafe"
+)
+
+// embeddedStringMax is the length up to which strings are stored embedded,
+// as in the embstr encoding of Redis
+const embeddedStringMax = 44
+
+// intString is a string holding an integer in canonical form, stored as
+// the integer itself
+type intString int64
+
+// embeddedString is a short string stored in a single allocation holding
+// its length byte followed by its bytes, rather than as a slice header and
+// a separate array. An interface holds a struct made of a single pointer
+// as is, so the value costs nothing beyond that allocation
+type embeddedString struct {
+	p *byte
+}
+
+func newEmbeddedString(val []byte) embeddedString {
+	buf := make([]byte, len(val)+1)
+	buf[0] = byte(len(val))
+	copy(buf[1:], val)
+	return embeddedString{p: &buf[0]}
+}
+
+func (e embeddedString) bytes() []byte {
+	return unsafe.Slice(e.p, int(*e.p)+1)[1:]
+}
+
+// encodeString returns the value stored for the string val in its most
+// compact encoding: an integer, an embedded string, a compressed string
+// or val itself, along with its checksum when the cache keeps them
+func (c *Cache) encodeString(val []byte) any {
+	value := c.compactString(val)
+	if c.checksums {
+		return checkedString{value: value, crc: crc32.Checksum(val, crc32c)}
+	}
+	return value
+}
+
+// compactString returns the most compact encoding of the string val
+func (c *Cache) compactString(val []byte) any {
+	if n, ok := parseIntString(val); ok {
+		return intString(n)
+	}
+	if len(val) <= embeddedStringMax {
+		return newEmbeddedString(val)
+	}
+	return c.packString(val)
+}
+
+// parseIntString parses val if it is an integer in canonical form, which
+// formats back to val, with no sign but for negative numbers and no
+// leading zeros
+func parseIntString(val []byte) (int64, bool) {
+	if len(val) == 0 || len(val) > 20 {
+		return 0, false
+	}
+	digits := val
+	if digits[0] == '-' {
+		digits = digits[1:]
+	}
+	if len(digits) == 0 || (digits[0] == '0' && len(val) > 1) {
+		return 0, false
+	}
+	for _, b := range digits {
+		if b < '0' || b > '9' {
+			return 0, false
+		}
+	}
+	n, err := strconv.ParseInt(string(val), 10, 64)
+	return n, err == nil
+}
+
+// stringBytes returns the string held by a value in any of the string
+// encodings, failing with ErrWrongType for values that are not strings and
+// with ErrCorrupt for those that no longer match their checksum
+func stringBytes(value any) ([]byte, error) {
+	switch v := value.(type) {
+	case []byte:
+		return v, nil
+	case intString:
+		return strconv.AppendInt(nil, int64(v), 10), nil
+	case embeddedString:
+		return v.bytes(), nil
+	case compressedString:
+		return v.unpack(), nil
+	case checkedString:
+		return v.bytes()
+	default:
+		return nil, ErrWrongType
+	}
+}
+
+// Type returns the type of the value stored at key, as reported by TYPE,
+// and "none" if the key does not exist
+func (c *Cache) Type(key string) string {
+	obj, ok := c.lookup(key)
+	if !ok {
+		return "none"
+	}
+	return typeName(obj.value)
+}
+
+// typeName returns the name of the type of value, those of the Redis
+// modules for the probabilistic and JSON types
+func typeName(value any) string {
+	switch v := value.(type) {
+	case *stream:
+		return "stream"
+	case *sortedSet:
+		return "zset"
+	case *bloomFilter:
+		return "MBbloom--"
+	case *cuckooFilter:
+		return "MBbloomCF"
+	case *countMinSketch:
+		return "CMSk-TYPE"
+	case *topK:
+		return "TopK-TYPE"
+	case *gCounter:
+		return "gcounter"
+	case *orSet:
+		return "orset"
+	case *jsonDocument:
+		return "ReJSON-RL"
+	case *moduleValue:
+		return v.typ.Name
+	default:
+		return "string"
+	}
+}
+
+// Encoding returns the internal encoding of the value stored at key, as
+// reported by OBJECT ENCODING, and false if the key does not exist
+func (c *Cache) Encoding(key string) (string, bool) {
+	obj, ok := c.lookup(key)
+	if !ok {
+		return "", false
+	}
+
+	value := obj.value
+	if v, ok := value.(checkedString); ok {
+		value = v.value
+	}
+	switch v := value.(type) {
+	case []byte:
+		return "raw", true
+	case intString:
+		return "int", true
+	case embeddedString:
+		return "embstr", true
+	case compressedString:
+		return "compressed", true
+	case *stream:
+		return "stream", true
+	case *sortedSet:
+		if v.dict == nil {
+			return "compact", true
+		}
+		return "sortedset", true
+	case *bloomFilter:
+		return "bloom", true
+	case *cuckooFilter:
+		return "cuckoo", true
+	case *countMinSketch:
+		return "cms", true
+	case *topK:
+		return "topk", true
+	case *gCounter:
+		return "gcounter", true
+	case *orSet:
+		return "orset", true
+	case *jsonDocument:
+		return "json", true
+	case *moduleValue:
+		return v.typ.Name, true
+	default:
+		return "unknown", true
+	}
+}
@@ -0,0 +1,89 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Error kinds. The kind of an error is the first word of its message,
+// so that clients can branch on the class of an error reply
+const (
+	// KindErr is the kind of generic errors
+	KindErr = "ERR"
+	// KindWrongType is the kind of operations against a key holding
+	// a value of another type
+	KindWrongType = "WRONGTYPE"
+	// KindOOM is the kind of writes refused because memory is exhausted
+	KindOOM = "OOM"
+	// KindBusyKey is the kind of writes refused because the key exists
+	KindBusyKey = "BUSYKEY"
+	// KindNoGroup is the kind of stream commands naming a missing consumer group
+	KindNoGroup = "NOGROUP"
+	// KindBusyGroup is the kind of XGROUP CREATE naming an existing consumer group
+	KindBusyGroup = "BUSYGROUP"
+	// KindIOErr is the kind of failures talking to another instance or to
+	// the backing store
+	KindIOErr = "IOERR"
+	// KindNoProto is the kind of HELLO naming an unsupported protocol version
+	KindNoProto = "NOPROTO"
+	// KindReadOnly is the kind of writes refused by a read only server
+	KindReadOnly = "READONLY"
+	// KindCrossSlot is the kind of commands refused by a proxy because
+	// their keys belong to several servers
+	KindCrossSlot = "CROSSSLOT"
+	// KindNotLeader is the kind of commands refused by the nodes of a Raft
+	// cluster other than the leader
+	KindNotLeader = "NOTLEADER"
+	// KindLimit is the kind of commands refused because the client
+	// exceeded a quota of the server
+	KindLimit = "LIMIT"
+	// KindCorrupt is the kind of reads of a value that no longer matches
+	// its checksum
+	KindCorrupt = "CORRUPT"
+	// KindConflict is the kind of writes refused because the key changed
+	// since the version they expect
+	KindConflict = "CONFLICT"
+	// KindBusy is the kind of commands refused because the server is
+	// overloaded
+	KindBusy = "BUSY"
+	// KindDraining is the kind of commands refused by a server draining its
+	// clients before it stops
+	KindDraining = "DRAINING"
+)
+
+// Error is an error of a given kind
+type Error struct {
+	Kind string
+	Msg  string
+}
+
+// Errorf returns an error of the given kind with a formatted message
+func Errorf(kind, format string, args ...any) *Error {
+	return &Error{Kind: kind, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (e *Error) Error() string {
+	return e.Kind + " " + e.Msg
+}
+
+var (
+	// ErrWrongType is returned when an operation is attempted against a key
+	// holding a value of a different type
+	ErrWrongType = &Error{Kind: KindWrongType, Msg: "Operation against a key holding the wrong kind of value"}
+	// ErrNoSuchKey is returned when an operation requires a key that does not exist
+	ErrNoSuchKey = &Error{Kind: KindErr, Msg: "no such key"}
+	// ErrOOM is returned when a write is refused because memory is exhausted
+	ErrOOM = &Error{Kind: KindOOM, Msg: "command not allowed when used memory > 'maxmemory'"}
+	// ErrNotInteger is returned when an operation expects a string holding
+	// an integer
+	ErrNotInteger = &Error{Kind: KindErr, Msg: "value is not an integer or out of range"}
+)
+
+// ErrorKind returns the kind of err, KindErr if it is not an *Error
+func ErrorKind(err error) string {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	return KindErr
+}
@@ -0,0 +1,68 @@
+package cache
+
+// ExpireMode is how the cache treats the keys whose expiry passed
+type ExpireMode int
+
+const (
+	// ExpireDelete deletes the expired keys as soon as they are found, on
+	// access or by DeleteExpiredKeys
+	ExpireDelete ExpireMode = iota
+	// ExpireHide reads the expired keys as missing but keeps them until
+	// they are deleted explicitly, as a replica whose primary deletes them
+	ExpireHide
+	// ExpireKeep reads the expired keys as present, as a replica applying
+	// the writes of a primary that deletes the expired keys before them
+	ExpireKeep
+)
+
+// SetExpireMode sets how the expired keys are treated from then on
+func (c *Cache) SetExpireMode(mode ExpireMode) {
+	c.expireMode = mode
+}
+
+// expired reports whether obj is to be read as missing at now
+func (c *Cache) expired(obj *obj, now int64) bool {
+	return obj.expiresAt != -1 && obj.expiresAt <= now && c.expireMode != ExpireKeep
+}
+
+// Expired reports whether key exists with an expiry that passed, whatever
+// the mode
+func (c *Cache) Expired(key string) bool {
+	obj, ok := c.data[key]
+	return ok && obj.expiresAt != -1 && obj.expiresAt <= c.Now().UnixMilli()
+}
+
+// ExpiredKeys returns the expired keys among up to sample keys having an
+// expiry, taken in the random order of the keyspace, whatever the mode
+func (c *Cache) ExpiredKeys(sample int) []string {
+	var keys []string
+	now := c.Now().UnixMilli()
+	for key, obj := range c.data {
+		if obj.expiresAt == -1 {
+			continue
+		}
+		if obj.expiresAt <= now {
+			keys = append(keys, key)
+		}
+		if sample--; sample == 0 {
+			break
+		}
+	}
+	return keys
+}
+
+// DeleteExpired deletes the given keys whose expiry is at or before the
+// unix time in milliseconds at, as expired keys, and returns their number.
+// Comparing to a time given rather than to the clock, a primary deleting
+// the keys it found expired gets the same keys deleted on its replicas,
+// sparing those written again since
+func (c *Cache) DeleteExpired(at int64, keys ...string) int {
+	deleted := 0
+	for _, key := range keys {
+		if obj, ok := c.data[key]; ok && obj.expiresAt != -1 && obj.expiresAt <= at {
+			c.evict(key, ReasonExpired)
+			deleted++
+		}
+	}
+	return deleted
+}
@@ -0,0 +1,40 @@
+package cache
+
+// Export is a key as exported by DUMPALL, for the tools moving keyspaces
+// between servers or into other formats
+type Export struct {
+	Type string
+	// ExpiresAt is the unix time in milliseconds the key expires at, or -1
+	// if it does not expire
+	ExpiresAt int64
+	// Payload is the value serialized by Dump, which Restore creates the
+	// key from
+	Payload []byte
+	// Value is the readable form of the strings and JSON documents, the
+	// string itself and the document as JSON, and nil for the other types
+	Value []byte
+}
+
+// Export returns the type, expiry and serialized value of key, and the
+// readable value of strings and JSON documents, reporting false if the key
+// does not exist
+func (c *Cache) Export(key string) (Export, bool, error) {
+	payload, ok, err := c.Dump(key)
+	if err != nil || !ok {
+		return Export{}, false, err
+	}
+
+	return exportObj(c.data[key], payload), true, nil
+}
+
+// exportObj returns the Export of obj given its serialized value
+func exportObj(obj *obj, payload []byte) Export {
+	e := Export{Type: typeName(obj.value), ExpiresAt: obj.expiresAt, Payload: payload}
+	switch v := obj.value.(type) {
+	case *jsonDocument:
+		e.Value = marshalJSON(v.root)
+	default:
+		e.Value, _ = stringBytes(v)
+	}
+	return e
+}
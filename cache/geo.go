@@ -0,0 +1,213 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Geospatial values are stored in sorted sets, with the score of each member
+// being the 52 bit geohash of its coordinates (same layout as Redis), so the
+// regular sorted-set commands keep working on geo keys
+
+const (
+	geoStep           = 26
+	geoLatMin         = -85.05112878
+	geoLatMax         = 85.05112878
+	geoLonMin         = -180.0
+	geoLonMax         = 180.0
+	earthRadiusMeters = 6372797.560856
+)
+
+// ErrInvalidCoordinates is returned for coordinates outside the indexable area
+var ErrInvalidCoordinates = errors.New("invalid longitude,latitude pair")
+
+// GeoPoint is a member of a geo set with its coordinates
+type GeoPoint struct {
+	Member string
+	Lon    float64
+	Lat    float64
+}
+
+// GeoSearchQuery describes a GeoSearch around a center point. The center is
+// the position of FromMember if set, otherwise Lon/Lat. A positive Radius
+// searches a circle, otherwise the Width x Height box. All lengths are meters
+type GeoSearchQuery struct {
+	FromMember string
+	Lon, Lat   float64
+
+	Radius        float64
+	Width, Height float64
+
+	// Count limits the number of results, 0 meaning unlimited
+	Count int
+	// Sort orders the results by distance, Desc reversing the order
+	Sort bool
+	Desc bool
+}
+
+// GeoResult is a member matched by GeoSearch
+type GeoResult struct {
+	GeoPoint
+	// Dist is the distance from the search center in meters
+	Dist float64
+	Hash uint64
+}
+
+// geoEncode interleaves the normalised latitude (even bits) and
+// longitude (odd bits) into a 52 bit geohash
+func geoEncode(lon, lat float64) uint64 {
+	latOffset := uint32((lat - geoLatMin) / (geoLatMax - geoLatMin) * (1 << geoStep))
+	lonOffset := uint32((lon - geoLonMin) / (geoLonMax - geoLonMin) * (1 << geoStep))
+	return interleave(latOffset, lonOffset)
+}
+
+// geoDecode returns the coordinates of the center of the geohash cell
+func geoDecode(hash uint64) (lon, lat float64) {
+	latOffset, lonOffset := deinterleave(hash)
+
+	cell := float64(uint64(1) << geoStep)
+	latLow := geoLatMin + float64(latOffset)/cell*(geoLatMax-geoLatMin)
+	latHigh := geoLatMin + float64(latOffset+1)/cell*(geoLatMax-geoLatMin)
+	lonLow := geoLonMin + float64(lonOffset)/cell*(geoLonMax-geoLonMin)
+	lonHigh := geoLonMin + float64(lonOffset+1)/cell*(geoLonMax-geoLonMin)
+
+	lon = math.Max(geoLonMin, math.Min(geoLonMax, (lonLow+lonHigh)/2))
+	lat = math.Max(geoLatMin, math.Min(geoLatMax, (latLow+latHigh)/2))
+	return lon, lat
+}
+
+func interleave(x, y uint32) uint64 {
+	var hash uint64
+	for i := 0; i < geoStep; i++ {
+		hash |= uint64(x>>i&1) << (2 * i)
+		hash |= uint64(y>>i&1) << (2*i + 1)
+	}
+	return hash
+}
+
+func deinterleave(hash uint64) (x, y uint32) {
+	for i := 0; i < geoStep; i++ {
+		x |= uint32(hash>>(2*i)&1) << i
+		y |= uint32(hash>>(2*i+1)&1) << i
+	}
+	return x, y
+}
+
+// GeoDistance returns the great circle distance in meters between two
+// points using the haversine formula
+func GeoDistance(lon1, lat1, lon2, lat2 float64) float64 {
+	lat1r, lat2r := lat1*math.Pi/180, lat2*math.Pi/180
+	u := math.Sin((lat2r - lat1r) / 2)
+	v := math.Sin((lon2 - lon1) * math.Pi / 180 / 2)
+	a := u*u + math.Cos(lat1r)*math.Cos(lat2r)*v*v
+	return 2 * earthRadiusMeters * math.Asin(math.Sqrt(a))
+}
+
+// GeoAdd adds the points to the geo set stored at key
+// and returns the number of added members like ZAdd
+func (c *Cache) GeoAdd(key string, opts ZAddOpts, points ...GeoPoint) (int, error) {
+	members := make([]ZMember, len(points))
+	for i, p := range points {
+		if p.Lon < geoLonMin || p.Lon > geoLonMax || p.Lat < geoLatMin || p.Lat > geoLatMax {
+			return 0, fmt.Errorf("%w: %f,%f", ErrInvalidCoordinates, p.Lon, p.Lat)
+		}
+		members[i] = ZMember{Member: p.Member, Score: float64(geoEncode(p.Lon, p.Lat))}
+	}
+
+	return c.ZAdd(key, opts, members...)
+}
+
+// GeoPos returns the coordinates of member in the geo set stored at key
+func (c *Cache) GeoPos(key, member string) (lon, lat float64, ok bool, err error) {
+	score, ok, err := c.ZScore(key, member)
+	if err != nil || !ok {
+		return 0, 0, false, err
+	}
+
+	lon, lat = geoDecode(uint64(score))
+	return lon, lat, true, nil
+}
+
+// GeoDist returns the distance in meters between two members of the geo set
+func (c *Cache) GeoDist(key, member1, member2 string) (float64, bool, error) {
+	lon1, lat1, ok, err := c.GeoPos(key, member1)
+	if err != nil || !ok {
+		return 0, false, err
+	}
+	lon2, lat2, ok, err := c.GeoPos(key, member2)
+	if err != nil || !ok {
+		return 0, false, err
+	}
+
+	return GeoDistance(lon1, lat1, lon2, lat2), true, nil
+}
+
+// GeoSearch returns the members of the geo set stored at key
+// that lie within the area described by the query
+func (c *Cache) GeoSearch(key string, q GeoSearchQuery) ([]GeoResult, error) {
+	z, err := c.getSortedSet(key)
+	if err != nil || z == nil {
+		return nil, err
+	}
+
+	lon, lat := q.Lon, q.Lat
+	if q.FromMember != "" {
+		score, ok := z.score(q.FromMember)
+		if !ok {
+			return nil, errors.New("could not decode requested zset member")
+		}
+		lon, lat = geoDecode(uint64(score))
+	}
+
+	var results []GeoResult
+	for _, m := range z.members {
+		hash := uint64(m.Score)
+		mLon, mLat := geoDecode(hash)
+
+		dist, ok := geoWithin(q, lon, lat, mLon, mLat)
+		if !ok {
+			continue
+		}
+
+		results = append(results, GeoResult{
+			GeoPoint: GeoPoint{Member: m.Member, Lon: mLon, Lat: mLat},
+			Dist:     dist,
+			Hash:     hash,
+		})
+	}
+
+	if q.Sort || q.Count > 0 {
+		sort.SliceStable(results, func(i, j int) bool {
+			if q.Desc {
+				return results[i].Dist > results[j].Dist
+			}
+			return results[i].Dist < results[j].Dist
+		})
+	}
+	if q.Count > 0 && len(results) > q.Count {
+		results = results[:q.Count]
+	}
+
+	return results, nil
+}
+
+// geoWithin reports whether the point lies in the search area
+// and returns its distance from the center
+func geoWithin(q GeoSearchQuery, lon, lat, pLon, pLat float64) (float64, bool) {
+	dist := GeoDistance(lon, lat, pLon, pLat)
+	if q.Radius > 0 {
+		return dist, dist <= q.Radius
+	}
+
+	// the point is in the box if both its north-south distance and its
+	// east-west distance (measured at the point's latitude) fit
+	if GeoDistance(lon, lat, lon, pLat) > q.Height/2 {
+		return 0, false
+	}
+	if GeoDistance(lon, pLat, pLon, pLat) > q.Width/2 {
+		return 0, false
+	}
+	return dist, true
+}
@@ -0,0 +1,31 @@
+package cache
+
+import "time"
+
+// WithTTLJitter shortens the relative TTLs of the keys written, by
+// SetWithTTL and StoreLoaded, by a random amount of up to fraction of the
+// TTL, so that the keys written in bulk with the same TTL expire over a
+// span of time rather than in the same active expiration cycle, all missing
+// from the cache and reaching the backing store at once. Shortening rather
+// than lengthening keeps the keys from outliving the TTL they were given,
+// and the absolute deadlines of EXPIREAT and the like are kept as they are
+func WithTTLJitter(fraction float64) Option {
+	return func(c *Cache) {
+		if fraction < 0 {
+			fraction = 0
+		}
+		if fraction > 1 {
+			fraction = 1
+		}
+		c.ttlJitter = fraction
+	}
+}
+
+// expiry returns the unix time in milliseconds at which a key written now
+// with the given TTL expires, applying the jitter
+func (c *Cache) expiry(ttl time.Duration) int64 {
+	if c.ttlJitter > 0 {
+		ttl -= time.Duration(c.rand.Float64() * c.ttlJitter * float64(ttl))
+	}
+	return c.Now().Add(ttl).UnixMilli()
+}
@@ -0,0 +1,463 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// jsonDocument is a parsed JSON document. Objects are map[string]any and
+// arrays *[]any, so that elements can be deleted in place, while scalars
+// are string, json.Number, bool or nil
+type jsonDocument struct {
+	root any
+}
+
+// ErrNewJSONNotAtRoot is returned by JSONSet when creating a document at
+// a path other than the root
+var ErrNewJSONNotAtRoot = errors.New("new objects must be created at the root")
+
+// parseJSON parses a JSON value, keeping numbers as written
+func parseJSON(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %v", err)
+	}
+	if dec.More() {
+		return nil, errors.New("invalid JSON: trailing characters")
+	}
+	return toJSONNode(v), nil
+}
+
+// toJSONNode converts the arrays decoded by encoding/json to *[]any
+func toJSONNode(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, elem := range v {
+			v[k] = toJSONNode(elem)
+		}
+		return v
+	case []any:
+		for i, elem := range v {
+			v[i] = toJSONNode(elem)
+		}
+		return &v
+	default:
+		return v
+	}
+}
+
+// marshalJSON serializes a value compactly without escaping HTML
+func marshalJSON(v any) []byte {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	// the values hold only types that encode
+	enc.Encode(v)
+	return bytes.TrimSuffix(buf.Bytes(), []byte{'\n'})
+}
+
+func cloneJSON(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		cp := make(map[string]any, len(v))
+		for k, elem := range v {
+			cp[k] = cloneJSON(elem)
+		}
+		return cp
+	case *[]any:
+		cp := make([]any, len(*v))
+		for i, elem := range *v {
+			cp[i] = cloneJSON(elem)
+		}
+		return &cp
+	default:
+		return v
+	}
+}
+
+func jsonType(v any) string {
+	switch v := v.(type) {
+	case map[string]any:
+		return "object"
+	case *[]any:
+		return "array"
+	case string:
+		return "string"
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return "integer"
+		}
+		return "number"
+	case bool:
+		return "boolean"
+	default:
+		return "null"
+	}
+}
+
+// jsonPath is a parsed path. Paths starting with $ follow JSONPath and
+// match any number of values, while legacy paths, such as .a.b or a[0],
+// match a single value
+type jsonPath struct {
+	legacy   bool
+	segments []jsonSegment
+}
+
+// jsonSegment selects the field key of objects, the element index of
+// arrays, negative from the end, or every child when wildcard is set
+type jsonSegment struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+func parseJSONPath(raw string) (*jsonPath, error) {
+	p := &jsonPath{}
+	rest := raw
+	switch {
+	case strings.HasPrefix(rest, "$"):
+		rest = rest[1:]
+	case rest == ".":
+		p.legacy = true
+		rest = ""
+	default:
+		p.legacy = true
+		if !strings.HasPrefix(rest, ".") && !strings.HasPrefix(rest, "[") {
+			rest = "." + rest
+		}
+	}
+
+	bad := fmt.Errorf("invalid JSON path '%s'", raw)
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			if strings.HasPrefix(rest, "*") {
+				p.segments = append(p.segments, jsonSegment{wildcard: true})
+				rest = rest[1:]
+				continue
+			}
+			end := strings.IndexAny(rest, ".[")
+			if end == -1 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, bad
+			}
+			p.segments = append(p.segments, jsonSegment{key: rest[:end]})
+			rest = rest[end:]
+		case '[':
+			if len(rest) > 1 && (rest[1] == '\'' || rest[1] == '"') {
+				// a quoted name, which may hold brackets and dots
+				end := strings.IndexByte(rest[2:], rest[1])
+				if end == -1 || !strings.HasPrefix(rest[2+end+1:], "]") {
+					return nil, bad
+				}
+				p.segments = append(p.segments, jsonSegment{key: rest[2 : 2+end]})
+				rest = rest[2+end+2:]
+				continue
+			}
+			end := strings.IndexByte(rest, ']')
+			if end == -1 {
+				return nil, bad
+			}
+			if sel := rest[1:end]; sel == "*" {
+				p.segments = append(p.segments, jsonSegment{wildcard: true})
+			} else {
+				n, err := strconv.Atoi(sel)
+				if err != nil {
+					return nil, bad
+				}
+				p.segments = append(p.segments, jsonSegment{index: n, isIndex: true})
+			}
+			rest = rest[end+1:]
+		default:
+			return nil, bad
+		}
+	}
+	return p, nil
+}
+
+func (p *jsonPath) isRoot() bool {
+	return len(p.segments) == 0
+}
+
+// jsonLoc is the location of a value: the field key of the object or the
+// element index of the array container, or the root if container is nil
+type jsonLoc struct {
+	container any
+	key       string
+	index     int
+}
+
+func (doc *jsonDocument) get(loc jsonLoc) (any, bool) {
+	switch c := loc.container.(type) {
+	case map[string]any:
+		v, ok := c[loc.key]
+		return v, ok
+	case *[]any:
+		return (*c)[loc.index], true
+	default:
+		return doc.root, true
+	}
+}
+
+func (doc *jsonDocument) set(loc jsonLoc, v any) {
+	switch c := loc.container.(type) {
+	case map[string]any:
+		c[loc.key] = v
+	case *[]any:
+		(*c)[loc.index] = v
+	default:
+		doc.root = v
+	}
+}
+
+func (doc *jsonDocument) remove(loc jsonLoc) {
+	switch c := loc.container.(type) {
+	case map[string]any:
+		delete(c, loc.key)
+	case *[]any:
+		*c = append((*c)[:loc.index], (*c)[loc.index+1:]...)
+	}
+}
+
+// find returns the locations matched by p. With create set, the missing
+// field of an existing object named by the last segment is matched too, so
+// that it can be set
+func (doc *jsonDocument) find(p *jsonPath, create bool) []jsonLoc {
+	locs := []jsonLoc{{}}
+	for i, seg := range p.segments {
+		last := i == len(p.segments)-1
+		var next []jsonLoc
+		for _, loc := range locs {
+			v, _ := doc.get(loc)
+			switch v := v.(type) {
+			case map[string]any:
+				if seg.wildcard {
+					keys := make([]string, 0, len(v))
+					for k := range v {
+						keys = append(keys, k)
+					}
+					sort.Strings(keys)
+					for _, k := range keys {
+						next = append(next, jsonLoc{container: v, key: k})
+					}
+				} else if _, ok := v[seg.key]; !seg.isIndex && (ok || (create && last)) {
+					next = append(next, jsonLoc{container: v, key: seg.key})
+				}
+			case *[]any:
+				if seg.wildcard {
+					for j := range *v {
+						next = append(next, jsonLoc{container: v, index: j})
+					}
+				} else if seg.isIndex {
+					j := seg.index
+					if j < 0 {
+						j += len(*v)
+					}
+					if j >= 0 && j < len(*v) {
+						next = append(next, jsonLoc{container: v, index: j})
+					}
+				}
+			}
+		}
+		locs = next
+	}
+	return locs
+}
+
+func (c *Cache) getJSON(key string) (*jsonDocument, error) {
+	obj, ok := c.lookup(key)
+	if !ok {
+		return nil, nil
+	}
+
+	doc, ok := obj.value.(*jsonDocument)
+	if !ok {
+		return nil, ErrWrongType
+	}
+	return doc, nil
+}
+
+// JSONSet sets the values matched by path in the JSON document stored at
+// key to value, creating the document if the path is the root. With nx
+// only missing values are set and with xx only existing ones. It reports
+// false when nothing was set
+func (c *Cache) JSONSet(key, path string, value []byte, nx, xx bool) (bool, error) {
+	p, err := parseJSONPath(path)
+	if err != nil {
+		return false, err
+	}
+	v, err := parseJSON(value)
+	if err != nil {
+		return false, err
+	}
+	doc, err := c.getJSON(key)
+	if err != nil {
+		return false, err
+	}
+
+	if doc == nil {
+		if !p.isRoot() {
+			return false, ErrNewJSONNotAtRoot
+		}
+		if xx {
+			return false, nil
+		}
+		c.setCreated(key, &jsonDocument{root: v})
+		return true, nil
+	}
+
+	set := false
+	for _, loc := range doc.find(p, true) {
+		if _, exists := doc.get(loc); (nx && exists) || (xx && !exists) {
+			continue
+		}
+		if set {
+			v = cloneJSON(v)
+		}
+		doc.set(loc, v)
+		set = true
+	}
+	return set, nil
+}
+
+// JSONGet serializes the values matched by paths in the JSON document
+// stored at key, reporting false if the key does not exist. A single path
+// gives its result alone and several give an object of the results by
+// path. The result of a JSONPath is the array of its matches, and that of
+// a legacy path its match, which must exist
+func (c *Cache) JSONGet(key string, paths ...string) ([]byte, bool, error) {
+	doc, err := c.getJSON(key)
+	if err != nil || doc == nil {
+		return nil, false, err
+	}
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	results := make(map[string]any, len(paths))
+	var single any
+	for _, path := range paths {
+		p, err := parseJSONPath(path)
+		if err != nil {
+			return nil, false, err
+		}
+		locs := doc.find(p, false)
+
+		var result any
+		if p.legacy {
+			if len(locs) == 0 {
+				return nil, false, fmt.Errorf("Path '%s' does not exist", path)
+			}
+			result, _ = doc.get(locs[0])
+		} else {
+			matches := make([]any, len(locs))
+			for i, loc := range locs {
+				matches[i], _ = doc.get(loc)
+			}
+			result = matches
+		}
+		results[path] = result
+		single = result
+	}
+
+	if len(paths) == 1 {
+		return marshalJSON(single), true, nil
+	}
+	return marshalJSON(results), true, nil
+}
+
+// JSONDel deletes the values matched by path in the JSON document stored
+// at key, the whole key for the root, and returns how many were deleted
+func (c *Cache) JSONDel(key, path string) (int, error) {
+	p, err := parseJSONPath(path)
+	if err != nil {
+		return 0, err
+	}
+	doc, err := c.getJSON(key)
+	if err != nil || doc == nil {
+		return 0, err
+	}
+
+	if p.isRoot() {
+		c.deleteObj(key)
+		return 1, nil
+	}
+	locs := doc.find(p, false)
+	// deleting array elements from the last keeps the earlier indexes valid
+	for i := len(locs) - 1; i >= 0; i-- {
+		doc.remove(locs[i])
+	}
+	return len(locs), nil
+}
+
+// JSONType returns the types of the values matched by path in the JSON
+// document stored at key and whether path is a legacy path, nil if the key
+// does not exist
+func (c *Cache) JSONType(key, path string) ([]string, bool, error) {
+	p, err := parseJSONPath(path)
+	if err != nil {
+		return nil, false, err
+	}
+	doc, err := c.getJSON(key)
+	if err != nil || doc == nil {
+		return nil, p.legacy, err
+	}
+
+	locs := doc.find(p, false)
+	types := make([]string, len(locs))
+	for i, loc := range locs {
+		v, _ := doc.get(loc)
+		types[i] = jsonType(v)
+	}
+	return types, p.legacy, nil
+}
+
+// JSONScalars returns the scalars matched by path in the JSON document
+// stored at key, along with the scalar elements of the matched arrays, as
+// text, reporting false if the key does not hold a JSON document. Strings
+// are returned unquoted and nulls and objects are skipped
+func (c *Cache) JSONScalars(key, path string) ([]string, bool) {
+	p, err := parseJSONPath(path)
+	if err != nil {
+		return nil, false
+	}
+	doc, err := c.getJSON(key)
+	if err != nil || doc == nil {
+		return nil, false
+	}
+
+	var scalars []string
+	var add func(v any, nested bool)
+	add = func(v any, nested bool) {
+		switch v := v.(type) {
+		case string:
+			scalars = append(scalars, v)
+		case json.Number:
+			scalars = append(scalars, v.String())
+		case bool:
+			scalars = append(scalars, strconv.FormatBool(v))
+		case *[]any:
+			if !nested {
+				for _, elem := range *v {
+					add(elem, true)
+				}
+			}
+		}
+	}
+	for _, loc := range doc.find(p, false) {
+		v, _ := doc.get(loc)
+		add(v, false)
+	}
+	return scalars, true
+}
@@ -0,0 +1,187 @@
+package cache
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// lazyFreeQueueSize bounds the number of detached values waiting to be freed
+	lazyFreeQueueSize = 1024
+	// defaultLazyFreeThreshold is the number of elements above which a
+	// value is freed in the background rather than inline, as handing
+	// small values to the worker costs more than freeing them directly
+	defaultLazyFreeThreshold = 64
+)
+
+// LazyFreeStats reports the activity of the lazy-free worker
+type LazyFreeStats struct {
+	// Pending is the number of values queued but not yet freed
+	Pending int64
+	// Freed is the number of values freed by the worker so far
+	Freed int64
+}
+
+// lazyFreer releases detached values on a background goroutine so that
+// deleting big collections never stalls the goroutine serving commands
+type lazyFreer struct {
+	queue     chan any
+	threshold int
+	pending   atomic.Int64
+	freed     atomic.Int64
+}
+
+func newLazyFreer(threshold int) *lazyFreer {
+	lf := &lazyFreer{
+		queue:     make(chan any, lazyFreeQueueSize),
+		threshold: threshold,
+	}
+	go lf.run()
+	return lf
+}
+
+func (lf *lazyFreer) run() {
+	for value := range lf.queue {
+		release(value)
+		lf.pending.Add(-1)
+		lf.freed.Add(1)
+	}
+}
+
+// free releases a value that is no longer reachable from the keyspace,
+// in the background if it is big enough to be worth it. When the queue
+// is full the value is freed inline
+func (lf *lazyFreer) free(value any) {
+	if valueEffort(value) <= lf.threshold {
+		return
+	}
+
+	lf.pending.Add(1)
+	select {
+	case lf.queue <- value:
+	default:
+		lf.pending.Add(-1)
+		release(value)
+	}
+}
+
+// valueEffort estimates the work needed to free a value as its element count
+func valueEffort(value any) int {
+	switch v := value.(type) {
+	case *stream:
+		effort := len(v.entries)
+		for _, g := range v.groups {
+			effort += len(g.pending)
+		}
+		return effort
+	case *sortedSet:
+		return len(v.members)
+	case *orSet:
+		return len(v.adds) + len(v.removed)
+	case map[string]*obj:
+		// a whole detached keyspace
+		return len(v)
+	case *moduleValue:
+		if v.typ.Size == nil {
+			return 1
+		}
+		return v.typ.Size(v.value)
+	default:
+		return 1
+	}
+}
+
+// release drops the references held by a value so that the
+// garbage collector can reclaim its elements
+func release(value any) {
+	switch v := value.(type) {
+	case *stream:
+		v.entries = nil
+		v.groups = nil
+	case *sortedSet:
+		for member := range v.dict {
+			delete(v.dict, member)
+		}
+		v.members = nil
+	case map[string]*obj:
+		for key, obj := range v {
+			release(obj.value)
+			delete(v, key)
+		}
+	}
+}
+
+// LazyFreeStats returns the current lazy-free worker counters
+func (c *Cache) LazyFreeStats() LazyFreeStats {
+	return LazyFreeStats{
+		Pending: c.lazyFree.pending.Load(),
+		Freed:   c.lazyFree.freed.Load(),
+	}
+}
+
+// Touch updates the access time of the given keys and returns how many exist
+func (c *Cache) Touch(keys ...string) int {
+	touched := 0
+	for _, key := range keys {
+		if _, ok := c.lookup(key); ok {
+			touched++
+		}
+	}
+	return touched
+}
+
+// IdleTime returns the time elapsed since key was last accessed
+// without counting as an access itself
+func (c *Cache) IdleTime(key string) (time.Duration, bool) {
+	obj, ok := c.data[key]
+	if !ok || c.expired(obj, c.Now().UnixMilli()) {
+		return 0, false
+	}
+
+	return time.Duration(c.Now().UnixMilli()-obj.accessedAt) * time.Millisecond, true
+}
+
+// Unlink removes the given keys from the keyspace right away, deferring
+// the reclamation of big values to the lazy-free worker, and returns
+// the number of keys removed
+func (c *Cache) Unlink(keys ...string) int {
+	unlinked := 0
+	for _, key := range keys {
+		obj, ok := c.lookup(key)
+		if !ok {
+			continue
+		}
+
+		c.lazyFree.free(obj.value)
+		c.deleteObj(key)
+		unlinked++
+	}
+	return unlinked
+}
+
+// FlushAll removes every key. With async set the old keyspace is
+// detached and freed by the lazy-free worker, otherwise it is freed inline
+func (c *Cache) FlushAll(async bool) {
+	old := c.data
+	c.data = make(map[string]*obj)
+	c.stats.entries.Store(0)
+	c.stats.bytes.Store(0)
+	for _, t := range c.tenants {
+		t.keys.Store(0)
+		t.bytes.Store(0)
+	}
+	if c.prefixIndex != nil {
+		c.prefixIndex = &radixNode{}
+	}
+	if c.objs != nil {
+		// the headers of the old keyspace are freed along with it, maybe
+		// by the lazy-free worker, so its slabs are not reused
+		c.objs = &objSlabs{}
+	}
+	c.clearSpilled()
+	if async {
+		c.lazyFree.free(old)
+		return
+	}
+	release(old)
+}
@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"bytes"
+	"time"
+)
+
+// Lock takes the lock held at key for token, expiring after ttl, and
+// reports whether it was taken. The lock is taken when the key does not
+// exist, or when it is already held with the same token, which refreshes
+// its expiry
+func (c *Cache) Lock(key string, token []byte, ttl time.Duration) (bool, error) {
+	return c.LockAt(key, token, c.Now().Add(ttl).UnixMilli())
+}
+
+// LockAt takes the lock held at key for token as Lock does, expiring at
+// the given unix time in milliseconds
+func (c *Cache) LockAt(key string, token []byte, expiresAt int64) (bool, error) {
+	if obj, ok := c.lookup(key); ok {
+		held, err := stringBytes(obj.value)
+		if err != nil {
+			return false, err
+		}
+		if !bytes.Equal(held, token) {
+			return false, nil
+		}
+	}
+
+	c.setObj(key, c.newObjAt(c.encodeString(token), expiresAt))
+	return true, nil
+}
+
+// Unlock releases the lock held at key if it is held with token, deleting
+// the key, and reports whether it was released. Comparing and deleting in
+// a single operation keeps a client whose lock expired from releasing the
+// lock another client took since
+func (c *Cache) Unlock(key string, token []byte) (bool, error) {
+	obj, ok := c.lookup(key)
+	if !ok {
+		return false, nil
+	}
+	held, err := stringBytes(obj.value)
+	if err != nil {
+		return false, err
+	}
+	if !bytes.Equal(held, token) {
+		return false, nil
+	}
+
+	c.deleteObj(key)
+	return true, nil
+}
+
+// CompareAndSwap stores value at key, keeping its expiry, if the key holds
+// expected, and returns the value the key holds afterwards, nil if it does
+// not exist, along with whether it was swapped
+func (c *Cache) CompareAndSwap(key string, expected, value []byte) ([]byte, bool, error) {
+	obj, ok := c.lookup(key)
+	if !ok {
+		return nil, false, nil
+	}
+	current, err := stringBytes(obj.value)
+	if err != nil {
+		return nil, false, err
+	}
+	if !bytes.Equal(current, expected) {
+		return current, false, nil
+	}
+
+	c.setValue(key, obj, c.encodeString(value))
+	return value, true, nil
+}
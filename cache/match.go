@@ -0,0 +1,135 @@
+package cache
+
+// MatchBudget is the number of steps MatchPattern spends at most on a
+// match, a step comparing a byte of the pattern, which bounds the time a
+// pattern made of many '*' holds the goroutine matching it
+const MatchBudget = 1 << 20
+
+// ErrPatternTooComplex is returned by MatchPatternBudget when the match
+// takes more steps than the budget
+var ErrPatternTooComplex = &Error{Kind: KindErr, Msg: "pattern too complex, the match exceeded its budget"}
+
+// MatchPattern reports whether s matches the glob-style pattern, as in Redis:
+// '*' matches any sequence, '?' any byte, "[abc]", "[^abc]" and "[a-z]"
+// match a set of bytes, and '\' escapes the next byte. A match taking more
+// than MatchBudget steps fails
+func MatchPattern(pattern, s string) bool {
+	ok, _ := MatchPatternBudget(pattern, s, MatchBudget)
+	return ok
+}
+
+// MatchPatternBudget reports whether s matches the glob-style pattern as
+// MatchPattern does, failing with ErrPatternTooComplex once budget steps
+// are spent
+func MatchPatternBudget(pattern, s string, budget int) (bool, error) {
+	m := matcher{budget: budget}
+	ok, _ := m.match(pattern, s)
+	if m.budget < 0 {
+		return false, ErrPatternTooComplex
+	}
+	return ok, nil
+}
+
+// matcher holds the steps left to a match
+type matcher struct {
+	budget int
+}
+
+// match reports whether s matches pattern and, if not, whether no longer
+// suffix of the string matched can match either: the last '*' of pattern
+// was tried against every suffix of s, so a '*' before it trying to match
+// fewer bytes would only hand it longer suffixes to fail on, which keeps
+// the patterns made of many '*' from taking exponential time, as in Redis
+func (m *matcher) match(pattern, s string) (matched, skipLonger bool) {
+	for len(pattern) > 0 {
+		if m.budget--; m.budget < 0 {
+			return false, true
+		}
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true, false
+			}
+			for i := 0; i <= len(s); i++ {
+				matched, skipLonger := m.match(pattern[1:], s[i:])
+				if matched {
+					return true, false
+				}
+				if skipLonger {
+					return false, true
+				}
+			}
+			return false, true
+
+		case '?':
+			if len(s) == 0 {
+				return false, false
+			}
+			s = s[1:]
+
+		case '[':
+			if len(s) == 0 {
+				return false, false
+			}
+			var ok bool
+			if ok, pattern = matchClass(pattern[1:], s[0]); !ok {
+				return false, false
+			}
+			s = s[1:]
+			// matchClass leaves pattern on the closing bracket
+			if len(pattern) == 0 {
+				return len(s) == 0, false
+			}
+
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+
+		default:
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false, false
+			}
+			s = s[1:]
+		}
+		pattern = pattern[1:]
+	}
+	return len(s) == 0, false
+}
+
+// matchClass matches b against the set of bytes following a '[', returning
+// the pattern from its closing bracket on, or empty if it is not closed
+func matchClass(pattern string, b byte) (bool, string) {
+	not := len(pattern) > 0 && pattern[0] == '^'
+	if not {
+		pattern = pattern[1:]
+	}
+
+	match := false
+	for len(pattern) > 0 && pattern[0] != ']' {
+		switch {
+		case pattern[0] == '\\' && len(pattern) > 1:
+			pattern = pattern[1:]
+			if pattern[0] == b {
+				match = true
+			}
+		case len(pattern) > 2 && pattern[1] == '-':
+			lo, hi := pattern[0], pattern[2]
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+			if lo <= b && b <= hi {
+				match = true
+			}
+			pattern = pattern[2:]
+		case pattern[0] == b:
+			match = true
+		}
+		pattern = pattern[1:]
+	}
+	return match != not, pattern
+}
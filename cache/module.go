@@ -0,0 +1,64 @@
+package cache
+
+import "fmt"
+
+// DataType describes a value type implemented outside the cache package,
+// letting modules store values of their own in the keyspace
+type DataType struct {
+	// Name identifies the type in DUMP payloads and must be unique
+	Name string
+	// Encode serializes a value for DUMP, RESTORE and MIGRATE
+	Encode func(value any) []byte
+	// Decode rebuilds a value serialized by Encode
+	Decode func(data []byte) (any, error)
+	// Copy returns a deep copy of a value for COPY
+	// When nil the copy shares the value with the original
+	Copy func(value any) any
+	// Size returns the number of elements of a value, deciding whether it
+	// is freed by the lazy-free worker. When nil the value counts as one element
+	Size func(value any) int
+}
+
+// dataTypes holds the registered data types keyed by name
+var dataTypes = make(map[string]*DataType)
+
+// RegisterDataType makes t available to every cache. It is meant to be
+// called from an init function, before any value of the type is stored
+func RegisterDataType(t *DataType) error {
+	if t.Name == "" || t.Encode == nil || t.Decode == nil {
+		return fmt.Errorf("data type %q must have a name, Encode and Decode", t.Name)
+	}
+	if _, ok := dataTypes[t.Name]; ok {
+		return fmt.Errorf("data type %s is already registered", t.Name)
+	}
+
+	dataTypes[t.Name] = t
+	return nil
+}
+
+// moduleValue is a value of a registered data type stored in the keyspace
+type moduleValue struct {
+	typ   *DataType
+	value any
+}
+
+// SetValue stores a value of the data type t at key, replacing any
+// existing value and its TTL
+func (c *Cache) SetValue(key string, t *DataType, value any) {
+	c.setCreated(key, &moduleValue{typ: t, value: value})
+}
+
+// GetValue returns the value of the data type t stored at key and reports
+// whether the key exists. A key holding another type fails with ErrWrongType
+func (c *Cache) GetValue(key string, t *DataType) (any, bool, error) {
+	obj, ok := c.lookup(key)
+	if !ok {
+		return nil, false, nil
+	}
+
+	mv, ok := obj.value.(*moduleValue)
+	if !ok || mv.typ != t {
+		return nil, false, ErrWrongType
+	}
+	return mv.value, true, nil
+}
@@ -0,0 +1,59 @@
+package cache
+
+// EvictReason describes why a key was removed from the cache
+// without being deleted explicitly
+type EvictReason int
+
+const (
+	// ReasonExpired is used for keys removed because their TTL elapsed,
+	// either when accessed or by the active expiration cycle
+	ReasonExpired EvictReason = iota
+	// ReasonEvicted is used for keys removed to make room for new data
+	ReasonEvicted
+)
+
+func (r EvictReason) String() string {
+	switch r {
+	case ReasonExpired:
+		return "expired"
+	case ReasonEvicted:
+		return "evicted"
+	default:
+		return "unknown"
+	}
+}
+
+// Option configures a Cache created with New
+type Option func(*Cache)
+
+// WithOnEvict registers a callback invoked after a key expires or is evicted
+// The callback runs synchronously on the goroutine using the cache, so it
+// must not block and must not call back into the cache
+func WithOnEvict(fn func(key string, reason EvictReason)) Option {
+	return func(c *Cache) {
+		c.onEvict = fn
+	}
+}
+
+// OnEvict adds a callback invoked after a key expires or is evicted, after
+// the ones registered before, with the same constraints as WithOnEvict
+func (c *Cache) OnEvict(fn func(key string, reason EvictReason)) {
+	prev := c.onEvict
+	if prev == nil {
+		c.onEvict = fn
+		return
+	}
+	c.onEvict = func(key string, reason EvictReason) {
+		prev(key, reason)
+		fn(key, reason)
+	}
+}
+
+// WithLazyFreeThreshold sets the number of elements above which values
+// removed by UNLINK, FLUSHALL ASYNC, expiration and eviction are freed
+// by the background lazy-free worker instead of inline
+func WithLazyFreeThreshold(n int) Option {
+	return func(c *Cache) {
+		c.lazyFreeThreshold = n
+	}
+}
@@ -0,0 +1,158 @@
+package cache
+
+import (
+	"sort"
+	"strings"
+)
+
+// WithPrefixIndex keeps the keys in a radix tree besides the keyspace, so
+// that CountPrefix counts the keys starting with a prefix without walking
+// them, and DeletePrefix and ScanPrefix walk only those keys rather than
+// the whole keyspace. It costs a node per key and the upkeep of the tree
+// on every key created or deleted
+func WithPrefixIndex() Option {
+	return func(c *Cache) {
+		c.prefixIndex = &radixNode{}
+	}
+}
+
+// setObj stores obj at key, adding key to the prefix index if it is new,
+// and counts it in Stats. The header of the key replaced is released to
+// the slabs, so it must not be read afterwards
+func (c *Cache) setObj(key string, obj *obj) {
+	t := c.tenantOf(key)
+	if old, ok := c.data[key]; ok {
+		c.stats.bytes.Add(-storedSize(old.value))
+		if t != nil {
+			t.bytes.Add(-storedSize(old.value))
+		}
+		c.dropSpilled(key, old.value)
+		if c.objs != nil && old != obj {
+			c.objs.release(old)
+		}
+	} else {
+		if c.prefixIndex != nil {
+			c.prefixIndex.insert(key)
+		}
+		c.stats.entries.Add(1)
+		c.stats.bytes.Add(int64(len(key)))
+		if t != nil {
+			t.keys.Add(1)
+			t.bytes.Add(int64(len(key)))
+		}
+	}
+	c.stats.bytes.Add(storedSize(obj.value))
+	if t != nil {
+		t.bytes.Add(storedSize(obj.value))
+	}
+	c.data[key] = obj
+}
+
+// deleteObj removes key from the keyspace and from the prefix index, and
+// from Stats, releasing its header to the slabs
+func (c *Cache) deleteObj(key string) {
+	old, ok := c.data[key]
+	if !ok {
+		return
+	}
+	if c.prefixIndex != nil {
+		c.prefixIndex.remove(key)
+	}
+	c.stats.entries.Add(-1)
+	c.stats.bytes.Add(-int64(len(key)) - storedSize(old.value))
+	if t := c.tenantOf(key); t != nil {
+		t.keys.Add(-1)
+		t.bytes.Add(-int64(len(key)) - storedSize(old.value))
+	}
+	c.dropSpilled(key, old.value)
+	delete(c.data, key)
+	if c.objs != nil {
+		c.objs.release(old)
+	}
+}
+
+// CountPrefix returns the number of keys starting with prefix. With the
+// prefix index, the keys expired but not deleted yet are counted
+func (c *Cache) CountPrefix(prefix string) int {
+	if c.prefixIndex != nil {
+		if n, _ := c.prefixIndex.seek(prefix); n != nil {
+			return n.size
+		}
+		return 0
+	}
+
+	count := 0
+	now := c.Now().UnixMilli()
+	for key, obj := range c.data {
+		if strings.HasPrefix(key, prefix) && !c.expired(obj, now) {
+			count++
+		}
+	}
+	return count
+}
+
+// DeletePrefix deletes the keys starting with prefix, handing the big
+// values to the lazy-free worker, and returns the keys deleted, the
+// expired keys not included
+func (c *Cache) DeletePrefix(prefix string) []string {
+	keys := c.prefixKeys(prefix, "", false, -1)
+	deleted := keys[:0]
+	now := c.Now().UnixMilli()
+	for _, key := range keys {
+		obj := c.data[key]
+		if !c.expired(obj, now) {
+			deleted = append(deleted, key)
+		}
+		c.lazyFree.free(obj.value)
+		c.deleteObj(key)
+	}
+	return deleted
+}
+
+// ScanPrefix returns up to count keys starting with prefix in
+// lexicographic order, those greater than after if resume is set, and
+// reports whether keys remain after them. Without the prefix index, every
+// call walks and sorts the keys starting with prefix
+func (c *Cache) ScanPrefix(prefix, after string, resume bool, count int) ([]string, bool) {
+	keys := c.prefixKeys(prefix, after, resume, count+1)
+	more := len(keys) > count
+	if more {
+		keys = keys[:count]
+	}
+	return keys, more
+}
+
+// prefixKeys returns up to limit keys starting with prefix in
+// lexicographic order, those greater than after if resume is set, and all
+// of them if limit is negative. The expired keys are skipped unless
+// limit is negative
+func (c *Cache) prefixKeys(prefix, after string, resume bool, limit int) []string {
+	var keys []string
+	now := c.Now().UnixMilli()
+	visible := func(key string) bool {
+		return limit < 0 || !c.expired(c.data[key], now)
+	}
+
+	if c.prefixIndex != nil {
+		if n, path := c.prefixIndex.seek(prefix); n != nil {
+			n.walk(path, after, resume, func(key string) bool {
+				if visible(key) {
+					keys = append(keys, key)
+				}
+				return limit < 0 || len(keys) < limit
+			})
+		}
+		return keys
+	}
+
+	for key := range c.data {
+		if strings.HasPrefix(key, prefix) && (!resume || key > after) && visible(key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	if limit >= 0 && len(keys) > limit {
+		keys = keys[:limit]
+	}
+	return keys
+}
@@ -0,0 +1,172 @@
+package cache
+
+import (
+	"sort"
+	"time"
+)
+
+const (
+	// QueueGroup is the consumer group of the streams used as queues,
+	// whose pending entries are the messages in flight
+	QueueGroup = "queue"
+	// QueueField is the field holding the message of the entries of a
+	// queue
+	QueueField = "message"
+)
+
+// QueueMessage is a message read from a queue
+type QueueMessage struct {
+	ID         StreamID
+	Message    string
+	Deliveries int
+}
+
+// QueueReadResult is the outcome of QRead
+type QueueReadResult struct {
+	Messages []QueueMessage
+	// DeadLettered is the number of messages moved to the dead letter
+	// queue, or dropped without one, for having been delivered too often
+	DeadLettered int
+}
+
+// queueGroup returns the group of the queue stored at key, creating the
+// group for streams used as queues for the first time, or nil if the key
+// does not exist
+func (c *Cache) queueGroup(key string) (*stream, *consumerGroup, error) {
+	st, err := c.getStream(key)
+	if err != nil || st == nil {
+		return nil, nil, err
+	}
+	if st.groups == nil {
+		st.groups = make(map[string]*consumerGroup)
+	}
+	g, ok := st.groups[QueueGroup]
+	if !ok {
+		g = newConsumerGroup(StreamID{})
+		st.groups[QueueGroup] = g
+	}
+	return st, g, nil
+}
+
+// QAdd appends a message to the queue stored at key, a stream whose
+// entries hold the message in QueueField, creating it if needed, and
+// returns the ID of the message
+func (c *Cache) QAdd(key, message string) (StreamID, error) {
+	return c.QAddID(key, "*", message)
+}
+
+// QAddID appends a message to the queue stored at key as QAdd does, with
+// the ID idSpec resolves to as in XAdd
+func (c *Cache) QAddID(key, idSpec, message string) (StreamID, error) {
+	id, err := c.XAdd(key, idSpec, []string{QueueField, message})
+	if err != nil {
+		return StreamID{}, err
+	}
+	_, _, err = c.queueGroup(key)
+	return id, err
+}
+
+// QRead receives up to count messages of the queue stored at key, those
+// received before and not acknowledged within visibility first, then those
+// never received. Once received, a message is invisible to the other reads
+// until visibility passes. When maxDeliveries is positive, a message
+// received that many times without being acknowledged is moved to the
+// queue deadLetter instead, or dropped if deadLetter is empty
+func (c *Cache) QRead(key string, count int, visibility time.Duration, maxDeliveries int, deadLetter string) (QueueReadResult, error) {
+	st, g, err := c.queueGroup(key)
+	if err != nil || st == nil {
+		return QueueReadResult{}, err
+	}
+
+	var (
+		res  QueueReadResult
+		now  = c.Now()
+		cons = g.consumer(QueueGroup, now)
+	)
+	for _, id := range sortedIDs(g.pending) {
+		if len(res.Messages) == count {
+			return res, nil
+		}
+		pe := g.pending[id]
+		if now.Sub(pe.deliveredAt) < visibility {
+			continue
+		}
+
+		entry, ok := st.entry(id)
+		if ok && maxDeliveries > 0 && pe.deliveryCount >= maxDeliveries {
+			if deadLetter != "" {
+				if _, err := c.QAdd(deadLetter, queueMessage(entry)); err != nil {
+					return res, err
+				}
+			}
+			st.remove(id)
+			res.DeadLettered++
+			ok = false
+		}
+		if !ok {
+			delete(g.pending, id)
+			delete(g.consumers[pe.consumer].pending, id)
+			continue
+		}
+
+		g.claim(id, pe, QueueGroup, cons, now, false)
+		res.Messages = append(res.Messages, QueueMessage{ID: id, Message: queueMessage(entry), Deliveries: pe.deliveryCount})
+	}
+
+	entries := st.entries[st.after(g.lastDelivered):]
+	if len(entries) > count-len(res.Messages) {
+		entries = entries[:count-len(res.Messages)]
+	}
+	for _, entry := range entries {
+		g.deliver(entry.ID, QueueGroup, cons, now)
+		g.lastDelivered = entry.ID
+		res.Messages = append(res.Messages, QueueMessage{ID: entry.ID, Message: queueMessage(entry), Deliveries: 1})
+	}
+	return res, nil
+}
+
+// QAck acknowledges the given messages of the queue stored at key,
+// deleting them, and returns the number of messages that were in flight
+func (c *Cache) QAck(key string, ids []StreamID) (int, error) {
+	st, g, err := c.queueGroup(key)
+	if err != nil || st == nil {
+		return 0, err
+	}
+
+	acked := 0
+	for _, id := range ids {
+		pe, ok := g.pending[id]
+		if !ok {
+			continue
+		}
+		delete(g.pending, id)
+		delete(g.consumers[pe.consumer].pending, id)
+		st.remove(id)
+		acked++
+	}
+	return acked, nil
+}
+
+// queueMessage returns the message of an entry of a queue, or the value of
+// its first field for the entries added with XADD
+func queueMessage(entry StreamEntry) string {
+	for i := 0; i+1 < len(entry.Fields); i += 2 {
+		if entry.Fields[i] == QueueField {
+			return entry.Fields[i+1]
+		}
+	}
+	if len(entry.Fields) >= 2 {
+		return entry.Fields[1]
+	}
+	return ""
+}
+
+// remove deletes the entry with the given ID from the stream
+func (st *stream) remove(id StreamID) {
+	i := sort.Search(len(st.entries), func(i int) bool {
+		return !st.entries[i].ID.Less(id)
+	})
+	if i < len(st.entries) && st.entries[i].ID == id {
+		st.entries = append(st.entries[:i], st.entries[i+1:]...)
+	}
+}
@@ -0,0 +1,142 @@
+package cache
+
+import (
+	"sort"
+	"strings"
+)
+
+// radixNode is a node of a radix tree of keys, whose edges are labelled
+// with the part of the keys they add. size counts the keys of the subtree
+// so that the keys sharing a prefix are counted without being walked
+type radixNode struct {
+	label string
+	// children are sorted by the first byte of their label, which differs
+	// between the children of a node
+	children []*radixNode
+	leaf     bool
+	size     int
+}
+
+// child returns the index of the child whose label starts with b, or the
+// index it would be inserted at
+func (n *radixNode) child(b byte) (int, bool) {
+	i := sort.Search(len(n.children), func(i int) bool { return n.children[i].label[0] >= b })
+	return i, i < len(n.children) && n.children[i].label[0] == b
+}
+
+// insert adds key, relative to the node, reporting whether it was missing
+func (n *radixNode) insert(key string) bool {
+	if key == "" {
+		if n.leaf {
+			return false
+		}
+		n.leaf = true
+		n.size++
+		return true
+	}
+
+	i, ok := n.child(key[0])
+	if !ok {
+		n.children = append(n.children, nil)
+		copy(n.children[i+1:], n.children[i:])
+		n.children[i] = &radixNode{label: key, leaf: true, size: 1}
+		n.size++
+		return true
+	}
+
+	child := n.children[i]
+	common := 0
+	for common < len(child.label) && common < len(key) && child.label[common] == key[common] {
+		common++
+	}
+	if common < len(child.label) {
+		// the key leaves the edge midway, which is split there
+		split := &radixNode{label: child.label[:common], children: []*radixNode{child}, size: child.size}
+		child.label = child.label[common:]
+		n.children[i] = split
+		child = split
+	}
+	if !child.insert(key[common:]) {
+		return false
+	}
+	n.size++
+	return true
+}
+
+// remove deletes key, relative to the node, reporting whether it was
+// there, and merges the edges left with a single child and no key
+func (n *radixNode) remove(key string) bool {
+	if key == "" {
+		if !n.leaf {
+			return false
+		}
+		n.leaf = false
+		n.size--
+		return true
+	}
+
+	i, ok := n.child(key[0])
+	if !ok || !strings.HasPrefix(key, n.children[i].label) {
+		return false
+	}
+	child := n.children[i]
+	if !child.remove(key[len(child.label):]) {
+		return false
+	}
+	n.size--
+
+	switch {
+	case child.size == 0:
+		n.children = append(n.children[:i], n.children[i+1:]...)
+	case !child.leaf && len(child.children) == 1:
+		grandchild := child.children[0]
+		grandchild.label = child.label + grandchild.label
+		n.children[i] = grandchild
+	}
+	return true
+}
+
+// seek returns the node holding the keys starting with prefix, along with
+// the key it stands for, or nil if no key starts with prefix
+func (n *radixNode) seek(prefix string) (*radixNode, string) {
+	path := ""
+	for prefix != "" {
+		i, ok := n.child(prefix[0])
+		if !ok {
+			return nil, ""
+		}
+		child := n.children[i]
+		switch {
+		case strings.HasPrefix(prefix, child.label):
+			prefix = prefix[len(child.label):]
+			path += child.label
+			n = child
+		case strings.HasPrefix(child.label, prefix):
+			return child, path + child.label
+		default:
+			return nil, ""
+		}
+	}
+	return n, path
+}
+
+// walk calls fn with the keys of the subtree of the node standing for
+// path in lexicographic order, only those greater than after if resume is
+// set, until fn returns false, reporting whether fn always returned true
+func (n *radixNode) walk(path, after string, resume bool, fn func(key string) bool) bool {
+	if n.leaf && (!resume || path > after) && !fn(path) {
+		return false
+	}
+	for _, child := range n.children {
+		p := path + child.label
+		// the keys of the subtree all sort before after unless p is a
+		// prefix of after or sorts after it
+		if resume && p < after && !strings.HasPrefix(after, p) {
+			continue
+		}
+		if !child.walk(p, after, resume, fn) {
+			return false
+		}
+	}
+	return true
+}
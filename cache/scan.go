@@ -0,0 +1,129 @@
+package cache
+
+import (
+	"container/heap"
+	"hash/maphash"
+)
+
+// scanSeed orders the keys for Scan. It is fixed for the lifetime of the
+// process so that cursors stay valid across calls
+var scanSeed = maphash.MakeSeed()
+
+// Scan returns up to count keys starting at cursor, along with the cursor
+// to continue from, which is 0 once every key has been returned. Calls
+// starting at cursor 0 and following the returned cursors return every key
+// present for the whole iteration, whatever the writes in between, though
+// a key may be returned more than once if it is deleted and set again
+// Keys are ordered by a hash of their name, the cursor being the hash the
+// next call starts from, and each call walks the whole keyspace. Expired
+// keys are skipped and, when pattern is not empty, only the keys matching
+// it are returned, so a call may return fewer keys than count. A pattern
+// whose match with a key takes more than MatchBudget steps fails the call
+// with ErrPatternTooComplex
+func (c *Cache) Scan(cursor uint64, count int, pattern string) ([]string, uint64, error) {
+	return c.ScanType(cursor, count, pattern, "")
+}
+
+// ScanType is Scan returning only the keys whose values are of type typ,
+// as named by Type, when it is not empty. The keys of the other types
+// still count towards count
+func (c *Cache) ScanType(cursor uint64, count int, pattern, typ string) ([]string, uint64, error) {
+	if count <= 0 {
+		count = 10
+	}
+
+	// keep the count smallest hashes from cursor on in a max-heap
+	now := c.Now().UnixMilli()
+	h := make(scanHeap, 0, count)
+	for key, obj := range c.data {
+		if c.expired(obj, now) {
+			continue
+		}
+		sum := maphash.String(scanSeed, key)
+		switch {
+		case sum < cursor:
+		case len(h) < count:
+			heap.Push(&h, scanEntry{sum, key})
+		case sum < h[0].sum:
+			h[0] = scanEntry{sum, key}
+			heap.Fix(&h, 0)
+		}
+	}
+	if len(h) == 0 {
+		return nil, 0, nil
+	}
+
+	// a full page ends at its largest hash, which is returned in full even
+	// when it is shared by several keys so that the next call skips past it
+	last := h[0].sum
+	keys := make([]string, 0, len(h))
+	for _, e := range h {
+		ok, err := scanMatch(e.key, c.data[e.key], pattern, typ)
+		if err != nil {
+			return nil, 0, err
+		}
+		if ok {
+			keys = append(keys, e.key)
+		}
+	}
+	if len(h) < count || last == ^uint64(0) {
+		return keys, 0, nil
+	}
+	for key, obj := range c.data {
+		if maphash.String(scanSeed, key) != last || h.contains(key) {
+			continue
+		}
+		if c.expired(obj, now) {
+			continue
+		}
+		ok, err := scanMatch(key, obj, pattern, typ)
+		if err != nil {
+			return nil, 0, err
+		}
+		if ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys, last + 1, nil
+}
+
+// scanMatch reports whether the key holding obj matches the pattern and
+// the type of a scan, empty ones matching every key, failing with
+// ErrPatternTooComplex once the match takes more than MatchBudget steps
+func scanMatch(key string, obj *obj, pattern, typ string) (bool, error) {
+	if typ != "" && typeName(obj.value) != typ {
+		return false, nil
+	}
+	if pattern == "" {
+		return true, nil
+	}
+	return MatchPatternBudget(pattern, key, MatchBudget)
+}
+
+type scanEntry struct {
+	sum uint64
+	key string
+}
+
+// scanHeap is a max-heap of keys by hash
+type scanHeap []scanEntry
+
+func (h scanHeap) Len() int           { return len(h) }
+func (h scanHeap) Less(i, j int) bool { return h[i].sum > h[j].sum }
+func (h scanHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *scanHeap) Push(x any)        { *h = append(*h, x.(scanEntry)) }
+func (h *scanHeap) Pop() any {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
+
+func (h scanHeap) contains(key string) bool {
+	for _, e := range h {
+		if e.key == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,83 @@
+package cache
+
+// scrubber holds the progress of Scrub over the keyspace
+type scrubber struct {
+	// visited is the number of keys visited by the current pass
+	visited int
+	// checked, expired, problems and passes count the keys checked, the
+	// expired keys deleted, the inconsistencies found and the passes
+	// completed
+	checked, expired, problems, passes int64
+}
+
+// ScrubStats reports the activity of Scrub
+type ScrubStats struct {
+	// Visited is the number of keys visited by the current pass
+	Visited int64
+	// Checked counts the keys checked, Expired the expired keys deleted,
+	// Problems the inconsistencies found and Passes the passes over the
+	// keyspace completed
+	Checked, Expired, Problems, Passes int64
+}
+
+// ScrubStats returns the counters of Scrub
+func (c *Cache) ScrubStats() ScrubStats {
+	s := &c.scrub
+	return ScrubStats{
+		Visited:  int64(s.visited),
+		Checked:  s.checked,
+		Expired:  s.expired,
+		Problems: s.problems,
+		Passes:   s.passes,
+	}
+}
+
+// Scrub checks count keys as Check does, and returns the inconsistencies
+// found, repairing them if repair is set, so that a keyspace too big to
+// be checked at once is checked a few keys at a time in the background.
+// The expired keys visited are deleted, unless the expired keys are not
+// deleted as found, for those never looked up again not to wait for the
+// active expiration to sample them. The batches start wherever the
+// iteration of the keyspace does, at random, and a pass is counted once
+// it visited as many keys as the keyspace holds, so a pass misses some
+// keys and visits others twice. The counters of Stats and the prefix
+// index, which are checked against the whole keyspace, are left to Check
+func (c *Cache) Scrub(count int, repair bool) []CheckProblem {
+	if len(c.data) == 0 {
+		c.scrub.visited = 0
+		return nil
+	}
+
+	var problems []CheckProblem
+	problem := func(key, problem, fix string) {
+		p := CheckProblem{Key: key, Problem: problem}
+		if repair {
+			p.Repair = fix
+		}
+		problems = append(problems, p)
+	}
+
+	s := &c.scrub
+	now := c.Now().UnixMilli()
+	n := 0
+	for key, o := range c.data {
+		if n == count {
+			break
+		}
+		n++
+		if c.expireMode == ExpireDelete && c.expired(o, now) {
+			c.evict(key, ReasonExpired)
+			s.expired++
+			continue
+		}
+		c.checkKey(key, o, repair, problem)
+		s.checked++
+	}
+
+	s.problems += int64(len(problems))
+	if s.visited += n; s.visited >= len(c.data) {
+		s.visited = 0
+		s.passes++
+	}
+	return problems
+}
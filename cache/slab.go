@@ -0,0 +1,73 @@
+package cache
+
+// objSlabSize is the number of headers of keys allocated at once by a slab
+const objSlabSize = 512
+
+// objSlabs allocates the headers of the keys from slabs, arrays of headers
+// allocated at once, reusing the headers of the keys removed before
+// carving new ones
+type objSlabs struct {
+	// slab is what is left of the slab headers are carved from
+	slab []obj
+	// free holds the headers of the keys removed, zeroed
+	free []*obj
+	// slabs counts the slabs allocated
+	slabs int64
+}
+
+// WithEntrySlabs allocates the headers of the keys, holding their value,
+// expiry and access times, 512 at a time from slabs rather than one by
+// one, and reuses the headers of the keys removed. The garbage collector
+// then has a few large objects to find rather than one per key, which
+// shortens its marking on keyspaces of millions of keys, and the headers
+// of the keys written together sit together. The slabs are never returned
+// to the runtime but along with the whole keyspace by FLUSHALL, so the
+// headers freed by a keyspace shrinking are only reused by the keys
+// written next. The values are still allocated on their own, as Snapshot
+// and COPY share the strings
+func WithEntrySlabs() Option {
+	return func(c *Cache) {
+		c.objs = &objSlabs{}
+	}
+}
+
+// alloc returns a zeroed header, reusing a freed one if any
+func (s *objSlabs) alloc() *obj {
+	if n := len(s.free); n > 0 {
+		o := s.free[n-1]
+		s.free[n-1] = nil
+		s.free = s.free[:n-1]
+		return o
+	}
+	if len(s.slab) == 0 {
+		s.slab = make([]obj, objSlabSize)
+		s.slabs++
+	}
+	o := &s.slab[0]
+	s.slab = s.slab[1:]
+	return o
+}
+
+// release zeroes o, which must no longer be referenced, dropping its value
+// for the garbage collector, and keeps it for the next alloc
+func (s *objSlabs) release(o *obj) {
+	*o = obj{}
+	s.free = append(s.free, o)
+}
+
+// EntrySlabStats reports the slabs the headers of the keys are allocated
+// from
+type EntrySlabStats struct {
+	// Slabs is the number of slabs allocated and Free the number of
+	// headers freed, waiting to be reused
+	Slabs, Free int64
+}
+
+// EntrySlabStats returns the counters of the slabs, all zero without
+// WithEntrySlabs
+func (c *Cache) EntrySlabStats() EntrySlabStats {
+	if c.objs == nil {
+		return EntrySlabStats{}
+	}
+	return EntrySlabStats{Slabs: c.objs.slabs, Free: int64(len(c.objs.free))}
+}
@@ -0,0 +1,77 @@
+package cache
+
+import "time"
+
+// Snapshot is a copy of the keyspace at a point in time, for the embedders
+// exporting or checking the whole keyspace periodically. It is read only
+// and independent of the cache, so it can be iterated from any goroutine,
+// by several at once, while the cache keeps serving writes
+type Snapshot struct {
+	data    map[string]*obj
+	takenAt time.Time
+}
+
+// Snapshot copies the keyspace, leaving out the expired keys. The strings
+// are shared with the cache, which never modifies them in place, and the
+// values of the other types are copied deeply, as COPY does, so taking a
+// snapshot holds the goroutine using the cache for as long as it takes to
+// copy the collections. The strings spilled to disk are read back into the
+// snapshot, and left on disk. The module values whose type has no Copy are
+// shared, and must not be written while the snapshot is iterated
+func (c *Cache) Snapshot() *Snapshot {
+	s := &Snapshot{data: make(map[string]*obj, len(c.data)), takenAt: c.Now()}
+	now := s.takenAt.UnixMilli()
+	for key, o := range c.data {
+		if c.expired(o, now) {
+			continue
+		}
+		cp := *o
+		switch v := o.value.(type) {
+		case []byte, intString, embeddedString, compressedString, checkedString:
+		case spilledString:
+			payload, err := c.spill.store.Read(key)
+			if err == nil {
+				cp.value, err = unspillPayload(payload)
+			}
+			if err != nil {
+				// the key is evicted by the next read in the cache
+				continue
+			}
+		default:
+			cp.value = cloneValue(v)
+		}
+		s.data[key] = &cp
+	}
+	return s
+}
+
+// Time returns when the snapshot was taken
+func (s *Snapshot) Time() time.Time {
+	return s.takenAt
+}
+
+// Len returns the number of keys of the snapshot
+func (s *Snapshot) Len() int {
+	return len(s.data)
+}
+
+// Range calls fn with every key of the snapshot in no particular order,
+// until fn returns false, along with its type, expiry and serialized value
+// as Export returns them. A string that no longer matches its checksum is
+// passed with ErrCorrupt and neither a payload nor a value, for integrity
+// checks to report it
+func (s *Snapshot) Range(fn func(key string, e Export, err error) bool) {
+	for key, o := range s.data {
+		var err error
+		if v, ok := o.value.(checkedString); ok {
+			_, err = v.bytes()
+		}
+		e := Export{Type: typeName(o.value), ExpiresAt: o.expiresAt}
+		if err == nil {
+			e = exportObj(o, encodeValue(o.value))
+		}
+		if !fn(key, e, err) {
+			return
+		}
+	}
+}
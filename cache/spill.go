@@ -0,0 +1,342 @@
+package cache
+
+import (
+	"encoding/binary"
+	"errors"
+	"log"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// spillSample is the number of strings sampled by every round of
+	// SpillCold, the least recently accessed quarter of which is spilled
+	spillSample = 64
+	// spillMaxVisits bounds the keys visited to find a sample, for the
+	// keyspaces holding few strings long enough to spill
+	spillMaxVisits = 16 * spillSample
+	// spillMinSize is the length from which strings are spilled, the
+	// shorter ones freeing too little to be worth a read from disk
+	spillMinSize = 128
+)
+
+// the flags of the header byte of a spilled string
+const (
+	spillCompressed = 1 << iota
+	spillChecked
+)
+
+var errBadSpill = errors.New("corrupt spilled value")
+
+// SpillStore holds the strings spilled to disk by a cache created with
+// WithSpill, such as a bbolt, Pebble or Badger database. Its methods are
+// called on the goroutine using the cache, so the store should be local
+type SpillStore interface {
+	// Write deletes the given keys, then stores the given values, as a
+	// single batch
+	Write(values map[string][]byte, deleted []string) error
+	// Read returns the value stored for key
+	Read(key string) ([]byte, error)
+	// Clear deletes every value
+	Clear() error
+	Close() error
+}
+
+// spilledString stands for a string spilled to disk, holding the length
+// of its payload in the SpillStore
+type spilledString int
+
+// spiller holds the state of the strings spilled to disk
+type spiller struct {
+	store SpillStore
+	// maxBytes is the size of the keys and strings in memory above which
+	// the cold strings are spilled
+	maxBytes int64
+	// dropped are the keys whose spilled values were replaced, deleted or
+	// read back, deleted from the store along with the next batch
+	dropped []string
+	// values and bytes are the number and size of the strings on disk
+	values, bytes int64
+	// spilled and faults count the strings spilled and those read back
+	spilled, faults int64
+}
+
+// WithSpill makes the cache a tier in front of store: while the keys and
+// strings stored, as counted by Stats, exceed maxBytes, SpillCold moves the
+// strings least recently accessed to store, and reading a key spilled reads
+// its string back into memory. Only the strings of at least 128 bytes are
+// spilled, the keys and their metadata staying in memory
+func WithSpill(store SpillStore, maxBytes int64) Option {
+	return func(c *Cache) {
+		c.spill = &spiller{store: store, maxBytes: maxBytes}
+	}
+}
+
+// SpillStats reports the strings spilled to disk
+type SpillStats struct {
+	// Values and Bytes are the number of strings on disk and their size
+	// there
+	Values, Bytes int64
+	// Spilled counts the strings spilled and Faults those read back
+	Spilled, Faults int64
+}
+
+// SpillStats returns the current counters of the strings spilled to disk,
+// all zero without WithSpill
+func (c *Cache) SpillStats() SpillStats {
+	sp := c.spill
+	if sp == nil {
+		return SpillStats{}
+	}
+	return SpillStats{Values: sp.values, Bytes: sp.bytes, Spilled: sp.spilled, Faults: sp.faults}
+}
+
+// SpillCold spills the least recently accessed strings while the keys and
+// strings in memory exceed the limit given to WithSpill, sampling the
+// keyspace as the eviction of Redis does, and returns the number of
+// strings spilled. It stops once budget is spent, unless it is 0. The
+// spilled values dropped since the last call are deleted from the store
+// along with the first batch
+func (c *Cache) SpillCold(budget time.Duration) int {
+	sp := c.spill
+	if sp == nil {
+		return 0
+	}
+
+	start := time.Now()
+	spilled := 0
+	for {
+		batch := make(map[string][]byte)
+		if c.stats.bytes.Load() > sp.maxBytes {
+			c.coldStrings(batch)
+		}
+		if len(batch) == 0 && len(sp.dropped) == 0 {
+			break
+		}
+		if err := sp.store.Write(batch, sp.dropped); err != nil {
+			log.Println("spilling to disk:", err)
+			break
+		}
+		sp.dropped = nil
+		for key, payload := range batch {
+			c.setValue(key, c.data[key], spilledString(len(payload)))
+			sp.values++
+			sp.bytes += int64(len(payload))
+		}
+		spilled += len(batch)
+		sp.spilled += int64(len(batch))
+		if len(batch) == 0 || (budget > 0 && time.Since(start) >= budget) {
+			break
+		}
+	}
+	return spilled
+}
+
+// coldStrings adds to batch the payloads of the least recently accessed
+// quarter of a sample of the strings long enough to spill
+func (c *Cache) coldStrings(batch map[string][]byte) {
+	type candidate struct {
+		key        string
+		accessedAt int64
+	}
+	var sample []candidate
+	now := c.Now().UnixMilli()
+	visits := 0
+	for key, obj := range c.data {
+		if visits++; visits > spillMaxVisits || len(sample) == spillSample {
+			break
+		}
+		if spillable(obj.value) && !c.expired(obj, now) {
+			sample = append(sample, candidate{key, obj.accessedAt})
+		}
+	}
+
+	sort.Slice(sample, func(i, j int) bool { return sample[i].accessedAt < sample[j].accessedAt })
+	for i := 0; i < len(sample) && i <= len(sample)/4; i++ {
+		batch[sample[i].key] = spillPayload(c.data[sample[i].key].value)
+	}
+}
+
+// spillable reports whether value is a string long enough to spill
+func spillable(value any) bool {
+	if v, ok := value.(checkedString); ok {
+		value = v.value
+	}
+	switch v := value.(type) {
+	case []byte:
+		return len(v) >= spillMinSize
+	case compressedString:
+		return len(v) >= spillMinSize
+	default:
+		return false
+	}
+}
+
+// spillPayload returns the payload stored on disk for a spillable string,
+// a byte of flags followed by its checksum, if any, and its bytes as stored
+func spillPayload(value any) []byte {
+	var flags byte
+	var crc uint32
+	if v, ok := value.(checkedString); ok {
+		flags |= spillChecked
+		crc = v.crc
+		value = v.value
+	}
+	var b []byte
+	switch v := value.(type) {
+	case []byte:
+		b = v
+	case compressedString:
+		flags |= spillCompressed
+		b = v
+	}
+
+	payload := make([]byte, 1, 5+len(b))
+	payload[0] = flags
+	if flags&spillChecked != 0 {
+		payload = binary.BigEndian.AppendUint32(payload, crc)
+	}
+	return append(payload, b...)
+}
+
+// unspillPayload returns the string value of a payload of spillPayload
+func unspillPayload(payload []byte) (any, error) {
+	if len(payload) == 0 {
+		return nil, errBadSpill
+	}
+	flags, b := payload[0], payload[1:]
+	var crc uint32
+	if flags&spillChecked != 0 {
+		if len(b) < 4 {
+			return nil, errBadSpill
+		}
+		crc = binary.BigEndian.Uint32(b)
+		b = b[4:]
+	}
+
+	var value any = b
+	if flags&spillCompressed != 0 {
+		value = compressedString(b)
+	}
+	if flags&spillChecked != 0 {
+		value = checkedString{value: value, crc: crc}
+	}
+	return value, nil
+}
+
+// faultIn reads the string of key back from disk into obj, evicting the
+// key if the store fails to return it, and reports whether it was read
+func (c *Cache) faultIn(key string, obj *obj) bool {
+	payload, err := c.spill.store.Read(key)
+	var value any
+	if err == nil {
+		value, err = unspillPayload(payload)
+	}
+	if err != nil {
+		log.Printf("reading %q back from disk: %v\n", key, err)
+		c.evict(key, ReasonEvicted)
+		return false
+	}
+
+	c.dropSpilled(key, obj.value)
+	c.setValue(key, obj, value)
+	c.spill.faults++
+	return true
+}
+
+// dropSpilled has the payload of key deleted from the store with the next
+// batch if value is spilled, as it is being replaced or deleted
+func (c *Cache) dropSpilled(key string, value any) {
+	v, ok := value.(spilledString)
+	if !ok {
+		return
+	}
+	sp := c.spill
+	sp.dropped = append(sp.dropped, key)
+	sp.values--
+	sp.bytes -= int64(v)
+}
+
+// clearSpilled deletes every spilled value, the keyspace being flushed
+func (c *Cache) clearSpilled() {
+	sp := c.spill
+	if sp == nil {
+		return
+	}
+	sp.dropped = nil
+	sp.values, sp.bytes = 0, 0
+	if err := sp.store.Clear(); err != nil {
+		log.Println("clearing the values spilled to disk:", err)
+	}
+}
+
+var spillBucket = []byte("spill")
+
+// boltSpillStore is a SpillStore keeping the values in a bbolt file
+type boltSpillStore struct {
+	db *bolt.DB
+}
+
+// OpenBoltSpillStore returns a SpillStore keeping the values in the bbolt
+// file at path, emptied when opened since the values spilled by another
+// process are of no use. The file is not synced, as the values spilled are
+// lost with the process anyway
+func OpenBoltSpillStore(path string) (SpillStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second, NoSync: true, NoFreelistSync: true})
+	if err != nil {
+		return nil, err
+	}
+	s := &boltSpillStore{db: db}
+	if err := s.Clear(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *boltSpillStore) Write(values map[string][]byte, deleted []string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(spillBucket)
+		for _, key := range deleted {
+			if err := b.Delete([]byte(key)); err != nil {
+				return err
+			}
+		}
+		for key, value := range values {
+			if err := b.Put([]byte(key), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *boltSpillStore) Read(key string) ([]byte, error) {
+	var value []byte
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(spillBucket).Get([]byte(key))
+		if v == nil {
+			return ErrNoSuchKey
+		}
+		// v is only valid for the life of the transaction
+		value = append([]byte(nil), v...)
+		return nil
+	})
+	return value, err
+}
+
+func (s *boltSpillStore) Clear() error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(spillBucket); err != nil && err != bolt.ErrBucketNotFound {
+			return err
+		}
+		_, err := tx.CreateBucket(spillBucket)
+		return err
+	})
+}
+
+func (s *boltSpillStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,85 @@
+package cache
+
+import "time"
+
+// WithSoftTTL makes the keys loaded from the backing store stale after d,
+// while their TTL still bounds how long they are kept. Stale values are
+// still served, and are meant to be refreshed in the background with
+// StoreRefreshed, so that hot keys are reloaded before they expire and
+// their reads never wait for the backing store
+func WithSoftTTL(d time.Duration) Option {
+	return func(c *Cache) {
+		c.softTTL = d
+	}
+}
+
+// SoftExpireAt makes the value stored at key stale from the given unix
+// time in milliseconds, or never if staleAt is 0, and reports whether the
+// key exists. Writing the key makes it fresh again
+func (c *Cache) SoftExpireAt(key string, staleAt int64) bool {
+	obj, ok := c.lookup(key)
+	if !ok {
+		return false
+	}
+
+	obj.staleAt = staleAt
+	return true
+}
+
+// StaleTime returns the unix time in milliseconds from which the value
+// stored at key is stale, -1 if it never goes stale and -2 if the key does
+// not exist
+func (c *Cache) StaleTime(key string) int64 {
+	obj, ok := c.lookup(key)
+	if !ok {
+		return -2
+	}
+	if obj.staleAt == 0 {
+		return -1
+	}
+	return obj.staleAt
+}
+
+// GetStale returns the string stored at key like Get, along with whether
+// it is stale
+func (c *Cache) GetStale(key string) ([]byte, bool, error) {
+	obj, ok := c.lookup(key)
+	if !ok {
+		return nil, false, ErrNoSuchKey
+	}
+
+	val, err := stringBytes(obj.value)
+	if err != nil {
+		return nil, false, err
+	}
+	return val, obj.isStale(c.Now().UnixMilli()), nil
+}
+
+func (o *obj) isStale(now int64) bool {
+	return o.staleAt != 0 && o.staleAt <= now
+}
+
+// StoreRefreshed stores a value returned by Load to refresh the stale value
+// stored at key, and reports whether it was stored. The key is left as it
+// is if it was written or deleted since it went stale
+func (c *Cache) StoreRefreshed(key string, value []byte, ttl time.Duration) bool {
+	obj, ok := c.lookup(key)
+	if !ok || !obj.isStale(c.Now().UnixMilli()) {
+		return false
+	}
+
+	c.storeLoaded(key, value, ttl)
+	return true
+}
+
+// DropStale deletes key if its value is stale, after the backing store
+// reported it missing when refreshing it, and reports whether it was deleted
+func (c *Cache) DropStale(key string) bool {
+	obj, ok := c.lookup(key)
+	if !ok || !obj.isStale(c.Now().UnixMilli()) {
+		return false
+	}
+
+	c.deleteObj(key)
+	return true
+}
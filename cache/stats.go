@@ -0,0 +1,77 @@
+package cache
+
+import "sync/atomic"
+
+// Stats reports the contents and the activity of a cache since it was
+// created. Its counters are kept atomically, so that Stats can be called
+// from any goroutine
+type Stats struct {
+	// Entries is the number of keys, the expired keys not deleted yet
+	// included
+	Entries int64
+	// Hits and Misses count the lookups of keys that found the key and
+	// those that did not, by the writes reading a key first as by the
+	// reads, the expired keys counting as misses
+	Hits, Misses int64
+	// Expired counts the keys deleted for having expired, and Evicted
+	// those deleted to make room
+	Expired, Evicted int64
+	// Bytes is the total length of the keys and of the strings as stored,
+	// the values of the other types not being counted
+	Bytes int64
+}
+
+// HitRatio returns the fraction of the lookups that found their key, 0
+// before any lookup
+func (s Stats) HitRatio() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// cacheStats holds the counters of Stats
+type cacheStats struct {
+	entries, hits, misses, expired, evicted, bytes atomic.Int64
+}
+
+// Stats returns the current counters and gauges of the cache
+func (c *Cache) Stats() Stats {
+	return Stats{
+		Entries: c.stats.entries.Load(),
+		Hits:    c.stats.hits.Load(),
+		Misses:  c.stats.misses.Load(),
+		Expired: c.stats.expired.Load(),
+		Evicted: c.stats.evicted.Load(),
+		Bytes:   c.stats.bytes.Load(),
+	}
+}
+
+// storedSize returns the number of bytes counted by Stats for a value,
+// those of the strings as stored and none for the other types
+func storedSize(value any) int64 {
+	switch v := value.(type) {
+	case []byte:
+		return int64(len(v))
+	case intString:
+		return 8
+	case embeddedString:
+		return int64(len(v.bytes()))
+	case compressedString:
+		return int64(len(v))
+	case checkedString:
+		return storedSize(v.value) + 4
+	default:
+		return 0
+	}
+}
+
+// setValue replaces the value of obj, stored at key, in place
+func (c *Cache) setValue(key string, obj *obj, value any) {
+	delta := storedSize(value) - storedSize(obj.value)
+	c.stats.bytes.Add(delta)
+	if t := c.tenantOf(key); t != nil {
+		t.bytes.Add(delta)
+	}
+	obj.value = value
+}
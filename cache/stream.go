@@ -0,0 +1,271 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidStreamID is returned when a stream ID cannot be parsed
+	ErrInvalidStreamID = errors.New("invalid stream ID specified as stream command argument")
+	// ErrStreamIDTooSmall is returned when XADD is given an ID that is not
+	// greater than the last ID of the stream
+	ErrStreamIDTooSmall = errors.New("the ID specified in XADD is equal or smaller than the target stream top item")
+)
+
+// StreamID identifies an entry of a stream. IDs are ordered first by
+// the millisecond timestamp and then by the sequence number
+type StreamID struct {
+	Ms  uint64
+	Seq uint64
+}
+
+// MaxStreamID is the largest possible stream ID
+var MaxStreamID = StreamID{Ms: math.MaxUint64, Seq: math.MaxUint64}
+
+func (id StreamID) String() string {
+	return fmt.Sprintf("%d-%d", id.Ms, id.Seq)
+}
+
+// Less reports whether id sorts before other
+func (id StreamID) Less(other StreamID) bool {
+	if id.Ms != other.Ms {
+		return id.Ms < other.Ms
+	}
+	return id.Seq < other.Seq
+}
+
+// ParseStreamID parses an ID of the form "<ms>-<seq>" or "<ms>"
+// When the sequence part is omitted defaultSeq is used
+func ParseStreamID(s string, defaultSeq uint64) (StreamID, error) {
+	msPart, seqPart, hasSeq := strings.Cut(s, "-")
+
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return StreamID{}, ErrInvalidStreamID
+	}
+
+	if !hasSeq {
+		return StreamID{Ms: ms, Seq: defaultSeq}, nil
+	}
+
+	seq, err := strconv.ParseUint(seqPart, 10, 64)
+	if err != nil {
+		return StreamID{}, ErrInvalidStreamID
+	}
+
+	return StreamID{Ms: ms, Seq: seq}, nil
+}
+
+// StreamEntry is a single entry of a stream
+// Fields holds the field-value pairs in the order they were added
+type StreamEntry struct {
+	ID     StreamID
+	Fields []string
+}
+
+// stream is an append-only log of entries ordered by ID
+type stream struct {
+	entries []StreamEntry
+	lastID  StreamID
+	// groups holds the consumer groups of the stream by name
+	groups map[string]*consumerGroup
+}
+
+// nextID generates the ID for a new entry from the given ID specification
+// The spec can be "*" (fully auto-generated), "<ms>-*" (auto-generated
+// sequence) or an explicit "<ms>-<seq>", now being the time of the cache
+func (st *stream) nextID(spec string, now time.Time) (StreamID, error) {
+	if spec == "*" {
+		ms := uint64(now.UnixMilli())
+		if ms <= st.lastID.Ms {
+			// the clock went backwards or we are within the same millisecond
+			return StreamID{Ms: st.lastID.Ms, Seq: st.lastID.Seq + 1}, nil
+		}
+		return StreamID{Ms: ms}, nil
+	}
+
+	if strings.HasSuffix(spec, "-*") {
+		ms, err := strconv.ParseUint(strings.TrimSuffix(spec, "-*"), 10, 64)
+		if err != nil {
+			return StreamID{}, ErrInvalidStreamID
+		}
+		if ms < st.lastID.Ms {
+			return StreamID{}, ErrStreamIDTooSmall
+		}
+
+		id := StreamID{Ms: ms}
+		if ms == st.lastID.Ms {
+			id.Seq = st.lastID.Seq + 1
+		} else if ms == 0 {
+			// 0-0 is never a valid entry ID
+			id.Seq = 1
+		}
+		return id, nil
+	}
+
+	id, err := ParseStreamID(spec, 0)
+	if err != nil {
+		return StreamID{}, err
+	}
+	if id == (StreamID{}) {
+		return StreamID{}, errors.New("the ID specified in XADD must be greater than 0-0")
+	}
+	if !st.lastID.Less(id) {
+		return StreamID{}, ErrStreamIDTooSmall
+	}
+	return id, nil
+}
+
+// after returns the index of the first entry with an ID greater than id
+func (st *stream) after(id StreamID) int {
+	return sort.Search(len(st.entries), func(i int) bool {
+		return id.Less(st.entries[i].ID)
+	})
+}
+
+// rangeOf returns up to count entries with IDs in [start, end]
+// A count <= 0 means no limit
+func (st *stream) rangeOf(start, end StreamID, count int) []StreamEntry {
+	i := sort.Search(len(st.entries), func(i int) bool {
+		return !st.entries[i].ID.Less(start)
+	})
+
+	var result []StreamEntry
+	for ; i < len(st.entries); i++ {
+		if end.Less(st.entries[i].ID) {
+			break
+		}
+		if count > 0 && len(result) == count {
+			break
+		}
+		result = append(result, st.entries[i])
+	}
+
+	return result
+}
+
+// getStream returns the stream stored at key or nil if the key does not exist
+func (c *Cache) getStream(key string) (*stream, error) {
+	obj, ok := c.lookup(key)
+	if !ok {
+		return nil, nil
+	}
+
+	st, ok := obj.value.(*stream)
+	if !ok {
+		return nil, ErrWrongType
+	}
+
+	return st, nil
+}
+
+// XAdd appends a new entry with the given field-value pairs to the stream
+// stored at key, creating the stream if needed, and returns the entry ID
+func (c *Cache) XAdd(key string, idSpec string, fields []string) (StreamID, error) {
+	return c.XAddMaxLen(key, idSpec, fields, -1)
+}
+
+// XAddMaxLen appends a new entry as XAdd does, and then trims the oldest
+// entries of the stream down to maxLen unless maxLen is negative, so that
+// a stream of recent items stays bounded without a separate trim
+func (c *Cache) XAddMaxLen(key string, idSpec string, fields []string, maxLen int) (StreamID, error) {
+	if len(fields) == 0 || len(fields)%2 != 0 {
+		return StreamID{}, errors.New("wrong number of arguments for 'xadd' command")
+	}
+
+	// validate the ID before creating the key so that a failed XADD
+	// does not leave an empty stream behind
+	existing, err := c.getStream(key)
+	if err != nil {
+		return StreamID{}, err
+	}
+	st := existing
+	if st == nil {
+		st = &stream{}
+	}
+
+	id, err := st.nextID(idSpec, c.Now())
+	if err != nil {
+		return StreamID{}, err
+	}
+
+	if existing == nil {
+		c.setCreated(key, st)
+	}
+
+	st.entries = append(st.entries, StreamEntry{ID: id, Fields: fields})
+	st.lastID = id
+	if maxLen >= 0 {
+		st.trim(maxLen)
+	}
+	return id, nil
+}
+
+// trim drops the oldest entries of the stream down to maxLen. The entries
+// are dropped from the front of the slice, whose backing array is
+// reallocated without them by the next appends once full, so trimming on
+// every append costs no copy of the stream
+func (st *stream) trim(maxLen int) {
+	drop := len(st.entries) - maxLen
+	if drop <= 0 {
+		return
+	}
+	for i := 0; i < drop; i++ {
+		st.entries[i] = StreamEntry{}
+	}
+	st.entries = st.entries[drop:]
+}
+
+// XLen returns the number of entries of the stream stored at key
+func (c *Cache) XLen(key string) (int, error) {
+	st, err := c.getStream(key)
+	if err != nil || st == nil {
+		return 0, err
+	}
+
+	return len(st.entries), nil
+}
+
+// XRange returns up to count entries of the stream stored at key whose
+// IDs lie within [start, end]. A count <= 0 means no limit
+func (c *Cache) XRange(key string, start, end StreamID, count int) ([]StreamEntry, error) {
+	st, err := c.getStream(key)
+	if err != nil || st == nil {
+		return nil, err
+	}
+
+	return st.rangeOf(start, end, count), nil
+}
+
+// XReadAfter returns up to count entries of the stream stored at key with
+// an ID strictly greater than id. A count <= 0 means no limit
+func (c *Cache) XReadAfter(key string, id StreamID, count int) ([]StreamEntry, error) {
+	st, err := c.getStream(key)
+	if err != nil || st == nil {
+		return nil, err
+	}
+
+	entries := st.entries[st.after(id):]
+	if count > 0 && len(entries) > count {
+		entries = entries[:count]
+	}
+
+	return entries, nil
+}
+
+// XLastID returns the ID of the last entry added to the stream stored at key
+// or 0-0 if the stream does not exist
+func (c *Cache) XLastID(key string) (StreamID, error) {
+	st, err := c.getStream(key)
+	if err != nil || st == nil {
+		return StreamID{}, err
+	}
+
+	return st.lastID, nil
+}
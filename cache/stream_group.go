@@ -0,0 +1,478 @@
+package cache
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+// ErrBusyGroup is returned when creating a consumer group that already exists
+var ErrBusyGroup = &Error{Kind: KindBusyGroup, Msg: "Consumer Group name already exists"}
+
+// PendingEntry describes an entry that was delivered to a consumer
+// of a group but not yet acknowledged
+type PendingEntry struct {
+	ID         StreamID
+	Consumer   string
+	Idle       time.Duration
+	Deliveries int
+}
+
+// PendingSummary summarises the pending entries list of a consumer group
+type PendingSummary struct {
+	Count     int
+	Min       StreamID
+	Max       StreamID
+	Consumers map[string]int
+}
+
+// pendingEntry is an entry of the pending entries list (PEL)
+type pendingEntry struct {
+	consumer      string
+	deliveredAt   time.Time
+	deliveryCount int
+}
+
+type consumer struct {
+	seenAt  time.Time
+	pending map[StreamID]*pendingEntry
+}
+
+// consumerGroup tracks the delivery state of a stream for a set of consumers
+type consumerGroup struct {
+	lastDelivered StreamID
+	pending       map[StreamID]*pendingEntry
+	consumers     map[string]*consumer
+}
+
+func newConsumerGroup(lastDelivered StreamID) *consumerGroup {
+	return &consumerGroup{
+		lastDelivered: lastDelivered,
+		pending:       make(map[StreamID]*pendingEntry),
+		consumers:     make(map[string]*consumer),
+	}
+}
+
+// consumer returns the named consumer, creating it if needed, seen now
+func (g *consumerGroup) consumer(name string, now time.Time) *consumer {
+	cons, ok := g.consumers[name]
+	if !ok {
+		cons = &consumer{pending: make(map[StreamID]*pendingEntry)}
+		g.consumers[name] = cons
+	}
+	cons.seenAt = now
+	return cons
+}
+
+// deliver records that the entry was delivered to cons
+func (g *consumerGroup) deliver(id StreamID, name string, cons *consumer, now time.Time) {
+	pe, ok := g.pending[id]
+	if ok {
+		if pe.consumer != name {
+			delete(g.consumers[pe.consumer].pending, id)
+			pe.consumer = name
+		}
+	} else {
+		pe = &pendingEntry{consumer: name}
+		g.pending[id] = pe
+	}
+
+	pe.deliveredAt = now
+	pe.deliveryCount++
+	cons.pending[id] = pe
+}
+
+// sortedIDs returns the keys of a pending entries list in ascending order
+func sortedIDs(pel map[StreamID]*pendingEntry) []StreamID {
+	ids := make([]StreamID, 0, len(pel))
+	for id := range pel {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].Less(ids[j]) })
+	return ids
+}
+
+// entry returns the stream entry with the given ID
+func (st *stream) entry(id StreamID) (StreamEntry, bool) {
+	i := sort.Search(len(st.entries), func(i int) bool {
+		return !st.entries[i].ID.Less(id)
+	})
+	if i < len(st.entries) && st.entries[i].ID == id {
+		return st.entries[i], true
+	}
+	return StreamEntry{}, false
+}
+
+// getGroup returns the consumer group of the stream stored at key
+func (c *Cache) getGroup(key, group string) (*stream, *consumerGroup, error) {
+	st, err := c.getStream(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if st == nil || st.groups[group] == nil {
+		return nil, nil, Errorf(KindNoGroup, "No such key '%s' or consumer group '%s'", key, group)
+	}
+
+	return st, st.groups[group], nil
+}
+
+// XGroupCreate creates a consumer group that starts delivering entries
+// after the given ID, where "$" means the last entry of the stream
+// If mkStream is set, a missing stream is created empty
+func (c *Cache) XGroupCreate(key, group, idSpec string, mkStream bool) error {
+	st, err := c.getStream(key)
+	if err != nil {
+		return err
+	}
+	if st == nil && !mkStream {
+		return errors.New("the XGROUP subcommand requires the key to exist, use MKSTREAM to create an empty stream automatically")
+	}
+
+	var id StreamID
+	if idSpec != "$" {
+		if id, err = ParseStreamID(idSpec, 0); err != nil {
+			return err
+		}
+	}
+
+	if st == nil {
+		st = &stream{}
+		c.setCreated(key, st)
+	}
+	if idSpec == "$" {
+		id = st.lastID
+	}
+
+	if st.groups == nil {
+		st.groups = make(map[string]*consumerGroup)
+	}
+	if _, ok := st.groups[group]; ok {
+		return ErrBusyGroup
+	}
+
+	st.groups[group] = newConsumerGroup(id)
+	return nil
+}
+
+// XGroupSetID sets the last delivered ID of a consumer group
+func (c *Cache) XGroupSetID(key, group, idSpec string) error {
+	st, g, err := c.getGroup(key, group)
+	if err != nil {
+		return err
+	}
+
+	if idSpec == "$" {
+		g.lastDelivered = st.lastID
+		return nil
+	}
+
+	id, err := ParseStreamID(idSpec, 0)
+	if err != nil {
+		return err
+	}
+	g.lastDelivered = id
+	return nil
+}
+
+// XGroupDestroy deletes a consumer group and reports whether it existed
+func (c *Cache) XGroupDestroy(key, group string) (bool, error) {
+	st, err := c.getStream(key)
+	if err != nil || st == nil {
+		return false, err
+	}
+
+	if _, ok := st.groups[group]; !ok {
+		return false, nil
+	}
+	delete(st.groups, group)
+	return true, nil
+}
+
+// XGroupCreateConsumer adds a consumer to a group and reports whether it was created
+func (c *Cache) XGroupCreateConsumer(key, group, name string) (bool, error) {
+	_, g, err := c.getGroup(key, group)
+	if err != nil {
+		return false, err
+	}
+
+	if _, ok := g.consumers[name]; ok {
+		return false, nil
+	}
+	g.consumer(name, c.Now())
+	return true, nil
+}
+
+// XGroupDelConsumer removes a consumer from a group, dropping its pending
+// entries, and returns the number of pending entries it had
+func (c *Cache) XGroupDelConsumer(key, group, name string) (int, error) {
+	_, g, err := c.getGroup(key, group)
+	if err != nil {
+		return 0, err
+	}
+
+	cons, ok := g.consumers[name]
+	if !ok {
+		return 0, nil
+	}
+
+	for id := range cons.pending {
+		delete(g.pending, id)
+	}
+	delete(g.consumers, name)
+	return len(cons.pending), nil
+}
+
+// XReadGroupNew delivers up to count entries that were never delivered to
+// any consumer of the group. Unless noAck is set, the entries are added to
+// the pending entries list of the consumer
+func (c *Cache) XReadGroupNew(key, group, name string, count int, noAck bool) ([]StreamEntry, error) {
+	st, g, err := c.getGroup(key, group)
+	if err != nil {
+		return nil, err
+	}
+
+	cons := g.consumer(name, c.Now())
+	entries := st.entries[st.after(g.lastDelivered):]
+	if count > 0 && len(entries) > count {
+		entries = entries[:count]
+	}
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	now := c.Now()
+	for _, entry := range entries {
+		if !noAck {
+			g.deliver(entry.ID, name, cons, now)
+		}
+	}
+	g.lastDelivered = entries[len(entries)-1].ID
+
+	return entries, nil
+}
+
+// XReadGroupHistory returns up to count entries from the consumer's pending
+// entries list with an ID greater than after, bumping their delivery count
+func (c *Cache) XReadGroupHistory(key, group, name string, after StreamID, count int) ([]StreamEntry, error) {
+	st, g, err := c.getGroup(key, group)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		now     = c.Now()
+		cons    = g.consumer(name, now)
+		entries = []StreamEntry{}
+	)
+	for _, id := range sortedIDs(cons.pending) {
+		if !after.Less(id) {
+			continue
+		}
+		if count > 0 && len(entries) == count {
+			break
+		}
+
+		entry, ok := st.entry(id)
+		if !ok {
+			// the entry was removed from the stream, report it without fields
+			entry = StreamEntry{ID: id}
+		}
+		g.deliver(id, name, cons, now)
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// XAck removes the given IDs from the pending entries list of the group
+// and returns the number of entries that were acknowledged
+func (c *Cache) XAck(key, group string, ids []StreamID) (int, error) {
+	st, err := c.getStream(key)
+	if err != nil || st == nil {
+		return 0, err
+	}
+	g, ok := st.groups[group]
+	if !ok {
+		return 0, nil
+	}
+
+	acked := 0
+	for _, id := range ids {
+		pe, ok := g.pending[id]
+		if !ok {
+			continue
+		}
+		delete(g.pending, id)
+		if cons, ok := g.consumers[pe.consumer]; ok {
+			delete(cons.pending, id)
+		}
+		acked++
+	}
+
+	return acked, nil
+}
+
+// XPendingSummary returns an overview of the pending entries of a group
+func (c *Cache) XPendingSummary(key, group string) (PendingSummary, error) {
+	_, g, err := c.getGroup(key, group)
+	if err != nil {
+		return PendingSummary{}, err
+	}
+
+	summary := PendingSummary{Count: len(g.pending), Consumers: make(map[string]int)}
+	first := true
+	for id, pe := range g.pending {
+		if first || id.Less(summary.Min) {
+			summary.Min = id
+		}
+		if first || summary.Max.Less(id) {
+			summary.Max = id
+		}
+		first = false
+		summary.Consumers[pe.consumer]++
+	}
+
+	return summary, nil
+}
+
+// XPendingRange returns up to count pending entries of a group with IDs in
+// [start, end] that have been idle for at least minIdle. When consumer is
+// not empty only the entries of that consumer are returned
+func (c *Cache) XPendingRange(key, group string, start, end StreamID, count int, consumer string, minIdle time.Duration) ([]PendingEntry, error) {
+	_, g, err := c.getGroup(key, group)
+	if err != nil {
+		return nil, err
+	}
+
+	pel := g.pending
+	if consumer != "" {
+		cons, ok := g.consumers[consumer]
+		if !ok {
+			return nil, nil
+		}
+		pel = cons.pending
+	}
+
+	var (
+		now    = c.Now()
+		result []PendingEntry
+	)
+	for _, id := range sortedIDs(pel) {
+		if id.Less(start) || end.Less(id) {
+			continue
+		}
+		if count > 0 && len(result) == count {
+			break
+		}
+
+		pe := pel[id]
+		idle := now.Sub(pe.deliveredAt)
+		if idle < minIdle {
+			continue
+		}
+		result = append(result, PendingEntry{
+			ID:         id,
+			Consumer:   pe.consumer,
+			Idle:       idle,
+			Deliveries: pe.deliveryCount,
+		})
+	}
+
+	return result, nil
+}
+
+// XClaim transfers ownership of the given pending entries to consumer
+// if they have been idle for at least minIdle, and returns the claimed
+// entries. Unless justID is set the delivery count of claimed entries
+// is incremented
+func (c *Cache) XClaim(key, group, name string, minIdle time.Duration, ids []StreamID, justID bool) ([]StreamEntry, error) {
+	st, g, err := c.getGroup(key, group)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		now     = c.Now()
+		cons    = g.consumer(name, now)
+		entries = []StreamEntry{}
+	)
+	for _, id := range ids {
+		pe, ok := g.pending[id]
+		if !ok || now.Sub(pe.deliveredAt) < minIdle {
+			continue
+		}
+
+		entry, ok := st.entry(id)
+		if !ok {
+			// the entry no longer exists, so it can never be processed
+			delete(g.pending, id)
+			delete(g.consumers[pe.consumer].pending, id)
+			continue
+		}
+
+		g.claim(id, pe, name, cons, now, justID)
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// XAutoClaim scans the pending entries list of the group starting at start
+// and claims up to count entries idle for at least minIdle, like XClaim
+// It returns the ID to resume the scan from (0-0 once the scan is complete),
+// the claimed entries and the IDs of pending entries that no longer exist
+func (c *Cache) XAutoClaim(key, group, name string, minIdle time.Duration, start StreamID, count int, justID bool) (StreamID, []StreamEntry, []StreamID, error) {
+	st, g, err := c.getGroup(key, group)
+	if err != nil {
+		return StreamID{}, nil, nil, err
+	}
+
+	var (
+		now     = c.Now()
+		cons    = g.consumer(name, now)
+		entries = []StreamEntry{}
+		deleted = []StreamID{}
+		next    StreamID
+	)
+	for _, id := range sortedIDs(g.pending) {
+		if id.Less(start) {
+			continue
+		}
+		if len(entries)+len(deleted) == count {
+			next = id
+			break
+		}
+
+		pe := g.pending[id]
+		if now.Sub(pe.deliveredAt) < minIdle {
+			continue
+		}
+
+		entry, ok := st.entry(id)
+		if !ok {
+			delete(g.pending, id)
+			delete(g.consumers[pe.consumer].pending, id)
+			deleted = append(deleted, id)
+			continue
+		}
+
+		g.claim(id, pe, name, cons, now, justID)
+		entries = append(entries, entry)
+	}
+
+	return next, entries, deleted, nil
+}
+
+// claim moves a pending entry to the given consumer
+func (g *consumerGroup) claim(id StreamID, pe *pendingEntry, name string, cons *consumer, now time.Time, justID bool) {
+	if pe.consumer != name {
+		delete(g.consumers[pe.consumer].pending, id)
+		pe.consumer = name
+		cons.pending[id] = pe
+	}
+
+	pe.deliveredAt = now
+	if !justID {
+		pe.deliveryCount++
+	}
+}
@@ -0,0 +1,109 @@
+package cache
+
+import (
+	"strings"
+	"sync/atomic"
+)
+
+// tenant holds the counters of the keys starting with a prefix
+type tenant struct {
+	prefix                    string
+	keys, bytes, hits, misses atomic.Int64
+}
+
+// WithTenants counts the keys, their bytes as counted by Stats, and the
+// lookups of the keys starting with each of prefixes apart, for
+// TenantStats to break the keyspace down by tenant. A key belongs to the
+// longest of the prefixes it starts with, and to no tenant if it starts
+// with none, the empty prefix being ignored. It costs a comparison with
+// the prefixes on every key looked up, created, resized or deleted, so
+// the prefixes are meant to be a few
+func WithTenants(prefixes ...string) Option {
+	return func(c *Cache) {
+		seen := make(map[string]bool)
+		c.tenants = nil
+		for _, prefix := range prefixes {
+			if prefix != "" && !seen[prefix] {
+				seen[prefix] = true
+				c.tenants = append(c.tenants, &tenant{prefix: prefix})
+			}
+		}
+	}
+}
+
+// tenantOf returns the tenant key belongs to, that of the longest prefix
+// it starts with, nil if none
+func (c *Cache) tenantOf(key string) *tenant {
+	var found *tenant
+	for _, t := range c.tenants {
+		if strings.HasPrefix(key, t.prefix) && (found == nil || len(t.prefix) > len(found.prefix)) {
+			found = t
+		}
+	}
+	return found
+}
+
+// countLookup counts a lookup of key in Stats and in its tenant
+func (c *Cache) countLookup(key string, hit bool) {
+	t := c.tenantOf(key)
+	if hit {
+		c.stats.hits.Add(1)
+		if t != nil {
+			t.hits.Add(1)
+		}
+		return
+	}
+	c.stats.misses.Add(1)
+	if t != nil {
+		t.misses.Add(1)
+	}
+}
+
+// recountTenants counts the keys and bytes of the tenants from the
+// keyspace
+func (c *Cache) recountTenants() {
+	for _, t := range c.tenants {
+		t.keys.Store(0)
+		t.bytes.Store(0)
+	}
+	for key, o := range c.data {
+		if t := c.tenantOf(key); t != nil {
+			t.keys.Add(1)
+			t.bytes.Add(int64(len(key)) + storedSize(o.value))
+		}
+	}
+}
+
+// TenantStats reports the keys starting with a prefix of WithTenants
+type TenantStats struct {
+	// Prefix is the prefix of the keys of the tenant
+	Prefix string
+	// Stats counts the keys of the tenant as Stats counts the keyspace,
+	// Expired and Evicted left zero
+	Stats
+}
+
+// Tenant returns the prefix of WithTenants key belongs to, and false if
+// it belongs to none
+func (c *Cache) Tenant(key string) (string, bool) {
+	if t := c.tenantOf(key); t != nil {
+		return t.prefix, true
+	}
+	return "", false
+}
+
+// TenantStats returns the counters of the tenants in the order their
+// prefixes were given to WithTenants, none without it. It can be called
+// from any goroutine
+func (c *Cache) TenantStats() []TenantStats {
+	stats := make([]TenantStats, len(c.tenants))
+	for i, t := range c.tenants {
+		stats[i] = TenantStats{Prefix: t.prefix, Stats: Stats{
+			Entries: t.keys.Load(),
+			Hits:    t.hits.Load(),
+			Misses:  t.misses.Load(),
+			Bytes:   t.bytes.Load(),
+		}}
+	}
+	return stats
+}
@@ -0,0 +1,82 @@
+package cache
+
+import (
+	"errors"
+	"time"
+)
+
+// ThrottleLimit describes a rate limit of count actions per period,
+// allowing bursts of up to MaxBurst actions beyond the steady rate
+type ThrottleLimit struct {
+	MaxBurst int64
+	Count    int64
+	Period   time.Duration
+}
+
+// ThrottleResult is the outcome of Throttle
+type ThrottleResult struct {
+	// Limited is set when the actions were refused
+	Limited bool
+	// Limit is the total number of actions allowed at once, MaxBurst + 1
+	Limit int64
+	// Remaining is the number of actions that would be allowed right now
+	Remaining int64
+	// RetryAfter is how long to wait before the actions would be
+	// allowed, -1 if they were allowed or can never be
+	RetryAfter time.Duration
+	// ResetAfter is how long the limit takes to be fully available again
+	ResetAfter time.Duration
+}
+
+// Throttle applies the generic cell rate algorithm to quantity actions
+// against the limit tracked at key, as the CL.THROTTLE command of
+// redis-cell. The key holds the theoretical arrival time of the next action
+// as unix nanoseconds and expires once the limit is fully available again
+func (c *Cache) Throttle(key string, limit ThrottleLimit, quantity int64, now time.Time) (ThrottleResult, error) {
+	if limit.MaxBurst < 0 || limit.Count <= 0 || limit.Period <= 0 || quantity < 0 {
+		return ThrottleResult{}, errors.New("invalid rate limit")
+	}
+
+	tat := now.UnixNano()
+	if obj, ok := c.lookup(key); ok {
+		val, err := stringBytes(obj.value)
+		if err != nil {
+			return ThrottleResult{}, err
+		}
+		stored, ok := parseIntString(val)
+		if !ok {
+			return ThrottleResult{}, ErrNotInteger
+		}
+		if stored > tat {
+			tat = stored
+		}
+	}
+
+	emission := int64(limit.Period) / limit.Count
+	tolerance := emission * (limit.MaxBurst + 1)
+	increment := emission * quantity
+	newTat := tat + increment
+	diff := now.UnixNano() - (newTat - tolerance)
+
+	result := ThrottleResult{Limit: limit.MaxBurst + 1, RetryAfter: -1}
+	var ttl int64
+	if diff < 0 {
+		result.Limited = true
+		if increment <= tolerance {
+			result.RetryAfter = time.Duration(-diff)
+		}
+		ttl = tat - now.UnixNano()
+	} else {
+		ttl = newTat - now.UnixNano()
+		if ttl > 0 {
+			expiresAt := (newTat + int64(time.Millisecond) - 1) / int64(time.Millisecond)
+			c.setObj(key, c.newObjAt(intString(newTat), expiresAt))
+		}
+	}
+
+	if next := tolerance - ttl; next > -emission {
+		result.Remaining = next / emission
+	}
+	result.ResetAfter = time.Duration(ttl)
+	return result, nil
+}
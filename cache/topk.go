@@ -0,0 +1,275 @@
+package cache
+
+import (
+	"container/heap"
+	"errors"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+const (
+	// DefaultTopKWidth, DefaultTopKDepth and DefaultTopKDecay are the
+	// dimensions of the top-k lists reserved without them, as in RedisBloom
+	DefaultTopKWidth = 8
+	DefaultTopKDepth = 7
+	DefaultTopKDecay = 0.9
+	// maxTopKIncrement bounds the increments of TopKIncrBy, which decay
+	// contended buckets once per unit
+	maxTopKIncrement = 100000
+)
+
+// topK tracks the k heaviest hitters of a stream with HeavyKeeper: depth
+// rows of width buckets, each counting the item whose fingerprint it holds.
+// An item hashed to a bucket held by another item decays its count with a
+// probability falling exponentially with the count, so that the buckets
+// end up held by the frequent items. The k items with the largest counts
+// are kept in a min-heap
+type topK struct {
+	k, width, depth uint64
+	decay           float64
+	buckets         []topKBucket
+	heap            topKHeap
+}
+
+type topKBucket struct {
+	fingerprint uint64
+	count       uint64
+}
+
+// TopKItem is an item of a top-k list with its estimated count
+type TopKItem struct {
+	Item  string
+	Count uint64
+}
+
+func newTopK(k, width, depth uint64, decay float64) (*topK, error) {
+	if k == 0 || width == 0 || depth == 0 {
+		return nil, errors.New("invalid topk, width or depth")
+	}
+	if decay <= 0 || decay > 1 {
+		return nil, errors.New("decay must be between 0 and 1")
+	}
+	if width > maxFilterBits/128/depth || k > maxFilterBits/128 {
+		return nil, errFilterTooBig
+	}
+	return &topK{
+		k: k, width: width, depth: depth, decay: decay,
+		buckets: make([]topKBucket, width*depth),
+		heap:    topKHeap{index: make(map[string]int)},
+	}, nil
+}
+
+// incrBy counts n occurrences of item, decaying the counts of the other
+// items with rnd, and returns the item it expelled from the top-k list, if
+// any
+func (tk *topK) incrBy(item string, n uint64, rnd *rand.Rand) (string, bool) {
+	fp, h2 := filterHashes([]byte(item))
+	var max uint64
+	for i := uint64(0); i < tk.depth; i++ {
+		b := &tk.buckets[i*tk.width+(fp+i*h2)%tk.width]
+		switch {
+		case b.count == 0:
+			*b = topKBucket{fingerprint: fp, count: n}
+		case b.fingerprint == fp:
+			b.count += n
+		default:
+			for left := n; left > 0; left-- {
+				if rnd.Float64() >= math.Pow(tk.decay, float64(b.count)) {
+					continue
+				}
+				if b.count--; b.count == 0 {
+					*b = topKBucket{fingerprint: fp, count: left}
+					break
+				}
+			}
+			if b.fingerprint != fp {
+				continue
+			}
+		}
+		if b.count > max {
+			max = b.count
+		}
+	}
+
+	h := &tk.heap
+	if i, ok := h.index[item]; ok {
+		if max > h.items[i].Count {
+			h.items[i].Count = max
+			heap.Fix(h, i)
+		}
+		return "", false
+	}
+	if uint64(len(h.items)) < tk.k {
+		heap.Push(h, TopKItem{Item: item, Count: max})
+		return "", false
+	}
+	if max <= h.items[0].Count {
+		return "", false
+	}
+	expelled := h.items[0].Item
+	delete(h.index, expelled)
+	h.items[0] = TopKItem{Item: item, Count: max}
+	h.index[item] = 0
+	heap.Fix(h, 0)
+	return expelled, true
+}
+
+// list returns the items of the top-k list by decreasing count
+func (tk *topK) list() []TopKItem {
+	items := append([]TopKItem(nil), tk.heap.items...)
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Count != items[j].Count {
+			return items[i].Count > items[j].Count
+		}
+		return items[i].Item < items[j].Item
+	})
+	return items
+}
+
+func (tk *topK) clone() *topK {
+	cp := *tk
+	cp.buckets = append([]topKBucket(nil), tk.buckets...)
+	cp.heap = topKHeap{items: append([]TopKItem(nil), tk.heap.items...), index: make(map[string]int, len(tk.heap.index))}
+	for item, i := range tk.heap.index {
+		cp.heap.index[item] = i
+	}
+	return &cp
+}
+
+// topKHeap is a min-heap of the items of a top-k list by count, indexed by
+// item
+type topKHeap struct {
+	items []TopKItem
+	index map[string]int
+}
+
+func (h topKHeap) Len() int           { return len(h.items) }
+func (h topKHeap) Less(i, j int) bool { return h.items[i].Count < h.items[j].Count }
+
+func (h topKHeap) Swap(i, j int) {
+	h.items[i], h.items[j] = h.items[j], h.items[i]
+	h.index[h.items[i].Item] = i
+	h.index[h.items[j].Item] = j
+}
+
+func (h *topKHeap) Push(x any) {
+	item := x.(TopKItem)
+	h.index[item.Item] = len(h.items)
+	h.items = append(h.items, item)
+}
+
+func (h *topKHeap) Pop() any {
+	item := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	delete(h.index, item.Item)
+	return item
+}
+
+func (c *Cache) getTopK(key string) (*topK, error) {
+	obj, ok := c.lookup(key)
+	if !ok {
+		return nil, ErrNoSuchKey
+	}
+
+	tk, ok := obj.value.(*topK)
+	if !ok {
+		return nil, ErrWrongType
+	}
+	return tk, nil
+}
+
+// TopKReserve creates an empty top-k list at key keeping the k heaviest
+// hitters, counted in depth rows of width buckets decaying by decay
+func (c *Cache) TopKReserve(key string, k, width, depth uint64, decay float64) error {
+	if _, exists := c.lookup(key); exists {
+		return ErrItemExists
+	}
+
+	tk, err := newTopK(k, width, depth, decay)
+	if err != nil {
+		return err
+	}
+	c.setCreated(key, tk)
+	return nil
+}
+
+// TopKIncrBy counts the items by the matching increments in the top-k list
+// stored at key and returns for each the item it expelled from the list,
+// nil if none
+func (c *Cache) TopKIncrBy(key string, items []string, increments []uint64) ([]*string, error) {
+	tk, err := c.getTopK(key)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, n := range increments {
+		if n == 0 || n > maxTopKIncrement {
+			return nil, errors.New("increment must be an integer between 1 and 100000")
+		}
+	}
+
+	expelled := make([]*string, len(items))
+	for i, item := range items {
+		if out, ok := tk.incrBy(item, increments[i], c.rand); ok {
+			expelled[i] = &out
+		}
+	}
+	return expelled, nil
+}
+
+// TopKQuery reports for each item whether it is in the top-k list stored
+// at key
+func (c *Cache) TopKQuery(key string, items ...string) ([]bool, error) {
+	tk, err := c.getTopK(key)
+	if err != nil {
+		return nil, err
+	}
+
+	found := make([]bool, len(items))
+	for i, item := range items {
+		_, found[i] = tk.heap.index[item]
+	}
+	return found, nil
+}
+
+// TopKList returns the items of the top-k list stored at key by decreasing
+// estimated count
+func (c *Cache) TopKList(key string) ([]TopKItem, error) {
+	tk, err := c.getTopK(key)
+	if err != nil {
+		return nil, err
+	}
+	return tk.list(), nil
+}
+
+// TopK tracks the k heaviest hitters of a stream of items in fixed memory,
+// as the top-k lists of TOPK.RESERVE, for uses outside of the keyspace
+type TopK struct {
+	tk  *topK
+	rnd *rand.Rand
+}
+
+// NewTopK returns an empty TopK keeping the k heaviest hitters, counted in
+// depth rows of width buckets decaying by decay
+func NewTopK(k, width, depth int, decay float64) (*TopK, error) {
+	if k <= 0 || width <= 0 || depth <= 0 {
+		return nil, errors.New("invalid topk, width or depth")
+	}
+	tk, err := newTopK(uint64(k), uint64(width), uint64(depth), decay)
+	if err != nil {
+		return nil, err
+	}
+	return &TopK{tk: tk, rnd: rand.New(rand.NewSource(time.Now().UnixNano()))}, nil
+}
+
+// Add counts an occurrence of item
+func (t *TopK) Add(item string) {
+	t.tk.incrBy(item, 1, t.rnd)
+}
+
+// List returns the heaviest hitters by decreasing estimated count
+func (t *TopK) List() []TopKItem {
+	return t.tk.list()
+}
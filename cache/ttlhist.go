@@ -0,0 +1,68 @@
+package cache
+
+import "time"
+
+// TTLHistogramBounds are the upper bounds of the buckets of a TTLHistogram,
+// a last bucket counting the keys expiring later
+var TTLHistogramBounds = []time.Duration{
+	time.Second, 10 * time.Second, time.Minute, 10 * time.Minute,
+	time.Hour, 24 * time.Hour, 7 * 24 * time.Hour,
+}
+
+// TTLBucket counts keys and the bytes they hold, as Stats counts them
+type TTLBucket struct {
+	Keys  int64
+	Bytes int64
+}
+
+// TTLHistogram buckets the keys by the time they have left to live
+type TTLHistogram struct {
+	// Persistent counts the keys without an expire
+	Persistent TTLBucket
+	// Buckets counts the keys expiring before the matching bound of
+	// TTLHistogramBounds and after the previous one, the last bucket
+	// counting those expiring later. The keys expired but not deleted yet
+	// fall in the first bucket
+	Buckets []TTLBucket
+	// Sampled is the number of keys looked at, the counts being scaled to
+	// the whole keyspace when it is less than its size
+	Sampled int
+}
+
+// TTLHistogram buckets the keys by the time they have left to live,
+// looking at up to samples keys picked at random, or at every key if
+// samples is not positive, which walks the whole keyspace
+func (c *Cache) TTLHistogram(samples int) TTLHistogram {
+	h := TTLHistogram{Buckets: make([]TTLBucket, len(TTLHistogramBounds)+1)}
+	now := c.Now().UnixMilli()
+	for key, obj := range c.data {
+		if samples > 0 && h.Sampled == samples {
+			break
+		}
+		h.Sampled++
+
+		b := &h.Persistent
+		if obj.expiresAt != -1 {
+			ttl := time.Duration(obj.expiresAt-now) * time.Millisecond
+			i := 0
+			for i < len(TTLHistogramBounds) && ttl >= TTLHistogramBounds[i] {
+				i++
+			}
+			b = &h.Buckets[i]
+		}
+		b.Keys++
+		b.Bytes += int64(len(key)) + storedSize(obj.value)
+	}
+
+	if h.Sampled > 0 && h.Sampled < len(c.data) {
+		scale := func(b *TTLBucket) {
+			b.Keys = b.Keys * int64(len(c.data)) / int64(h.Sampled)
+			b.Bytes = b.Bytes * int64(len(c.data)) / int64(h.Sampled)
+		}
+		scale(&h.Persistent)
+		for i := range h.Buckets {
+			scale(&h.Buckets[i])
+		}
+	}
+	return h
+}
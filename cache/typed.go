@@ -0,0 +1,83 @@
+package cache
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Codec converts the values of a typed cache to the strings stored and
+// back. The bytes given to Unmarshal may be shared with the cache, so they
+// must not be kept or modified
+type Codec[V any] struct {
+	Marshal   func(v V) ([]byte, error)
+	Unmarshal func(data []byte) (V, error)
+}
+
+// JSONCodec returns a Codec storing the values as JSON
+func JSONCodec[V any]() Codec[V] {
+	return Codec[V]{
+		Marshal: func(v V) ([]byte, error) { return json.Marshal(v) },
+		Unmarshal: func(data []byte) (V, error) {
+			var v V
+			err := json.Unmarshal(data, &v)
+			return v, err
+		},
+	}
+}
+
+// GetTyped returns the value of type V stored at key by SetTyped with the
+// same codec. It fails with ErrNoSuchKey for missing keys, ErrWrongType for
+// keys that do not hold a string and the error of the codec for strings it
+// cannot decode
+func GetTyped[V any](c *Cache, key string, codec Codec[V]) (V, error) {
+	data, err := c.Get(key)
+	if err != nil {
+		var zero V
+		return zero, err
+	}
+	return codec.Unmarshal(data)
+}
+
+// SetTyped stores v at key as the string its codec encodes it to, expiring
+// after ttl, or never if ttl is 0
+func SetTyped[V any](c *Cache, key string, v V, ttl time.Duration, codec Codec[V]) error {
+	data, err := codec.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if ttl <= 0 {
+		return c.Set(key, data)
+	}
+	c.setObj(key, c.newObjAt(c.encodeString(data), c.expiry(ttl)))
+	return nil
+}
+
+// Typed is a view of a cache holding values of type V at keys of type K,
+// for the programs embedding the cache to use it without encoding their
+// values themselves. The values are stored as the strings of their codec,
+// so the server reads and writes them as any other string. Like the cache
+// it wraps, it is not safe for concurrent use
+type Typed[K ~string, V any] struct {
+	c     *Cache
+	codec Codec[V]
+}
+
+// NewTyped returns a view of c holding values of type V encoded by codec
+func NewTyped[K ~string, V any](c *Cache, codec Codec[V]) *Typed[K, V] {
+	return &Typed[K, V]{c: c, codec: codec}
+}
+
+// Get returns the value stored at key, failing as GetTyped does
+func (t *Typed[K, V]) Get(key K) (V, error) {
+	return GetTyped(t.c, string(key), t.codec)
+}
+
+// Set stores v at key, expiring after ttl, or never if ttl is 0
+func (t *Typed[K, V]) Set(key K, v V, ttl time.Duration) error {
+	return SetTyped(t.c, string(key), v, ttl, t.codec)
+}
+
+// Delete deletes key, reporting whether it existed
+func (t *Typed[K, V]) Delete(key K) bool {
+	return t.c.DeleteKeys(string(key)) == 1
+}
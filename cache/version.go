@@ -0,0 +1,69 @@
+package cache
+
+import "time"
+
+// Written records a write of the keys that exist, giving them their write
+// time and a new version, greater than every version given before. The
+// server calls it for the keys of every write, and the versions compared
+// by SET IFVERSION
+func (c *Cache) Written(keys ...string) {
+	now := c.Now().UnixMilli()
+	for _, key := range keys {
+		if obj, ok := c.data[key]; ok {
+			c.versionSeq++
+			obj.version = c.versionSeq
+			obj.writtenAt = now
+		}
+	}
+}
+
+// KeyInfo is the metadata of a key, its times being unix times in
+// milliseconds
+type KeyInfo struct {
+	// CreatedAt is when the value was created, by the write that created
+	// the key or by a later one replacing the value whole, such as SET
+	CreatedAt  int64
+	WrittenAt  int64
+	AccessedAt int64
+	// ExpiresAt is -1 for the keys without an expiry
+	ExpiresAt int64
+	Version   uint64
+}
+
+// KeyInfo returns the metadata of key, without counting as an access,
+// reporting whether the key exists
+func (c *Cache) KeyInfo(key string) (KeyInfo, bool) {
+	obj, ok := c.data[key]
+	if !ok || c.expired(obj, c.Now().UnixMilli()) {
+		return KeyInfo{}, false
+	}
+	return KeyInfo{
+		CreatedAt:  obj.createdAt,
+		WrittenAt:  obj.writtenAt,
+		AccessedAt: obj.accessedAt,
+		ExpiresAt:  obj.expiresAt,
+		Version:    c.Version(key),
+	}, true
+}
+
+// Version returns the version of key, or 0 if it does not exist. The keys
+// not written by a command since they were loaded or restored are given
+// a version then
+func (c *Cache) Version(key string) uint64 {
+	obj, ok := c.lookup(key)
+	if !ok {
+		return 0
+	}
+	if obj.version == 0 {
+		c.versionSeq++
+		obj.version = c.versionSeq
+	}
+	return obj.version
+}
+
+// initialVersion is the version the versions of a new cache start after.
+// As the versions are not saved, starting from the clock keeps those of a
+// restarted server greater than the versions it gave before
+func initialVersion() uint64 {
+	return uint64(time.Now().UnixMicro())
+}
@@ -0,0 +1,449 @@
+package cache
+
+import (
+	"errors"
+	"math"
+	"sort"
+)
+
+// ZMember is a member of a sorted set together with its score
+type ZMember struct {
+	Member string
+	Score  float64
+}
+
+// less orders members by score and then lexicographically by member
+func (m ZMember) less(other ZMember) bool {
+	if m.Score != other.Score {
+		return m.Score < other.Score
+	}
+	return m.Member < other.Member
+}
+
+// ZAddOpts controls how ZAdd treats existing and new members
+type ZAddOpts struct {
+	// NX only adds new members and never updates existing ones
+	NX bool
+	// XX only updates existing members and never adds new ones
+	XX bool
+	// CH makes ZAdd count changed members in addition to added ones
+	CH bool
+}
+
+const (
+	// defaultZSetMaxCompactEntries and defaultZSetMaxCompactValue are the
+	// number of members and the member length up to which sorted sets
+	// keep the compact encoding, as the listpack limits of Redis
+	defaultZSetMaxCompactEntries = 128
+	defaultZSetMaxCompactValue   = 64
+)
+
+// sortedSet keeps members ordered by score in a slice, with a dict
+// for constant time score lookups by member. Small sets are stored in a
+// compact encoding without the dict, their lookups scanning the slice,
+// which saves a map per set when keeping many small sets
+type sortedSet struct {
+	// dict is nil in the compact encoding
+	dict    map[string]float64
+	members []ZMember
+}
+
+// newSortedSet returns an empty sorted set in the compact encoding
+func newSortedSet() *sortedSet {
+	return &sortedSet{}
+}
+
+// WithSortedSetCompactLimits sets the number of members and the member
+// length up to which sorted sets are stored in the compact encoding,
+// converted to the full encoding once they grow past either. Zero entries
+// disables the compact encoding
+func WithSortedSetCompactLimits(entries, value int) Option {
+	return func(c *Cache) {
+		c.zsetMaxCompactEntries = entries
+		c.zsetMaxCompactValue = value
+	}
+}
+
+// score returns the score of member
+func (z *sortedSet) score(member string) (float64, bool) {
+	if z.dict != nil {
+		score, ok := z.dict[member]
+		return score, ok
+	}
+	for _, m := range z.members {
+		if m.Member == member {
+			return m.Score, true
+		}
+	}
+	return 0, false
+}
+
+// fitSortedSet converts a sorted set in the compact encoding to the full
+// one if it has too many members or if one of added is too long
+func (c *Cache) fitSortedSet(z *sortedSet, added ...ZMember) {
+	if z.dict != nil {
+		return
+	}
+	expand := len(z.members) > c.zsetMaxCompactEntries
+	for _, m := range added {
+		expand = expand || len(m.Member) > c.zsetMaxCompactValue
+	}
+	if !expand {
+		return
+	}
+
+	z.dict = make(map[string]float64, len(z.members))
+	for _, m := range z.members {
+		z.dict[m.Member] = m.Score
+	}
+}
+
+// search returns the index at which m is or would be stored
+func (z *sortedSet) search(m ZMember) int {
+	return sort.Search(len(z.members), func(i int) bool {
+		return !z.members[i].less(m)
+	})
+}
+
+func (z *sortedSet) insert(m ZMember) {
+	i := z.search(m)
+	z.members = append(z.members, ZMember{})
+	copy(z.members[i+1:], z.members[i:])
+	z.members[i] = m
+	if z.dict != nil {
+		z.dict[m.Member] = m.Score
+	}
+}
+
+func (z *sortedSet) remove(member string) bool {
+	score, ok := z.score(member)
+	if !ok {
+		return false
+	}
+
+	i := z.search(ZMember{Member: member, Score: score})
+	z.members = append(z.members[:i], z.members[i+1:]...)
+	delete(z.dict, member)
+	return true
+}
+
+// getSortedSet returns the sorted set stored at key or nil if the key does not exist
+func (c *Cache) getSortedSet(key string) (*sortedSet, error) {
+	obj, ok := c.lookup(key)
+	if !ok {
+		return nil, nil
+	}
+
+	z, ok := obj.value.(*sortedSet)
+	if !ok {
+		return nil, ErrWrongType
+	}
+
+	return z, nil
+}
+
+// ZAdd adds the members to the sorted set stored at key, creating it if
+// needed, and returns the number of added members (plus updated ones with CH)
+func (c *Cache) ZAdd(key string, opts ZAddOpts, members ...ZMember) (int, error) {
+	if opts.NX && opts.XX {
+		return 0, errors.New("XX and NX options at the same time are not compatible")
+	}
+
+	z, err := c.getSortedSet(key)
+	if err != nil {
+		return 0, err
+	}
+	if z == nil {
+		if opts.XX {
+			return 0, nil
+		}
+		z = newSortedSet()
+		c.setCreated(key, z)
+	}
+
+	changed := 0
+	for _, m := range members {
+		score, exists := z.score(m.Member)
+		switch {
+		case exists && !opts.NX:
+			if score == m.Score {
+				continue
+			}
+			z.remove(m.Member)
+			z.insert(m)
+			if opts.CH {
+				changed++
+			}
+		case !exists && !opts.XX:
+			z.insert(m)
+			c.fitSortedSet(z, m)
+			changed++
+		}
+	}
+
+	if len(z.members) == 0 {
+		c.deleteObj(key)
+	}
+	return changed, nil
+}
+
+// ZScore returns the score of member in the sorted set stored at key
+func (c *Cache) ZScore(key, member string) (float64, bool, error) {
+	z, err := c.getSortedSet(key)
+	if err != nil || z == nil {
+		return 0, false, err
+	}
+
+	score, ok := z.score(member)
+	return score, ok, nil
+}
+
+// ZRem removes the members from the sorted set stored at key
+// and returns the number of removed members
+func (c *Cache) ZRem(key string, members ...string) (int, error) {
+	z, err := c.getSortedSet(key)
+	if err != nil || z == nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, member := range members {
+		if z.remove(member) {
+			removed++
+		}
+	}
+
+	if len(z.members) == 0 {
+		c.deleteObj(key)
+	}
+	return removed, nil
+}
+
+// ZCard returns the number of members of the sorted set stored at key
+func (c *Cache) ZCard(key string) (int, error) {
+	z, err := c.getSortedSet(key)
+	if err != nil || z == nil {
+		return 0, err
+	}
+
+	return len(z.members), nil
+}
+
+// ZRange returns the members ranked between start and stop inclusive
+// Negative indexes count from the end of the set, -1 being the last member
+func (c *Cache) ZRange(key string, start, stop int) ([]ZMember, error) {
+	z, err := c.getSortedSet(key)
+	if err != nil || z == nil {
+		return nil, err
+	}
+
+	n := len(z.members)
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= n {
+		stop = n - 1
+	}
+	if start > stop {
+		return nil, nil
+	}
+
+	result := make([]ZMember, stop-start+1)
+	copy(result, z.members[start:stop+1])
+	return result, nil
+}
+
+// ZIncrBy adds increment to the score of member in the sorted set stored
+// at key, adding the member with the increment as its score if it is
+// missing, and returns its new score
+func (c *Cache) ZIncrBy(key string, increment float64, member string) (float64, error) {
+	z, err := c.getSortedSet(key)
+	if err != nil {
+		return 0, err
+	}
+
+	score, exists := 0.0, false
+	if z != nil {
+		score, exists = z.score(member)
+	}
+	score += increment
+	if math.IsNaN(score) {
+		return 0, errors.New("resulting score is not a number (NaN)")
+	}
+
+	if z == nil {
+		z = newSortedSet()
+		c.setCreated(key, z)
+	}
+	m := ZMember{Member: member, Score: score}
+	if exists {
+		z.remove(member)
+		z.insert(m)
+		return score, nil
+	}
+	z.insert(m)
+	c.fitSortedSet(z, m)
+	return score, nil
+}
+
+// ScoreRange is a range of scores, each bound being included unless it
+// is exclusive. Infinite bounds cover all the scores on their side
+type ScoreRange struct {
+	Min, Max                   float64
+	MinExclusive, MaxExclusive bool
+}
+
+// aboveMin reports whether score is not below the lower bound of r
+func (r ScoreRange) aboveMin(score float64) bool {
+	if r.MinExclusive {
+		return score > r.Min
+	}
+	return score >= r.Min
+}
+
+// belowMax reports whether score is not above the upper bound of r
+func (r ScoreRange) belowMax(score float64) bool {
+	if r.MaxExclusive {
+		return score < r.Max
+	}
+	return score <= r.Max
+}
+
+// ZCount returns the number of members of the sorted set stored at key
+// whose score is within r
+func (c *Cache) ZCount(key string, r ScoreRange) (int, error) {
+	z, err := c.getSortedSet(key)
+	if err != nil || z == nil {
+		return 0, err
+	}
+
+	first := sort.Search(len(z.members), func(i int) bool {
+		return r.aboveMin(z.members[i].Score)
+	})
+	last := sort.Search(len(z.members), func(i int) bool {
+		return !r.belowMax(z.members[i].Score)
+	})
+	if last < first {
+		return 0, nil
+	}
+	return last - first, nil
+}
+
+// ZPop removes and returns up to count members of the sorted set stored
+// at key, those with the lowest scores first, or the highest with max
+func (c *Cache) ZPop(key string, count int, max bool) ([]ZMember, error) {
+	z, err := c.getSortedSet(key)
+	if err != nil || z == nil {
+		return nil, err
+	}
+
+	if count > len(z.members) {
+		count = len(z.members)
+	}
+	popped := make([]ZMember, count)
+	if max {
+		for i := range popped {
+			popped[i] = z.members[len(z.members)-1-i]
+		}
+		z.members = z.members[:len(z.members)-count]
+	} else {
+		copy(popped, z.members)
+		z.members = append(z.members[:0], z.members[count:]...)
+	}
+	for _, m := range popped {
+		delete(z.dict, m.Member)
+	}
+
+	if len(z.members) == 0 {
+		c.deleteObj(key)
+	}
+	return popped, nil
+}
+
+// LexRange is a range of members of a sorted set whose members all have
+// the same score, each bound being included unless it is exclusive. An
+// unbounded side covers all the members on that side
+type LexRange struct {
+	Min, Max                   string
+	MinExclusive, MaxExclusive bool
+	MinUnbounded, MaxUnbounded bool
+}
+
+// aboveMin reports whether member is not below the lower bound of r
+func (r LexRange) aboveMin(member string) bool {
+	switch {
+	case r.MinUnbounded:
+		return true
+	case r.MinExclusive:
+		return member > r.Min
+	}
+	return member >= r.Min
+}
+
+// belowMax reports whether member is not above the upper bound of r
+func (r LexRange) belowMax(member string) bool {
+	switch {
+	case r.MaxUnbounded:
+		return true
+	case r.MaxExclusive:
+		return member < r.Max
+	}
+	return member <= r.Max
+}
+
+// lexRange returns the indexes of the first member within r and of the
+// member following the last one. As in Redis, the result is unspecified
+// when the members have different scores
+func (z *sortedSet) lexRange(r LexRange) (int, int) {
+	first := sort.Search(len(z.members), func(i int) bool {
+		return r.aboveMin(z.members[i].Member)
+	})
+	last := sort.Search(len(z.members), func(i int) bool {
+		return !r.belowMax(z.members[i].Member)
+	})
+	if last < first {
+		return first, first
+	}
+	return first, last
+}
+
+// ZRangeByLex returns the members of the sorted set stored at key within
+// r, skipping the first offset of them and returning at most count, a
+// negative count returning them all
+func (c *Cache) ZRangeByLex(key string, r LexRange, offset, count int) ([]ZMember, error) {
+	z, err := c.getSortedSet(key)
+	if err != nil || z == nil {
+		return nil, err
+	}
+
+	first, last := z.lexRange(r)
+	first += offset
+	if first >= last {
+		return nil, nil
+	}
+	if count >= 0 && first+count < last {
+		last = first + count
+	}
+
+	result := make([]ZMember, last-first)
+	copy(result, z.members[first:last])
+	return result, nil
+}
+
+// ZLexCount returns the number of members of the sorted set stored at key
+// within r
+func (c *Cache) ZLexCount(key string, r LexRange) (int, error) {
+	z, err := c.getSortedSet(key)
+	if err != nil || z == nil {
+		return 0, err
+	}
+
+	first, last := z.lexRange(r)
+	return last - first, nil
+}
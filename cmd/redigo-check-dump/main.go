@@ -0,0 +1,97 @@
+// Command redigo-check-dump validates command logs in the format of an
+// append only file before they are relied on, printing a summary of each:
+//
+//	redigo-check-dump [-fix] file [file ...]
+//
+// It exits with status 1 if a log is malformed, such as one truncated by a
+// crash, reporting the offset up to which it is valid. With -fix, the
+// malformed logs are truncated to that offset instead, dropping the
+// commands from there on
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/KavetiRohith/go-cache/server"
+)
+
+var fix = flag.Bool("fix", false, "Truncate the malformed logs to their last well formed command")
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [-fix] file [file ...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ok := true
+	for _, path := range flag.Args() {
+		if !checkFile(path) {
+			ok = false
+		}
+	}
+	if !ok {
+		os.Exit(1)
+	}
+}
+
+// checkFile prints the summary of the log at path, reporting whether it is
+// well formed or, with -fix, was repaired
+func checkFile(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return false
+	}
+	defer f.Close()
+
+	check := server.CheckLog(f)
+	if check.Err != nil {
+		fmt.Printf("%s: invalid at byte %d of %d: %v\n", path, check.Valid, check.Size, check.Err)
+	} else {
+		fmt.Printf("%s: OK\n", path)
+	}
+
+	total := 0
+	names := make([]string, 0, len(check.Commands))
+	for name, n := range check.Commands {
+		names = append(names, name)
+		total += n
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if check.Commands[names[i]] != check.Commands[names[j]] {
+			return check.Commands[names[i]] > check.Commands[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	counts := make([]string, len(names))
+	for i, name := range names {
+		counts[i] = fmt.Sprintf("%s=%d", name, check.Commands[name])
+	}
+
+	fmt.Printf("  %d bytes, %d commands, %d annotations, %d keys written\n", check.Size, total, check.Annotations, check.Keys)
+	if len(counts) > 0 {
+		fmt.Printf("  %s\n", strings.Join(counts, " "))
+	}
+	if check.Unknown > 0 || check.BadArity > 0 {
+		fmt.Printf("  %d unknown commands, %d with a wrong number of arguments\n", check.Unknown, check.BadArity)
+	}
+	if check.Err == nil || !*fix {
+		return check.Err == nil
+	}
+
+	if err := os.Truncate(path, check.Valid); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return false
+	}
+	fmt.Printf("  truncated to %d bytes, %d bytes dropped\n", check.Valid, check.Size-check.Valid)
+	return true
+}
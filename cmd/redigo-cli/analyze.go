@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// keySize is the size of a key, in the unit of its type for bigkeys and in
+// bytes for memkeys
+type keySize struct {
+	key, typ string
+	size     int64
+}
+
+// typeSizes sums the sizes of the keys of a type
+type typeSizes struct {
+	keys, total int64
+	biggest     keySize
+}
+
+// sizeUnits names the unit of the sizes of bigkeys per type, the types not
+// listed being sized by their serialized value in bytes
+var sizeUnits = map[string]string{
+	"string":    "bytes",
+	"ReJSON-RL": "bytes",
+	"zset":      "members",
+	"stream":    "entries",
+}
+
+// runAnalyze walks the keyspace with DUMPALL, reporting the biggest keys of
+// every type and how the keys split among the types, their sizes being
+// their length for strings, their number of members for sorted sets and
+// so on with bigkeys, and the bytes of their name and of their serialized
+// value, an estimate of their memory usage, with memkeys
+func runAnalyze(name string, args []string) error {
+	mem := name == "memkeys"
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	match := fs.String("match", "", "Analyze only the keys matching a glob-style pattern")
+	typ := fs.String("type", "", "Analyze only the keys of a type, as TYPE names it")
+	top := fs.Int("top", 10, "Report this many of the biggest keys")
+	fs.Parse(args)
+
+	c, err := dial(*addr)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	var (
+		keys, keyBytes int64
+		types          = make(map[string]*typeSizes)
+		biggest        []keySize
+	)
+	err = dumpAll(c, *match, *typ, func(r record) error {
+		size, err := sizeOf(c, r, mem)
+		if err != nil {
+			return err
+		}
+		keys++
+		keyBytes += int64(len(r.Key))
+
+		ks := keySize{r.Key, r.Type, size}
+		t, ok := types[r.Type]
+		if !ok {
+			t = &typeSizes{}
+			types[r.Type] = t
+		}
+		t.keys++
+		t.total += size
+		if t.keys == 1 || size > t.biggest.size {
+			t.biggest = ks
+		}
+		// the sizes of different types only compare in bytes
+		if mem {
+			biggest = appendBiggest(biggest, ks, *top)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(types))
+	for name := range types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	unit := func(typ string) string {
+		if u, ok := sizeUnits[typ]; ok && !mem {
+			return u
+		}
+		return "bytes"
+	}
+	percent := func(n, of int64) float64 {
+		if of == 0 {
+			return 0
+		}
+		return 100 * float64(n) / float64(of)
+	}
+
+	w := os.Stdout
+	fmt.Fprintf(w, "scanned %d keys, %d bytes of key names", keys, keyBytes)
+	if keys > 0 {
+		fmt.Fprintf(w, " (%.2f on average)", float64(keyBytes)/float64(keys))
+	}
+	fmt.Fprintln(w)
+
+	if mem {
+		var total int64
+		for _, t := range types {
+			total += t.total
+		}
+		fmt.Fprintf(w, "\n%d bytes in total\n\ntop %d keys by memory:\n", total, len(biggest))
+		for i, ks := range biggest {
+			fmt.Fprintf(w, "%4d) %q (%s) %d bytes\n", i+1, ks.key, ks.typ, ks.size)
+		}
+		fmt.Fprintf(w, "\nmemory per type:\n")
+		for _, name := range names {
+			t := types[name]
+			fmt.Fprintf(w, "  %-10s %d keys, %d bytes (%.2f%%)\n", name, t.keys, t.total, percent(t.total, total))
+		}
+		return nil
+	}
+
+	fmt.Fprintf(w, "\nbiggest keys per type:\n")
+	for _, name := range names {
+		t := types[name]
+		fmt.Fprintf(w, "  %-10s %q has %d %s\n", name, t.biggest.key, t.biggest.size, unit(name))
+	}
+	fmt.Fprintf(w, "\nkeys per type:\n")
+	for _, name := range names {
+		t := types[name]
+		fmt.Fprintf(w, "  %-10s %d keys (%.2f%%) with %d %s, %.2f on average\n",
+			name, t.keys, percent(t.keys, keys), t.total, unit(name), float64(t.total)/float64(t.keys))
+	}
+	return nil
+}
+
+// sizeOf returns the size of the key of a record, asking the server for the
+// number of members or entries of the sorted sets and the streams
+func sizeOf(c *conn, r record, mem bool) (int64, error) {
+	dump, err := base64.StdEncoding.DecodeString(r.Dump)
+	if err != nil {
+		return 0, fmt.Errorf("%s: invalid serialized value", r.Key)
+	}
+	if mem {
+		return int64(len(r.Key) + len(dump)), nil
+	}
+
+	var cmd string
+	switch r.Type {
+	case "string", "ReJSON-RL":
+		if r.Value != nil {
+			return int64(len(*r.Value)), nil
+		}
+	case "zset":
+		cmd = "ZCARD"
+	case "stream":
+		cmd = "XLEN"
+	}
+	if cmd == "" {
+		return int64(len(dump)), nil
+	}
+	n, err := c.do(cmd, r.Key)
+	if err != nil {
+		return 0, err
+	}
+	size, _ := n.(int64)
+	return size, nil
+}
+
+// appendBiggest adds ks to the keys sorted by decreasing size if it is
+// among the n biggest
+func appendBiggest(keys []keySize, ks keySize, n int) []keySize {
+	i := sort.Search(len(keys), func(i int) bool { return keys[i].size < ks.size })
+	if i >= n {
+		return keys
+	}
+	if len(keys) < n {
+		keys = append(keys, keySize{})
+	}
+	copy(keys[i+1:], keys[i:])
+	keys[i] = ks
+	return keys
+}
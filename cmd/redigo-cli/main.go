@@ -0,0 +1,385 @@
+// Command redigo-cli exports the keyspace of a server to JSON or CSV and
+// imports it back, for ad hoc migrations and for analysis in other tools,
+// and reports the biggest keys:
+//
+//	redigo-cli [-addr host:port] export [-format json|csv] [-match pattern] [-type type] [file]
+//	redigo-cli [-addr host:port] import [-format json|csv] [-replace] [file]
+//	redigo-cli [-addr host:port] bigkeys|memkeys [-match pattern] [-type type] [-top n]
+//
+// export streams the keyspace with DUMPALL, writing a record per key: a
+// JSON object per line, or a CSV row under a header, with the key, its
+// type, its expire time in unix milliseconds, -1 if it has none, its value
+// for strings and JSON documents, and its value serialized by DUMP. import
+// restores the keys from their serialized value with RESTORE, or from their
+// value alone with SET or JSON.SET, for the records written by other tools.
+// The format follows the extension of the file, JSON by default, and the
+// standard input or output is used without a file.
+//
+// bigkeys walks the keyspace the same way, reporting the biggest key of
+// every type, by length for strings and JSON documents, by number of
+// members or entries for sorted sets and streams and by serialized size
+// otherwise, along with the number and total size of the keys of every
+// type. memkeys reports the keys using the most memory instead, estimated
+// as the size of their name and of their serialized value, and the memory
+// used by every type
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var addr = flag.String("addr", "127.0.0.1:3000", "Set the address of the server")
+
+// exportBatch is the number of keys asked for by every DUMPALL
+const exportBatch = 1000
+
+// record is a key as exported
+type record struct {
+	Key      string  `json:"key"`
+	Type     string  `json:"type,omitempty"`
+	ExpireAt int64   `json:"expireat,omitempty"`
+	Value    *string `json:"value,omitempty"`
+	Dump     string  `json:"dump,omitempty"`
+}
+
+var csvHeader = []string{"key", "type", "expireat", "value", "dump"}
+
+func main() {
+	flag.Usage = func() {
+		out := flag.CommandLine.Output()
+		fmt.Fprintf(out, "usage: %s [-addr host:port] export [-format json|csv] [-match pattern] [-type type] [file]\n", os.Args[0])
+		fmt.Fprintf(out, "       %s [-addr host:port] import [-format json|csv] [-replace] [file]\n", os.Args[0])
+		fmt.Fprintf(out, "       %s [-addr host:port] bigkeys|memkeys [-match pattern] [-type type] [-top n]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	var err error
+	switch flag.Arg(0) {
+	case "export":
+		err = runExport(flag.Args()[1:])
+	case "import":
+		err = runImport(flag.Args()[1:])
+	case "bigkeys", "memkeys":
+		err = runAnalyze(flag.Arg(0), flag.Args()[1:])
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// formatOf returns the format given, or the one of the extension of path
+func formatOf(format, path string) (string, error) {
+	if format == "" {
+		format = "json"
+		if strings.EqualFold(filepath.Ext(path), ".csv") {
+			format = "csv"
+		}
+	}
+	if format != "json" && format != "csv" {
+		return "", fmt.Errorf("unknown format %s", format)
+	}
+	return format, nil
+}
+
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	format := fs.String("format", "", "Write json or csv, by default as the extension of the file says")
+	match := fs.String("match", "", "Export only the keys matching a glob-style pattern")
+	typ := fs.String("type", "", "Export only the keys of a type, as TYPE names it")
+	fs.Parse(args)
+
+	path := fs.Arg(0)
+	f, err := formatOf(*format, path)
+	if err != nil {
+		return err
+	}
+	out := os.Stdout
+	if path != "" {
+		if out, err = os.Create(path); err != nil {
+			return err
+		}
+		defer out.Close()
+	}
+
+	c, err := dial(*addr)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	w := bufio.NewWriter(out)
+	var cw *csv.Writer
+	if f == "csv" {
+		cw = csv.NewWriter(w)
+		cw.Write(csvHeader)
+	}
+
+	n := 0
+	err = dumpAll(c, *match, *typ, func(r record) error {
+		if cw != nil {
+			value := ""
+			if r.Value != nil {
+				value = *r.Value
+			}
+			cw.Write([]string{r.Key, r.Type, strconv.FormatInt(r.ExpireAt, 10), value, r.Dump})
+		} else {
+			b, err := json.Marshal(r)
+			if err != nil {
+				return err
+			}
+			w.Write(append(b, '\n'))
+		}
+		n++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if cw != nil {
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "exported %d keys\n", n)
+	return nil
+}
+
+// dumpAll iterates over the keys matching match and of type typ, if set,
+// with DUMPALL, calling fn with the record of every key
+func dumpAll(c *conn, match, typ string, fn func(record) error) error {
+	cursor := "0"
+	for {
+		args := []string{"DUMPALL", cursor, "COUNT", strconv.Itoa(exportBatch)}
+		if match != "" {
+			args = append(args, "MATCH", match)
+		}
+		if typ != "" {
+			args = append(args, "TYPE", typ)
+		}
+		reply, err := c.do(args...)
+		if err != nil {
+			return err
+		}
+		page, ok := reply.([]any)
+		if !ok || len(page) != 2 {
+			return errors.New("unexpected DUMPALL reply")
+		}
+		entries, _ := page[1].([]any)
+		for _, entry := range entries {
+			r, err := parseEntry(entry)
+			if err != nil {
+				return err
+			}
+			if err := fn(r); err != nil {
+				return err
+			}
+		}
+		if cursor, _ = page[0].(string); cursor == "0" {
+			return nil
+		}
+	}
+}
+
+// parseEntry returns the record of an entry of a DUMPALL reply
+func parseEntry(entry any) (record, error) {
+	fields, ok := entry.([]any)
+	if !ok || len(fields) != 5 {
+		return record{}, errors.New("unexpected DUMPALL entry")
+	}
+	var r record
+	r.Key, _ = fields[0].(string)
+	r.Type, _ = fields[1].(string)
+	r.ExpireAt, _ = fields[2].(int64)
+	r.Dump, _ = fields[3].(string)
+	if value, ok := fields[4].(string); ok {
+		r.Value = &value
+	}
+	return r, nil
+}
+
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	format := fs.String("format", "", "Read json or csv, by default as the extension of the file says")
+	replace := fs.Bool("replace", false, "Overwrite the existing keys rather than skipping them")
+	fs.Parse(args)
+
+	path := fs.Arg(0)
+	f, err := formatOf(*format, path)
+	if err != nil {
+		return err
+	}
+	in := os.Stdin
+	if path != "" {
+		if in, err = os.Open(path); err != nil {
+			return err
+		}
+		defer in.Close()
+	}
+
+	c, err := dial(*addr)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	next := jsonRecords(in)
+	if f == "csv" {
+		if next, err = csvRecords(in); err != nil {
+			return err
+		}
+	}
+
+	var imported, skipped, failed int
+	for {
+		r, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		ok, err := importRecord(c, r, *replace)
+		var e respError
+		switch {
+		case errors.As(err, &e):
+			fmt.Fprintf(os.Stderr, "%s: %v\n", r.Key, err)
+			failed++
+		case err != nil:
+			return err
+		case ok:
+			imported++
+		default:
+			skipped++
+		}
+	}
+	fmt.Fprintf(os.Stderr, "imported %d keys, %d existing keys skipped, %d failed\n", imported, skipped, failed)
+	return nil
+}
+
+// importRecord creates the key of a record, reporting false if it was
+// skipped for existing already
+func importRecord(c *conn, r record, replace bool) (bool, error) {
+	if r.Dump != "" {
+		ttl := "0"
+		if r.ExpireAt > 0 {
+			ttl = strconv.FormatInt(r.ExpireAt, 10)
+		}
+		args := []string{"RESTORE", r.Key, ttl, r.Dump, "ABSTTL"}
+		if replace {
+			args = append(args, "REPLACE")
+		}
+		_, err := c.do(args...)
+		if err != nil && strings.HasPrefix(err.Error(), "BUSYKEY") {
+			return false, nil
+		}
+		return err == nil, err
+	}
+
+	if r.Value == nil {
+		return false, respError("ERR neither a value nor a serialized value to import")
+	}
+	if !replace {
+		n, err := c.do("EXISTS", r.Key)
+		if err != nil || n != int64(0) {
+			return false, err
+		}
+	}
+	var err error
+	switch r.Type {
+	case "", "string":
+		_, err = c.do("SET", r.Key, *r.Value)
+	case "ReJSON-RL":
+		_, err = c.do("JSON.SET", r.Key, "$", *r.Value)
+	default:
+		err = respError("ERR a value of type " + r.Type + " is only imported from its serialized value")
+	}
+	if err == nil && r.ExpireAt > 0 {
+		_, err = c.do("PEXPIREAT", r.Key, strconv.FormatInt(r.ExpireAt, 10))
+	}
+	return err == nil, err
+}
+
+// jsonRecords returns a function reading the next record of a stream of
+// JSON objects, returning io.EOF after the last one
+func jsonRecords(r io.Reader) func() (record, error) {
+	dec := json.NewDecoder(r)
+	return func() (record, error) {
+		var rec record
+		if err := dec.Decode(&rec); err != nil {
+			return record{}, err
+		}
+		if rec.Key == "" {
+			return record{}, errors.New("record without a key")
+		}
+		return rec, nil
+	}
+}
+
+// csvRecords returns a function reading the next record of a CSV file,
+// whose header names its columns among those written by export, only key
+// being required, returning io.EOF after the last one
+func csvRecords(r io.Reader) (func() (record, error), error) {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+	cols := make(map[string]int)
+	for i, name := range header {
+		cols[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := cols["key"]; !ok {
+		return nil, errors.New("the CSV header has no key column")
+	}
+
+	return func() (record, error) {
+		row, err := cr.Read()
+		if err != nil {
+			return record{}, err
+		}
+		field := func(name string) (string, bool) {
+			i, ok := cols[name]
+			if !ok || i >= len(row) {
+				return "", false
+			}
+			return row[i], true
+		}
+
+		var rec record
+		rec.Key, _ = field("key")
+		rec.Type, _ = field("type")
+		rec.Dump, _ = field("dump")
+		if v, ok := field("expireat"); ok && v != "" {
+			if rec.ExpireAt, err = strconv.ParseInt(v, 10, 64); err != nil {
+				return record{}, fmt.Errorf("%s: invalid expireat %s", rec.Key, v)
+			}
+		}
+		// an empty value stands for none unless the record has no
+		// serialized value, a string being then empty
+		if v, ok := field("value"); ok && (v != "" || rec.Dump == "") {
+			rec.Value = &v
+		}
+		return rec, nil
+	}, nil
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+)
+
+// generator generates random commands of a group, supported alike by
+// redigo and Redis, with arguments drawn from small pools so that the
+// commands keep hitting the same keys, members and fields
+type generator struct {
+	group string
+	gen   func(g *gen) []string
+}
+
+// gen draws the arguments of the commands
+type gen struct {
+	r    *rand.Rand
+	keys int
+}
+
+// key returns one of the keys, shared by every group so that the commands
+// also run against keys of the wrong type
+func (g *gen) key() string {
+	return "k" + strconv.Itoa(g.r.Intn(g.keys))
+}
+
+// value returns a short string, an integer now and then
+func (g *gen) value() string {
+	if g.r.Intn(4) == 0 {
+		return strconv.Itoa(g.r.Intn(200) - 100)
+	}
+	b := make([]byte, 1+g.r.Intn(8))
+	for i := range b {
+		b[i] = "abcde"[g.r.Intn(5)]
+	}
+	return string(b)
+}
+
+func (g *gen) member() string {
+	return "m" + strconv.Itoa(g.r.Intn(8))
+}
+
+func (g *gen) score() string {
+	switch g.r.Intn(8) {
+	case 0:
+		return "-inf"
+	case 1:
+		return "+inf"
+	case 2:
+		return strconv.FormatFloat(g.r.Float64()*10, 'f', 2, 64)
+	default:
+		return strconv.Itoa(g.r.Intn(10))
+	}
+}
+
+// scoreRange returns a bound of ZCOUNT, exclusive now and then
+func (g *gen) scoreRange() string {
+	if g.r.Intn(4) == 0 {
+		return "(" + strconv.Itoa(g.r.Intn(10))
+	}
+	return g.score()
+}
+
+func (g *gen) lexRange() string {
+	switch g.r.Intn(6) {
+	case 0:
+		return "-"
+	case 1:
+		return "+"
+	case 2:
+		return "(" + g.member()
+	default:
+		return "[" + g.member()
+	}
+}
+
+func (g *gen) index() string {
+	return strconv.Itoa(g.r.Intn(12) - 4)
+}
+
+// pick returns one of choices
+func (g *gen) pick(choices ...string) string {
+	return choices[g.r.Intn(len(choices))]
+}
+
+// maybe returns args half of the time
+func (g *gen) maybe(args ...string) []string {
+	if g.r.Intn(2) == 0 {
+		return nil
+	}
+	return args
+}
+
+// expireAt returns a unix time in seconds, in the past now and then to
+// delete the key, and otherwise far enough in the future for the replies
+// not to depend on when the commands run
+func (g *gen) expireAt() int64 {
+	if g.r.Intn(4) == 0 {
+		return 1 + int64(g.r.Intn(1000))
+	}
+	return 4000000000 + int64(g.r.Intn(1000))
+}
+
+// streamID returns an explicit stream ID, as those generated by * depend
+// on the time
+func (g *gen) streamID() string {
+	return fmt.Sprintf("%d-%d", 1+g.r.Intn(20), g.r.Intn(3))
+}
+
+// lonLat returns the coordinates of a point around Paris
+func (g *gen) lonLat() (string, string) {
+	lon := 2.2 + g.r.Float64()*0.3
+	lat := 48.7 + g.r.Float64()*0.3
+	return strconv.FormatFloat(lon, 'f', 6, 64), strconv.FormatFloat(lat, 'f', 6, 64)
+}
+
+func (g *gen) bitfieldType() string {
+	return g.pick("u4", "i4", "u8", "i8", "u16", "i16")
+}
+
+// json returns a small JSON document
+func (g *gen) json() string {
+	switch g.r.Intn(4) {
+	case 0:
+		return strconv.Itoa(g.r.Intn(100))
+	case 1:
+		return strconv.Quote(g.value())
+	case 2:
+		return fmt.Sprintf(`{"a":%d,"b":[%d,%q]}`, g.r.Intn(10), g.r.Intn(10), g.value())
+	default:
+		return fmt.Sprintf(`[%d,{"c":%q}]`, g.r.Intn(10), g.value())
+	}
+}
+
+func (g *gen) jsonPath() string {
+	return g.pick("$", "$.a", "$.b", "$.b[0]", "$[0]", "$[1].c", "$..c")
+}
+
+func join(args ...[]string) []string {
+	var all []string
+	for _, a := range args {
+		all = append(all, a...)
+	}
+	return all
+}
+
+// generators are the commands generated, by group. The json group needs
+// the RedisJSON module on the reference server
+var generators = []generator{
+	{group: "keys", gen: func(g *gen) []string { return []string{"DEL", g.key(), g.key()} }},
+	{group: "keys", gen: func(g *gen) []string { return []string{"UNLINK", g.key()} }},
+	{group: "keys", gen: func(g *gen) []string { return []string{"EXISTS", g.key(), g.key(), g.key()} }},
+	{group: "keys", gen: func(g *gen) []string { return []string{"TOUCH", g.key(), g.key()} }},
+	{group: "keys", gen: func(g *gen) []string { return []string{"TYPE", g.key()} }},
+	{group: "keys", gen: func(g *gen) []string { return join([]string{"COPY", g.key(), g.key()}, g.maybe("REPLACE")) }},
+	{group: "keys", gen: func(g *gen) []string {
+		return join([]string{"EXPIREAT", g.key(), strconv.FormatInt(g.expireAt(), 10)}, g.maybe(g.pick("NX", "XX", "GT", "LT")))
+	}},
+	{group: "keys", gen: func(g *gen) []string {
+		return []string{"PEXPIREAT", g.key(), strconv.FormatInt(g.expireAt()*1000+int64(g.r.Intn(1000)), 10)}
+	}},
+	{group: "keys", gen: func(g *gen) []string { return []string{"EXPIRETIME", g.key()} }},
+	{group: "keys", gen: func(g *gen) []string { return []string{"PEXPIRETIME", g.key()} }},
+
+	{group: "string", gen: func(g *gen) []string { return []string{"SET", g.key(), g.value()} }},
+	{group: "string", gen: func(g *gen) []string { return []string{"GET", g.key()} }},
+	{group: "string", gen: func(g *gen) []string { return join([]string{"GETEX", g.key()}, g.maybe("PERSIST")) }},
+	{group: "string", gen: func(g *gen) []string { return join([]string{"LCS", g.key(), g.key()}, g.maybe("LEN")) }},
+	{group: "string", gen: func(g *gen) []string {
+		return join([]string{"LCS", g.key(), g.key(), "IDX"}, g.maybe("MINMATCHLEN", strconv.Itoa(g.r.Intn(3))), g.maybe("WITHMATCHLEN"))
+	}},
+	{group: "string", gen: func(g *gen) []string {
+		args := []string{"BITFIELD", g.key()}
+		for n := 1 + g.r.Intn(3); n > 0; n-- {
+			offset := strconv.Itoa(g.r.Intn(32))
+			switch g.r.Intn(4) {
+			case 0:
+				args = append(args, "GET", g.bitfieldType(), offset)
+			case 1:
+				args = append(args, "SET", g.bitfieldType(), offset, strconv.Itoa(g.r.Intn(300)-150))
+			case 2:
+				args = append(args, "INCRBY", g.bitfieldType(), offset, strconv.Itoa(g.r.Intn(300)-150))
+			default:
+				args = append(args, "OVERFLOW", g.pick("WRAP", "SAT", "FAIL"))
+			}
+		}
+		return args
+	}},
+
+	{group: "zset", gen: func(g *gen) []string {
+		args := join([]string{"ZADD", g.key()}, g.maybe(g.pick("NX", "XX")), g.maybe("CH"))
+		for n := 1 + g.r.Intn(3); n > 0; n-- {
+			args = append(args, g.score(), g.member())
+		}
+		return args
+	}},
+	{group: "zset", gen: func(g *gen) []string { return []string{"ZSCORE", g.key(), g.member()} }},
+	{group: "zset", gen: func(g *gen) []string { return []string{"ZREM", g.key(), g.member(), g.member()} }},
+	{group: "zset", gen: func(g *gen) []string { return []string{"ZCARD", g.key()} }},
+	{group: "zset", gen: func(g *gen) []string { return []string{"ZINCRBY", g.key(), g.score(), g.member()} }},
+	{group: "zset", gen: func(g *gen) []string { return []string{"ZCOUNT", g.key(), g.scoreRange(), g.scoreRange()} }},
+	{group: "zset", gen: func(g *gen) []string {
+		return join([]string{g.pick("ZPOPMIN", "ZPOPMAX"), g.key()}, g.maybe(strconv.Itoa(g.r.Intn(4))))
+	}},
+	{group: "zset", gen: func(g *gen) []string {
+		return join([]string{"ZRANGEBYLEX", g.key(), g.lexRange(), g.lexRange()}, g.maybe("LIMIT", strconv.Itoa(g.r.Intn(3)), strconv.Itoa(g.r.Intn(4)-1)))
+	}},
+	{group: "zset", gen: func(g *gen) []string { return []string{"ZLEXCOUNT", g.key(), g.lexRange(), g.lexRange()} }},
+	{group: "zset", gen: func(g *gen) []string {
+		return join([]string{"ZRANGE", g.key(), g.index(), g.index()}, g.maybe("WITHSCORES"))
+	}},
+
+	{group: "stream", gen: func(g *gen) []string {
+		args := join([]string{"XADD", g.key()}, g.maybe("MAXLEN", strconv.Itoa(g.r.Intn(4))), []string{g.streamID()})
+		for n := 1 + g.r.Intn(2); n > 0; n-- {
+			args = append(args, g.member(), g.value())
+		}
+		return args
+	}},
+	{group: "stream", gen: func(g *gen) []string { return []string{"XLEN", g.key()} }},
+	{group: "stream", gen: func(g *gen) []string {
+		return join([]string{"XRANGE", g.key(), g.pick("-", g.streamID()), g.pick("+", g.streamID())}, g.maybe("COUNT", strconv.Itoa(g.r.Intn(4))))
+	}},
+
+	{group: "geo", gen: func(g *gen) []string {
+		args := join([]string{"GEOADD", g.key()}, g.maybe(g.pick("NX", "XX")), g.maybe("CH"))
+		for n := 1 + g.r.Intn(2); n > 0; n-- {
+			lon, lat := g.lonLat()
+			args = append(args, lon, lat, g.member())
+		}
+		return args
+	}},
+	{group: "geo", gen: func(g *gen) []string { return []string{"GEOPOS", g.key(), g.member(), g.member()} }},
+	{group: "geo", gen: func(g *gen) []string {
+		return join([]string{"GEODIST", g.key(), g.member(), g.member()}, g.maybe(g.pick("M", "KM", "FT", "MI")))
+	}},
+	{group: "geo", gen: func(g *gen) []string {
+		args := []string{"GEOSEARCH", g.key(), "FROMMEMBER", g.member()}
+		if g.r.Intn(2) == 0 {
+			args = append(args, "BYRADIUS", strconv.Itoa(1+g.r.Intn(20)), "km")
+		} else {
+			args = append(args, "BYBOX", strconv.Itoa(1+g.r.Intn(20)), strconv.Itoa(1+g.r.Intn(20)), "km")
+		}
+		return join(args, []string{g.pick("ASC", "DESC")}, g.maybe("WITHDIST"))
+	}},
+
+	{group: "json", gen: func(g *gen) []string {
+		return join([]string{"JSON.SET", g.key(), g.pick("$", "$", g.jsonPath()), g.json()}, g.maybe(g.pick("NX", "XX")))
+	}},
+	{group: "json", gen: func(g *gen) []string { return []string{"JSON.GET", g.key(), g.jsonPath()} }},
+	{group: "json", gen: func(g *gen) []string { return []string{"JSON.DEL", g.key(), g.jsonPath()} }},
+	{group: "json", gen: func(g *gen) []string { return []string{"JSON.TYPE", g.key(), g.jsonPath()} }},
+}
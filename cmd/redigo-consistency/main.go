@@ -0,0 +1,285 @@
+// Command redigo-consistency runs random sequences of commands against a
+// redigo server and a reference Redis server, comparing their replies to
+// catch the commands whose semantics diverge:
+//
+//	redigo-consistency [-addr host:port] [-ref host:port] [-seed n] [-runs n] [-length n] [-keys n] [-groups group,...] [-strict-errors] [-out file]
+//
+// Both servers are flushed before every run, so they must be scratch
+// instances. The commands are drawn from groups, keys, string, zset,
+// stream, geo and json, the last one needing RedisJSON on the reference,
+// with their keys and arguments drawn from small pools so that they keep
+// hitting the same keys, including those of the wrong type. Two error
+// replies match when their codes do, such as ERR or WRONGTYPE, and with
+// -strict-errors when their messages do.
+//
+// On the first divergence, the sequence is shrunk to the fewest commands
+// still diverging, which are printed along with the replies of both
+// servers, and with -out written in the format of an append only file,
+// for redigo -replay file -replay-compare host:port to reproduce. The exit
+// status is then 1
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var (
+	addr         = flag.String("addr", "127.0.0.1:3000", "Set the address of the redigo server")
+	ref          = flag.String("ref", "127.0.0.1:6379", "Set the address of the reference Redis server")
+	seed         = flag.Int64("seed", 0, "Set the seed of the first run, the current time if 0")
+	runs         = flag.Int("runs", 100, "Set the number of runs, each from a fresh keyspace")
+	length       = flag.Int("length", 200, "Set the number of commands of every run")
+	keys         = flag.Int("keys", 6, "Set the number of keys the commands draw from")
+	groups       = flag.String("groups", "keys,string,zset,stream,geo", "Set the comma separated groups of commands to draw from, among keys, string, zset, stream, geo and json")
+	strictErrors = flag.Bool("strict-errors", false, "Compare the messages of the error replies rather than their codes")
+	out          = flag.String("out", "", "Write the shrunk sequence diverging to this file, in the format of an append only file")
+)
+
+// divergence is a command whose replies differ
+type divergence struct {
+	index     int
+	got, want any
+}
+
+// pair holds the connections to both servers
+type pair struct {
+	redigo, ref *conn
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	gens, err := selectGenerators(*groups)
+	if err != nil {
+		return err
+	}
+	if *keys <= 0 || *length <= 0 {
+		return errors.New("-keys and -length must be positive")
+	}
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+
+	var p pair
+	if p.redigo, err = dial(*addr); err != nil {
+		return err
+	}
+	defer p.redigo.Close()
+	if p.ref, err = dial(*ref); err != nil {
+		return err
+	}
+	defer p.ref.Close()
+
+	for i := 0; i < *runs; i++ {
+		runSeed := *seed + int64(i)
+		g := &gen{r: rand.New(rand.NewSource(runSeed)), keys: *keys}
+		seq := make([][]string, *length)
+		for j := range seq {
+			seq[j] = gens[g.r.Intn(len(gens))].gen(g)
+		}
+
+		d, err := p.replay(seq)
+		if err != nil {
+			return err
+		}
+		if d == nil {
+			continue
+		}
+
+		fmt.Printf("run %d (seed %d) diverged at command %d, shrinking\n", i+1, runSeed, d.index+1)
+		seq, d, err = p.shrink(seq[:d.index+1], d)
+		if err != nil {
+			return err
+		}
+		for j, args := range seq {
+			fmt.Printf("%d %s\n", j+1, strings.Join(args, " "))
+		}
+		fmt.Printf("redigo replied %s\nreference replied %s\n", format(d.got), format(d.want))
+		if *out != "" {
+			if err := writeLog(*out, seq); err != nil {
+				return err
+			}
+		}
+		os.Exit(1)
+	}
+	fmt.Printf("%d runs of %d commands, no divergence (seed %d)\n", *runs, *length, *seed)
+	return nil
+}
+
+// selectGenerators returns the generators of the comma separated groups
+func selectGenerators(list string) ([]generator, error) {
+	selected := make(map[string]bool)
+	for _, group := range strings.Split(list, ",") {
+		selected[strings.TrimSpace(group)] = true
+	}
+	var gens []generator
+	known := make(map[string]bool)
+	for _, gen := range generators {
+		known[gen.group] = true
+		if selected[gen.group] {
+			gens = append(gens, gen)
+		}
+	}
+	for group := range selected {
+		if !known[group] {
+			return nil, fmt.Errorf("unknown group %q", group)
+		}
+	}
+	if len(gens) == 0 {
+		return nil, errors.New("no group of commands selected")
+	}
+	return gens, nil
+}
+
+// replay flushes both servers and runs seq against them, returning the
+// first command whose replies differ, nil if none does
+func (p pair) replay(seq [][]string) (*divergence, error) {
+	for _, c := range []*conn{p.redigo, p.ref} {
+		reply, err := c.do("FLUSHALL")
+		if err != nil {
+			return nil, err
+		}
+		if e, ok := reply.(respError); ok {
+			return nil, fmt.Errorf("FLUSHALL: %v", e)
+		}
+	}
+
+	for i, args := range seq {
+		got, err := p.redigo.do(args...)
+		if err != nil {
+			return nil, fmt.Errorf("redigo: %v", err)
+		}
+		want, err := p.ref.do(args...)
+		if err != nil {
+			return nil, fmt.Errorf("reference: %v", err)
+		}
+		if !equal(got, want) {
+			return &divergence{i, got, want}, nil
+		}
+	}
+	return nil, nil
+}
+
+// shrink removes chunks of commands from seq, halving their size down to
+// a single command, as long as the sequence left still diverges, and
+// returns the shortest sequence found along with its divergence
+func (p pair) shrink(seq [][]string, d *divergence) ([][]string, *divergence, error) {
+	for size := len(seq) / 2; size >= 1; size /= 2 {
+		// the last command is the one diverging, kept in place
+		for start := len(seq) - 1 - size; start >= 0; start-- {
+			if start+size > len(seq)-1 {
+				// the sequence now diverges earlier
+				continue
+			}
+			candidate := append(append([][]string(nil), seq[:start]...), seq[start+size:]...)
+			cd, err := p.replay(candidate)
+			if err != nil {
+				return nil, nil, err
+			}
+			if cd != nil {
+				seq, d = candidate[:cd.index+1], cd
+			}
+		}
+	}
+	return seq, d, nil
+}
+
+// equal reports whether two replies match, the error replies matching by
+// their code unless -strict-errors is set
+func equal(got, want any) bool {
+	ge, gok := got.(respError)
+	we, wok := want.(respError)
+	if gok || wok {
+		if !gok || !wok {
+			return false
+		}
+		if *strictErrors {
+			return ge == we
+		}
+		return errorCode(ge) == errorCode(we)
+	}
+
+	ga, gok := got.([]any)
+	wa, wok := want.([]any)
+	if gok || wok {
+		if !gok || !wok || len(ga) != len(wa) {
+			return false
+		}
+		for i := range ga {
+			if !equal(ga[i], wa[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(got, want)
+}
+
+// errorCode returns the first word of an error reply
+func errorCode(e respError) string {
+	code, _, _ := strings.Cut(string(e), " ")
+	return code
+}
+
+// format returns a reply as redis-cli prints it, on one line
+func format(reply any) string {
+	switch r := reply.(type) {
+	case nil:
+		return "(nil)"
+	case status:
+		return string(r)
+	case respError:
+		return "(error) " + string(r)
+	case int64:
+		return fmt.Sprintf("(integer) %d", r)
+	case string:
+		return fmt.Sprintf("%q", r)
+	case []any:
+		elems := make([]string, len(r))
+		for i, e := range r {
+			elems[i] = format(e)
+		}
+		return "[" + strings.Join(elems, ", ") + "]"
+	default:
+		return fmt.Sprint(r)
+	}
+}
+
+// writeLog writes seq to path as RESP arrays, the format of an append
+// only file
+func writeLog(path string, seq [][]string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, args := range seq {
+		fmt.Fprintf(w, "*%d\r\n", len(args))
+		for _, arg := range args {
+			fmt.Fprintf(w, "$%d\r\n%s\r\n", len(arg), arg)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -1,24 +1,478 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
 	"log"
+	"net/netip"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/KavetiRohith/go-cache/cache"
 	"github.com/KavetiRohith/go-cache/server"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var configFile = flag.String("config", "", "Read the flags from this file of name value lines, read again on SIGHUP")
 var host = flag.String("host", "127.0.0.1", "Set the host")
 var port = flag.Int("port", 3000, "Set the port")
+var edgeTriggered = flag.Bool("edge-triggered", false, "Poll the sockets in edge triggered mode")
+var reusePort = flag.Bool("reuseport", false, "Set SO_REUSEPORT on the listening socket")
+var systemd = flag.Bool("systemd", false, "Take the listening socket from systemd socket activation if passed one, and notify systemd of readiness over NOTIFY_SOCKET")
+var tcpNoDelay = flag.Bool("tcp-nodelay", true, "Set TCP_NODELAY on client connections")
+var proxyProtocol = flag.Bool("proxy-protocol", false, "Expect the client connections to start with a PROXY protocol v1 or v2 header giving the address of the client")
+var httpAddr = flag.String("http", "", "Set the address of the HTTP gateway, disabled if empty")
+var grpcAddr = flag.String("grpc", "", "Set the address of the gRPC API, disabled if empty")
+var memcachedAddr = flag.String("memcached", "", "Set the address of the memcached protocol listener, disabled if empty")
+var healthAddr = flag.String("health", "", "Set the address of the listener serving the /healthz and /readyz endpoints, disabled if empty")
+var slowlogLogSlowerThan = flag.Duration("slowlog-log-slower-than", server.DefaultSlowlogLogSlowerThan, "Record the commands running for at least this long in the slow log, negative to disable it")
+var slowlogMaxLen = flag.Int("slowlog-max-len", server.DefaultSlowlogMaxLen, "Set the number of entries of the slow log")
+var hotKeysWindow = flag.Duration("hotkeys-window", server.DefaultHotKeysWindow, "Set the window over which HOTKEYS counts the accesses of keys, negative to disable the counting")
+var latencyMonitorThreshold = flag.Duration("latency-monitor-threshold", 0, "Record the commands and expiry cycles running for at least this long in the latency monitor, disabled if 0")
+var checksums = flag.Bool("checksums", false, "Store a CRC-32C with every string, checked on reads to fail with CORRUPT rather than return a corrupted value")
+var compressThreshold = flag.Int("compress-threshold", 0, "Store the strings of at least this many bytes compressed with snappy, disabled if 0")
+var entrySlabs = flag.Bool("entry-slabs", false, "Allocate the headers of the keys from slabs of 512, shortening the marking of the garbage collector on keyspaces of millions of keys")
+var tenantPrefixes = flag.String("tenant-prefixes", "", "Break the keys, bytes, commands and hit ratio down by the comma separated key prefixes, in INFO tenants")
+var prefixIndex = flag.Bool("prefix-index", false, "Keep the keys in a radix tree, so that DELPREFIX, COUNTPREFIX and SCANPREFIX do not walk the whole keyspace")
+var spillFile = flag.String("spill-file", "", "Spill the least recently accessed strings to this bbolt file while the keys and strings exceed -spill-max-memory, disabled if empty")
+var spillMaxMemory = flag.Int64("spill-max-memory", 0, "Set the bytes of keys and strings above which the cold strings are spilled to the -spill-file")
+var defaultTTL = flag.Duration("default-ttl", 0, "Expire the keys written without a TTL after this long, 0 for never")
+var prefixTTLs = flag.String("prefix-ttls", "", "Override -default-ttl for the keys starting with prefixes, as comma separated prefix=duration pairs, 0 for never")
+var ttlJitter = flag.Float64("ttl-jitter", 0, "Shorten the TTLs of the keys written by a random fraction of up to this much, so that keys written together expire apart")
+var readOnly = flag.Bool("read-only", false, "Reject the write commands with READONLY errors")
+var logLevel = flag.String("loglevel", server.LogLevelNotice, "Set the log level, notice or debug to log every command received")
+var logCommands = flag.Bool("log-commands", true, "Log the commands served with their values")
+var overloadLatency = flag.Duration("overload-latency", 0, "Refuse the commands of low priority with BUSY while serving the events of a poll takes at least this long, disabled if 0")
+var replyCacheSize = flag.Int("reply-cache-size", 0, "Keep the values of up to this many strings read by GET decoded, for the hot keys stored encoded, disabled if 0")
+var historyVersions = flag.Int("history-versions", 0, "Keep this many versions of every key for GETAT to read the past values of strings, disabled if 0")
+var historyKeyBytes = flag.Int("history-key-bytes", server.DefaultHistoryKeyBytes, "Set the bytes of versions kept for a key, the latest version being always kept")
+var historyMaxBytes = flag.Int("history-max-bytes", server.DefaultHistoryMaxBytes, "Set the bytes of versions kept for all the keys, the oldest being dropped first")
+var activeDefragThreshold = flag.Float64("active-defrag-threshold", 0, "Move the keys to fresh allocations in the idle polls while the heap spans in use exceed the memory of their objects by this ratio, returning the spans emptied to the OS, disabled if 0")
+var activeDefragIgnoreBytes = flag.Int64("active-defrag-ignore-bytes", server.DefaultDefragIgnoreBytes, "Leave the heap as is while its fragmentation is below this many bytes")
+var overloadPendingBytes = flag.Int("overload-pending-bytes", 0, "Refuse the commands of low priority with BUSY while the replies waiting for slow clients add up to this many bytes, disabled if 0")
+var webhooks = flag.String("webhooks", "", "Post the events of the keys to space separated webhooks, each given as url[#pattern[#event,...]]")
+var webhookQueueLen = flag.Int("webhook-queue-len", server.DefaultWebhookQueueLen, "Set the number of events a webhook may lag behind before the next ones are dropped")
+var cdcNATS = flag.String("cdc-nats", "", "Publish the changes of the keys as JSON messages to the NATS server at nats://host:port, disabled if empty")
+var cdcSubject = flag.String("cdc-subject", "redigo.changes", "Set the NATS subject the changes are published on")
+var cdcQueueLen = flag.Int("cdc-queue-len", server.DefaultChangeQueueLen, "Set the number of changes the change sink may lag behind before the next ones are dropped")
+var checkOnStart = flag.Bool("check-on-start", false, "Check the keyspace restored from the Raft snapshot or copied by -warm-from before serving, refusing to start if it is inconsistent")
+var checkRepair = flag.Bool("check-repair", false, "Repair the inconsistencies found by -check-on-start rather than refusing to start")
+var scrubKeys = flag.Int("scrub-keys", 0, "Check this many keys in the background every cron run, deleting those expired, 0 to disable the scrubber")
+var scrubRepair = flag.Bool("scrub-repair", false, "Repair the inconsistencies found by the scrubber as -check-repair does")
+var warmFrom = flag.String("warm-from", "", "Copy the keyspace of the server at host:port before serving, to start with a warm cache")
+var drainTimeout = flag.Duration("drain-timeout", server.DefaultDrainTimeout, "Set how long SHUTDOWN DRAIN waits for the clients blocked or with replies pending before stopping")
+var drainRedirect = flag.String("drain-redirect", "", "Set the host:port the clients are told to reconnect to while the server drains")
+var drainOnSIGTERM = flag.Bool("drain-on-sigterm", false, "Drain the clients on SIGTERM as SHUTDOWN DRAIN does, rather than stopping at once")
+var quotaOps = flag.Int("quota-ops", 0, "Limit the commands each client IP sends per second, 0 for no limit")
+var quotaBytes = flag.Int("quota-bytes", 0, "Limit the bytes of the commands each client IP sends per second, 0 for no limit")
+var otlpEndpoint = flag.String("otlp-endpoint", "", "Export the traces of the commands over OTLP gRPC to this host:port, disabled if empty")
+var allowCIDRs = flag.String("allow-cidrs", "", "Only accept the clients of these comma separated networks or IPs, all if empty")
+var denyCIDRs = flag.String("deny-cidrs", "", "Refuse the clients of these comma separated networks or IPs")
+var protectedMode = flag.Bool("protected-mode", true, "Refuse the clients not on the loopback interface while listening on every interface without -allow-cidrs")
+var maxConnsPerIP = flag.Int("max-conns-per-ip", 0, "Limit the connections open from each client IP, 0 for no limit")
+var quotaCommands = flag.String("quota-commands", "", "Limit the commands of the given names each client IP sends per second, as comma separated name=limit pairs")
+var raftAddr = flag.String("raft", "", "Set the address this node of a Raft cluster listens on, disabled if empty")
+var raftID = flag.String("raft-id", "", "Set the ID of the Raft node, the address of the server if empty")
+var raftDir = flag.String("raft-dir", "raft", "Set the directory holding the Raft log and snapshots")
+var raftBootstrap = flag.Bool("raft-bootstrap", false, "Bootstrap a new Raft cluster of this node and the -raft-peers")
+var raftPeers = flag.String("raft-peers", "", "Set the comma separated id=address of the other nodes of the Raft cluster bootstrapped")
+var crdtPeers = flag.String("crdt-peers", "", "Set the comma separated addresses of the replicas the CRDT counters and sets are merged with")
+var crdtReplicaID = flag.String("crdt-replica-id", "", "Set the ID of this replica in the CRDT counters and sets, the address of the server if empty")
+var crdtSyncInterval = flag.Duration("crdt-sync-interval", server.DefaultCRDTSyncInterval, "Set the interval at which the CRDT counters and sets are sent to the peers")
+var gossipAddr = flag.String("gossip", "", "Set the address this node gossips with the other nodes on, disabled if empty")
+var gossipName = flag.String("gossip-name", "", "Set the name of this node in the gossip cluster, the address of the server if empty")
+var gossipJoin = flag.String("gossip-join", "", "Set the comma separated seeds of the gossip cluster to join, as host:port or srv:name for the targets of DNS SRV records")
+var gossipRejoinInterval = flag.Duration("gossip-rejoin-interval", server.DefaultGossipRejoinInterval, "Set the interval at which the gossip seeds are resolved and joined again")
+var replay = flag.String("replay", "", "Replay the commands of this append only file against a fresh instance and exit")
+var replaySpeed = flag.Float64("replay-speed", 1, "Divide the delays between the replayed commands by this factor, 0 to replay them as fast as possible")
+var replayLoadTruncated = flag.Bool("replay-load-truncated", true, "Replay a file ending within a command up to its last whole command rather than failing")
+var replayCompare = flag.String("replay-compare", "", "Send the replayed commands to the server at this address too and print the replies that diverge")
+var protoMaxBulkLen = flag.Int("proto-max-bulk-len", server.DefaultProtoMaxBulkLen, "Set the maximum length in bytes of a bulk string")
+var protoMaxMultibulkLen = flag.Int("proto-max-multibulk-len", server.DefaultProtoMaxMultibulkLen, "Set the maximum number of arguments of a RESP array")
+var protoMaxInlineLen = flag.Int("proto-max-inline-len", server.DefaultProtoMaxInlineLen, "Set the maximum length in bytes of an inline command")
+var clientOutputBufferLimitNormal = flag.String("client-output-buffer-limit-normal", "0 0 0s", "Disconnect the clients whose pending replies reach the hard limit in bytes, or stay over the soft limit for the duration, as hard soft duration, 0 for no limit")
+var clientOutputBufferLimitPubsub = flag.String("client-output-buffer-limit-pubsub", formatOutputBufferLimit(server.DefaultClientOutputBufferLimitPubsub), "Set the output buffer limit of the subscribed clients, as hard soft duration")
+var strictText = flag.Bool("strict-text", false, "Quote the strings replied to inline commands, so that a missing value differs from any string")
+var clientQueryBufferLimit = flag.Int("client-query-buffer-limit", server.DefaultClientQueryBufferLimit, "Set the maximum size in bytes of a command")
+var expireMinInterval = flag.Duration("expire-min-interval", server.DefaultExpireMinInterval, "Set the shortest interval the active expiry cycle runs at while it finds mostly expired keys, the cycle slowing down to once a second as they get fewer")
+var scheduleKey = flag.String("schedule-key", server.DefaultScheduleKey, "Set the key of the sorted set holding the commands scheduled with SCHEDULE")
+
+// buildCacheOpts are the cache options added by the files of build tags,
+// such as the manual clock of the testclock builds
+var buildCacheOpts []cache.Option
 
 func main() {
 	log.SetFlags(log.Ldate | log.Ltime | log.Llongfile)
 	flag.Parse()
+	if flag.Arg(0) == "proxy" {
+		runProxy(flag.Args()[1:])
+		return
+	}
+	if *configFile != "" {
+		flag.Visit(func(f *flag.Flag) { onCommandLine[f.Name] = true })
+		if err := loadConfig(*configFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *otlpEndpoint != "" {
+		tp, err := newTracerProvider(*otlpEndpoint)
+		if err != nil {
+			log.Fatal(err)
+		}
+		tracerProvider = tp
+	}
+	if *cdcNATS != "" {
+		sink, err := server.NewNATSSink(*cdcNATS, *cdcSubject)
+		if err != nil {
+			log.Fatal(err)
+		}
+		changeSink = sink
+	}
+	opts, err := serverOpts()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var cacheOpts []cache.Option
+	if *compressThreshold > 0 {
+		cacheOpts = append(cacheOpts, cache.WithCompression(*compressThreshold))
+	}
+	if *checksums {
+		cacheOpts = append(cacheOpts, cache.WithChecksums())
+	}
+	if *prefixIndex {
+		cacheOpts = append(cacheOpts, cache.WithPrefixIndex())
+	}
+	if *entrySlabs {
+		cacheOpts = append(cacheOpts, cache.WithEntrySlabs())
+	}
+	if *tenantPrefixes != "" {
+		cacheOpts = append(cacheOpts, cache.WithTenants(strings.Split(*tenantPrefixes, ",")...))
+	}
+	if *ttlJitter > 0 {
+		cacheOpts = append(cacheOpts, cache.WithTTLJitter(*ttlJitter))
+	}
+	if *defaultTTL > 0 || *prefixTTLs != "" {
+		ttls, err := parsePrefixTTLs(*prefixTTLs)
+		if err != nil {
+			log.Fatal(err)
+		}
+		cacheOpts = append(cacheOpts, cache.WithDefaultTTL(*defaultTTL, ttls))
+	}
+	if *spillFile != "" {
+		if *spillMaxMemory <= 0 {
+			log.Fatal("-spill-file requires a positive -spill-max-memory")
+		}
+		store, err := cache.OpenBoltSpillStore(*spillFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		cacheOpts = append(cacheOpts, cache.WithSpill(store, *spillMaxMemory))
+	}
+	cacheOpts = append(cacheOpts, buildCacheOpts...)
+	server := server.NewServer(opts, cache.New(cacheOpts...))
+	if *replay != "" {
+		replayFile(server)
+		return
+	}
+	if *configFile != "" {
+		go reloadOnSIGHUP(server)
+	}
+	go stopOnSIGTERM(server)
+	if err := server.Start(); err != nil {
+		log.Fatal(err)
+	}
+	log.Println("server stopped")
+}
+
+// stopOnSIGTERM stops the server on SIGINT or SIGTERM, closing the client
+// connections and the listeners as SHUTDOWN does, or draining the clients
+// first on SIGTERM with -drain-on-sigterm
+func stopOnSIGTERM(s *server.Server) {
+	term := make(chan os.Signal, 1)
+	signal.Notify(term, syscall.SIGINT, syscall.SIGTERM)
+	if sig := <-term; sig == syscall.SIGTERM && *drainOnSIGTERM {
+		s.Drain(0)
+		// a second signal stops the server without waiting
+		<-term
+	}
+	s.Stop()
+}
+
+// serverOpts returns the options of the server given by the flags
+func serverOpts() (server.ServerOpts, error) {
 	opts := server.ServerOpts{
 		Host: *host, Port: *port, CronFrequency: 1 * time.Second,
+		ProtoMaxBulkLen: *protoMaxBulkLen, ProtoMaxMultibulkLen: *protoMaxMultibulkLen,
+		ProtoMaxInlineLen: *protoMaxInlineLen, ClientQueryBufferLimit: *clientQueryBufferLimit, StrictText: *strictText,
+		EdgeTriggered: *edgeTriggered, ReusePort: *reusePort, Systemd: *systemd, TCPNoDelay: *tcpNoDelay,
+		HTTPAddr: *httpAddr, GRPCAddr: *grpcAddr, SlowlogLogSlowerThan: *slowlogLogSlowerThan,
+		SlowlogMaxLen: *slowlogMaxLen, MemcachedAddr: *memcachedAddr,
+		HotKeysWindow: *hotKeysWindow, LatencyMonitorThreshold: *latencyMonitorThreshold,
+		ReadOnly: *readOnly, LogLevel: *logLevel, QuietCommands: !*logCommands,
+		QuotaOpsPerSec: *quotaOps, QuotaBytesPerSec: *quotaBytes, MaxConnsPerIP: *maxConnsPerIP,
+		OverloadLatency: *overloadLatency, OverloadPendingBytes: *overloadPendingBytes, ReplyCacheSize: *replyCacheSize,
+		HistoryVersions: *historyVersions, HistoryKeyBytes: *historyKeyBytes, HistoryMaxBytes: *historyMaxBytes,
+		DefragThreshold: *activeDefragThreshold, DefragIgnoreBytes: *activeDefragIgnoreBytes,
+		WarmFrom: *warmFrom, CheckOnStart: *checkOnStart, CheckRepair: *checkRepair, ScrubKeys: *scrubKeys, ScrubRepair: *scrubRepair, WebhookQueueLen: *webhookQueueLen,
+		ChangeSink: changeSink, ChangeQueueLen: *cdcQueueLen, DrainTimeout: *drainTimeout, DrainRedirect: *drainRedirect,
+		ProxyProtocol: *proxyProtocol, ProtectedMode: *protectedMode,
+		TracerProvider: tracerProvider, RaftAddr: *raftAddr, RaftID: *raftID,
+		RaftDir: *raftDir, RaftBootstrap: *raftBootstrap,
+		CRDTReplicaID: *crdtReplicaID, CRDTSyncInterval: *crdtSyncInterval,
+		GossipAddr: *gossipAddr, GossipName: *gossipName,
+		GossipRejoinInterval: *gossipRejoinInterval, HealthAddr: *healthAddr,
+		ScheduleKey: *scheduleKey, ExpireMinInterval: *expireMinInterval,
+	}
+	if *crdtPeers != "" {
+		opts.CRDTPeers = strings.Split(*crdtPeers, ",")
+	}
+	if *gossipJoin != "" {
+		opts.GossipJoin = strings.Split(*gossipJoin, ",")
+	}
+	if *raftPeers != "" {
+		opts.RaftPeers = strings.Split(*raftPeers, ",")
+	}
+	var err error
+	if opts.AllowCIDRs, err = parseCIDRs(*allowCIDRs); err != nil {
+		return opts, err
+	}
+	if opts.DenyCIDRs, err = parseCIDRs(*denyCIDRs); err != nil {
+		return opts, err
+	}
+	if opts.ClientOutputBufferLimitNormal, err = parseOutputBufferLimit(*clientOutputBufferLimitNormal); err != nil {
+		return opts, err
+	}
+	if opts.ClientOutputBufferLimitPubsub, err = parseOutputBufferLimit(*clientOutputBufferLimitPubsub); err != nil {
+		return opts, err
+	}
+	if opts.ClientOutputBufferLimitPubsub == (server.OutputBufferLimit{}) {
+		// the zero limit would mean the default to the server
+		opts.ClientOutputBufferLimitPubsub.Hard = -1
+	}
+	for _, spec := range strings.Fields(*webhooks) {
+		w, err := server.ParseWebhook(spec)
+		if err != nil {
+			return opts, err
+		}
+		opts.Webhooks = append(opts.Webhooks, w)
+	}
+	if *quotaCommands != "" {
+		opts.QuotaCommandOps = make(map[string]int)
+		for _, pair := range strings.Split(*quotaCommands, ",") {
+			name, limit, _ := strings.Cut(pair, "=")
+			n, err := strconv.Atoi(limit)
+			if err != nil || n <= 0 {
+				return opts, fmt.Errorf("invalid quota %q, must be name=limit with a positive limit", pair)
+			}
+			opts.QuotaCommandOps[strings.ToUpper(name)] = n
+		}
+	}
+
+	return opts, nil
+}
+
+// parsePrefixTTLs parses comma separated prefix=duration pairs
+func parsePrefixTTLs(value string) (map[string]time.Duration, error) {
+	ttls := make(map[string]time.Duration)
+	if value == "" {
+		return ttls, nil
+	}
+	for _, pair := range strings.Split(value, ",") {
+		prefix, ttl, _ := strings.Cut(pair, "=")
+		d, err := time.ParseDuration(ttl)
+		if err != nil || d < 0 || prefix == "" {
+			return nil, fmt.Errorf("invalid prefix TTL %q, must be prefix=duration with a duration of 0 or more", pair)
+		}
+		ttls[prefix] = d
+	}
+	return ttls, nil
+}
+
+// parseCIDRs parses comma separated networks in CIDR notation, a bare IP
+// standing for the network of that IP alone
+func parseCIDRs(value string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, cidr := range strings.Split(value, ",") {
+		if cidr = strings.TrimSpace(cidr); cidr == "" {
+			continue
+		}
+		if !strings.Contains(cidr, "/") {
+			addr, err := netip.ParseAddr(cidr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid network %q", cidr)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q", cidr)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// parseOutputBufferLimit parses an output buffer limit given as
+// "hard soft duration", the limits being in bytes
+func parseOutputBufferLimit(value string) (server.OutputBufferLimit, error) {
+	var limit server.OutputBufferLimit
+	fields := strings.Fields(value)
+	if len(fields) != 3 {
+		return limit, fmt.Errorf("invalid output buffer limit %q, must be hard soft duration", value)
+	}
+	hard, err1 := strconv.Atoi(fields[0])
+	soft, err2 := strconv.Atoi(fields[1])
+	d, err3 := time.ParseDuration(fields[2])
+	if err1 != nil || err2 != nil || err3 != nil || hard < 0 || soft < 0 || d < 0 {
+		return limit, fmt.Errorf("invalid output buffer limit %q, must be hard soft duration", value)
+	}
+	return server.OutputBufferLimit{Hard: hard, Soft: soft, SoftDuration: d}, nil
+}
+
+// formatOutputBufferLimit formats limit as parseOutputBufferLimit parses it
+func formatOutputBufferLimit(limit server.OutputBufferLimit) string {
+	return fmt.Sprintf("%d %d %v", limit.Hard, limit.Soft, limit.SoftDuration)
+}
+
+// tracerProvider exports the traces to -otlp-endpoint, nil if it is empty
+var tracerProvider trace.TracerProvider
+
+// newTracerProvider returns a tracer provider exporting the spans in
+// batches over OTLP gRPC to endpoint
+func newTracerProvider(endpoint string) (trace.TracerProvider, error) {
+	exporter, err := otlptracegrpc.New(context.Background(),
+		otlptracegrpc.WithEndpoint(endpoint), otlptracegrpc.WithInsecure())
+	if err != nil {
+		return nil, err
+	}
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName("redigo"))),
+	), nil
+}
+
+// changeSink publishes the changes to -cdc-nats, nil if it is empty
+var changeSink server.ChangeSink
+
+// cacheFlags are the flags of the options of the cache, which cannot
+// change without a restart
+var cacheFlags = []string{"checksums", "compress-threshold", "default-ttl", "entry-slabs", "prefix-index", "prefix-ttls", "tenant-prefixes", "ttl-jitter"}
+
+// onCommandLine holds the flags given on the command line, which the
+// config file does not set
+var onCommandLine = make(map[string]bool)
+
+// loadConfig sets the flags from the lines of the file at path, each
+// holding the name of a flag followed by its value, blank lines and lines
+// starting with # being ignored. The flags given on the command line take
+// precedence over the file, and the others not in the file get back their
+// default value, for the lines removed to be undone on a reload
+func loadConfig(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	flag.VisitAll(func(f *flag.Flag) {
+		if !onCommandLine[f.Name] {
+			f.Value.Set(f.DefValue)
+		}
+	})
+
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value, _ := strings.Cut(line, " ")
+		if name == "config" {
+			return fmt.Errorf("%s:%d: the config file cannot be set in itself", path, i+1)
+		}
+		if onCommandLine[name] {
+			continue
+		}
+		if err := flag.Set(name, strings.TrimSpace(value)); err != nil {
+			return fmt.Errorf("%s:%d: %v", path, i+1, err)
+		}
+	}
+	return nil
+}
+
+// reloadOnSIGHUP reads the config file again on every SIGHUP and applies
+// it to the running server, all at once or not at all if an option that
+// requires a restart changed
+func reloadOnSIGHUP(s *server.Server) {
+	started := make(map[string]string)
+	for _, name := range cacheFlags {
+		started[name] = flag.Lookup(name).Value.String()
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		if err := loadConfig(*configFile); err != nil {
+			log.Println("reloading the config:", err)
+			continue
+		}
+		var restart []string
+		for _, name := range cacheFlags {
+			if flag.Lookup(name).Value.String() != started[name] {
+				restart = append(restart, name)
+			}
+		}
+		if len(restart) > 0 {
+			log.Printf("reloading the config: %s cannot change without a restart\n", strings.Join(restart, ", "))
+			continue
+		}
+		opts, err := serverOpts()
+		if err == nil {
+			err = s.Reload(context.Background(), opts)
+		}
+		if err != nil {
+			log.Println("reloading the config:", err)
+		}
 	}
+}
 
-	server := server.NewServer(opts, cache.New())
-	log.Fatal(server.Start())
+// replayFile replays the file of -replay, printing the commands that fail
+// or diverge followed by a summary
+func replayFile(s *server.Server) {
+	f, err := os.Open(*replay)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	stats, err := s.Replay(f, server.ReplayOpts{Speed: *replaySpeed, CompareAddr: *replayCompare, Out: os.Stdout, LoadTruncated: *replayLoadTruncated})
+	fmt.Printf("replayed %d commands: %d errors, %d skipped, %d divergences\n",
+		stats.Commands, stats.Errors, stats.Skipped, stats.Divergences)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// runProxy runs the proxy sub-command:
+//
+//	redigo proxy -listen host:port -backends host:port,host:port,...
+func runProxy(args []string) {
+	fs := flag.NewFlagSet("proxy", flag.ExitOnError)
+	listen := fs.String("listen", "127.0.0.1:3000", "Set the address the proxy listens on")
+	backends := fs.String("backends", "", "Set the comma separated addresses of the servers the keys are spread over")
+	fs.Parse(args)
+
+	proxy, err := server.NewProxy(strings.FieldsFunc(*backends, func(r rune) bool { return r == ',' }))
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Fatal(proxy.ListenAndServe(*listen))
 }
@@ -0,0 +1,15 @@
+//go:build testclock
+
+package main
+
+import (
+	"time"
+
+	"github.com/KavetiRohith/go-cache/cache"
+)
+
+// the builds tagged testclock tell the time with a manual clock, starting
+// at the time the server starts and moved only by DEBUG SET-TIME
+func init() {
+	buildCacheOpts = append(buildCacheOpts, cache.WithClock(cache.NewManualClock(time.Now())))
+}
@@ -0,0 +1,215 @@
+package server
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/KavetiRohith/go-cache/cache"
+)
+
+// loadTimeout bounds the loads of the keys missing from the cache
+const loadTimeout = 10 * time.Second
+
+// getHandler implements GET, loading the missing keys from the Loader of
+// the cache when it has one, and refreshing the stale ones in the
+// background while serving their stale value. A key missing is replied
+// nil, and fails with ErrNoSuchKey for the gateways
+func getHandler(s *Server, client Client, args []string) (Reply, error) {
+	r, err := s.getOrLoad(client, args)
+	if err == cache.ErrNoSuchKey && client.conn != gatewayClient {
+		// the gateways map the error to a miss of their own
+		return Nil, nil
+	}
+	return r, err
+}
+
+// getOrLoad implements GET, failing with ErrNoSuchKey for a missing key
+func (s *Server) getOrLoad(client Client, args []string) (Reply, error) {
+	if len(args) > 1 {
+		return s.handleGetWithVersion(args)
+	}
+	if !s.cache.HasLoader() {
+		return s.handleGet(args[0])
+	}
+
+	key := args[0]
+	val, stale, err := s.cache.GetStale(key)
+	switch {
+	case err == nil:
+		if stale {
+			s.refreshKey(key)
+		}
+		s.logCommand("GET %q %q stale: %v\n", key, val, stale)
+		return Bulk(val), nil
+	case err != cache.ErrNoSuchKey:
+		return nil, err
+	}
+	if _, ok := s.clients[client.conn.Fd]; !ok {
+		// the gateways wait for the load on their own goroutine
+		return nil, err
+	}
+	return nil, s.loadKey(client.conn, key)
+}
+
+// refreshKey reloads the stale value of key on another goroutine, unless
+// it is being refreshed already. The key is updated if it is still stale
+// by then, and deleted if the backing store no longer has it, while it is
+// kept stale if the load fails
+func (s *Server) refreshKey(key string) {
+	if _, ok := s.refreshes[key]; ok {
+		return
+	}
+	s.refreshes[key] = struct{}{}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), loadTimeout)
+		defer cancel()
+		val, ttl, err := s.cache.Load(ctx, key)
+		s.Post(func() {
+			delete(s.refreshes, key)
+			var changed bool
+			switch err {
+			case nil:
+				changed = s.cache.StoreRefreshed(key, val, ttl)
+			case cache.ErrNoSuchKey:
+				changed = s.cache.DropStale(key)
+			default:
+				log.Printf("refreshing %q: %v\n", key, err)
+			}
+			if changed {
+				s.invalidate(key, -1)
+				s.reindex(key)
+			}
+		})
+	}()
+}
+
+// keyLoad is a load of a key missing from the cache run for the clients
+// of the event loop
+type keyLoad struct {
+	done bool
+	err  error
+}
+
+// loadKey blocks the client while key is loaded on another goroutine, the
+// loaded value being stored and served by the event loop. The clients
+// missing the same key meanwhile wait for the same load, so that a hot
+// missing key starts a single goroutine
+func (s *Server) loadKey(conn fDconn, key string) error {
+	l, ok := s.loads[key]
+	if !ok {
+		l = &keyLoad{}
+		s.loads[key] = l
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), loadTimeout)
+			defer cancel()
+			val, ttl, err := s.cache.Load(ctx, key)
+			s.Post(func() {
+				if err == nil {
+					s.cache.StoreLoaded(key, val, ttl)
+				}
+				l.done, l.err = true, backingStoreError(err)
+				delete(s.loads, key)
+				s.serveBlockedClients(key)
+			})
+		}()
+	}
+
+	serve := func() (Reply, error) {
+		val, err := s.cache.Get(key)
+		switch {
+		case err == nil:
+			return Bulk(val), nil
+		case !l.done:
+			return nil, nil
+		case err == cache.ErrNoSuchKey && l.err != nil:
+			return nil, l.err
+		case err == cache.ErrNoSuchKey:
+			return Nil, nil
+		default:
+			return nil, err
+		}
+	}
+	return s.block(conn, []string{key}, 0, serve)
+}
+
+// loadThrough loads a key missing from the cache for the gateways, which
+// wait for it on their own goroutine rather than blocking a client of the
+// event loop. It returns ErrNoSuchKey if the backing store has no such key
+func (s *Server) loadThrough(ctx context.Context, key string) error {
+	ctx, cancel := context.WithTimeout(ctx, loadTimeout)
+	defer cancel()
+	val, ttl, err := s.cache.Load(ctx, key)
+	if err != nil {
+		return backingStoreError(err)
+	}
+	return s.runOnLoop(ctx, func() {
+		s.cache.StoreLoaded(key, val, ttl)
+	})
+}
+
+// writeThrough propagates a write of key, already applied to the cache,
+// to the Writer of the cache when it has one. Connected clients are
+// blocked until the backing store acknowledges the write, and are then
+// replied r, while the gateways are replied right away. A key whose write
+// failed is dropped from the cache so that the next read loads it again
+func (s *Server) writeThrough(client Client, key string, value []byte, deleted bool, r Reply) (Reply, error) {
+	return s.writeThroughKeys(client, []string{key}, value, deleted, r)
+}
+
+// writeThroughKeys is writeThrough for the writes of value to several
+// keys, or their deletion, the client being replied once the backing
+// store acknowledged all of them, or the error of the first that failed
+func (s *Server) writeThroughKeys(client Client, keys []string, value []byte, deleted bool, r Reply) (Reply, error) {
+	if !s.cache.HasWriter() {
+		return r, nil
+	}
+
+	var (
+		pending = len(keys)
+		result  error
+	)
+	for _, key := range keys {
+		key := key
+		span := s.traceChild("backing_store.write")
+		s.cache.Propagate(key, value, deleted, func(err error) {
+			endSpan(span, err)
+			s.Post(func() {
+				if err != nil {
+					s.cache.Delete(key)
+					s.invalidate(key, -1)
+					s.reindex(key)
+					if result == nil {
+						result = backingStoreError(err)
+					}
+				}
+				pending--
+				s.serveBlockedClients(key)
+			})
+		})
+	}
+
+	if _, ok := s.clients[client.conn.Fd]; !ok {
+		return r, nil
+	}
+	serve := func() (Reply, error) {
+		if pending > 0 {
+			return nil, nil
+		}
+		if result != nil {
+			return nil, result
+		}
+		return r, nil
+	}
+	return nil, s.block(client.conn, keys, 0, serve)
+}
+
+// backingStoreError reports the failures of the backing store as IOERR
+// errors, leaving ErrNoSuchKey alone
+func backingStoreError(err error) error {
+	if err == nil || err == cache.ErrNoSuchKey {
+		return err
+	}
+	return cache.Errorf(cache.KindIOErr, "backing store: %v", err)
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/KavetiRohith/go-cache/cache"
+)
+
+var (
+	errBitFieldType   = errors.New("Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is.")
+	errBitFieldOffset = errors.New("bit offset is not an integer or out of range")
+)
+
+// bitFieldHandler implements BITFIELD key [GET type offset] [SET type
+// offset value] [INCRBY type offset increment] [OVERFLOW WRAP|SAT|FAIL] ...
+// and, when readOnly is set, BITFIELD_RO key [GET type offset] ...
+func bitFieldHandler(readOnly bool) CommandFunc {
+	return func(s *Server, _ Client, args []string) (Reply, error) {
+		ops, err := s.parseBitFieldOps(args[1:], readOnly)
+		if err != nil {
+			return nil, err
+		}
+
+		results, err := s.cache.BitField(args[0], ops)
+		if err != nil {
+			return nil, err
+		}
+
+		s.logCommand("BITFIELD %s %v %v\n", args[0], args[1:], results)
+		r := make(Array, len(results))
+		for i, result := range results {
+			if result.Failed {
+				r[i] = Nil
+			} else {
+				r[i] = Int(result.Value)
+			}
+		}
+		return r, nil
+	}
+}
+
+// parseBitFieldOps parses the subcommands of BITFIELD, OVERFLOW setting
+// the policy of the SET and INCRBY following it
+func (s *Server) parseBitFieldOps(args []string, readOnly bool) ([]cache.BitFieldOp, error) {
+	var (
+		ops      []cache.BitFieldOp
+		overflow = cache.OverflowWrap
+	)
+	for i := 0; i < len(args); {
+		sub := strings.ToUpper(args[i])
+		if sub == "OVERFLOW" && !readOnly && i+1 < len(args) {
+			switch strings.ToUpper(args[i+1]) {
+			case "WRAP":
+				overflow = cache.OverflowWrap
+			case "SAT":
+				overflow = cache.OverflowSat
+			case "FAIL":
+				overflow = cache.OverflowFail
+			default:
+				return nil, errors.New("Invalid OVERFLOW type specified")
+			}
+			i += 2
+			continue
+		}
+
+		n := 3
+		switch {
+		case sub == "GET":
+		case (sub == "SET" || sub == "INCRBY") && !readOnly:
+			n = 4
+		case readOnly:
+			return nil, errors.New("BITFIELD_RO only supports the GET subcommand")
+		default:
+			return nil, ErrSyntax
+		}
+		if i+n > len(args) {
+			return nil, ErrSyntax
+		}
+
+		op := cache.BitFieldOp{Set: sub == "SET", Incr: sub == "INCRBY", Overflow: overflow}
+		var err error
+		if op.Signed, op.Bits, err = parseBitFieldType(args[i+1]); err != nil {
+			return nil, err
+		}
+		if op.Offset, err = s.parseBitFieldOffset(args[i+2], op.Bits); err != nil {
+			return nil, err
+		}
+		if n == 4 {
+			if op.Value, err = strconv.ParseInt(args[i+3], 10, 64); err != nil {
+				return nil, cache.ErrNotInteger
+			}
+		}
+		ops = append(ops, op)
+		i += n
+	}
+	return ops, nil
+}
+
+// parseBitFieldType parses a type such as i16 or u8, the signed integers
+// having up to 64 bits and the unsigned ones up to 63
+func parseBitFieldType(t string) (bool, int, error) {
+	if len(t) < 2 || (t[0] != 'i' && t[0] != 'I' && t[0] != 'u' && t[0] != 'U') {
+		return false, 0, errBitFieldType
+	}
+	signed := t[0] == 'i' || t[0] == 'I'
+	bits, err := strconv.Atoi(t[1:])
+	if err != nil || bits < 1 || (signed && bits > 64) || (!signed && bits > 63) {
+		return false, 0, errBitFieldType
+	}
+	return signed, bits, nil
+}
+
+// parseBitFieldOffset parses a bit offset, or #n for the offset of the
+// nth field of bits bits, the fields having to end within the longest
+// bulk string the server accepts
+func (s *Server) parseBitFieldOffset(offset string, bits int) (int64, error) {
+	multiply := strings.HasPrefix(offset, "#")
+	n, err := strconv.ParseInt(strings.TrimPrefix(offset, "#"), 10, 64)
+	if err != nil || n < 0 {
+		return 0, errBitFieldOffset
+	}
+	maxBits := int64(s.ProtoMaxBulkLen) * 8
+	if multiply {
+		if n > maxBits/int64(bits) {
+			return 0, errBitFieldOffset
+		}
+		n *= int64(bits)
+	}
+	if n+int64(bits) > maxBits {
+		return 0, errBitFieldOffset
+	}
+	return n, nil
+}
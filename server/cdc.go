@@ -0,0 +1,151 @@
+package server
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+const (
+	// DefaultChangeQueueLen is the default number of changes the change
+	// sink may lag behind before the next ones are dropped
+	DefaultChangeQueueLen = 65536
+	// changeBatch bounds the changes published at once
+	changeBatch = 512
+	// changeMinBackoff and changeMaxBackoff bound the wait between the
+	// attempts to publish a batch, doubled on every failure
+	changeMinBackoff = 100 * time.Millisecond
+	changeMaxBackoff = 10 * time.Second
+)
+
+// ChangeEvent is a change of a key published to a ChangeSink
+type ChangeEvent struct {
+	// Command is the lower case name of the command writing the key, or
+	// expired or evicted for the keys removed by the server, and flushall
+	// for FLUSHALL and FLUSHDB, whose event has no key
+	Command string `json:"command"`
+	Key     string `json:"key,omitempty"`
+	// Type is the type of the key after the change, as TYPE names it,
+	// empty if the key no longer exists
+	Type string `json:"type,omitempty"`
+	// Value is the string or the JSON document the key holds after the
+	// change, empty for the other types, which Dump holds serialized as by
+	// DUMP instead
+	Value string `json:"value,omitempty"`
+	Dump  []byte `json:"dump,omitempty"`
+	// ExpiresAt is the unix time in milliseconds the key expires at, -1 if
+	// it does not expire
+	ExpiresAt int64 `json:"expireat,omitempty"`
+	// Time is the unix time in milliseconds of the change
+	Time int64 `json:"time"`
+}
+
+// ChangeSink publishes the changes of the keys, for change data capture
+// into systems such as NATS or Kafka. Publish is called from a goroutine of
+// its own with the changes in the order they were made, and is called
+// again with the same changes when it fails
+type ChangeSink interface {
+	Publish(ctx context.Context, events []ChangeEvent) error
+	Close() error
+}
+
+// startChangeSink starts the goroutine publishing the changes to
+// ChangeSink, and returns the function stopping it and closing the sink,
+// the changes queued being dropped
+func (s *Server) startChangeSink() func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.changes = make(chan ChangeEvent, s.ChangeQueueLen)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.publishChanges(ctx, s.changes)
+	}()
+	return func() {
+		cancel()
+		close(s.changes)
+		<-done
+		s.changes = nil
+		if err := s.ChangeSink.Close(); err != nil {
+			log.Println("change sink:", err)
+		}
+	}
+}
+
+// keysChanged queues the changes of keys made by command to the change
+// sink, dropping them when its queue is full rather than blocking the
+// loop. In Raft mode, only the leader publishes the changes
+func (s *Server) keysChanged(command string, keys []string) {
+	if s.raft != nil && s.raft.State() != raft.Leader {
+		return
+	}
+	now := s.cache.Now().UnixMilli()
+	for _, key := range keys {
+		event := ChangeEvent{Command: command, Key: key, Time: now}
+		if e, ok, _ := s.cache.Export(key); ok {
+			event.Type, event.ExpiresAt = e.Type, e.ExpiresAt
+			if e.Value != nil {
+				event.Value = string(e.Value)
+			} else {
+				event.Dump = e.Payload
+			}
+		}
+		s.queueChange(event)
+	}
+}
+
+// flushChanged queues the change of FLUSHALL and FLUSHDB to the change sink
+func (s *Server) flushChanged() {
+	if s.raft != nil && s.raft.State() != raft.Leader {
+		return
+	}
+	s.queueChange(ChangeEvent{Command: "flushall", Time: s.cache.Now().UnixMilli()})
+}
+
+func (s *Server) queueChange(event ChangeEvent) {
+	select {
+	case s.changes <- event:
+	default:
+		s.stats.changesDropped++
+	}
+}
+
+// publishChanges publishes the changes queued in batches until changes is
+// closed, retrying a batch that fails with a growing backoff
+func (s *Server) publishChanges(ctx context.Context, changes <-chan ChangeEvent) {
+	batch := make([]ChangeEvent, 0, changeBatch)
+	for event := range changes {
+		batch = append(batch[:0], event)
+	drain:
+		for len(batch) < changeBatch {
+			select {
+			case event, ok := <-changes:
+				if !ok {
+					break drain
+				}
+				batch = append(batch, event)
+			default:
+				break drain
+			}
+		}
+
+		backoff := changeMinBackoff
+		for {
+			err := s.ChangeSink.Publish(ctx, batch)
+			if err == nil {
+				s.changesPublished.Add(int64(len(batch)))
+				break
+			}
+			log.Printf("change sink: publishing %d changes: %v\n", len(batch), err)
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return
+			}
+			if backoff *= 2; backoff > changeMaxBackoff {
+				backoff = changeMaxBackoff
+			}
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// checkOnStart checks the keyspace loaded before serving, logging the
+// inconsistencies found, and fails if there are any unless CheckRepair
+// is set. The search indexes are rebuilt for the keys repaired
+func (s *Server) checkOnStart() error {
+	start := time.Now()
+	report := s.cache.Check(s.CheckRepair)
+	for _, p := range report.Problems {
+		log.Println("check:", p)
+	}
+	if len(report.Problems) > 0 && !s.CheckRepair {
+		return fmt.Errorf("the keyspace failed its check with %d inconsistencies, start with -check-repair to repair them", len(report.Problems))
+	}
+
+	if len(s.indexes) > 0 {
+		for _, p := range report.Problems {
+			if p.Key != "" {
+				s.reindex(p.Key)
+			}
+		}
+	}
+	elapsed := time.Since(start).Round(time.Millisecond)
+	if len(report.Problems) == 0 {
+		log.Printf("checked %d keys in %v, consistent\n", report.Keys, elapsed)
+		return nil
+	}
+	log.Printf("checked %d keys in %v, %d inconsistencies repaired\n", report.Keys, elapsed, len(report.Problems))
+	return nil
+}
+
+// scrubKeys checks ScrubKeys keys in the background every cron run,
+// logging the inconsistencies found and repairing them with ScrubRepair,
+// the keys repaired being written for their watchers, tracking clients
+// and search indexes
+func (s *Server) scrubKeys() {
+	if s.ScrubKeys <= 0 {
+		return
+	}
+	repair := s.ScrubRepair && s.raft == nil
+	problems := s.cache.Scrub(s.ScrubKeys, repair)
+	if len(problems) == 0 {
+		return
+	}
+	var repaired []string
+	for _, p := range problems {
+		log.Println("scrub:", p)
+		if repair && p.Key != "" {
+			repaired = append(repaired, p.Key)
+		}
+	}
+	s.lastScrubProblem = problems[len(problems)-1].String()
+	if len(repaired) > 0 {
+		s.keysWritten("SCRUB", -1, repaired)
+	}
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// handleClient implements CLIENT ID | LIST | SETNAME name | GETNAME |
+// SETINFO LIB-NAME|LIB-VER|REQUEST-ID value | REQUESTID id |
+// TRACKING ON|OFF [options] | TRACEPARENT traceparent [tracestate] |
+// PAUSE timeout [WRITE|ALL] | UNPAUSE
+func (s *Server) handleClient(client Client, args []string) (Reply, error) {
+	switch strings.ToUpper(args[0]) {
+	case "ID":
+		return Int(client.ID()), nil
+
+	case "LIST":
+		return Bulk(s.clientList()), nil
+
+	case "SETNAME":
+		c, ok := s.clients[client.conn.Fd]
+		if !ok {
+			return nil, errors.New("CLIENT SETNAME is not supported on this connection")
+		}
+		if !validClientInfo(args[1]) {
+			return nil, errors.New("Client names cannot contain spaces, newlines or special characters.")
+		}
+		c.name = args[1]
+		s.logCommand("CLIENT SETNAME %d %s\n", c.Fd, c.name)
+		return OK, nil
+
+	case "SETINFO":
+		c, ok := s.clients[client.conn.Fd]
+		if !ok {
+			return nil, errors.New("CLIENT SETINFO is not supported on this connection")
+		}
+		attr := strings.ToUpper(args[1])
+		if !validClientInfo(args[2]) {
+			return nil, fmt.Errorf("%s cannot contain spaces, newlines or special characters.", attr)
+		}
+		switch attr {
+		case "LIB-NAME":
+			c.libName = args[2]
+		case "LIB-VER":
+			c.libVer = args[2]
+		case "REQUEST-ID":
+			c.requestID = args[2]
+		default:
+			return nil, fmt.Errorf("Unrecognized option '%s'", args[1])
+		}
+		s.logCommand("CLIENT SETINFO %d %s %s\n", c.Fd, attr, args[2])
+		return OK, nil
+
+	case "REQUESTID":
+		c, ok := s.clients[client.conn.Fd]
+		if !ok {
+			return nil, errors.New("CLIENT REQUESTID is not supported on this connection")
+		}
+		if !validClientInfo(args[1]) {
+			return nil, errors.New("Request IDs cannot contain spaces, newlines or special characters.")
+		}
+		c.nextRequestID = args[1]
+		return OK, nil
+
+	case "TRACKING":
+		return s.clientTracking(client, args[1:])
+
+	case "TRACEPARENT":
+		c, ok := s.clients[client.conn.Fd]
+		if !ok {
+			return nil, errors.New("CLIENT TRACEPARENT is not supported on this connection")
+		}
+		return s.handleClientTraceParent(c, args[1:])
+
+	case "PAUSE":
+		return s.handleClientPause(args[1:])
+
+	case "UNPAUSE":
+		s.unpause()
+		return OK, nil
+
+	case "GETNAME":
+		if c, ok := s.clients[client.conn.Fd]; ok && c.name != "" {
+			return Bulk(c.name), nil
+		}
+		return Nil, nil
+
+	default:
+		return nil, fmt.Errorf("unknown subcommand '%s'", args[0])
+	}
+}
+
+// validClientInfo reports whether a client name or attribute is made of
+// printable characters other than spaces, empty values clearing them
+func validClientInfo(value string) bool {
+	for i := 0; i < len(value); i++ {
+		if value[i] < '!' || value[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// startRequest sets the request ID of the command about to be served, the
+// one given by CLIENT REQUESTID for it if any, or that of the connection
+func (c *clientConn) startRequest() {
+	c.cmdRequestID = c.requestID
+	if c.nextRequestID != "" {
+		c.cmdRequestID, c.nextRequestID = c.nextRequestID, ""
+	}
+}
+
+// clientList describes the connected clients one per line, ordered by id
+func (s *Server) clientList() string {
+	fds := make([]int, 0, len(s.clients))
+	for fd := range s.clients {
+		fds = append(fds, fd)
+	}
+	sort.Ints(fds)
+
+	now := time.Now()
+	var b strings.Builder
+	for _, fd := range fds {
+		c := s.clients[fd]
+		omem := c.outputLen()
+		sub, psub, ssub := 0, 0, 0
+		if c.pubsub != nil {
+			sub, psub, ssub = len(c.pubsub.channels), len(c.pubsub.patterns), len(c.pubsub.shardChannels)
+		}
+		redir := -1
+		if c.tracking != nil && c.tracking.redirect != 0 {
+			redir = c.tracking.redirect
+		}
+		fmt.Fprintf(&b, "id=%d addr=%s fd=%d name=%s age=%d idle=%d sub=%d psub=%d ssub=%d qbuf=%d omem=%d cmd=%s redir=%d lib-name=%s lib-ver=%s reqid=%s\n",
+			fd, c.addr, fd, c.name,
+			int64(now.Sub(c.createdAt)/time.Second), int64(now.Sub(c.lastInteraction)/time.Second),
+			sub, psub, ssub, len(c.querybuf), omem, c.lastCmd, redir, c.libName, c.libVer, c.requestID)
+	}
+	return b.String()
+}
@@ -0,0 +1,535 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Command flags reported by COMMAND
+const (
+	// FlagWrite marks commands that may modify the keyspace
+	FlagWrite = "write"
+	// FlagReadonly marks commands that only read the keyspace
+	FlagReadonly = "readonly"
+	// FlagAdmin marks administrative commands
+	FlagAdmin = "admin"
+	// FlagBlocking marks commands that may block the client
+	FlagBlocking = "blocking"
+	// FlagMovableKeys marks commands whose key positions depend on
+	// their arguments and cannot be described by FirstKey, LastKey and Step
+	FlagMovableKeys = "movablekeys"
+	// FlagPubSub marks the Pub/Sub commands
+	FlagPubSub = "pubsub"
+)
+
+// Client is the connection a command was received on
+type Client struct {
+	conn fDconn
+	// pubsub holds the subscriptions of clients that are not connections
+	// of the event loop, such as WebSocket clients
+	pubsub *pubsubClient
+}
+
+// ID returns a number identifying the client among the connected ones
+func (c Client) ID() int {
+	return c.conn.Fd
+}
+
+// CommandFunc serves a command. args holds the arguments following the
+// command name, already validated against the arity of the command
+// The reply is written in the protocol the client used for the command
+// and an error is replied with its message
+type CommandFunc func(s *Server, client Client, args []string) (Reply, error)
+
+// Command describes a command for dispatch, arity validation and introspection
+type Command struct {
+	// Name is the command name, matched ignoring case
+	Name string
+	// Arity is the number of arguments including the command name.
+	// A negative arity means at least -Arity arguments
+	Arity int
+	Flags []string
+	// FirstKey and LastKey are the positions of the first and last key
+	// arguments and Step the distance between keys. A negative LastKey
+	// counts from the end and a FirstKey of 0 means the command has no keys
+	FirstKey, LastKey, Step int
+	// Syntax and Summary are returned by COMMAND DOCS
+	Syntax  string
+	Summary string
+	Handler CommandFunc
+}
+
+// builtinCommands are the commands registered by NewServer
+var builtinCommands = []*Command{
+	{"SET", -3, []string{FlagWrite}, 1, 1, 1, "SET key value [ttl | PXAT unix-time-milliseconds] [IFVERSION version]", "Sets the string value of a key, optionally expiring after ttl seconds or at a unix milliseconds timestamp, or only if the key is at the given version", setHandler},
+	{"GET", -2, []string{FlagReadonly}, 1, 1, 1, "GET key [WITHVERSION]", "Returns the string value of a key, and its version with WITHVERSION", getHandler},
+	{"GETAT", 3, []string{FlagReadonly}, 1, 1, 1, "GETAT key unix-time-milliseconds", "Returns the string value a key had at a past time, from the versions kept by the key history", argsHandler((*Server).handleGetAt)},
+	{"GETEX", -2, []string{FlagWrite}, 1, 1, 1, "GETEX key [EX seconds | PX milliseconds | EXAT unix-time-seconds | PXAT unix-time-milliseconds | PERSIST]", "Returns the string value of a key after setting its expiration time", argsHandler((*Server).handleGetEx)},
+	{"EXPIREAT", -3, []string{FlagWrite}, 1, 1, 1, "EXPIREAT key unix-time-seconds [NX | XX | GT | LT]", "Sets the expiration time of a key to a unix timestamp", expireAtHandler(1000)},
+	{"PEXPIREAT", -3, []string{FlagWrite}, 1, 1, 1, "PEXPIREAT key unix-time-milliseconds [NX | XX | GT | LT]", "Sets the expiration time of a key to a unix milliseconds timestamp", expireAtHandler(1)},
+	{"SOFTEXPIRE", 3, []string{FlagWrite}, 1, 1, 1, "SOFTEXPIRE key seconds", "Makes the value of a key stale after a number of seconds, refreshing it in the background on reads when a backing store is configured", argsHandler((*Server).handleSoftExpire)},
+	{"SOFTTTL", 2, []string{FlagReadonly}, 1, 1, 1, "SOFTTTL key", "Returns the seconds left before the value of a key goes stale", keyHandler((*Server).handleSoftTTL)},
+	{"GETSTALE", 2, []string{FlagReadonly}, 1, 1, 1, "GETSTALE key", "Returns the string value of a key and whether it is stale", keyHandler((*Server).handleGetStale)},
+	{"EXPIRETIME", 2, []string{FlagReadonly}, 1, 1, 1, "EXPIRETIME key", "Returns the expiration time of a key as a unix timestamp", expireTimeHandler(1000)},
+	{"PEXPIRETIME", 2, []string{FlagReadonly}, 1, 1, 1, "PEXPIRETIME key", "Returns the expiration time of a key as a unix milliseconds timestamp", expireTimeHandler(1)},
+	{"DUMP", 2, []string{FlagReadonly}, 1, 1, 1, "DUMP key", "Returns a serialized representation of the value stored at a key", keyHandler((*Server).handleDump)},
+	{"RESTORE", -4, []string{FlagWrite}, 1, 1, 1, "RESTORE key ttl serialized-value [REPLACE] [ABSTTL]", "Creates a key from the serialized representation of a value", argsHandler((*Server).handleRestore)},
+	{"DUMPALL", -2, []string{FlagReadonly}, 0, 0, 0, "DUMPALL cursor [MATCH pattern] [COUNT count] [TYPE type]", "Iterates over the keyspace returning the serialized values of the keys", argsHandler((*Server).handleDumpAll)},
+	{"MIGRATE", -6, []string{FlagWrite, FlagMovableKeys}, 3, 3, 1, "MIGRATE host port key|\"\" destination-db timeout [COPY] [REPLACE] [KEYS key [key ...]]", "Atomically transfers keys to another instance", (*Server).handleMigrate},
+	{"COPY", -3, []string{FlagWrite}, 1, 2, 1, "COPY source destination [DB destination-db] [REPLACE]", "Copies the value of a key to a new key", argsHandler((*Server).handleCopy)},
+	{"OBJECT", -3, []string{FlagReadonly}, 2, 2, 1, "OBJECT ENCODING key", "Returns the internal encoding of the value stored at a key", argsHandler((*Server).handleObject)},
+	{"KEYINFO", 2, []string{FlagReadonly}, 1, 1, 1, "KEYINFO key", "Returns the creation, last write and last access times of a key, its expiry and its version", keyHandler((*Server).handleKeyInfo)},
+	{"BITFIELD", -2, []string{FlagWrite}, 1, 1, 1, "BITFIELD key [GET type offset | SET type offset value | INCRBY type offset increment | OVERFLOW WRAP|SAT|FAIL ...]", "Reads, sets and increments integers of arbitrary widths at bit offsets of a string", bitFieldHandler(false)},
+	{"BITFIELD_RO", -2, []string{FlagReadonly}, 1, 1, 1, "BITFIELD_RO key [GET type offset ...]", "Reads integers of arbitrary widths at bit offsets of a string", bitFieldHandler(true)},
+	{"LCS", -3, []string{FlagReadonly}, 1, 2, 1, "LCS key1 key2 [LEN] [IDX] [MINMATCHLEN min-match-len] [WITHMATCHLEN]", "Returns the longest common subsequence of the strings of two keys", argsHandler((*Server).handleLCS)},
+	{"DEL", -2, []string{FlagWrite}, 1, -1, 1, "DEL key [key ...]", "Deletes one or more keys", delHandler},
+	{"EXISTS", -2, []string{FlagReadonly}, 1, -1, 1, "EXISTS key [key ...]", "Returns the number of keys that exist", argsHandler((*Server).handleExists)},
+	{"UNLINK", -2, []string{FlagWrite}, 1, -1, 1, "UNLINK key [key ...]", "Asynchronously deletes one or more keys", argsHandler((*Server).handleUnlink)},
+	{"TOUCH", -2, []string{FlagReadonly}, 1, -1, 1, "TOUCH key [key ...]", "Updates the last access time of one or more keys", argsHandler((*Server).handleTouch)},
+	{"HAS", 2, []string{FlagReadonly}, 1, 1, 1, "HAS key", "Reports whether a key exists", keyHandler((*Server).handleHas)},
+	{"SCAN", -2, []string{FlagReadonly}, 0, 0, 0, "SCAN cursor [MATCH pattern] [COUNT count] [TYPE type]", "Iterates over the keys of the keyspace", argsHandler((*Server).handleScan)},
+	{"SCANPREFIX", -3, []string{FlagReadonly}, 0, 0, 0, "SCANPREFIX prefix cursor [COUNT count]", "Iterates over the keys starting with a prefix in lexicographic order", argsHandler((*Server).handleScanPrefix)},
+	{"COUNTPREFIX", 2, []string{FlagReadonly}, 0, 0, 0, "COUNTPREFIX prefix", "Returns the number of keys starting with a prefix", argsHandler((*Server).handleCountPrefix)},
+	{"DELPREFIX", 2, []string{FlagWrite}, 0, 0, 0, "DELPREFIX prefix", "Deletes the keys starting with a prefix", delPrefixHandler},
+	{"TYPE", 2, []string{FlagReadonly}, 1, 1, 1, "TYPE key", "Returns the type of the value stored at a key", keyHandler((*Server).handleType)},
+	{"PUBLISH", 3, []string{FlagPubSub}, 0, 0, 0, "PUBLISH channel message", "Posts a message to a channel", argsHandler((*Server).handlePublish)},
+	{"SUBSCRIBE", -2, []string{FlagPubSub}, 0, 0, 0, "SUBSCRIBE channel [channel ...]", "Listens for messages published to channels", subscribeHandler(subscribeChannels)},
+	{"UNSUBSCRIBE", -1, []string{FlagPubSub}, 0, 0, 0, "UNSUBSCRIBE [channel [channel ...]]", "Stops listening to messages posted to channels", unsubscribeHandler(subscribeChannels)},
+	{"PSUBSCRIBE", -2, []string{FlagPubSub}, 0, 0, 0, "PSUBSCRIBE pattern [pattern ...]", "Listens for messages published to channels matching patterns", subscribeHandler(subscribePatterns)},
+	{"PUNSUBSCRIBE", -1, []string{FlagPubSub}, 0, 0, 0, "PUNSUBSCRIBE [pattern [pattern ...]]", "Stops listening to messages published to channels matching patterns", unsubscribeHandler(subscribePatterns)},
+	{"PUBSUB", -2, []string{FlagPubSub}, 0, 0, 0, "PUBSUB CHANNELS [pattern] | NUMSUB [channel ...] | NUMPAT | SHARDCHANNELS [pattern] | SHARDNUMSUB [shardchannel ...] | STATS [pattern] | SHARDSTATS [pattern] | RESETSTATS", "Returns the channels subscribed to, their numbers of subscribers and the messages published to them and delivered", argsHandler((*Server).handlePubsub)},
+	{"SPUBLISH", 3, []string{FlagPubSub}, 1, 1, 1, "SPUBLISH shardchannel message", "Posts a message to a shard channel", argsHandler((*Server).handleSpublish)},
+	{"SSUBSCRIBE", -2, []string{FlagPubSub}, 1, -1, 1, "SSUBSCRIBE shardchannel [shardchannel ...]", "Listens for messages published to shard channels", subscribeHandler(subscribeShardChannels)},
+	{"SUNSUBSCRIBE", -1, []string{FlagPubSub}, 1, -1, 1, "SUNSUBSCRIBE [shardchannel [shardchannel ...]]", "Stops listening to messages posted to shard channels", unsubscribeHandler(subscribeShardChannels)},
+	{"FLUSHALL", -1, []string{FlagWrite}, 0, 0, 0, "FLUSHALL [ASYNC | SYNC]", "Removes all keys", flushHandler("FLUSHALL")},
+	{"FLUSHDB", -1, []string{FlagWrite}, 0, 0, 0, "FLUSHDB [ASYNC | SYNC]", "Removes all keys of the current database", flushHandler("FLUSHDB")},
+	{"XADD", -5, []string{FlagWrite}, 1, 1, 1, "XADD key [MAXLEN [= | ~] threshold] <* | id> field value [field value ...]", "Appends a new entry to a stream, trimming its oldest entries down to a length", argsHandler((*Server).handleXAdd)},
+	{"XLEN", 2, []string{FlagReadonly}, 1, 1, 1, "XLEN key", "Returns the number of entries in a stream", keyHandler((*Server).handleXLen)},
+	{"XRANGE", -4, []string{FlagReadonly}, 1, 1, 1, "XRANGE key start end [COUNT count]", "Returns the stream entries within a range of IDs", argsHandler((*Server).handleXRange)},
+	{"XREAD", -4, []string{FlagReadonly, FlagBlocking, FlagMovableKeys}, 0, 0, 0, "XREAD [COUNT count] [BLOCK milliseconds] STREAMS key [key ...] id [id ...]", "Returns entries from multiple streams with IDs greater than the ones given, optionally blocking", (*Server).handleXRead},
+	{"XGROUP", -4, []string{FlagWrite}, 2, 2, 1, "XGROUP CREATE|SETID|DESTROY|CREATECONSUMER|DELCONSUMER key group [arguments ...]", "Manages the consumer groups of a stream", argsHandler((*Server).handleXGroup)},
+	{"XREADGROUP", -7, []string{FlagWrite, FlagBlocking, FlagMovableKeys}, 0, 0, 0, "XREADGROUP GROUP group consumer [COUNT count] [BLOCK milliseconds] [NOACK] STREAMS key [key ...] id [id ...]", "Returns entries from streams on behalf of a consumer group member", (*Server).handleXReadGroup},
+	{"XACK", -4, []string{FlagWrite}, 1, 1, 1, "XACK key group id [id ...]", "Acknowledges messages delivered to a consumer group", argsHandler((*Server).handleXAck)},
+	{"XPENDING", -3, []string{FlagReadonly}, 1, 1, 1, "XPENDING key group [[IDLE min-idle-time] start end count [consumer]]", "Returns the pending entries list of a consumer group", argsHandler((*Server).handleXPending)},
+	{"XCLAIM", -6, []string{FlagWrite}, 1, 1, 1, "XCLAIM key group consumer min-idle-time id [id ...] [JUSTID]", "Changes the ownership of pending messages", argsHandler((*Server).handleXClaim)},
+	{"XAUTOCLAIM", -6, []string{FlagWrite}, 1, 1, 1, "XAUTOCLAIM key group consumer min-idle-time start [COUNT count] [JUSTID]", "Claims idle pending messages scanning from start", argsHandler((*Server).handleXAutoClaim)},
+	{"QADD", -3, []string{FlagWrite}, 1, 1, 1, "QADD queue message [<* | id>]", "Appends a message to a queue kept in a stream, with the given ID or one generated", argsHandler((*Server).handleQAdd)},
+	{"QREAD", -2, []string{FlagWrite, FlagMovableKeys}, 1, 1, 1, "QREAD queue [COUNT count] [VISIBILITY milliseconds] [MAXDELIVERIES n [DEADLETTER queue]]", "Receives messages of a queue, hiding them from the other reads until acknowledged or the visibility timeout passes", argsHandler((*Server).handleQRead)},
+	{"QACK", -3, []string{FlagWrite}, 1, 1, 1, "QACK queue id [id ...]", "Acknowledges and deletes messages received from a queue", argsHandler((*Server).handleQAck)},
+	{"SCHEDULE", -4, []string{FlagWrite, FlagMovableKeys}, 0, 0, 0, "SCHEDULE id milliseconds command [arg ...]", "Runs a write once the given delay passes, replacing the command scheduled as id", scheduleHandler(false)},
+	{"SCHEDULEAT", -4, []string{FlagWrite, FlagMovableKeys}, 0, 0, 0, "SCHEDULEAT id unix-time-milliseconds command [arg ...]", "Runs a write at the given time, replacing the command scheduled as id", scheduleHandler(true)},
+	{"UNSCHEDULE", -2, []string{FlagWrite}, 0, 0, 0, "UNSCHEDULE id [id ...]", "Cancels scheduled commands", argsHandler((*Server).handleUnschedule)},
+	{"ZADD", -4, []string{FlagWrite}, 1, 1, 1, "ZADD key [NX | XX] [CH] score member [score member ...]", "Adds members to a sorted set or updates their scores", argsHandler((*Server).handleZAdd)},
+	{"ZSCORE", 3, []string{FlagReadonly}, 1, 1, 1, "ZSCORE key member", "Returns the score of a sorted set member", argsHandler((*Server).handleZScore)},
+	{"ZREM", -3, []string{FlagWrite}, 1, 1, 1, "ZREM key member [member ...]", "Removes members from a sorted set", argsHandler((*Server).handleZRem)},
+	{"ZCARD", 2, []string{FlagReadonly}, 1, 1, 1, "ZCARD key", "Returns the number of members of a sorted set", keyHandler((*Server).handleZCard)},
+	{"ZINCRBY", 4, []string{FlagWrite}, 1, 1, 1, "ZINCRBY key increment member", "Increments the score of a sorted set member", argsHandler((*Server).handleZIncrBy)},
+	{"ZCOUNT", 4, []string{FlagReadonly}, 1, 1, 1, "ZCOUNT key min max", "Returns the number of sorted set members within a range of scores", argsHandler((*Server).handleZCount)},
+	{"ZPOPMIN", -2, []string{FlagWrite}, 1, 1, 1, "ZPOPMIN key [count]", "Removes and returns the members with the lowest scores of a sorted set", zpopHandler(false)},
+	{"ZPOPMAX", -2, []string{FlagWrite}, 1, 1, 1, "ZPOPMAX key [count]", "Removes and returns the members with the highest scores of a sorted set", zpopHandler(true)},
+	{"BZPOPMIN", -3, []string{FlagWrite, FlagBlocking}, 1, -2, 1, "BZPOPMIN key [key ...] timeout", "Removes and returns the member with the lowest score of the first non empty sorted set, blocking until one is added", bzpopHandler(false)},
+	{"BZPOPMAX", -3, []string{FlagWrite, FlagBlocking}, 1, -2, 1, "BZPOPMAX key [key ...] timeout", "Removes and returns the member with the highest score of the first non empty sorted set, blocking until one is added", bzpopHandler(true)},
+	{"ZRANGEBYLEX", -4, []string{FlagReadonly}, 1, 1, 1, "ZRANGEBYLEX key min max [LIMIT offset count]", "Returns the members of a sorted set of equal scores within a lexicographic range", argsHandler((*Server).handleZRangeByLex)},
+	{"ZLEXCOUNT", 4, []string{FlagReadonly}, 1, 1, 1, "ZLEXCOUNT key min max", "Returns the number of members of a sorted set of equal scores within a lexicographic range", argsHandler((*Server).handleZLexCount)},
+	{"ZRANGE", -4, []string{FlagReadonly}, 1, 1, 1, "ZRANGE key start stop [WITHSCORES]", "Returns sorted set members within a range of ranks", argsHandler((*Server).handleZRange)},
+	{"LOCK", -4, []string{FlagWrite}, 1, 1, 1, "LOCK key token <ttl | PXAT unix-time-milliseconds>", "Takes a lock held with a token for ttl milliseconds or until a unix milliseconds timestamp, unless another token holds it", argsHandler((*Server).handleLock)},
+	{"UNLOCK", 3, []string{FlagWrite}, 1, 1, 1, "UNLOCK key token", "Releases a lock if it is held with the token", argsHandler((*Server).handleUnlock)},
+	{"CAS", 4, []string{FlagWrite}, 1, 1, 1, "CAS key expected value", "Sets the string value of a key if it holds the expected value, returning the value it holds afterwards", argsHandler((*Server).handleCAS)},
+	{"SETIF", 4, []string{FlagWrite}, 1, 1, 1, "SETIF key condition value", "Sets the string value of a key if a condition on the value it holds, such as \"value > 5\", holds, returning the value it holds afterwards", argsHandler((*Server).handleSetIf)},
+	{"CL.THROTTLE", -5, []string{FlagWrite}, 1, 1, 1, "CL.THROTTLE key max_burst count_per_period period [quantity]", "Applies a rate limit of count actions per period seconds to the actions tracked at a key, as in redis-cell", argsHandler((*Server).handleThrottle)},
+	{"BF.RESERVE", 4, []string{FlagWrite}, 1, 1, 1, "BF.RESERVE key error_rate capacity", "Creates an empty bloom filter that grows once capacity items were added, keeping to a false positive rate", argsHandler((*Server).handleBFReserve)},
+	{"BF.ADD", 3, []string{FlagWrite}, 1, 1, 1, "BF.ADD key item", "Adds an item to a bloom filter, creating it if needed", argsHandler((*Server).handleBFAdd)},
+	{"BF.MADD", -3, []string{FlagWrite}, 1, 1, 1, "BF.MADD key item [item ...]", "Adds items to a bloom filter, creating it if needed", argsHandler((*Server).handleBFMAdd)},
+	{"BF.EXISTS", 3, []string{FlagReadonly}, 1, 1, 1, "BF.EXISTS key item", "Tells whether an item may have been added to a bloom filter", argsHandler((*Server).handleBFExists)},
+	{"BF.MEXISTS", -3, []string{FlagReadonly}, 1, 1, 1, "BF.MEXISTS key item [item ...]", "Tells for each item whether it may have been added to a bloom filter", argsHandler((*Server).handleBFMExists)},
+	{"CF.RESERVE", 3, []string{FlagWrite}, 1, 1, 1, "CF.RESERVE key capacity", "Creates an empty cuckoo filter holding capacity items", argsHandler((*Server).handleCFReserve)},
+	{"CF.ADD", 3, []string{FlagWrite}, 1, 1, 1, "CF.ADD key item", "Adds an item to a cuckoo filter, creating it if needed", argsHandler((*Server).handleCFAdd)},
+	{"CF.ADDNX", 3, []string{FlagWrite}, 1, 1, 1, "CF.ADDNX key item", "Adds an item to a cuckoo filter unless it may be there already", argsHandler((*Server).handleCFAddNX)},
+	{"CF.EXISTS", 3, []string{FlagReadonly}, 1, 1, 1, "CF.EXISTS key item", "Tells whether an item may have been added to a cuckoo filter", argsHandler((*Server).handleCFExists)},
+	{"CF.DEL", 3, []string{FlagWrite}, 1, 1, 1, "CF.DEL key item", "Removes an occurrence of an item from a cuckoo filter", argsHandler((*Server).handleCFDel)},
+	{"CMS.INITBYDIM", 4, []string{FlagWrite}, 1, 1, 1, "CMS.INITBYDIM key width depth", "Creates an empty count-min sketch of depth rows of width counters", argsHandler((*Server).handleCMSInitByDim)},
+	{"CMS.INITBYPROB", 4, []string{FlagWrite}, 1, 1, 1, "CMS.INITBYPROB key error probability", "Creates an empty count-min sketch overestimating counts by at most error of the total with the given probability of failure", argsHandler((*Server).handleCMSInitByProb)},
+	{"CMS.INCRBY", -4, []string{FlagWrite}, 1, 1, 1, "CMS.INCRBY key item increment [item increment ...]", "Increments the counts of items in a count-min sketch, returning their estimates", argsHandler((*Server).handleCMSIncrBy)},
+	{"CMS.QUERY", -3, []string{FlagReadonly}, 1, 1, 1, "CMS.QUERY key item [item ...]", "Returns the estimated counts of items in a count-min sketch", argsHandler((*Server).handleCMSQuery)},
+	{"TOPK.RESERVE", -3, []string{FlagWrite}, 1, 1, 1, "TOPK.RESERVE key topk [width depth decay]", "Creates an empty list of the topk heaviest hitters", argsHandler((*Server).handleTopKReserve)},
+	{"TOPK.ADD", -3, []string{FlagWrite}, 1, 1, 1, "TOPK.ADD key item [item ...]", "Counts items in a top-k list, returning the items they expelled from it", argsHandler((*Server).handleTopKAdd)},
+	{"TOPK.INCRBY", -4, []string{FlagWrite}, 1, 1, 1, "TOPK.INCRBY key item increment [item increment ...]", "Increments the counts of items in a top-k list, returning the items they expelled from it", argsHandler((*Server).handleTopKIncrBy)},
+	{"TOPK.QUERY", -3, []string{FlagReadonly}, 1, 1, 1, "TOPK.QUERY key item [item ...]", "Tells for each item whether it is in a top-k list", argsHandler((*Server).handleTopKQuery)},
+	{"TOPK.LIST", -2, []string{FlagReadonly}, 1, 1, 1, "TOPK.LIST key [WITHCOUNT]", "Returns the items of a top-k list by decreasing estimated count", argsHandler((*Server).handleTopKList)},
+	{"CRDT.INCRBY", 3, []string{FlagWrite}, 1, 1, 1, "CRDT.INCRBY key increment", "Increments a grow-only counter merged across the replicas, creating it if needed", argsHandler((*Server).handleCRDTIncrBy)},
+	{"CRDT.GET", 2, []string{FlagReadonly}, 1, 1, 1, "CRDT.GET key", "Returns the value of a grow-only counter", argsHandler((*Server).handleCRDTGet)},
+	{"CRDT.SADD", -3, []string{FlagWrite}, 1, 1, 1, "CRDT.SADD key member [member ...]", "Adds members to an observed-remove set merged across the replicas, creating it if needed", argsHandler((*Server).handleCRDTSAdd)},
+	{"CRDT.SREM", -3, []string{FlagWrite}, 1, 1, 1, "CRDT.SREM key member [member ...]", "Removes members from an observed-remove set", argsHandler((*Server).handleCRDTSRem)},
+	{"CRDT.SMEMBERS", 2, []string{FlagReadonly}, 1, 1, 1, "CRDT.SMEMBERS key", "Returns the members of an observed-remove set", argsHandler((*Server).handleCRDTSMembers)},
+	{"CRDT.SISMEMBER", 3, []string{FlagReadonly}, 1, 1, 1, "CRDT.SISMEMBER key member", "Tells whether a member is in an observed-remove set", argsHandler((*Server).handleCRDTSIsMember)},
+	{"CRDT.MERGE", 3, []string{FlagWrite}, 1, 1, 1, "CRDT.MERGE key payload", "Merges the state of a counter or a set sent by another replica", argsHandler((*Server).handleCRDTMerge)},
+	{"JSON.SET", -4, []string{FlagWrite}, 1, 1, 1, "JSON.SET key path value [NX | XX]", "Sets the values at a path of a JSON document, creating the document at the root", argsHandler((*Server).handleJSONSet)},
+	{"JSON.GET", -2, []string{FlagReadonly}, 1, 1, 1, "JSON.GET key [path ...]", "Returns the values at paths of a JSON document serialized", argsHandler((*Server).handleJSONGet)},
+	{"JSON.DEL", -2, []string{FlagWrite}, 1, 1, 1, "JSON.DEL key [path]", "Deletes the values at a path of a JSON document, the whole document by default", argsHandler((*Server).handleJSONDel)},
+	{"JSON.TYPE", -2, []string{FlagReadonly}, 1, 1, 1, "JSON.TYPE key [path]", "Returns the types of the values at a path of a JSON document", argsHandler((*Server).handleJSONType)},
+	{"FT.CREATE", -5, []string{FlagWrite}, 0, 0, 0, "FT.CREATE index [ON JSON] [PREFIX count prefix [prefix ...]] SCHEMA path [AS name] TAG | NUMERIC [path [AS name] TAG | NUMERIC ...]", "Creates a search index over fields of the JSON documents at keys with the given prefixes", argsHandler((*Server).handleFTCreate)},
+	{"FT.SEARCH", -3, []string{FlagReadonly}, 0, 0, 0, "FT.SEARCH index query [LIMIT offset num]", "Returns the keys of the documents matching tag, tag prefix and numeric range terms", argsHandler((*Server).handleFTSearch)},
+	{"FT.DROPINDEX", 2, []string{FlagWrite}, 0, 0, 0, "FT.DROPINDEX index", "Deletes a search index, keeping the documents", argsHandler((*Server).handleFTDropIndex)},
+	{"FT._LIST", 1, nil, 0, 0, 0, "FT._LIST", "Returns the names of the search indexes", argsHandler((*Server).handleFTList)},
+	{"GEOADD", -5, []string{FlagWrite}, 1, 1, 1, "GEOADD key [NX | XX] [CH] longitude latitude member [longitude latitude member ...]", "Adds members with coordinates to a geospatial index", argsHandler((*Server).handleGeoAdd)},
+	{"GEOPOS", -3, []string{FlagReadonly}, 1, 1, 1, "GEOPOS key member [member ...]", "Returns the coordinates of geospatial index members", argsHandler((*Server).handleGeoPos)},
+	{"GEODIST", -4, []string{FlagReadonly}, 1, 1, 1, "GEODIST key member1 member2 [M | KM | FT | MI]", "Returns the distance between two geospatial index members", argsHandler((*Server).handleGeoDist)},
+	{"GEOSEARCH", -7, []string{FlagReadonly}, 1, 1, 1, "GEOSEARCH key <FROMMEMBER member | FROMLONLAT longitude latitude> <BYRADIUS radius unit | BYBOX width height unit> [ASC | DESC] [COUNT count] [WITHCOORD] [WITHDIST] [WITHHASH]", "Returns members of a geospatial index within an area", argsHandler((*Server).handleGeoSearch)},
+	{"PING", -1, nil, 0, 0, 0, "PING [message]", "Returns PONG, or the message given, to check that the server serves commands", argsHandler((*Server).handlePing)},
+	{"ECHO", 2, nil, 0, 0, 0, "ECHO message", "Returns the message given", argsHandler((*Server).handleEcho)},
+	{"QUIT", 1, nil, 0, 0, 0, "QUIT", "Closes the connection once the replies to the commands sent before are written", (*Server).handleQuit},
+	{"RESET", 1, nil, 0, 0, 0, "RESET", "Resets the connection: leaves the subscriptions, turns tracking and READONLY off and switches back to RESP2", (*Server).handleReset},
+	{"INFO", -1, nil, 0, 0, 0, "INFO [section [section ...]]", "Returns information and statistics about the server", argsHandler((*Server).handleInfo)},
+	{"MEMORY", -2, nil, 0, 0, 0, "MEMORY STATS", "Returns memory usage details, including the compression of large strings", argsHandler((*Server).handleMemory)},
+	{"CLIENT", -2, []string{FlagAdmin}, 0, 0, 0, "CLIENT ID | LIST | SETNAME connection-name | GETNAME | SETINFO LIB-NAME|LIB-VER|REQUEST-ID value | REQUESTID request-id | TRACKING ON|OFF [REDIRECT client-id] [PREFIX prefix ...] [BCAST] [NOLOOP] | TRACEPARENT traceparent [tracestate] | PAUSE timeout [WRITE|ALL] | UNPAUSE", "Inspects, names and annotates client connections, turns client side caching on, sets the trace parent or request ID of the next command and pauses the clients", (*Server).handleClient},
+	{"HELLO", -1, nil, 0, 0, 0, "HELLO [protover]", "Switches the protocol of the connection, replying with the server properties", (*Server).handleHello},
+	{"CONFIG", -2, []string{FlagAdmin}, 0, 0, 0, "CONFIG GET pattern [pattern ...] | SET parameter value [parameter value ...]", "Returns or changes the runtime parameters loglevel and log-commands", argsHandler((*Server).handleConfig)},
+	{"SLOWLOG", -2, []string{FlagAdmin}, 0, 0, 0, "SLOWLOG GET [count] | LEN | RESET", "Returns or resets the commands that exceeded the slow log threshold", argsHandler((*Server).handleSlowlog)},
+	{"LATENCY", -2, []string{FlagAdmin}, 0, 0, 0, "LATENCY LATEST | HISTORY event | RESET [event ...] | DOCTOR | HISTOGRAM [command ...]", "Returns or resets the latency spikes recorded by the latency monitor, or returns the latency histograms of commands", argsHandler((*Server).handleLatency)},
+	{"READONLY", 1, nil, 0, 0, 0, "READONLY", "Lets the connection read possibly stale values from the Raft followers", readOnlyHandler(true)},
+	{"READWRITE", 1, nil, 0, 0, 0, "READWRITE", "Sends the reads of the connection to the Raft leader again", readOnlyHandler(false)},
+	{"RAFT", -2, []string{FlagAdmin}, 0, 0, 0, "RAFT INFO | SNAPSHOT | ADDNODE id address | REMOVENODE id", "Returns the state of the Raft node, snapshots its state or changes the members of its cluster", (*Server).handleRaft},
+	{"GOSSIP", -2, []string{FlagAdmin}, 0, 0, 0, "GOSSIP MEMBERS | JOIN address [address ...]", "Returns the members of the gossip cluster or joins it through known nodes", (*Server).handleGossip},
+	{"TTLHIST", -1, nil, 0, 0, 0, "TTLHIST [SAMPLES count]", "Returns the number of keys and bytes expiring within each time to live bucket, forecasting the memory reclaimed", argsHandler((*Server).handleTTLHist)},
+	{"HOTKEYS", -1, nil, 0, 0, 0, "HOTKEYS [COUNT count] [PREFIXES]", "Returns the most accessed keys or key prefixes over the hot keys window", argsHandler((*Server).handleHotKeys)},
+	{"SHUTDOWN", -1, []string{FlagAdmin}, 0, 0, 0, "SHUTDOWN [NOSAVE | SAVE | DRAIN [milliseconds]]", "Stops the server, snapshotting the Raft state first with SAVE or waiting for the clients with DRAIN", (*Server).handleShutdown},
+	{"MODULE", -2, []string{FlagAdmin}, 0, 0, 0, "MODULE LIST", "Returns the loaded modules", argsHandler((*Server).handleModule)},
+	{"COMMAND", -1, nil, 0, 0, 0, "COMMAND [COUNT | INFO command [command ...] | DOCS [command ...]]", "Returns details about the supported commands", argsHandler((*Server).handleCommand)},
+}
+
+// RegisterCommand adds a command to the server, so that extensions can serve
+// commands of their own. It fails if a command with the same name exists
+// Commands must be registered before calling Start or from Module.Load
+func (s *Server) RegisterCommand(cmd Command) error {
+	if cmd.Name == "" || strings.ContainsAny(cmd.Name, " \t\r\n") {
+		return fmt.Errorf("invalid command name %q", cmd.Name)
+	}
+	if cmd.Arity == 0 {
+		return fmt.Errorf("command %s must have a non-zero arity", cmd.Name)
+	}
+	if cmd.Handler == nil {
+		return fmt.Errorf("command %s must have a handler", cmd.Name)
+	}
+
+	cmd.Name = strings.ToUpper(cmd.Name)
+	if _, ok := s.commands[cmd.Name]; ok {
+		return fmt.Errorf("command %s is already registered", cmd.Name)
+	}
+	s.commands[cmd.Name] = &cmd
+	return nil
+}
+
+// argsHandler adapts handlers that do not need the client
+func argsHandler(fn func(*Server, []string) (Reply, error)) CommandFunc {
+	return func(s *Server, _ Client, args []string) (Reply, error) {
+		return fn(s, args)
+	}
+}
+
+// keyHandler adapts handlers taking the single key of the command
+func keyHandler(fn func(*Server, string) (Reply, error)) CommandFunc {
+	return func(s *Server, _ Client, args []string) (Reply, error) {
+		return fn(s, args[0])
+	}
+}
+
+func setHandler(s *Server, client Client, args []string) (Reply, error) {
+	var (
+		r   Reply
+		err error
+	)
+	if n := len(args); n >= 4 && strings.EqualFold(args[n-2], "IFVERSION") {
+		if err := s.checkVersion(args[0], args[n-1]); err != nil {
+			return nil, err
+		}
+		args = args[:n-2]
+	}
+	switch len(args) {
+	case 2:
+		r, err = s.handleSet(args[0], args[1])
+	case 3:
+		r, err = s.handleSetWithTTL(args[0], args[1], args[2])
+	case 4:
+		if !strings.EqualFold(args[2], "PXAT") {
+			return nil, ErrSyntax
+		}
+		r, err = s.handleSetAt(args[0], args[1], args[3])
+	default:
+		return nil, errors.New("SET message must atleast have key and value")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.writeThrough(client, args[0], []byte(args[1]), false, r)
+}
+
+func delHandler(s *Server, client Client, args []string) (Reply, error) {
+	r, err := s.handleDel(args)
+	if err != nil {
+		return nil, err
+	}
+	return s.writeThroughKeys(client, args, nil, true, r)
+}
+
+func expireAtHandler(unit int64) CommandFunc {
+	return func(s *Server, _ Client, args []string) (Reply, error) {
+		return s.handleExpireAt(unitCommand("EXPIREAT", unit), args, unit)
+	}
+}
+
+func expireTimeHandler(unit int64) CommandFunc {
+	return func(s *Server, _ Client, args []string) (Reply, error) {
+		return s.handleExpireTime(unitCommand("EXPIRETIME", unit), args[0], unit)
+	}
+}
+
+// unitCommand returns the name of the seconds or milliseconds variant of cmd
+func unitCommand(cmd string, unit int64) string {
+	if unit == 1 {
+		return "P" + cmd
+	}
+	return cmd
+}
+
+func flushHandler(cmd string) CommandFunc {
+	return func(s *Server, _ Client, args []string) (Reply, error) {
+		return s.handleFlushAll(cmd, args)
+	}
+}
+
+// builtinCommandNames maps the upper case names of the built in commands
+// to them, for the tools running without a Server
+var builtinCommandNames = func() map[string]*Command {
+	names := make(map[string]*Command, len(builtinCommands))
+	for _, cmd := range builtinCommands {
+		names[cmd.Name] = cmd
+	}
+	return names
+}()
+
+// lookupCommand returns the named command, ignoring case
+func (s *Server) lookupCommand(name string) (*Command, bool) {
+	cmd, ok := s.commands[strings.ToUpper(name)]
+	return cmd, ok
+}
+
+// argRange bounds the number of arguments of a subcommand, including the
+// names of the command and subcommand, max being -1 if unbounded
+type argRange struct {
+	min, max int
+}
+
+// subcommandArgs holds the number of arguments of the subcommands, keyed
+// by their command and name joined by a | as in Redis. checkArity
+// validates those listed, the others being left to their handler to reply
+// an unknown subcommand
+var subcommandArgs = map[string]argRange{
+	"CLIENT|ID":          {2, 2},
+	"CLIENT|LIST":        {2, 2},
+	"CLIENT|SETNAME":     {3, 3},
+	"CLIENT|GETNAME":     {2, 2},
+	"CLIENT|SETINFO":     {4, 4},
+	"CLIENT|REQUESTID":   {3, 3},
+	"CLIENT|TRACKING":    {3, -1},
+	"CLIENT|TRACEPARENT": {3, 4},
+	"CLIENT|PAUSE":       {3, 4},
+	"CLIENT|UNPAUSE":     {2, 2},
+
+	"COMMAND|COUNT": {2, 2},
+	"COMMAND|INFO":  {3, -1},
+	"COMMAND|DOCS":  {2, -1},
+
+	"CONFIG|GET": {3, -1},
+	"CONFIG|SET": {4, -1},
+
+	"GOSSIP|MEMBERS": {2, 2},
+	"GOSSIP|JOIN":    {3, -1},
+
+	"LATENCY|LATEST":    {2, 2},
+	"LATENCY|HISTORY":   {3, 3},
+	"LATENCY|RESET":     {2, -1},
+	"LATENCY|DOCTOR":    {2, 2},
+	"LATENCY|HISTOGRAM": {2, -1},
+
+	"MEMORY|STATS":    {2, 2},
+	"MODULE|LIST":     {2, 2},
+	"OBJECT|ENCODING": {3, 3},
+
+	"PUBSUB|CHANNELS":      {2, 3},
+	"PUBSUB|SHARDCHANNELS": {2, 3},
+	"PUBSUB|NUMSUB":        {2, -1},
+	"PUBSUB|SHARDNUMSUB":   {2, -1},
+	"PUBSUB|NUMPAT":        {2, 2},
+	"PUBSUB|STATS":         {2, 3},
+	"PUBSUB|SHARDSTATS":    {2, 3},
+	"PUBSUB|RESETSTATS":    {2, 2},
+
+	"RAFT|INFO":       {2, 2},
+	"RAFT|SNAPSHOT":   {2, 2},
+	"RAFT|ADDNODE":    {4, 4},
+	"RAFT|REMOVENODE": {3, 3},
+
+	"SLOWLOG|GET":   {2, 3},
+	"SLOWLOG|LEN":   {2, 2},
+	"SLOWLOG|RESET": {2, 2},
+
+	"XGROUP|CREATE":         {5, 6},
+	"XGROUP|SETID":          {5, 5},
+	"XGROUP|DESTROY":        {4, 4},
+	"XGROUP|CREATECONSUMER": {5, 5},
+	"XGROUP|DELCONSUMER":    {5, 5},
+}
+
+// checkArity validates the number of arguments, args starting with the
+// command name, and that of the subcommand if it is in subcommandArgs
+func (cmd *Command) checkArity(args []string) error {
+	n := len(args)
+	if (cmd.Arity > 0 && n != cmd.Arity) || (cmd.Arity < 0 && n < -cmd.Arity) {
+		return errWrongArgs(cmd.Name)
+	}
+	if n < 2 {
+		return nil
+	}
+	name := cmd.Name + "|" + strings.ToUpper(args[1])
+	if r, ok := subcommandArgs[name]; ok && (n < r.min || (r.max >= 0 && n > r.max)) {
+		return errWrongArgs(name)
+	}
+	return nil
+}
+
+// errWrongArgs returns the error replied to a command, or to a subcommand
+// named command|subcommand, given a wrong number of arguments
+func errWrongArgs(name string) error {
+	return fmt.Errorf("wrong number of arguments for '%s' command", strings.ToLower(name))
+}
+
+// keys returns the key arguments of a command line described by FirstKey,
+// LastKey and Step, args starting with the command name
+func (cmd *Command) keys(args []string) []string {
+	if cmd.FirstKey <= 0 || cmd.FirstKey >= len(args) {
+		return nil
+	}
+	last := cmd.LastKey
+	if last < 0 {
+		last += len(args)
+	}
+	if last >= len(args) {
+		last = len(args) - 1
+	}
+	step := cmd.Step
+	if step < 1 {
+		step = 1
+	}
+
+	var keys []string
+	for i := cmd.FirstKey; i <= last; i += step {
+		keys = append(keys, args[i])
+	}
+	return keys
+}
+
+// hasFlag reports whether the command is marked with flag
+func (cmd *Command) hasFlag(flag string) bool {
+	for _, f := range cmd.Flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// info returns the command as [name, arity, [flags], first-key, last-key, step]
+// written as "name arity flags first-key last-key step" in the text protocol
+func (cmd *Command) info() Reply {
+	flags := "-"
+	if len(cmd.Flags) > 0 {
+		flags = strings.Join(cmd.Flags, ",")
+	}
+	flagsReply := make(Array, len(cmd.Flags))
+	for i, flag := range cmd.Flags {
+		flagsReply[i] = Status(flag)
+	}
+
+	name := strings.ToLower(cmd.Name)
+	r := Array{Bulk(name), Int(cmd.Arity), flagsReply, Int(cmd.FirstKey), Int(cmd.LastKey), Int(cmd.Step)}
+	return withText(r, []byte(fmt.Sprintf("%s %d %s %d %d %d", name, cmd.Arity, flags, cmd.FirstKey, cmd.LastKey, cmd.Step)))
+}
+
+// docsReply returns the documentation of the commands as a flat array of
+// name and [summary, ..., syntax, ...] pairs, written in the text protocol as
+// each name followed by indented summary and syntax lines
+func docsReply(cmds []*Command) Reply {
+	if len(cmds) == 0 {
+		return Array{}
+	}
+
+	var (
+		buf bytes.Buffer
+		arr = make(Array, 0, 2*len(cmds))
+	)
+	for i, cmd := range cmds {
+		if i > 0 {
+			buf.WriteByte('\n')
+		}
+		name := strings.ToLower(cmd.Name)
+		fmt.Fprintf(&buf, "%s\n  summary: %s\n  syntax: %s", name, cmd.Summary, cmd.Syntax)
+		arr = append(arr, Bulk(name), Array{Bulk("summary"), Bulk(cmd.Summary), Bulk("syntax"), Bulk(cmd.Syntax)})
+	}
+	return withText(arr, buf.Bytes())
+}
+
+// sortedCommands returns every registered command ordered by name
+func (s *Server) sortedCommands() []*Command {
+	cmds := make([]*Command, 0, len(s.commands))
+	for _, cmd := range s.commands {
+		cmds = append(cmds, cmd)
+	}
+	sort.Slice(cmds, func(i, j int) bool { return cmds[i].Name < cmds[j].Name })
+	return cmds
+}
+
+// handleCommand implements COMMAND, COMMAND COUNT, COMMAND INFO command [...]
+// and COMMAND DOCS [command ...]. COMMAND INFO replies nil for unknown
+// commands while COMMAND DOCS leaves them out
+func (s *Server) handleCommand(args []string) (Reply, error) {
+	if len(args) == 0 {
+		cmds := s.sortedCommands()
+		r := make(Array, len(cmds))
+		for i, cmd := range cmds {
+			r[i] = cmd.info()
+		}
+		return r, nil
+	}
+
+	switch strings.ToUpper(args[0]) {
+	case "COUNT":
+		return Int(len(s.commands)), nil
+	case "INFO":
+		s.logCommand("COMMAND INFO %v\n", args[1:])
+		r := make(Array, len(args)-1)
+		for i, name := range args[1:] {
+			r[i] = Nil
+			if cmd, ok := s.lookupCommand(name); ok {
+				r[i] = cmd.info()
+			}
+		}
+		return r, nil
+	case "DOCS":
+		s.logCommand("COMMAND DOCS %v\n", args[1:])
+		if len(args) == 1 {
+			return docsReply(s.sortedCommands()), nil
+		}
+		var cmds []*Command
+		for _, name := range args[1:] {
+			if cmd, ok := s.lookupCommand(name); ok {
+				cmds = append(cmds, cmd)
+			}
+		}
+		return docsReply(cmds), nil
+	default:
+		return nil, fmt.Errorf("unknown subcommand '%s'", args[0])
+	}
+}
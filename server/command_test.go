@@ -0,0 +1,79 @@
+package server_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/KavetiRohith/go-cache/server"
+	"github.com/KavetiRohith/go-cache/server/servertest"
+)
+
+// commandLine returns a command line of n arguments, the name included,
+// starting with prefix and padded with placeholder arguments
+func commandLine(n int, prefix ...string) []string {
+	line := append([]string{}, prefix...)
+	for len(line) < n {
+		line = append(line, "x")
+	}
+	return line
+}
+
+// fitsArity reports whether n arguments, the name included, satisfy arity
+func fitsArity(arity, n int) bool {
+	if arity < 0 {
+		return n >= -arity
+	}
+	return n == arity
+}
+
+func wrongArgs(name string) string {
+	return fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(name))
+}
+
+func TestCommandArity(t *testing.T) {
+	s := servertest.NewServer(t, server.ServerOpts{}, nil)
+
+	for _, cmd := range server.BuiltinCommands {
+		var counts []int
+		if cmd.Arity > 0 {
+			counts = []int{cmd.Arity - 1, cmd.Arity + 1}
+		} else {
+			counts = []int{-cmd.Arity - 1}
+		}
+		for _, n := range counts {
+			if n >= 1 {
+				s.ExpectError(wrongArgs(cmd.Name), commandLine(n, cmd.Name)...)
+			}
+		}
+	}
+}
+
+func TestSubcommandArity(t *testing.T) {
+	s := servertest.NewServer(t, server.ServerOpts{}, nil)
+
+	arities := make(map[string]int)
+	for _, cmd := range server.BuiltinCommands {
+		arities[cmd.Name] = cmd.Arity
+	}
+	for name, r := range server.SubcommandArgs() {
+		cmdName, sub, _ := strings.Cut(name, "|")
+		arity, ok := arities[cmdName]
+		if !ok {
+			t.Errorf("%s: unknown command %s", name, cmdName)
+			continue
+		}
+
+		counts := []int{r[0] - 1}
+		if r[1] >= 0 {
+			counts = append(counts, r[1]+1)
+		}
+		for _, n := range counts {
+			// a count the command itself refuses never reaches the
+			// subcommand check
+			if n >= 2 && fitsArity(arity, n) {
+				s.ExpectError(wrongArgs(name), commandLine(n, cmdName, sub)...)
+			}
+		}
+	}
+}
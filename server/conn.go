@@ -1,6 +1,11 @@
 package server
 
-import "syscall"
+import (
+	"context"
+	"sync"
+	"syscall"
+	"time"
+)
 
 type fDconn struct {
 	Fd int
@@ -17,3 +22,131 @@ func (f fDconn) Read(b []byte) (int, error) {
 func (f fDconn) Close() error {
 	return syscall.Close(f.Fd)
 }
+
+// clientConn holds the state of a connected client
+type clientConn struct {
+	fDconn
+	// querybuf holds the bytes read from the client but not parsed yet
+	querybuf []byte
+	// want is the length querybuf must reach to hold the big argument
+	// being received, so that it is allocated once rather than grown
+	want int
+	// out holds the replies not written yet, as the segments of a writev.
+	// outbuf holds the encoded replies, those from outpos on not being in
+	// out yet, while big bulk payloads get segments of their own. outLen
+	// is the number of bytes held by out
+	out    [][]byte
+	outbuf []byte
+	outpos int
+	outLen int
+	// softLimitSince is when the pending output went over the soft output
+	// buffer limit, zero while it is under it, and closeASAP is set once
+	// the client exceeded its limit, for it to be closed after the poll
+	softLimitSince time.Time
+	closeASAP      bool
+	// quit is set by QUIT for the connection to be closed once its
+	// replies are written, the commands following it being ignored
+	quit bool
+	// paused is set while a command of the client waits for the end of
+	// a CLIENT PAUSE
+	paused bool
+	// pendingWrite is set while the client has replies queued since the
+	// last poll, and waitWrite while it waits for its socket to be writable
+	pendingWrite bool
+	waitWrite    bool
+	// resp is set when the last command was sent as a RESP array, so
+	// that its reply is written in RESP too
+	resp bool
+	// resp3 is set once the client switched to RESP3 with HELLO 3, and
+	// tracking holds its CLIENT TRACKING state, nil while it is off
+	resp3    bool
+	tracking *tracking
+	// readOnly is set by READONLY for the reads of the client to be served
+	// by the Raft followers
+	readOnly bool
+	// pubsub holds the subscriptions of the client, nil until it subscribes
+	pubsub *pubsubClient
+	// addr is the address of the peer and name the one set with
+	// CLIENT SETNAME, both reported by CLIENT LIST. proxyHeader is set
+	// until the PROXY protocol header giving the address is read
+	addr        string
+	name        string
+	proxyHeader bool
+	// ip is the IP the connection counts against for MaxConnsPerIP,
+	// empty until it is admitted
+	ip string
+	// libName and libVer are the client library set with CLIENT SETINFO,
+	// and requestID the request ID of the connection. nextRequestID is
+	// the one set with CLIENT REQUESTID for the next command only, and
+	// cmdRequestID that of the command being served, reported by the slow
+	// log, the debug log and the traces
+	libName       string
+	libVer        string
+	requestID     string
+	nextRequestID string
+	cmdRequestID  string
+	// traceParent holds the span set by CLIENT TRACEPARENT for the next
+	// command, and parseStart and parsedAt when the parsing of the command
+	// being served started and ended, while tracing
+	traceParent context.Context
+	parseStart  time.Time
+	parsedAt    time.Time
+	// lastCmd is the last command run, in lower case
+	lastCmd         string
+	createdAt       time.Time
+	lastInteraction time.Time
+}
+
+// queryBufPool recycles query buffers between reads, since most reads carry
+// whole commands and leave the buffer of the client empty once served
+var queryBufPool = sync.Pool{
+	New: func() any { return new([readBufferSize]byte) },
+}
+
+// releaseQueryBuf drops the query buffer of the client, returning it
+// to the pool if it came from there
+func (c *clientConn) releaseQueryBuf() {
+	if cap(c.querybuf) == readBufferSize {
+		queryBufPool.Put((*[readBufferSize]byte)(c.querybuf[:readBufferSize]))
+	}
+	c.querybuf = nil
+}
+
+// seal moves the replies encoded since the last seal into a segment of out
+// Later replies may still be appended to outbuf, as the segment is capped
+func (c *clientConn) seal() {
+	if len(c.outbuf) > c.outpos {
+		c.out = append(c.out, c.outbuf[c.outpos:len(c.outbuf):len(c.outbuf)])
+		c.outLen += len(c.outbuf) - c.outpos
+		c.outpos = len(c.outbuf)
+	}
+}
+
+// appendPayload queues p as a segment of its own rather than copying it
+func (c *clientConn) appendPayload(p []byte) {
+	c.seal()
+	c.out = append(c.out, p)
+	c.outLen += len(p)
+}
+
+// outputLen returns the number of bytes of the replies not written yet
+func (c *clientConn) outputLen() int {
+	return c.outLen + len(c.outbuf) - c.outpos
+}
+
+// consumeOut drops the first n bytes written from out, reusing the reply
+// buffer once everything is written
+func (c *clientConn) consumeOut(n int) {
+	c.outLen -= n
+	for len(c.out) > 0 && n >= len(c.out[0]) {
+		n -= len(c.out[0])
+		c.out[0] = nil
+		c.out = c.out[1:]
+	}
+	if len(c.out) > 0 {
+		c.out[0] = c.out[0][n:]
+		return
+	}
+	c.out = c.out[:0]
+	c.outbuf, c.outpos = c.outbuf[:0], 0
+}
@@ -0,0 +1,24 @@
+package server
+
+// writev writes the segments one after the other, stopping at the first
+// one the socket does not fully accept, as x/sys/unix has no writev for
+// darwin. It returns the number of bytes written
+func (f fDconn) writev(segs [][]byte) (int, error) {
+	total := 0
+	for _, seg := range segs {
+		n, err := f.Write(seg)
+		if n > 0 {
+			total += n
+		}
+		if err != nil {
+			if total > 0 {
+				return total, nil
+			}
+			return 0, err
+		}
+		if n < len(seg) {
+			break
+		}
+	}
+	return total, nil
+}
@@ -0,0 +1,15 @@
+package server
+
+import "golang.org/x/sys/unix"
+
+// maxIovecs is the largest number of segments the kernel accepts per writev
+const maxIovecs = 1024
+
+// writev writes the segments with a single syscall, returning the number
+// of bytes written
+func (f fDconn) writev(segs [][]byte) (int, error) {
+	if len(segs) > maxIovecs {
+		segs = segs[:maxIovecs]
+	}
+	return unix.Writev(f.Fd, segs)
+}
@@ -0,0 +1,42 @@
+package server
+
+// handleEcho implements ECHO message
+func (s *Server) handleEcho(args []string) (Reply, error) {
+	return Bulk(args[0]), nil
+}
+
+// handleQuit implements QUIT, replying OK and closing the connection once
+// the replies queued are written. The commands pipelined after it are
+// ignored
+func (s *Server) handleQuit(client Client, _ []string) (Reply, error) {
+	if c, ok := s.clients[client.conn.Fd]; ok {
+		c.quit = true
+	}
+	return OK, nil
+}
+
+// handleReset implements RESET, bringing the connection back to the state
+// of a new one for the clients reusing connections from a pool: its
+// subscriptions are dropped, CLIENT TRACKING and READONLY are turned off,
+// the protocol goes back to RESP2, and the request ID and trace parent
+// set for the next command are cleared. Its name and library are kept, as
+// in Redis
+func (s *Server) handleReset(client Client, _ []string) (Reply, error) {
+	c, ok := s.clients[client.conn.Fd]
+	if !ok {
+		return Status("RESET"), nil
+	}
+
+	if c.pubsub != nil {
+		s.unsubscribeAll(c.pubsub)
+		c.pubsub = nil
+	}
+	c.tracking = nil
+	delete(s.trackers, c.Fd)
+	c.readOnly = false
+	c.resp3 = false
+	c.nextRequestID = ""
+	c.traceParent = nil
+	s.logCommand("RESET %d\n", c.Fd)
+	return Status("RESET"), nil
+}
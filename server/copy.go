@@ -0,0 +1,37 @@
+package server
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// handleCopy implements COPY source destination [DB destination-db] [REPLACE]
+// Only the default database exists, so DB must be 0 when given
+func (s *Server) handleCopy(args []string) (Reply, error) {
+	var replace bool
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "REPLACE":
+			replace = true
+		case "DB":
+			if i+1 >= len(args) {
+				return nil, ErrSyntax
+			}
+			if db, err := strconv.Atoi(args[i+1]); err != nil || db != 0 {
+				return nil, errors.New("DB index is out of range")
+			}
+			i++
+		default:
+			return nil, ErrSyntax
+		}
+	}
+
+	copied, err := s.cache.Copy(args[0], args[1], replace)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logCommand("COPY %s %s %v\n", args[0], args[1], copied)
+	return boolToInt(copied), nil
+}
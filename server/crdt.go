@@ -0,0 +1,255 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"log"
+	"math"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultCRDTSyncInterval is the default interval at which the counters
+	// and sets of the CRDT commands are sent to the peers
+	DefaultCRDTSyncInterval = time.Second
+	// crdtPeerTimeout bounds the connections to the peers and the merges
+	// they reply to
+	crdtPeerTimeout = 5 * time.Second
+)
+
+// handleCRDTIncrBy implements CRDT.INCRBY key increment, adding to the count
+// of this replica
+func (s *Server) handleCRDTIncrBy(args []string) (Reply, error) {
+	n, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil || n == 0 || n > math.MaxInt64 {
+		return nil, errors.New("increment must be a positive integer")
+	}
+
+	value, err := s.cache.GCounterIncrBy(args[0], s.crdtReplicaID(), n)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logCommand("CRDT.INCRBY %s %d\n", args[0], n)
+	s.crdtChanged(args[0])
+	return Int(value), nil
+}
+
+// handleCRDTGet implements CRDT.GET key
+func (s *Server) handleCRDTGet(args []string) (Reply, error) {
+	value, err := s.cache.GCounterGet(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return Int(value), nil
+}
+
+// handleCRDTSAdd implements CRDT.SADD key member [member ...]
+func (s *Server) handleCRDTSAdd(args []string) (Reply, error) {
+	added, err := s.cache.ORSetAdd(args[0], s.crdtReplicaID(), args[1:]...)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logCommand("CRDT.SADD %s %v\n", args[0], args[1:])
+	s.crdtChanged(args[0])
+	return Int(added), nil
+}
+
+// handleCRDTSRem implements CRDT.SREM key member [member ...]
+func (s *Server) handleCRDTSRem(args []string) (Reply, error) {
+	removed, err := s.cache.ORSetRemove(args[0], args[1:]...)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logCommand("CRDT.SREM %s %v\n", args[0], args[1:])
+	if removed > 0 {
+		s.crdtChanged(args[0])
+	}
+	return Int(removed), nil
+}
+
+// handleCRDTSMembers implements CRDT.SMEMBERS key
+func (s *Server) handleCRDTSMembers(args []string) (Reply, error) {
+	members, err := s.cache.ORSetMembers(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return bulks(members), nil
+}
+
+// handleCRDTSIsMember implements CRDT.SISMEMBER key member
+func (s *Server) handleCRDTSIsMember(args []string) (Reply, error) {
+	ok, err := s.cache.ORSetIsMember(args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+	return boolToInt(ok), nil
+}
+
+// handleCRDTMerge implements CRDT.MERGE key payload, merging the state of a
+// counter or a set sent by a peer. The merged keys are not sent on to the
+// other peers, which receive the state from the replica that changed it
+func (s *Server) handleCRDTMerge(args []string) (Reply, error) {
+	if err := s.cache.CRDTMerge(args[0], []byte(args[1])); err != nil {
+		return nil, err
+	}
+	return OK, nil
+}
+
+func (s *Server) crdtReplicaID() string {
+	if s.CRDTReplicaID != "" {
+		return s.CRDTReplicaID
+	}
+	return net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+}
+
+// crdtChanged records that key changed for the next sync with the peers
+func (s *Server) crdtChanged(key string) {
+	if s.crdtDirty != nil {
+		s.crdtDirty[key] = struct{}{}
+	}
+}
+
+// crdtState is the state of a counter or a set sent to the peers
+type crdtState struct {
+	key     string
+	payload []byte
+}
+
+// crdtPeer is another replica the counters and sets are sent to, over a
+// connection of its goroutine
+type crdtPeer struct {
+	addr string
+	// batches holds the states changed since the previous sync
+	batches chan []crdtState
+	// missed is set when a batch was dropped because the peer was slow,
+	// for the next sync to send every state
+	missed atomic.Bool
+	conn   net.Conn
+	r      *bufio.Reader
+}
+
+// startCRDTSync starts sending the counters and sets changed to the peers
+// every CRDTSyncInterval, returning the function stopping it. A peer
+// connecting again receives them all, so that it catches up with the
+// changes it missed
+func (s *Server) startCRDTSync() func() {
+	interval := s.CRDTSyncInterval
+	if interval <= 0 {
+		interval = DefaultCRDTSyncInterval
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	s.crdtDirty = make(map[string]struct{})
+	peers := make([]*crdtPeer, len(s.CRDTPeers))
+	for i, addr := range s.CRDTPeers {
+		peers[i] = &crdtPeer{addr: addr, batches: make(chan []crdtState, 1)}
+		go s.runCRDTPeer(ctx, peers[i])
+	}
+
+	var syncPeers func()
+	syncPeers = func() {
+		batch := s.crdtStates(s.crdtDirty)
+		s.crdtDirty = make(map[string]struct{})
+		for _, p := range peers {
+			select {
+			case p.batches <- batch:
+			default:
+				p.missed.Store(true)
+			}
+		}
+		s.AfterFunc(interval, syncPeers)
+	}
+	s.AfterFunc(interval, syncPeers)
+
+	return func() {
+		cancel()
+		for _, p := range peers {
+			close(p.batches)
+		}
+	}
+}
+
+// crdtStates returns the states of the counters and sets among keys
+func (s *Server) crdtStates(keys map[string]struct{}) []crdtState {
+	states := make([]crdtState, 0, len(keys))
+	for key := range keys {
+		if payload, ok := s.cache.DumpCRDT(key); ok {
+			states = append(states, crdtState{key, payload})
+		}
+	}
+	return states
+}
+
+// runCRDTPeer sends the batches to a peer, connecting to it again when the
+// connection is lost
+func (s *Server) runCRDTPeer(ctx context.Context, p *crdtPeer) {
+	defer func() {
+		if p.conn != nil {
+			p.conn.Close()
+		}
+	}()
+
+	for batch := range p.batches {
+		if p.conn == nil || p.missed.Swap(false) {
+			if p.conn == nil {
+				conn, err := net.DialTimeout("tcp", p.addr, crdtPeerTimeout)
+				if err != nil {
+					continue
+				}
+				log.Println("syncing the CRDTs with", p.addr)
+				p.conn, p.r = conn, bufio.NewReader(conn)
+			}
+			var all []crdtState
+			if err := s.runOnLoop(ctx, func() {
+				keys := make(map[string]struct{})
+				for _, key := range s.cache.CRDTKeys() {
+					keys[key] = struct{}{}
+				}
+				all = s.crdtStates(keys)
+			}); err != nil {
+				return
+			}
+			batch = all
+		}
+
+		if err := p.send(batch); err != nil {
+			log.Println("lost the CRDT peer", p.addr+":", err)
+			p.conn.Close()
+			p.conn = nil
+		}
+	}
+}
+
+// send pipelines the merges of the states to the peer, logging those it
+// refuses
+func (p *crdtPeer) send(batch []crdtState) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	p.conn.SetDeadline(time.Now().Add(crdtPeerTimeout))
+
+	w := bufio.NewWriter(p.conn)
+	for _, st := range batch {
+		w.Write(appendCommand(nil, "CRDT.MERGE", st.key, string(st.payload)))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	for _, st := range batch {
+		reply, err := readRESPFrame(p.r, nil)
+		if err != nil {
+			return err
+		}
+		if reply[0] == '-' {
+			log.Printf("CRDT peer %s refused %q: %s\n", p.addr, st.key, reply[1:len(reply)-2])
+		}
+	}
+	return nil
+}
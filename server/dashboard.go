@@ -0,0 +1,27 @@
+package server
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// dashboardPath is the admin dashboard of the HTTP gateway
+const dashboardPath = "/dashboard"
+
+// dashboardHTML is a single page showing the stats, keys, clients and slow
+// log of the server, which it reads with INFO, SCAN, CLIENT LIST and SLOWLOG
+// over the WebSocket bridge
+//
+//go:embed dashboard.html
+var dashboardHTML []byte
+
+func serveDashboard(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "default-src 'self'; script-src 'unsafe-inline'; style-src 'unsafe-inline'; connect-src 'self'")
+	w.Write(dashboardHTML)
+}
@@ -0,0 +1,45 @@
+//go:build testclock || faults
+
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/KavetiRohith/go-cache/cache"
+)
+
+// the test builds, tagged testclock or faults, add DEBUG, for the tests
+// driving the server over the network to move its clock or inject faults
+func init() {
+	cmd := &Command{"DEBUG", -2, []string{FlagAdmin}, 0, 0, 0, "DEBUG SET-TIME unix-time-milliseconds | STRINGMATCH-LEN pattern string | FAULT FAIL-FSYNC [count] | FAULT DROP-LINK milliseconds | FAULT DELAY-SNAPSHOT milliseconds | FAULT RESET", "Sets the time told by the manual clock of the cache, matches a glob-style pattern within its budget, or injects faults into the Raft log, links and snapshots, in the test builds", argsHandler((*Server).handleDebug)}
+	builtinCommands = append(builtinCommands, cmd)
+	builtinCommandNames[cmd.Name] = cmd
+	subcommandArgs["DEBUG|STRINGMATCH-LEN"] = argRange{4, 4}
+}
+
+// debugSubcommands are the subcommands of DEBUG, registered by the files
+// of the build tags providing them
+var debugSubcommands = map[string]func(s *Server, args []string) (Reply, error){
+	"STRINGMATCH-LEN": (*Server).debugStringMatchLen,
+}
+
+func (s *Server) handleDebug(args []string) (Reply, error) {
+	sub, ok := debugSubcommands[strings.ToUpper(args[0])]
+	if !ok {
+		return nil, fmt.Errorf("unknown subcommand '%s'", args[0])
+	}
+	return sub(s, args[1:])
+}
+
+// debugStringMatchLen implements DEBUG STRINGMATCH-LEN pattern string,
+// replying 1 if string matches the glob-style pattern and 0 otherwise, or
+// an error if the match exceeds cache.MatchBudget steps, for the tests to
+// check that the patterns of many '*' cannot hold the event loop
+func (s *Server) debugStringMatchLen(args []string) (Reply, error) {
+	ok, err := cache.MatchPatternBudget(args[0], args[1], cache.MatchBudget)
+	if err != nil {
+		return nil, err
+	}
+	return boolToInt(ok), nil
+}
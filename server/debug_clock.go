@@ -0,0 +1,34 @@
+//go:build testclock
+
+package server
+
+import (
+	"errors"
+	"strconv"
+	"time"
+)
+
+func init() {
+	debugSubcommands["SET-TIME"] = (*Server).debugSetTime
+	subcommandArgs["DEBUG|SET-TIME"] = argRange{3, 3}
+}
+
+// settableClock is a clock that can be set, such as cache.ManualClock
+type settableClock interface {
+	Set(now time.Time)
+}
+
+func (s *Server) debugSetTime(args []string) (Reply, error) {
+	ms, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid unix-time-milliseconds argument")
+	}
+	clock, ok := s.cache.Clock().(settableClock)
+	if !ok {
+		return nil, errors.New("the clock of the cache cannot be set")
+	}
+
+	clock.Set(time.UnixMilli(ms))
+	s.logCommand("DEBUG SET-TIME %d\n", ms)
+	return OK, nil
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+const (
+	// DefaultDefragIgnoreBytes is the default fragmentation in bytes below
+	// which the heap is not defragmented, whatever its ratio
+	DefaultDefragIgnoreBytes = 100 << 20
+	// defragStepBudget bounds the time an idle poll spends defragmenting,
+	// for the loop to serve the events arriving meanwhile without delay,
+	// and defragInterval the time it polls for while defragmenting, which
+	// together bound the cycle to a tenth of a core
+	defragStepBudget = time.Millisecond
+	defragInterval   = 10 * time.Millisecond
+)
+
+// defragState holds the state of the idle defragmentation cycle
+type defragState struct {
+	// running is set while the heap is fragmented beyond DefragThreshold,
+	// the idle polls then moving keys to fresh allocations
+	running bool
+	// ratio and bytes are the fragmentation of the heap when last checked
+	ratio float64
+	bytes int64
+}
+
+// checkFragmentation measures the fragmentation of the heap, as the ratio
+// of the memory of the spans in use to that of the objects they hold and
+// the bytes in between, and starts or stops the idle defragmentation
+// cycle against DefragThreshold and DefragIgnoreBytes. It runs every cron
+func (s *Server) checkFragmentation() {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	d := &s.defrag
+	d.ratio, d.bytes = 1, 0
+	if m.HeapAlloc > 0 {
+		d.ratio = float64(m.HeapInuse) / float64(m.HeapAlloc)
+	}
+	if m.HeapInuse > m.HeapAlloc {
+		d.bytes = int64(m.HeapInuse - m.HeapAlloc)
+	}
+	d.running = s.DefragThreshold > 0 && d.ratio > s.DefragThreshold && d.bytes > s.DefragIgnoreBytes
+}
+
+// defragTimeout shortens the poll timeout to defragInterval while the
+// heap is defragmented, for the idle loop to wake up to the next step
+func (s *Server) defragTimeout(timeout time.Duration) time.Duration {
+	if s.defrag.running && (timeout < 0 || timeout > defragInterval) {
+		return defragInterval
+	}
+	return timeout
+}
+
+// defragIdle moves a batch of keys to fresh allocations while the heap is
+// fragmented, when a poll found no events. Once a pass over the keyspace
+// completes, the memory freed is returned to the OS in the background and
+// the cycle waits for the next check to tell whether it is still needed
+func (s *Server) defragIdle() {
+	if !s.defrag.running || !s.cache.Defrag(defragStepBudget) {
+		return
+	}
+	s.defrag.running = false
+	go debug.FreeOSMemory()
+}
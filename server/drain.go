@@ -0,0 +1,83 @@
+package server
+
+import (
+	"log"
+	"time"
+
+	"github.com/KavetiRohith/go-cache/cache"
+	"github.com/KavetiRohith/go-cache/server/iomultiplexer"
+)
+
+const (
+	// DefaultDrainTimeout is how long a drain waits for the clients by
+	// default
+	DefaultDrainTimeout = 30 * time.Second
+	// drainCheckInterval is how often a drain checks whether the clients
+	// are done
+	drainCheckInterval = 100 * time.Millisecond
+)
+
+// Drain stops the server gracefully for a rolling restart, as SHUTDOWN
+// DRAIN does, waiting up to timeout for the clients, or DrainTimeout if
+// timeout is 0. It is safe to call from any goroutine
+func (s *Server) Drain(timeout time.Duration) {
+	s.Post(func() { s.drain(timeout) })
+}
+
+// drain stops accepting connections and refuses the commands of the
+// clients connected with DRAINING errors, hinting at DrainRedirect, then
+// stops the server once no client is blocked or has replies pending, or
+// once timeout passes
+func (s *Server) drain(timeout time.Duration) {
+	if !s.drainDeadline.IsZero() {
+		return
+	}
+	if timeout <= 0 {
+		timeout = s.DrainTimeout
+	}
+	s.drainDeadline = time.Now().Add(timeout)
+	log.Printf("draining the clients for up to %v\n", timeout)
+
+	// the connections attempted from now on wait in the backlog of the
+	// listening socket until it is closed as the server stops
+	if err := s.multiplexer.Modify(iomultiplexer.Event{Fd: s.listenFD}); err != nil {
+		log.Println("drain:", err)
+	}
+	s.checkDrained()
+}
+
+// draining reports whether the server is draining its clients
+func (s *Server) draining() bool {
+	return !s.drainDeadline.IsZero()
+}
+
+// drainingError returns the error refusing the commands while draining
+func (s *Server) drainingError() error {
+	if s.DrainRedirect != "" {
+		return cache.Errorf(cache.KindDraining, "the server is shutting down, reconnect to %s", s.DrainRedirect)
+	}
+	return &cache.Error{Kind: cache.KindDraining, Msg: "the server is shutting down"}
+}
+
+// checkDrained stops the server once the clients are done or the drain
+// timed out, and checks again later otherwise
+func (s *Server) checkDrained() {
+	done := len(s.blocked) == 0
+	for _, c := range s.clients {
+		if !done {
+			break
+		}
+		done = c.outputLen() == 0
+	}
+
+	switch {
+	case done:
+		log.Println("drained the clients")
+	case !time.Now().Before(s.drainDeadline):
+		log.Printf("drain timed out with %d clients blocked\n", len(s.blocked))
+	default:
+		s.AfterFunc(drainCheckInterval, s.checkDrained)
+		return
+	}
+	s.stopped = true
+}
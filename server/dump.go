@@ -0,0 +1,108 @@
+package server
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/KavetiRohith/go-cache/cache"
+)
+
+// handleDump implements DUMP key. As the text protocol cannot carry binary
+// data the serialized value is sent base64 encoded
+func (s *Server) handleDump(key string) (Reply, error) {
+	payload, ok, err := s.cache.Dump(key)
+	if err != nil {
+		return nil, err
+	}
+	s.logCommand("DUMP %s %d bytes\n", key, len(payload))
+	if !ok {
+		return Nil, nil
+	}
+
+	return Bulk(base64.StdEncoding.EncodeToString(payload)), nil
+}
+
+// handleRestore implements RESTORE key ttl serialized-value [REPLACE] [ABSTTL]
+// where ttl is in milliseconds, 0 meaning no expiration, and
+// serialized-value is the base64 encoded output of DUMP
+func (s *Server) handleRestore(args []string) (Reply, error) {
+	var replace, absTTL bool
+	for _, opt := range args[3:] {
+		switch strings.ToUpper(opt) {
+		case "REPLACE":
+			replace = true
+		case "ABSTTL":
+			absTTL = true
+		default:
+			return nil, ErrSyntax
+		}
+	}
+
+	ttl, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil || ttl < 0 {
+		return nil, errors.New("invalid TTL value, must be >= 0")
+	}
+
+	expiresAt := int64(-1)
+	switch {
+	case ttl > 0 && absTTL:
+		expiresAt = ttl
+	case ttl > 0:
+		expiresAt = s.cache.Now().UnixMilli() + ttl
+	}
+
+	payload, err := base64.StdEncoding.DecodeString(args[2])
+	if err != nil {
+		return nil, cache.ErrBadDump
+	}
+
+	if err := s.cache.Restore(args[0], payload, expiresAt, replace); err != nil {
+		return nil, err
+	}
+
+	s.logCommand("RESTORE %s %d %v\n", args[0], ttl, args[3:])
+	return OK, nil
+}
+
+// handleDumpAll implements DUMPALL cursor [MATCH pattern] [COUNT count] [TYPE type],
+// iterating over the keyspace as SCAN does while returning every key as
+// [key, type, expire-time, serialized-value, value]. The expire time is in
+// unix milliseconds, -1 for the keys without one, the serialized value is
+// the base64 encoded output of DUMP and the value is the string or the JSON
+// document, nil for the other types, so that the keyspace is streamed out
+// a batch at a time and restored with RESTORE ... ABSTTL
+func (s *Server) handleDumpAll(args []string) (Reply, error) {
+	cursor, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	pattern, typ, count, err := parseScanOpts(args[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	keys, next, err := s.cache.ScanType(cursor, count, pattern, typ)
+	if err != nil {
+		return nil, err
+	}
+	entries := make(Array, 0, len(keys))
+	for _, key := range keys {
+		e, ok, err := s.cache.Export(key)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		value := Reply(Nil)
+		if e.Value != nil {
+			value = Bulk(e.Value)
+		}
+		entries = append(entries, Array{Bulk(key), Bulk(e.Type), Int(e.ExpiresAt), Bulk(base64.StdEncoding.EncodeToString(e.Payload)), value})
+	}
+
+	s.logCommand("DUMPALL %d %d keys next: %d\n", cursor, len(entries), next)
+	return Array{Bulk(strconv.FormatUint(next, 10)), entries}, nil
+}
@@ -0,0 +1,28 @@
+package server
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/KavetiRohith/go-cache/cache"
+)
+
+// ErrSyntax is returned for commands whose options cannot be parsed
+var ErrSyntax = &cache.Error{Kind: cache.KindErr, Msg: "syntax error"}
+
+// errNoProto is returned by HELLO for the protocol versions not supported
+var errNoProto = &cache.Error{Kind: cache.KindNoProto, Msg: "unsupported protocol version"}
+
+// errReadOnly is returned for the write commands sent to a ReadOnly server
+var errReadOnly = &cache.Error{Kind: cache.KindReadOnly, Msg: "You can't write against a read only instance."}
+
+// formatError renders err as "<KIND> <message>" for error replies
+// Errors that are not a *cache.Error are of kind ERR
+func formatError(err error) string {
+	msg := err.Error()
+	var e *cache.Error
+	if errors.As(err, &e) && strings.HasPrefix(msg, e.Kind+" ") {
+		return msg
+	}
+	return cache.ErrorKind(err) + " " + msg
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// handleExpireAt implements EXPIREAT and PEXPIREAT
+// key unix-time [NX | XX | GT | LT], where unit is the number of
+// milliseconds per unit of the given timestamp
+func (s *Server) handleExpireAt(cmd string, args []string, unit int64) (Reply, error) {
+	if len(args) != 2 && len(args) != 3 {
+		return nil, errWrongArgs(cmd)
+	}
+
+	ts, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return nil, errors.New("value is not an integer or out of range")
+	}
+	expiresAt := ts * unit
+
+	key := args[0]
+	if len(args) == 3 {
+		current := s.cache.ExpireTime(key)
+		if current == -2 {
+			return Int(0), nil
+		}
+
+		var apply bool
+		switch strings.ToUpper(args[2]) {
+		case "NX":
+			apply = current == -1
+		case "XX":
+			apply = current != -1
+		case "GT":
+			// keys without an expire are treated as having an infinite TTL
+			apply = current != -1 && expiresAt > current
+		case "LT":
+			apply = current == -1 || expiresAt < current
+		default:
+			return nil, errors.New("unsupported option " + args[2])
+		}
+		if !apply {
+			return Int(0), nil
+		}
+	}
+
+	ok := s.cache.ExpireAt(key, expiresAt)
+	s.logCommand("%s %s %d %v\n", cmd, key, ts, ok)
+	return boolToInt(ok), nil
+}
+
+// handleExpireTime implements EXPIRETIME and PEXPIRETIME, replying with the
+// absolute expiration in the unit of the command, -1 for keys without an
+// expire and -2 for missing keys
+func (s *Server) handleExpireTime(cmd string, key string, unit int64) (Reply, error) {
+	expiresAt := s.cache.ExpireTime(key)
+	if expiresAt > 0 {
+		expiresAt /= unit
+	}
+
+	s.logCommand("%s %s %d\n", cmd, key, expiresAt)
+	return Int(expiresAt), nil
+}
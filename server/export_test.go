@@ -0,0 +1,34 @@
+package server
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/hashicorp/raft"
+)
+
+// BuiltinCommands exports the built in commands to the tests of
+// server_test, which cannot reach them otherwise
+var BuiltinCommands = builtinCommands
+
+// SubcommandArgs returns the number of arguments of the subcommands
+// checkArity validates, as [min, max] with a max of -1 unbounded
+func SubcommandArgs() map[string][2]int {
+	args := make(map[string][2]int, len(subcommandArgs))
+	for name, r := range subcommandArgs {
+		args[name] = [2]int{r.min, r.max}
+	}
+	return args
+}
+
+// ApplyRaftEntry applies cmds to s as its Raft FSM applies the entry of
+// the log at index the leader logged at the unix time in milliseconds at,
+// for the tests of server_test to replay the same log on several servers
+func ApplyRaftEntry(s *Server, index uint64, at int64, cmds ...[]string) error {
+	data := appendCommand(nil, raftAppliedAtCommand, strconv.FormatInt(at, 10))
+	for _, args := range cmds {
+		data = appendCommand(data, args...)
+	}
+	fsm := &raftFSM{s: s, ctx: context.Background()}
+	return fsm.Apply(&raft.Log{Index: index, Data: data}).(raftResult).err
+}
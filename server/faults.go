@@ -0,0 +1,239 @@
+//go:build faults
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+func init() {
+	debugSubcommands["FAULT"] = (*Server).debugFault
+	subcommandArgs["DEBUG|FAULT"] = argRange{3, 4}
+}
+
+var (
+	errInjectedSync = errors.New("injected fault: fsync failed")
+	errInjectedLink = errors.New("injected fault: link down")
+)
+
+// faultState holds the faults injected into Raft by DEBUG FAULT, read by
+// its goroutines
+type faultState struct {
+	// failSyncs is the number of writes of the log left to fail
+	failSyncs atomic.Int64
+	// linkDownUntil is the unix time in nanoseconds until which the RPCs
+	// to and from the other nodes fail
+	linkDownUntil atomic.Int64
+	// snapshotDelay delays the completion of every snapshot written
+	snapshotDelay atomic.Int64
+}
+
+// linkDown reports whether the link to the other nodes is dropped
+func (f *faultState) linkDown() bool {
+	return time.Now().UnixNano() < f.linkDownUntil.Load()
+}
+
+// debugFault implements DEBUG FAULT FAIL-FSYNC [count] | DROP-LINK
+// milliseconds | DELAY-SNAPSHOT milliseconds | RESET
+func (s *Server) debugFault(args []string) (Reply, error) {
+	sub := strings.ToUpper(args[0])
+	switch sub {
+	case "FAIL-FSYNC", "DROP-LINK", "DELAY-SNAPSHOT", "RESET":
+	default:
+		return nil, fmt.Errorf("unknown subcommand 'fault|%s'", args[0])
+	}
+	n := int64(1)
+	switch {
+	case len(args) == 1 && (sub == "RESET" || sub == "FAIL-FSYNC"):
+	case len(args) == 2 && sub != "RESET":
+		var err error
+		if n, err = strconv.ParseInt(args[1], 10, 64); err != nil || n < 0 {
+			return nil, errors.New("value is out of range, must be positive")
+		}
+	default:
+		return nil, errWrongArgs("debug|fault|" + sub)
+	}
+
+	f := &s.faults
+	switch sub {
+	case "FAIL-FSYNC":
+		f.failSyncs.Store(n)
+	case "DROP-LINK":
+		f.linkDownUntil.Store(time.Now().Add(time.Duration(n) * time.Millisecond).UnixNano())
+	case "DELAY-SNAPSHOT":
+		f.snapshotDelay.Store(int64(time.Duration(n) * time.Millisecond))
+	case "RESET":
+		f.failSyncs.Store(0)
+		f.linkDownUntil.Store(0)
+		f.snapshotDelay.Store(0)
+	}
+	s.logCommand("DEBUG FAULT %v\n", args)
+	return OK, nil
+}
+
+// faultLogStore fails the writes of the log armed by FAIL-FSYNC, as a
+// disk failing to sync them would
+func (s *Server) faultLogStore(store raft.LogStore) raft.LogStore {
+	return &faultLogStore{LogStore: store, faults: &s.faults}
+}
+
+type faultLogStore struct {
+	raft.LogStore
+	faults *faultState
+}
+
+func (l *faultLogStore) fail() bool {
+	for {
+		n := l.faults.failSyncs.Load()
+		if n <= 0 {
+			return false
+		}
+		if l.faults.failSyncs.CompareAndSwap(n, n-1) {
+			return true
+		}
+	}
+}
+
+func (l *faultLogStore) StoreLog(log *raft.Log) error {
+	if l.fail() {
+		return errInjectedSync
+	}
+	return l.LogStore.StoreLog(log)
+}
+
+func (l *faultLogStore) StoreLogs(logs []*raft.Log) error {
+	if l.fail() {
+		return errInjectedSync
+	}
+	return l.LogStore.StoreLogs(logs)
+}
+
+// faultSnapshotStore delays the snapshots written by DELAY-SNAPSHOT,
+// before they are closed and retained
+func (s *Server) faultSnapshotStore(store raft.SnapshotStore) raft.SnapshotStore {
+	return &faultSnapshotStore{SnapshotStore: store, faults: &s.faults}
+}
+
+type faultSnapshotStore struct {
+	raft.SnapshotStore
+	faults *faultState
+}
+
+func (ss *faultSnapshotStore) Create(version raft.SnapshotVersion, index, term uint64, configuration raft.Configuration, configurationIndex uint64, trans raft.Transport) (raft.SnapshotSink, error) {
+	sink, err := ss.SnapshotStore.Create(version, index, term, configuration, configurationIndex, trans)
+	if err != nil {
+		return nil, err
+	}
+	return &faultSnapshotSink{SnapshotSink: sink, faults: ss.faults}, nil
+}
+
+type faultSnapshotSink struct {
+	raft.SnapshotSink
+	faults *faultState
+}
+
+func (sink *faultSnapshotSink) Close() error {
+	time.Sleep(time.Duration(sink.faults.snapshotDelay.Load()))
+	return sink.SnapshotSink.Close()
+}
+
+// faultTransport fails the RPCs to and from the other nodes while the link
+// is dropped by DROP-LINK, as a network partition would
+func (s *Server) faultTransport(t raft.Transport) raft.Transport {
+	ft := &faultTransport{Transport: t, faults: &s.faults, consumer: make(chan raft.RPC)}
+	go func() {
+		for rpc := range t.Consumer() {
+			if ft.faults.linkDown() {
+				rpc.Respond(nil, errInjectedLink)
+				continue
+			}
+			ft.consumer <- rpc
+		}
+	}()
+	return ft
+}
+
+type faultTransport struct {
+	raft.Transport
+	faults   *faultState
+	consumer chan raft.RPC
+}
+
+func (t *faultTransport) Consumer() <-chan raft.RPC {
+	return t.consumer
+}
+
+func (t *faultTransport) SetHeartbeatHandler(cb func(rpc raft.RPC)) {
+	if cb == nil {
+		t.Transport.SetHeartbeatHandler(nil)
+		return
+	}
+	t.Transport.SetHeartbeatHandler(func(rpc raft.RPC) {
+		if t.faults.linkDown() {
+			rpc.Respond(nil, errInjectedLink)
+			return
+		}
+		cb(rpc)
+	})
+}
+
+func (t *faultTransport) AppendEntriesPipeline(id raft.ServerID, target raft.ServerAddress) (raft.AppendPipeline, error) {
+	if t.faults.linkDown() {
+		return nil, errInjectedLink
+	}
+	p, err := t.Transport.AppendEntriesPipeline(id, target)
+	if err != nil {
+		return nil, err
+	}
+	return &faultPipeline{AppendPipeline: p, faults: t.faults}, nil
+}
+
+// faultPipeline fails the entries appended through a pipeline opened
+// before the link was dropped, which Raft then closes
+type faultPipeline struct {
+	raft.AppendPipeline
+	faults *faultState
+}
+
+func (p *faultPipeline) AppendEntries(args *raft.AppendEntriesRequest, resp *raft.AppendEntriesResponse) (raft.AppendFuture, error) {
+	if p.faults.linkDown() {
+		return nil, errInjectedLink
+	}
+	return p.AppendPipeline.AppendEntries(args, resp)
+}
+
+func (t *faultTransport) AppendEntries(id raft.ServerID, target raft.ServerAddress, args *raft.AppendEntriesRequest, resp *raft.AppendEntriesResponse) error {
+	if t.faults.linkDown() {
+		return errInjectedLink
+	}
+	return t.Transport.AppendEntries(id, target, args, resp)
+}
+
+func (t *faultTransport) RequestVote(id raft.ServerID, target raft.ServerAddress, args *raft.RequestVoteRequest, resp *raft.RequestVoteResponse) error {
+	if t.faults.linkDown() {
+		return errInjectedLink
+	}
+	return t.Transport.RequestVote(id, target, args, resp)
+}
+
+func (t *faultTransport) InstallSnapshot(id raft.ServerID, target raft.ServerAddress, args *raft.InstallSnapshotRequest, resp *raft.InstallSnapshotResponse, data io.Reader) error {
+	if t.faults.linkDown() {
+		return errInjectedLink
+	}
+	return t.Transport.InstallSnapshot(id, target, args, resp, data)
+}
+
+func (t *faultTransport) TimeoutNow(id raft.ServerID, target raft.ServerAddress, args *raft.TimeoutNowRequest, resp *raft.TimeoutNowResponse) error {
+	if t.faults.linkDown() {
+		return errInjectedLink
+	}
+	return t.Transport.TimeoutNow(id, target, args, resp)
+}
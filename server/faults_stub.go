@@ -0,0 +1,20 @@
+//go:build !faults
+
+package server
+
+import "github.com/hashicorp/raft"
+
+// faultState holds the faults injected, none without the tag faults
+type faultState struct{}
+
+func (s *Server) faultLogStore(store raft.LogStore) raft.LogStore {
+	return store
+}
+
+func (s *Server) faultSnapshotStore(store raft.SnapshotStore) raft.SnapshotStore {
+	return store
+}
+
+func (s *Server) faultTransport(t raft.Transport) raft.Transport {
+	return t
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"errors"
+	"strconv"
+)
+
+// handleBFReserve implements BF.RESERVE key error_rate capacity
+func (s *Server) handleBFReserve(args []string) (Reply, error) {
+	errorRate, err := strconv.ParseFloat(args[1], 64)
+	if err != nil {
+		return nil, errors.New("bad error rate")
+	}
+	capacity, err := strconv.ParseUint(args[2], 10, 64)
+	if err != nil {
+		return nil, errors.New("bad capacity")
+	}
+
+	if err := s.cache.BFReserve(args[0], errorRate, capacity); err != nil {
+		return nil, err
+	}
+
+	s.logCommand("BF.RESERVE %s %v %d\n", args[0], errorRate, capacity)
+	return OK, nil
+}
+
+// handleBFAdd implements BF.ADD key item, replying 1 if the item was added
+// and 0 if it may have been added before
+func (s *Server) handleBFAdd(args []string) (Reply, error) {
+	added, err := s.cache.BFAdd(args[0], []byte(args[1]))
+	if err != nil {
+		return nil, err
+	}
+
+	s.logCommand("BF.ADD %s %s %v\n", args[0], args[1], added[0])
+	return boolToInt(added[0]), nil
+}
+
+// handleBFMAdd implements BF.MADD key item [item ...]
+func (s *Server) handleBFMAdd(args []string) (Reply, error) {
+	added, err := s.cache.BFAdd(args[0], bytesArgs(args[1:])...)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logCommand("BF.MADD %s %v %v\n", args[0], args[1:], added)
+	r := make(Array, len(added))
+	for i, ok := range added {
+		r[i] = boolToInt(ok)
+	}
+	return r, nil
+}
+
+// handleBFExists implements BF.EXISTS key item
+func (s *Server) handleBFExists(args []string) (Reply, error) {
+	exists, err := s.cache.BFExists(args[0], []byte(args[1]))
+	if err != nil {
+		return nil, err
+	}
+	return boolToInt(exists[0]), nil
+}
+
+// handleBFMExists implements BF.MEXISTS key item [item ...]
+func (s *Server) handleBFMExists(args []string) (Reply, error) {
+	exists, err := s.cache.BFExists(args[0], bytesArgs(args[1:])...)
+	if err != nil {
+		return nil, err
+	}
+
+	r := make(Array, len(exists))
+	for i, ok := range exists {
+		r[i] = boolToInt(ok)
+	}
+	return r, nil
+}
+
+// handleCFReserve implements CF.RESERVE key capacity
+func (s *Server) handleCFReserve(args []string) (Reply, error) {
+	capacity, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		return nil, errors.New("bad capacity")
+	}
+
+	if err := s.cache.CFReserve(args[0], capacity); err != nil {
+		return nil, err
+	}
+
+	s.logCommand("CF.RESERVE %s %d\n", args[0], capacity)
+	return OK, nil
+}
+
+// handleCFAdd implements CF.ADD key item, which adds the item even if it
+// may be in the filter already
+func (s *Server) handleCFAdd(args []string) (Reply, error) {
+	return s.cuckooAdd(args, false)
+}
+
+// handleCFAddNX implements CF.ADDNX key item, replying 0 without adding
+// the item if it may be in the filter already
+func (s *Server) handleCFAddNX(args []string) (Reply, error) {
+	return s.cuckooAdd(args, true)
+}
+
+func (s *Server) cuckooAdd(args []string, nx bool) (Reply, error) {
+	added, err := s.cache.CFAdd(args[0], []byte(args[1]), nx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logCommand("CF.ADD %s %s %v\n", args[0], args[1], added)
+	return boolToInt(added), nil
+}
+
+// handleCFExists implements CF.EXISTS key item
+func (s *Server) handleCFExists(args []string) (Reply, error) {
+	exists, err := s.cache.CFExists(args[0], []byte(args[1]))
+	if err != nil {
+		return nil, err
+	}
+	return boolToInt(exists), nil
+}
+
+// handleCFDel implements CF.DEL key item, replying 1 if an occurrence of
+// the item was removed and 0 if it was not found
+func (s *Server) handleCFDel(args []string) (Reply, error) {
+	deleted, err := s.cache.CFDel(args[0], []byte(args[1]))
+	if err != nil {
+		return nil, err
+	}
+
+	s.logCommand("CF.DEL %s %s %v\n", args[0], args[1], deleted)
+	return boolToInt(deleted), nil
+}
+
+func bytesArgs(args []string) [][]byte {
+	items := make([][]byte, len(args))
+	for i, arg := range args {
+		items[i] = []byte(arg)
+	}
+	return items
+}
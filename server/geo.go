@@ -0,0 +1,248 @@
+package server
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/KavetiRohith/go-cache/cache"
+)
+
+// geoUnits maps the supported distance units to their length in meters
+var geoUnits = map[string]float64{
+	"M":  1,
+	"KM": 1000,
+	"FT": 0.3048,
+	"MI": 1609.34,
+}
+
+// handleGeoAdd implements GEOADD key [NX|XX] [CH] longitude latitude member [...]
+func (s *Server) handleGeoAdd(args []string) (Reply, error) {
+	key := args[0]
+	opts, rest := parseZAddOpts(args[1:])
+	if len(rest) == 0 || len(rest)%3 != 0 {
+		return nil, ErrSyntax
+	}
+
+	points := make([]cache.GeoPoint, 0, len(rest)/3)
+	for i := 0; i < len(rest); i += 3 {
+		lon, lat, err := parseLonLat(rest[i], rest[i+1])
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, cache.GeoPoint{Member: rest[i+2], Lon: lon, Lat: lat})
+	}
+
+	n, err := s.cache.GeoAdd(key, opts, points...)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logCommand("GEOADD %s %v %d\n", key, points, n)
+	return Int(n), nil
+}
+
+// handleGeoPos implements GEOPOS key member [member ...]
+// replying one "longitude latitude" line per member
+func (s *Server) handleGeoPos(args []string) (Reply, error) {
+	positions := make(Array, 0, len(args)-1)
+	for _, member := range args[1:] {
+		lon, lat, ok, err := s.cache.GeoPos(args[0], member)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			positions = append(positions, Nil)
+			continue
+		}
+		positions = append(positions, Array{Bulk(formatCoord(lon)), Bulk(formatCoord(lat))})
+	}
+
+	s.logCommand("GEOPOS %s %v\n", args[0], args[1:])
+	return positions, nil
+}
+
+// handleGeoDist implements GEODIST key member1 member2 [M|KM|FT|MI]
+func (s *Server) handleGeoDist(args []string) (Reply, error) {
+	if len(args) != 3 && len(args) != 4 {
+		return nil, errWrongArgs("geodist")
+	}
+
+	unit := 1.0
+	if len(args) == 4 {
+		var err error
+		if unit, err = parseGeoUnit(args[3]); err != nil {
+			return nil, err
+		}
+	}
+
+	dist, ok, err := s.cache.GeoDist(args[0], args[1], args[2])
+	if err != nil {
+		return nil, err
+	}
+
+	s.logCommand("GEODIST %s %s %s %v\n", args[0], args[1], args[2], dist)
+	if !ok {
+		return Nil, nil
+	}
+	return Bulk(formatDist(dist / unit)), nil
+}
+
+// handleGeoSearch implements
+// GEOSEARCH key <FROMMEMBER member | FROMLONLAT longitude latitude>
+// <BYRADIUS radius unit | BYBOX width height unit> [ASC|DESC] [COUNT count]
+// [WITHCOORD] [WITHDIST] [WITHHASH]
+func (s *Server) handleGeoSearch(args []string) (Reply, error) {
+	var (
+		key                           = args[0]
+		q                             cache.GeoSearchQuery
+		unit                          = 1.0
+		hasFrom, hasBy                bool
+		withCoord, withDist, withHash bool
+		err                           error
+	)
+
+	for i := 1; i < len(args); i++ {
+		rest := len(args) - i - 1
+		switch strings.ToUpper(args[i]) {
+		case "FROMMEMBER":
+			if rest < 1 || hasFrom {
+				return nil, ErrSyntax
+			}
+			q.FromMember = args[i+1]
+			hasFrom = true
+			i++
+		case "FROMLONLAT":
+			if rest < 2 || hasFrom {
+				return nil, ErrSyntax
+			}
+			if q.Lon, q.Lat, err = parseLonLat(args[i+1], args[i+2]); err != nil {
+				return nil, err
+			}
+			hasFrom = true
+			i += 2
+		case "BYRADIUS":
+			if rest < 2 || hasBy {
+				return nil, ErrSyntax
+			}
+			if q.Radius, err = parseDistance(args[i+1]); err != nil {
+				return nil, err
+			}
+			if unit, err = parseGeoUnit(args[i+2]); err != nil {
+				return nil, err
+			}
+			q.Radius *= unit
+			hasBy = true
+			i += 2
+		case "BYBOX":
+			if rest < 3 || hasBy {
+				return nil, ErrSyntax
+			}
+			if q.Width, err = parseDistance(args[i+1]); err != nil {
+				return nil, err
+			}
+			if q.Height, err = parseDistance(args[i+2]); err != nil {
+				return nil, err
+			}
+			if unit, err = parseGeoUnit(args[i+3]); err != nil {
+				return nil, err
+			}
+			q.Width *= unit
+			q.Height *= unit
+			hasBy = true
+			i += 3
+		case "ASC":
+			q.Sort, q.Desc = true, false
+		case "DESC":
+			q.Sort, q.Desc = true, true
+		case "COUNT":
+			if rest < 1 {
+				return nil, ErrSyntax
+			}
+			if q.Count, err = strconv.Atoi(args[i+1]); err != nil || q.Count <= 0 {
+				return nil, errors.New("COUNT must be > 0")
+			}
+			i++
+		case "WITHCOORD":
+			withCoord = true
+		case "WITHDIST":
+			withDist = true
+		case "WITHHASH":
+			withHash = true
+		default:
+			return nil, ErrSyntax
+		}
+	}
+
+	if !hasFrom {
+		return nil, errors.New("exactly one of FROMMEMBER or FROMLONLAT can be specified for GEOSEARCH")
+	}
+	if !hasBy {
+		return nil, errors.New("exactly one of BYRADIUS and BYBOX can be specified for GEOSEARCH")
+	}
+
+	results, err := s.cache.GeoSearch(key, q)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logCommand("GEOSEARCH %s %+v %d results\n", key, q, len(results))
+	if len(results) == 0 {
+		return Array{}, nil
+	}
+
+	// one line per result: member [distance] [hash] [longitude latitude]
+	arr := make(Array, len(results))
+	for i, r := range results {
+		if !withDist && !withHash && !withCoord {
+			arr[i] = Bulk(r.Member)
+			continue
+		}
+
+		item := Array{Bulk(r.Member)}
+		if withDist {
+			item = append(item, Bulk(formatDist(r.Dist/unit)))
+		}
+		if withHash {
+			item = append(item, Int(r.Hash))
+		}
+		if withCoord {
+			item = append(item, Array{Bulk(formatCoord(r.Lon)), Bulk(formatCoord(r.Lat))})
+		}
+		arr[i] = item
+	}
+	return arr, nil
+}
+
+func parseLonLat(lonStr, latStr string) (float64, float64, error) {
+	lon, err1 := strconv.ParseFloat(lonStr, 64)
+	lat, err2 := strconv.ParseFloat(latStr, 64)
+	if err1 != nil || err2 != nil {
+		return 0, 0, errors.New("value is not a valid float")
+	}
+	return lon, lat, nil
+}
+
+func parseDistance(s string) (float64, error) {
+	d, err := strconv.ParseFloat(s, 64)
+	if err != nil || d < 0 {
+		return 0, errors.New("need numeric radius")
+	}
+	return d, nil
+}
+
+func parseGeoUnit(s string) (float64, error) {
+	unit, ok := geoUnits[strings.ToUpper(s)]
+	if !ok {
+		return 0, errors.New("unsupported unit provided. please use M, KM, FT, MI")
+	}
+	return unit, nil
+}
+
+func formatDist(d float64) string {
+	return strconv.FormatFloat(d, 'f', 4, 64)
+}
+
+func formatCoord(c float64) string {
+	return strconv.FormatFloat(c, 'f', -1, 64)
+}
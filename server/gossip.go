@@ -0,0 +1,251 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/memberlist"
+)
+
+const (
+	// DefaultGossipRejoinInterval is the default interval at which the
+	// seeds are resolved and joined again
+	DefaultGossipRejoinInterval = 30 * time.Second
+	// gossipLeaveTimeout bounds how long a node stopping waits for its
+	// leave to be gossiped
+	gossipLeaveTimeout = time.Second
+)
+
+var errGossipDisabled = errors.New("gossip is disabled")
+
+// gossipNode is a member of the gossip cluster as last reported
+type gossipNode struct {
+	// addr is the gossip address of the node and server the address of
+	// its RESP server
+	addr, server string
+	// state is alive, failed or left, since the given time
+	state string
+	since time.Time
+}
+
+// startGossip joins the gossip cluster of GossipJoin, returning the
+// function leaving it. The nodes find each other through the nodes they
+// know of, and probe each other with SWIM, a node that does not answer
+// the probes of any node being declared failed
+func (s *Server) startGossip() (func(), error) {
+	host, portStr, err := net.SplitHostPort(s.GossipAddr)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid gossip port %q", portStr)
+	}
+
+	config := memberlist.DefaultLANConfig()
+	config.Name = s.GossipName
+	if config.Name == "" {
+		config.Name = net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+	}
+	config.BindAddr, config.BindPort = host, port
+	config.AdvertisePort = port
+	config.Delegate = gossipDelegate{meta: []byte(net.JoinHostPort(s.Host, strconv.Itoa(s.Port)))}
+	config.Events = gossipEvents{s}
+	config.LogOutput = gossipLogWriter{}
+
+	s.gossipNodes = make(map[string]*gossipNode)
+	list, err := memberlist.Create(config)
+	if err != nil {
+		return nil, err
+	}
+	s.gossip = list
+	log.Println("gossiping as", config.Name, "on", s.GossipAddr)
+
+	stop := make(chan struct{})
+	if len(s.GossipJoin) > 0 {
+		go s.joinSeeds(stop)
+	}
+	return func() {
+		close(stop)
+		list.Leave(gossipLeaveTimeout)
+		list.Shutdown()
+	}, nil
+}
+
+// joinSeeds joins the seeds of GossipJoin and joins them again every
+// GossipRejoinInterval until stop is closed, resolving them every time so
+// that the nodes replaced behind a DNS name, such as the pods of a
+// Kubernetes headless service, are found again, and the partitions heal
+func (s *Server) joinSeeds(stop chan struct{}) {
+	interval := s.GossipRejoinInterval
+	if interval <= 0 {
+		interval = DefaultGossipRejoinInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var lastErr string
+	for {
+		addrs, err := resolveSeeds(s.GossipJoin)
+		if len(addrs) > 0 {
+			if _, joinErr := s.gossip.Join(addrs); joinErr != nil && err == nil {
+				err = joinErr
+			}
+		}
+		// the same error is logged once, not at every attempt
+		if err != nil && err.Error() != lastErr {
+			log.Println("joining the gossip cluster:", strings.Join(strings.Fields(err.Error()), " "))
+		}
+		lastErr = ""
+		if err != nil {
+			lastErr = err.Error()
+		}
+
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// resolveSeeds returns the addresses of seeds, given as host:port or as
+// srv:name for the targets of the DNS SRV records of name, along with the
+// first error resolving them
+func resolveSeeds(seeds []string) ([]string, error) {
+	var addrs []string
+	var firstErr error
+	for _, seed := range seeds {
+		if !strings.HasPrefix(seed, "srv:") {
+			addrs = append(addrs, seed)
+			continue
+		}
+		_, records, err := net.LookupSRV("", "", strings.TrimPrefix(seed, "srv:"))
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		for _, r := range records {
+			addrs = append(addrs, net.JoinHostPort(strings.TrimSuffix(r.Target, "."), strconv.Itoa(int(r.Port))))
+		}
+	}
+	return addrs, firstErr
+}
+
+// handleGossip implements GOSSIP MEMBERS | JOIN address [address ...]
+func (s *Server) handleGossip(client Client, args []string) (Reply, error) {
+	if s.gossip == nil {
+		return nil, errGossipDisabled
+	}
+
+	switch strings.ToUpper(args[0]) {
+	case "MEMBERS":
+		return Bulk(s.gossipMembers()), nil
+	case "JOIN":
+		addrs := args[1:]
+		var joined int
+		return nil, s.awaitOffLoop(client.conn, func() error {
+			n, err := s.gossip.Join(addrs)
+			joined = n
+			return err
+		}, func(err error) (Reply, error) {
+			if joined == 0 && err != nil {
+				// the errors of the nodes are listed on several lines
+				return nil, errors.New(strings.Join(strings.Fields(err.Error()), " "))
+			}
+			return Int(joined), nil
+		})
+	default:
+		return nil, fmt.Errorf("unknown subcommand '%s'", args[0])
+	}
+}
+
+// gossipMembers returns a line per member like CLIENT LIST
+func (s *Server) gossipMembers() string {
+	names := make([]string, 0, len(s.gossipNodes))
+	for name := range s.gossipNodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	now := time.Now()
+	for _, name := range names {
+		n := s.gossipNodes[name]
+		fmt.Fprintf(&b, "name=%s addr=%s server=%s state=%s since=%d\n",
+			name, n.addr, n.server, n.state, int(now.Sub(n.since).Seconds()))
+	}
+	return b.String()
+}
+
+// gossipDelegate advertises the address of the RESP server of the node
+type gossipDelegate struct {
+	meta []byte
+}
+
+func (d gossipDelegate) NodeMeta(limit int) []byte {
+	if len(d.meta) > limit {
+		return nil
+	}
+	return d.meta
+}
+
+func (gossipDelegate) NotifyMsg([]byte)                {}
+func (gossipDelegate) GetBroadcasts(int, int) [][]byte { return nil }
+func (gossipDelegate) LocalState(bool) []byte          { return nil }
+func (gossipDelegate) MergeRemoteState([]byte, bool)   {}
+
+// gossipEvents records the members joining, failing and leaving on the
+// event loop
+type gossipEvents struct {
+	s *Server
+}
+
+func (e gossipEvents) NotifyJoin(n *memberlist.Node) {
+	e.update(n, "alive")
+}
+
+func (e gossipEvents) NotifyLeave(n *memberlist.Node) {
+	state := "failed"
+	if n.State == memberlist.StateLeft {
+		state = "left"
+	}
+	e.update(n, state)
+}
+
+func (e gossipEvents) NotifyUpdate(n *memberlist.Node) {
+	e.update(n, "alive")
+}
+
+func (e gossipEvents) update(n *memberlist.Node, state string) {
+	node := &gossipNode{addr: n.Address(), server: string(n.Meta), state: state, since: time.Now()}
+	name := n.Name
+	e.s.Post(func() {
+		if old, ok := e.s.gossipNodes[name]; !ok || old.state != state {
+			log.Println("gossip member", name, "is", state)
+		} else {
+			node.since = old.since
+		}
+		e.s.gossipNodes[name] = node
+	})
+}
+
+// gossipLogWriter drops the debug logs of memberlist, written for every
+// exchange between nodes
+type gossipLogWriter struct{}
+
+func (gossipLogWriter) Write(p []byte) (int, error) {
+	if bytes.Contains(p, []byte("[DEBUG]")) {
+		return len(p), nil
+	}
+	return log.Writer().Write(p)
+}
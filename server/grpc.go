@@ -0,0 +1,193 @@
+package server
+
+import (
+	"context"
+	"log"
+	"net"
+	"strconv"
+
+	"github.com/KavetiRohith/go-cache/cache"
+	"github.com/KavetiRohith/go-cache/cachepb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// grpcService implements the Cache service of cachepb
+type grpcService struct {
+	cachepb.UnimplementedCacheServer
+	s *Server
+}
+
+// startGRPC serves the gRPC API on GRPCAddr in the background. Calls run
+// their commands on the event loop through Post, like the HTTP gateway
+func (s *Server) startGRPC() (*grpc.Server, error) {
+	ln, err := net.Listen("tcp", s.GRPCAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	var opts []grpc.ServerOption
+	if s.tracer != nil {
+		opts = append(opts, grpc.UnaryInterceptor(grpcTraceInterceptor))
+	}
+	srv := grpc.NewServer(opts...)
+	cachepb.RegisterCacheServer(srv, &grpcService{s: s})
+	go func() {
+		if err := srv.Serve(ln); err != nil {
+			log.Println("grpc:", err)
+		}
+	}()
+
+	log.Println("serving the gRPC API on", ln.Addr())
+	return srv, nil
+}
+
+func (g *grpcService) Get(ctx context.Context, req *cachepb.GetRequest) (*cachepb.GetResponse, error) {
+	var (
+		val, expiresAt Reply
+		err            error
+	)
+	// a key missing from the cache is loaded from the backing store once
+	for loaded := false; ; loaded = true {
+		if err := g.s.runOnLoop(ctx, func() {
+			if val, err = g.s.handlecommand(gatewayClient, []string{"GET", req.Key}); err == nil {
+				expiresAt, err = g.s.handlecommand(gatewayClient, []string{"PEXPIRETIME", req.Key})
+			}
+		}); err != nil {
+			return nil, status.FromContextError(err).Err()
+		}
+		if err != cache.ErrNoSuchKey || loaded || !g.s.cache.HasLoader() {
+			break
+		}
+		if err = g.s.loadThrough(ctx, req.Key); err != nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	return &cachepb.GetResponse{
+		Value:      val.(Bulk),
+		TtlSeconds: ttlSeconds(int64(expiresAt.(Int))),
+	}, nil
+}
+
+func (g *grpcService) Set(ctx context.Context, req *cachepb.SetRequest) (*cachepb.SetResponse, error) {
+	if req.TtlSeconds < 0 {
+		return nil, status.Error(codes.InvalidArgument, "invalid TTl")
+	}
+
+	args := []string{"SET", req.Key, string(req.Value)}
+	if req.TtlSeconds > 0 {
+		args = append(args, strconv.FormatInt(req.TtlSeconds, 10))
+	}
+	var err error
+	if err := g.s.runOnLoop(ctx, func() { _, err = g.s.handlecommand(gatewayClient, args) }); err != nil {
+		return nil, status.FromContextError(err).Err()
+	}
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &cachepb.SetResponse{}, nil
+}
+
+func (g *grpcService) Del(ctx context.Context, req *cachepb.DelRequest) (*cachepb.DelResponse, error) {
+	var (
+		deleted int64
+		err     error
+	)
+	if err := g.s.runOnLoop(ctx, func() {
+		for _, key := range req.Keys {
+			var exists Reply
+			if exists, err = g.s.handlecommand(gatewayClient, []string{"HAS", key}); err != nil {
+				return
+			}
+			if exists != Status("Yes") {
+				continue
+			}
+			if _, err = g.s.handlecommand(gatewayClient, []string{"DEL", key}); err != nil {
+				return
+			}
+			deleted++
+		}
+	}); err != nil {
+		return nil, status.FromContextError(err).Err()
+	}
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &cachepb.DelResponse{Deleted: deleted}, nil
+}
+
+func (g *grpcService) Scan(ctx context.Context, req *cachepb.ScanRequest) (*cachepb.ScanResponse, error) {
+	if req.Count < 0 {
+		return nil, status.Error(codes.InvalidArgument, "invalid COUNT")
+	}
+
+	var (
+		resp    cachepb.ScanResponse
+		scanErr error
+	)
+	if err := g.s.runOnLoop(ctx, func() {
+		resp.Keys, resp.Cursor, scanErr = g.s.cache.Scan(req.Cursor, int(req.Count), req.Match)
+	}); err != nil {
+		return nil, status.FromContextError(err).Err()
+	}
+	if scanErr != nil {
+		return nil, grpcError(scanErr)
+	}
+	return &resp, nil
+}
+
+// Watch registers a watcher of the keys before sending the headers of the
+// stream, so that the writes following them are all reported
+func (g *grpcService) Watch(req *cachepb.WatchRequest, stream cachepb.Cache_WatchServer) error {
+	if len(req.Keys) == 0 {
+		return status.Error(codes.InvalidArgument, "no keys to watch")
+	}
+
+	ctx := stream.Context()
+	w := newKeyWatcher(req.Keys)
+	// posted functions run in order, so this runs after the watch below
+	defer g.s.Post(func() { g.s.unwatch(w) })
+	if err := g.s.runOnLoop(ctx, func() { g.s.watch(w) }); err != nil {
+		return status.FromContextError(err).Err()
+	}
+	if err := stream.SendHeader(metadata.MD{}); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case ev, ok := <-w.events:
+			if !ok {
+				if w.lagged {
+					return status.Error(codes.ResourceExhausted, "watcher lagged behind the writes")
+				}
+				return nil
+			}
+			if err := stream.Send(&cachepb.WatchEvent{Key: ev.key, Command: ev.command}); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		}
+	}
+}
+
+// grpcError maps the kind of a command error to a gRPC status
+func grpcError(err error) error {
+	code := codes.InvalidArgument
+	switch {
+	case err == cache.ErrNoSuchKey:
+		code = codes.NotFound
+	case cache.ErrorKind(err) == cache.KindWrongType:
+		code = codes.FailedPrecondition
+	case cache.ErrorKind(err) == cache.KindOOM:
+		code = codes.ResourceExhausted
+	}
+	return status.Error(code, formatError(err))
+}
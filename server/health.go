@@ -0,0 +1,117 @@
+package server
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+const (
+	// healthzPath and readyzPath are the liveness and readiness endpoints
+	// of the health listener and of the HTTP gateway
+	healthzPath = "/healthz"
+	readyzPath  = "/readyz"
+	// healthTimeout bounds how long the health checks wait for the event
+	// loop, which is unresponsive past it
+	healthTimeout = 2 * time.Second
+)
+
+// healthBody is the JSON body of the health endpoints, checks holding
+// "ok" or the reason of the failure of each check
+type healthBody struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// handlePing implements PING [message], letting clients and load
+// balancers check that the event loop is serving commands
+func (s *Server) handlePing(args []string) (Reply, error) {
+	if len(args) == 1 {
+		return Bulk(args[0]), nil
+	}
+	return Status("PONG"), nil
+}
+
+// startHealth serves the health endpoints alone on HealthAddr in the
+// background, for orchestrators probing servers whose HTTP gateway is
+// disabled or reachable by clients
+func (s *Server) startHealth() (*http.Server, error) {
+	ln, err := net.Listen("tcp", s.HealthAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	s.handleHealth(mux)
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			log.Println("health:", err)
+		}
+	}()
+
+	log.Println("serving the health endpoints on", ln.Addr())
+	return srv, nil
+}
+
+func (s *Server) handleHealth(mux *http.ServeMux) {
+	mux.HandleFunc(healthzPath, s.serveHealthz)
+	mux.HandleFunc(readyzPath, s.serveReadyz)
+}
+
+// serveHealthz implements GET /healthz, which fails when the event loop
+// does not run a posted function in time, so that a hung server restarts
+func (s *Server) serveHealthz(w http.ResponseWriter, r *http.Request) {
+	if err := s.checkLoop(r.Context()); err != nil {
+		writeHTTPJSON(w, http.StatusServiceUnavailable, healthBody{Status: "unresponsive"})
+		return
+	}
+	writeHTTPJSON(w, http.StatusOK, healthBody{Status: "ok"})
+}
+
+// serveReadyz implements GET /readyz, which fails while the server should
+// not be sent traffic: when its event loop is unresponsive, and in Raft
+// mode while the cluster has no leader or the node did not apply the log
+// committed yet
+func (s *Server) serveReadyz(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]string{"event_loop": "ok"}
+	if err := s.checkLoop(r.Context()); err != nil {
+		checks["event_loop"] = "unresponsive"
+	}
+	if s.raft != nil {
+		checks["raft"] = raftReadiness(s.raft)
+	}
+
+	for _, result := range checks {
+		if result != "ok" {
+			writeHTTPJSON(w, http.StatusServiceUnavailable, healthBody{Status: "not ready", Checks: checks})
+			return
+		}
+	}
+	writeHTTPJSON(w, http.StatusOK, healthBody{Status: "ready", Checks: checks})
+}
+
+// checkLoop waits for the event loop to run a posted function
+func (s *Server) checkLoop(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, healthTimeout)
+	defer cancel()
+	return s.runOnLoop(ctx, func() {})
+}
+
+// raftReadiness returns "ok" once the cluster has a leader and the node
+// applied the entries committed to its log, or the reason it is not ready
+func raftReadiness(r *raft.Raft) string {
+	if addr, _ := r.LeaderWithID(); addr == "" {
+		return "no leader"
+	}
+	commit, _ := strconv.ParseUint(r.Stats()["commit_index"], 10, 64)
+	if r.AppliedIndex() < commit {
+		return "applying the log"
+	}
+	return "ok"
+}
@@ -0,0 +1,225 @@
+package server
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+
+	"github.com/KavetiRohith/go-cache/cache"
+)
+
+const (
+	// DefaultHistoryKeyBytes is the default size of the versions kept for
+	// a key, and DefaultHistoryMaxBytes that of the whole history
+	DefaultHistoryKeyBytes = 1 << 20
+	DefaultHistoryMaxBytes = 64 << 20
+	// historyOverhead is the size counted for a version besides its key
+	// and value
+	historyOverhead = 64
+)
+
+var (
+	errHistoryDisabled = errors.New("the key history is disabled")
+	errHistoryTooOld   = errors.New("the history of the key does not go back that far")
+)
+
+// keyVersion is a version of a key, as left by a write or a deletion
+type keyVersion struct {
+	// seq orders the versions of every key as they were recorded
+	seq uint64
+	// at is the unix time in milliseconds of the change, and expiresAt
+	// the expire time of the key then, -1 if it had none
+	at        int64
+	expiresAt int64
+	// typ is the type of the key, empty if it was deleted, and value its
+	// value for strings
+	typ   string
+	value []byte
+}
+
+func (v keyVersion) size(key string) int {
+	return historyOverhead + len(key) + len(v.value)
+}
+
+// keyHistory is the versions of a key, oldest first, and their size
+type keyHistory struct {
+	versions []keyVersion
+	bytes    int
+}
+
+// history holds the versions of the keys read by GETAT
+type history struct {
+	keys map[string]*keyHistory
+	// order holds the versions in the order they were recorded, for the
+	// oldest ones to be dropped first once the history is full, those
+	// already dropped with the other versions of their key being skipped
+	order []historyRef
+	seq   uint64
+	// versions and bytes are the number and size of the versions kept
+	versions int
+	bytes    int
+	// since is when the history started, and horizon the time of the
+	// latest version dropped, before which the keys without versions are
+	// not known
+	since   int64
+	horizon int64
+}
+
+// historyRef refers to a version of a key
+type historyRef struct {
+	key string
+	seq uint64
+}
+
+// recordHistory records the versions of keys left by a write, or their
+// deletion if deleted is set, when HistoryVersions is set
+func (s *Server) recordHistory(keys []string, deleted bool) {
+	if s.HistoryVersions <= 0 {
+		s.history = nil
+		return
+	}
+	now := s.cache.Now().UnixMilli()
+	if s.history == nil {
+		s.history = &history{keys: make(map[string]*keyHistory), since: now}
+	}
+
+	for _, key := range keys {
+		v := keyVersion{at: now, expiresAt: -1}
+		if !deleted {
+			if e, ok, _ := s.cache.Export(key); ok {
+				v.typ, v.expiresAt = e.Type, e.ExpiresAt
+				if e.Type == "string" {
+					v.value = e.Value
+				}
+			}
+		}
+		s.history.add(key, v, s.HistoryVersions, s.HistoryKeyBytes)
+	}
+	s.history.trim(s.HistoryMaxBytes)
+}
+
+// flushHistory records the deletion of the keys with versions after the
+// keyspace was flushed or replaced, the keys without versions being no
+// longer known before then
+func (s *Server) flushHistory() {
+	if s.history == nil {
+		return
+	}
+	keys := make([]string, 0, len(s.history.keys))
+	for key := range s.history.keys {
+		keys = append(keys, key)
+	}
+	s.recordHistory(keys, true)
+	if s.history != nil {
+		s.history.horizon = s.cache.Now().UnixMilli()
+	}
+}
+
+// add appends a version of key, dropping the oldest versions of the key
+// beyond maxVersions or maxBytes but for the latest one
+func (h *history) add(key string, v keyVersion, maxVersions, maxBytes int) {
+	h.seq++
+	v.seq = h.seq
+	kh := h.keys[key]
+	if kh == nil {
+		kh = &keyHistory{}
+		h.keys[key] = kh
+	}
+	kh.versions = append(kh.versions, v)
+	kh.bytes += v.size(key)
+	h.versions++
+	h.bytes += v.size(key)
+	h.order = append(h.order, historyRef{key, v.seq})
+
+	for len(kh.versions) > 1 && (len(kh.versions) > maxVersions || kh.bytes > maxBytes) {
+		h.dropOldest(key, kh)
+	}
+}
+
+// trim drops the oldest versions until the history fits in maxBytes, and
+// compacts order once it mostly refers to versions dropped
+func (h *history) trim(maxBytes int) {
+	for h.bytes > maxBytes && len(h.order) > 0 {
+		ref := h.order[0]
+		h.order = h.order[1:]
+		if kh := h.keys[ref.key]; kh != nil && kh.versions[0].seq == ref.seq {
+			h.dropOldest(ref.key, kh)
+		}
+	}
+
+	if len(h.order) > 2*h.versions+1024 {
+		live := make([]historyRef, 0, h.versions)
+		for _, ref := range h.order {
+			if kh := h.keys[ref.key]; kh != nil && kh.versions[0].seq <= ref.seq {
+				live = append(live, ref)
+			}
+		}
+		h.order = live
+	}
+}
+
+// dropOldest drops the oldest version of key, and the key once it has no
+// versions left
+func (h *history) dropOldest(key string, kh *keyHistory) {
+	v := kh.versions[0]
+	kh.versions = append(kh.versions[:0], kh.versions[1:]...)
+	kh.bytes -= v.size(key)
+	h.versions--
+	h.bytes -= v.size(key)
+	if v.at > h.horizon {
+		h.horizon = v.at
+	}
+	if len(kh.versions) == 0 {
+		delete(h.keys, key)
+	}
+}
+
+// handleGetAt implements GETAT key unix-time-milliseconds, replying with
+// the value the string at key had then, nil if the key did not exist, or
+// an error if the history no longer knows
+func (s *Server) handleGetAt(args []string) (Reply, error) {
+	key := args[0]
+	at, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid unix-time-milliseconds argument")
+	}
+	if s.HistoryVersions <= 0 {
+		return nil, errHistoryDisabled
+	}
+
+	s.logCommand("GETAT %q %d\n", key, at)
+	// a key not written since then still has its value of then
+	info, exists := s.cache.KeyInfo(key)
+	if exists && info.WrittenAt <= at {
+		val, err := s.cache.Get(key)
+		if err != nil {
+			return nil, err
+		}
+		return Bulk(val), nil
+	}
+
+	var kh *keyHistory
+	if s.history != nil {
+		kh = s.history.keys[key]
+	}
+	if kh == nil {
+		if !exists && s.history != nil && at >= s.history.since && at > s.history.horizon {
+			return Nil, nil
+		}
+		return nil, errHistoryTooOld
+	}
+	i := sort.Search(len(kh.versions), func(i int) bool { return kh.versions[i].at > at })
+	if i == 0 {
+		return nil, errHistoryTooOld
+	}
+
+	v := kh.versions[i-1]
+	switch {
+	case v.typ == "" || (v.expiresAt != -1 && v.expiresAt <= at):
+		return Nil, nil
+	case v.typ != "string":
+		return nil, cache.ErrWrongType
+	default:
+		return Bulk(v.value), nil
+	}
+}
@@ -0,0 +1,46 @@
+package server
+
+// CommandHook is called on the event loop before a command runs, with the
+// arguments following the command name, already validated against the
+// arity of the command. It may rewrite the arguments in place, and an
+// error refuses the command, being replied instead of its reply
+type CommandHook func(client Client, cmd *Command, args []string) error
+
+// PostCommandHook is called on the event loop after a command ran, with
+// its arguments and its reply or error
+type PostCommandHook func(client Client, cmd *Command, args []string, reply Reply, err error)
+
+// AddPreHook adds a hook called before every command dispatched, after the
+// hooks added before it, so that embedders can validate, audit or rewrite
+// commands. Hooks must be added before calling Start or from Module.Load
+func (s *Server) AddPreHook(h CommandHook) {
+	s.preHooks = append(s.preHooks, h)
+}
+
+// AddPostHook adds a hook called after every command dispatched, after the
+// hooks added before it. The commands blocking the client, such as XREAD
+// with BLOCK or the writes waiting for the backing store, have no reply
+// yet and do not call the hooks. Hooks must be added before calling Start
+// or from Module.Load
+func (s *Server) AddPostHook(h PostCommandHook) {
+	s.postHooks = append(s.postHooks, h)
+}
+
+// runPreHooks calls the pre hooks until one fails, returning its error
+func (s *Server) runPreHooks(client Client, cmd *Command, args []string) error {
+	for _, h := range s.preHooks {
+		if err := h(client, cmd, args); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Server) runPostHooks(client Client, cmd *Command, args []string, reply Reply, err error) {
+	if err == errClientBlocked {
+		return
+	}
+	for _, h := range s.postHooks {
+		h(client, cmd, args, reply, err)
+	}
+}
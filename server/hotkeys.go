@@ -0,0 +1,140 @@
+package server
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KavetiRohith/go-cache/cache"
+)
+
+const (
+	// DefaultHotKeysWindow is the default window over which HOTKEYS
+	// counts the accesses of keys
+	DefaultHotKeysWindow = time.Minute
+	// hotKeysTracked is the number of hot keys and prefixes tracked, and
+	// hotKeysWidth and hotKeysDepth the dimensions of the sketches
+	// counting them, which take 128KB each
+	hotKeysTracked = 128
+	hotKeysWidth   = 2048
+	hotKeysDepth   = 4
+	// prefixDelimiter ends the prefix of a key, from user:42 to user
+	prefixDelimiter = ":"
+)
+
+// hotKeys counts the accesses of the keys, and of their prefixes, in
+// sketches of fixed size however many keys there are. The window is made
+// of two halves, the counts of the current half adding to those of the
+// previous one, so that HOTKEYS covers between half a window and a window
+// of accesses
+type hotKeys struct {
+	startedAt              time.Time
+	keys, prevKeys         *cache.TopK
+	prefixes, prevPrefixes *cache.TopK
+}
+
+func newHotKeysSketch() *cache.TopK {
+	// the dimensions are valid
+	tk, _ := cache.NewTopK(hotKeysTracked, hotKeysWidth, hotKeysDepth, cache.DefaultTopKDecay)
+	return tk
+}
+
+// recordHotKeys counts an access of the keys of a command
+func (s *Server) recordHotKeys(cmd *Command, parts []string) {
+	if s.HotKeysWindow < 0 {
+		return
+	}
+	h := &s.hotKeys
+	if h.keys == nil {
+		h.startedAt = time.Now()
+		h.keys, h.prefixes = newHotKeysSketch(), newHotKeysSketch()
+	}
+
+	for _, key := range cmd.keys(parts) {
+		h.keys.Add(key)
+		if i := strings.Index(key, prefixDelimiter); i > 0 {
+			h.prefixes.Add(key[:i])
+		}
+	}
+}
+
+// rotateHotKeys starts a new half of the window once the current one is
+// over, forgetting the counts of the previous half
+func (s *Server) rotateHotKeys(now time.Time) {
+	h := &s.hotKeys
+	elapsed := now.Sub(h.startedAt)
+	if h.keys == nil || elapsed < s.HotKeysWindow/2 {
+		return
+	}
+
+	h.prevKeys, h.prevPrefixes = h.keys, h.prefixes
+	if elapsed >= s.HotKeysWindow {
+		// no access was recorded in the last half either
+		h.prevKeys, h.prevPrefixes = nil, nil
+	}
+	h.startedAt = now
+	h.keys, h.prefixes = newHotKeysSketch(), newHotKeysSketch()
+}
+
+// handleHotKeys implements HOTKEYS [COUNT count] [PREFIXES], replying with
+// the most accessed keys, or key prefixes, and their estimated number of
+// accesses over the window by decreasing number of accesses
+func (s *Server) handleHotKeys(args []string) (Reply, error) {
+	if s.HotKeysWindow < 0 {
+		return nil, errors.New("hot keys tracking is disabled")
+	}
+
+	count, prefixes := 10, false
+	for i := 0; i < len(args); i++ {
+		switch {
+		case strings.EqualFold(args[i], "COUNT") && i+1 < len(args):
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil || n <= 0 {
+				return nil, errors.New("count should be greater than 0")
+			}
+			count = n
+			i++
+		case strings.EqualFold(args[i], "PREFIXES"):
+			prefixes = true
+		default:
+			return nil, ErrSyntax
+		}
+	}
+
+	h := &s.hotKeys
+	cur, prev := h.keys, h.prevKeys
+	if prefixes {
+		cur, prev = h.prefixes, h.prevPrefixes
+	}
+	counts := make(map[string]uint64)
+	for _, tk := range []*cache.TopK{cur, prev} {
+		if tk == nil {
+			continue
+		}
+		for _, item := range tk.List() {
+			counts[item.Item] += item.Count
+		}
+	}
+
+	items := make([]cache.TopKItem, 0, len(counts))
+	for item, n := range counts {
+		items = append(items, cache.TopKItem{Item: item, Count: n})
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Count != items[j].Count {
+			return items[i].Count > items[j].Count
+		}
+		return items[i].Item < items[j].Item
+	})
+	if len(items) > count {
+		items = items[:count]
+	}
+
+	r := make(Array, 0, 2*len(items))
+	for _, item := range items {
+		r = append(r, Bulk(item.Item), Int(item.Count))
+	}
+	return r, nil
+}
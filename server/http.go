@@ -0,0 +1,197 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KavetiRohith/go-cache/cache"
+)
+
+// httpKeysPath prefixes the keys served by the HTTP gateway
+const httpKeysPath = "/keys/"
+
+// gatewayClient is the connection the commands of the HTTP gateway and the
+// gRPC API run on, as they are not issued by a connected client
+var gatewayClient = fDconn{Fd: -1}
+
+// keyBody is the JSON body of the key requests and responses of the HTTP
+// gateway, the TTL being in seconds and omitted for keys without expiry
+type keyBody struct {
+	Key   string `json:"key,omitempty"`
+	Value string `json:"value"`
+	TTL   int64  `json:"ttl,omitempty"`
+}
+
+// startHTTP serves the HTTP gateway on HTTPAddr in the background. Requests
+// run their commands on the event loop through Post, like client commands
+func (s *Server) startHTTP() (*http.Server, error) {
+	ln, err := net.Listen("tcp", s.HTTPAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(httpKeysPath, s.serveKey)
+	mux.Handle(wsPath, s.webSocketHandler())
+	mux.HandleFunc(dashboardPath, serveDashboard)
+	s.handleHealth(mux)
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			log.Println("http:", err)
+		}
+	}()
+
+	log.Println("serving the HTTP gateway on", ln.Addr())
+	return srv, nil
+}
+
+// serveKey implements GET, PUT and DELETE /keys/{key}
+func (s *Server) serveKey(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, httpKeysPath)
+	if key == "" {
+		writeHTTPError(w, http.StatusNotFound, errors.New("missing key"))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		var (
+			val, expiresAt Reply
+			err            error
+		)
+		// a key missing from the cache is loaded from the backing store once
+		for loaded := false; ; loaded = true {
+			if !s.runHTTP(w, r, func() {
+				if val, err = s.handlecommand(gatewayClient, []string{"GET", key}); err == nil {
+					expiresAt, err = s.handlecommand(gatewayClient, []string{"PEXPIRETIME", key})
+				}
+			}) {
+				return
+			}
+			if err != cache.ErrNoSuchKey || loaded || !s.cache.HasLoader() {
+				break
+			}
+			if err = s.loadThrough(r.Context(), key); err != nil {
+				break
+			}
+		}
+		if err != nil {
+			writeHTTPError(w, httpStatus(err), err)
+			return
+		}
+
+		body := keyBody{Key: key, Value: string(val.(Bulk))}
+		body.TTL = ttlSeconds(int64(expiresAt.(Int)))
+		writeHTTPJSON(w, http.StatusOK, body)
+
+	case http.MethodPut:
+		var body keyBody
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeHTTPError(w, http.StatusBadRequest, err)
+			return
+		}
+		if body.TTL < 0 {
+			writeHTTPError(w, http.StatusBadRequest, errors.New("invalid TTl"))
+			return
+		}
+
+		args := []string{"SET", key, body.Value}
+		if body.TTL > 0 {
+			args = append(args, strconv.FormatInt(body.TTL, 10))
+		}
+		var err error
+		if !s.runHTTP(w, r, func() { _, err = s.handlecommand(gatewayClient, args) }) {
+			return
+		}
+		if err != nil {
+			writeHTTPError(w, httpStatus(err), err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	case http.MethodDelete:
+		var (
+			exists Reply
+			err    error
+		)
+		if !s.runHTTP(w, r, func() {
+			exists, err = s.handlecommand(gatewayClient, []string{"HAS", key})
+			switch {
+			case err != nil:
+			case exists != Status("Yes"):
+				err = cache.ErrNoSuchKey
+			default:
+				_, err = s.handlecommand(gatewayClient, []string{"DEL", key})
+			}
+		}) {
+			return
+		}
+		if err != nil {
+			writeHTTPError(w, httpStatus(err), err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		writeHTTPError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	}
+}
+
+// runHTTP runs fn on the event loop and waits for it, reporting false
+// if the request was cancelled first
+func (s *Server) runHTTP(w http.ResponseWriter, r *http.Request, fn func()) bool {
+	ctx := r.Context()
+	if s.tracer != nil {
+		ctx = httpTraceContext(r)
+	}
+	if err := s.runOnLoop(ctx, fn); err != nil {
+		writeHTTPError(w, http.StatusServiceUnavailable, err)
+		return false
+	}
+	return true
+}
+
+// httpStatus maps the kind of a command error to an HTTP status
+func httpStatus(err error) int {
+	if err == cache.ErrNoSuchKey {
+		return http.StatusNotFound
+	}
+	switch cache.ErrorKind(err) {
+	case cache.KindWrongType:
+		return http.StatusConflict
+	case cache.KindOOM:
+		return http.StatusInsufficientStorage
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// ttlSeconds returns the seconds left before expiresAt, a unix time in
+// milliseconds as returned by PEXPIRETIME, rounded up, or 0 if it is negative
+func ttlSeconds(expiresAt int64) int64 {
+	if expiresAt <= 0 {
+		return 0
+	}
+	ms := time.Until(time.UnixMilli(expiresAt)).Milliseconds()
+	return (ms + 999) / 1000
+}
+
+func writeHTTPError(w http.ResponseWriter, status int, err error) {
+	writeHTTPJSON(w, status, map[string]string{"error": formatError(err)})
+}
+
+func writeHTTPJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println("http:", err)
+	}
+}
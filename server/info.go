@@ -0,0 +1,188 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// serverStats are the counters reported by INFO
+type serverStats struct {
+	startedAt time.Time
+	// connections and commands are the numbers of connections accepted
+	// and of commands run since the server started
+	connections int64
+	commands    int64
+	// quotaRejections is the number of commands refused by the quotas
+	quotaRejections int64
+	// overloadRejections is the number of commands refused under overload
+	overloadRejections int64
+	// protocolErrors is the number of clients disconnected for sending
+	// malformed commands or commands over the protocol limits
+	protocolErrors int64
+	// outputLimitDisconnections is the number of clients disconnected for
+	// exceeding their output buffer limit
+	outputLimitDisconnections int64
+	// rejectedConnections is the number of connections refused by the
+	// CIDR lists and the limit of connections per IP
+	rejectedConnections int64
+	// webhookDropped is the number of events dropped for the webhooks
+	// lagging behind
+	webhookDropped int64
+	// changesDropped is the number of changes dropped for the change sink
+	// lagging behind
+	changesDropped int64
+}
+
+// infoSections are the sections of INFO in the order they are written
+var infoSections = []string{"server", "clients", "memory", "stats", "latencystats", "keyspace", "tenants"}
+
+// handleInfo implements INFO [section [section ...]], writing every
+// section when none is given or for "all", "default" and "everything"
+func (s *Server) handleInfo(args []string) (Reply, error) {
+	want := make(map[string]bool)
+	for _, arg := range args {
+		want[strings.ToLower(arg)] = true
+	}
+	all := len(args) == 0 || want["all"] || want["default"] || want["everything"]
+
+	var b strings.Builder
+	for _, section := range infoSections {
+		if !all && !want[section] {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteString("\r\n")
+		}
+		fmt.Fprintf(&b, "# %s%s\r\n", strings.ToUpper(section[:1]), section[1:])
+		for _, field := range s.infoSection(section) {
+			fmt.Fprintf(&b, "%s:%v\r\n", field.name, field.value)
+		}
+	}
+	return Bulk(b.String()), nil
+}
+
+type infoField struct {
+	name  string
+	value any
+}
+
+func (s *Server) infoSection(section string) []infoField {
+	switch section {
+	case "server":
+		api := "epoll"
+		if runtime.GOOS == "darwin" {
+			api = "kqueue"
+		}
+		return []infoField{
+			{"go_version", runtime.Version()},
+			{"multiplexing_api", api},
+			{"process_id", os.Getpid()},
+			{"tcp_port", s.Port},
+			{"uptime_in_seconds", int64(time.Since(s.stats.startedAt) / time.Second)},
+		}
+
+	case "clients":
+		pubsub := 0
+		for _, c := range s.clients {
+			if c.pubsub.count() > 0 {
+				pubsub++
+			}
+		}
+		return []infoField{
+			{"connected_clients", len(s.clients)},
+			{"blocked_clients", len(s.blocked)},
+			{"pubsub_clients", pubsub},
+		}
+
+	case "memory":
+		var m runtime.MemStats
+		runtime.ReadMemStats(&m)
+		lazyFree := s.cache.LazyFreeStats()
+		spill := s.cache.SpillStats()
+		slabs := s.cache.EntrySlabStats()
+		defragRunning := 0
+		if s.defrag.running {
+			defragRunning = 1
+		}
+		var historyVersions, historyBytes int
+		if s.history != nil {
+			historyVersions, historyBytes = s.history.versions, s.history.bytes
+		}
+		return []infoField{
+			{"used_memory", m.HeapAlloc},
+			{"used_memory_sys", m.Sys},
+			{"mem_fragmentation_ratio", fmt.Sprintf("%.2f", s.defrag.ratio)},
+			{"mem_fragmentation_bytes", s.defrag.bytes},
+			{"active_defrag_running", defragRunning},
+			{"used_memory_keys_strings", s.cache.Stats().Bytes},
+			{"lazyfree_pending_objects", lazyFree.Pending},
+			{"lazyfreed_objects", lazyFree.Freed},
+			{"entry_slabs", slabs.Slabs},
+			{"entry_slab_free", slabs.Free},
+			{"spilled_keys", spill.Values},
+			{"spilled_bytes", spill.Bytes},
+			{"total_spilled_keys", spill.Spilled},
+			{"spill_faults", spill.Faults},
+			{"history_versions", historyVersions},
+			{"history_bytes", historyBytes},
+		}
+
+	case "stats":
+		cacheStats := s.cache.Stats()
+		defrag := s.cache.DefragStats()
+		scrub := s.cache.ScrubStats()
+		return []infoField{
+			{"total_connections_received", s.stats.connections},
+			{"total_commands_processed", s.stats.commands},
+			{"keyspace_hits", cacheStats.Hits},
+			{"keyspace_misses", cacheStats.Misses},
+			{"keyspace_hit_ratio", fmt.Sprintf("%.4f", cacheStats.HitRatio())},
+			{"expired_keys", cacheStats.Expired},
+			{"evicted_keys", cacheStats.Evicted},
+			{"quota_rejections", s.stats.quotaRejections},
+			{"overload_rejections", s.stats.overloadRejections},
+			{"reply_cache_hits", s.replyCache.hits},
+			{"reply_cache_misses", s.replyCache.misses},
+			{"webhook_events_posted", s.webhookPosted.Load()},
+			{"webhook_events_failed", s.webhookFailed.Load()},
+			{"webhook_events_dropped", s.stats.webhookDropped},
+			{"cdc_changes_published", s.changesPublished.Load()},
+			{"cdc_changes_dropped", s.stats.changesDropped},
+			{"total_protocol_errors", s.stats.protocolErrors},
+			{"client_output_buffer_limit_disconnections", s.stats.outputLimitDisconnections},
+			{"rejected_connections", s.stats.rejectedConnections},
+			{"pubsub_channels", len(s.channels)},
+			{"pubsub_patterns", len(s.patterns)},
+			{"pubsubshard_channels", len(s.shardChannels)},
+			{"slowlog_len", len(s.slowlog.entries)},
+			{"expire_cycle_interval_ms", s.expireInterval.Milliseconds()},
+			{"active_defrag_hits", defrag.Reallocated},
+			{"active_defrag_passes", defrag.Passes},
+			{"scrub_keys_checked", scrub.Checked},
+			{"scrub_expired_keys", scrub.Expired},
+			{"scrub_problems", scrub.Problems},
+			{"scrub_passes", scrub.Passes},
+			{"scrub_pass_keys", scrub.Visited},
+			{"scrub_last_problem", s.lastScrubProblem},
+		}
+
+	case "latencystats":
+		return s.latencyStatsInfo()
+
+	case "keyspace":
+		keys := s.cache.Len()
+		if keys == 0 {
+			return nil
+		}
+		return []infoField{
+			{"db0", fmt.Sprintf("keys=%d,expires=%d", keys, s.cache.VolatileLen())},
+		}
+
+	case "tenants":
+		return s.tenantsInfo()
+	}
+	return nil
+}
@@ -6,6 +6,9 @@ import (
 	"time"
 )
 
+// epollET is EPOLLET, which the syscall package declares as a negative constant
+const epollET = 1 << 31
+
 // Epoll implements the IOMultiplexer interface for Linux-based systems
 type Epoll struct {
 	// fd stores the file descriptor of the epoll instance
@@ -15,10 +18,12 @@ type Epoll struct {
 	// events stores the events after they are converted to the generic Event type
 	// and is returned to the caller
 	events []Event
+	// edgeTriggered is set to subscribe the events with EPOLLET
+	edgeTriggered bool
 }
 
 // New creates a new Epoll instance
-func New(maxClients int) (*Epoll, error) {
+func New(maxClients int, opts ...Option) (*Epoll, error) {
 	if maxClients < 0 {
 		return nil, ErrInvalidMaxClients
 	}
@@ -29,21 +34,40 @@ func New(maxClients int) (*Epoll, error) {
 	}
 
 	return &Epoll{
-		fd:          fd,
-		ePollEvents: make([]syscall.EpollEvent, maxClients),
-		events:      make([]Event, maxClients),
+		fd:            fd,
+		ePollEvents:   make([]syscall.EpollEvent, maxClients),
+		events:        make([]Event, maxClients),
+		edgeTriggered: newOptions(opts).edgeTriggered,
 	}, nil
 }
 
 // Subscribe subscribes to the given event
 func (ep *Epoll) Subscribe(event Event) error {
-	nativeEvent := event.toNative()
+	nativeEvent := ep.toNative(event)
 	if err := syscall.EpollCtl(ep.fd, syscall.EPOLL_CTL_ADD, event.Fd, &nativeEvent); err != nil {
 		return fmt.Errorf("epoll subscribe: %w", err)
 	}
 	return nil
 }
 
+// Modify replaces the operations monitored on a subscribed file descriptor
+func (ep *Epoll) Modify(event Event) error {
+	nativeEvent := ep.toNative(event)
+	if err := syscall.EpollCtl(ep.fd, syscall.EPOLL_CTL_MOD, event.Fd, &nativeEvent); err != nil {
+		return fmt.Errorf("epoll modify: %w", err)
+	}
+	return nil
+}
+
+// toNative converts the event, adding EPOLLET in edge triggered mode
+func (ep *Epoll) toNative(event Event) syscall.EpollEvent {
+	nativeEvent := event.toNative()
+	if ep.edgeTriggered {
+		nativeEvent.Events |= epollET
+	}
+	return nativeEvent
+}
+
 // Poll polls for all the subscribed events simultaneously
 // and returns all the events that were triggered
 // It blocks until at least one event is triggered or the timeout is reached
@@ -9,6 +9,10 @@ type IOMultiplexer interface {
 	// When the event is triggered, the Poll method will return it
 	Subscribe(event Event) error
 
+	// Modify replaces the operations monitored on a subscribed
+	// file descriptor with the operations of the given event
+	Modify(event Event) error
+
 	// Poll polls for all the subscribed events simultaneously
 	// and returns all the events that were triggered
 	// It blocks until at least one event is triggered or the timeout is reached
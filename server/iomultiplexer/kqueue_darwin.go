@@ -15,10 +15,13 @@ type KQueue struct {
 	// events stores the events after they are converted to the generic Event type
 	// and is returned to the caller
 	events []Event
+	// clear is EV_CLEAR in edge triggered mode, added to the flags of
+	// every filter so that it is reset once reported
+	clear uint16
 }
 
 // New creates a new KQueue instance
-func New(maxClients int) (*KQueue, error) {
+func New(maxClients int, opts ...Option) (*KQueue, error) {
 	if maxClients < 0 {
 		return nil, ErrInvalidMaxClients
 	}
@@ -28,21 +31,43 @@ func New(maxClients int) (*KQueue, error) {
 		return nil, err
 	}
 
-	return &KQueue{
+	kq := &KQueue{
 		fd:       fd,
 		kQEvents: make([]syscall.Kevent_t, maxClients),
 		events:   make([]Event, maxClients),
-	}, nil
+	}
+	if newOptions(opts).edgeTriggered {
+		kq.clear = syscall.EV_CLEAR
+	}
+	return kq, nil
 }
 
 // Subscribe subscribes to the given event
 func (kq *KQueue) Subscribe(event Event) error {
-	if subscribed, err := syscall.Kevent(kq.fd, []syscall.Kevent_t{event.toNative(syscall.EV_ADD)}, nil, nil); err != nil || subscribed == -1 {
+	if subscribed, err := syscall.Kevent(kq.fd, []syscall.Kevent_t{event.toNative(syscall.EV_ADD | kq.clear)}, nil, nil); err != nil || subscribed == -1 {
 		return fmt.Errorf("kqueue subscribe: %w", err)
 	}
 	return nil
 }
 
+// Modify replaces the operations monitored on a subscribed file descriptor
+// Filters are registered one per operation, disabling those not requested
+func (kq *KQueue) Modify(event Event) error {
+	changes := make([]syscall.Kevent_t, 0, 2)
+	for _, op := range []Operations{OP_READ, OP_WRITE} {
+		flags := syscall.EV_ADD | syscall.EV_DISABLE | kq.clear
+		if event.Op&op != 0 {
+			flags = syscall.EV_ADD | syscall.EV_ENABLE | kq.clear
+		}
+		changes = append(changes, Event{Fd: event.Fd, Op: op}.toNative(flags))
+	}
+
+	if _, err := syscall.Kevent(kq.fd, changes, nil, nil); err != nil {
+		return fmt.Errorf("kqueue modify: %w", err)
+	}
+	return nil
+}
+
 // Poll polls for all the subscribed events simultaneously
 // and returns all the events that were triggered
 // It blocks until at least one event is triggered or the timeout is reached
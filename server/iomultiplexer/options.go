@@ -0,0 +1,26 @@
+package iomultiplexer
+
+// Option configures a multiplexer created with New
+type Option func(*options)
+
+type options struct {
+	edgeTriggered bool
+}
+
+// WithEdgeTriggered makes the multiplexer report a file descriptor only when
+// it becomes ready again, rather than for as long as it stays ready, using
+// EPOLLET on Linux and EV_CLEAR on Darwin. Callers must then read and write
+// until EAGAIN, as the remaining data is not reported again
+func WithEdgeTriggered() Option {
+	return func(o *options) {
+		o.edgeTriggered = true
+	}
+}
+
+func newOptions(opts []Option) options {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
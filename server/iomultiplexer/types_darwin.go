@@ -11,9 +11,8 @@ func newTime(t time.Duration) *syscall.Timespec {
 		return nil
 	}
 
-	return &syscall.Timespec{
-		Nsec: int64(t),
-	}
+	ts := syscall.NsecToTimespec(int64(t))
+	return &ts
 }
 
 // toNative converts the given generic Event to Darwin's Kevent_t struct
@@ -48,15 +47,13 @@ func (op Operations) toNative() int16 {
 }
 
 // newOperations converts the given Darwin's filter type to the generic Operations type
+// Filters are distinct values rather than bit flags, each kevent holding one
 func newOperations(filter int16) Operations {
-	op := Operations(0)
-
-	if filter&syscall.EVFILT_READ != 0 {
-		op |= OP_READ
+	switch filter {
+	case syscall.EVFILT_READ:
+		return OP_READ
+	case syscall.EVFILT_WRITE:
+		return OP_WRITE
 	}
-	if filter&syscall.EVFILT_WRITE != 0 {
-		op |= OP_WRITE
-	}
-
-	return op
+	return 0
 }
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"strings"
+)
+
+// handleJSONSet implements JSON.SET key path value [NX | XX], replying nil
+// when nothing was set
+func (s *Server) handleJSONSet(args []string) (Reply, error) {
+	var nx, xx bool
+	switch {
+	case len(args) == 3:
+	case len(args) == 4 && strings.EqualFold(args[3], "NX"):
+		nx = true
+	case len(args) == 4 && strings.EqualFold(args[3], "XX"):
+		xx = true
+	default:
+		return nil, ErrSyntax
+	}
+
+	set, err := s.cache.JSONSet(args[0], args[1], []byte(args[2]), nx, xx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logCommand("JSON.SET %s %s %v\n", args[0], args[1], set)
+	if !set {
+		return Nil, nil
+	}
+	return OK, nil
+}
+
+// handleJSONGet implements JSON.GET key [path ...]
+func (s *Server) handleJSONGet(args []string) (Reply, error) {
+	val, ok, err := s.cache.JSONGet(args[0], args[1:]...)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return Nil, nil
+	}
+	return Bulk(val), nil
+}
+
+// handleJSONDel implements JSON.DEL key [path], replying with the number
+// of values deleted
+func (s *Server) handleJSONDel(args []string) (Reply, error) {
+	if len(args) > 2 {
+		return nil, ErrSyntax
+	}
+	path := "$"
+	if len(args) == 2 {
+		path = args[1]
+	}
+
+	n, err := s.cache.JSONDel(args[0], path)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logCommand("JSON.DEL %s %s %d\n", args[0], path, n)
+	return Int(n), nil
+}
+
+// handleJSONType implements JSON.TYPE key [path], replying with the type
+// of the value at a legacy path and the array of the types of the values
+// matched by a JSONPath
+func (s *Server) handleJSONType(args []string) (Reply, error) {
+	if len(args) > 2 {
+		return nil, ErrSyntax
+	}
+	path := "."
+	if len(args) == 2 {
+		path = args[1]
+	}
+
+	types, legacy, err := s.cache.JSONType(args[0], path)
+	if err != nil {
+		return nil, err
+	}
+	if !legacy {
+		return bulks(types), nil
+	}
+	if len(types) == 0 {
+		return Nil, nil
+	}
+	return Status(types[0]), nil
+}
@@ -0,0 +1,186 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// latencyHistoryLen is the number of samples kept per event, as in Redis
+const latencyHistoryLen = 160
+
+// The events whose latency is monitored
+const (
+	latencyCommand     = "command"
+	latencyExpireCycle = "expire-cycle"
+)
+
+// latencySample is the worst latency of an event within a second
+type latencySample struct {
+	at time.Time
+	ms int64
+}
+
+// latencyEvent holds the latest samples of an event in a ring buffer
+type latencyEvent struct {
+	samples [latencyHistoryLen]latencySample
+	// next is the index of the next sample and count the number of
+	// samples held
+	next, count int
+	maxMs       int64
+}
+
+// history returns the samples of the event, oldest first
+func (e *latencyEvent) history() []latencySample {
+	samples := make([]latencySample, 0, e.count)
+	for i := e.count; i > 0; i-- {
+		samples = append(samples, e.samples[(e.next-i+latencyHistoryLen)%latencyHistoryLen])
+	}
+	return samples
+}
+
+func (e *latencyEvent) latest() latencySample {
+	return e.samples[(e.next-1+latencyHistoryLen)%latencyHistoryLen]
+}
+
+// monitorLatency records that event took d if it reached the latency
+// monitor threshold. The spikes of the same second are merged into a
+// sample of the worst of them
+func (s *Server) monitorLatency(event string, d time.Duration) {
+	if s.LatencyMonitorThreshold <= 0 || d < s.LatencyMonitorThreshold {
+		return
+	}
+
+	e, ok := s.latency[event]
+	if !ok {
+		e = &latencyEvent{}
+		s.latency[event] = e
+	}
+	now := time.Now().Truncate(time.Second)
+	ms := d.Milliseconds()
+	if ms > e.maxMs {
+		e.maxMs = ms
+	}
+	if e.count > 0 && e.latest().at.Equal(now) {
+		if last := &e.samples[(e.next-1+latencyHistoryLen)%latencyHistoryLen]; ms > last.ms {
+			last.ms = ms
+		}
+		return
+	}
+
+	e.samples[e.next] = latencySample{at: now, ms: ms}
+	e.next = (e.next + 1) % latencyHistoryLen
+	if e.count < latencyHistoryLen {
+		e.count++
+	}
+}
+
+// handleLatency implements LATENCY LATEST | HISTORY event |
+// RESET [event ...] | DOCTOR | HISTOGRAM [command ...]
+func (s *Server) handleLatency(args []string) (Reply, error) {
+	switch strings.ToUpper(args[0]) {
+	case "LATEST":
+		r := Array{}
+		for _, name := range s.latencyEvents() {
+			e := s.latency[name]
+			latest := e.latest()
+			r = append(r, Array{Bulk(name), Int(latest.at.Unix()), Int(latest.ms), Int(e.maxMs)})
+		}
+		return r, nil
+
+	case "HISTORY":
+		r := Array{}
+		if e, ok := s.latency[args[1]]; ok {
+			for _, sample := range e.history() {
+				r = append(r, Array{Int(sample.at.Unix()), Int(sample.ms)})
+			}
+		}
+		return r, nil
+
+	case "RESET":
+		if len(args) == 1 {
+			n := len(s.latency)
+			s.latency = make(map[string]*latencyEvent)
+			return Int(n), nil
+		}
+		n := 0
+		for _, name := range args[1:] {
+			if _, ok := s.latency[name]; ok {
+				delete(s.latency, name)
+				n++
+			}
+		}
+		return Int(n), nil
+
+	case "DOCTOR":
+		return Bulk(s.latencyDoctor()), nil
+
+	case "HISTOGRAM":
+		return s.handleLatencyHistogram(args[1:]), nil
+
+	default:
+		return nil, fmt.Errorf("unknown subcommand '%s'", args[0])
+	}
+}
+
+func (s *Server) latencyEvents() []string {
+	names := make([]string, 0, len(s.latency))
+	for name := range s.latency {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// latencyDoctor writes a report of the latency spikes of each event, with
+// advice on their likely causes
+func (s *Server) latencyDoctor() string {
+	if s.LatencyMonitorThreshold <= 0 {
+		return "The latency monitor is disabled. Start the server with -latency-monitor-threshold " +
+			"to record the events taking at least that long.\n"
+	}
+	if len(s.latency) == 0 {
+		return "No latency spike was observed since the server started or the latest LATENCY RESET.\n"
+	}
+
+	var b strings.Builder
+	b.WriteString("Latency spikes were observed for the following events:\n\n")
+	for i, name := range s.latencyEvents() {
+		e := s.latency[name]
+		samples := e.history()
+
+		var sum int64
+		for _, sample := range samples {
+			sum += sample.ms
+		}
+		avg := float64(sum) / float64(len(samples))
+		var dev float64
+		for _, sample := range samples {
+			d := float64(sample.ms) - avg
+			if d < 0 {
+				d = -d
+			}
+			dev += d
+		}
+		dev /= float64(len(samples))
+		period := samples[len(samples)-1].at.Sub(samples[0].at) / time.Second
+		if len(samples) > 1 {
+			period /= time.Duration(len(samples) - 1)
+		}
+
+		fmt.Fprintf(&b, "%d. %s: %d latency spikes (average %.0fms, mean deviation %.0fms, period %d sec). Worst all time event %dms.\n",
+			i+1, name, len(samples), avg, dev, period, e.maxMs)
+	}
+
+	b.WriteString("\nAdvice:\n\n")
+	if _, ok := s.latency[latencyCommand]; ok {
+		b.WriteString("- Commands are taking long to run. Check SLOWLOG GET for the commands that are too slow " +
+			"and prefer commands working on a bounded number of elements, as every command blocks the event loop.\n")
+	}
+	if _, ok := s.latency[latencyExpireCycle]; ok {
+		b.WriteString("- Deleting the expired keys is blocking the event loop. Many keys may be expiring at the same time: " +
+			"spread their TTLs, for instance with -ttl-jitter, and free big values lazily.\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,157 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"sort"
+	"strings"
+	"time"
+)
+
+// latencyHistogram counts durations in microseconds in log-linear buckets
+// like HdrHistogram: the values below latencySubBuckets have a bucket each
+// and every power of two range above is split into latencySubBuckets
+// buckets, so that a value is known to within 1/latencySubBuckets
+type latencyHistogram struct {
+	counts [(64 - latencySubBucketBits + 1) * latencySubBuckets]uint64
+	total  uint64
+}
+
+const (
+	latencySubBucketBits = 4
+	latencySubBuckets    = 1 << latencySubBucketBits
+)
+
+// latencyPercentiles are the percentiles reported by INFO latencystats, as
+// in Redis
+var latencyPercentiles = []float64{50, 99, 99.9}
+
+func latencyBucket(v uint64) int {
+	if v < latencySubBuckets {
+		return int(v)
+	}
+	shift := bits.Len64(v) - latencySubBucketBits - 1
+	return (shift+1)*latencySubBuckets + int(v>>shift) - latencySubBuckets
+}
+
+// latencyBucketMax returns the largest value counted in the bucket i
+func latencyBucketMax(i int) uint64 {
+	if i < latencySubBuckets {
+		return uint64(i)
+	}
+	shift := i/latencySubBuckets - 1
+	m := uint64(i%latencySubBuckets + latencySubBuckets)
+	return (m+1)<<shift - 1
+}
+
+func (h *latencyHistogram) record(d time.Duration) {
+	us := d.Microseconds()
+	if us < 0 {
+		us = 0
+	}
+	h.counts[latencyBucket(uint64(us))]++
+	h.total++
+}
+
+// percentile returns the value at or below which p percent of the values
+// recorded are
+func (h *latencyHistogram) percentile(p float64) uint64 {
+	target := uint64(math.Ceil(p / 100 * float64(h.total)))
+	if target == 0 {
+		target = 1
+	}
+	var seen uint64
+	for i, n := range h.counts {
+		if seen += n; seen >= target {
+			return latencyBucketMax(i)
+		}
+	}
+	return 0
+}
+
+// cumulative returns the number of values recorded below each power of
+// two from the first below which there are any up to the first below
+// which they all are
+func (h *latencyHistogram) cumulative() ([]uint64, []uint64) {
+	var bounds, counts []uint64
+	var seen uint64
+	i := 0
+	for bound := uint64(1); ; bound <<= 1 {
+		for ; i < len(h.counts) && latencyBucketMax(i) < bound; i++ {
+			seen += h.counts[i]
+		}
+		if seen > 0 {
+			bounds = append(bounds, bound)
+			counts = append(counts, seen)
+		}
+		if seen == h.total || bound == 1<<63 {
+			return bounds, counts
+		}
+	}
+}
+
+// recordCommandLatency counts the duration of a call to cmd in its
+// histogram
+func (s *Server) recordCommandLatency(cmd *Command, d time.Duration) {
+	h, ok := s.latencyStats[cmd.Name]
+	if !ok {
+		h = &latencyHistogram{}
+		s.latencyStats[cmd.Name] = h
+	}
+	h.record(d)
+}
+
+// latencyStatsCommands returns the names of the commands called, sorted
+func (s *Server) latencyStatsCommands() []string {
+	names := make([]string, 0, len(s.latencyStats))
+	for name := range s.latencyStats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// latencyStatsInfo returns the fields of INFO latencystats, one per
+// command called, such as
+// latency_percentiles_usec_get:p50=1.000,p99=2.000,p99.9=7.000
+func (s *Server) latencyStatsInfo() []infoField {
+	var fields []infoField
+	for _, name := range s.latencyStatsCommands() {
+		h := s.latencyStats[name]
+		values := make([]string, len(latencyPercentiles))
+		for i, p := range latencyPercentiles {
+			values[i] = fmt.Sprintf("p%g=%.3f", p, float64(h.percentile(p)))
+		}
+		fields = append(fields, infoField{"latency_percentiles_usec_" + strings.ToLower(name), strings.Join(values, ",")})
+	}
+	return fields
+}
+
+// handleLatencyHistogram implements LATENCY HISTOGRAM [command ...],
+// replying for each command called, all of them by default, with its
+// number of calls and the number of calls that took less than each power
+// of two microseconds
+func (s *Server) handleLatencyHistogram(args []string) Reply {
+	names := s.latencyStatsCommands()
+	if len(args) > 0 {
+		names = names[:0]
+		for _, arg := range args {
+			if _, ok := s.latencyStats[strings.ToUpper(arg)]; ok {
+				names = append(names, strings.ToUpper(arg))
+			}
+		}
+	}
+
+	r := Array{}
+	for _, name := range names {
+		h := s.latencyStats[name]
+		bounds, counts := h.cumulative()
+		histogram := make(Array, 0, 2*len(bounds))
+		for i, bound := range bounds {
+			histogram = append(histogram, Int(bound), Int(counts[i]))
+		}
+		r = append(r, Bulk(strings.ToLower(name)), Array{Bulk("calls"), Int(h.total), Bulk("histogram_usec"), histogram})
+	}
+	return r
+}
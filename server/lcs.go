@@ -0,0 +1,147 @@
+package server
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/KavetiRohith/go-cache/cache"
+)
+
+// handleLCS implements LCS key1 key2 [LEN] [IDX] [MINMATCHLEN len]
+// [WITHMATCHLEN], the missing keys holding empty strings
+func (s *Server) handleLCS(args []string) (Reply, error) {
+	var (
+		getLen, getIdx, withMatchLen bool
+		minMatchLen                  int
+	)
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "LEN":
+			getLen = true
+		case "IDX":
+			getIdx = true
+		case "WITHMATCHLEN":
+			withMatchLen = true
+		case "MINMATCHLEN":
+			if i+1 == len(args) {
+				return nil, ErrSyntax
+			}
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil {
+				return nil, cache.ErrNotInteger
+			}
+			if n > 0 {
+				minMatchLen = n
+			}
+			i++
+		default:
+			return nil, ErrSyntax
+		}
+	}
+	if getLen && getIdx {
+		return nil, errors.New("If you want both the length and indexes, please just use IDX.")
+	}
+
+	a, err := s.lcsString(args[0])
+	if err != nil {
+		return nil, err
+	}
+	b, err := s.lcsString(args[1])
+	if err != nil {
+		return nil, err
+	}
+	if (int64(len(a))+1)*(int64(len(b))+1)*4 > int64(s.ProtoMaxBulkLen) {
+		return nil, errors.New("Insufficient memory, transient memory for LCS exceeds proto-max-bulk-len")
+	}
+
+	lcs, matches := longestCommonSubsequence(a, b)
+	s.logCommand("LCS %s %s %d\n", args[0], args[1], len(lcs))
+	switch {
+	case getLen:
+		return Int(len(lcs)), nil
+	case !getIdx:
+		return Bulk(lcs), nil
+	}
+
+	r := Array{}
+	for _, m := range matches {
+		if m.len < minMatchLen {
+			continue
+		}
+		match := Array{
+			Array{Int(m.a), Int(m.a + m.len - 1)},
+			Array{Int(m.b), Int(m.b + m.len - 1)},
+		}
+		if withMatchLen {
+			match = append(match, Int(m.len))
+		}
+		r = append(r, match)
+	}
+	return Array{Bulk("matches"), r, Bulk("len"), Int(len(lcs))}, nil
+}
+
+// lcsString returns the string stored at key, empty if the key is missing
+func (s *Server) lcsString(key string) ([]byte, error) {
+	val, err := s.cache.Get(key)
+	if err == cache.ErrNoSuchKey {
+		return nil, nil
+	}
+	return val, err
+}
+
+// lcsMatch is a range of len bytes common to the strings, starting at a
+// in the first one and at b in the second one
+type lcsMatch struct {
+	a, b, len int
+}
+
+// longestCommonSubsequence returns the longest common subsequence of a
+// and b, along with the ranges of contiguous bytes it is made of, from the
+// last to the first as Redis returns them
+func longestCommonSubsequence(a, b []byte) ([]byte, []lcsMatch) {
+	// dp[i*(len(b)+1)+j] is the length of the LCS of a[:i] and b[:j]
+	width := len(b) + 1
+	dp := make([]uint32, (len(a)+1)*width)
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			switch {
+			case a[i-1] == b[j-1]:
+				dp[i*width+j] = dp[(i-1)*width+j-1] + 1
+			case dp[(i-1)*width+j] > dp[i*width+j-1]:
+				dp[i*width+j] = dp[(i-1)*width+j]
+			default:
+				dp[i*width+j] = dp[i*width+j-1]
+			}
+		}
+	}
+
+	n := dp[len(a)*width+len(b)]
+	lcs := make([]byte, n)
+	var (
+		matches []lcsMatch
+		current *lcsMatch
+	)
+	for i, j := len(a), len(b); i > 0 && j > 0; {
+		if a[i-1] == b[j-1] {
+			n--
+			lcs[n] = a[i-1]
+			i, j = i-1, j-1
+			if current != nil && current.a == i+1 && current.b == j+1 {
+				current.a, current.b, current.len = i, j, current.len+1
+				continue
+			}
+			matches = append(matches, lcsMatch{a: i, b: j, len: 1})
+			current = &matches[len(matches)-1]
+			continue
+		}
+
+		current = nil
+		if dp[(i-1)*width+j] > dp[i*width+j-1] {
+			i--
+		} else {
+			j--
+		}
+	}
+	return lcs, matches
+}
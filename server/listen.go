@@ -0,0 +1,196 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+
+	syscall "golang.org/x/sys/unix"
+)
+
+// listen creates the non blocking socket listening on Host and Port, or
+// takes the one passed by systemd with Systemd, setting Port to its port
+func (s *Server) listen(backlog int) (int, error) {
+	if s.Systemd {
+		fd, err := activatedListener()
+		if err != nil {
+			return -1, err
+		}
+		if fd >= 0 {
+			if port, err := boundPort(fd); err == nil {
+				s.Port = port
+			}
+			return fd, nil
+		}
+	}
+
+	sa, dualStack, err := resolveBindAddr(s.Host, s.Port)
+	if err != nil {
+		return -1, err
+	}
+
+	fd, err := s.bind(sa, dualStack)
+	if err != nil && dualStack {
+		// IPv6 is not available, listen on every IPv4 address instead
+		fd, err = s.bind(&syscall.SockaddrInet4{Port: s.Port}, false)
+	}
+	if err != nil {
+		return -1, err
+	}
+
+	if err := syscall.Listen(fd, backlog); err != nil {
+		syscall.Close(fd)
+		return -1, err
+	}
+
+	// port 0 lets the kernel pick a free port, which Port is set to
+	if s.Port == 0 {
+		port, err := boundPort(fd)
+		if err != nil {
+			syscall.Close(fd)
+			return -1, err
+		}
+		s.Port = port
+	}
+	return fd, nil
+}
+
+// boundPort returns the port a socket is bound to
+func boundPort(fd int) (int, error) {
+	sa, err := syscall.Getsockname(fd)
+	if err != nil {
+		return 0, err
+	}
+	switch sa := sa.(type) {
+	case *syscall.SockaddrInet4:
+		return sa.Port, nil
+	case *syscall.SockaddrInet6:
+		return sa.Port, nil
+	}
+	return 0, nil
+}
+
+// bind creates a socket of the family of sa and binds it to sa,
+// accepting IPv4 connections on an IPv6 socket if dualStack is set
+func (s *Server) bind(sa syscall.Sockaddr, dualStack bool) (int, error) {
+	family := syscall.AF_INET
+	if _, ok := sa.(*syscall.SockaddrInet6); ok {
+		family = syscall.AF_INET6
+	}
+
+	fd, err := syscall.Socket(family, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		return -1, err
+	}
+	if err := s.setListenOpts(fd, family, dualStack); err != nil {
+		syscall.Close(fd)
+		return -1, err
+	}
+	if err := syscall.Bind(fd, sa); err != nil {
+		syscall.Close(fd)
+		return -1, err
+	}
+	return fd, nil
+}
+
+func (s *Server) setListenOpts(fd, family int, dualStack bool) error {
+	// Set the Socket operate in a non-blocking mode
+	if err := syscall.SetNonblock(fd, true); err != nil {
+		return err
+	}
+
+	// Allow restarting while connections of the previous run linger
+	if err := syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1); err != nil {
+		return err
+	}
+	if s.ReusePort {
+		if err := syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_REUSEPORT, 1); err != nil {
+			return err
+		}
+	}
+
+	if family == syscall.AF_INET6 {
+		v6Only := 1
+		if dualStack {
+			v6Only = 0
+		}
+		if err := syscall.SetsockoptInt(fd, syscall.IPPROTO_IPV6, syscall.IPV6_V6ONLY, v6Only); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveBindAddr returns the address to listen on for host, which may be
+// an IPv4 or IPv6 address, possibly with a zone, or a hostname, bound to
+// its first IPv4 address or else its first IPv6 one. An empty host, "*"
+// or "::" listen on every address, over IPv4 and IPv6 alike
+func resolveBindAddr(host string, port int) (syscall.Sockaddr, bool, error) {
+	if port < 0 || port > 65535 {
+		return nil, false, fmt.Errorf("invalid port %d", port)
+	}
+
+	switch host {
+	case "", "*", "::":
+		return &syscall.SockaddrInet6{Port: port}, true, nil
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		ips, err := net.LookupIP(host)
+		if err != nil {
+			return nil, false, err
+		}
+		if len(ips) == 0 {
+			return nil, false, fmt.Errorf("no address found for host %s", host)
+		}
+
+		ip := ips[0]
+		for _, candidate := range ips {
+			if candidate.To4() != nil {
+				ip = candidate
+				break
+			}
+		}
+		addr, _ = netip.AddrFromSlice(ip)
+	}
+	addr = addr.Unmap()
+
+	if addr.Is4() {
+		return &syscall.SockaddrInet4{Port: port, Addr: addr.As4()}, false, nil
+	}
+
+	sa := &syscall.SockaddrInet6{Port: port, Addr: addr.As16()}
+	if zone := addr.Zone(); zone != "" {
+		if index, err := strconv.Atoi(zone); err == nil {
+			sa.ZoneId = uint32(index)
+		} else {
+			ifi, err := net.InterfaceByName(zone)
+			if err != nil {
+				return nil, false, err
+			}
+			sa.ZoneId = uint32(ifi.Index)
+		}
+	}
+	return sa, false, nil
+}
+
+// sockaddrString formats the address of a peer as host:port, IPv4 peers of
+// a dual stack socket being shown as IPv4 addresses
+func sockaddrString(sa syscall.Sockaddr) string {
+	switch sa := sa.(type) {
+	case *syscall.SockaddrInet4:
+		return netip.AddrPortFrom(netip.AddrFrom4(sa.Addr), uint16(sa.Port)).String()
+	case *syscall.SockaddrInet6:
+		addr := netip.AddrFrom16(sa.Addr).Unmap()
+		if sa.ZoneId != 0 && addr.Is6() {
+			if ifi, err := net.InterfaceByIndex(int(sa.ZoneId)); err == nil {
+				addr = addr.WithZone(ifi.Name)
+			}
+		}
+		return netip.AddrPortFrom(addr, uint16(sa.Port)).String()
+	default:
+		return ""
+	}
+}
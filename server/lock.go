@@ -0,0 +1,104 @@
+package server
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KavetiRohith/go-cache/cache"
+)
+
+// handleLock implements LOCK key token <ttl | PXAT unix-time-milliseconds>,
+// with ttl in milliseconds, replying OK when the lock was taken and nil when
+// another token holds it
+func (s *Server) handleLock(args []string) (Reply, error) {
+	var expiresAt int64
+	switch len(args) {
+	case 3:
+		ttl, err := strconv.ParseInt(args[2], 10, 64)
+		if err != nil || ttl <= 0 {
+			return nil, errors.New("invalid expire time in 'lock' command")
+		}
+		expiresAt = s.cache.Now().Add(time.Duration(ttl) * time.Millisecond).UnixMilli()
+	case 4:
+		if !strings.EqualFold(args[2], "PXAT") {
+			return nil, ErrSyntax
+		}
+		at, err := strconv.ParseInt(args[3], 10, 64)
+		if err != nil || at <= 0 {
+			return nil, errors.New("invalid expire time in 'lock' command")
+		}
+		expiresAt = at
+	default:
+		return nil, ErrSyntax
+	}
+
+	ok, err := s.cache.LockAt(args[0], []byte(args[1]), expiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logCommand("LOCK %s %v\n", args[0], ok)
+	if !ok {
+		return Nil, nil
+	}
+	return OK, nil
+}
+
+// handleUnlock implements UNLOCK key token, replying 1 when the lock was
+// released and 0 when it is not held with token
+func (s *Server) handleUnlock(args []string) (Reply, error) {
+	ok, err := s.cache.Unlock(args[0], []byte(args[1]))
+	if err != nil {
+		return nil, err
+	}
+
+	s.logCommand("UNLOCK %s %v\n", args[0], ok)
+	if !ok {
+		return Int(0), nil
+	}
+	return Int(1), nil
+}
+
+// handleCAS implements CAS key expected value, replying with whether the
+// value was swapped and the value the key holds afterwards, the one of the
+// winning writer when another one swapped it first
+func (s *Server) handleCAS(args []string) (Reply, error) {
+	current, swapped, err := s.cache.CompareAndSwap(args[0], []byte(args[1]), []byte(args[2]))
+	if err != nil {
+		return nil, err
+	}
+
+	s.logCommand("CAS %s %v\n", args[0], swapped)
+	var value Reply = Nil
+	if current != nil {
+		value = Bulk(current)
+	}
+	if !swapped {
+		return Array{Int(0), value}, nil
+	}
+	return Array{Int(1), value}, nil
+}
+
+// handleSetIf implements SETIF key condition value, setting the string
+// value of key if the condition holds for the value it holds, and replying
+// with whether it was set and the value the key holds afterwards, as CAS
+// does
+func (s *Server) handleSetIf(args []string) (Reply, error) {
+	cond, err := cache.ParseCondition(args[1])
+	if err != nil {
+		return nil, err
+	}
+	current, set, err := s.cache.SetIf(args[0], cond, []byte(args[2]))
+	if err != nil {
+		return nil, err
+	}
+
+	s.logCommand("SETIF %s %q %v\n", args[0], cond, set)
+	var value Reply = Nil
+	if current != nil {
+		value = Bulk(current)
+	}
+	return Array{boolToInt(set), value}, nil
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// LogCheck summarizes a command log checked by CheckLog
+type LogCheck struct {
+	// Commands counts the commands of the log by upper case name and
+	// Annotations its #TS annotations
+	Commands    map[string]int
+	Annotations int
+	// Keys is the number of distinct keys written by the commands, found at
+	// the key positions of the command table
+	Keys int
+	// Unknown counts the commands that are not built in and BadArity those
+	// with a wrong number of arguments, which would fail when replayed
+	Unknown, BadArity int
+	// Valid is the number of bytes up to the end of the last well formed
+	// command and Size that of the log
+	Valid, Size int64
+	// Err is the error at Valid, nil if the whole log is well formed
+	Err error
+}
+
+// CheckLog validates the structure of a log in the format of an append
+// only file, as replayed by Replay, and counts its commands and keys
+func CheckLog(r io.Reader) LogCheck {
+	check := LogCheck{Commands: make(map[string]int)}
+	written := make(map[string]struct{})
+
+	br := bufio.NewReader(r)
+	for {
+		args, _, n, err := readLogCommand(br)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			check.Err = err
+			rest, _ := io.Copy(io.Discard, br)
+			check.Size = check.Valid + int64(n) + rest
+			break
+		}
+		check.Valid += int64(n)
+		check.Size = check.Valid
+		if args == nil {
+			check.Annotations++
+			continue
+		}
+
+		name := strings.ToUpper(args[0])
+		check.Commands[name]++
+		cmd, ok := builtinCommandNames[name]
+		switch {
+		case !ok:
+			check.Unknown++
+		case cmd.checkArity(args) != nil:
+			check.BadArity++
+		case cmd.hasFlag(FlagWrite):
+			for _, key := range cmd.keys(args) {
+				written[key] = struct{}{}
+			}
+		}
+	}
+	check.Keys = len(written)
+	return check
+}
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/KavetiRohith/go-cache/cache"
+)
+
+const (
+	// LogLevelNotice logs the commands written by the handlers, with their
+	// values unless QuietCommands is set, and the events of the server
+	LogLevelNotice = "notice"
+	// LogLevelDebug also logs every command received with its arguments
+	// and the address of the client, before it runs
+	LogLevelDebug = "debug"
+)
+
+// configParam is a parameter of CONFIG GET and CONFIG SET
+type configParam struct {
+	get func(s *Server) string
+	set func(s *Server, value string) error
+}
+
+// configParams are the parameters changed at runtime by CONFIG SET, which
+// last until the server restarts or reloads its config file
+var configParams = map[string]configParam{
+	"loglevel": {
+		get: func(s *Server) string { return s.LogLevel },
+		set: func(s *Server, value string) error {
+			level := strings.ToLower(value)
+			if err := checkLogLevel(level); err != nil {
+				return err
+			}
+			s.LogLevel = level
+			return nil
+		},
+	},
+	"log-commands": {
+		get: func(s *Server) string { return yesNo(!s.QuietCommands) },
+		set: func(s *Server, value string) error {
+			switch strings.ToLower(value) {
+			case "yes":
+				s.QuietCommands = false
+			case "no":
+				s.QuietCommands = true
+			default:
+				return errors.New("argument must be 'yes' or 'no'")
+			}
+			return nil
+		},
+	},
+}
+
+func checkLogLevel(level string) error {
+	if level != LogLevelNotice && level != LogLevelDebug {
+		return fmt.Errorf("invalid log level %q, must be %s or %s", level, LogLevelNotice, LogLevelDebug)
+	}
+	return nil
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+// handleConfig implements CONFIG GET pattern [pattern ...] | SET parameter
+// value [parameter value ...]
+func (s *Server) handleConfig(args []string) (Reply, error) {
+	switch strings.ToUpper(args[0]) {
+	case "GET":
+		var names []string
+		for name := range configParams {
+			for _, pattern := range args[1:] {
+				if cache.MatchPattern(strings.ToLower(pattern), name) {
+					names = append(names, name)
+					break
+				}
+			}
+		}
+		sort.Strings(names)
+
+		r := make(Array, 0, 2*len(names))
+		for _, name := range names {
+			r = append(r, Bulk(name), Bulk(configParams[name].get(s)))
+		}
+		return r, nil
+
+	case "SET":
+		if len(args)%2 == 0 {
+			return nil, errWrongArgs("config|set")
+		}
+		// every parameter is checked before any is set, for CONFIG SET
+		// to change all of them or none
+		pairs := args[1:]
+		for i := 0; i < len(pairs); i += 2 {
+			if _, ok := configParams[strings.ToLower(pairs[i])]; !ok {
+				return nil, fmt.Errorf("unknown option or number of arguments for CONFIG SET - '%s'", pairs[i])
+			}
+		}
+		old := s.ServerOpts
+		for i := 0; i < len(pairs); i += 2 {
+			if err := configParams[strings.ToLower(pairs[i])].set(s, pairs[i+1]); err != nil {
+				s.ServerOpts = old
+				return nil, fmt.Errorf("CONFIG SET failed (possibly related to argument '%s') - %v", pairs[i], err)
+			}
+		}
+		s.logCommand("CONFIG SET %v\n", pairs)
+		return OK, nil
+
+	default:
+		return nil, fmt.Errorf("unknown subcommand '%s'", args[0])
+	}
+}
+
+// logCommand logs a command served by a handler, as the handler did itself
+// before, unless QuietCommands is set
+func (s *Server) logCommand(format string, v ...interface{}) {
+	if s.QuietCommands {
+		return
+	}
+	log.Output(2, fmt.Sprintf(format, v...))
+}
+
+// logReceived logs the command parts received from client at the debug
+// log level, along with the client library and the request ID the client
+// gave, if any
+func (s *Server) logReceived(client Client, parts []string) {
+	if s.LogLevel != LogLevelDebug {
+		return
+	}
+	addr, annotations := "-", ""
+	if c, ok := s.clients[client.conn.Fd]; ok {
+		addr = c.addr
+		if c.libName != "" || c.libVer != "" {
+			annotations += " lib=" + c.libName + "/" + c.libVer
+		}
+		if c.cmdRequestID != "" {
+			annotations += " reqid=" + c.cmdRequestID
+		}
+	}
+	log.Output(2, fmt.Sprintf("%s%s %q", addr, annotations, parts))
+}
@@ -0,0 +1,345 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/KavetiRohith/go-cache/cache"
+)
+
+const (
+	// memcachedMaxKeyLen is the longest key of the memcached protocol
+	memcachedMaxKeyLen = 250
+	// memcachedMaxRelativeExptime is the largest exptime taken as a number
+	// of seconds, larger ones being unix times as in memcached
+	memcachedMaxRelativeExptime = 30 * 24 * 60 * 60
+)
+
+var errMemcachedLineTooLong = errors.New("line too long")
+
+// startMemcached serves the memcached text protocol on MemcachedAddr in the
+// background. Commands run on the event loop through Post, like those of
+// the HTTP gateway, and are mapped onto the string commands of the cache
+func (s *Server) startMemcached() (net.Listener, error) {
+	ln, err := net.Listen("tcp", s.MemcachedAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			if err != nil {
+				// such as running out of file descriptors
+				log.Println("memcached:", err)
+				time.Sleep(acceptRetryDelay)
+				continue
+			}
+			go s.serveMemcached(conn)
+		}
+	}()
+
+	log.Println("serving the memcached protocol on", ln.Addr())
+	return ln, nil
+}
+
+// serveMemcached serves the commands of a memcached connection in order,
+// writing the replies once no pipelined command is left to read
+func (s *Server) serveMemcached(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReaderSize(conn, DefaultProtoMaxInlineLen)
+	w := bufio.NewWriter(conn)
+
+	for {
+		line, err := r.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			err = errMemcachedLineTooLong
+		}
+		if err != nil {
+			if err != io.EOF {
+				fmt.Fprintf(w, "CLIENT_ERROR %v\r\n", err)
+				w.Flush()
+			}
+			return
+		}
+
+		quit, err := s.memcachedCommand(r, w, strings.Fields(string(line)))
+		if err == nil && (quit || r.Buffered() == 0) {
+			err = w.Flush()
+		}
+		if quit || err != nil {
+			return
+		}
+	}
+}
+
+// memcachedCommand serves a command, reading its data block from r for
+// storage commands, and reports whether the client quit
+func (s *Server) memcachedCommand(r *bufio.Reader, w *bufio.Writer, fields []string) (bool, error) {
+	if len(fields) == 0 {
+		_, err := w.WriteString("ERROR\r\n")
+		return false, err
+	}
+
+	var err error
+	switch cmd := fields[0]; cmd {
+	case "get", "gets":
+		err = s.memcachedGet(w, fields[1:])
+	case "set", "add", "replace":
+		err = s.memcachedStore(r, w, cmd, fields[1:])
+	case "delete":
+		err = s.memcachedDelete(w, fields[1:])
+	case "touch":
+		err = s.memcachedTouch(w, fields[1:])
+	case "flush_all":
+		noreply := len(fields) > 1 && fields[len(fields)-1] == "noreply"
+		s.runOnLoop(context.Background(), func() {
+			_, err = s.handlecommand(gatewayClient, []string{"FLUSHALL"})
+		})
+		err = memcachedReply(w, "OK", err, noreply)
+	case "version":
+		_, err = w.WriteString("VERSION redigo\r\n")
+	case "quit":
+		return true, nil
+	default:
+		_, err = w.WriteString("ERROR\r\n")
+	}
+	return false, err
+}
+
+// memcachedGet implements get and gets <key>*. CAS is not supported, so
+// gets returns 0 as the unique value of every item
+func (s *Server) memcachedGet(w *bufio.Writer, keys []string) error {
+	if len(keys) == 0 {
+		_, err := w.WriteString("ERROR\r\n")
+		return err
+	}
+
+	values := make([]Reply, len(keys))
+	errs := make([]error, len(keys))
+	get := func() {
+		for i, key := range keys {
+			if values[i] == nil {
+				// missing keys and values that are not strings are misses
+				values[i], errs[i] = s.handlecommand(gatewayClient, []string{"GET", key})
+			}
+		}
+	}
+	s.runOnLoop(context.Background(), get)
+
+	if s.cache.HasLoader() {
+		// the keys missing from the cache are loaded concurrently, then
+		// read again
+		var wg sync.WaitGroup
+		for i, key := range keys {
+			if errs[i] != cache.ErrNoSuchKey {
+				continue
+			}
+			wg.Add(1)
+			go func(key string) {
+				defer wg.Done()
+				s.loadThrough(context.Background(), key)
+			}(key)
+		}
+		wg.Wait()
+		s.runOnLoop(context.Background(), get)
+	}
+
+	for i, key := range keys {
+		val, ok := values[i].(Bulk)
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(w, "VALUE %s 0 %d\r\n", key, len(val))
+		w.Write(val)
+		w.WriteString("\r\n")
+	}
+	_, err := w.WriteString("END\r\n")
+	return err
+}
+
+// memcachedStore implements set, add and replace
+// <key> <flags> <exptime> <bytes> [noreply], followed by the data block
+// The flags are not stored, and are returned as 0 by get
+func (s *Server) memcachedStore(r *bufio.Reader, w *bufio.Writer, cmd string, args []string) error {
+	if len(args) != 4 && len(args) != 5 {
+		_, err := w.WriteString("ERROR\r\n")
+		return err
+	}
+	noreply := len(args) == 5 && args[4] == "noreply"
+
+	key := args[0]
+	_, flagsErr := strconv.ParseUint(args[1], 10, 32)
+	exptime, expErr := strconv.ParseInt(args[2], 10, 64)
+	size, sizeErr := strconv.Atoi(args[3])
+	if flagsErr != nil || expErr != nil || sizeErr != nil || size < 0 {
+		_, err := w.WriteString("CLIENT_ERROR bad command line format\r\n")
+		return err
+	}
+	if size > s.ProtoMaxBulkLen {
+		// the data block cannot be skipped safely, so drop the client
+		w.WriteString("SERVER_ERROR object too large for cache\r\n")
+		w.Flush()
+		return errors.New("object too large")
+	}
+
+	data := make([]byte, size+2)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return err
+	}
+	if data[size] != '\r' || data[size+1] != '\n' {
+		_, err := w.WriteString("CLIENT_ERROR bad data chunk\r\n")
+		return err
+	}
+	if err := checkMemcachedKey(key); err != nil {
+		if noreply {
+			return nil
+		}
+		_, err = fmt.Fprintf(w, "CLIENT_ERROR %v\r\n", err)
+		return err
+	}
+
+	var (
+		stored bool
+		err    error
+	)
+	s.runOnLoop(context.Background(), func() {
+		if cmd != "set" {
+			var at Reply
+			if at, err = s.handlecommand(gatewayClient, []string{"PEXPIRETIME", key}); err != nil {
+				return
+			}
+			if exists := at != Int(-2); exists != (cmd == "replace") {
+				return
+			}
+		}
+
+		stored = true
+		ttl, live := memcachedTTL(exptime)
+		switch {
+		case !live:
+			// an item expiring right away replaces the key and is gone
+			_, err = s.handlecommand(gatewayClient, []string{"DEL", key})
+		case ttl > 0:
+			_, err = s.handlecommand(gatewayClient, []string{"SET", key, string(data[:size]), strconv.FormatInt(ttl, 10)})
+		default:
+			_, err = s.handlecommand(gatewayClient, []string{"SET", key, string(data[:size])})
+		}
+	})
+
+	status := "STORED"
+	if !stored {
+		status = "NOT_STORED"
+	}
+	return memcachedReply(w, status, err, noreply)
+}
+
+// memcachedDelete implements delete <key> [noreply]
+func (s *Server) memcachedDelete(w *bufio.Writer, args []string) error {
+	if len(args) != 1 && !(len(args) == 2 && args[1] == "noreply") {
+		_, err := w.WriteString("CLIENT_ERROR bad command line format. Usage: delete <key> [noreply]\r\n")
+		return err
+	}
+
+	status := "NOT_FOUND"
+	var err error
+	s.runOnLoop(context.Background(), func() {
+		var at Reply
+		if at, err = s.handlecommand(gatewayClient, []string{"PEXPIRETIME", args[0]}); err != nil || at == Int(-2) {
+			return
+		}
+		if _, err = s.handlecommand(gatewayClient, []string{"DEL", args[0]}); err == nil {
+			status = "DELETED"
+		}
+	})
+	return memcachedReply(w, status, err, len(args) == 2)
+}
+
+// memcachedTouch implements touch <key> <exptime> [noreply]
+func (s *Server) memcachedTouch(w *bufio.Writer, args []string) error {
+	if len(args) != 2 && !(len(args) == 3 && args[2] == "noreply") {
+		_, err := w.WriteString("ERROR\r\n")
+		return err
+	}
+	exptime, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		_, err := w.WriteString("CLIENT_ERROR invalid exptime argument\r\n")
+		return err
+	}
+
+	status := "NOT_FOUND"
+	s.runOnLoop(context.Background(), func() {
+		var at Reply
+		if at, err = s.handlecommand(gatewayClient, []string{"PEXPIRETIME", args[0]}); err != nil || at == Int(-2) {
+			return
+		}
+
+		ttl, live := memcachedTTL(exptime)
+		switch {
+		case !live:
+			_, err = s.handlecommand(gatewayClient, []string{"DEL", args[0]})
+		case ttl > 0:
+			expiresAt := s.cache.Now().Add(time.Duration(ttl) * time.Second).UnixMilli()
+			_, err = s.handlecommand(gatewayClient, []string{"PEXPIREAT", args[0], strconv.FormatInt(expiresAt, 10)})
+		default:
+			_, err = s.handlecommand(gatewayClient, []string{"GETEX", args[0], "PERSIST"})
+		}
+		if err == nil {
+			status = "TOUCHED"
+		}
+	})
+	return memcachedReply(w, status, err, len(args) == 3)
+}
+
+// memcachedTTL converts an exptime, a number of seconds up to 30 days and
+// a unix time beyond, to a TTL in seconds, 0 meaning no expiry. It reports
+// false for items that expire right away
+func memcachedTTL(exptime int64) (int64, bool) {
+	switch {
+	case exptime < 0:
+		return 0, false
+	case exptime > memcachedMaxRelativeExptime:
+		ttl := exptime - time.Now().Unix()
+		return ttl, ttl > 0
+	default:
+		return exptime, true
+	}
+}
+
+func checkMemcachedKey(key string) error {
+	if len(key) > memcachedMaxKeyLen {
+		return errors.New("key too long")
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < '!' || key[i] == 0x7f {
+			return errors.New("key contains control characters")
+		}
+	}
+	return nil
+}
+
+// memcachedReply writes status, or err as a server error, unless the
+// client asked for no reply
+func memcachedReply(w *bufio.Writer, status string, err error, noreply bool) error {
+	if noreply {
+		return nil
+	}
+	if err != nil {
+		_, err = fmt.Fprintf(w, "SERVER_ERROR %s\r\n", formatError(err))
+		return err
+	}
+	_, err = w.WriteString(status + "\r\n")
+	return err
+}
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// handleMemory implements MEMORY STATS, replying with a flat array of
+// names and values as in Redis
+func (s *Server) handleMemory(args []string) (Reply, error) {
+	if !strings.EqualFold(args[0], "STATS") {
+		return nil, fmt.Errorf("unknown subcommand '%s'", args[0])
+	}
+
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	compression := s.cache.CompressionStats()
+	ratio := 1.0
+	if compression.CompressedBytes > 0 {
+		ratio = float64(compression.RawBytes) / float64(compression.CompressedBytes)
+	}
+
+	names := []string{
+		"total.allocated", "keys.count", "compressed.values",
+		"compressed.raw.bytes", "compressed.bytes", "compression.ratio",
+	}
+	values := []Reply{
+		Int(m.HeapAlloc), Int(s.cache.Len()), Int(compression.Values),
+		Int(compression.RawBytes), Int(compression.CompressedBytes), Bulk(fmt.Sprintf("%.2f", ratio)),
+	}
+
+	r := make(Array, 0, 2*len(names))
+	var text []byte
+	for i, name := range names {
+		r = append(r, Bulk(name), values[i])
+		if i > 0 {
+			text = append(text, '\n')
+		}
+		text = append(text, name+": "...)
+		text = values[i].appendText(text, false)
+	}
+	return withText(r, text), nil
+}
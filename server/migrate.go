@@ -0,0 +1,180 @@
+package server
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KavetiRohith/go-cache/cache"
+)
+
+// migrateConnIdleTimeout is how long a cached MIGRATE connection
+// may stay unused before it is closed by the cron
+const migrateConnIdleTimeout = 10 * time.Second
+
+// migrateConn is a connection to another instance kept open across
+// MIGRATE calls to avoid reconnecting for every key moved
+type migrateConn struct {
+	conn     net.Conn
+	r        *bufio.Reader
+	lastUsed time.Time
+}
+
+// migrateConn returns a pooled connection to addr, dialing one if needed
+func (s *Server) migrateConn(addr string, timeout time.Duration) (*migrateConn, error) {
+	if mc, ok := s.migrateConns[addr]; ok {
+		return mc, nil
+	}
+
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, cache.Errorf(cache.KindIOErr, "error or timeout connecting to the client: %v", err)
+	}
+
+	mc := &migrateConn{conn: conn, r: bufio.NewReader(conn)}
+	s.migrateConns[addr] = mc
+	return mc, nil
+}
+
+// closeMigrateConn closes and forgets the pooled connection to addr
+func (s *Server) closeMigrateConn(addr string) {
+	if mc, ok := s.migrateConns[addr]; ok {
+		mc.conn.Close()
+		delete(s.migrateConns, addr)
+	}
+}
+
+// closeIdleMigrateConns closes the pooled connections that were not
+// used for longer than migrateConnIdleTimeout
+func (s *Server) closeIdleMigrateConns() {
+	for addr, mc := range s.migrateConns {
+		if time.Since(mc.lastUsed) > migrateConnIdleTimeout {
+			s.closeMigrateConn(addr)
+		}
+	}
+}
+
+// handleMigrate implements
+// MIGRATE host port key|"" destination-db timeout [COPY] [REPLACE] [KEYS key [key ...]]
+// Every key is transferred with DUMP/RESTORE over a pooled connection and,
+// unless COPY is given, deleted locally once the target acknowledged it.
+// The keys of KEYS are not at a fixed position for the dispatch to record
+// their writes, so the keys deleted are recorded here
+func (s *Server) handleMigrate(client Client, args []string) (Reply, error) {
+	var (
+		addr     = net.JoinHostPort(args[0], args[1])
+		keys     = []string{args[2]}
+		copyKeys bool
+		replace  bool
+		keysOpt  bool
+	)
+
+	if db, err := strconv.Atoi(args[3]); err != nil || db != 0 {
+		return nil, errors.New("DB index is out of range")
+	}
+	ms, err := strconv.Atoi(args[4])
+	if err != nil || ms < 0 {
+		return nil, errors.New("timeout is not an integer or out of range")
+	}
+	timeout := time.Duration(ms) * time.Millisecond
+	if timeout == 0 {
+		timeout = time.Second
+	}
+
+	for i := 5; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "COPY":
+			copyKeys = true
+		case "REPLACE":
+			replace = true
+		case "KEYS":
+			// inline commands cannot carry an empty argument,
+			// so the literal "" is accepted as well
+			if args[2] != "" && args[2] != `""` {
+				return nil, errors.New(`when using MIGRATE KEYS option, the key argument must be set to the empty string ""`)
+			}
+			keys = args[i+1:]
+			keysOpt = true
+			i = len(args)
+		default:
+			return nil, ErrSyntax
+		}
+	}
+
+	type dumped struct {
+		key, payload string
+		ttl          int64
+	}
+	var toMove []dumped
+	for _, key := range keys {
+		payload, ok, err := s.cache.Dump(key)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+
+		ttl := int64(0)
+		if expiresAt := s.cache.ExpireTime(key); expiresAt > 0 {
+			if ttl = expiresAt - s.cache.Now().UnixMilli(); ttl <= 0 {
+				continue
+			}
+		}
+		toMove = append(toMove, dumped{key, base64.StdEncoding.EncodeToString(payload), ttl})
+	}
+
+	if len(toMove) == 0 {
+		return Status("NOKEY"), nil
+	}
+
+	mc, err := s.migrateConn(addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	mc.lastUsed = time.Now()
+
+	var deleted []string
+	if keysOpt {
+		defer func() {
+			if len(deleted) > 0 {
+				s.keysWritten("MIGRATE", client.conn.Fd, deleted)
+			}
+		}()
+	}
+	for _, d := range toMove {
+		// RESTORE is sent as RESP so that keys may hold any byte
+		args := []string{"RESTORE", d.key, strconv.FormatInt(d.ttl, 10), d.payload}
+		if replace {
+			args = append(args, "REPLACE")
+		}
+
+		mc.conn.SetDeadline(time.Now().Add(timeout))
+		if _, err := mc.conn.Write(appendCommand(nil, args...)); err != nil {
+			s.closeMigrateConn(addr)
+			return nil, cache.Errorf(cache.KindIOErr, "error or timeout writing to target instance: %v", err)
+		}
+
+		resp, err := mc.r.ReadString('\n')
+		if err != nil {
+			s.closeMigrateConn(addr)
+			return nil, cache.Errorf(cache.KindIOErr, "error or timeout reading from target instance: %v", err)
+		}
+		if resp = strings.TrimSpace(resp); resp != "+OK" {
+			return nil, fmt.Errorf("target instance replied with error: %s", strings.TrimPrefix(resp, "-"))
+		}
+
+		if !copyKeys {
+			s.cache.Delete(d.key)
+			deleted = append(deleted, d.key)
+		}
+		s.logCommand("MIGRATE %s %q copy: %v\n", addr, d.key, copyKeys)
+	}
+
+	return OK, nil
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Module extends the server with commands and, through
+// cache.RegisterDataType, data types of its own
+type Module interface {
+	// Name identifies the module in logs and MODULE LIST
+	Name() string
+	// Load registers the commands of the module on s
+	Load(s *Server) error
+}
+
+// modules holds the modules registered at compile time, in registration order
+var modules []Module
+
+// RegisterModule adds a module loaded by every server on Start. It is meant
+// to be called from the init function of the module package, so that
+// importing the package for its side effects enables the module
+func RegisterModule(m Module) {
+	modules = append(modules, m)
+}
+
+// loadModules loads every registered module, failing on the first error
+func (s *Server) loadModules() error {
+	for _, m := range modules {
+		if err := m.Load(s); err != nil {
+			return fmt.Errorf("loading module %s: %w", m.Name(), err)
+		}
+		s.modules = append(s.modules, m)
+		log.Println("loaded module", m.Name())
+	}
+	return nil
+}
+
+// handleModule implements MODULE LIST, replying one module name per line
+func (s *Server) handleModule(args []string) (Reply, error) {
+	if !strings.EqualFold(args[0], "LIST") {
+		return nil, fmt.Errorf("unknown subcommand '%s'", args[0])
+	}
+
+	names := make(Array, len(s.modules))
+	for i, m := range s.modules {
+		names[i] = Bulk(m.Name())
+	}
+	return names, nil
+}
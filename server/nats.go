@@ -0,0 +1,131 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// natsTimeout bounds the connection to the NATS server and every publish
+const natsTimeout = 5 * time.Second
+
+// natsSink is a ChangeSink publishing every change as a JSON message on a
+// NATS subject, speaking the NATS text protocol on a single connection
+// dialed again once lost
+type natsSink struct {
+	addr    string
+	subject string
+	conn    net.Conn
+	r       *bufio.Reader
+}
+
+// NewNATSSink returns a ChangeSink publishing the changes as JSON messages
+// on subject to the NATS server at natsURL, as nats://host:port or
+// host:port. Every batch is flushed with a PING, so that it is published
+// once the server answered its PONG
+func NewNATSSink(natsURL, subject string) (ChangeSink, error) {
+	addr := natsURL
+	if strings.Contains(natsURL, "://") {
+		u, err := url.Parse(natsURL)
+		if err != nil || u.Scheme != "nats" || u.Host == "" {
+			return nil, fmt.Errorf("invalid NATS URL %q", natsURL)
+		}
+		addr = u.Host
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "4222")
+	}
+	if subject == "" || strings.ContainsAny(subject, " \t\r\n") {
+		return nil, fmt.Errorf("invalid NATS subject %q", subject)
+	}
+	return &natsSink{addr: addr, subject: subject}, nil
+}
+
+// connect dials the server, reading its INFO and sending CONNECT
+func (n *natsSink) connect(ctx context.Context) error {
+	d := net.Dialer{Timeout: natsTimeout}
+	conn, err := d.DialContext(ctx, "tcp", n.addr)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(natsTimeout))
+	r := bufio.NewReader(conn)
+	line, err := r.ReadString('\n')
+	if err == nil && !strings.HasPrefix(line, "INFO ") {
+		err = fmt.Errorf("unexpected greeting %q", strings.TrimSpace(line))
+	}
+	if err == nil {
+		_, err = conn.Write([]byte("CONNECT {\"verbose\":false,\"pedantic\":false,\"name\":\"redigo\"}\r\n"))
+	}
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	n.conn, n.r = conn, r
+	return nil
+}
+
+func (n *natsSink) Publish(ctx context.Context, events []ChangeEvent) error {
+	if n.conn == nil {
+		if err := n.connect(ctx); err != nil {
+			return err
+		}
+	}
+	if err := n.publish(events); err != nil {
+		n.conn.Close()
+		n.conn = nil
+		return err
+	}
+	return nil
+}
+
+// publish writes a PUB per event followed by a PING, and waits for the
+// PONG, answering the PINGs of the server meanwhile
+func (n *natsSink) publish(events []ChangeEvent) error {
+	n.conn.SetDeadline(time.Now().Add(natsTimeout))
+	w := bufio.NewWriter(n.conn)
+	for _, event := range events {
+		payload, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		w.WriteString("PUB " + n.subject + " " + strconv.Itoa(len(payload)) + "\r\n")
+		w.Write(payload)
+		w.WriteString("\r\n")
+	}
+	w.WriteString("PING\r\n")
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	for {
+		line, err := n.r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		switch line = strings.TrimSpace(line); {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			if _, err := n.conn.Write([]byte("PONG\r\n")); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return errors.New(strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+	}
+}
+
+func (n *natsSink) Close() error {
+	if n.conn == nil {
+		return nil
+	}
+	return n.conn.Close()
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"net"
+	"net/netip"
+
+	syscall "golang.org/x/sys/unix"
+)
+
+// connDeniedResp, maxConnsPerIPResp and protectedModeResp are the errors
+// sent to the clients refused by admitConn
+var (
+	connDeniedResp    = []byte("-ERR connections from this address are not allowed\r\n")
+	maxConnsPerIPResp = []byte("-ERR max number of connections from this IP reached\r\n")
+	protectedModeResp = []byte("-DENIED redigo is running in protected mode because it listens on every interface " +
+		"and has no password to require. In this mode connections are only accepted from the loopback interface. " +
+		"To connect from other hosts, either set -host to the address of a private interface, list the networks " +
+		"the clients may connect from with -allow-cidrs, or, once the server is protected by a firewall, " +
+		"disable the protected mode with -protected-mode=false\r\n")
+)
+
+// admitConn checks the address of c against the protected mode,
+// AllowCIDRs, DenyCIDRs and MaxConnsPerIP, counting the connection against its IP if it is admitted.
+// A refused client is sent the error and closed, before any of its
+// commands is read
+func (s *Server) admitConn(c *clientConn) bool {
+	ip := c.addr
+	if host, _, err := net.SplitHostPort(c.addr); err == nil {
+		ip = host
+	}
+
+	var resp []byte
+	switch {
+	case s.protected() && !isLoopback(ip):
+		resp = protectedModeResp
+	case !s.allowedIP(ip):
+		resp = connDeniedResp
+	case s.MaxConnsPerIP > 0 && s.connsPerIP[ip] >= s.MaxConnsPerIP:
+		resp = maxConnsPerIPResp
+	default:
+		s.connsPerIP[ip]++
+		c.ip = ip
+		return true
+	}
+
+	// the socket buffer of a new connection holds the error, so a single
+	// non blocking write sends it
+	syscall.Write(c.Fd, resp)
+	s.stats.rejectedConnections++
+	s.closeConn(c.fDconn)
+	return false
+}
+
+// allowedIP reports whether the clients of ip may connect, those of IPs
+// that do not parse being allowed unless AllowCIDRs is set
+func (s *Server) allowedIP(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return len(s.AllowCIDRs) == 0
+	}
+	addr = addr.WithZone("")
+	for _, prefix := range s.DenyCIDRs {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	if len(s.AllowCIDRs) == 0 {
+		return true
+	}
+	for _, prefix := range s.AllowCIDRs {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// protected reports whether the protected mode refuses the clients that
+// are not on the loopback interface, which it does when it is enabled and
+// the server listens on every interface with no AllowCIDRs, as the server
+// has no password either
+func (s *Server) protected() bool {
+	if !s.ProtectedMode || len(s.AllowCIDRs) > 0 {
+		return false
+	}
+	switch s.Host {
+	case "", "*", "::", "0.0.0.0":
+		return true
+	}
+	return false
+}
+
+func isLoopback(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	return err == nil && addr.Unmap().IsLoopback()
+}
+
+// releaseConnIP stops counting the connection of c against its IP
+func (s *Server) releaseConnIP(c *clientConn) {
+	if c.ip == "" {
+		return
+	}
+	if s.connsPerIP[c.ip]--; s.connsPerIP[c.ip] <= 0 {
+		delete(s.connsPerIP, c.ip)
+	}
+	c.ip = ""
+}
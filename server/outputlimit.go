@@ -0,0 +1,62 @@
+package server
+
+import (
+	"log"
+	"time"
+)
+
+// OutputBufferLimit bounds the replies queued for a client that does not
+// read them, like client-output-buffer-limit in Redis. A client is
+// disconnected as soon as its pending output reaches Hard bytes, or once
+// it stayed over Soft bytes for SoftDuration. Zero or negative byte
+// counts mean no limit
+type OutputBufferLimit struct {
+	Hard         int
+	Soft         int
+	SoftDuration time.Duration
+}
+
+// DefaultClientOutputBufferLimitPubsub is the default limit of the output
+// of the subscribed clients, those of the other clients being unlimited
+var DefaultClientOutputBufferLimitPubsub = OutputBufferLimit{
+	Hard: 32 * 1024 * 1024, Soft: 8 * 1024 * 1024, SoftDuration: 60 * time.Second,
+}
+
+// outputLimitOf returns the output buffer limit of the class of the client
+func (s *Server) outputLimitOf(c *clientConn) OutputBufferLimit {
+	if c.pubsub.count() > 0 {
+		return s.ClientOutputBufferLimitPubsub
+	}
+	return s.ClientOutputBufferLimitNormal
+}
+
+// checkOutputLimit reports whether the pending output of the client
+// exceeds its limit, tracking since when it is over the soft limit
+func (s *Server) checkOutputLimit(c *clientConn) bool {
+	limit := s.outputLimitOf(c)
+	pending := c.outputLen()
+	if limit.Hard > 0 && pending >= limit.Hard {
+		return true
+	}
+	if limit.Soft <= 0 || pending < limit.Soft {
+		c.softLimitSince = time.Time{}
+		return false
+	}
+
+	now := time.Now()
+	if c.softLimitSince.IsZero() {
+		c.softLimitSince = now
+	}
+	return now.Sub(c.softLimitSince) >= limit.SoftDuration
+}
+
+// closeOverLimit drops the pending output of a client over its output
+// buffer limit and schedules it to be closed once the replies of the
+// current poll are written, as it may still be in use by the caller
+func (s *Server) closeOverLimit(c *clientConn) {
+	log.Printf("client id=%d addr=%s closed for exceeding the output buffer limit with %d bytes pending\n",
+		c.Fd, c.addr, c.outputLen())
+	s.stats.outputLimitDisconnections++
+	c.closeASAP = true
+	c.out, c.outbuf, c.outpos, c.outLen = nil, nil, 0, 0
+}
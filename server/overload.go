@@ -0,0 +1,70 @@
+package server
+
+import (
+	"strings"
+	"time"
+
+	"github.com/KavetiRohith/go-cache/cache"
+)
+
+var errOverloaded = &cache.Error{Kind: cache.KindBusy, Msg: "the server is overloaded, try again later"}
+
+// overloadExempt are the commands served under overload whatever their
+// flags: the health checks and connection setup, and the merges of the
+// CRDT peers replicating their writes
+var overloadExempt = map[string]bool{
+	"PING": true, "ECHO": true, "HELLO": true, "CLIENT": true, "INFO": true,
+	"COMMAND": true, "QUIT": true, "RESET": true, "CRDT.MERGE": true,
+}
+
+// overloadEnabled reports whether any overload threshold is set
+func (s *Server) overloadEnabled() bool {
+	return s.OverloadLatency > 0 || s.OverloadPendingBytes > 0
+}
+
+// checkOverload returns a BUSY error for the commands of low priority
+// while the loop is overloaded: the events of the last poll took at least
+// OverloadLatency to serve, or the replies waiting for slow clients add up
+// to OverloadPendingBytes. The administrative commands and those of
+// overloadExempt are always served
+func (s *Server) checkOverload(name string) error {
+	if !s.overloaded() {
+		return nil
+	}
+	name = strings.ToUpper(name)
+	if overloadExempt[name] {
+		return nil
+	}
+	if cmd, ok := s.lookupCommand(name); ok && cmd.hasFlag(FlagAdmin) {
+		return nil
+	}
+	s.stats.overloadRejections++
+	return errOverloaded
+}
+
+// overloaded reports whether the loop is overloaded, summing the pending
+// replies once per poll at most
+func (s *Server) overloaded() bool {
+	if s.OverloadLatency > 0 && s.lastPollBusy >= s.OverloadLatency {
+		return true
+	}
+	if s.OverloadPendingBytes <= 0 {
+		return false
+	}
+	if !s.pendingOutputKnown {
+		s.pendingOutput = 0
+		for _, c := range s.clients {
+			if c.waitWrite {
+				s.pendingOutput += c.outputLen()
+			}
+		}
+		s.pendingOutputKnown = true
+	}
+	return s.pendingOutput >= s.OverloadPendingBytes
+}
+
+// polled records how long the events of a poll took to serve
+func (s *Server) polled(busy time.Duration) {
+	s.lastPollBusy = busy
+	s.pendingOutputKnown = false
+}
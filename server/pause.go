@@ -0,0 +1,83 @@
+package server
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clientPause is the CLIENT PAUSE in effect
+type clientPause struct {
+	until time.Time
+	// all pauses every command rather than the write commands alone
+	all bool
+	// timer ends the pause
+	timer *Timer
+}
+
+// handleClientPause implements CLIENT PAUSE timeout [WRITE|ALL], timeout
+// being in milliseconds. A pause overlapping the current one extends it
+// and makes it pause every command if either of them does
+func (s *Server) handleClientPause(args []string) (Reply, error) {
+	ms, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil || ms < 0 {
+		return nil, errors.New("timeout is not an integer or out of range")
+	}
+	all := true
+	if len(args) == 2 {
+		switch strings.ToUpper(args[1]) {
+		case "ALL":
+		case "WRITE":
+			all = false
+		default:
+			return nil, ErrSyntax
+		}
+	}
+
+	until := time.Now().Add(time.Duration(ms) * time.Millisecond)
+	if p := s.pause; p != nil {
+		p.timer.Stop()
+		all = all || p.all
+		if p.until.After(until) {
+			until = p.until
+		}
+	}
+	s.pause = &clientPause{until: until, all: all}
+	s.pause.timer = s.AfterFunc(time.Until(until), s.unpause)
+	s.logCommand("CLIENT PAUSE %d all=%v\n", ms, all)
+	return OK, nil
+}
+
+// pauses reports whether the command args must wait for the end of
+// the current pause. CLIENT UNPAUSE is never paused, so that any client
+// can end a pause early
+func (s *Server) pauses(args []string) bool {
+	if s.pause == nil {
+		return false
+	}
+	if strings.EqualFold(args[0], "CLIENT") && len(args) == 2 && strings.EqualFold(args[1], "UNPAUSE") {
+		return false
+	}
+	if s.pause.all {
+		return true
+	}
+	cmd, ok := s.lookupCommand(args[0])
+	return ok && cmd.hasFlag(FlagWrite)
+}
+
+// unpause ends the current pause and serves the commands the clients
+// sent in the meantime
+func (s *Server) unpause() {
+	if s.pause == nil {
+		return
+	}
+	s.pause.timer.Stop()
+	s.pause = nil
+	for _, c := range s.clients {
+		if c.paused {
+			c.paused = false
+			s.processQuery(c)
+		}
+	}
+}
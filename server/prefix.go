@@ -0,0 +1,62 @@
+package server
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+func (s *Server) handleCountPrefix(args []string) (Reply, error) {
+	n := s.cache.CountPrefix(args[0])
+	s.logCommand("COUNTPREFIX %q %d\n", args[0], n)
+	return Int(n), nil
+}
+
+// delPrefixHandler implements DELPREFIX prefix, deleting the keys starting
+// with prefix from the backing store too
+func delPrefixHandler(s *Server, client Client, args []string) (Reply, error) {
+	keys := s.cache.DeletePrefix(args[0])
+	s.keysWritten("DELPREFIX", client.conn.Fd, keys)
+
+	s.logCommand("DELPREFIX %q %d\n", args[0], len(keys))
+	return s.writeThroughKeys(client, keys, nil, true, Int(len(keys)))
+}
+
+// handleScanPrefix implements SCANPREFIX prefix cursor [COUNT count],
+// iterating over the keys starting with prefix in lexicographic order.
+// The cursor is 0 to start and once the iteration is over, and otherwise
+// the last key returned preceded by >
+func (s *Server) handleScanPrefix(args []string) (Reply, error) {
+	var after string
+	resume := args[1] != "0"
+	if resume {
+		if !strings.HasPrefix(args[1], ">") {
+			return nil, errors.New("invalid cursor")
+		}
+		after = args[1][1:]
+	}
+
+	count := 10
+	for i := 2; i < len(args); i++ {
+		switch {
+		case strings.EqualFold(args[i], "COUNT") && i+1 < len(args):
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil || n < 1 {
+				return nil, ErrSyntax
+			}
+			count = n
+			i++
+		default:
+			return nil, ErrSyntax
+		}
+	}
+
+	keys, more := s.cache.ScanPrefix(args[0], after, resume, count)
+	next := "0"
+	if more {
+		next = ">" + keys[len(keys)-1]
+	}
+
+	s.logCommand("SCANPREFIX %q %s %d keys\n", args[0], args[1], len(keys))
+	return Array{Bulk(next), bulks(keys)}, nil
+}
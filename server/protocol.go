@@ -0,0 +1,154 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxPreallocArgs bounds the arguments allocated upfront for a RESP
+	// array, so that a bogus length cannot make the server allocate
+	// a huge slice before the arguments arrive
+	maxPreallocArgs = 1024
+	// bigBulkLen is the size from which the query buffer of a client
+	// is grown upfront to hold the whole argument being received
+	bigBulkLen = 32 * 1024
+)
+
+// protoLimits bound the commands parsed, a client exceeding them being
+// replied a protocol error and disconnected
+type protoLimits struct {
+	// maxBulkLen is the longest bulk string and maxMultibulkLen the
+	// largest number of arguments of a RESP array
+	maxBulkLen      int
+	maxMultibulkLen int
+	// maxInlineLen is the longest inline command or RESP length header,
+	// beyond which a client still not sending a newline is disconnected
+	maxInlineLen int
+	// maxQueryLen is the largest size of a whole command
+	maxQueryLen int
+}
+
+// protoLimits returns the limits of the commands of the clients
+func (s *Server) protoLimits() protoLimits {
+	return protoLimits{
+		maxBulkLen:      s.ProtoMaxBulkLen,
+		maxMultibulkLen: s.ProtoMaxMultibulkLen,
+		maxInlineLen:    s.ProtoMaxInlineLen,
+		maxQueryLen:     s.ClientQueryBufferLimit,
+	}
+}
+
+// parseCommand parses the first command buffered in buf. Commands starting
+// with '*' are RESP arrays of bulk strings and any other command is an inline
+// command made of space separated arguments terminated by a newline
+// It returns the arguments, the number of bytes consumed, zero if the command
+// is not complete yet, and whether the command was sent as RESP
+// For an incomplete command whose next argument is at least bigBulkLen long,
+// want is the length buf must reach to hold that argument. Commands over the
+// limits are rejected as soon as the header at fault is read
+func parseCommand(buf []byte, limits protoLimits) (args []string, n, want int, resp bool, err error) {
+	if buf[0] == '*' {
+		args, n, want, err = parseMultibulk(buf, limits)
+		return args, n, want, true, err
+	}
+
+	args, n, err = parseInline(buf, limits.maxInlineLen)
+	return args, n, 0, false, err
+}
+
+func parseInline(buf []byte, maxInlineLen int) ([]string, int, error) {
+	i := bytes.IndexByte(buf, '\n')
+	if i < 0 || i > maxInlineLen {
+		if len(buf) > maxInlineLen {
+			return nil, 0, protocolError("too big inline request")
+		}
+		return nil, 0, nil
+	}
+	return strings.Fields(string(buf[:i])), i + 1, nil
+}
+
+// parseMultibulk parses "*<count>\r\n" followed by count "$<len>\r\n<arg>\r\n"
+// The arrays hold bulk strings only, nested arrays being rejected
+func parseMultibulk(buf []byte, limits protoLimits) ([]string, int, int, error) {
+	count, pos, err := parseLength(buf, 0, '*', limits.maxInlineLen)
+	if err != nil || pos == 0 {
+		return nil, 0, 0, err
+	}
+	if count > limits.maxMultibulkLen {
+		return nil, 0, 0, protocolError("invalid multibulk length")
+	}
+
+	prealloc := count
+	if prealloc > maxPreallocArgs {
+		prealloc = maxPreallocArgs
+	}
+	args := make([]string, 0, prealloc)
+	for len(args) < count {
+		if pos < len(buf) && buf[pos] == '*' {
+			return nil, 0, 0, protocolError("nested multibulk requests are not supported")
+		}
+		size, next, err := parseLength(buf, pos, '$', limits.maxInlineLen)
+		if err != nil || next == 0 {
+			return nil, 0, 0, err
+		}
+		if size > limits.maxBulkLen {
+			return nil, 0, 0, protocolError("invalid bulk length")
+		}
+		if next+size+2 > limits.maxQueryLen {
+			return nil, 0, 0, protocolError("the command exceeds the client query buffer limit")
+		}
+		if len(buf) < next+size+2 {
+			if size >= bigBulkLen {
+				return nil, 0, next + size + 2, nil
+			}
+			return nil, 0, 0, nil
+		}
+		if buf[next+size] != '\r' || buf[next+size+1] != '\n' {
+			return nil, 0, 0, protocolError("expected CRLF after bulk string")
+		}
+
+		args = append(args, string(buf[next:next+size]))
+		pos = next + size + 2
+	}
+	return args, pos, 0, nil
+}
+
+// parseLength parses a "<prefix><n>\r\n" header starting at pos, returning
+// n and the position following the header, or zero if it is not complete yet
+func parseLength(buf []byte, pos int, prefix byte, maxInlineLen int) (int, int, error) {
+	i := bytes.IndexByte(buf[pos:], '\n')
+	if i < 0 || i > maxInlineLen {
+		if len(buf)-pos > maxInlineLen {
+			return 0, 0, protocolError(fmt.Sprintf("too big '%c' length", prefix))
+		}
+		return 0, 0, nil
+	}
+
+	line := buf[pos : pos+i]
+	if len(line) < 3 || line[0] != prefix || line[len(line)-1] != '\r' {
+		return 0, 0, protocolError(fmt.Sprintf("expected '%c'", prefix))
+	}
+	n, err := strconv.Atoi(string(line[1 : len(line)-1]))
+	if err != nil || n < 0 {
+		return 0, 0, protocolError(fmt.Sprintf("invalid length %q", line[1:len(line)-1]))
+	}
+	return n, pos + i + 1, nil
+}
+
+// appendCommand appends a command encoded as a RESP array of bulk strings
+func appendCommand(b []byte, args ...string) []byte {
+	b = append(b, '*')
+	b = strconv.AppendInt(b, int64(len(args)), 10)
+	b = append(b, "\r\n"...)
+	for _, arg := range args {
+		b = Bulk(arg).appendRESP(b)
+	}
+	return b
+}
+
+func protocolError(msg string) error {
+	return fmt.Errorf("Protocol error: %s", msg)
+}
@@ -0,0 +1,462 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/KavetiRohith/go-cache/cache"
+)
+
+// proxyVirtualNodes is the number of points of each backend on the hash
+// ring, spreading the keys evenly over the backends
+const proxyVirtualNodes = 160
+
+// proxyDialTimeout bounds the connections of the proxy to its backends
+const proxyDialTimeout = 5 * time.Second
+
+// errCrossSlot is returned by the proxy for the commands whose keys belong
+// to several backends and whose replies cannot be combined
+var errCrossSlot = &cache.Error{Kind: cache.KindCrossSlot, Msg: "Keys in request don't hash to the same backend"}
+
+// proxySplitCommands are the commands taking keys only whose integer
+// replies are summed when their keys belong to several backends
+var proxySplitCommands = map[string]bool{"DEL": true, "UNLINK": true, "TOUCH": true}
+
+// proxySumCommands are the commands over the keys of every backend whose
+// integer replies are summed
+var proxySumCommands = map[string]bool{"COUNTPREFIX": true, "DELPREFIX": true}
+
+// Proxy fronts several servers, routing every command to the server
+// owning its keys by consistent hashing, so that adding or removing a
+// server moves only the keys it owns. The part of a key between { and },
+// when not empty, is hashed alone, so that keys sharing it are stored
+// together and can be used by the same command. The client connections
+// share a pipelined connection to every server
+type Proxy struct {
+	backends []*proxyBackend
+	// ring holds the points of the backends sorted by hash
+	ring []proxyNode
+}
+
+type proxyNode struct {
+	hash    uint64
+	backend *proxyBackend
+}
+
+// NewProxy returns a proxy routing the commands to the servers at addrs
+func NewProxy(addrs []string) (*Proxy, error) {
+	if len(addrs) == 0 {
+		return nil, errors.New("the proxy needs at least one backend")
+	}
+
+	p := &Proxy{}
+	for _, addr := range addrs {
+		b := &proxyBackend{addr: addr}
+		p.backends = append(p.backends, b)
+		for i := 0; i < proxyVirtualNodes; i++ {
+			p.ring = append(p.ring, proxyNode{hash: proxyHash(addr + "#" + strconv.Itoa(i)), backend: b})
+		}
+	}
+	sort.Slice(p.ring, func(i, j int) bool { return p.ring[i].hash < p.ring[j].hash })
+	return p, nil
+}
+
+// proxyHash hashes a string with FNV-1a followed by the finalizer of
+// splitmix64, as FNV alone clusters the hashes of similar strings
+func proxyHash(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	return x ^ x>>31
+}
+
+// hashTag returns the part of key hashed to place it on the ring
+func hashTag(key string) string {
+	if start := strings.IndexByte(key, '{'); start != -1 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			return key[start+1 : start+1+end]
+		}
+	}
+	return key
+}
+
+// backend returns the backend owning key, the first one clockwise on the
+// ring from the hash of the key
+func (p *Proxy) backend(key string) *proxyBackend {
+	h := proxyHash(hashTag(key))
+	i := sort.Search(len(p.ring), func(i int) bool { return p.ring[i].hash >= h })
+	if i == len(p.ring) {
+		i = 0
+	}
+	return p.ring[i].backend
+}
+
+// ListenAndServe accepts the clients of the proxy on addr, serving each
+// on a goroutine of its own
+func (p *Proxy) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	log.Println("proxying", addr, "to", len(p.backends), "backends")
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go p.serveConn(conn)
+	}
+}
+
+func (p *Proxy) serveConn(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	sub := &proxySubscriber{client: conn, w: bufio.NewWriter(conn)}
+	defer sub.close()
+	for {
+		args, _, _, err := readLogCommand(r)
+		if err != nil {
+			if err != io.EOF {
+				sub.write(errorRESP(nil, protocolError(err.Error())), true)
+			}
+			return
+		}
+		if args == nil {
+			continue
+		}
+
+		var reply []byte
+		switch strings.ToUpper(args[0]) {
+		case "SSUBSCRIBE", "SUNSUBSCRIBE":
+			// the confirmations are relayed by the subscriptions
+			err = p.shardSubscribe(sub, args)
+		default:
+			reply, err = p.do(args)
+		}
+		if err != nil {
+			reply = errorRESP(nil, err)
+		}
+		// the replies of pipelined commands are written together
+		if err := sub.write(reply, r.Buffered() == 0); err != nil {
+			return
+		}
+	}
+}
+
+// do runs a command through the proxy, returning its reply in RESP
+func (p *Proxy) do(args []string) ([]byte, error) {
+	name := strings.ToUpper(args[0])
+	cmd, ok := builtinCommandNames[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown Command %s", args[0])
+	}
+	if err := cmd.checkArity(args); err != nil {
+		return nil, err
+	}
+	// the commands holding on to the connection or changing its protocol
+	// would hold on to the connection shared with the other clients
+	if cmd.hasFlag(FlagBlocking) || (cmd.hasFlag(FlagPubSub) && name != "SPUBLISH") || cmd.hasFlag(FlagMovableKeys) || name == "HELLO" || name == "CLIENT" || name == "QUIT" || name == "RESET" {
+		return nil, fmt.Errorf("'%s' is not supported by the proxy", strings.ToLower(name))
+	}
+
+	keys := cmd.keys(args)
+	if len(keys) == 0 {
+		if name == "FLUSHALL" || name == "FLUSHDB" {
+			return p.broadcast(args)
+		}
+		if proxySumCommands[name] {
+			return p.sum(args)
+		}
+		// the commands without keys are answered by the first backend
+		return p.backends[0].do(args)
+	}
+
+	b := p.backend(keys[0])
+	for _, key := range keys[1:] {
+		if p.backend(key) != b {
+			if proxySplitCommands[name] {
+				return p.split(args)
+			}
+			return nil, errCrossSlot
+		}
+	}
+	return b.do(args)
+}
+
+// shardSubscribe sends SSUBSCRIBE or SUNSUBSCRIBE to the backend owning
+// their shard channels over the connection sub subscribes on to it, the
+// confirmations and messages being relayed to the client as they come.
+// Without channels, SUNSUBSCRIBE is sent to every backend subscribed to
+func (p *Proxy) shardSubscribe(sub *proxySubscriber, args []string) error {
+	if len(args) == 1 {
+		if len(sub.conns) == 0 {
+			return sub.write(Array{Bulk("sunsubscribe"), Nil, Int(0)}.appendRESP(nil), false)
+		}
+		for b := range sub.conns {
+			if err := sub.send(b, args); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	b := p.backend(args[1])
+	for _, channel := range args[2:] {
+		if p.backend(channel) != b {
+			return errCrossSlot
+		}
+	}
+	return sub.send(b, args)
+}
+
+// broadcast runs a command on every backend, replying the reply of the
+// first one unless another failed
+func (p *Proxy) broadcast(args []string) ([]byte, error) {
+	var first []byte
+	for i, b := range p.backends {
+		reply, err := b.do(args)
+		if err != nil {
+			return nil, err
+		}
+		if reply[0] == '-' || i == 0 {
+			first = reply
+		}
+		if reply[0] == '-' {
+			break
+		}
+	}
+	return first, nil
+}
+
+// split runs a command taking keys only on every backend owning some of
+// them, summing their integer replies
+func (p *Proxy) split(args []string) ([]byte, error) {
+	byBackend := make(map[*proxyBackend][]string)
+	var order []*proxyBackend
+	for _, key := range args[1:] {
+		b := p.backend(key)
+		if _, ok := byBackend[b]; !ok {
+			order = append(order, b)
+		}
+		byBackend[b] = append(byBackend[b], key)
+	}
+
+	return sumReplies(order, func(b *proxyBackend) []string {
+		return append([]string{args[0]}, byBackend[b]...)
+	})
+}
+
+// sum runs a command on every backend, summing their integer replies
+func (p *Proxy) sum(args []string) ([]byte, error) {
+	return sumReplies(p.backends, func(*proxyBackend) []string { return args })
+}
+
+// sumReplies runs on every backend given the command returned by argsOf,
+// summing their integer replies, or replying the first other reply
+func sumReplies(backends []*proxyBackend, argsOf func(b *proxyBackend) []string) ([]byte, error) {
+	var sum int64
+	for _, b := range backends {
+		reply, err := b.do(argsOf(b))
+		if err != nil {
+			return nil, err
+		}
+		if reply[0] != ':' {
+			return reply, nil
+		}
+		n, err := strconv.ParseInt(string(reply[1:len(reply)-2]), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		sum += n
+	}
+	return Int(sum).appendRESP(nil), nil
+}
+
+// proxySubscriber is a client of the proxy subscribed to shard channels,
+// which is given a connection of its own to every backend owning some of
+// them, as the subscriptions hold on to it. Its replies and the messages
+// relayed are written to it under mu
+type proxySubscriber struct {
+	client net.Conn
+	mu     sync.Mutex
+	w      *bufio.Writer
+	conns  map[*proxyBackend]net.Conn
+}
+
+// write writes reply to the client, flushing the replies written if flush
+// is set
+func (sub *proxySubscriber) write(reply []byte, flush bool) error {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	sub.w.Write(reply)
+	if !flush {
+		return nil
+	}
+	return sub.w.Flush()
+}
+
+// send sends a command to b over the connection subscribing to it,
+// connecting it first if needed
+func (sub *proxySubscriber) send(b *proxyBackend, args []string) error {
+	conn, ok := sub.conns[b]
+	if !ok {
+		var err error
+		if conn, err = net.DialTimeout("tcp", b.addr, proxyDialTimeout); err != nil {
+			return fmt.Errorf("proxy: backend %s: %v", b.addr, err)
+		}
+		if sub.conns == nil {
+			sub.conns = make(map[*proxyBackend]net.Conn)
+		}
+		sub.conns[b] = conn
+		go sub.relay(conn)
+	}
+	if _, err := conn.Write(appendCommand(nil, args...)); err != nil {
+		return fmt.Errorf("proxy: backend %s: %v", b.addr, err)
+	}
+	return nil
+}
+
+// relay writes the replies read from a backend to the client until the
+// connection breaks, closing the client then as it lost its subscriptions
+func (sub *proxySubscriber) relay(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	for {
+		reply, err := readRESPFrame(r, nil)
+		if err == nil {
+			err = sub.write(reply, r.Buffered() == 0)
+		}
+		if err != nil {
+			conn.Close()
+			sub.client.Close()
+			return
+		}
+	}
+}
+
+// close closes the connections subscribing to the backends
+func (sub *proxySubscriber) close() {
+	for _, conn := range sub.conns {
+		conn.Close()
+	}
+}
+
+// proxyBackend is a server of the proxy, reached over a connection that
+// the clients pipeline their commands on
+type proxyBackend struct {
+	addr string
+	mu   sync.Mutex
+	conn *proxyConn
+}
+
+// proxyConn is a pipelined connection to a backend. The commands are
+// written in the order of queue, which holds the channels their replies
+// are sent to as they are read
+type proxyConn struct {
+	conn  net.Conn
+	mu    sync.Mutex
+	queue []chan proxyReply
+	err   error
+}
+
+type proxyReply struct {
+	reply []byte
+	err   error
+}
+
+// do sends a command to the backend and waits for its reply, connecting
+// again if the connection was lost
+func (b *proxyBackend) do(args []string) ([]byte, error) {
+	pc, err := b.connect()
+	if err != nil {
+		return nil, fmt.Errorf("proxy: backend %s: %v", b.addr, err)
+	}
+
+	ch := make(chan proxyReply, 1)
+	pc.mu.Lock()
+	if pc.err != nil {
+		pc.mu.Unlock()
+		return nil, fmt.Errorf("proxy: backend %s: %v", b.addr, pc.err)
+	}
+	pc.queue = append(pc.queue, ch)
+	_, err = pc.conn.Write(appendCommand(nil, args...))
+	pc.mu.Unlock()
+	if err != nil {
+		// the reader fails the queued commands once the connection closes
+		pc.conn.Close()
+	}
+
+	r := <-ch
+	if r.err != nil {
+		return nil, fmt.Errorf("proxy: backend %s: %v", b.addr, r.err)
+	}
+	return r.reply, nil
+}
+
+func (b *proxyBackend) connect() (*proxyConn, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.conn != nil {
+		b.conn.mu.Lock()
+		broken := b.conn.err != nil
+		b.conn.mu.Unlock()
+		if !broken {
+			return b.conn, nil
+		}
+	}
+
+	conn, err := net.DialTimeout("tcp", b.addr, proxyDialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	b.conn = &proxyConn{conn: conn}
+	go b.conn.readReplies()
+	return b.conn, nil
+}
+
+// readReplies hands the replies read to the commands queued, failing them
+// all when the connection breaks
+func (pc *proxyConn) readReplies() {
+	r := bufio.NewReader(pc.conn)
+	for {
+		reply, err := readRESPFrame(r, nil)
+		pc.mu.Lock()
+		if err != nil {
+			pc.err = err
+			for _, ch := range pc.queue {
+				ch <- proxyReply{err: err}
+			}
+			pc.queue = nil
+			pc.mu.Unlock()
+			pc.conn.Close()
+			return
+		}
+		if len(pc.queue) == 0 {
+			// a reply no command waits for, which desynchronizes the
+			// connection
+			pc.err = errors.New("unexpected reply")
+			pc.mu.Unlock()
+			pc.conn.Close()
+			return
+		}
+		ch := pc.queue[0]
+		pc.queue = pc.queue[1:]
+		pc.mu.Unlock()
+		ch <- proxyReply{reply: reply}
+	}
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"log"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+const (
+	// proxyV1Prefix starts the headers of version 1 of the PROXY protocol,
+	// which are a line of at most proxyV1MaxLen bytes
+	proxyV1Prefix = "PROXY "
+	proxyV1MaxLen = 107
+	// proxyV2Len is the length of the fixed part of the headers of
+	// version 2, followed by the length of the addresses
+	proxyV2Len = 16
+)
+
+// proxyV2Signature starts the headers of version 2 of the PROXY protocol
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+var errProxyHeader = protocolError("invalid PROXY protocol header")
+
+// readProxyHeader parses the PROXY protocol header starting the connection
+// of c once it is received, replacing the address of c with the source
+// address it carries, which admitConn then checks. It reports whether the
+// header was read and the client admitted, closing the connection if the
+// header is invalid
+func (s *Server) readProxyHeader(c *clientConn) bool {
+	addr, n, err := parseProxyHeader(c.querybuf)
+	if err != nil {
+		s.stats.protocolErrors++
+		log.Printf("closing %s: %v\n", c.addr, err)
+		s.closeConn(c.fDconn)
+		return false
+	}
+	if n == 0 {
+		return false
+	}
+
+	c.querybuf = c.querybuf[n:]
+	c.proxyHeader = false
+	if addr.IsValid() {
+		c.addr = addr.String()
+	}
+	return s.admitConn(c)
+}
+
+// parseProxyHeader parses the header of version 1 or 2 of the PROXY
+// protocol at the start of b, returning the source address it carries and
+// its length, which is zero while the header is incomplete. The address
+// is invalid for the headers of health checks, which carry none
+func parseProxyHeader(b []byte) (netip.AddrPort, int, error) {
+	switch {
+	case bytes.HasPrefix(b, []byte(proxyV1Prefix)):
+		return parseProxyV1(b)
+	case bytes.HasPrefix(b, proxyV2Signature):
+		return parseProxyV2(b)
+	case bytes.HasPrefix([]byte(proxyV1Prefix), b), bytes.HasPrefix(proxyV2Signature, b):
+		return netip.AddrPort{}, 0, nil
+	default:
+		return netip.AddrPort{}, 0, errProxyHeader
+	}
+}
+
+// parseProxyV1 parses a header such as
+// PROXY TCP4 192.0.2.1 198.51.100.1 56324 6379\r\n
+func parseProxyV1(b []byte) (netip.AddrPort, int, error) {
+	end := bytes.Index(b, []byte("\r\n"))
+	if end == -1 {
+		if len(b) >= proxyV1MaxLen {
+			return netip.AddrPort{}, 0, errProxyHeader
+		}
+		return netip.AddrPort{}, 0, nil
+	}
+	if end+2 > proxyV1MaxLen {
+		return netip.AddrPort{}, 0, errProxyHeader
+	}
+
+	fields := strings.Split(string(b[:end]), " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return netip.AddrPort{}, end + 2, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return netip.AddrPort{}, 0, errProxyHeader
+	}
+	addr, err := netip.ParseAddr(fields[2])
+	if err != nil || addr.Is4() != (fields[1] == "TCP4") {
+		return netip.AddrPort{}, 0, errProxyHeader
+	}
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if err != nil {
+		return netip.AddrPort{}, 0, errProxyHeader
+	}
+	return netip.AddrPortFrom(addr, uint16(port)), end + 2, nil
+}
+
+// parseProxyV2 parses a binary header, made of the signature, the version
+// and command, the address family and protocol, the length of the
+// addresses and the addresses themselves
+func parseProxyV2(b []byte) (netip.AddrPort, int, error) {
+	if len(b) < proxyV2Len {
+		return netip.AddrPort{}, 0, nil
+	}
+	n := proxyV2Len + int(binary.BigEndian.Uint16(b[14:16]))
+	if len(b) < n {
+		return netip.AddrPort{}, 0, nil
+	}
+
+	verCmd, family, addrs := b[12], b[13], b[proxyV2Len:n]
+	switch {
+	case verCmd>>4 != 2:
+		return netip.AddrPort{}, 0, errProxyHeader
+	case verCmd&0xf == 0:
+		// LOCAL, sent by the proxy for its own health checks
+		return netip.AddrPort{}, n, nil
+	case verCmd&0xf != 1:
+		return netip.AddrPort{}, 0, errProxyHeader
+	}
+
+	switch family {
+	case 0x11: // TCP over IPv4
+		if len(addrs) < 12 {
+			return netip.AddrPort{}, 0, errProxyHeader
+		}
+		addr := netip.AddrFrom4(*(*[4]byte)(addrs[:4]))
+		return netip.AddrPortFrom(addr, binary.BigEndian.Uint16(addrs[8:10])), n, nil
+	case 0x21: // TCP over IPv6
+		if len(addrs) < 36 {
+			return netip.AddrPort{}, 0, errProxyHeader
+		}
+		addr := netip.AddrFrom16(*(*[16]byte)(addrs[:16])).Unmap()
+		return netip.AddrPortFrom(addr, binary.BigEndian.Uint16(addrs[32:34])), n, nil
+	default:
+		// UNSPEC and the other protocols carry no TCP source address
+		return netip.AddrPort{}, n, nil
+	}
+}
@@ -0,0 +1,368 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/KavetiRohith/go-cache/cache"
+)
+
+// maxChannelStats bounds the number of channels whose deliveries are
+// counted, the channels first published to once it is reached not being
+// counted
+const maxChannelStats = 10000
+
+// channelStats counts the messages published to a channel and their
+// deliveries to its subscribers, those of the patterns included
+type channelStats struct {
+	published, delivered int64
+}
+
+// channelStatsKey is a channel, the shard channels being apart from the
+// others of the same name
+type channelStatsKey struct {
+	channel string
+	shard   bool
+}
+
+// pubsubClient holds the Pub/Sub subscriptions of a client
+type pubsubClient struct {
+	channels map[string]struct{}
+	patterns map[string]struct{}
+	// shardChannels are the channels subscribed to with SSUBSCRIBE, which
+	// only SPUBLISH posts to
+	shardChannels map[string]struct{}
+	// deliver writes a published message to the client
+	deliver func(Reply)
+}
+
+func newPubsubClient(deliver func(Reply)) *pubsubClient {
+	return &pubsubClient{
+		channels:      make(map[string]struct{}),
+		patterns:      make(map[string]struct{}),
+		shardChannels: make(map[string]struct{}),
+		deliver:       deliver,
+	}
+}
+
+// count returns the number of channels, patterns and shard channels
+// subscribed to
+func (pc *pubsubClient) count() int {
+	if pc == nil {
+		return 0
+	}
+	return len(pc.channels) + len(pc.patterns) + len(pc.shardChannels)
+}
+
+// subscriptionKind tells the channels, the patterns and the shard channels
+// apart
+type subscriptionKind int
+
+const (
+	subscribeChannels subscriptionKind = iota
+	subscribePatterns
+	subscribeShardChannels
+)
+
+// subscriptions returns the prefix of the replies of kind, the
+// subscriptions of pc of kind and the subscribers of each of them
+func (s *Server) subscriptions(pc *pubsubClient, kind subscriptionKind) (string, map[string]struct{}, map[string]map[*pubsubClient]struct{}) {
+	switch kind {
+	case subscribePatterns:
+		return "p", pc.patterns, s.patterns
+	case subscribeShardChannels:
+		return "s", pc.shardChannels, s.shardChannels
+	default:
+		return "", pc.channels, s.channels
+	}
+}
+
+// countOf returns the count carried by the replies of kind, which as in
+// Redis is that of the shard channels or that of the channels and patterns
+func (pc *pubsubClient) countOf(kind subscriptionKind) int {
+	if kind == subscribeShardChannels {
+		return len(pc.shardChannels)
+	}
+	return len(pc.channels) + len(pc.patterns)
+}
+
+// pubsubCommands are the commands a RESP client may send while subscribed,
+// as its connection only carries the published messages then
+var pubsubCommands = map[string]bool{
+	"SUBSCRIBE": true, "UNSUBSCRIBE": true, "PSUBSCRIBE": true, "PUNSUBSCRIBE": true,
+	"SSUBSCRIBE": true, "SUNSUBSCRIBE": true, "PING": true, "QUIT": true,
+	"RESET": true,
+}
+
+// pubsubOf returns the subscriptions of the client, creating them for
+// connected clients on their first subscription
+func (s *Server) pubsubOf(client Client) (*pubsubClient, error) {
+	if client.pubsub != nil {
+		return client.pubsub, nil
+	}
+	c, ok := s.clients[client.conn.Fd]
+	if !ok {
+		return nil, errors.New("Pub/Sub is not supported on this connection")
+	}
+	if c.pubsub == nil {
+		c.pubsub = newPubsubClient(func(r Reply) { s.reply(c.fDconn, r, nil) })
+	}
+	return c.pubsub, nil
+}
+
+// checkSubscribed rejects the commands a subscribed client may not send
+func (s *Server) checkSubscribed(conn fDconn, cmd *Command) error {
+	c, ok := s.clients[conn.Fd]
+	if !ok || c.pubsub.count() == 0 || pubsubCommands[cmd.Name] {
+		return nil
+	}
+	return fmt.Errorf("Can't execute '%s': only (P|S)SUBSCRIBE / (P|S)UNSUBSCRIBE are allowed in this context", strings.ToLower(cmd.Name))
+}
+
+// subscribe adds the client to the channels, patterns or shard channels
+// names, replying with a confirmation for each of them
+func (s *Server) subscribe(pc *pubsubClient, names []string, kind subscriptionKind) Reply {
+	prefix, subs, registry := s.subscriptions(pc, kind)
+	reply := prefix + "subscribe"
+
+	r := make(replies, 0, len(names))
+	for _, name := range names {
+		if _, ok := subs[name]; !ok {
+			subs[name] = struct{}{}
+			if registry[name] == nil {
+				registry[name] = make(map[*pubsubClient]struct{})
+			}
+			registry[name][pc] = struct{}{}
+		}
+		r = append(r, Array{Bulk(reply), Bulk(name), Int(pc.countOf(kind))})
+	}
+	s.logCommand("%s %v\n", strings.ToUpper(reply), names)
+	return r
+}
+
+// unsubscribe removes the client from the channels, patterns or shard
+// channels names, or from every one of kind when names is empty
+func (s *Server) unsubscribe(pc *pubsubClient, names []string, kind subscriptionKind) Reply {
+	prefix, subs, registry := s.subscriptions(pc, kind)
+	reply := prefix + "unsubscribe"
+	if len(names) == 0 {
+		for name := range subs {
+			names = append(names, name)
+		}
+		if len(names) == 0 {
+			return Array{Bulk(reply), Nil, Int(pc.countOf(kind))}
+		}
+	}
+
+	r := make(replies, 0, len(names))
+	for _, name := range names {
+		if _, ok := subs[name]; ok {
+			delete(subs, name)
+			delete(registry[name], pc)
+			if len(registry[name]) == 0 {
+				delete(registry, name)
+			}
+		}
+		r = append(r, Array{Bulk(reply), Bulk(name), Int(pc.countOf(kind))})
+	}
+	s.logCommand("%s %v\n", strings.ToUpper(reply), names)
+	return r
+}
+
+// unsubscribeAll drops every subscription of a client going away
+func (s *Server) unsubscribeAll(pc *pubsubClient) {
+	for name := range pc.channels {
+		delete(s.channels[name], pc)
+		if len(s.channels[name]) == 0 {
+			delete(s.channels, name)
+		}
+	}
+	for name := range pc.patterns {
+		delete(s.patterns[name], pc)
+		if len(s.patterns[name]) == 0 {
+			delete(s.patterns, name)
+		}
+	}
+	for name := range pc.shardChannels {
+		delete(s.shardChannels[name], pc)
+		if len(s.shardChannels[name]) == 0 {
+			delete(s.shardChannels, name)
+		}
+	}
+	pc.channels = make(map[string]struct{})
+	pc.patterns = make(map[string]struct{})
+	pc.shardChannels = make(map[string]struct{})
+}
+
+// publish delivers msg to the subscribers of channel and of the patterns
+// matching it, returning the number of deliveries
+func (s *Server) publish(channel, msg string) int {
+	n := 0
+	for pc := range s.channels[channel] {
+		pc.deliver(Array{Bulk("message"), Bulk(channel), Bulk(msg)})
+		n++
+	}
+	for pattern, subs := range s.patterns {
+		if !cache.MatchPattern(pattern, channel) {
+			continue
+		}
+		for pc := range subs {
+			pc.deliver(Array{Bulk("pmessage"), Bulk(pattern), Bulk(channel), Bulk(msg)})
+			n++
+		}
+	}
+	s.countPublished(channelStatsKey{channel, false}, n)
+	return n
+}
+
+// shardPublish delivers msg to the subscribers of the shard channel,
+// returning their number. The patterns do not match the shard channels
+func (s *Server) shardPublish(channel, msg string) int {
+	for pc := range s.shardChannels[channel] {
+		pc.deliver(Array{Bulk("smessage"), Bulk(channel), Bulk(msg)})
+	}
+	n := len(s.shardChannels[channel])
+	s.countPublished(channelStatsKey{channel, true}, n)
+	return n
+}
+
+// countPublished counts a message published to a channel and delivered n
+// times
+func (s *Server) countPublished(key channelStatsKey, n int) {
+	st, ok := s.channelStats[key]
+	if !ok {
+		if len(s.channelStats) >= maxChannelStats {
+			return
+		}
+		st = &channelStats{}
+		s.channelStats[key] = st
+	}
+	st.published++
+	st.delivered += int64(n)
+}
+
+func subscribeHandler(kind subscriptionKind) CommandFunc {
+	return func(s *Server, client Client, args []string) (Reply, error) {
+		pc, err := s.pubsubOf(client)
+		if err != nil {
+			return nil, err
+		}
+		return s.subscribe(pc, args, kind), nil
+	}
+}
+
+func unsubscribeHandler(kind subscriptionKind) CommandFunc {
+	return func(s *Server, client Client, args []string) (Reply, error) {
+		pc, err := s.pubsubOf(client)
+		if err != nil {
+			return nil, err
+		}
+		return s.unsubscribe(pc, args, kind), nil
+	}
+}
+
+func (s *Server) handlePublish(args []string) (Reply, error) {
+	n := s.publish(args[0], args[1])
+	s.logCommand("PUBLISH %s %d receivers\n", args[0], n)
+	return Int(n), nil
+}
+
+func (s *Server) handleSpublish(args []string) (Reply, error) {
+	n := s.shardPublish(args[0], args[1])
+	s.logCommand("SPUBLISH %s %d receivers\n", args[0], n)
+	return Int(n), nil
+}
+
+// handlePubsub implements PUBSUB CHANNELS [pattern] | NUMSUB [channel ...]
+// | NUMPAT | SHARDCHANNELS [pattern] | SHARDNUMSUB [shardchannel ...] |
+// STATS [pattern] | SHARDSTATS [pattern] | RESETSTATS
+func (s *Server) handlePubsub(args []string) (Reply, error) {
+	switch strings.ToUpper(args[0]) {
+	case "CHANNELS":
+		return activeChannels(s.channels, args[1:]), nil
+	case "SHARDCHANNELS":
+		return activeChannels(s.shardChannels, args[1:]), nil
+
+	case "NUMSUB":
+		return numSub(s.channels, args[1:]), nil
+	case "SHARDNUMSUB":
+		return numSub(s.shardChannels, args[1:]), nil
+
+	case "NUMPAT":
+		return Int(len(s.patterns)), nil
+
+	case "STATS":
+		return s.pubsubStats(false, args[1:]), nil
+	case "SHARDSTATS":
+		return s.pubsubStats(true, args[1:]), nil
+
+	case "RESETSTATS":
+		s.channelStats = make(map[channelStatsKey]*channelStats)
+		return OK, nil
+
+	default:
+		return nil, fmt.Errorf("unknown subcommand '%s'", args[0])
+	}
+}
+
+// activeChannels replies with the channels of registry having subscribers,
+// those matching the pattern if one is given, sorted
+func activeChannels(registry map[string]map[*pubsubClient]struct{}, pattern []string) Reply {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		if len(pattern) == 0 || cache.MatchPattern(pattern[0], name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	r := make(Array, len(names))
+	for i, name := range names {
+		r[i] = Bulk(name)
+	}
+	return r
+}
+
+// numSub replies with each of the channels followed by its number of
+// subscribers in registry
+func numSub(registry map[string]map[*pubsubClient]struct{}, channels []string) Reply {
+	r := make(Array, 0, 2*len(channels))
+	for _, name := range channels {
+		r = append(r, Bulk(name), Int(len(registry[name])))
+	}
+	return r
+}
+
+// pubsubStats replies with the counters of the channels, or of the shard
+// channels, matching the pattern if one is given, as entries of the
+// channel, the messages published to it, their deliveries and its current
+// subscribers, by decreasing number of messages published
+func (s *Server) pubsubStats(shard bool, pattern []string) Reply {
+	registry := s.channels
+	if shard {
+		registry = s.shardChannels
+	}
+
+	var keys []channelStatsKey
+	for key := range s.channelStats {
+		if key.shard == shard && (len(pattern) == 0 || cache.MatchPattern(pattern[0], key.channel)) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := s.channelStats[keys[i]], s.channelStats[keys[j]]
+		if a.published != b.published {
+			return a.published > b.published
+		}
+		return keys[i].channel < keys[j].channel
+	})
+
+	r := make(Array, len(keys))
+	for i, key := range keys {
+		st := s.channelStats[key]
+		r[i] = Array{Bulk(key.channel), Int(st.published), Int(st.delivered), Int(len(registry[key.channel]))}
+	}
+	return r
+}
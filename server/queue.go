@@ -0,0 +1,103 @@
+package server
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultQueueVisibility is how long a message read with QREAD stays
+// invisible to the other reads unless VISIBILITY is given
+const defaultQueueVisibility = 30 * time.Second
+
+// handleQAdd implements QADD queue message [<* | id>], replying with the
+// ID of the message
+func (s *Server) handleQAdd(args []string) (Reply, error) {
+	idSpec := "*"
+	switch len(args) {
+	case 2:
+	case 3:
+		idSpec = args[2]
+	default:
+		return nil, ErrSyntax
+	}
+
+	id, err := s.cache.QAddID(args[0], idSpec, args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	s.logCommand("QADD %s %s\n", args[0], id)
+	s.serveBlockedClients(args[0])
+	return Bulk(id.String()), nil
+}
+
+// handleQRead implements
+// QREAD queue [COUNT count] [VISIBILITY milliseconds] [MAXDELIVERIES n [DEADLETTER queue]],
+// replying with the messages received as [id, message, deliveries]
+func (s *Server) handleQRead(args []string) (Reply, error) {
+	var (
+		count, maxDeliveries = 1, 0
+		visibility           = defaultQueueVisibility
+		deadLetter           string
+		err                  error
+	)
+	for i := 1; i < len(args); i++ {
+		if i+1 >= len(args) {
+			return nil, ErrSyntax
+		}
+		switch strings.ToUpper(args[i]) {
+		case "COUNT":
+			if count, err = strconv.Atoi(args[i+1]); err != nil || count < 1 {
+				return nil, errors.New("COUNT must be > 0")
+			}
+		case "VISIBILITY":
+			if visibility, err = parseMinIdle(args[i+1]); err != nil {
+				return nil, errors.New("invalid VISIBILITY argument")
+			}
+		case "MAXDELIVERIES":
+			if maxDeliveries, err = strconv.Atoi(args[i+1]); err != nil || maxDeliveries < 1 {
+				return nil, errors.New("MAXDELIVERIES must be > 0")
+			}
+		case "DEADLETTER":
+			deadLetter = args[i+1]
+		default:
+			return nil, ErrSyntax
+		}
+		i++
+	}
+	if deadLetter != "" && maxDeliveries == 0 {
+		return nil, errors.New("DEADLETTER requires MAXDELIVERIES")
+	}
+
+	res, err := s.cache.QRead(args[0], count, visibility, maxDeliveries, deadLetter)
+	if err != nil {
+		return nil, err
+	}
+	if res.DeadLettered > 0 && deadLetter != "" {
+		s.serveBlockedClients(deadLetter)
+	}
+
+	s.logCommand("QREAD %s %d received %d dead lettered\n", args[0], len(res.Messages), res.DeadLettered)
+	r := make(Array, len(res.Messages))
+	for i, m := range res.Messages {
+		r[i] = Array{Bulk(m.ID.String()), Bulk(m.Message), Int(m.Deliveries)}
+	}
+	return r, nil
+}
+
+func (s *Server) handleQAck(args []string) (Reply, error) {
+	ids, err := parseStreamIDs(args[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	acked, err := s.cache.QAck(args[0], ids)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logCommand("QACK %s %v %d\n", args[0], ids, acked)
+	return Int(acked), nil
+}
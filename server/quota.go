@@ -0,0 +1,80 @@
+package server
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	"github.com/KavetiRohith/go-cache/cache"
+)
+
+// quotaUsage counts what the clients of an IP sent during the current
+// second, the quotas being enforced over fixed one second windows
+type quotaUsage struct {
+	second int64
+	ops    int
+	bytes  int
+	// commands counts the commands of QuotaCommandOps by name
+	commands map[string]int
+}
+
+// quotasEnabled reports whether any quota is set
+func (s *Server) quotasEnabled() bool {
+	return s.QuotaOpsPerSec > 0 || s.QuotaBytesPerSec > 0 || len(s.QuotaCommandOps) > 0
+}
+
+// checkQuota counts the command args of n bytes against the quotas of
+// the IP of the client, returning a LIMIT error if it exceeds one of them
+// The commands refused count as well, so that a client retrying in a loop
+// stays limited until it slows down
+func (s *Server) checkQuota(c *clientConn, args []string, n int) error {
+	ip := c.addr
+	if host, _, err := net.SplitHostPort(c.addr); err == nil {
+		ip = host
+	}
+	now := time.Now().Unix()
+	u, ok := s.quotas[ip]
+	if !ok {
+		u = &quotaUsage{}
+		s.quotas[ip] = u
+	}
+	if u.second != now {
+		*u = quotaUsage{second: now}
+	}
+
+	u.ops++
+	u.bytes += n
+	name := strings.ToUpper(args[0])
+	var limit int
+	if limit = s.QuotaCommandOps[name]; limit > 0 {
+		if u.commands == nil {
+			u.commands = make(map[string]int)
+		}
+		u.commands[name]++
+	}
+
+	var err error
+	switch {
+	case s.QuotaOpsPerSec > 0 && u.ops > s.QuotaOpsPerSec:
+		err = cache.Errorf(cache.KindLimit, "%s exceeded the quota of %d commands per second", ip, s.QuotaOpsPerSec)
+	case s.QuotaBytesPerSec > 0 && u.bytes > s.QuotaBytesPerSec:
+		err = cache.Errorf(cache.KindLimit, "%s exceeded the quota of %d bytes per second", ip, s.QuotaBytesPerSec)
+	case limit > 0 && u.commands[name] > limit:
+		err = cache.Errorf(cache.KindLimit, "%s exceeded the quota of %d %s commands per second", ip, limit, name)
+	}
+	if err != nil {
+		s.stats.quotaRejections++
+	}
+	return err
+}
+
+// pruneQuotas drops the usage of the IPs that sent nothing during the
+// current second
+func (s *Server) pruneQuotas() {
+	now := time.Now().Unix()
+	for ip, u := range s.quotas {
+		if u.second != now {
+			delete(s.quotas, ip)
+		}
+	}
+}
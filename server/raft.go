@@ -0,0 +1,783 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/KavetiRohith/go-cache/cache"
+	"github.com/hashicorp/raft"
+	raftboltdb "github.com/hashicorp/raft-boltdb/v2"
+)
+
+const (
+	// raftApplyTimeout bounds how long a write waits to be committed
+	raftApplyTimeout = 10 * time.Second
+	// raftSnapshotsRetained is the number of snapshots kept in RaftDir
+	raftSnapshotsRetained = 2
+	// raftRestoreChunk is the number of entries of a snapshot handed to a
+	// decoding worker at once
+	raftRestoreChunk = 256
+	// raftMaxPool and raftTimeout configure the connections between the
+	// nodes
+	raftMaxPool = 3
+	raftTimeout = 10 * time.Second
+	// raftExpireSample is the number of keys with an expiry the leader
+	// looks at for expired keys on every cron
+	raftExpireSample = 200
+	// raftExpiredCommand starts the commands of the log deleting expired
+	// keys, as EXPIRED unix-time-milliseconds key ..., which clients
+	// cannot send
+	raftExpiredCommand = "EXPIRED"
+	// raftAppliedAtCommand starts the entries of the log, as APPLIEDAT
+	// unix-time-milliseconds, with the time of the leader at which the
+	// nodes apply the writes of the entry, which clients cannot send
+	raftAppliedAtCommand = "APPLIEDAT"
+)
+
+// errRaftGateways is returned by Start when the gateways are enabled in
+// Raft mode, as they cannot wait for the writes to be committed
+var errRaftGateways = errors.New("the HTTP, gRPC and memcached gateways are not supported in Raft mode")
+
+var errRaftBlocking = errors.New("the blocking commands are not supported in Raft mode")
+
+// errRaftReplica is returned for the CRDT writes tagged with the replica ID
+// of the node, which would differ on every node applying them
+var errRaftReplica = errors.New("CRDT.INCRBY and CRDT.SADD are not supported in Raft mode")
+
+var errRaftDisabled = errors.New("Raft mode is disabled")
+
+// startRaft joins this node to the Raft cluster, returning the function
+// shutting it down
+func (s *Server) startRaft(ctx context.Context) (func(), error) {
+	id := s.RaftID
+	if id == "" {
+		id = net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+	}
+	if err := os.MkdirAll(s.RaftDir, 0o755); err != nil {
+		return nil, err
+	}
+
+	store, err := raftboltdb.NewBoltStore(filepath.Join(s.RaftDir, "raft.db"))
+	if err != nil {
+		return nil, err
+	}
+	snapshots, err := raft.NewFileSnapshotStore(s.RaftDir, raftSnapshotsRetained, log.Writer())
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+	advertise, err := net.ResolveTCPAddr("tcp", s.RaftAddr)
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+	transport, err := raft.NewTCPTransport(s.RaftAddr, advertise, raftMaxPool, raftTimeout, log.Writer())
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+
+	// the nodes only delete the expired keys when the leader logs it, so
+	// that the writes using them apply the same way on every node
+	s.cache.SetExpireMode(cache.ExpireHide)
+
+	config := raft.DefaultConfig()
+	config.LocalID = raft.ServerID(id)
+	config.LogOutput = log.Writer()
+	config.LogLevel = "WARN"
+	fsm := &raftFSM{s: s, ctx: ctx}
+	r, err := raft.NewRaft(config, fsm, s.faultLogStore(store), store, s.faultSnapshotStore(snapshots), s.faultTransport(transport))
+	if err != nil {
+		transport.Close()
+		store.Close()
+		return nil, err
+	}
+	fsm.started.Store(true)
+	stop := func() {
+		r.Shutdown().Error()
+		transport.Close()
+		store.Close()
+	}
+
+	if s.RaftBootstrap {
+		servers := []raft.Server{{ID: config.LocalID, Address: transport.LocalAddr()}}
+		for _, peer := range s.RaftPeers {
+			peerID, addr, ok := strings.Cut(peer, "=")
+			if !ok {
+				stop()
+				return nil, fmt.Errorf("invalid Raft peer %q, expected id=address", peer)
+			}
+			servers = append(servers, raft.Server{ID: raft.ServerID(peerID), Address: raft.ServerAddress(addr)})
+		}
+		// bootstrapping a node that already holds a cluster state fails,
+		// which is how it restarts
+		if err := r.BootstrapCluster(raft.Configuration{Servers: servers}).Error(); err != nil && err != raft.ErrCantBootstrap {
+			stop()
+			return nil, err
+		}
+	}
+
+	s.raft = r
+	log.Println("joined the Raft cluster as", id, "on", s.RaftAddr)
+	return stop, nil
+}
+
+// routeRaft routes the commands reading or writing keys through Raft,
+// reporting whether it did. The writes are replied once committed and
+// applied, and the reads once this node confirmed it is still the leader,
+// so that they see every write committed before them. The nodes other
+// than the leader refuse both, except for the reads of the clients that
+// sent READONLY, which they serve from their own state
+func (s *Server) routeRaft(conn fDconn, parts []string) (bool, error) {
+	cmd, ok := s.lookupCommand(parts[0])
+	if !ok || cmd.checkArity(parts) != nil {
+		return false, nil
+	}
+	write, read := cmd.hasFlag(FlagWrite), cmd.hasFlag(FlagReadonly)
+	if !write && !read {
+		return false, nil
+	}
+	if cmd.hasFlag(FlagBlocking) && s.raftBlocks(cmd, parts) {
+		// the nodes would block applying the command
+		return true, errRaftBlocking
+	}
+	if cmd.Name == "CRDT.INCRBY" || cmd.Name == "CRDT.SADD" {
+		return true, errRaftReplica
+	}
+	if s.raft.State() != raft.Leader {
+		if c, ok := s.clients[conn.Fd]; ok && c.readOnly && !write {
+			return false, nil
+		}
+		return true, s.notLeaderError()
+	}
+
+	if write {
+		if cmd.Name == "SET" {
+			var err error
+			if parts, err = s.checkVersionLogged(parts); err != nil {
+				return true, err
+			}
+		}
+		parts = s.resolveWrite(cmd, parts)
+		// the expired keys the write uses are deleted first, in the same
+		// entry of the log
+		keys := cmd.keys(parts)
+		data := s.appendAppliedAt(nil)
+		data = s.appendExpired(data, keys...)
+		data = appendCommand(data, parts...)
+		s.raftWriting(cmd, keys, 1)
+		var res raftResult
+		err := s.awaitOffLoop(conn, func() error {
+			f := s.raft.Apply(data, raftApplyTimeout)
+			err := f.Error()
+			s.Post(func() { s.raftWriting(cmd, keys, -1) })
+			if err != nil {
+				return err
+			}
+			res = f.Response().(raftResult)
+			return nil
+		}, func(err error) (Reply, error) {
+			if err != nil {
+				return nil, s.raftError(err)
+			}
+			return res.reply, res.err
+		})
+		if err != errClientBlocked {
+			// the write was not logged
+			s.raftWriting(cmd, keys, -1)
+		}
+		return true, err
+	}
+	return true, s.awaitOffLoop(conn, func() error {
+		return s.raft.VerifyLeader().Error()
+	}, func(err error) (Reply, error) {
+		if err != nil {
+			return nil, s.raftError(err)
+		}
+		return s.dispatch(Client{conn: conn}, parts)
+	})
+}
+
+// raftBlocks reports whether a blocking command may block, which the nodes
+// applying it cannot do: XREAD and XREADGROUP reading new entries with
+// BLOCK, and the pops of sorted sets all empty. The pops logged once a
+// sorted set holds members reply nil when applied after another pop took
+// them
+func (s *Server) raftBlocks(cmd *Command, parts []string) bool {
+	switch cmd.Name {
+	case "BZPOPMIN", "BZPOPMAX":
+		return s.cache.Exists(parts[1:len(parts)-1]...) == 0
+	case "XREAD":
+		opts, err := parseReadOpts(parts[1:], false)
+		return err == nil && opts.block
+	case "XREADGROUP":
+		opts, err := parseReadOpts(parts[4:], true)
+		if err != nil || !opts.block {
+			return false
+		}
+		// reading the history of a consumer never blocks
+		for _, id := range opts.ids {
+			if id != ">" {
+				return false
+			}
+		}
+		return true
+	}
+	return true
+}
+
+// raftWriting counts delta writes of keys logged by the leader and not
+// applied yet, those of the commands whose keys move counting for every
+// key
+func (s *Server) raftWriting(cmd *Command, keys []string, delta int) {
+	if cmd.hasFlag(FlagMovableKeys) {
+		s.raftWritingAll += delta
+		return
+	}
+	if s.raftWritingKeys == nil {
+		s.raftWritingKeys = make(map[string]int)
+	}
+	for _, key := range keys {
+		if s.raftWritingKeys[key] += delta; s.raftWritingKeys[key] <= 0 {
+			delete(s.raftWritingKeys, key)
+		}
+	}
+}
+
+// checkVersionLogged checks the version of SET IFVERSION on the leader,
+// returning the SET to log without IFVERSION. Each node numbers the
+// versions itself, so the nodes applying the log could not agree on the
+// check. A key with a write logged but not applied yet is in conflict,
+// its version being about to change
+func (s *Server) checkVersionLogged(parts []string) ([]string, error) {
+	n := len(parts)
+	if n < 5 || !strings.EqualFold(parts[n-2], "IFVERSION") {
+		return parts, nil
+	}
+	if s.raftWritingAll > 0 || s.raftWritingKeys[parts[1]] > 0 {
+		return nil, cache.Errorf(cache.KindConflict, "the key has a write in flight")
+	}
+	if err := s.checkVersion(parts[1], parts[n-1]); err != nil {
+		return nil, err
+	}
+	return parts[:n-2], nil
+}
+
+// resolveWrite returns the writes reading the clock in forms applied the
+// same way on every node whatever its clock, and again once the log is
+// replayed after a restart: the relative expiries become unix times and
+// the stream IDs generated by the server become explicit, the sequence
+// number left to the nodes for the writes logged within the same
+// millisecond
+func (s *Server) resolveWrite(cmd *Command, parts []string) []string {
+	now := s.cache.Now().UnixMilli()
+	at := func(n, unit int64) string {
+		return strconv.FormatInt(now+n*unit, 10)
+	}
+	positive := func(arg string) (int64, bool) {
+		n, err := strconv.ParseInt(arg, 10, 64)
+		return n, err == nil && n > 0
+	}
+
+	switch cmd.Name {
+	case "SCHEDULE":
+		return s.scheduleAt(parts)
+	case "SET":
+		rest := parts[3:]
+		if n := len(parts); n >= 5 && strings.EqualFold(parts[n-2], "IFVERSION") {
+			rest = parts[3 : n-2]
+		}
+		if len(rest) == 1 {
+			if ttl, ok := positive(rest[0]); ok {
+				resolved := append([]string{}, parts[:3]...)
+				resolved = append(resolved, "PXAT", at(ttl, 1000))
+				return append(resolved, parts[4:]...)
+			}
+		}
+	case "GETEX":
+		if len(parts) == 4 {
+			n, ok := positive(parts[3])
+			switch opt := strings.ToUpper(parts[2]); {
+			case ok && opt == "EX":
+				return []string{parts[0], parts[1], "PXAT", at(n, 1000)}
+			case ok && opt == "PX":
+				return []string{parts[0], parts[1], "PXAT", at(n, 1)}
+			}
+		}
+	case "LOCK":
+		if len(parts) == 4 {
+			if ttl, ok := positive(parts[3]); ok {
+				return []string{parts[0], parts[1], parts[2], "PXAT", at(ttl, 1)}
+			}
+		}
+	case "RESTORE":
+		for _, opt := range parts[4:] {
+			if strings.EqualFold(opt, "ABSTTL") {
+				return parts
+			}
+		}
+		if ttl, ok := positive(parts[2]); ok {
+			resolved := append([]string{}, parts...)
+			resolved[2] = at(ttl, 1)
+			return append(resolved, "ABSTTL")
+		}
+	case "XADD":
+		i := 2
+		if strings.EqualFold(parts[i], "MAXLEN") {
+			i += 2
+			if i < len(parts) && (parts[i-1] == "=" || parts[i-1] == "~") {
+				i++
+			}
+		}
+		if i < len(parts) && parts[i] == "*" {
+			resolved := append([]string{}, parts...)
+			resolved[i] = s.streamIDAt(parts[1], now)
+			return resolved
+		}
+	case "QADD":
+		if len(parts) == 3 {
+			return append(parts[:3:3], s.streamIDAt(parts[1], now))
+		}
+	}
+	return parts
+}
+
+// streamIDAt returns the ID spec of the next entry of the stream stored at
+// key at the unix time now in milliseconds, or that of the last entry if
+// the clock is behind it, the nodes numbering the entries logged within
+// the same millisecond
+func (s *Server) streamIDAt(key string, now int64) string {
+	ms := uint64(now)
+	if last, err := s.cache.XLastID(key); err == nil && last.Ms > ms {
+		ms = last.Ms
+	}
+	return strconv.FormatUint(ms, 10) + "-*"
+}
+
+// readOnlyHandler implements READONLY and, when readOnly is not set,
+// READWRITE, which let the connection read from the nodes other than the
+// leader, at the cost of missing the writes they did not apply yet, or
+// stop it again
+func readOnlyHandler(readOnly bool) CommandFunc {
+	return func(s *Server, client Client, _ []string) (Reply, error) {
+		if s.raft == nil {
+			return nil, errRaftDisabled
+		}
+		if c, ok := s.clients[client.conn.Fd]; ok {
+			c.readOnly = readOnly
+		}
+		return OK, nil
+	}
+}
+
+// appendAppliedAt appends to b the command giving the time of the leader
+// to the writes of an entry of the log
+func (s *Server) appendAppliedAt(b []byte) []byte {
+	return appendCommand(b, raftAppliedAtCommand, strconv.FormatInt(s.cache.Now().UnixMilli(), 10))
+}
+
+// appendExpired appends to b the command deleting the keys that expired,
+// if any
+func (s *Server) appendExpired(b []byte, keys ...string) []byte {
+	args := []string{raftExpiredCommand, strconv.FormatInt(s.cache.Now().UnixMilli(), 10)}
+	for _, key := range keys {
+		if s.cache.Expired(key) {
+			args = append(args, key)
+		}
+	}
+	if len(args) == 2 {
+		return b
+	}
+	return appendCommand(b, args...)
+}
+
+// expireRaftKeys has the leader log the deletion of the expired keys among
+// a sample of the keys with an expiry, unless it is still logging the last
+// ones. The nodes delete them once they apply it, spared the keys written
+// again since. It reports whether the keys expire faster than they are
+// logged, a quarter of the sample being expired or the last ones not
+// logged yet
+func (s *Server) expireRaftKeys() bool {
+	if s.raft.State() != raft.Leader {
+		return false
+	}
+	if s.raftExpiring.Load() {
+		return true
+	}
+	keys := s.cache.ExpiredKeys(raftExpireSample)
+	data := s.appendExpired(nil, keys...)
+	if data == nil {
+		return false
+	}
+	s.raftExpiring.Store(true)
+	go func() {
+		if err := s.raft.Apply(data, raftApplyTimeout).Error(); err != nil {
+			log.Println("raft: logging the expired keys:", err)
+		}
+		s.raftExpiring.Store(false)
+	}()
+	return len(keys) >= raftExpireSample/4
+}
+
+func (s *Server) notLeaderError() error {
+	if _, id := s.raft.LeaderWithID(); id != "" {
+		return cache.Errorf(cache.KindNotLeader, "the leader is %s", id)
+	}
+	return &cache.Error{Kind: cache.KindNotLeader, Msg: "no leader is elected"}
+}
+
+func (s *Server) raftError(err error) error {
+	if err == raft.ErrNotLeader || err == raft.ErrLeadershipLost {
+		return s.notLeaderError()
+	}
+	return fmt.Errorf("raft: %v", err)
+}
+
+// handleRaft implements RAFT INFO | SNAPSHOT | ADDNODE id address |
+// REMOVENODE id, the nodes being added as voters through the leader
+func (s *Server) handleRaft(client Client, args []string) (Reply, error) {
+	if s.raft == nil {
+		return nil, errRaftDisabled
+	}
+
+	var change func() raft.IndexFuture
+	switch strings.ToUpper(args[0]) {
+	case "INFO":
+		return Bulk(s.raftInfo()), nil
+	case "SNAPSHOT":
+		// the snapshot is taken by any node, compacting its own log
+		return nil, s.awaitOffLoop(client.conn, func() error {
+			return s.raft.Snapshot().Error()
+		}, func(err error) (Reply, error) {
+			if err != nil {
+				return nil, s.raftError(err)
+			}
+			return OK, nil
+		})
+	case "ADDNODE":
+		change = func() raft.IndexFuture {
+			return s.raft.AddVoter(raft.ServerID(args[1]), raft.ServerAddress(args[2]), 0, raftApplyTimeout)
+		}
+	case "REMOVENODE":
+		change = func() raft.IndexFuture {
+			return s.raft.RemoveServer(raft.ServerID(args[1]), 0, raftApplyTimeout)
+		}
+	default:
+		return nil, fmt.Errorf("unknown subcommand '%s'", args[0])
+	}
+
+	if s.raft.State() != raft.Leader {
+		return nil, s.notLeaderError()
+	}
+	s.logCommand("RAFT %v\n", args)
+	return nil, s.awaitOffLoop(client.conn, func() error {
+		return change().Error()
+	}, func(err error) (Reply, error) {
+		if err != nil {
+			return nil, s.raftError(err)
+		}
+		return OK, nil
+	})
+}
+
+// raftInfo returns the state of the node in the format of INFO
+func (s *Server) raftInfo() string {
+	stats := s.raft.Stats()
+	_, leader := s.raft.LeaderWithID()
+	stats["leader_id"] = string(leader)
+	names := make([]string, 0, len(stats))
+	for name := range stats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&b, "%s:%s\r\n", name, stats[name])
+	}
+	return b.String()
+}
+
+// raftFSM applies the committed writes to the cache through the event
+// loop, which owns it
+type raftFSM struct {
+	s *Server
+	// ctx is done once the event loop stopped
+	ctx context.Context
+	// started is set once NewRaft returned, having restored the latest
+	// snapshot before the event loop runs
+	started atomic.Bool
+}
+
+// raftResult is the reply of a write applied by the FSM
+type raftResult struct {
+	reply Reply
+	err   error
+}
+
+// Apply runs the commands of an entry in order, replying with the result
+// of the last one
+func (f *raftFSM) Apply(l *raft.Log) any {
+	var cmds [][]string
+	r := bufio.NewReader(bytes.NewReader(l.Data))
+	for {
+		args, _, _, err := readLogCommand(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return raftResult{err: err}
+		}
+		cmds = append(cmds, args)
+	}
+
+	// the entries logged without the time of the leader, such as the
+	// deletions of expired keys, are applied at the time of the node
+	var at int64
+	if len(cmds) > 0 && len(cmds[0]) == 2 && cmds[0][0] == raftAppliedAtCommand {
+		var err error
+		if at, err = strconv.ParseInt(cmds[0][1], 10, 64); err != nil {
+			return raftResult{err: err}
+		}
+		cmds = cmds[1:]
+	}
+
+	var res raftResult
+	apply := func() {
+		f.s.keepingExpired(func() {
+			for _, args := range cmds {
+				res.reply, res.err = f.s.applyRaft(args)
+			}
+		})
+	}
+	if err := f.s.runOnLoop(f.ctx, func() {
+		if at == 0 {
+			apply()
+			return
+		}
+		// the random numbers are seeded with the index of the entry,
+		// the same on every node
+		f.s.cache.ApplyAt(time.UnixMilli(at), int64(l.Index), apply)
+	}); err != nil {
+		return raftResult{err: err}
+	}
+	return res
+}
+
+// applyRaft runs a command of the log
+func (s *Server) applyRaft(args []string) (Reply, error) {
+	if args[0] != raftExpiredCommand {
+		return s.dispatch(Client{conn: gatewayClient}, args)
+	}
+	at, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	n := s.cache.DeleteExpired(at, args[2:]...)
+	s.logCommand("EXPIRED %d %v %d\n", at, args[2:], n)
+	return Int(n), nil
+}
+
+// keepingExpired runs fn with the expired keys read as present, for the
+// log to be applied the same way on every node whatever its clock
+func (s *Server) keepingExpired(fn func()) {
+	s.cache.SetExpireMode(cache.ExpireKeep)
+	defer s.cache.SetExpireMode(cache.ExpireHide)
+	fn()
+}
+
+// raftSnapshot holds the keys of the cache as DUMP payloads
+type raftSnapshot struct {
+	entries []raftEntry
+}
+
+type raftEntry struct {
+	key       string
+	expiresAt int64
+	payload   []byte
+}
+
+func (f *raftFSM) Snapshot() (raft.FSMSnapshot, error) {
+	snap := &raftSnapshot{}
+	var dumpErr error
+	err := f.s.runOnLoop(f.ctx, func() {
+		// the expired keys are kept until the log deletes them
+		f.s.keepingExpired(func() {
+			keys, _, _ := f.s.cache.Scan(0, f.s.cache.Len()+1, "")
+			for _, key := range keys {
+				payload, ok, err := f.s.cache.Dump(key)
+				if err != nil {
+					dumpErr = fmt.Errorf("dumping %q: %v", key, err)
+					return
+				}
+				if ok {
+					snap.entries = append(snap.entries, raftEntry{key, f.s.cache.ExpireTime(key), payload})
+				}
+			}
+		})
+	})
+	if err == nil {
+		err = dumpErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+// Persist writes the entries as their key, expiry and payload, each
+// prefixed by its length
+func (snap *raftSnapshot) Persist(sink raft.SnapshotSink) error {
+	w := bufio.NewWriter(sink)
+	var buf []byte
+	for _, e := range snap.entries {
+		buf = binary.AppendUvarint(buf[:0], uint64(len(e.key)))
+		buf = append(buf, e.key...)
+		buf = binary.AppendVarint(buf, e.expiresAt)
+		buf = binary.AppendUvarint(buf, uint64(len(e.payload)))
+		if _, err := w.Write(buf); err != nil {
+			sink.Cancel()
+			return err
+		}
+		if _, err := w.Write(e.payload); err != nil {
+			sink.Cancel()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		sink.Cancel()
+		return err
+	}
+	return sink.Close()
+}
+
+func (snap *raftSnapshot) Release() {}
+
+// decodeSnapshot reads the entries of a snapshot and decodes their
+// payloads on a worker per CPU, each filling a batch of its own, so that
+// the loop is only left with the stores. The keys of a snapshot being
+// distinct, the batches apply in any order
+func decodeSnapshot(r *bufio.Reader) ([]*cache.Batch, error) {
+	workers := runtime.GOMAXPROCS(0)
+	chunks := make(chan []raftEntry, workers)
+	batches := make([]*cache.Batch, workers)
+	errs := make([]error, workers)
+	var wg sync.WaitGroup
+	for i := range batches {
+		batches[i] = &cache.Batch{}
+		wg.Add(1)
+		go func(batch *cache.Batch, err *error) {
+			defer wg.Done()
+			for chunk := range chunks {
+				for _, e := range chunk {
+					if *err != nil {
+						break
+					}
+					if restoreErr := batch.Restore(e.key, e.payload, e.expiresAt); restoreErr != nil {
+						*err = fmt.Errorf("restoring %q: %v", e.key, restoreErr)
+					}
+				}
+			}
+		}(batches[i], &errs[i])
+	}
+
+	readErr := readSnapshot(r, chunks)
+	close(chunks)
+	wg.Wait()
+	if readErr != nil {
+		return nil, readErr
+	}
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return batches, nil
+}
+
+// readSnapshot reads the entries of a snapshot, sending them to chunks
+// raftRestoreChunk at a time
+func readSnapshot(r *bufio.Reader, chunks chan<- []raftEntry) error {
+	chunk := make([]raftEntry, 0, raftRestoreChunk)
+	for {
+		n, err := binary.ReadUvarint(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		key := make([]byte, n)
+		if _, err := io.ReadFull(r, key); err != nil {
+			return err
+		}
+		expiresAt, err := binary.ReadVarint(r)
+		if err != nil {
+			return err
+		}
+		if n, err = binary.ReadUvarint(r); err != nil {
+			return err
+		}
+		payload := make([]byte, n)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return err
+		}
+
+		chunk = append(chunk, raftEntry{string(key), expiresAt, payload})
+		if len(chunk) == raftRestoreChunk {
+			chunks <- chunk
+			chunk = make([]raftEntry, 0, raftRestoreChunk)
+		}
+	}
+	if len(chunk) > 0 {
+		chunks <- chunk
+	}
+	return nil
+}
+
+// Restore replaces the keys of the cache with those of the snapshot
+func (f *raftFSM) Restore(rc io.ReadCloser) error {
+	defer rc.Close()
+	batches, err := decodeSnapshot(bufio.NewReader(rc))
+	if err != nil {
+		return err
+	}
+
+	restore := func() {
+		f.s.cache.FlushAll(true)
+		f.s.invalidateAll()
+		f.s.uncacheReplies(nil)
+		f.s.clearIndexes()
+		f.s.flushHistory()
+		for _, batch := range batches {
+			f.s.cache.Apply(batch)
+		}
+		if len(f.s.indexes) > 0 {
+			keys, _, _ := f.s.cache.Scan(0, f.s.cache.Len()+1, "")
+			for _, key := range keys {
+				f.s.reindex(key)
+			}
+		}
+	}
+	if !f.started.Load() {
+		f.s.keepingExpired(restore)
+		return nil
+	}
+	return f.s.runOnLoop(f.ctx, func() { f.s.keepingExpired(restore) })
+}
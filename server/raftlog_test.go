@@ -0,0 +1,74 @@
+package server_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/KavetiRohith/go-cache/cache"
+	"github.com/KavetiRohith/go-cache/server"
+	"github.com/KavetiRohith/go-cache/server/servertest"
+)
+
+// TestRaftLogDeterministic applies the same log of writes reading the clock
+// or random numbers to two servers whose clocks disagree, as two nodes of a
+// cluster would, and checks that they end up with the same keys
+func TestRaftLogDeterministic(t *testing.T) {
+	leader := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	log := [][]string{
+		{"CL.THROTTLE", "throttle", "5", "10", "60", "1"},
+		{"SET", "soft", "v"},
+		{"SOFTEXPIRE", "soft", "10"},
+		{"ZADD", "zset", "1", "a"},
+		{"QADD", "queue", "job", "1000-1"},
+		{"QREAD", "queue", "VISIBILITY", "30000"},
+		{"XADD", "stream", "1-1", "field", "value"},
+		{"XGROUP", "CREATE", "stream", "group", "0"},
+		{"XREADGROUP", "GROUP", "group", "alice", "STREAMS", "stream", ">"},
+		{"XCLAIM", "stream", "group", "bob", "0", "1-1"},
+		{"XAUTOCLAIM", "stream", "group", "carol", "0", "0"},
+		{"CF.RESERVE", "cuckoo", "64"},
+		{"TOPK.RESERVE", "topk", "2", "4", "2", "0.5"},
+	}
+	for i := 0; i < 64; i++ {
+		log = append(log,
+			[]string{"CF.ADD", "cuckoo", fmt.Sprint("item", i)},
+			[]string{"TOPK.ADD", "topk", fmt.Sprint("item", i%5)},
+		)
+	}
+
+	var caches []*cache.Cache
+	for _, skew := range []time.Duration{-2 * time.Second, 2 * time.Second} {
+		c := cache.New(
+			cache.WithClock(cache.NewManualClock(leader.Add(skew))),
+			cache.WithDefaultTTL(time.Hour, nil),
+			cache.WithTTLJitter(0.5),
+		)
+		s := servertest.NewServer(t, server.ServerOpts{}, c)
+		for i, args := range log {
+			// the cuckoo filter fills up, which does not matter
+			_ = server.ApplyRaftEntry(s.Server, uint64(i+1), leader.Add(time.Duration(i)*time.Millisecond).UnixMilli(), args)
+		}
+		s.Close()
+		caches = append(caches, c)
+	}
+
+	a, b := caches[0], caches[1]
+	for _, key := range []string{"throttle", "soft", "zset", "queue", "stream", "cuckoo", "topk"} {
+		dumpA, okA, errA := a.Dump(key)
+		dumpB, okB, errB := b.Dump(key)
+		if errA != nil || errB != nil || !okA || !okB {
+			t.Fatalf("DUMP %s: %v %v, %v %v", key, okA, errA, okB, errB)
+		}
+		if !bytes.Equal(dumpA, dumpB) {
+			t.Errorf("DUMP %s differs between the nodes", key)
+		}
+		if expA, expB := a.ExpireTime(key), b.ExpireTime(key); expA != expB {
+			t.Errorf("%s expires at %d and %d", key, expA, expB)
+		}
+		if staleA, staleB := a.StaleTime(key), b.StaleTime(key); staleA != staleB {
+			t.Errorf("%s goes stale at %d and %d", key, staleA, staleB)
+		}
+	}
+}
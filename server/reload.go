@@ -0,0 +1,96 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+)
+
+// reloadableOpts are the options Reload changes on a running server, as
+// they are read whenever they are used. The others are only read by Start
+var reloadableOpts = map[string]bool{
+	"CronFrequency":                 true,
+	"ExpireMinInterval":             true,
+	"ProtoMaxBulkLen":               true,
+	"ProtoMaxMultibulkLen":          true,
+	"ProtoMaxInlineLen":             true,
+	"ClientQueryBufferLimit":        true,
+	"ClientOutputBufferLimitNormal": true,
+	"ClientOutputBufferLimitPubsub": true,
+	"StrictText":                    true,
+	"TCPNoDelay":                    true,
+	"AllowCIDRs":                    true,
+	"DenyCIDRs":                     true,
+	"MaxConnsPerIP":                 true,
+	"ProtectedMode":                 true,
+	"SlowlogLogSlowerThan":          true,
+	"SlowlogMaxLen":                 true,
+	"HotKeysWindow":                 true,
+	"LatencyMonitorThreshold":       true,
+	"ReadOnly":                      true,
+	"LogLevel":                      true,
+	"QuietCommands":                 true,
+	"QuotaOpsPerSec":                true,
+	"QuotaBytesPerSec":              true,
+	"QuotaCommandOps":               true,
+	"OverloadLatency":               true,
+	"OverloadPendingBytes":          true,
+	"ReplyCacheSize":                true,
+	"HistoryVersions":               true,
+	"HistoryKeyBytes":               true,
+	"HistoryMaxBytes":               true,
+	"DefragThreshold":               true,
+	"DefragIgnoreBytes":             true,
+	"ScrubKeys":                     true,
+	"ScrubRepair":                   true,
+	"DrainTimeout":                  true,
+	"DrainRedirect":                 true,
+}
+
+// Reload replaces the options of the running server by opts on the event
+// loop, from the next cron run for CronFrequency and the next connection
+// for TCPNoDelay. If an option that requires a restart differs, nothing is
+// changed and the error names the options at fault
+func (s *Server) Reload(ctx context.Context, opts ServerOpts) error {
+	if opts.CronFrequency <= 0 {
+		return errors.New("the cron frequency must be positive")
+	}
+	opts.setDefaults()
+	if err := checkLogLevel(opts.LogLevel); err != nil {
+		return err
+	}
+
+	var err error
+	if loopErr := s.runOnLoop(ctx, func() { err = s.reload(opts) }); loopErr != nil {
+		return loopErr
+	}
+	return err
+}
+
+func (s *Server) reload(opts ServerOpts) error {
+	cur, next := reflect.ValueOf(&s.ServerOpts).Elem(), reflect.ValueOf(opts)
+	var changed, restart []string
+	for i := 0; i < cur.NumField(); i++ {
+		name := cur.Type().Field(i).Name
+		if reflect.DeepEqual(cur.Field(i).Interface(), next.Field(i).Interface()) {
+			continue
+		}
+		if reloadableOpts[name] {
+			changed = append(changed, name)
+		} else {
+			restart = append(restart, name)
+		}
+	}
+	if len(restart) > 0 {
+		return fmt.Errorf("%s cannot change without a restart", strings.Join(restart, ", "))
+	}
+
+	s.ServerOpts = opts
+	if len(changed) > 0 {
+		log.Println("reloaded", strings.Join(changed, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ReplayOpts configures Replay
+type ReplayOpts struct {
+	// Speed divides the delays between the commands given by the #TS
+	// annotations of the log, 1 replaying them at their original pace.
+	// Zero replays the commands as fast as possible
+	Speed float64
+	// CompareAddr is the address of a server the commands are sent to as
+	// well, whose replies are compared with those of the replay, which is
+	// disabled when empty
+	CompareAddr string
+	// Out receives a line for every command failing or whose reply diverges
+	Out io.Writer
+	// LoadTruncated replays a log ending within a command, as left by a
+	// crash while it was written, up to its last whole command rather than
+	// failing
+	LoadTruncated bool
+}
+
+// ReplayStats counts the commands replayed by Replay
+type ReplayStats struct {
+	Commands, Errors, Skipped, Divergences int
+}
+
+// Replay runs the commands of a log in the format of an append only file,
+// RESP arrays optionally preceded by #TS:unix-time annotations, against
+// the server, which must not be started, to reproduce the state and the
+// replies that led to a bug. Blocking commands are skipped, as they would
+// wait forever without the event loop
+func (s *Server) Replay(r io.Reader, opts ReplayOpts) (ReplayStats, error) {
+	var stats ReplayStats
+	var ref net.Conn
+	var refReader *bufio.Reader
+	if opts.CompareAddr != "" {
+		conn, err := net.Dial("tcp", opts.CompareAddr)
+		if err != nil {
+			return stats, err
+		}
+		defer conn.Close()
+		ref, refReader = conn, bufio.NewReader(conn)
+	}
+	if opts.Out == nil {
+		opts.Out = io.Discard
+	}
+
+	commands := bufio.NewReader(r)
+	var start time.Time
+	var firstTS int64
+	for {
+		args, ts, _, err := readLogCommand(commands)
+		if err == io.EOF {
+			return stats, nil
+		}
+		if err == io.ErrUnexpectedEOF && opts.LoadTruncated {
+			fmt.Fprintf(opts.Out, "%d: log truncated within the command, ignored\n", stats.Commands+1)
+			return stats, nil
+		}
+		if err != nil {
+			return stats, fmt.Errorf("command %d of the log: %v", stats.Commands+1, err)
+		}
+		if ts != 0 && opts.Speed > 0 {
+			if start.IsZero() {
+				start, firstTS = time.Now(), ts
+			}
+			elapsed := time.Duration(float64(time.Duration(ts-firstTS)*time.Second) / opts.Speed)
+			time.Sleep(time.Until(start.Add(elapsed)))
+		}
+		if args == nil {
+			continue
+		}
+		stats.Commands++
+
+		if cmd, ok := s.lookupCommand(args[0]); ok && cmd.hasFlag(FlagBlocking) {
+			stats.Skipped++
+			fmt.Fprintf(opts.Out, "%d %s: skipped blocking command\n", stats.Commands, strings.Join(args, " "))
+			continue
+		}
+		reply, err := s.dispatch(Client{conn: gatewayClient}, args)
+		var got []byte
+		if err != nil {
+			stats.Errors++
+			got = errorRESP(nil, err)
+			fmt.Fprintf(opts.Out, "%d %s: %s\n", stats.Commands, strings.Join(args, " "), formatError(err))
+		} else {
+			got = reply.appendRESP(nil)
+		}
+
+		if ref == nil {
+			continue
+		}
+		if _, err := ref.Write(appendCommand(nil, args...)); err != nil {
+			return stats, err
+		}
+		want, err := readRESPFrame(refReader, nil)
+		if err != nil {
+			return stats, err
+		}
+		if !bytes.Equal(got, want) {
+			stats.Divergences++
+			fmt.Fprintf(opts.Out, "%d %s: replied %q, %s replied %q\n", stats.Commands, strings.Join(args, " "), got, opts.CompareAddr, want)
+		}
+	}
+}
+
+// readLogCommand reads the next command of a log, or the time of a #TS
+// annotation with nil args, along with the number of bytes read. It
+// returns io.EOF at the end of the log and io.ErrUnexpectedEOF if the log
+// ends within a command
+func readLogCommand(r *bufio.Reader) ([]string, int64, int, error) {
+	line, err := r.ReadString('\n')
+	read := len(line)
+	if err == io.EOF && line == "" {
+		return nil, 0, read, io.EOF
+	}
+	if err != nil {
+		return nil, 0, read, io.ErrUnexpectedEOF
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+
+	if strings.HasPrefix(line, "#") {
+		ts, _ := strconv.ParseInt(strings.TrimPrefix(line, "#TS:"), 10, 64)
+		return nil, ts, read, nil
+	}
+	if !strings.HasPrefix(line, "*") {
+		return nil, 0, read, fmt.Errorf("expected a RESP array, got %q", line)
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n <= 0 {
+		return nil, 0, read, fmt.Errorf("invalid array length %q", line[1:])
+	}
+
+	args := make([]string, n)
+	for i := range args {
+		line, err := r.ReadString('\n')
+		read += len(line)
+		if err != nil {
+			return nil, 0, read, io.ErrUnexpectedEOF
+		}
+		if !strings.HasPrefix(line, "$") || !strings.HasSuffix(line, "\r\n") {
+			return nil, 0, read, fmt.Errorf("expected a bulk string, got %q", line)
+		}
+		size, err := strconv.Atoi(line[1 : len(line)-2])
+		if err != nil || size < 0 {
+			return nil, 0, read, fmt.Errorf("invalid bulk length %q", line[1:len(line)-2])
+		}
+		buf := make([]byte, size+2)
+		m, err := io.ReadFull(r, buf)
+		read += m
+		if err != nil {
+			return nil, 0, read, io.ErrUnexpectedEOF
+		}
+		if !bytes.HasSuffix(buf, []byte("\r\n")) {
+			return nil, 0, read, fmt.Errorf("bulk string of %d bytes not terminated by CRLF", size)
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, 0, read, nil
+}
+
+// readRESPFrame appends the next reply read from r to b as it was
+// received
+func readRESPFrame(r *bufio.Reader, b []byte) ([]byte, error) {
+	line, err := r.ReadBytes('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 {
+		return nil, protocolError(fmt.Sprintf("malformed reply %q", line))
+	}
+	b = append(b, line...)
+
+	switch line[0] {
+	case '$', '=', '!':
+		n, err := strconv.Atoi(string(line[1 : len(line)-2]))
+		if err != nil || n < 0 {
+			return b, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return append(b, buf...), nil
+	case '*', '~', '>', '%':
+		n, err := strconv.Atoi(string(line[1 : len(line)-2]))
+		if err != nil || n < 0 {
+			return b, err
+		}
+		if line[0] == '%' {
+			n *= 2
+		}
+		for i := 0; i < n; i++ {
+			if b, err = readRESPFrame(r, b); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return b, nil
+}
@@ -0,0 +1,245 @@
+package server
+
+import "strconv"
+
+// Reply is the result of a command. Replies are written in RESP to clients
+// sending RESP arrays and in the text protocol to clients sending inline commands
+type Reply interface {
+	appendRESP(b []byte) []byte
+	// appendText renders the reply in the text protocol, nested being
+	// set for the elements of an array that is itself inside an array
+	appendText(b []byte, nested bool) []byte
+}
+
+var (
+	// OK acknowledges a successful command. It is written as "Success"
+	// in the text protocol
+	OK Reply = statusReply{resp: "OK", text: "Success"}
+	// Nil is the reply for missing values
+	Nil Reply = nilReply{}
+)
+
+// Status returns a simple string reply
+func Status(s string) Reply {
+	return statusReply{resp: s, text: s}
+}
+
+type statusReply struct {
+	resp, text string
+}
+
+func (r statusReply) appendRESP(b []byte) []byte {
+	b = append(b, '+')
+	b = append(b, r.resp...)
+	return append(b, "\r\n"...)
+}
+
+func (r statusReply) appendText(b []byte, _ bool) []byte {
+	return append(b, r.text...)
+}
+
+type nilReply struct{}
+
+func (nilReply) appendRESP(b []byte) []byte {
+	return append(b, "$-1\r\n"...)
+}
+
+func (nilReply) appendText(b []byte, _ bool) []byte {
+	return append(b, "(nil)"...)
+}
+
+// Bulk is a binary safe string reply
+type Bulk []byte
+
+func (r Bulk) appendRESP(b []byte) []byte {
+	b = appendBulkHeader(b, len(r))
+	b = append(b, r...)
+	return append(b, "\r\n"...)
+}
+
+// appendBulkHeader appends the "$<n>\r\n" header of a bulk string of n bytes
+func appendBulkHeader(b []byte, n int) []byte {
+	b = append(b, '$')
+	b = strconv.AppendInt(b, int64(n), 10)
+	return append(b, "\r\n"...)
+}
+
+func (r Bulk) appendText(b []byte, _ bool) []byte {
+	return append(b, r...)
+}
+
+// Int is an integer reply
+type Int int64
+
+func (r Int) appendRESP(b []byte) []byte {
+	b = append(b, ':')
+	b = strconv.AppendInt(b, int64(r), 10)
+	return append(b, "\r\n"...)
+}
+
+func (r Int) appendText(b []byte, _ bool) []byte {
+	return strconv.AppendInt(b, int64(r), 10)
+}
+
+// Array is a reply made of other replies. In the text protocol the elements
+// are written one per line, or separated by spaces in a nested array
+type Array []Reply
+
+func (r Array) appendRESP(b []byte) []byte {
+	b = append(b, '*')
+	b = strconv.AppendInt(b, int64(len(r)), 10)
+	b = append(b, "\r\n"...)
+	for _, elem := range r {
+		b = elem.appendRESP(b)
+	}
+	return b
+}
+
+func (r Array) appendText(b []byte, nested bool) []byte {
+	if len(r) == 0 {
+		return append(b, "(empty array)"...)
+	}
+
+	sep := byte('\n')
+	if nested {
+		sep = ' '
+	}
+	for i, elem := range r {
+		if i > 0 {
+			b = append(b, sep)
+		}
+		b = elem.appendText(b, true)
+	}
+	return b
+}
+
+// mapReply is a RESP3 map made of alternating keys and values, only sent
+// to clients that switched to RESP3. It is written like an array in the
+// text protocol
+type mapReply []Reply
+
+func (r mapReply) appendRESP(b []byte) []byte {
+	b = append(b, '%')
+	b = strconv.AppendInt(b, int64(len(r)/2), 10)
+	b = append(b, "\r\n"...)
+	for _, elem := range r {
+		b = elem.appendRESP(b)
+	}
+	return b
+}
+
+func (r mapReply) appendText(b []byte, nested bool) []byte {
+	return Array(r).appendText(b, nested)
+}
+
+// pushReply is a RESP3 push, an out of band message such as an
+// invalidation, only sent to clients that switched to RESP3
+type pushReply []Reply
+
+func (r pushReply) appendRESP(b []byte) []byte {
+	b = append(b, '>')
+	b = strconv.AppendInt(b, int64(len(r)), 10)
+	b = append(b, "\r\n"...)
+	for _, elem := range r {
+		b = elem.appendRESP(b)
+	}
+	return b
+}
+
+func (r pushReply) appendText(b []byte, nested bool) []byte {
+	return Array(r).appendText(b, nested)
+}
+
+// replies are several replies written back to back, such as the
+// confirmations of SUBSCRIBE for each of its channels
+type replies []Reply
+
+func (r replies) appendRESP(b []byte) []byte {
+	for _, elem := range r {
+		b = elem.appendRESP(b)
+	}
+	return b
+}
+
+func (r replies) appendText(b []byte, _ bool) []byte {
+	for i, elem := range r {
+		if i > 0 {
+			b = append(b, '\n')
+		}
+		b = elem.appendText(b, false)
+	}
+	return b
+}
+
+// textReply overrides the text rendering of a reply
+type textReply struct {
+	Reply
+	text []byte
+}
+
+// withText returns a reply written as r in RESP and as text in the text
+// protocol, for replies whose text layout does not follow the structure of r
+func withText(r Reply, text []byte) Reply {
+	return textReply{Reply: r, text: text}
+}
+
+func (r textReply) appendText(b []byte, _ bool) []byte {
+	return append(b, r.text...)
+}
+
+// quotedBulk is a bulk string written quoted in the text protocol, as
+// redis-cli prints it, for the strict text protocol
+type quotedBulk []byte
+
+func (r quotedBulk) appendRESP(b []byte) []byte {
+	return Bulk(r).appendRESP(b)
+}
+
+func (r quotedBulk) appendText(b []byte, _ bool) []byte {
+	return strconv.AppendQuote(b, string(r))
+}
+
+// strictText returns r with its bulk strings, nested ones included, quoted
+// in the text protocol, so that a missing value written (nil) differs from
+// the string "(nil)", the empty string from an empty array or line, and a
+// string holding a newline stays on one line. The replies with a text of
+// their own are left as they are
+func strictText(r Reply) Reply {
+	switch r := r.(type) {
+	case Bulk:
+		return quotedBulk(r)
+	case Array:
+		return Array(strictTextAll(r))
+	case mapReply:
+		return mapReply(strictTextAll(r))
+	case pushReply:
+		return pushReply(strictTextAll(r))
+	case replies:
+		return replies(strictTextAll(r))
+	}
+	return r
+}
+
+func strictTextAll(rs []Reply) []Reply {
+	quoted := make([]Reply, len(rs))
+	for i, r := range rs {
+		quoted[i] = strictText(r)
+	}
+	return quoted
+}
+
+// bulks returns an array of bulk strings
+func bulks(strs []string) Array {
+	arr := make(Array, len(strs))
+	for i, s := range strs {
+		arr[i] = Bulk(s)
+	}
+	return arr
+}
+
+// errorRESP renders an error reply in RESP, prefixed by the kind of the error
+func errorRESP(b []byte, err error) []byte {
+	b = append(b, '-')
+	b = append(b, formatError(err)...)
+	return append(b, "\r\n"...)
+}
@@ -0,0 +1,64 @@
+package server
+
+// replyCache holds the values of the strings read by GET that had to be
+// decoded, such as the compressed, checksummed and integer strings, so that
+// the repeated reads of the hot keys skip the decoding. An entry is
+// dropped when its key is written, expires or is evicted, and the cache
+// holds up to ReplyCacheSize entries, a random one making room for a new
+// one
+type replyCache struct {
+	entries map[string]Bulk
+	hits    int64
+	misses  int64
+}
+
+// cachedGet returns the value of key held by the reply cache, the access
+// counting as one of the key
+func (s *Server) cachedGet(key string) (Bulk, bool) {
+	if s.ReplyCacheSize <= 0 {
+		if s.replyCache.entries != nil {
+			s.replyCache.entries = nil
+		}
+		return nil, false
+	}
+	val, ok := s.replyCache.entries[key]
+	// the lookup of the key expires it, dropping the entry
+	if ok && s.cache.Touch(key) == 1 {
+		s.replyCache.hits++
+		return val, true
+	}
+	s.replyCache.misses++
+	return nil, false
+}
+
+// cacheGet adds the value read by GET at key to the reply cache
+func (s *Server) cacheGet(key string, val Bulk) {
+	if s.ReplyCacheSize <= 0 || len(val) >= zeroCopyBulkLen {
+		return
+	}
+	if s.replyCache.entries == nil {
+		s.replyCache.entries = make(map[string]Bulk)
+	}
+	for k := range s.replyCache.entries {
+		if len(s.replyCache.entries) < s.ReplyCacheSize {
+			break
+		}
+		delete(s.replyCache.entries, k)
+	}
+	s.replyCache.entries[key] = val
+}
+
+// uncacheReplies drops the entries of keys from the reply cache, or every
+// entry if keys is nil
+func (s *Server) uncacheReplies(keys []string) {
+	if len(s.replyCache.entries) == 0 {
+		return
+	}
+	if keys == nil {
+		s.replyCache.entries = nil
+		return
+	}
+	for _, key := range keys {
+		delete(s.replyCache.entries, key)
+	}
+}
@@ -0,0 +1,195 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KavetiRohith/go-cache/cache"
+	"github.com/hashicorp/raft"
+)
+
+const (
+	// DefaultScheduleKey is the default key of the sorted set holding the
+	// commands scheduled with SCHEDULE
+	DefaultScheduleKey = "redigo:schedule"
+	// scheduleBatch bounds the scheduled commands run at once
+	scheduleBatch = 100
+)
+
+var errNotSchedulable = errors.New("only the writes that do not block can be scheduled")
+
+// scheduleHandler implements SCHEDULE id milliseconds command [arg ...],
+// or SCHEDULEAT id unix-time-milliseconds command [arg ...] if at is set,
+// replacing the command scheduled as id if any, and replying with the
+// unix time in milliseconds the command is to run at
+func scheduleHandler(at bool) CommandFunc {
+	return func(s *Server, client Client, args []string) (Reply, error) {
+		ms, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil || ms < 0 {
+			return nil, errors.New("invalid milliseconds argument")
+		}
+		if !at {
+			ms += s.cache.Now().UnixMilli()
+		}
+		cmd, ok := s.lookupCommand(args[2])
+		if !ok {
+			return nil, fmt.Errorf("unknown Command %s", args[2])
+		}
+		if err := cmd.checkArity(args[2:]); err != nil {
+			return nil, err
+		}
+		if !cmd.hasFlag(FlagWrite) || cmd.hasFlag(FlagBlocking) {
+			return nil, errNotSchedulable
+		}
+
+		if _, err := s.unschedule(args[:1]); err != nil {
+			return nil, err
+		}
+		// the member is the id followed by the command, so that it is the
+		// same on every node of a Raft cluster
+		member := string(appendCommand(nil, append([]string{args[0]}, args[2:]...)...))
+		if _, err := s.cache.ZAdd(s.ScheduleKey, cache.ZAddOpts{}, cache.ZMember{Member: member, Score: float64(ms)}); err != nil {
+			return nil, err
+		}
+		s.armSchedules()
+
+		s.logCommand("SCHEDULE %s %d %v\n", args[0], ms, args[2:])
+		return Int(ms), nil
+	}
+}
+
+// scheduleAt returns SCHEDULE as SCHEDULEAT, for the Raft log to keep the
+// time the command is due at when it is applied again after a restart
+func (s *Server) scheduleAt(parts []string) []string {
+	ms, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil || ms < 0 {
+		return parts
+	}
+	return append([]string{"SCHEDULEAT", parts[1], strconv.FormatInt(s.cache.Now().UnixMilli()+ms, 10)}, parts[3:]...)
+}
+
+func (s *Server) handleUnschedule(args []string) (Reply, error) {
+	n, err := s.unschedule(args)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logCommand("UNSCHEDULE %v %d\n", args, n)
+	return Int(n), nil
+}
+
+// unschedule removes the commands scheduled as ids, returning their number
+func (s *Server) unschedule(ids []string) (int, error) {
+	members, err := s.cache.ZRange(s.ScheduleKey, 0, -1)
+	if err != nil {
+		return 0, err
+	}
+	var removed []string
+	for _, m := range members {
+		if args, err := parseScheduled(m.Member); err == nil && contains(ids, args[0]) {
+			removed = append(removed, m.Member)
+		}
+	}
+	if len(removed) == 0 {
+		return 0, nil
+	}
+	return s.cache.ZRem(s.ScheduleKey, removed...)
+}
+
+// parseScheduled returns the id and the command of a member of the
+// schedule
+func parseScheduled(member string) ([]string, error) {
+	args, _, _, err := readLogCommand(bufio.NewReader(strings.NewReader(member)))
+	if err == nil && len(args) < 2 {
+		err = errors.New("no command scheduled")
+	}
+	return args, err
+}
+
+// armSchedules sets the timer running the schedule when its first command
+// is due
+func (s *Server) armSchedules() {
+	first, err := s.cache.ZRange(s.ScheduleKey, 0, 0)
+	if err != nil || len(first) == 0 {
+		if s.scheduleTimer != nil {
+			s.scheduleTimer.Stop()
+			s.scheduleTimer = nil
+		}
+		return
+	}
+
+	due := int64(first[0].Score)
+	if s.scheduleTimer != nil {
+		if s.scheduleDue == due {
+			return
+		}
+		s.scheduleTimer.Stop()
+	}
+	s.scheduleDue = due
+	s.scheduleTimer = s.AfterFunc(time.UnixMilli(due).Sub(s.cache.Now()), s.runSchedules)
+}
+
+// runSchedules runs the scheduled commands that are due, removing them
+// from the schedule, and arms the timer for the next ones. It is also run
+// by cron, which catches up with the schedule after a restart or a Raft
+// snapshot is restored. In Raft mode, the leader logs the removals and the
+// commands, the other nodes applying them from the log
+func (s *Server) runSchedules() {
+	if s.scheduleTimer != nil {
+		s.scheduleTimer.Stop()
+		s.scheduleTimer = nil
+	}
+	if s.raft != nil && (s.raft.State() != raft.Leader || s.raftScheduling.Load()) {
+		return
+	}
+
+	members, err := s.cache.ZRange(s.ScheduleKey, 0, scheduleBatch-1)
+	if err != nil {
+		log.Printf("schedule %s: %v\n", s.ScheduleKey, err)
+		return
+	}
+	now := s.cache.Now().UnixMilli()
+	var data []byte
+	for _, m := range members {
+		if int64(m.Score) > now {
+			break
+		}
+		args, err := parseScheduled(m.Member)
+		if s.raft != nil {
+			data = appendCommand(data, "ZREM", s.ScheduleKey, m.Member)
+			if err == nil {
+				if cmd, ok := s.lookupCommand(args[1]); ok {
+					data = s.appendExpired(data, cmd.keys(args[1:])...)
+				}
+				data = appendCommand(data, args[1:]...)
+			}
+			continue
+		}
+
+		s.cache.ZRem(s.ScheduleKey, m.Member)
+		if err != nil {
+			log.Printf("schedule %s: %v\n", s.ScheduleKey, err)
+		} else if _, err := s.dispatch(Client{conn: gatewayClient}, args[1:]); err != nil {
+			log.Printf("schedule %s: %v\n", args[0], err)
+		}
+	}
+
+	if data == nil {
+		s.armSchedules()
+		return
+	}
+	data = append(s.appendAppliedAt(nil), data...)
+	s.raftScheduling.Store(true)
+	go func() {
+		if err := s.raft.Apply(data, raftApplyTimeout).Error(); err != nil {
+			log.Println("raft: logging the scheduled commands:", err)
+		}
+		s.raftScheduling.Store(false)
+		s.Post(s.runSchedules)
+	}()
+}
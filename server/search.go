@@ -0,0 +1,413 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// defaultSearchLimit is the number of keys FT.SEARCH replies with unless
+// LIMIT is given, as in RediSearch
+const defaultSearchLimit = 10
+
+var errUnknownIndex = errors.New("Unknown index name")
+
+// searchIndex indexes fields of the JSON documents stored at the keys
+// starting with one of its prefixes. It is kept up to date by reindexing
+// the keys written by each command, and the keys that expire or are
+// evicted are removed from it
+type searchIndex struct {
+	prefixes []string
+	fields   []searchField
+	// docs holds the values indexed for each key, by field
+	docs map[string][][]string
+	// tags holds the keys by value for each TAG field, nil for the
+	// NUMERIC fields, which are matched by walking docs
+	tags []map[string]map[string]struct{}
+}
+
+// searchField is a field of an index, holding the values at path
+type searchField struct {
+	name, path string
+	numeric    bool
+}
+
+func (idx *searchIndex) covers(key string) bool {
+	if len(idx.prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range idx.prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (idx *searchIndex) field(name string) (int, bool) {
+	for i, f := range idx.fields {
+		if f.name == name {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+func (idx *searchIndex) remove(key string) {
+	values, ok := idx.docs[key]
+	if !ok {
+		return
+	}
+	for i, tags := range idx.tags {
+		if tags == nil {
+			continue
+		}
+		for _, v := range values[i] {
+			if delete(tags[v], key); len(tags[v]) == 0 {
+				delete(tags, v)
+			}
+		}
+	}
+	delete(idx.docs, key)
+}
+
+func (idx *searchIndex) add(key string, values [][]string) {
+	idx.docs[key] = values
+	for i, tags := range idx.tags {
+		if tags == nil {
+			continue
+		}
+		for _, v := range values[i] {
+			if tags[v] == nil {
+				tags[v] = make(map[string]struct{})
+			}
+			tags[v][key] = struct{}{}
+		}
+	}
+}
+
+// reindex updates the indexes covering key with the document it holds
+// now, if any
+func (s *Server) reindex(key string) {
+	for _, idx := range s.indexes {
+		if !idx.covers(key) {
+			continue
+		}
+		idx.remove(key)
+
+		values := make([][]string, len(idx.fields))
+		ok := true
+		for i, f := range idx.fields {
+			if values[i], ok = s.cache.JSONScalars(key, f.path); !ok {
+				break
+			}
+		}
+		if ok {
+			idx.add(key, values)
+		}
+	}
+}
+
+// unindex removes key from the indexes after it expired or was evicted
+func (s *Server) unindex(key string) {
+	for _, idx := range s.indexes {
+		idx.remove(key)
+	}
+}
+
+// clearIndexes empties the indexes after the keyspace was flushed
+func (s *Server) clearIndexes() {
+	for _, idx := range s.indexes {
+		idx.docs = make(map[string][][]string)
+		for i := range idx.tags {
+			if idx.tags[i] != nil {
+				idx.tags[i] = make(map[string]map[string]struct{})
+			}
+		}
+	}
+}
+
+// handleFTCreate implements
+// FT.CREATE index [ON JSON] [PREFIX count prefix ...] SCHEMA path [AS name] TAG|NUMERIC [...]
+// indexing the documents already stored at once
+func (s *Server) handleFTCreate(args []string) (Reply, error) {
+	name := args[0]
+	if _, exists := s.indexes[name]; exists {
+		return nil, errors.New("Index already exists")
+	}
+
+	idx := &searchIndex{docs: make(map[string][][]string)}
+	i := 1
+	if i+1 < len(args) && strings.EqualFold(args[i], "ON") {
+		if !strings.EqualFold(args[i+1], "JSON") {
+			return nil, errors.New("only JSON documents can be indexed")
+		}
+		i += 2
+	}
+	if i+1 < len(args) && strings.EqualFold(args[i], "PREFIX") {
+		n, err := strconv.Atoi(args[i+1])
+		if err != nil || n < 0 || i+2+n > len(args) {
+			return nil, ErrSyntax
+		}
+		idx.prefixes = append(idx.prefixes, args[i+2:i+2+n]...)
+		i += 2 + n
+	}
+	if i >= len(args) || !strings.EqualFold(args[i], "SCHEMA") {
+		return nil, ErrSyntax
+	}
+
+	for i++; i < len(args); {
+		f := searchField{path: args[i], name: args[i]}
+		i++
+		if i+1 < len(args) && strings.EqualFold(args[i], "AS") {
+			f.name = args[i+1]
+			i += 2
+		}
+		if i >= len(args) {
+			return nil, ErrSyntax
+		}
+		switch strings.ToUpper(args[i]) {
+		case "TAG":
+		case "NUMERIC":
+			f.numeric = true
+		default:
+			return nil, fmt.Errorf("Invalid field type for field `%s`", f.name)
+		}
+		i++
+		if _, dup := idx.field(f.name); dup {
+			return nil, fmt.Errorf("Duplicate field in schema - %s", f.name)
+		}
+		idx.fields = append(idx.fields, f)
+	}
+	if len(idx.fields) == 0 {
+		return nil, errors.New("Fields arguments are missing")
+	}
+
+	idx.tags = make([]map[string]map[string]struct{}, len(idx.fields))
+	for i, f := range idx.fields {
+		if !f.numeric {
+			idx.tags[i] = make(map[string]map[string]struct{})
+		}
+	}
+	s.indexes[name] = idx
+	keys, _, _ := s.cache.Scan(0, s.cache.Len()+1, "")
+	for _, key := range keys {
+		s.reindex(key)
+	}
+
+	s.logCommand("FT.CREATE %s %v %d docs\n", name, idx.fields, len(idx.docs))
+	return OK, nil
+}
+
+// handleFTDropIndex implements FT.DROPINDEX index, which keeps the
+// documents
+func (s *Server) handleFTDropIndex(args []string) (Reply, error) {
+	if _, ok := s.indexes[args[0]]; !ok {
+		return nil, errUnknownIndex
+	}
+	delete(s.indexes, args[0])
+
+	s.logCommand("FT.DROPINDEX %s\n", args[0])
+	return OK, nil
+}
+
+// handleFTList implements FT._LIST
+func (s *Server) handleFTList(args []string) (Reply, error) {
+	names := make([]string, 0, len(s.indexes))
+	for name := range s.indexes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return bulks(names), nil
+}
+
+// handleFTSearch implements FT.SEARCH index query [LIMIT offset num],
+// replying with the number of matching keys followed by the keys of the
+// requested page in order. The query is * for every document or terms all
+// of which must match: @field:{value | prefix* | ...} for TAG fields and
+// @field:[min max] for NUMERIC fields, with (min or max excluding the bound
+// and -inf and +inf for no bound
+func (s *Server) handleFTSearch(args []string) (Reply, error) {
+	idx, ok := s.indexes[args[0]]
+	if !ok {
+		return nil, errUnknownIndex
+	}
+
+	offset, limit := 0, defaultSearchLimit
+	if rest := args[2:]; len(rest) > 0 {
+		if len(rest) != 3 || !strings.EqualFold(rest[0], "LIMIT") {
+			return nil, ErrSyntax
+		}
+		var err1, err2 error
+		offset, err1 = strconv.Atoi(rest[1])
+		limit, err2 = strconv.Atoi(rest[2])
+		if err1 != nil || err2 != nil || offset < 0 || limit < 0 {
+			return nil, ErrSyntax
+		}
+	}
+
+	matched, err := idx.search(args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	// looking the keys up drops those that expired since the last cron
+	// run from the index
+	keys := matched[:0]
+	for _, key := range matched {
+		if s.cache.ExpireTime(key) != -2 {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	r := Array{Int(len(keys))}
+	for i := offset; i < len(keys) && i < offset+limit; i++ {
+		r = append(r, Bulk(keys[i]))
+	}
+	return r, nil
+}
+
+// search returns the keys of the documents matching query
+func (idx *searchIndex) search(query string) ([]string, error) {
+	var matched map[string]struct{}
+	if strings.TrimSpace(query) != "*" {
+		terms, err := splitSearchTerms(query)
+		if err != nil {
+			return nil, err
+		}
+		for _, term := range terms {
+			keys, err := idx.match(term)
+			if err != nil {
+				return nil, err
+			}
+			if matched == nil {
+				matched = keys
+				continue
+			}
+			for key := range matched {
+				if _, ok := keys[key]; !ok {
+					delete(matched, key)
+				}
+			}
+		}
+	} else {
+		matched = make(map[string]struct{}, len(idx.docs))
+		for key := range idx.docs {
+			matched[key] = struct{}{}
+		}
+	}
+
+	keys := make([]string, 0, len(matched))
+	for key := range matched {
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// splitSearchTerms splits a query on the spaces outside of braces and
+// brackets
+func splitSearchTerms(query string) ([]string, error) {
+	var terms []string
+	depth, start := 0, -1
+	for i, r := range query {
+		switch {
+		case r == '{' || r == '[':
+			depth++
+		case r == '}' || r == ']':
+			depth--
+		case r == ' ' && depth == 0:
+			if start != -1 {
+				terms = append(terms, query[start:i])
+				start = -1
+			}
+			continue
+		}
+		if start == -1 {
+			start = i
+		}
+	}
+	if start != -1 {
+		terms = append(terms, query[start:])
+	}
+	if depth != 0 || len(terms) == 0 {
+		return nil, errors.New("Syntax error in query")
+	}
+	return terms, nil
+}
+
+// match returns the keys of the documents matching a single query term
+func (idx *searchIndex) match(term string) (map[string]struct{}, error) {
+	colon := strings.IndexByte(term, ':')
+	if !strings.HasPrefix(term, "@") || colon == -1 || len(term) < colon+3 {
+		return nil, fmt.Errorf("Syntax error in query term '%s'", term)
+	}
+	i, ok := idx.field(term[1:colon])
+	if !ok {
+		return nil, fmt.Errorf("Unknown field '%s'", term[1:colon])
+	}
+	f, sel := idx.fields[i], term[colon+1:]
+
+	keys := make(map[string]struct{})
+	switch {
+	case !f.numeric && sel[0] == '{' && sel[len(sel)-1] == '}':
+		for _, v := range strings.Split(sel[1:len(sel)-1], "|") {
+			v = strings.TrimSpace(v)
+			if prefix := strings.TrimSuffix(v, "*"); prefix != v {
+				for tag, tagged := range idx.tags[i] {
+					if strings.HasPrefix(tag, prefix) {
+						addKeys(keys, tagged)
+					}
+				}
+				continue
+			}
+			addKeys(keys, idx.tags[i][v])
+		}
+	case f.numeric && sel[0] == '[' && sel[len(sel)-1] == ']':
+		bounds := strings.Fields(sel[1 : len(sel)-1])
+		if len(bounds) != 2 {
+			return nil, fmt.Errorf("Syntax error in query term '%s'", term)
+		}
+		min, minEx, err1 := parseSearchBound(bounds[0])
+		max, maxEx, err2 := parseSearchBound(bounds[1])
+		if err1 != nil || err2 != nil {
+			return nil, errors.New("Bad numeric range bounds")
+		}
+		for key, values := range idx.docs {
+			for _, v := range values[i] {
+				n, err := strconv.ParseFloat(v, 64)
+				if err != nil || n < min || n > max || (minEx && n == min) || (maxEx && n == max) {
+					continue
+				}
+				keys[key] = struct{}{}
+				break
+			}
+		}
+	default:
+		return nil, fmt.Errorf("Syntax error in query term '%s'", term)
+	}
+	return keys, nil
+}
+
+func addKeys(dst, src map[string]struct{}) {
+	for key := range src {
+		dst[key] = struct{}{}
+	}
+}
+
+// parseSearchBound parses a bound of a numeric range, reporting whether
+// it is exclusive
+func parseSearchBound(bound string) (float64, bool, error) {
+	exclusive := strings.HasPrefix(bound, "(")
+	bound = strings.TrimPrefix(bound, "(")
+	switch strings.ToLower(bound) {
+	case "-inf":
+		return math.Inf(-1), exclusive, nil
+	case "+inf", "inf":
+		return math.Inf(1), exclusive, nil
+	}
+	n, err := strconv.ParseFloat(bound, 64)
+	return n, exclusive, err
+}
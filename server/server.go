@@ -1,82 +1,670 @@
 package server
 
 import (
-	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"log"
-	"net"
+	"net/netip"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/KavetiRohith/go-cache/cache"
 	"github.com/KavetiRohith/go-cache/server/iomultiplexer"
+	"github.com/hashicorp/memberlist"
+	"github.com/hashicorp/raft"
+	"go.opentelemetry.io/otel/trace"
 	syscall "golang.org/x/sys/unix"
 )
 
+const (
+	// readBufferSize is the number of bytes read from a client at once
+	readBufferSize = 4096
+	// maxReplyBufSize is the largest reply buffer a client keeps for reuse
+	// once its replies are written
+	maxReplyBufSize = 16 * 1024
+	// acceptRetryDelay is how long accepting pauses when the process
+	// runs out of file descriptors
+	acceptRetryDelay = 100 * time.Millisecond
+	// zeroCopyBulkLen is the size from which bulk replies are written
+	// from the value itself rather than copied into the reply buffer
+	zeroCopyBulkLen = 16 * 1024
+	// DefaultProtoMaxBulkLen is the default limit of the length of a
+	// RESP bulk string
+	DefaultProtoMaxBulkLen = 512 * 1024 * 1024
+	// DefaultProtoMaxMultibulkLen is the default limit of the number of
+	// arguments of a RESP array
+	DefaultProtoMaxMultibulkLen = 1024 * 1024
+	// DefaultProtoMaxInlineLen is the default limit of the length of an
+	// inline command or of a RESP length header
+	DefaultProtoMaxInlineLen = 64 * 1024
+	// DefaultClientQueryBufferLimit is the default limit of the size of
+	// a command
+	DefaultClientQueryBufferLimit = 1024 * 1024 * 1024
+	// DefaultExpireMinInterval is the default shortest interval of the
+	// active expiry cycle
+	DefaultExpireMinInterval = 10 * time.Millisecond
+)
+
 type ServerOpts struct {
-	Host             string
-	Port             int
-	CronFrequency    time.Duration
-	lastCronExecTime time.Time
+	Host          string
+	Port          int
+	CronFrequency time.Duration
+	// ExpireMinInterval is the shortest interval the active expiry cycle
+	// runs at. The cycle runs every CronFrequency while it finds few keys
+	// expired, its interval halving down to ExpireMinInterval as long as
+	// its samples are mostly expired and doubling back once they are not,
+	// and each cycle samples for a quarter of its interval at most. Zero
+	// means DefaultExpireMinInterval, and CronFrequency or more keeps the
+	// interval at CronFrequency
+	ExpireMinInterval time.Duration
+	// ProtoMaxBulkLen limits the length of the RESP bulk strings sent by
+	// clients. Longer bulk strings are rejected as soon as their length
+	// is read and the client disconnected. Zero means DefaultProtoMaxBulkLen
+	ProtoMaxBulkLen int
+	// ProtoMaxMultibulkLen limits the number of arguments of the RESP
+	// arrays, ProtoMaxInlineLen the length of the inline commands and of
+	// the RESP length headers, and ClientQueryBufferLimit the size of a
+	// whole command, so that a client cannot make the server buffer
+	// without bounds. Clients over a limit are replied a protocol error
+	// and disconnected. Zero means DefaultProtoMaxMultibulkLen,
+	// DefaultProtoMaxInlineLen and DefaultClientQueryBufferLimit
+	ProtoMaxMultibulkLen   int
+	ProtoMaxInlineLen      int
+	ClientQueryBufferLimit int
+	// ClientOutputBufferLimitNormal and ClientOutputBufferLimitPubsub bound
+	// the replies queued for the clients, and for those subscribed to
+	// channels or patterns, that do not read them fast enough. The zero
+	// pubsub limit means DefaultClientOutputBufferLimitPubsub
+	ClientOutputBufferLimitNormal OutputBufferLimit
+	ClientOutputBufferLimitPubsub OutputBufferLimit
+	// StrictText quotes the strings replied in the text protocol to the
+	// clients sending inline commands, so that a missing value, written
+	// (nil), differs from any string, the empty one included
+	StrictText bool
+	// EdgeTriggered polls the sockets in edge triggered mode, reading
+	// and accepting until EAGAIN on every event, for fewer wakeups
+	// per connection under heavy pipelining
+	EdgeTriggered bool
+	// ReusePort sets SO_REUSEPORT on the listening socket, letting several
+	// servers listen on the same port with the kernel spreading the
+	// connections among them
+	ReusePort bool
+	// Systemd takes the listening socket from systemd socket activation
+	// when the process is passed one, rather than binding Host and Port,
+	// and notifies systemd over NOTIFY_SOCKET once the server is ready to
+	// serve, the Raft snapshot being restored, and when it stops
+	Systemd bool
+	// TCPNoDelay sets TCP_NODELAY on client connections, so that small
+	// replies are not delayed by Nagle's algorithm
+	TCPNoDelay bool
+	// ProxyProtocol expects the client connections to start with a header
+	// of version 1 or 2 of the PROXY protocol, as sent by HAProxy and the
+	// network load balancers, whose source address then stands for the
+	// client in CLIENT LIST, the quotas and the logs. The connections
+	// without a valid header are closed
+	ProxyProtocol bool
+	// AllowCIDRs, when not empty, are the networks the clients may connect
+	// from, and DenyCIDRs those they may not, a client in both being
+	// refused. MaxConnsPerIP limits the connections open from each client
+	// IP, zero meaning no limit. They are checked as the connections are
+	// accepted, or once the PROXY protocol header gives their address
+	AllowCIDRs    []netip.Prefix
+	DenyCIDRs     []netip.Prefix
+	MaxConnsPerIP int
+	// ProtectedMode refuses the clients that are not on the loopback
+	// interface while the server listens on every interface, Host being
+	// empty, * or an unspecified address, unless AllowCIDRs is set. As the
+	// server has no password, this keeps an instance exposed by mistake
+	// from being open to anyone
+	ProtectedMode bool
+	// HTTPAddr is the address of the HTTP gateway serving GET, PUT and
+	// DELETE /keys/{key}, which is disabled when empty
+	HTTPAddr string
+	// GRPCAddr is the address of the gRPC API defined in cachepb,
+	// which is disabled when empty
+	GRPCAddr string
+	// MemcachedAddr is the address of the listener speaking the memcached
+	// text protocol, which is disabled when empty
+	MemcachedAddr string
+	// HealthAddr is the address of the listener serving the /healthz and
+	// /readyz endpoints of the HTTP gateway alone, for orchestrators, which
+	// is disabled when empty
+	HealthAddr string
+	// Webhooks post the events of the keys to HTTP endpoints, such as
+	// serverless functions, every webhook queueing up to WebhookQueueLen
+	// events, DefaultWebhookQueueLen by default, before dropping the next
+	// ones
+	Webhooks        []Webhook
+	WebhookQueueLen int
+	// WarmFrom is the address of a running server whose keyspace is
+	// copied with DUMPALL before the server starts serving, so that it
+	// does not start with a cold cache. The server starts with the keys
+	// copied if the copy fails midway. Warming is disabled when empty
+	WarmFrom string
+	// CheckOnStart checks the invariants of the keyspace restored from the
+	// Raft snapshot or copied from WarmFrom before serving, Start failing
+	// if it is inconsistent unless CheckRepair is set, in which case the
+	// inconsistencies are repaired and logged
+	CheckOnStart bool
+	CheckRepair  bool
+	// ScrubKeys is the number of keys the background scrubber checks every
+	// cron run as CheckOnStart does, deleting the expired keys it visits,
+	// and ScrubRepair has it repair the inconsistencies it finds as
+	// CheckRepair does, on the servers without Raft whose replicas would
+	// not get the repairs. Zero disables the scrubber
+	ScrubKeys   int
+	ScrubRepair bool
+	// SlowlogLogSlowerThan is the duration from which commands are recorded
+	// in the slow log. Zero means DefaultSlowlogLogSlowerThan and a negative
+	// duration disables the slow log
+	SlowlogLogSlowerThan time.Duration
+	// SlowlogMaxLen is the number of entries the slow log keeps. Zero means
+	// DefaultSlowlogMaxLen
+	SlowlogMaxLen int
+	// HotKeysWindow is the window over which HOTKEYS counts the accesses
+	// of keys. Zero means DefaultHotKeysWindow and a negative window
+	// disables the counting
+	HotKeysWindow time.Duration
+	// LatencyMonitorThreshold is the duration from which the commands and
+	// the deletions of expired keys are recorded by the latency monitor.
+	// Zero disables the latency monitor
+	LatencyMonitorThreshold time.Duration
+	// ReadOnly rejects the write commands, for instances serving reads
+	// from the backing store of the cache
+	ReadOnly bool
+	// LogLevel is LogLevelNotice, which empty means, or LogLevelDebug to
+	// log every command received as well
+	LogLevel string
+	// QuietCommands stops the handlers from logging the commands they serve
+	// with their values, which may be large or sensitive
+	QuietCommands bool
+	// QuotaOpsPerSec and QuotaBytesPerSec limit the commands, and their
+	// bytes, each client IP sends per second, and QuotaCommandOps the
+	// commands of each upper case name. Commands over a quota are refused
+	// with LIMIT errors, and zero means no limit
+	QuotaOpsPerSec   int
+	QuotaBytesPerSec int
+	QuotaCommandOps  map[string]int
+	// OverloadLatency and OverloadPendingBytes shed load when the event
+	// loop falls behind: while serving the events of the last poll took at
+	// least OverloadLatency, or while the replies waiting for slow clients
+	// add up to OverloadPendingBytes, the commands of the clients are
+	// refused with BUSY errors, except for the administrative commands and
+	// PING, HELLO, CLIENT, INFO and the other commands keeping connections
+	// and replication alive. Zero disables each of them
+	OverloadLatency      time.Duration
+	OverloadPendingBytes int
+	// ReplyCacheSize is the number of values of strings read by GET kept
+	// decoded, for the repeated reads of the hot keys whose strings are
+	// stored encoded, such as compressed or as integers, to skip decoding. The entries
+	// are dropped as their keys are written, and zero disables the cache
+	ReplyCacheSize int
+	// HistoryVersions is the number of versions of every key kept for
+	// GETAT, zero disabling the history. HistoryKeyBytes bounds the size
+	// of the versions of a key but for the latest one, and HistoryMaxBytes
+	// that of the whole history, DefaultHistoryKeyBytes and
+	// DefaultHistoryMaxBytes by default, the oldest versions being dropped
+	// first
+	HistoryVersions int
+	HistoryKeyBytes int
+	HistoryMaxBytes int
+	// DefragThreshold is the fragmentation of the heap, as the ratio of the
+	// memory of its spans in use to that of the objects they hold, above
+	// which the idle polls move keys to fresh allocations for the emptied
+	// spans to be returned to the OS. Zero disables it. DefragIgnoreBytes
+	// is the fragmentation in bytes below which the heap is left as is,
+	// DefaultDefragIgnoreBytes by default
+	DefragThreshold   float64
+	DefragIgnoreBytes int64
+	// DrainTimeout is how long SHUTDOWN DRAIN and Drain wait for the
+	// clients blocked or with replies pending before the server stops.
+	// Zero means DefaultDrainTimeout. DrainRedirect is the address of the
+	// server the clients are told to reconnect to while draining, if any
+	DrainTimeout  time.Duration
+	DrainRedirect string
+	// ChangeSink publishes the changes of the keys, such as with the sink
+	// of NewNATSSink, queueing up to ChangeQueueLen changes,
+	// DefaultChangeQueueLen by default, before dropping the next ones.
+	// Change data capture is disabled when nil
+	ChangeSink     ChangeSink
+	ChangeQueueLen int
+	// TracerProvider traces the commands dispatched with OpenTelemetry,
+	// along with their parsing and their writes to the backing store. The
+	// tracing is disabled when nil
+	TracerProvider trace.TracerProvider
+	// RaftAddr is the address the node of a Raft cluster listens on,
+	// which must be reachable by the other nodes. The writes are then
+	// committed to the Raft log of the cluster before they are applied,
+	// and only the leader serves the commands reading or writing keys.
+	// Raft mode is disabled when empty
+	RaftAddr string
+	// RaftID identifies the node in the cluster. It defaults to the
+	// address of the server, which the other nodes name the leader by
+	RaftID string
+	// RaftDir holds the Raft log and the snapshots of the node
+	RaftDir string
+	// RaftBootstrap starts a new cluster of the node and RaftPeers, given
+	// as id=address, unless the node already belongs to one. The nodes
+	// not bootstrapped wait to be added with RAFT ADDNODE on the leader
+	RaftBootstrap bool
+	RaftPeers     []string
+	// CRDTPeers are the addresses of the other replicas the counters and
+	// sets of the CRDT commands are sent to and merged on, so that every
+	// replica of a full mesh accepts writes. The sync is disabled when
+	// empty
+	CRDTPeers []string
+	// CRDTReplicaID identifies the writes of this replica in the counters
+	// and sets, and must differ between the replicas. It defaults to the
+	// address of the server
+	CRDTReplicaID string
+	// CRDTSyncInterval is the interval at which the counters and sets
+	// changed are sent to the peers. Zero means DefaultCRDTSyncInterval
+	CRDTSyncInterval time.Duration
+	// GossipAddr is the address the node gossips on, with the nodes of
+	// GossipJoin and those they know of, to discover the other nodes and
+	// detect their failures. Gossip is disabled when empty
+	GossipAddr string
+	// GossipName names the node in the gossip cluster. It defaults to the
+	// address of the server
+	GossipName string
+	// GossipJoin are the seeds joined, as host:port or as srv:name for
+	// the targets of the DNS SRV records of name. They are resolved and
+	// joined again every GossipRejoinInterval, zero meaning
+	// DefaultGossipRejoinInterval
+	GossipJoin           []string
+	GossipRejoinInterval time.Duration
+	// ScheduleKey is the key of the sorted set holding the commands
+	// scheduled with SCHEDULE by the unix time in milliseconds they are
+	// due at, kept in the keyspace for the Raft snapshots to carry them.
+	// The empty key means DefaultScheduleKey
+	ScheduleKey string
+}
+
+// setDefaults replaces the zero options that have a default by it
+func (opts *ServerOpts) setDefaults() {
+	if opts.LogLevel == "" {
+		opts.LogLevel = LogLevelNotice
+	}
+	if opts.ProtoMaxBulkLen <= 0 {
+		opts.ProtoMaxBulkLen = DefaultProtoMaxBulkLen
+	}
+	if opts.ProtoMaxMultibulkLen <= 0 {
+		opts.ProtoMaxMultibulkLen = DefaultProtoMaxMultibulkLen
+	}
+	if opts.ProtoMaxInlineLen <= 0 {
+		opts.ProtoMaxInlineLen = DefaultProtoMaxInlineLen
+	}
+	if opts.ClientQueryBufferLimit <= 0 {
+		opts.ClientQueryBufferLimit = DefaultClientQueryBufferLimit
+	}
+	if opts.ClientOutputBufferLimitPubsub == (OutputBufferLimit{}) {
+		opts.ClientOutputBufferLimitPubsub = DefaultClientOutputBufferLimitPubsub
+	}
+	if opts.SlowlogLogSlowerThan == 0 {
+		opts.SlowlogLogSlowerThan = DefaultSlowlogLogSlowerThan
+	}
+	if opts.SlowlogMaxLen <= 0 {
+		opts.SlowlogMaxLen = DefaultSlowlogMaxLen
+	}
+	if opts.HotKeysWindow == 0 {
+		opts.HotKeysWindow = DefaultHotKeysWindow
+	}
+	if opts.ScheduleKey == "" {
+		opts.ScheduleKey = DefaultScheduleKey
+	}
+	if opts.ExpireMinInterval <= 0 {
+		opts.ExpireMinInterval = DefaultExpireMinInterval
+	}
+	if opts.ChangeQueueLen <= 0 {
+		opts.ChangeQueueLen = DefaultChangeQueueLen
+	}
+	if opts.WebhookQueueLen <= 0 {
+		opts.WebhookQueueLen = DefaultWebhookQueueLen
+	}
+	if opts.HistoryKeyBytes <= 0 {
+		opts.HistoryKeyBytes = DefaultHistoryKeyBytes
+	}
+	if opts.HistoryMaxBytes <= 0 {
+		opts.HistoryMaxBytes = DefaultHistoryMaxBytes
+	}
+	if opts.DefragIgnoreBytes <= 0 {
+		opts.DefragIgnoreBytes = DefaultDefragIgnoreBytes
+	}
+	if opts.DrainTimeout <= 0 {
+		opts.DrainTimeout = DefaultDrainTimeout
+	}
 }
 
 type Server struct {
 	ServerOpts
 	cache       *cache.Cache
 	con_clients uint
+	// clients holds the connected clients keyed by fd
+	clients map[int]*clientConn
+	// blocked holds the clients waiting in a blocking command keyed by fd
+	blocked map[int]*blockedClient
+	// migrateConns caches connections opened by MIGRATE keyed by address
+	migrateConns map[string]*migrateConn
+	// commands maps upper case command names to their registered command
+	commands map[string]*Command
+	// modules holds the modules loaded on Start
+	modules []Module
+	// preHooks and postHooks are called around the commands dispatched
+	preHooks  []CommandHook
+	postHooks []PostCommandHook
+	// multiplexer monitors the server socket and the client connections
+	multiplexer iomultiplexer.IOMultiplexer
+	// pendingWrites holds the clients with replies queued since the last poll
+	pendingWrites []*clientConn
+	// posted holds the functions other goroutines queued with Post
+	posted loopQueue
+	// timers schedules the functions run by the event loop at a given time
+	timers *timerWheel
+	// watchers holds the watchers of the writes of each key
+	watchers map[string]map[*keyWatcher]struct{}
+	// channels and patterns hold the Pub/Sub subscribers of each channel
+	// and of each pattern
+	channels map[string]map[*pubsubClient]struct{}
+	patterns map[string]map[*pubsubClient]struct{}
+	// shardChannels holds the subscribers of each shard channel
+	shardChannels map[string]map[*pubsubClient]struct{}
+	// channelStats counts the messages published to each channel
+	channelStats map[channelStatsKey]*channelStats
+	// trackers holds the clients with CLIENT TRACKING on keyed by fd, and
+	// tracked the fds of the tracking clients that read each key
+	trackers map[int]*clientConn
+	tracked  map[string]map[int]struct{}
+	// loads holds the loads of the keys missing from the cache that
+	// clients are waiting for
+	loads map[string]*keyLoad
+	// refreshes holds the stale keys being refreshed in the background
+	refreshes map[string]struct{}
+	// indexes holds the search indexes by name
+	indexes map[string]*searchIndex
+	// slowlog holds the latest commands that ran for SlowlogLogSlowerThan
+	slowlog slowlog
+	hotKeys hotKeys
+	// tenantCommands counts the commands by the tenant of their first
+	// key, while the cache counts tenants
+	tenantCommands map[string]int64
+	// stopped is set by Stop for Start to return
+	stopped bool
+	// latency holds the latency spikes recorded for each event
+	latency map[string]*latencyEvent
+	// latencyStats holds the histograms of the latencies of the commands
+	// called, by name
+	latencyStats map[string]*latencyHistogram
+	// raft is the node of the Raft cluster, nil unless RaftAddr is set,
+	// and raftExpiring is set while the leader logs the deletion of
+	// expired keys
+	raft         *raft.Raft
+	raftExpiring atomic.Bool
+	// raftWritingKeys counts the writes of each key the leader logged and
+	// did not apply yet, and raftWritingAll those of the commands whose
+	// keys move, for SET IFVERSION to be checked before logging
+	raftWritingKeys map[string]int
+	raftWritingAll  int
+	// scheduleTimer runs the schedule at scheduleDue, the unix time in
+	// milliseconds its first command is due at, and raftScheduling is set
+	// while the leader logs the scheduled commands run
+	scheduleTimer  *Timer
+	scheduleDue    int64
+	raftScheduling atomic.Bool
+	// faults are the faults injected into Raft by DEBUG FAULT, in the
+	// builds tagged faults
+	faults faultState
+	// expireInterval is the interval the active expiry cycle runs at next
+	expireInterval time.Duration
+	// lastPollBusy is how long the events of the last poll took to serve,
+	// and pendingOutput the replies waiting for slow clients, summed once
+	// per poll if pendingOutputKnown, for the overload thresholds
+	lastPollBusy       time.Duration
+	pendingOutput      int
+	pendingOutputKnown bool
+	replyCache         replyCache
+	history            *history
+	defrag             defragState
+	// lastScrubProblem is the latest inconsistency found by the scrubber
+	lastScrubProblem string
+	// listenFD is the listening socket, and drainDeadline when the drain
+	// started by SHUTDOWN DRAIN times out, zero unless draining
+	listenFD      int
+	drainDeadline time.Time
+	// webhooks are the webhooks started, and webhookPosted and
+	// webhookFailed count the events they posted and gave up on
+	webhooks      []*webhook
+	webhookPosted atomic.Int64
+	webhookFailed atomic.Int64
+	// changes queues the changes for ChangeSink, nil unless it is set,
+	// and changesPublished counts those it published
+	changes          chan ChangeEvent
+	changesPublished atomic.Int64
+	// crdtDirty holds the counters and sets changed since they were last
+	// sent to the CRDT peers, nil unless CRDTPeers is set
+	crdtDirty map[string]struct{}
+	// gossip is the member of the gossip cluster, nil unless GossipAddr is
+	// set, and gossipNodes the members it reported by name
+	gossip      *memberlist.Memberlist
+	gossipNodes map[string]*gossipNode
+	// quotas holds what each client IP sent in the current second, while
+	// quotas are set
+	quotas map[string]*quotaUsage
+	// connsPerIP counts the connections open from each client IP
+	connsPerIP map[string]int
+	// pause is the CLIENT PAUSE in effect, nil when none is
+	pause *clientPause
+	// tracer traces the commands, nil unless TracerProvider is set.
+	// traceParent is the context of the function run by runOnLoop, and
+	// commandTrace the command being dispatched while it is traced
+	tracer       trace.Tracer
+	traceParent  context.Context
+	commandTrace *commandTrace
+	stats        serverStats
 }
 
 func NewServer(opts ServerOpts, c *cache.Cache) *Server {
-	return &Server{
-		ServerOpts: opts,
-		cache:      c,
+	s := &Server{
+		ServerOpts:    opts,
+		cache:         c,
+		clients:       make(map[int]*clientConn),
+		blocked:       make(map[int]*blockedClient),
+		migrateConns:  make(map[string]*migrateConn),
+		commands:      make(map[string]*Command, len(builtinCommands)),
+		timers:        newTimerWheel(time.Now()),
+		watchers:      make(map[string]map[*keyWatcher]struct{}),
+		channels:      make(map[string]map[*pubsubClient]struct{}),
+		patterns:      make(map[string]map[*pubsubClient]struct{}),
+		shardChannels: make(map[string]map[*pubsubClient]struct{}),
+		channelStats:  make(map[channelStatsKey]*channelStats),
+		loads:         make(map[string]*keyLoad),
+		refreshes:     make(map[string]struct{}),
+		trackers:      make(map[int]*clientConn),
+		tracked:       make(map[string]map[int]struct{}),
+		indexes:       make(map[string]*searchIndex),
+		latency:       make(map[string]*latencyEvent),
+		latencyStats:  make(map[string]*latencyHistogram),
+		quotas:        make(map[string]*quotaUsage),
+		connsPerIP:    make(map[string]int),
 	}
+	s.ServerOpts.setDefaults()
+	if opts.TracerProvider != nil {
+		s.tracer = opts.TracerProvider.Tracer(tracerName)
+	}
+	for _, cmd := range builtinCommands {
+		s.commands[cmd.Name] = cmd
+	}
+	// the keys that expire or are evicted change for the tracking clients
+	// and leave the reply cache and the search indexes, while the webhooks
+	// and the change sink get their event
+	c.OnEvict(func(key string, reason cache.EvictReason) {
+		s.invalidate(key, -1)
+		s.uncacheReplies([]string{key})
+		if len(s.webhooks) > 0 {
+			s.notifyWebhooks(reason.String(), []string{key})
+		}
+		if s.changes != nil {
+			s.keysChanged(reason.String(), []string{key})
+		}
+		s.unindex(key)
+		if s.HistoryVersions > 0 {
+			s.recordHistory([]string{key}, true)
+		}
+	})
+	return s
 }
 
-func (s *Server) Start() error {
-	log.Println("starting an asynchronous TCP server on", s.Host, s.Port)
+// Cache returns the cache served by the server, for use by the
+// handlers of commands added with RegisterCommand
+func (s *Server) Cache() *cache.Cache {
+	return s.cache
+}
 
-	maxClients := 20000
+// Do runs a command on the event loop, as the HTTP and gRPC gateways do,
+// for the programs embedding the server, and returns its reply. If ctx is
+// done before the loop gets to the command, Do returns the error of ctx
+// and the command is not run. The blocking and Pub/Sub commands, which
+// would hold on to the caller, are not supported
+func (s *Server) Do(ctx context.Context, args ...string) (Reply, error) {
+	if len(args) > 0 {
+		if cmd, ok := s.lookupCommand(args[0]); ok && (cmd.hasFlag(FlagBlocking) || cmd.hasFlag(FlagPubSub)) {
+			return nil, fmt.Errorf("'%s' is not supported by Do", strings.ToLower(cmd.Name))
+		}
+	}
 
-	// Create a socket
-	serverFD, err := syscall.Socket(syscall.AF_INET, syscall.O_NONBLOCK|syscall.SOCK_STREAM, 0)
-	if err != nil {
-		return err
+	var (
+		reply Reply
+		err   error
+	)
+	if loopErr := s.runOnLoop(ctx, func() { reply, err = s.handlecommand(gatewayClient, args) }); loopErr != nil {
+		return nil, loopErr
 	}
-	defer syscall.Close(serverFD)
+	return reply, err
+}
 
-	// Set the Socket operate in a non-blocking mode
-	err = syscall.SetNonblock(serverFD, true)
-	if err != nil {
+// Start listens on Host and Port and runs the event loop until Stop is
+// called or an error occurs
+func (s *Server) Start() error {
+	if err := checkLogLevel(s.LogLevel); err != nil {
 		return err
 	}
-
-	// Bind the IP and the port
-	ip4 := net.ParseIP(s.Host)
-	err = syscall.Bind(serverFD, &syscall.SockaddrInet4{
-		Port: s.Port,
-		Addr: [4]byte{ip4[0], ip4[1], ip4[2], ip4[3]},
-	})
-	if err != nil {
+	if err := s.loadModules(); err != nil {
 		return err
 	}
 
-	// Start listening
-	err = syscall.Listen(serverFD, maxClients)
+	s.stats.startedAt = time.Now()
+
+	maxClients := 20000
+
+	// Create the listening socket
+	serverFD, err := s.listen(maxClients)
 	if err != nil {
 		return err
 	}
+	defer syscall.Close(serverFD)
+	s.listenFD = serverFD
+	log.Println("starting an asynchronous TCP server on", s.Host, s.Port)
 
 	// AsyncIO starts here!!
 
 	// creating multiplexer instance
-	multiplexer, err := iomultiplexer.New(maxClients)
+	var muxOpts []iomultiplexer.Option
+	if s.EdgeTriggered {
+		muxOpts = append(muxOpts, iomultiplexer.WithEdgeTriggered())
+	}
+	multiplexer, err := iomultiplexer.New(maxClients, muxOpts...)
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer multiplexer.Close()
+	s.multiplexer = multiplexer
+
+	// Listen to the functions posted by other goroutines
+	if err := s.subscribeWaker(); err != nil {
+		return err
+	}
+	defer s.closeWaker()
+
+	if s.RaftAddr != "" {
+		if s.HTTPAddr != "" || s.GRPCAddr != "" || s.MemcachedAddr != "" {
+			return errRaftGateways
+		}
+		if s.WarmFrom != "" {
+			return errRaftWarm
+		}
+		// the FSM stops waiting for the event loop once it returns
+		ctx, cancel := context.WithCancel(context.Background())
+		stopRaft, err := s.startRaft(ctx)
+		if err != nil {
+			cancel()
+			return err
+		}
+		defer func() {
+			cancel()
+			stopRaft()
+		}()
+	}
+
+	if len(s.CRDTPeers) > 0 {
+		defer s.startCRDTSync()()
+	}
+	if len(s.Webhooks) > 0 {
+		defer s.startWebhooks()()
+	}
+	if s.ChangeSink != nil {
+		defer s.startChangeSink()()
+	}
+	if s.GossipAddr != "" {
+		leaveGossip, err := s.startGossip()
+		if err != nil {
+			return err
+		}
+		defer leaveGossip()
+	}
+
+	if s.HTTPAddr != "" {
+		httpServer, err := s.startHTTP()
+		if err != nil {
+			return err
+		}
+		defer httpServer.Close()
+	}
+	if s.GRPCAddr != "" {
+		grpcServer, err := s.startGRPC()
+		if err != nil {
+			return err
+		}
+		defer grpcServer.Stop()
+	}
+	if s.MemcachedAddr != "" {
+		memcachedListener, err := s.startMemcached()
+		if err != nil {
+			return err
+		}
+		defer memcachedListener.Close()
+	}
+	if s.HealthAddr != "" {
+		healthServer, err := s.startHealth()
+		if err != nil {
+			return err
+		}
+		defer healthServer.Close()
+	}
+
+	// the connections made while warming wait in the backlog of the
+	// listening socket
+	if s.WarmFrom != "" {
+		if err := s.warm(); err != nil {
+			log.Printf("warming from %s: %v\n", s.WarmFrom, err)
+		}
+	}
+	if s.CheckOnStart {
+		if err := s.checkOnStart(); err != nil {
+			return err
+		}
+	}
 
 	// Listen to read events on the Server itself
 	err = multiplexer.Subscribe(iomultiplexer.Event{
@@ -87,14 +675,30 @@ func (s *Server) Start() error {
 		return err
 	}
 
-	for {
-		if time.Now().After(s.lastCronExecTime.Add(s.CronFrequency)) {
-			s.cache.DeleteExpiredKeys()
-			s.lastCronExecTime = time.Now()
+	s.AfterFunc(s.CronFrequency, s.cron)
+	s.expireInterval = s.CronFrequency
+	s.AfterFunc(s.expireInterval, s.expireCycle)
+
+	if s.Systemd {
+		if err := sdNotify("READY=1"); err != nil {
+			log.Println("systemd:", err)
 		}
+	}
 
-		// poll for events that are ready for IO
-		events, err := multiplexer.Poll(-1)
+	for {
+		s.writePendingReplies()
+		if s.stopped {
+			if s.Systemd {
+				sdNotify("STOPPING=1")
+			}
+			s.closeConns()
+			return nil
+		}
+		// poll for events that are ready for IO, waking up
+		// in time for the next timer
+		events, err := multiplexer.Poll(s.defragTimeout(s.timers.timeout(time.Now())))
+		polledAt := time.Now()
+		s.timers.advance(polledAt)
 		if err != nil {
 			continue
 		}
@@ -102,142 +706,839 @@ func (s *Server) Start() error {
 		for _, event := range events {
 			// if the socket server itself is ready for an IO
 			if event.Fd == serverFD {
-				// accept the incoming connection from a client
-				fd, _, err := syscall.Accept(serverFD)
-				if err != nil {
-					log.Println("err", err)
-					continue
+				if err := s.acceptConns(serverFD); err != nil {
+					return err
+				}
+			} else if event.Fd == s.posted.waker.fd() {
+				s.runPosted()
+			} else {
+				if event.Op&iomultiplexer.OP_WRITE != 0 {
+					s.flushReplies(int(event.Fd))
 				}
+				if event.Op != iomultiplexer.OP_WRITE {
+					s.readQuery(int(event.Fd))
+				}
+			}
+		}
+		s.polled(time.Since(polledAt))
+		if len(events) == 0 {
+			s.defragIdle()
+		}
+	}
+}
 
-				// increase the number of concurrent clients count
-				s.con_clients++
-				syscall.SetNonblock(fd, true)
+// Stop makes Start close the connections of the clients and return nil.
+// It is safe to call from any goroutine
+func (s *Server) Stop() {
+	s.Post(func() { s.stopped = true })
+}
 
-				// add this new TCP connection to be monitored
-				if err := multiplexer.Subscribe(iomultiplexer.Event{
-					Fd: fd,
-					Op: iomultiplexer.OP_READ,
-				}); err != nil {
-					return err
-				}
+// handleShutdown implements SHUTDOWN [NOSAVE|SAVE|DRAIN [milliseconds]],
+// stopping the server like Stop once the command is served. SAVE first
+// snapshots the Raft state, the only state kept on disk, while NOSAVE,
+// like no argument, leaves it to the Raft log. DRAIN stops accepting
+// connections and refuses the commands of the clients, stopping once they
+// are done or after milliseconds, DrainTimeout by default
+func (s *Server) handleShutdown(client Client, args []string) (Reply, error) {
+	if len(args) > 0 && strings.EqualFold(args[0], "DRAIN") {
+		var timeout time.Duration
+		switch len(args) {
+		case 1:
+		case 2:
+			ms, err := strconv.ParseInt(args[1], 10, 64)
+			if err != nil || ms <= 0 {
+				return nil, errors.New("invalid milliseconds argument")
+			}
+			timeout = time.Duration(ms) * time.Millisecond
+		default:
+			return nil, ErrSyntax
+		}
+		s.drain(timeout)
+		return OK, nil
+	}
 
-			} else {
-				conn := fDconn{Fd: int(event.Fd)}
+	save := false
+	switch {
+	case len(args) > 1:
+		return nil, ErrSyntax
+	case len(args) == 1 && strings.EqualFold(args[0], "SAVE"):
+		save = true
+	case len(args) == 1 && !strings.EqualFold(args[0], "NOSAVE"):
+		return nil, ErrSyntax
+	}
+
+	if !save {
+		s.shutdown()
+		return OK, nil
+	}
+	if s.raft == nil {
+		return nil, errors.New("SHUTDOWN SAVE needs Raft mode, as nothing else is saved to disk")
+	}
+	return nil, s.awaitOffLoop(client.conn, func() error {
+		return s.raft.Snapshot().Error()
+	}, func(err error) (Reply, error) {
+		if err != nil && err != raft.ErrNothingNewToSnapshot {
+			return nil, fmt.Errorf("Errors trying to SHUTDOWN: %w", s.raftError(err))
+		}
+		s.shutdown()
+		return OK, nil
+	})
+}
 
-				r := bufio.NewReader(conn)
-				cmd, err := r.ReadBytes('\n')
+// shutdown makes Start return once the current event is served and
+// the replies pending are written
+func (s *Server) shutdown() {
+	log.Println("shutting down on SHUTDOWN")
+	s.stopped = true
+}
 
-				if err != nil {
-					conn.Close()
-					s.con_clients--
-					continue
-				}
+// closeConns closes the connections of the clients and of MIGRATE as the
+// server stops
+func (s *Server) closeConns() {
+	for _, c := range s.clients {
+		s.closeConn(c.fDconn)
+	}
+	for addr := range s.migrateConns {
+		s.closeMigrateConn(addr)
+	}
+}
 
-				resp, err := s.handlecommand(cmd)
-				if err != nil {
-					resp = []byte(err.Error())
-				}
+// cron runs the periodic jobs of the server every CronFrequency
+func (s *Server) cron() {
+	s.closeIdleMigrateConns()
+	s.rotateHotKeys(time.Now())
+	s.pruneQuotas()
+	s.runSchedules()
+	s.cache.SpillCold(s.CronFrequency / 4)
+	s.checkFragmentation()
+	s.scrubKeys()
+	s.AfterFunc(s.CronFrequency, s.cron)
+}
 
-				_, err = conn.Write(append(resp, '\n'))
-				if err != nil {
-					conn.Close()
-					s.con_clients--
-					continue
-				}
+// expireCycle deletes the expired keys, or has the Raft leader log their
+// deletion, adapting the interval it runs at to the keys it finds expired
+func (s *Server) expireCycle() {
+	start := time.Now()
+	var pressured bool
+	if s.raft != nil {
+		pressured = s.expireRaftKeys()
+	} else {
+		_, pressured = s.cache.DeleteExpiredKeys(s.expireInterval / 4)
+	}
+	s.monitorLatency(latencyExpireCycle, time.Since(start))
+
+	if pressured {
+		s.expireInterval /= 2
+	} else {
+		s.expireInterval *= 2
+	}
+	if s.expireInterval < s.ExpireMinInterval {
+		s.expireInterval = s.ExpireMinInterval
+	}
+	if s.expireInterval > s.CronFrequency {
+		s.expireInterval = s.CronFrequency
+	}
+	s.AfterFunc(s.expireInterval, s.expireCycle)
+}
+
+// acceptConns accepts the incoming connections from clients
+// until none is pending
+func (s *Server) acceptConns(serverFD int) error {
+	for {
+		fd, sa, err := syscall.Accept(serverFD)
+		switch err {
+		case nil:
+		case syscall.EAGAIN:
+			return nil
+		case syscall.EINTR, syscall.ECONNABORTED:
+			continue
+		case syscall.EMFILE, syscall.ENFILE, syscall.ENOBUFS, syscall.ENOMEM:
+			// the pending connection stays in the backlog, so that
+			// retrying right away would spin on the same error
+			return s.pauseAccept(serverFD, err)
+		default:
+			log.Println("err", err)
+			return nil
+		}
+
+		// increase the number of concurrent clients count
+		s.con_clients++
+		syscall.SetNonblock(fd, true)
+		if s.TCPNoDelay {
+			syscall.SetsockoptInt(fd, syscall.IPPROTO_TCP, syscall.TCP_NODELAY, 1)
+		}
+		now := time.Now()
+		c := &clientConn{
+			fDconn:          fDconn{Fd: fd},
+			addr:            sockaddrString(sa),
+			proxyHeader:     s.ProxyProtocol,
+			createdAt:       now,
+			lastInteraction: now,
+		}
+		s.clients[fd] = c
+		s.stats.connections++
+		if !c.proxyHeader && !s.admitConn(c) {
+			continue
+		}
+
+		// add this new TCP connection to be monitored
+		if err := s.multiplexer.Subscribe(iomultiplexer.Event{
+			Fd: fd,
+			Op: iomultiplexer.OP_READ,
+		}); err != nil {
+			return err
+		}
+	}
+}
+
+// pauseAccept stops polling the listening socket for acceptRetryDelay,
+// once out of file descriptors, rather than failing in a tight loop
+func (s *Server) pauseAccept(serverFD int, err error) error {
+	log.Printf("accept: %v, pausing for %v\n", err, acceptRetryDelay)
+	if err := s.multiplexer.Modify(iomultiplexer.Event{Fd: serverFD}); err != nil {
+		return err
+	}
+
+	s.AfterFunc(acceptRetryDelay, func() {
+		if err := s.multiplexer.Modify(iomultiplexer.Event{
+			Fd: serverFD,
+			Op: iomultiplexer.OP_READ,
+		}); err != nil {
+			log.Println("err", err)
+		}
+	})
+	return nil
+}
+
+// readQuery reads the bytes sent by a client and serves the complete
+// commands buffered so far. In edge triggered mode it reads until the
+// socket is drained, as the rest would not be reported again
+func (s *Server) readQuery(fd int) {
+	c, ok := s.clients[fd]
+	if !ok {
+		return
+	}
+	for s.readClient(c) && s.EdgeTriggered && s.clients[fd] == c {
+	}
+}
+
+// readClient reads once from the client and serves the complete commands
+// buffered so far, reporting whether anything was read
+func (s *Server) readClient(c *clientConn) bool {
+	// read straight into the free space of the query buffer, reserving
+	// the whole of a big argument at once so it is read in large chunks
+	size := len(c.querybuf) + readBufferSize
+	if c.want > size {
+		size = c.want
+	}
+	switch {
+	case c.querybuf == nil && size == readBufferSize:
+		c.querybuf = queryBufPool.Get().(*[readBufferSize]byte)[:0]
+	case cap(c.querybuf) < size:
+		buf := make([]byte, len(c.querybuf), size)
+		copy(buf, c.querybuf)
+		c.releaseQueryBuf()
+		c.querybuf = buf
+	}
+
+	n, err := c.Read(c.querybuf[len(c.querybuf):cap(c.querybuf)])
+	if err == syscall.EAGAIN {
+		if len(c.querybuf) == 0 {
+			c.releaseQueryBuf()
+		}
+		return false
+	}
+	if err != nil || n == 0 {
+		s.closeConn(c.fDconn)
+		return false
+	}
+
+	c.querybuf = c.querybuf[:len(c.querybuf)+n]
+	if c.proxyHeader && !s.readProxyHeader(c) {
+		// the rest of the header is read first
+		return s.clients[c.Fd] == c
+	}
+	s.processQuery(c)
+	return true
+}
+
+// processQuery serves the complete commands buffered for a client
+// in order, stopping while the client is blocked
+func (s *Server) processQuery(c *clientConn) {
+	for len(c.querybuf) > 0 {
+		if _, blocked := s.blocked[c.Fd]; blocked || c.closeASAP || c.quit || s.stopped {
+			return
+		}
+
+		if s.tracer != nil && c.parseStart.IsZero() {
+			c.parseStart = time.Now()
+		}
+		args, n, want, resp, err := parseCommand(c.querybuf, s.protoLimits())
+		if err != nil {
+			// the rest of the buffer cannot be trusted after a protocol error
+			s.stats.protocolErrors++
+			c.resp = resp
+			s.reply(c.fDconn, nil, err)
+			s.writeReplies(c)
+			s.closeConn(c.fDconn)
+			return
+		}
+		if n == 0 {
+			c.want = want
+			return
+		}
+		if len(args) > 0 && s.pauses(args) {
+			// the command stays buffered until the pause ends
+			c.paused = true
+			return
+		}
+		c.querybuf = c.querybuf[n:]
+		c.want = 0
+		c.resp = resp
+		if s.tracer != nil {
+			c.parsedAt = time.Now()
+		}
+
+		// empty RESP arrays and blank inline lines are ignored like in
+		// Redis
+		if len(args) == 0 {
+			continue
+		}
+
+		c.lastCmd = strings.ToLower(args[0])
+		c.lastInteraction = time.Now()
+		if s.quotasEnabled() {
+			if err := s.checkQuota(c, args, n); err != nil {
+				s.reply(c.fDconn, nil, err)
+				continue
+			}
+		}
+		if s.draining() {
+			s.reply(c.fDconn, nil, s.drainingError())
+			continue
+		}
+		if s.overloadEnabled() {
+			if err := s.checkOverload(args[0]); err != nil {
+				s.reply(c.fDconn, nil, err)
+				continue
 			}
 		}
+		r, err := s.handlecommand(c.fDconn, args)
+		c.parseStart = time.Time{}
+		if err == errClientBlocked {
+			return
+		}
+		s.reply(c.fDconn, r, err)
 	}
+	c.releaseQueryBuf()
 }
 
-func (s *Server) handlecommand(rawCmd []byte) ([]byte, error) {
-	var (
-		parts   = strings.Fields(string(rawCmd))
-		len_cmd = len(parts)
-	)
+// reply queues the reply, or err if it is not nil, to the client in the
+// protocol of its last command. Queued replies are written before the
+// next poll, so that the replies to pipelined commands share a syscall
+func (s *Server) reply(conn fDconn, r Reply, err error) {
+	c, ok := s.clients[conn.Fd]
+	if !ok || c.closeASAP {
+		return
+	}
 
-	if len_cmd < 2 {
-		return nil, errors.New("message must atleast have command and key")
+	if !c.resp && err == nil && s.StrictText {
+		r = strictText(r)
+	}
+	bulk, isBulk := r.(Bulk)
+	switch {
+	case c.resp && err != nil:
+		c.outbuf = errorRESP(c.outbuf, err)
+	case isBulk && len(bulk) >= zeroCopyBulkLen:
+		// big values are written straight from the bytes held by the
+		// cache, which are never modified in place, rather than copied
+		if c.resp {
+			c.outbuf = appendBulkHeader(c.outbuf, len(bulk))
+		}
+		c.appendPayload(bulk)
+		if c.resp {
+			c.outbuf = append(c.outbuf, "\r\n"...)
+		} else {
+			c.outbuf = append(c.outbuf, '\n')
+		}
+	case c.resp:
+		c.outbuf = r.appendRESP(c.outbuf)
+	case err != nil:
+		c.outbuf = append(append(c.outbuf, formatError(err)...), '\n')
+	default:
+		c.outbuf = append(r.appendText(c.outbuf, false), '\n')
 	}
 
-	var (
-		cmd = parts[0]
-		key = parts[1]
-	)
+	if s.checkOutputLimit(c) {
+		s.closeOverLimit(c)
+	}
+	if !c.pendingWrite {
+		c.pendingWrite = true
+		s.pendingWrites = append(s.pendingWrites, c)
+	}
+}
 
-	switch cmd {
-	case "SET":
-		switch len_cmd {
-		case 3:
-			val := parts[2]
-			return s.handleSet(key, val)
-		case 4:
-			val := parts[2]
-			ttl := parts[3]
-			return s.handleSetWithTTL(key, val, ttl)
+// writePendingReplies writes the replies queued since the last poll
+func (s *Server) writePendingReplies() {
+	for i, c := range s.pendingWrites {
+		c.pendingWrite = false
+		switch {
+		case s.clients[c.Fd] != c:
+		case c.closeASAP:
+			s.closeConn(c.fDconn)
 		default:
-			return nil, errors.New("SET message must atleast have key and value")
-		}
-	case "GET":
-		return s.handleGet(key)
-	case "DEL":
-		return s.handleDel(key)
-	case "HAS":
-		return s.handleHas(key)
-	default:
-		return nil, fmt.Errorf("unknown Command %s", cmd)
+			s.writeReplies(c)
+		}
+		s.pendingWrites[i] = nil
+	}
+	s.pendingWrites = s.pendingWrites[:0]
+}
+
+// writeReplies writes the queued replies of the client with writev, keeping
+// what the socket does not accept and waiting for it to become writable
+func (s *Server) writeReplies(c *clientConn) {
+	c.seal()
+	for len(c.out) > 0 {
+		n, err := c.writev(c.out)
+		if err == syscall.EAGAIN {
+			break
+		}
+		if err != nil {
+			s.closeConn(c.fDconn)
+			return
+		}
+		c.consumeOut(n)
+	}
+	if len(c.out) == 0 && c.quit {
+		s.closeConn(c.fDconn)
+		return
+	}
+
+	if len(c.out) == 0 && cap(c.outbuf) > maxReplyBufSize {
+		// do not pin the memory of a big reply for good
+		c.outbuf, c.outpos = nil, 0
+	}
+	waitWrite := len(c.out) > 0
+	if waitWrite == c.waitWrite {
+		return
 	}
+
+	op := iomultiplexer.OP_READ
+	if waitWrite {
+		op |= iomultiplexer.OP_WRITE
+	}
+	if err := s.multiplexer.Modify(iomultiplexer.Event{Fd: c.Fd, Op: op}); err != nil {
+		log.Println("err", err)
+		s.closeConn(c.fDconn)
+		return
+	}
+	c.waitWrite = waitWrite
+}
+
+// flushReplies writes the pending replies of a client whose socket is writable
+func (s *Server) flushReplies(fd int) {
+	if c, ok := s.clients[fd]; ok {
+		s.writeReplies(c)
+	}
+}
+
+// closeConn closes the client connection and releases its server side state
+func (s *Server) closeConn(conn fDconn) {
+	if c, ok := s.clients[conn.Fd]; ok {
+		c.releaseQueryBuf()
+		s.releaseConnIP(c)
+		if c.pubsub != nil {
+			s.unsubscribeAll(c.pubsub)
+		}
+		delete(s.trackers, conn.Fd)
+	}
+	if bc, ok := s.blocked[conn.Fd]; ok {
+		bc.unblock(s)
+	}
+	delete(s.clients, conn.Fd)
+	conn.Close()
+	s.con_clients--
 }
 
-func (s *Server) handleSet(key string, val string) ([]byte, error) {
-	err := s.cache.Set(key, val)
+func (s *Server) handlecommand(conn fDconn, parts []string) (Reply, error) {
+	if s.raft != nil && len(parts) > 0 {
+		if routed, err := s.routeRaft(conn, parts); routed {
+			return nil, err
+		}
+	}
+	return s.dispatch(Client{conn: conn}, parts)
+}
+
+// dispatch looks up and runs a command for client, notifying the watchers
+// of the keys it wrote
+func (s *Server) dispatch(client Client, parts []string) (Reply, error) {
+	if len(parts) == 0 {
+		return nil, errors.New("message must atleast have command")
+	}
+
+	cmd, ok := s.lookupCommand(parts[0])
+	if !ok {
+		return nil, fmt.Errorf("unknown Command %s", parts[0])
+	}
+	if err := cmd.checkArity(parts); err != nil {
+		return nil, err
+	}
+	if err := s.checkSubscribed(client.conn, cmd); err != nil {
+		return nil, err
+	}
+	if s.ReadOnly && cmd.hasFlag(FlagWrite) {
+		return nil, errReadOnly
+	}
+	if len(s.preHooks) > 0 {
+		if err := s.runPreHooks(client, cmd, parts[1:]); err != nil {
+			return nil, err
+		}
+	}
+
+	if c, ok := s.clients[client.conn.Fd]; ok {
+		c.startRequest()
+	}
+	s.logReceived(client, parts)
+	var endTrace func(error)
+	if s.tracer != nil {
+		endTrace = s.traceCommand(client, cmd)
+	}
+	start := time.Now()
+	reply, err := cmd.Handler(s, client, parts[1:])
+	elapsed := time.Since(start)
+	if endTrace != nil {
+		endTrace(err)
+	}
+	s.logSlow(client, parts, elapsed)
+	s.monitorLatency(latencyCommand, elapsed)
+	s.recordCommandLatency(cmd, elapsed)
+	s.recordHotKeys(cmd, parts)
+	s.countTenantCommand(cmd, parts)
+	s.stats.commands++
+	if len(s.postHooks) > 0 {
+		s.runPostHooks(client, cmd, parts[1:], reply, err)
+	}
+
+	if len(s.trackers) > 0 && cmd.hasFlag(FlagReadonly) {
+		s.trackRead(client, cmd, parts)
+	}
+	// writes blocked until the backing store acknowledges them have
+	// already changed the cache
+	written := err == nil || (err == errClientBlocked && !cmd.hasFlag(FlagBlocking))
+	if written && cmd.hasFlag(FlagWrite) {
+		s.keysWritten(cmd.Name, client.conn.Fd, cmd.keys(parts))
+	}
+	return reply, err
+}
+
+// keysWritten records that the command name of the client of fd wrote
+// keys, for their versions, watchers, webhooks, change sink, tracking
+// clients and search indexes. It is called for the keys of every write, and by the
+// writes of keys that are not arguments, such as DELPREFIX
+func (s *Server) keysWritten(name string, fd int, keys []string) {
+	s.cache.Written(keys...)
+	s.uncacheReplies(keys)
+	if len(s.watchers) > 0 {
+		s.notifyWrite(name, keys)
+	}
+	if len(s.webhooks) > 0 {
+		s.notifyWebhooks(strings.ToLower(name), keys)
+	}
+	if s.changes != nil {
+		s.keysChanged(strings.ToLower(name), keys)
+	}
+	if len(s.trackers) > 0 {
+		for _, key := range keys {
+			s.invalidate(key, fd)
+		}
+	}
+	if len(s.indexes) > 0 {
+		for _, key := range keys {
+			s.reindex(key)
+		}
+	}
+	if s.HistoryVersions > 0 || s.history != nil {
+		s.recordHistory(keys, false)
+	}
+}
+
+func (s *Server) handleSet(key string, val string) (Reply, error) {
+	err := s.cache.Set(key, []byte(val))
 	if err != nil {
 		return nil, err
 	}
 
-	log.Printf("SET %s %s\n", key, val)
-	return []byte("Success"), nil
+	s.logCommand("SET %q %q\n", key, val)
+	return OK, nil
 }
 
-func (s *Server) handleSetWithTTL(key string, val string, ttl string) ([]byte, error) {
+func (s *Server) handleSetWithTTL(key string, val string, ttl string) (Reply, error) {
 	parsedTTL, err := strconv.Atoi(ttl)
 	if err != nil {
 		return nil, errors.New("invalid TTl")
 	}
-	err = s.cache.SetWithTTL(key, val, int64(parsedTTL))
+	err = s.cache.SetWithTTL(key, []byte(val), int64(parsedTTL))
 	if err != nil {
 		return nil, err
 	}
 
-	log.Printf("SET %s %s exp: %v seconds\n", key, val, parsedTTL)
-	return []byte("Success"), nil
+	s.logCommand("SET %q %q exp: %v seconds\n", key, val, parsedTTL)
+	return OK, nil
 }
 
-func (s *Server) handleGet(key string) ([]byte, error) {
-	val, err := s.cache.Get(key)
+// handleSetAt implements SET key value PXAT unix-time-milliseconds
+func (s *Server) handleSetAt(key string, val string, at string) (Reply, error) {
+	expiresAt, err := strconv.ParseInt(at, 10, 64)
+	if err != nil || expiresAt <= 0 {
+		return nil, errors.New("invalid expire time in 'set' command")
+	}
+	if err := s.cache.SetAt(key, []byte(val), expiresAt); err != nil {
+		return nil, err
+	}
+
+	s.logCommand("SET %q %q exp at: %d\n", key, val, expiresAt)
+	return OK, nil
+}
+
+func (s *Server) handleGet(key string) (Reply, error) {
+	if val, ok := s.cachedGet(key); ok {
+		s.logCommand("GET %q %q cached\n", key, val)
+		return val, nil
+	}
+
+	val, decoded, err := s.cache.GetDecoded(key)
 	if err != nil {
 		return nil, err
 	}
+	if decoded {
+		s.cacheGet(key, val)
+	}
 
-	log.Printf("GET %s %s\n", key, val)
-	return []byte(val), nil
+	s.logCommand("GET %q %q\n", key, val)
+	return Bulk(val), nil
 }
 
-func (s *Server) handleDel(key string) ([]byte, error) {
-	err := s.cache.Delete(key)
+// handleGetEx implements GETEX key [EX seconds | PX milliseconds |
+// EXAT unix-time-seconds | PXAT unix-time-milliseconds | PERSIST]
+func (s *Server) handleGetEx(args []string) (Reply, error) {
+	var expiresAt int64
+	switch len(args) {
+	case 1:
+	case 2:
+		if !strings.EqualFold(args[1], "PERSIST") {
+			return nil, ErrSyntax
+		}
+		expiresAt = -1
+	case 3:
+		n, err := strconv.ParseInt(args[2], 10, 64)
+		if err != nil || n <= 0 {
+			return nil, errors.New("invalid expire time in GETEX")
+		}
+
+		switch strings.ToUpper(args[1]) {
+		case "EX":
+			expiresAt = s.cache.Now().UnixMilli() + n*1000
+		case "PX":
+			expiresAt = s.cache.Now().UnixMilli() + n
+		case "EXAT":
+			expiresAt = n * 1000
+		case "PXAT":
+			expiresAt = n
+		default:
+			return nil, ErrSyntax
+		}
+	default:
+		return nil, errWrongArgs("getex")
+	}
+
+	val, err := s.cache.GetEx(args[0], expiresAt)
 	if err != nil {
 		return nil, err
 	}
 
-	log.Printf("DEL %s\n", key)
-	return []byte("Success"), nil
+	s.logCommand("GETEX %q %q %v\n", args[0], val, args[1:])
+	return Bulk(val), nil
 }
 
-func (s *Server) handleHas(key string) ([]byte, error) {
+func (s *Server) handleDel(keys []string) (Reply, error) {
+	n := s.cache.DeleteKeys(keys...)
+	s.logCommand("DEL %v %d\n", keys, n)
+	return Int(n), nil
+}
+
+func (s *Server) handleExists(keys []string) (Reply, error) {
+	n := s.cache.Exists(keys...)
+	s.logCommand("EXISTS %v %d\n", keys, n)
+	return Int(n), nil
+}
+
+// handleType implements TYPE key
+func (s *Server) handleType(key string) (Reply, error) {
+	typ := s.cache.Type(key)
+	s.logCommand("TYPE %s %s\n", key, typ)
+	return Status(typ), nil
+}
+
+// handleObject implements OBJECT ENCODING key
+func (s *Server) handleObject(args []string) (Reply, error) {
+	if !strings.EqualFold(args[0], "ENCODING") {
+		return nil, fmt.Errorf("unknown subcommand '%s'", args[0])
+	}
+	encoding, ok := s.cache.Encoding(args[1])
+	if !ok {
+		return Nil, nil
+	}
+	return Bulk(encoding), nil
+}
+
+// handleKeyInfo implements KEYINFO key, replying with the creation, write,
+// access and expiry times of the key in unix milliseconds and its version
+func (s *Server) handleKeyInfo(key string) (Reply, error) {
+	info, ok := s.cache.KeyInfo(key)
+	if !ok {
+		return Nil, nil
+	}
+
+	s.logCommand("KEYINFO %q\n", key)
+	return Array{
+		Bulk("created"), Int(info.CreatedAt),
+		Bulk("written"), Int(info.WrittenAt),
+		Bulk("accessed"), Int(info.AccessedAt),
+		Bulk("expires"), Int(info.ExpiresAt),
+		Bulk("version"), Int(info.Version),
+	}, nil
+}
+
+func (s *Server) handleTouch(keys []string) (Reply, error) {
+	n := s.cache.Touch(keys...)
+	s.logCommand("TOUCH %v %d\n", keys, n)
+	return Int(n), nil
+}
+
+func (s *Server) handleUnlink(keys []string) (Reply, error) {
+	n := s.cache.Unlink(keys...)
+	s.logCommand("UNLINK %v %d\n", keys, n)
+	return Int(n), nil
+}
+
+// handleScan implements SCAN cursor [MATCH pattern] [COUNT count]
+func (s *Server) handleScan(args []string) (Reply, error) {
+	cursor, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+
+	pattern, typ, count, err := parseScanOpts(args[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	keys, next, err := s.cache.ScanType(cursor, count, pattern, typ)
+	if err != nil {
+		return nil, err
+	}
+	s.logCommand("SCAN %d %d keys next: %d\n", cursor, len(keys), next)
+
+	cur := strconv.FormatUint(next, 10)
+	text := []byte(cur)
+	for _, key := range keys {
+		text = append(text, '\n')
+		text = append(text, key...)
+	}
+	return withText(Array{Bulk(cur), bulks(keys)}, text), nil
+}
+
+// parseScanOpts parses the [MATCH pattern] [COUNT count] [TYPE type]
+// options of SCAN and DUMPALL
+func parseScanOpts(args []string) (pattern, typ string, count int, err error) {
+	count = 10
+	for i := 0; i < len(args); i += 2 {
+		if i+1 == len(args) {
+			return "", "", 0, ErrSyntax
+		}
+		switch strings.ToUpper(args[i]) {
+		case "MATCH":
+			pattern = args[i+1]
+			if pattern == "*" {
+				pattern = ""
+			}
+		case "COUNT":
+			if count, err = strconv.Atoi(args[i+1]); err != nil || count < 1 {
+				return "", "", 0, errors.New("invalid COUNT")
+			}
+		case "TYPE":
+			typ = args[i+1]
+		default:
+			return "", "", 0, ErrSyntax
+		}
+	}
+	return pattern, typ, count, nil
+}
+
+// handleFlushAll implements FLUSHALL and FLUSHDB [ASYNC|SYNC]
+func (s *Server) handleFlushAll(cmd string, args []string) (Reply, error) {
+	async := false
+	if len(args) > 1 {
+		return nil, errors.New(cmd + " message accepts at most one of ASYNC or SYNC")
+	}
+	if len(args) == 1 {
+		switch strings.ToUpper(args[0]) {
+		case "ASYNC":
+			async = true
+		case "SYNC":
+		default:
+			return nil, ErrSyntax
+		}
+	}
+
+	s.cache.FlushAll(async)
+	s.invalidateAll()
+	s.uncacheReplies(nil)
+	if s.changes != nil {
+		s.flushChanged()
+	}
+	s.clearIndexes()
+	s.flushHistory()
+	s.logCommand("%s async: %v\n", cmd, async)
+	return OK, nil
+}
+
+func (s *Server) handleHas(key string) (Reply, error) {
 	isPresent := s.cache.Has(key)
-	log.Printf("HAS %s %v\n", key, isPresent)
+	s.logCommand("HAS %s %v\n", key, isPresent)
 	if !isPresent {
-		return []byte("No"), nil
+		return Status("No"), nil
+	}
+
+	return Status("Yes"), nil
+}
+
+// handleGetWithVersion implements GET key WITHVERSION, replying with the
+// value and the version of the key, which SET IFVERSION expects. A
+// missing key fails like GET, its version being 0
+func (s *Server) handleGetWithVersion(args []string) (Reply, error) {
+	if len(args) != 2 || !strings.EqualFold(args[1], "WITHVERSION") {
+		return nil, ErrSyntax
+	}
+	val, err := s.cache.Get(args[0])
+	if err != nil {
+		return nil, err
 	}
+	version := s.cache.Version(args[0])
 
-	return []byte("Yes"), nil
+	s.logCommand("GET %q %q version: %d\n", args[0], val, version)
+	return Array{Bulk(val), Int(version)}, nil
+}
+
+// checkVersion fails with a CONFLICT error carrying the version of key
+// unless it is version, 0 standing for a missing key
+func (s *Server) checkVersion(key, version string) error {
+	expected, err := strconv.ParseUint(version, 10, 64)
+	if err != nil {
+		return errors.New("version is not an integer or out of range")
+	}
+	if v := s.cache.Version(key); v != expected {
+		return cache.Errorf(cache.KindConflict, "the key is at version %d", v)
+	}
+	return nil
 }
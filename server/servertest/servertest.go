@@ -0,0 +1,292 @@
+// Package servertest runs servers on free ports of the loopback interface
+// for integration tests, with a RESP client to send them commands and
+// check their replies, as net/http/httptest does for HTTP handlers
+package servertest
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/KavetiRohith/go-cache/cache"
+	"github.com/KavetiRohith/go-cache/server"
+)
+
+// DefaultCronFrequency is the CronFrequency of the servers started with a
+// zero one, short for keys to expire soon after their deadline in tests
+const DefaultCronFrequency = 100 * time.Millisecond
+
+// ReplyTimeout is how long a client waits for a reply before failing the
+// test, which must be longer than the timeouts of the blocking commands
+// sent
+var ReplyTimeout = 10 * time.Second
+
+// Server is a server started for a test, stopped when it ends
+type Server struct {
+	*server.Server
+	// Addr is the host:port the server listens on
+	Addr string
+
+	tb     testing.TB
+	done   chan error
+	once   sync.Once
+	client *Client
+}
+
+// NewServer starts a server of opts serving c, or an empty cache if nil,
+// the Host and Port of opts being ignored for a free port of the loopback
+// interface. The server is stopped when the test and its subtests end
+func NewServer(tb testing.TB, opts server.ServerOpts, c *cache.Cache) *Server {
+	tb.Helper()
+	opts.Host, opts.Port = "127.0.0.1", 0
+	if opts.CronFrequency <= 0 {
+		opts.CronFrequency = DefaultCronFrequency
+	}
+	if c == nil {
+		c = cache.New()
+	}
+
+	s := &Server{Server: server.NewServer(opts, c), tb: tb, done: make(chan error, 1)}
+	go func() { s.done <- s.Start() }()
+
+	// the functions posted before Start run once it listens, with the port
+	// the kernel picked
+	port := make(chan int, 1)
+	s.Post(func() { port <- s.Port })
+	select {
+	case p := <-port:
+		s.Addr = net.JoinHostPort(opts.Host, strconv.Itoa(p))
+	case err := <-s.done:
+		tb.Fatalf("servertest: starting the server: %v", err)
+	}
+
+	tb.Cleanup(s.Close)
+	return s
+}
+
+// Close stops the server and waits for it to return. It is called when the
+// test ends and may be called before
+func (s *Server) Close() {
+	s.once.Do(func() {
+		s.Stop()
+		if err := <-s.done; err != nil {
+			s.tb.Errorf("servertest: running the server: %v", err)
+		}
+	})
+}
+
+// Run runs fn with the cache on the event loop of the server, which owns
+// it, and waits for it to return
+func (s *Server) Run(fn func(c *cache.Cache)) {
+	done := make(chan struct{})
+	s.Post(func() {
+		defer close(done)
+		fn(s.Cache())
+	})
+	<-done
+}
+
+// Load stores the strings of fixtures at their keys, replacing the values
+// held. The fixtures of other types can be stored with Run
+func (s *Server) Load(fixtures map[string]string) {
+	s.Run(func(c *cache.Cache) {
+		for key, value := range fixtures {
+			c.Set(key, []byte(value))
+		}
+	})
+}
+
+// NewClient connects a client to the server, closed when the test ends
+func (s *Server) NewClient() *Client {
+	s.tb.Helper()
+	conn, err := net.Dial("tcp", s.Addr)
+	if err != nil {
+		s.tb.Fatalf("servertest: connecting to %s: %v", s.Addr, err)
+	}
+	c := &Client{tb: s.tb, conn: conn, r: bufio.NewReader(conn)}
+	s.tb.Cleanup(func() { conn.Close() })
+	return c
+}
+
+// Do sends a command over the client of the server, connected on first
+// use. See Client.Do
+func (s *Server) Do(args ...string) (any, error) {
+	s.tb.Helper()
+	return s.defaultClient().Do(args...)
+}
+
+// Expect sends a command over the client of the server and checks its
+// reply. See Client.Expect
+func (s *Server) Expect(want any, args ...string) {
+	s.tb.Helper()
+	s.defaultClient().Expect(want, args...)
+}
+
+// ExpectError sends a command over the client of the server and checks
+// that it fails. See Client.ExpectError
+func (s *Server) ExpectError(prefix string, args ...string) {
+	s.tb.Helper()
+	s.defaultClient().ExpectError(prefix, args...)
+}
+
+func (s *Server) defaultClient() *Client {
+	if s.client == nil {
+		s.client = s.NewClient()
+	}
+	return s.client
+}
+
+// Error is an error reply, such as "ERR syntax error"
+type Error string
+
+func (e Error) Error() string {
+	return string(e)
+}
+
+// Client is a connection to a server sending one command at a time
+type Client struct {
+	tb   testing.TB
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// Do sends a command and returns its reply, or an Error for an error
+// reply. Simple strings, bulk strings and doubles are returned as string,
+// integers as int64, booleans as bool, nulls as nil, and arrays, sets,
+// maps and pushes as []any, maps alternating keys and values. The test
+// fails if the connection does
+func (c *Client) Do(args ...string) (any, error) {
+	c.tb.Helper()
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+
+	c.conn.SetDeadline(time.Now().Add(ReplyTimeout))
+	if _, err := c.conn.Write([]byte(b.String())); err != nil {
+		c.tb.Fatalf("servertest: sending %s: %v", strings.Join(args, " "), err)
+	}
+	reply, err := c.readReply()
+	var replyErr Error
+	if err != nil && !errors.As(err, &replyErr) {
+		c.tb.Fatalf("servertest: reading the reply to %s: %v", strings.Join(args, " "), err)
+	}
+	return reply, err
+}
+
+// Expect sends a command and checks that its reply is want, in which ints
+// stand for int64 and []string for []any to keep the expectations short
+func (c *Client) Expect(want any, args ...string) {
+	c.tb.Helper()
+	got, err := c.Do(args...)
+	if err != nil {
+		c.tb.Errorf("%s: got error %q, want %#v", strings.Join(args, " "), err, want)
+		return
+	}
+	if want = normalize(want); !reflect.DeepEqual(got, want) {
+		c.tb.Errorf("%s: got %#v, want %#v", strings.Join(args, " "), got, want)
+	}
+}
+
+// ExpectError sends a command and checks that it fails with an error
+// starting with prefix, such as "ERR" or "WRONGTYPE"
+func (c *Client) ExpectError(prefix string, args ...string) {
+	c.tb.Helper()
+	got, err := c.Do(args...)
+	if err == nil {
+		c.tb.Errorf("%s: got %#v, want an error starting with %q", strings.Join(args, " "), got, prefix)
+	} else if !strings.HasPrefix(err.Error(), prefix) {
+		c.tb.Errorf("%s: got error %q, want an error starting with %q", strings.Join(args, " "), err, prefix)
+	}
+}
+
+func normalize(v any) any {
+	switch v := v.(type) {
+	case int:
+		return int64(v)
+	case []string:
+		elems := make([]any, len(v))
+		for i, s := range v {
+			elems[i] = s
+		}
+		return elems
+	case []any:
+		elems := make([]any, len(v))
+		for i, elem := range v {
+			elems[i] = normalize(elem)
+		}
+		return elems
+	default:
+		return v
+	}
+}
+
+// readReply reads a reply in RESP2 or RESP3
+func (c *Client) readReply() (any, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || !strings.HasSuffix(line, "\r\n") {
+		return nil, fmt.Errorf("malformed reply %q", line)
+	}
+	kind, line := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+', ',':
+		return line, nil
+	case '-':
+		return nil, Error(line)
+	case ':':
+		return strconv.ParseInt(line, 10, 64)
+	case '#':
+		return line == "t", nil
+	case '_':
+		return nil, nil
+	case '$', '=':
+		n, err := strconv.Atoi(line)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		if kind == '=' && n >= 4 {
+			// verbatim strings start with their format, such as txt:
+			return string(buf[4:n]), nil
+		}
+		return string(buf[:n]), nil
+	case '*', '~', '>', '%':
+		n, err := strconv.Atoi(line)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		if kind == '%' {
+			n *= 2
+		}
+		elems := make([]any, n)
+		for i := range elems {
+			// the errors nested in arrays are kept as elements
+			if elems[i], err = c.readReply(); err != nil {
+				var replyErr Error
+				if !errors.As(err, &replyErr) {
+					return nil, err
+				}
+				elems[i] = replyErr
+			}
+		}
+		return elems, nil
+	default:
+		return nil, fmt.Errorf("unknown reply type %q", kind)
+	}
+}
@@ -0,0 +1,204 @@
+package server
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/KavetiRohith/go-cache/cache"
+)
+
+// handleCMSInitByDim implements CMS.INITBYDIM key width depth
+func (s *Server) handleCMSInitByDim(args []string) (Reply, error) {
+	width, err1 := strconv.ParseUint(args[1], 10, 64)
+	depth, err2 := strconv.ParseUint(args[2], 10, 64)
+	if err1 != nil || err2 != nil {
+		return nil, errors.New("invalid width/depth")
+	}
+
+	if err := s.cache.CMSInitByDim(args[0], width, depth); err != nil {
+		return nil, err
+	}
+
+	s.logCommand("CMS.INITBYDIM %s %d %d\n", args[0], width, depth)
+	return OK, nil
+}
+
+// handleCMSInitByProb implements CMS.INITBYPROB key error probability
+func (s *Server) handleCMSInitByProb(args []string) (Reply, error) {
+	errorRate, err1 := strconv.ParseFloat(args[1], 64)
+	probability, err2 := strconv.ParseFloat(args[2], 64)
+	if err1 != nil || err2 != nil {
+		return nil, errors.New("invalid overestimation value")
+	}
+
+	if err := s.cache.CMSInitByProb(args[0], errorRate, probability); err != nil {
+		return nil, err
+	}
+
+	s.logCommand("CMS.INITBYPROB %s %v %v\n", args[0], errorRate, probability)
+	return OK, nil
+}
+
+// handleCMSIncrBy implements CMS.INCRBY key item increment [item increment ...],
+// replying with the new estimated counts of the items
+func (s *Server) handleCMSIncrBy(args []string) (Reply, error) {
+	items, increments, err := parseIncrements("cms.incrby", args[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	counts, err := s.cache.CMSIncrBy(args[0], bytesArgs(items), increments)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logCommand("CMS.INCRBY %s %v %v\n", args[0], items, increments)
+	return counters(counts), nil
+}
+
+// handleCMSQuery implements CMS.QUERY key item [item ...]
+func (s *Server) handleCMSQuery(args []string) (Reply, error) {
+	counts, err := s.cache.CMSQuery(args[0], bytesArgs(args[1:])...)
+	if err != nil {
+		return nil, err
+	}
+	return counters(counts), nil
+}
+
+// handleTopKReserve implements TOPK.RESERVE key topk [width depth decay]
+func (s *Server) handleTopKReserve(args []string) (Reply, error) {
+	if len(args) != 2 && len(args) != 5 {
+		return nil, ErrSyntax
+	}
+
+	k, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid topk")
+	}
+	width, depth, decay := uint64(cache.DefaultTopKWidth), uint64(cache.DefaultTopKDepth), cache.DefaultTopKDecay
+	if len(args) == 5 {
+		var err1, err2, err3 error
+		width, err1 = strconv.ParseUint(args[2], 10, 64)
+		depth, err2 = strconv.ParseUint(args[3], 10, 64)
+		decay, err3 = strconv.ParseFloat(args[4], 64)
+		if err1 != nil || err2 != nil || err3 != nil {
+			return nil, errors.New("invalid width, depth or decay")
+		}
+	}
+
+	if err := s.cache.TopKReserve(args[0], k, width, depth, decay); err != nil {
+		return nil, err
+	}
+
+	s.logCommand("TOPK.RESERVE %s %d %d %d %v\n", args[0], k, width, depth, decay)
+	return OK, nil
+}
+
+// handleTopKAdd implements TOPK.ADD key item [item ...], replying for each
+// item with the item it expelled from the list or nil
+func (s *Server) handleTopKAdd(args []string) (Reply, error) {
+	increments := make([]uint64, len(args)-1)
+	for i := range increments {
+		increments[i] = 1
+	}
+	return s.topKIncrBy(args[0], args[1:], increments)
+}
+
+// handleTopKIncrBy implements TOPK.INCRBY key item increment [item increment ...]
+func (s *Server) handleTopKIncrBy(args []string) (Reply, error) {
+	items, increments, err := parseIncrements("topk.incrby", args[1:])
+	if err != nil {
+		return nil, err
+	}
+	return s.topKIncrBy(args[0], items, increments)
+}
+
+func (s *Server) topKIncrBy(key string, items []string, increments []uint64) (Reply, error) {
+	expelled, err := s.cache.TopKIncrBy(key, items, increments)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logCommand("TOPK.INCRBY %s %v %v\n", key, items, increments)
+	r := make(Array, len(expelled))
+	for i, item := range expelled {
+		r[i] = Nil
+		if item != nil {
+			r[i] = Bulk(*item)
+		}
+	}
+	return r, nil
+}
+
+// handleTopKQuery implements TOPK.QUERY key item [item ...]
+func (s *Server) handleTopKQuery(args []string) (Reply, error) {
+	found, err := s.cache.TopKQuery(args[0], args[1:]...)
+	if err != nil {
+		return nil, err
+	}
+
+	r := make(Array, len(found))
+	for i, ok := range found {
+		r[i] = boolToInt(ok)
+	}
+	return r, nil
+}
+
+// handleTopKList implements TOPK.LIST key [WITHCOUNT]
+func (s *Server) handleTopKList(args []string) (Reply, error) {
+	withCount := false
+	if len(args) == 2 {
+		if !strings.EqualFold(args[1], "WITHCOUNT") {
+			return nil, ErrSyntax
+		}
+		withCount = true
+	} else if len(args) > 2 {
+		return nil, ErrSyntax
+	}
+
+	items, err := s.cache.TopKList(args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	r := make(Array, 0, len(items))
+	for _, item := range items {
+		r = append(r, Bulk(item.Item))
+		if withCount {
+			r = append(r, Int(item.Count))
+		}
+	}
+	return r, nil
+}
+
+// parseIncrements parses the item increment pairs of the command cmd
+func parseIncrements(cmd string, args []string) ([]string, []uint64, error) {
+	if len(args) == 0 || len(args)%2 != 0 {
+		return nil, nil, errWrongArgs(cmd)
+	}
+
+	items := make([]string, 0, len(args)/2)
+	increments := make([]uint64, 0, len(args)/2)
+	for i := 0; i < len(args); i += 2 {
+		n, err := strconv.ParseUint(args[i+1], 10, 64)
+		if err != nil {
+			return nil, nil, errors.New("cannot parse number")
+		}
+		items = append(items, args[i])
+		increments = append(increments, n)
+	}
+	return items, increments, nil
+}
+
+// counters returns an array of counts, capped to the largest integer reply
+func counters(counts []uint64) Array {
+	r := make(Array, len(counts))
+	for i, n := range counts {
+		if n > 1<<63-1 {
+			n = 1<<63 - 1
+		}
+		r[i] = Int(n)
+	}
+	return r
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultSlowlogLogSlowerThan is the default duration from which
+	// commands are recorded in the slow log
+	DefaultSlowlogLogSlowerThan = 10 * time.Millisecond
+	// DefaultSlowlogMaxLen is the default number of entries of the slow log
+	DefaultSlowlogMaxLen = 128
+	// slowlogMaxArgs and slowlogMaxArgLen bound the arguments recorded
+	// for a command, so that the slow log never holds big values
+	slowlogMaxArgs   = 32
+	slowlogMaxArgLen = 128
+)
+
+// slowlogEntry is a command that ran for at least SlowlogLogSlowerThan
+type slowlogEntry struct {
+	id       int64
+	at       time.Time
+	duration time.Duration
+	args     []string
+	addr     string
+	name     string
+	// reqID is the request ID of the command, if the client gave one
+	reqID string
+}
+
+// slowlog holds the latest slow commands, oldest first
+type slowlog struct {
+	entries []slowlogEntry
+	nextID  int64
+}
+
+// logSlow records the command in the slow log if it ran for long enough
+func (s *Server) logSlow(client Client, args []string, d time.Duration) {
+	if s.SlowlogLogSlowerThan < 0 || d < s.SlowlogLogSlowerThan {
+		return
+	}
+
+	n := len(args)
+	if n > slowlogMaxArgs {
+		n = slowlogMaxArgs
+	}
+	entry := slowlogEntry{id: s.slowlog.nextID, at: s.cache.Now(), duration: d, args: make([]string, n)}
+	for i := range entry.args {
+		arg := args[i]
+		if i == slowlogMaxArgs-1 && len(args) > slowlogMaxArgs {
+			arg = "... (" + strconv.Itoa(len(args)-slowlogMaxArgs+1) + " more arguments)"
+		} else if len(arg) > slowlogMaxArgLen {
+			// the concatenation copies the prefix, which would pin
+			// the whole argument otherwise
+			arg = arg[:slowlogMaxArgLen] + "... (" + strconv.Itoa(len(arg)-slowlogMaxArgLen) + " more bytes)"
+		}
+		entry.args[i] = arg
+	}
+	if c, ok := s.clients[client.conn.Fd]; ok {
+		entry.addr, entry.name, entry.reqID = c.addr, c.name, c.cmdRequestID
+	}
+
+	s.slowlog.nextID++
+	s.slowlog.entries = append(s.slowlog.entries, entry)
+	if over := len(s.slowlog.entries) - s.SlowlogMaxLen; over > 0 {
+		s.slowlog.entries = append(s.slowlog.entries[:0], s.slowlog.entries[over:]...)
+	}
+}
+
+// handleSlowlog implements SLOWLOG GET [count] | LEN | RESET
+func (s *Server) handleSlowlog(args []string) (Reply, error) {
+	switch strings.ToUpper(args[0]) {
+	case "GET":
+		count := 10
+		if len(args) == 2 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < -1 {
+				return nil, errors.New("count should be greater than or equal to -1")
+			}
+			count = n
+		}
+		entries := s.slowlog.entries
+		if count == -1 || count > len(entries) {
+			count = len(entries)
+		}
+
+		// newest first, as in Redis
+		r := make(Array, 0, count)
+		for i := len(entries) - 1; i >= len(entries)-count; i-- {
+			e := entries[i]
+			r = append(r, Array{
+				Int(e.id), Int(e.at.Unix()), Int(e.duration.Microseconds()),
+				bulks(e.args), Bulk(e.addr), Bulk(e.name), Bulk(e.reqID),
+			})
+		}
+		return r, nil
+
+	case "LEN":
+		return Int(len(s.slowlog.entries)), nil
+
+	case "RESET":
+		s.slowlog.entries = nil
+		return OK, nil
+
+	default:
+		return nil, fmt.Errorf("unknown subcommand '%s'", args[0])
+	}
+}
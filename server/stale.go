@@ -0,0 +1,57 @@
+package server
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/KavetiRohith/go-cache/cache"
+)
+
+// handleSoftExpire implements SOFTEXPIRE key seconds, which makes the value
+// of key stale after seconds, 0 making it fresh for good, while its TTL is
+// left as it is
+func (s *Server) handleSoftExpire(args []string) (Reply, error) {
+	seconds, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil || seconds < 0 {
+		return nil, errors.New("invalid expire time in 'softexpire' command")
+	}
+
+	var staleAt int64
+	if seconds > 0 {
+		staleAt = s.cache.Now().UnixMilli() + seconds*1000
+	}
+	ok := s.cache.SoftExpireAt(args[0], staleAt)
+
+	s.logCommand("SOFTEXPIRE %s %d %v\n", args[0], seconds, ok)
+	return boolToInt(ok), nil
+}
+
+// handleSoftTTL implements SOFTTTL key, replying with the seconds left
+// before the value of key goes stale, 0 if it is stale, -1 if it never goes
+// stale and -2 if the key does not exist
+func (s *Server) handleSoftTTL(key string) (Reply, error) {
+	staleAt := s.cache.StaleTime(key)
+	if staleAt < 0 {
+		return Int(staleAt), nil
+	}
+
+	left := staleAt - s.cache.Now().UnixMilli()
+	if left < 0 {
+		return Int(0), nil
+	}
+	return Int((left + 999) / 1000), nil
+}
+
+// handleGetStale implements GETSTALE key, replying with the value of key
+// and 1 if it is stale or 0 if it is fresh, or nil if the key does not
+// exist. Unlike GET it neither loads nor refreshes the key
+func (s *Server) handleGetStale(key string) (Reply, error) {
+	val, stale, err := s.cache.GetStale(key)
+	if err == cache.ErrNoSuchKey {
+		return Nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return Array{Bulk(val), boolToInt(stale)}, nil
+}
@@ -0,0 +1,369 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KavetiRohith/go-cache/cache"
+)
+
+// errClientBlocked is returned by handlers that parked the client
+// instead of replying right away
+var errClientBlocked = errors.New("client blocked")
+
+// blockedClient is a client waiting in XREAD or XREADGROUP for new entries
+type blockedClient struct {
+	conn fDconn
+	keys []string
+	// serve retries the blocked command, returning a nil reply
+	// if there is still nothing to deliver
+	serve func() (Reply, error)
+	// timeout unblocks the client with a nil reply, nil if the
+	// client blocks forever
+	timeout *Timer
+}
+
+// block parks the client until one of the keys receives new entries
+// or the timeout elapses, a zero timeout meaning forever
+func (s *Server) block(conn fDconn, keys []string, timeout time.Duration, serve func() (Reply, error)) error {
+	if _, ok := s.clients[conn.Fd]; !ok {
+		return errors.New("blocking is not supported on this connection")
+	}
+	bc := &blockedClient{conn: conn, keys: keys, serve: serve}
+	if timeout > 0 {
+		bc.timeout = s.AfterFunc(timeout, func() {
+			bc.unblock(s)
+			s.reply(bc.conn, Nil, nil)
+			s.resumeClients([]*blockedClient{bc})
+		})
+	}
+	s.blocked[conn.Fd] = bc
+	return errClientBlocked
+}
+
+// unblock removes the client from the blocked clients
+func (bc *blockedClient) unblock(s *Server) {
+	if bc.timeout != nil {
+		bc.timeout.Stop()
+	}
+	delete(s.blocked, bc.conn.Fd)
+}
+
+// handleXAdd implements XADD key [MAXLEN [= | ~] threshold] <* | id>
+// field value [field value ...], the approximate trimming of ~ trimming
+// exactly as Redis allows
+func (s *Server) handleXAdd(args []string) (Reply, error) {
+	key, rest := args[0], args[1:]
+	maxLen := -1
+	if strings.EqualFold(rest[0], "MAXLEN") {
+		rest = rest[1:]
+		if len(rest) > 0 && (rest[0] == "=" || rest[0] == "~") {
+			rest = rest[1:]
+		}
+		if len(rest) == 0 {
+			return nil, ErrSyntax
+		}
+		n, err := strconv.Atoi(rest[0])
+		if err != nil {
+			return nil, errors.New("value is not an integer or out of range")
+		}
+		if n < 0 {
+			return nil, errors.New("The MAXLEN argument must be >= 0.")
+		}
+		maxLen, rest = n, rest[1:]
+	}
+	if len(rest) < 3 {
+		return nil, errWrongArgs("xadd")
+	}
+
+	idSpec, fields := rest[0], rest[1:]
+	id, err := s.cache.XAddMaxLen(key, idSpec, fields, maxLen)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logCommand("XADD %s %s %v\n", key, id, fields)
+	s.serveBlockedClients(key)
+	return Bulk(id.String()), nil
+}
+
+func (s *Server) handleXLen(key string) (Reply, error) {
+	n, err := s.cache.XLen(key)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logCommand("XLEN %s %d\n", key, n)
+	return Int(n), nil
+}
+
+func (s *Server) handleXRange(args []string) (Reply, error) {
+	if len(args) != 3 && len(args) != 5 {
+		return nil, errWrongArgs("xrange")
+	}
+
+	start, err := parseRangeID(args[1], 0)
+	if err != nil {
+		return nil, err
+	}
+	end, err := parseRangeID(args[2], cache.MaxStreamID.Seq)
+	if err != nil {
+		return nil, err
+	}
+
+	count := 0
+	if len(args) == 5 {
+		if !strings.EqualFold(args[3], "COUNT") {
+			return nil, ErrSyntax
+		}
+		if count, err = strconv.Atoi(args[4]); err != nil || count < 0 {
+			return nil, errors.New("invalid COUNT")
+		}
+		if count == 0 {
+			return Array{}, nil
+		}
+	}
+
+	entries, err := s.cache.XRange(args[0], start, end, count)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logCommand("XRANGE %s %s %s %d entries\n", args[0], start, end, len(entries))
+	if len(entries) == 0 {
+		return Array{}, nil
+	}
+	return entriesReply(entries), nil
+}
+
+// handleXRead implements
+// XREAD [COUNT count] [BLOCK milliseconds] STREAMS key [key ...] id [id ...]
+func (s *Server) handleXRead(client Client, args []string) (Reply, error) {
+	opts, err := parseReadOpts(args, false)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]cache.StreamID, len(opts.keys))
+	for j, spec := range opts.ids {
+		if spec == "$" {
+			last, err := s.cache.XLastID(opts.keys[j])
+			if err != nil {
+				return nil, err
+			}
+			ids[j] = last
+			continue
+		}
+
+		id, err := cache.ParseStreamID(spec, 0)
+		if err != nil {
+			return nil, err
+		}
+		ids[j] = id
+	}
+
+	serve := func() (Reply, error) {
+		return s.readStreams(opts.keys, ids, opts.count)
+	}
+	resp, err := serve()
+	if err != nil {
+		return nil, err
+	}
+
+	s.logCommand("XREAD %v %v\n", opts.keys, ids)
+	if resp != nil {
+		return resp, nil
+	}
+	if !opts.block {
+		return Nil, nil
+	}
+
+	return nil, s.block(client.conn, opts.keys, opts.timeout, serve)
+}
+
+// readOpts holds the options shared by XREAD and XREADGROUP
+type readOpts struct {
+	count   int
+	block   bool
+	timeout time.Duration
+	noAck   bool
+	keys    []string
+	ids     []string
+}
+
+// parseReadOpts parses
+// [COUNT count] [BLOCK milliseconds] [NOACK] STREAMS key [key ...] id [id ...]
+// where NOACK is only accepted when allowNoAck is set
+func parseReadOpts(args []string, allowNoAck bool) (readOpts, error) {
+	var (
+		opts readOpts
+		i    int
+	)
+
+	for ; i < len(args); i++ {
+		opt := strings.ToUpper(args[i])
+		if opt == "STREAMS" {
+			break
+		}
+		if opt == "NOACK" && allowNoAck {
+			opts.noAck = true
+			continue
+		}
+		if i+1 >= len(args) {
+			return opts, ErrSyntax
+		}
+
+		switch opt {
+		case "COUNT":
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil || n < 0 {
+				return opts, errors.New("invalid COUNT")
+			}
+			opts.count = n
+		case "BLOCK":
+			ms, err := strconv.Atoi(args[i+1])
+			if err != nil || ms < 0 {
+				return opts, errors.New("timeout is not an integer or out of range")
+			}
+			opts.block = true
+			opts.timeout = time.Duration(ms) * time.Millisecond
+		default:
+			return opts, ErrSyntax
+		}
+		i++
+	}
+
+	if i == len(args) {
+		return opts, ErrSyntax
+	}
+	streams := args[i+1:]
+	if len(streams) == 0 || len(streams)%2 != 0 {
+		return opts, errors.New("unbalanced list of streams: for each stream key an ID must be specified")
+	}
+
+	opts.keys = streams[:len(streams)/2]
+	opts.ids = streams[len(streams)/2:]
+	return opts, nil
+}
+
+// readStreams returns the entries newer than the given IDs for
+// every key, or nil if none of the streams has new entries
+func (s *Server) readStreams(keys []string, ids []cache.StreamID, count int) (Reply, error) {
+	var r streamsReply
+	for i, key := range keys {
+		entries, err := s.cache.XReadAfter(key, ids[i], count)
+		if err != nil {
+			return nil, err
+		}
+		r.add(key, entries)
+	}
+	return r.reply(), nil
+}
+
+// streamsReply accumulates the entries read from several streams, replied
+// as [[key, entries], ...] in RESP and one "<key> <id> <field> <value> ..."
+// line per entry in the text protocol
+type streamsReply struct {
+	streams Array
+	lines   [][]byte
+}
+
+// add appends the entries read from key, skipping streams without entries
+func (r *streamsReply) add(key string, entries []cache.StreamEntry) {
+	if len(entries) == 0 {
+		return
+	}
+	r.streams = append(r.streams, Array{Bulk(key), entriesReply(entries)})
+	r.lines = append(r.lines, formatEntries(key, entries))
+}
+
+// reply returns the accumulated reply, or nil if no entries were added
+func (r *streamsReply) reply() Reply {
+	if len(r.streams) == 0 {
+		return nil
+	}
+	return withText(r.streams, bytes.Join(r.lines, []byte("\n")))
+}
+
+// serveBlockedClients replies to the clients blocked on key
+// now that new entries were added to it
+func (s *Server) serveBlockedClients(key string) {
+	var served []*blockedClient
+	for _, bc := range s.blocked {
+		if !contains(bc.keys, key) {
+			continue
+		}
+
+		r, err := bc.serve()
+		if err == nil && r == nil {
+			continue
+		}
+
+		bc.unblock(s)
+		s.reply(bc.conn, r, err)
+		served = append(served, bc)
+	}
+	s.resumeClients(served)
+}
+
+// resumeClients serves the commands that unblocked clients
+// pipelined after their blocking command
+func (s *Server) resumeClients(unblocked []*blockedClient) {
+	for _, bc := range unblocked {
+		if c, ok := s.clients[bc.conn.Fd]; ok {
+			s.processQuery(c)
+		}
+	}
+}
+
+// parseRangeID parses an XRANGE boundary, where "-" and "+" denote
+// the smallest and largest possible IDs
+func parseRangeID(s string, defaultSeq uint64) (cache.StreamID, error) {
+	switch s {
+	case "-":
+		return cache.StreamID{}, nil
+	case "+":
+		return cache.MaxStreamID, nil
+	}
+	return cache.ParseStreamID(s, defaultSeq)
+}
+
+// entriesReply returns the entries as [[id, [field, value, ...]], ...]
+// written one "<id> <field> <value> ..." line per entry in the text protocol
+func entriesReply(entries []cache.StreamEntry) Array {
+	arr := make(Array, len(entries))
+	for i, entry := range entries {
+		arr[i] = Array{Bulk(entry.ID.String()), bulks(entry.Fields)}
+	}
+	return arr
+}
+
+// formatEntries renders one entry per line as "<key> <id> <field> <value> ..."
+func formatEntries(key string, entries []cache.StreamEntry) []byte {
+	var buf bytes.Buffer
+	for i, entry := range entries {
+		if i > 0 {
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(key)
+		buf.WriteByte(' ')
+		buf.WriteString(entry.ID.String())
+		for _, field := range entry.Fields {
+			buf.WriteByte(' ')
+			buf.WriteString(field)
+		}
+	}
+	return buf.Bytes()
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
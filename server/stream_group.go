@@ -0,0 +1,350 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KavetiRohith/go-cache/cache"
+)
+
+// handleXGroup implements the XGROUP CREATE|SETID|DESTROY|CREATECONSUMER|DELCONSUMER subcommands
+func (s *Server) handleXGroup(args []string) (Reply, error) {
+	var (
+		sub   = strings.ToUpper(args[0])
+		key   = args[1]
+		group = args[2]
+	)
+
+	switch sub {
+	case "CREATE":
+		if len(args) == 5 && !strings.EqualFold(args[4], "MKSTREAM") {
+			return nil, ErrSyntax
+		}
+		if err := s.cache.XGroupCreate(key, group, args[3], len(args) == 5); err != nil {
+			return nil, err
+		}
+	case "SETID":
+		if err := s.cache.XGroupSetID(key, group, args[3]); err != nil {
+			return nil, err
+		}
+	case "DESTROY":
+		destroyed, err := s.cache.XGroupDestroy(key, group)
+		if err != nil {
+			return nil, err
+		}
+		s.logCommand("XGROUP DESTROY %s %s %v\n", key, group, destroyed)
+		return boolToInt(destroyed), nil
+	case "CREATECONSUMER":
+		created, err := s.cache.XGroupCreateConsumer(key, group, args[3])
+		if err != nil {
+			return nil, err
+		}
+		s.logCommand("XGROUP CREATECONSUMER %s %s %s %v\n", key, group, args[3], created)
+		return boolToInt(created), nil
+	case "DELCONSUMER":
+		pending, err := s.cache.XGroupDelConsumer(key, group, args[3])
+		if err != nil {
+			return nil, err
+		}
+		s.logCommand("XGROUP DELCONSUMER %s %s %s %d\n", key, group, args[3], pending)
+		return Int(pending), nil
+	default:
+		return nil, fmt.Errorf("unknown subcommand '%s'", args[0])
+	}
+
+	s.logCommand("XGROUP %s %s %s %v\n", sub, key, group, args[3:])
+	return OK, nil
+}
+
+// handleXReadGroup implements
+// XREADGROUP GROUP group consumer [COUNT count] [BLOCK milliseconds] [NOACK] STREAMS key [key ...] id [id ...]
+func (s *Server) handleXReadGroup(client Client, args []string) (Reply, error) {
+	if len(args) < 3 || !strings.EqualFold(args[0], "GROUP") {
+		return nil, errors.New("XREADGROUP message must start with GROUP group consumer")
+	}
+
+	group, consumer := args[1], args[2]
+	opts, err := parseReadOpts(args[3:], true)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		ids     = make([]cache.StreamID, len(opts.keys))
+		newOnly = true
+	)
+	for i, spec := range opts.ids {
+		if spec == ">" {
+			continue
+		}
+		newOnly = false
+		if ids[i], err = cache.ParseStreamID(spec, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	serve := func() (Reply, error) {
+		var r streamsReply
+		for i, key := range opts.keys {
+			var (
+				entries []cache.StreamEntry
+				err     error
+			)
+			if opts.ids[i] == ">" {
+				entries, err = s.cache.XReadGroupNew(key, group, consumer, opts.count, opts.noAck)
+			} else {
+				entries, err = s.cache.XReadGroupHistory(key, group, consumer, ids[i], opts.count)
+			}
+			if err != nil {
+				return nil, err
+			}
+			r.add(key, entries)
+		}
+		return r.reply(), nil
+	}
+
+	resp, err := serve()
+	if err != nil {
+		return nil, err
+	}
+
+	s.logCommand("XREADGROUP %s %s %v %v\n", group, consumer, opts.keys, opts.ids)
+	if resp != nil {
+		return resp, nil
+	}
+	// reading the history of a consumer never blocks
+	if !opts.block || !newOnly {
+		return Nil, nil
+	}
+
+	return nil, s.block(client.conn, opts.keys, opts.timeout, serve)
+}
+
+func (s *Server) handleXAck(args []string) (Reply, error) {
+	ids, err := parseStreamIDs(args[2:])
+	if err != nil {
+		return nil, err
+	}
+
+	acked, err := s.cache.XAck(args[0], args[1], ids)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logCommand("XACK %s %s %v %d\n", args[0], args[1], ids, acked)
+	return Int(acked), nil
+}
+
+// handleXPending implements
+// XPENDING key group [[IDLE min-idle-time] start end count [consumer]]
+func (s *Server) handleXPending(args []string) (Reply, error) {
+	key, group := args[0], args[1]
+	if len(args) == 2 {
+		summary, err := s.cache.XPendingSummary(key, group)
+		if err != nil {
+			return nil, err
+		}
+
+		s.logCommand("XPENDING %s %s %d\n", key, group, summary.Count)
+		if summary.Count == 0 {
+			return withText(Array{Int(0), Nil, Nil, Nil}, []byte("0")), nil
+		}
+
+		var (
+			buf       bytes.Buffer
+			consumers Array
+		)
+		fmt.Fprintf(&buf, "%d %s %s", summary.Count, summary.Min, summary.Max)
+		for name, n := range summary.Consumers {
+			fmt.Fprintf(&buf, "\n%s %d", name, n)
+			consumers = append(consumers, Array{Bulk(name), Bulk(strconv.Itoa(n))})
+		}
+		r := Array{Int(summary.Count), Bulk(summary.Min.String()), Bulk(summary.Max.String()), consumers}
+		return withText(r, buf.Bytes()), nil
+	}
+
+	args = args[2:]
+	var minIdle time.Duration
+	if strings.EqualFold(args[0], "IDLE") {
+		if len(args) < 2 {
+			return nil, ErrSyntax
+		}
+		ms, err := strconv.Atoi(args[1])
+		if err != nil || ms < 0 {
+			return nil, errors.New("invalid IDLE")
+		}
+		minIdle = time.Duration(ms) * time.Millisecond
+		args = args[2:]
+	}
+	if len(args) != 3 && len(args) != 4 {
+		return nil, ErrSyntax
+	}
+
+	start, err := parseRangeID(args[0], 0)
+	if err != nil {
+		return nil, err
+	}
+	end, err := parseRangeID(args[1], cache.MaxStreamID.Seq)
+	if err != nil {
+		return nil, err
+	}
+	count, err := strconv.Atoi(args[2])
+	if err != nil || count < 0 {
+		return nil, errors.New("invalid COUNT")
+	}
+	consumer := ""
+	if len(args) == 4 {
+		consumer = args[3]
+	}
+
+	pending, err := s.cache.XPendingRange(key, group, start, end, count, consumer, minIdle)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logCommand("XPENDING %s %s %s %s %d %d entries\n", key, group, start, end, count, len(pending))
+	if len(pending) == 0 || count == 0 {
+		return Array{}, nil
+	}
+
+	r := make(Array, len(pending))
+	for i, pe := range pending {
+		r[i] = Array{Bulk(pe.ID.String()), Bulk(pe.Consumer), Int(pe.Idle.Milliseconds()), Int(pe.Deliveries)}
+	}
+	return r, nil
+}
+
+// handleXClaim implements XCLAIM key group consumer min-idle-time id [id ...] [JUSTID]
+func (s *Server) handleXClaim(args []string) (Reply, error) {
+	minIdle, err := parseMinIdle(args[3])
+	if err != nil {
+		return nil, err
+	}
+
+	rawIDs := args[4:]
+	justID := strings.EqualFold(rawIDs[len(rawIDs)-1], "JUSTID")
+	if justID {
+		rawIDs = rawIDs[:len(rawIDs)-1]
+	}
+	ids, err := parseStreamIDs(rawIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := s.cache.XClaim(args[0], args[1], args[2], minIdle, ids, justID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logCommand("XCLAIM %s %s %s %v %d claimed\n", args[0], args[1], args[2], ids, len(entries))
+	if len(entries) == 0 {
+		return Array{}, nil
+	}
+	if justID {
+		return idsReply(entries), nil
+	}
+	return entriesReply(entries), nil
+}
+
+// handleXAutoClaim implements
+// XAUTOCLAIM key group consumer min-idle-time start [COUNT count] [JUSTID]
+// The first line of the reply is the cursor to resume from, followed by the
+// claimed entries and, if any, a line listing the IDs that no longer exist
+func (s *Server) handleXAutoClaim(args []string) (Reply, error) {
+	minIdle, err := parseMinIdle(args[3])
+	if err != nil {
+		return nil, err
+	}
+	start, err := parseRangeID(args[4], 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		count  = 100
+		justID bool
+	)
+	for i := 5; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "COUNT":
+			if i+1 >= len(args) {
+				return nil, ErrSyntax
+			}
+			if count, err = strconv.Atoi(args[i+1]); err != nil || count < 1 {
+				return nil, errors.New("COUNT must be > 0")
+			}
+			i++
+		case "JUSTID":
+			justID = true
+		default:
+			return nil, ErrSyntax
+		}
+	}
+
+	next, entries, deleted, err := s.cache.XAutoClaim(args[0], args[1], args[2], minIdle, start, count, justID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logCommand("XAUTOCLAIM %s %s %s %s %d claimed\n", args[0], args[1], args[2], start, len(entries))
+
+	claimed := entriesReply(entries)
+	if justID {
+		claimed = idsReply(entries)
+	}
+	deletedIDs := make(Array, len(deleted))
+	for i, id := range deleted {
+		deletedIDs[i] = Bulk(id.String())
+	}
+
+	text := []byte(next.String())
+	if len(entries) > 0 {
+		text = append(text, '\n')
+		text = claimed.appendText(text, false)
+	}
+	if len(deleted) > 0 {
+		text = append(text, "\ndeleted "...)
+		text = deletedIDs.appendText(text, true)
+	}
+	return withText(Array{Bulk(next.String()), claimed, deletedIDs}, text), nil
+}
+
+func parseMinIdle(s string) (time.Duration, error) {
+	ms, err := strconv.Atoi(s)
+	if err != nil || ms < 0 {
+		return 0, errors.New("invalid min-idle-time argument")
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+func parseStreamIDs(specs []string) ([]cache.StreamID, error) {
+	ids := make([]cache.StreamID, len(specs))
+	for i, spec := range specs {
+		id, err := cache.ParseStreamID(spec, 0)
+		if err != nil {
+			return nil, err
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+// idsReply returns the IDs of the entries, written one per line in the text protocol
+func idsReply(entries []cache.StreamEntry) Array {
+	arr := make(Array, len(entries))
+	for i, entry := range entries {
+		arr[i] = Bulk(entry.ID.String())
+	}
+	return arr
+}
+
+func boolToInt(b bool) Int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+
+	syscall "golang.org/x/sys/unix"
+)
+
+// listenFDsStart is the first file descriptor passed by systemd socket
+// activation
+const listenFDsStart = 3
+
+// activatedListener returns the listening socket passed by systemd socket
+// activation, or -1 if the process was not passed one
+func activatedListener() (int, error) {
+	if pid, err := strconv.Atoi(os.Getenv("LISTEN_PID")); err != nil || pid != os.Getpid() {
+		return -1, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 1 {
+		return -1, nil
+	}
+	// the processes started by the server must not take the socket as
+	// theirs
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	if n > 1 {
+		return -1, fmt.Errorf("systemd passed %d sockets, only one is supported", n)
+	}
+
+	fd := listenFDsStart
+	listening, err := syscall.GetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_ACCEPTCONN)
+	if err != nil {
+		return -1, err
+	}
+	if listening == 0 {
+		return -1, fmt.Errorf("the socket passed by systemd is not listening")
+	}
+	syscall.CloseOnExec(fd)
+	if err := syscall.SetNonblock(fd, true); err != nil {
+		return -1, err
+	}
+	return fd, nil
+}
+
+// sdNotify sends state to systemd over NOTIFY_SOCKET, doing nothing when
+// the service manager did not set it
+func sdNotify(state string) error {
+	addr := os.Getenv("NOTIFY_SOCKET")
+	if addr == "" {
+		return nil
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
@@ -0,0 +1,34 @@
+package server
+
+import "fmt"
+
+// countTenantCommand counts a command against the tenant of its first
+// key, the commands without keys or whose first key belongs to no tenant
+// not being counted
+func (s *Server) countTenantCommand(cmd *Command, parts []string) {
+	keys := cmd.keys(parts)
+	if len(keys) == 0 {
+		return
+	}
+	tenant, ok := s.cache.Tenant(keys[0])
+	if !ok {
+		return
+	}
+	if s.tenantCommands == nil {
+		s.tenantCommands = make(map[string]int64)
+	}
+	s.tenantCommands[tenant]++
+}
+
+// tenantsInfo returns the fields of INFO tenants, one per key prefix of
+// -tenant-prefixes numbered as db0, the prefix being a value as it may
+// hold a colon
+func (s *Server) tenantsInfo() []infoField {
+	var fields []infoField
+	for i, t := range s.cache.TenantStats() {
+		fields = append(fields, infoField{fmt.Sprintf("tenant%d", i), fmt.Sprintf(
+			"prefix=%s,keys=%d,bytes=%d,commands=%d,hits=%d,misses=%d,hit_ratio=%.4f",
+			t.Prefix, t.Entries, t.Bytes, s.tenantCommands[t.Prefix], t.Hits, t.Misses, t.HitRatio())})
+	}
+	return fields
+}
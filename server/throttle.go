@@ -0,0 +1,53 @@
+package server
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/KavetiRohith/go-cache/cache"
+)
+
+// handleThrottle implements CL.THROTTLE key max_burst count_per_period
+// period [quantity], replying like redis-cell with whether the actions were
+// limited, the limit, the remaining actions and the seconds to wait before
+// retrying, -1 if allowed, and before the limit is fully available again
+func (s *Server) handleThrottle(args []string) (Reply, error) {
+	if len(args) > 5 {
+		return nil, ErrSyntax
+	}
+	nums := make([]int64, 4)
+	nums[3] = 1
+	for i, arg := range args[1:] {
+		n, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			return nil, errors.New("value is not an integer or out of range")
+		}
+		nums[i] = n
+	}
+	if nums[0] < 0 || nums[1] <= 0 || nums[2] <= 0 || nums[3] < 0 {
+		return nil, errors.New("invalid rate limit")
+	}
+
+	limit := cache.ThrottleLimit{MaxBurst: nums[0], Count: nums[1], Period: time.Duration(nums[2]) * time.Second}
+	res, err := s.cache.Throttle(args[0], limit, nums[3], s.cache.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	limited := 0
+	if res.Limited {
+		limited = 1
+	}
+	retryAfter := int64(-1)
+	if res.RetryAfter >= 0 {
+		retryAfter = ceilSeconds(res.RetryAfter)
+	}
+	s.logCommand("CL.THROTTLE %s %v %v\n", args[0], args[1:], res.Limited)
+	return Array{Int(limited), Int(res.Limit), Int(res.Remaining), Int(retryAfter), Int(ceilSeconds(res.ResetAfter))}, nil
+}
+
+// ceilSeconds rounds d up to whole seconds
+func ceilSeconds(d time.Duration) int64 {
+	return int64((d + time.Second - 1) / time.Second)
+}
@@ -0,0 +1,218 @@
+package server
+
+import "time"
+
+// The timer wheel has wheelLevels levels of wheelSlots slots. A slot of
+// level 0 holds the timers due at one tick, and a slot of level l holds
+// the timers due within wheelSlots^l ticks, which are cascaded to the
+// lower levels when the wheel reaches them
+const (
+	timerTick   = time.Millisecond
+	wheelBits   = 6
+	wheelSlots  = 1 << wheelBits
+	wheelMask   = wheelSlots - 1
+	wheelLevels = 5
+	// maxTimerDelta is the farthest a timer is placed in the wheel, farther
+	// timers being placed at that distance and cascaded down again
+	maxTimerDelta = 1<<(wheelBits*wheelLevels) - 1
+)
+
+// Timer is a function scheduled on the event loop with Server.AfterFunc
+type Timer struct {
+	wheel *timerWheel
+	// when is the tick at which the timer fires
+	when int64
+	fn   func()
+	// level and slot locate the timer in the wheel, slot being -1 once
+	// the timer is not in the wheel anymore
+	level, slot int
+	prev, next  *Timer
+}
+
+// Stop cancels the timer, reporting whether it had not fired yet
+// It must be called on the goroutine of the event loop
+func (t *Timer) Stop() bool {
+	if t.fn == nil {
+		return false
+	}
+	if t.slot >= 0 {
+		t.wheel.unlink(t)
+	}
+	t.fn = nil
+	return true
+}
+
+// timerWheel is a hierarchical timing wheel, scheduling and cancelling
+// timers in constant time whatever their number
+type timerWheel struct {
+	// start is the time of tick 0
+	start time.Time
+	// now is the next tick to process, every earlier tick having fired
+	now   int64
+	slots [wheelLevels][wheelSlots]*Timer
+	count int
+}
+
+func newTimerWheel(start time.Time) *timerWheel {
+	return &timerWheel{start: start}
+}
+
+// tick returns the tick of t, rounded up so that timers never fire early
+func (w *timerWheel) tick(t time.Time) int64 {
+	d := t.Sub(w.start)
+	return int64((d + timerTick - 1) / timerTick)
+}
+
+// schedule returns a timer running fn once at is reached
+func (w *timerWheel) schedule(at time.Time, fn func()) *Timer {
+	t := &Timer{wheel: w, when: w.tick(at), fn: fn}
+	if t.when < w.now {
+		t.when = w.now
+	}
+	w.insert(t)
+	return t
+}
+
+// insert places the timer in the lowest level covering its distance
+func (w *timerWheel) insert(t *Timer) {
+	when := t.when
+	delta := when - w.now
+	if delta > maxTimerDelta {
+		delta = maxTimerDelta
+		when = w.now + delta
+	}
+
+	level := 0
+	for delta >= 1<<(wheelBits*(level+1)) {
+		level++
+	}
+	t.level = level
+	t.slot = int(when>>(wheelBits*level)) & wheelMask
+
+	head := &w.slots[t.level][t.slot]
+	t.prev, t.next = nil, *head
+	if *head != nil {
+		(*head).prev = t
+	}
+	*head = t
+	w.count++
+}
+
+func (w *timerWheel) unlink(t *Timer) {
+	if t.prev != nil {
+		t.prev.next = t.next
+	} else {
+		w.slots[t.level][t.slot] = t.next
+	}
+	if t.next != nil {
+		t.next.prev = t.prev
+	}
+	t.prev, t.next, t.slot = nil, nil, -1
+	w.count--
+}
+
+// take removes the timers of a slot from the wheel and returns them
+func (w *timerWheel) take(level, slot int) []*Timer {
+	var timers []*Timer
+	for t := w.slots[level][slot]; t != nil; {
+		next := t.next
+		w.unlink(t)
+		timers = append(timers, t)
+		t = next
+	}
+	return timers
+}
+
+// advance fires the timers due up to now, in tick order
+func (w *timerWheel) advance(now time.Time) {
+	// a tick fires once it has fully elapsed
+	last := int64(now.Sub(w.start) / timerTick)
+	for w.now <= last {
+		if w.count == 0 {
+			w.now = last + 1
+			return
+		}
+
+		tick := w.now
+		// cascade the slots of the higher levels starting at this tick
+		level := 0
+		for level+1 < wheelLevels && tick&((1<<(wheelBits*(level+1)))-1) == 0 {
+			level++
+		}
+		for ; level > 0; level-- {
+			slot := int(tick>>(wheelBits*level)) & wheelMask
+			for _, t := range w.take(level, slot) {
+				w.insert(t)
+			}
+		}
+
+		// timers scheduled by the functions fired below are placed
+		// from the next tick on
+		w.now = tick + 1
+		for _, t := range w.take(0, int(tick)&wheelMask) {
+			if fn := t.fn; fn != nil {
+				t.fn = nil
+				fn()
+			}
+		}
+	}
+}
+
+// timeout returns how long the loop may poll before the next timer fires,
+// or -1 if no timer is scheduled
+func (w *timerWheel) timeout(now time.Time) time.Duration {
+	next, ok := w.next()
+	if !ok {
+		return -1
+	}
+	if d := w.start.Add(time.Duration(next) * timerTick).Sub(now); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// next returns the tick of the earliest timer. As the slots of a level are
+// ordered by time from the current one, the earliest timer is in the first
+// non empty slot of one of the levels
+func (w *timerWheel) next() (int64, bool) {
+	if w.count == 0 {
+		return 0, false
+	}
+
+	var (
+		next  int64
+		found bool
+	)
+	for level := 0; level < wheelLevels; level++ {
+		cursor := int(w.now>>(wheelBits*level)) & wheelMask
+		// past the tick cascading it, the current slot of a higher level
+		// holds the timers a full turn ahead
+		first := 0
+		if level > 0 && w.now&((1<<(wheelBits*level))-1) != 0 {
+			first = 1
+		}
+		for d := first; d < first+wheelSlots; d++ {
+			slot := (cursor + d) & wheelMask
+			if w.slots[level][slot] == nil {
+				continue
+			}
+			for t := w.slots[level][slot]; t != nil; t = t.next {
+				if !found || t.when < next {
+					next, found = t.when, true
+				}
+			}
+			break
+		}
+	}
+	if next < w.now {
+		next = w.now
+	}
+	return next, found
+}
+
+// AfterFunc runs fn on the event loop once d has elapsed, returning a
+// timer that can cancel it. It must be called on the goroutine of the
+// event loop, such as in a command handler or a function given to Post
+func (s *Server) AfterFunc(d time.Duration, fn func()) *Timer {
+	return s.timers.schedule(time.Now().Add(d), fn)
+}
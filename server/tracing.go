@@ -0,0 +1,161 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// tracerName identifies the spans of the server to the tracer provider
+const tracerName = "github.com/KavetiRohith/go-cache/server"
+
+// tracePropagator reads the W3C traceparent and tracestate of the HTTP
+// headers, the gRPC metadata and CLIENT TRACEPARENT
+var tracePropagator = propagation.TraceContext{}
+
+var errInvalidTraceParent = errors.New("invalid traceparent")
+
+// commandTrace holds a command traced by dispatch
+type commandTrace struct {
+	ctx  context.Context
+	span trace.Span
+}
+
+// traceCommand starts the span of cmd for client, with a child span for
+// the parsing of the command when it was read from a connection, and
+// returns the function ending it with the result of the command. The
+// parent is the traceparent given by CLIENT TRACEPARENT before the
+// command, or by the HTTP or gRPC request that dispatched it
+func (s *Server) traceCommand(client Client, cmd *Command) func(error) {
+	parent := s.traceParent
+	if parent == nil {
+		parent = context.Background()
+	}
+	attrs := []attribute.KeyValue{semconv.DBSystemRedis, semconv.DBOperation(cmd.Name)}
+	var parsedAt, parseStart time.Time
+	if c, ok := s.clients[client.conn.Fd]; ok {
+		if c.traceParent != nil {
+			parent, c.traceParent = c.traceParent, nil
+		}
+		parseStart, parsedAt = c.parseStart, c.parsedAt
+		attrs = append(attrs, semconv.NetSockPeerAddr(c.addr))
+		if c.cmdRequestID != "" {
+			attrs = append(attrs, attribute.String("redigo.request_id", c.cmdRequestID))
+		}
+		if c.libName != "" {
+			attrs = append(attrs, attribute.String("redigo.client.lib", c.libName+"/"+c.libVer))
+		}
+	}
+
+	opts := []trace.SpanStartOption{trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(attrs...)}
+	if !parseStart.IsZero() {
+		opts = append(opts, trace.WithTimestamp(parseStart))
+	}
+	ctx, span := s.tracer.Start(parent, cmd.Name, opts...)
+	if !parseStart.IsZero() {
+		_, parse := s.tracer.Start(ctx, "parse", trace.WithTimestamp(parseStart))
+		parse.End(trace.WithTimestamp(parsedAt))
+	}
+	ctx, execute := s.tracer.Start(ctx, "execute")
+
+	outer := s.commandTrace
+	s.commandTrace = &commandTrace{ctx: ctx, span: execute}
+	return func(err error) {
+		s.commandTrace = outer
+		switch {
+		case err == errClientBlocked:
+			// the reply is sent once the client is unblocked
+			span.SetAttributes(attribute.Bool("redigo.blocked", true))
+		case err != nil:
+			span.SetStatus(codes.Error, err.Error())
+		}
+		execute.End()
+		span.End()
+	}
+}
+
+// traceChild starts a span of the work of the command being dispatched
+// that outlives it, such as the writes to the backing store. It returns
+// nil when no command is traced
+func (s *Server) traceChild(name string) trace.Span {
+	if s.commandTrace == nil {
+		return nil
+	}
+	_, span := s.tracer.Start(s.commandTrace.ctx, name, trace.WithSpanKind(trace.SpanKindClient))
+	return span
+}
+
+// endSpan ends a span returned by traceChild, recording err
+func endSpan(span trace.Span, err error) {
+	if span == nil {
+		return
+	}
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// handleClientTraceParent implements CLIENT TRACEPARENT traceparent
+// [tracestate], making the next command of the client a child of the
+// given span
+func (s *Server) handleClientTraceParent(c *clientConn, args []string) (Reply, error) {
+	carrier := propagation.MapCarrier{"traceparent": args[0]}
+	if len(args) == 2 {
+		carrier["tracestate"] = args[1]
+	}
+	ctx := tracePropagator.Extract(context.Background(), carrier)
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return nil, errInvalidTraceParent
+	}
+	if s.tracer != nil {
+		c.traceParent = ctx
+	}
+	return OK, nil
+}
+
+// httpTraceContext returns the context of r holding the span its headers
+// propagate
+func httpTraceContext(r *http.Request) context.Context {
+	return tracePropagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+}
+
+// grpcTraceInterceptor adds to the context of the calls the span their
+// metadata propagates
+func grpcTraceInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		ctx = tracePropagator.Extract(ctx, metadataCarrier(md))
+	}
+	return handler(ctx, req)
+}
+
+// metadataCarrier reads and writes the propagated fields in gRPC metadata
+type metadataCarrier metadata.MD
+
+func (mc metadataCarrier) Get(key string) string {
+	if v := metadata.MD(mc).Get(key); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+func (mc metadataCarrier) Set(key, value string) {
+	metadata.MD(mc).Set(key, value)
+}
+
+func (mc metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(mc))
+	for k := range mc {
+		keys = append(keys, k)
+	}
+	return keys
+}
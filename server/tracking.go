@@ -0,0 +1,215 @@
+package server
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// invalidationChannel is the channel on which the clients redirected to by
+// RESP2 clients receive the invalidation messages
+const invalidationChannel = "__redis__:invalidate"
+
+// tracking is the client side caching state of a client that turned
+// CLIENT TRACKING on
+type tracking struct {
+	// redirect is the id of the client receiving the invalidations, zero
+	// for the client itself
+	redirect int
+	// bcast tracks every key starting with one of prefixes, or every key
+	// if there is none, rather than the keys the client read
+	bcast    bool
+	prefixes []string
+	// noloop skips the invalidations of the keys the client wrote itself
+	noloop bool
+}
+
+// handleHello implements HELLO [protover], switching the connection to
+// RESP3 so that it can receive invalidation messages as pushes
+func (s *Server) handleHello(client Client, args []string) (Reply, error) {
+	c, ok := s.clients[client.conn.Fd]
+	proto := 2
+	if ok && c.resp3 {
+		proto = 3
+	}
+	if len(args) > 0 {
+		v, err := strconv.Atoi(args[0])
+		if err != nil {
+			return nil, errors.New("Protocol version is not an integer or out of range")
+		}
+		if v != 2 && v != 3 || len(args) > 1 {
+			return nil, errNoProto
+		}
+		if v == 3 && !ok {
+			return nil, errors.New("RESP3 is not supported on this connection")
+		}
+		proto = v
+		if ok {
+			c.resp3 = v == 3
+		}
+	}
+
+	fields := []Reply{
+		Bulk("server"), Bulk("redigo"),
+		Bulk("proto"), Int(proto),
+		Bulk("id"), Int(client.ID()),
+		Bulk("mode"), Bulk("standalone"),
+		Bulk("role"), Bulk("master"),
+		Bulk("modules"), Array{},
+	}
+	if proto == 3 {
+		return mapReply(fields), nil
+	}
+	return Array(fields), nil
+}
+
+// clientTracking implements CLIENT TRACKING ON|OFF [REDIRECT client-id]
+// [PREFIX prefix [PREFIX prefix ...]] [BCAST] [NOLOOP]
+func (s *Server) clientTracking(client Client, args []string) (Reply, error) {
+	c, ok := s.clients[client.conn.Fd]
+	if !ok {
+		return nil, errors.New("CLIENT TRACKING is not supported on this connection")
+	}
+
+	switch strings.ToUpper(args[0]) {
+	case "OFF":
+		if len(args) > 1 {
+			return nil, ErrSyntax
+		}
+		c.tracking = nil
+		delete(s.trackers, c.Fd)
+		return OK, nil
+	case "ON":
+	default:
+		return nil, ErrSyntax
+	}
+
+	t := &tracking{}
+	for i := 1; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "REDIRECT":
+			if i+1 == len(args) {
+				return nil, ErrSyntax
+			}
+			i++
+			id, err := strconv.Atoi(args[i])
+			if _, exists := s.clients[id]; err != nil || !exists {
+				return nil, errors.New("The client ID you want redirect to does not exist")
+			}
+			if id != c.Fd {
+				t.redirect = id
+			}
+		case "PREFIX":
+			if i+1 == len(args) {
+				return nil, ErrSyntax
+			}
+			i++
+			t.prefixes = append(t.prefixes, args[i])
+		case "BCAST":
+			t.bcast = true
+		case "NOLOOP":
+			t.noloop = true
+		default:
+			return nil, ErrSyntax
+		}
+	}
+	if len(t.prefixes) > 0 && !t.bcast {
+		return nil, errors.New("PREFIX option requires BCAST mode to be enabled")
+	}
+	if !c.resp3 && t.redirect == 0 {
+		return nil, errors.New("CLIENT TRACKING requires RESP3, switched to with HELLO 3, or a REDIRECT")
+	}
+
+	c.tracking = t
+	s.trackers[c.Fd] = c
+	return OK, nil
+}
+
+// trackRead remembers the keys read by a tracking client, args starting
+// with the command name, so that it is sent an invalidation message when
+// they change
+func (s *Server) trackRead(client Client, cmd *Command, args []string) {
+	c, ok := s.trackers[client.conn.Fd]
+	if !ok || c.tracking.bcast {
+		return
+	}
+	for _, key := range cmd.keys(args) {
+		fds, ok := s.tracked[key]
+		if !ok {
+			fds = make(map[int]struct{})
+			s.tracked[key] = fds
+		}
+		fds[c.Fd] = struct{}{}
+	}
+}
+
+// invalidate sends an invalidation message for key to the clients that
+// read it since it last changed and to the broadcasting clients of its
+// prefix. writer is the fd of the client that changed it, -1 if none did
+func (s *Server) invalidate(key string, writer int) {
+	if len(s.trackers) == 0 {
+		return
+	}
+
+	msg := bulks([]string{key})
+	for fd := range s.tracked[key] {
+		// the clients that turned tracking off since are not tracking
+		// the key anymore
+		if c, ok := s.trackers[fd]; ok && !c.tracking.bcast && !(c.tracking.noloop && fd == writer) {
+			s.sendInvalidation(c, msg)
+		}
+	}
+	delete(s.tracked, key)
+
+	for fd, c := range s.trackers {
+		if c.tracking.bcast && !(c.tracking.noloop && fd == writer) && hasAnyPrefix(key, c.tracking.prefixes) {
+			s.sendInvalidation(c, msg)
+		}
+	}
+}
+
+// invalidateAll sends the tracking clients an invalidation message with
+// no keys, which invalidates every key, after the keyspace was flushed
+func (s *Server) invalidateAll() {
+	for _, c := range s.trackers {
+		s.sendInvalidation(c, Nil)
+	}
+	s.tracked = make(map[string]map[int]struct{})
+}
+
+// sendInvalidation sends an invalidation message for keys to a tracking
+// client, as a push in RESP3 or as a message of invalidationChannel to the
+// client it redirects to
+func (s *Server) sendInvalidation(c *clientConn, keys Reply) {
+	target := c
+	if id := c.tracking.redirect; id != 0 {
+		var ok bool
+		if target, ok = s.clients[id]; !ok {
+			if c.resp3 {
+				s.reply(c.fDconn, pushReply{Bulk("tracking-redir-broken"), Int(id)}, nil)
+			}
+			return
+		}
+	}
+
+	switch {
+	case target.resp3:
+		s.reply(target.fDconn, pushReply{Bulk("invalidate"), keys}, nil)
+	case target.pubsub != nil:
+		if _, ok := target.pubsub.channels[invalidationChannel]; ok {
+			s.reply(target.fDconn, Array{Bulk("message"), Bulk(invalidationChannel), keys}, nil)
+		}
+	}
+}
+
+func hasAnyPrefix(key string, prefixes []string) bool {
+	if len(prefixes) == 0 {
+		return true
+	}
+	for _, p := range prefixes {
+		if strings.HasPrefix(key, p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KavetiRohith/go-cache/cache"
+)
+
+// handleTTLHist implements TTLHIST [SAMPLES count], replying with a
+// [bucket, keys, bytes, reclaimed] entry per bucket of remaining time to
+// live: the keys without an expire, those expiring within each bound of
+// cache.TTLHistogramBounds, and those expiring later. reclaimed is the
+// number of bytes freed once the keys of the bucket and of the buckets
+// before it expired, forecasting the memory reclaimed over time
+func (s *Server) handleTTLHist(args []string) (Reply, error) {
+	samples := 0
+	switch {
+	case len(args) == 0:
+	case len(args) == 2 && strings.EqualFold(args[0], "SAMPLES"):
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n <= 0 {
+			return nil, errors.New("SAMPLES must be > 0")
+		}
+		samples = n
+	default:
+		return nil, ErrSyntax
+	}
+
+	h := s.cache.TTLHistogram(samples)
+	r := make(Array, 0, len(h.Buckets)+1)
+	var text []byte
+	add := func(name string, b cache.TTLBucket, reclaimed int64) {
+		r = append(r, Array{Bulk(name), Int(b.Keys), Int(b.Bytes), Int(reclaimed)})
+		if len(text) > 0 {
+			text = append(text, '\n')
+		}
+		text = append(text, fmt.Sprintf("%s: keys=%d bytes=%d reclaimed=%d", name, b.Keys, b.Bytes, reclaimed)...)
+	}
+
+	add("persistent", h.Persistent, 0)
+	var reclaimed int64
+	for i, b := range h.Buckets {
+		reclaimed += b.Bytes
+		name := "+inf"
+		if i < len(cache.TTLHistogramBounds) {
+			name = "<" + formatBound(cache.TTLHistogramBounds[i])
+		}
+		add(name, b, reclaimed)
+	}
+
+	s.logCommand("TTLHIST sampled %d keys\n", h.Sampled)
+	return withText(r, text), nil
+}
+
+// formatBound formats a bound of a TTL bucket in its largest whole unit,
+// as 10m or 7d
+func formatBound(d time.Duration) string {
+	switch {
+	case d%(24*time.Hour) == 0:
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	}
+	return fmt.Sprintf("%ds", d/time.Second)
+}
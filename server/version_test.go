@@ -0,0 +1,80 @@
+package server_test
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KavetiRohith/go-cache/server"
+	"github.com/KavetiRohith/go-cache/server/servertest"
+)
+
+// freeAddr returns a free address of the loopback interface
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+// newRaftServer starts the single node of a Raft cluster and waits for it
+// to lead
+func newRaftServer(t *testing.T) *servertest.Server {
+	t.Helper()
+	s := servertest.NewServer(t, server.ServerOpts{
+		RaftAddr:      freeAddr(t),
+		RaftID:        "node",
+		RaftDir:       t.TempDir(),
+		RaftBootstrap: true,
+	}, nil)
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		_, err := s.Do("SET", "leader", "")
+		if err == nil {
+			return s
+		}
+		if !strings.HasPrefix(err.Error(), "NOTLEADER") || time.Now().After(deadline) {
+			t.Fatalf("waiting for the node to lead: %v", err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestSetIfVersion(t *testing.T) {
+	for name, start := range map[string]func(*testing.T) *servertest.Server{
+		"standalone": func(t *testing.T) *servertest.Server {
+			return servertest.NewServer(t, server.ServerOpts{}, nil)
+		},
+		"raft": newRaftServer,
+	} {
+		t.Run(name, func(t *testing.T) {
+			s := start(t)
+
+			s.Expect("OK", "SET", "k", "v")
+			reply, err := s.Do("GET", "k", "WITHVERSION")
+			if err != nil {
+				t.Fatal(err)
+			}
+			version := strconv.FormatInt(reply.([]any)[1].(int64), 10)
+
+			s.ExpectError("CONFLICT", "SET", "k", "stale", "IFVERSION", "1")
+			s.Expect("v", "GET", "k")
+			s.Expect("OK", "SET", "k", "v2", "IFVERSION", version)
+			s.Expect("v2", "GET", "k")
+			// the SET gave the key a new version
+			s.ExpectError("CONFLICT", "SET", "k", "v3", "IFVERSION", version)
+			s.Expect("v2", "GET", "k")
+
+			// 0 stands for a key that does not exist
+			s.Expect("OK", "SET", "new", "v", "IFVERSION", "0")
+			s.ExpectError("CONFLICT", "SET", "new", "v", "IFVERSION", "0")
+			s.ExpectError("ERR version is not an integer", "SET", "k", "v", "IFVERSION", "x")
+		})
+	}
+}
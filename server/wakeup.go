@@ -0,0 +1,150 @@
+package server
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"github.com/KavetiRohith/go-cache/server/iomultiplexer"
+)
+
+// loopQueue holds the functions posted to the event loop by other goroutines
+type loopQueue struct {
+	mu    sync.Mutex
+	funcs []func()
+	// waker is nil until Start subscribes it, functions posted before
+	// being run once the loop starts
+	waker *waker
+}
+
+// Post queues fn to run on the goroutine of the event loop, waking the loop
+// up if it is polling. It is safe to call from any goroutine, letting
+// background work hand its results to the loop, which owns the cache and
+// the clients, instead of the loop polling for them
+func (s *Server) Post(fn func()) {
+	q := &s.posted
+	q.mu.Lock()
+	q.funcs = append(q.funcs, fn)
+	wake := len(q.funcs) == 1 && q.waker != nil
+	w := q.waker
+	q.mu.Unlock()
+
+	// a wakeup already pending covers the functions queued after it
+	if wake {
+		w.wake()
+	}
+}
+
+// runOnLoop posts fn and waits for it to run, returning the error of ctx
+// if it is done first. fn is skipped if ctx is done by the time the loop
+// gets to it, so that the work of callers that gave up while the loop was
+// busy is dropped rather than done late
+func (s *Server) runOnLoop(ctx context.Context, fn func()) error {
+	done := make(chan struct{})
+	ran := false
+	s.Post(func() {
+		if ctx.Err() == nil {
+			// the commands fn dispatches are traced as children of the
+			// span of ctx
+			s.traceParent = ctx
+			fn()
+			s.traceParent = nil
+			ran = true
+		}
+		close(done)
+	})
+
+	select {
+	case <-done:
+		if !ran {
+			return ctx.Err()
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// awaitOffLoop blocks the client while wait runs on another goroutine, for
+// the commands waiting on the network, and then replies it what serve
+// returns given the error of wait on the event loop
+func (s *Server) awaitOffLoop(conn fDconn, wait func() error, serve func(error) (Reply, error)) error {
+	err := s.block(conn, nil, 0, func() (Reply, error) { return nil, nil })
+	if err != errClientBlocked {
+		return err
+	}
+	bc := s.blocked[conn.Fd]
+
+	go func() {
+		waitErr := wait()
+		s.Post(func() {
+			if s.blocked[conn.Fd] != bc {
+				// the client disconnected meanwhile
+				return
+			}
+			bc.unblock(s)
+			r, err := serve(waitErr)
+			if err == errClientBlocked {
+				// the command blocked the client again
+				return
+			}
+			s.reply(conn, r, err)
+			s.resumeClients([]*blockedClient{bc})
+		})
+	}()
+	return err
+}
+
+// subscribeWaker creates the wakeup channel of the loop and
+// subscribes it to the multiplexer
+func (s *Server) subscribeWaker() error {
+	w, err := newWaker()
+	if err != nil {
+		return err
+	}
+	if err := s.multiplexer.Subscribe(iomultiplexer.Event{
+		Fd: w.fd(),
+		Op: iomultiplexer.OP_READ,
+	}); err != nil {
+		w.close()
+		return err
+	}
+
+	q := &s.posted
+	q.mu.Lock()
+	q.waker = w
+	pending := len(q.funcs) > 0
+	q.mu.Unlock()
+
+	if pending {
+		w.wake()
+	}
+	return nil
+}
+
+// runPosted runs the functions posted since the last wakeup
+func (s *Server) runPosted() {
+	q := &s.posted
+	q.mu.Lock()
+	q.waker.drain()
+	funcs := q.funcs
+	q.funcs = nil
+	q.mu.Unlock()
+
+	for _, fn := range funcs {
+		fn()
+	}
+}
+
+// closeWaker releases the wakeup channel once the loop exits
+func (s *Server) closeWaker() {
+	q := &s.posted
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.waker != nil {
+		if err := q.waker.close(); err != nil {
+			log.Println("err", err)
+		}
+		q.waker = nil
+	}
+}
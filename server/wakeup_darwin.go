@@ -0,0 +1,45 @@
+package server
+
+import "golang.org/x/sys/unix"
+
+// waker wakes the event loop up through a pipe, darwin having no eventfd
+type waker struct {
+	r, w int
+}
+
+func newWaker() (*waker, error) {
+	var p [2]int
+	if err := unix.Pipe(p[:]); err != nil {
+		return nil, err
+	}
+	for _, fd := range p {
+		unix.SetNonblock(fd, true)
+		unix.CloseOnExec(fd)
+	}
+	return &waker{r: p[0], w: p[1]}, nil
+}
+
+func (w *waker) fd() int {
+	return w.r
+}
+
+// wake writes a byte to the pipe, making it readable. A full pipe
+// fails with EAGAIN, which is fine as it is readable already
+func (w *waker) wake() {
+	unix.Write(w.w, []byte{0})
+}
+
+// drain empties the pipe
+func (w *waker) drain() {
+	var buf [64]byte
+	for {
+		if n, err := unix.Read(w.r, buf[:]); n <= 0 || err != nil {
+			return
+		}
+	}
+}
+
+func (w *waker) close() error {
+	unix.Close(w.w)
+	return unix.Close(w.r)
+}
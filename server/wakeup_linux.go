@@ -0,0 +1,37 @@
+package server
+
+import "golang.org/x/sys/unix"
+
+// waker wakes the event loop up through an eventfd
+type waker struct {
+	efd int
+}
+
+func newWaker() (*waker, error) {
+	efd, err := unix.Eventfd(0, unix.EFD_NONBLOCK|unix.EFD_CLOEXEC)
+	if err != nil {
+		return nil, err
+	}
+	return &waker{efd: efd}, nil
+}
+
+func (w *waker) fd() int {
+	return w.efd
+}
+
+// wake adds one to the eventfd counter, making it readable. A full
+// counter fails with EAGAIN, which is fine as it is readable already
+func (w *waker) wake() {
+	one := [8]byte{1}
+	unix.Write(w.efd, one[:])
+}
+
+// drain resets the eventfd counter
+func (w *waker) drain() {
+	var buf [8]byte
+	unix.Read(w.efd, buf[:])
+}
+
+func (w *waker) close() error {
+	return unix.Close(w.efd)
+}
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/KavetiRohith/go-cache/cache"
+)
+
+const (
+	// warmBatch is the number of keys asked for by every DUMPALL sent to
+	// the peer warming the cache
+	warmBatch = 1000
+	// warmTimeout bounds the connection to the peer and every DUMPALL
+	warmTimeout = 30 * time.Second
+)
+
+// errRaftWarm is returned by Start when WarmFrom is set in Raft mode,
+// whose keyspace comes from the Raft log
+var errRaftWarm = errors.New("warming the cache from a peer is not supported in Raft mode")
+
+// warm copies the keyspace of the server at WarmFrom with DUMPALL before
+// the server starts serving, the pages being fetched and decoded while
+// the previous ones are stored. It fails short of the whole keyspace if
+// the peer goes away, keeping the keys copied until then
+func (s *Server) warm() error {
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", s.WarmFrom, warmTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	batches := make(chan *cache.Batch, 1)
+	var fetchErr error
+	go func() {
+		defer close(batches)
+		fetchErr = fetchWarmPages(conn, batches)
+	}()
+
+	n := 0
+	for batch := range batches {
+		s.cache.Apply(batch)
+		n += batch.Len()
+	}
+	log.Printf("warmed %d keys from %s in %v\n", n, s.WarmFrom, time.Since(start).Round(time.Millisecond))
+	return fetchErr
+}
+
+// fetchWarmPages iterates over the keyspace of the peer on conn with
+// DUMPALL, sending a batch restoring the keys of every page
+func fetchWarmPages(conn net.Conn, batches chan<- *cache.Batch) error {
+	r := bufio.NewReader(conn)
+	cursor := "0"
+	for {
+		conn.SetDeadline(time.Now().Add(warmTimeout))
+		if _, err := conn.Write(appendCommand(nil, "DUMPALL", cursor, "COUNT", strconv.Itoa(warmBatch))); err != nil {
+			return err
+		}
+		reply, err := readWarmReply(r)
+		if err != nil {
+			return err
+		}
+		page, ok := reply.([]any)
+		if !ok || len(page) != 2 {
+			return errors.New("unexpected DUMPALL reply")
+		}
+		entries, _ := page[1].([]any)
+
+		batch := &cache.Batch{}
+		for _, entry := range entries {
+			fields, ok := entry.([]any)
+			if !ok || len(fields) != 5 {
+				return errors.New("unexpected DUMPALL entry")
+			}
+			key, _ := fields[0].(string)
+			expiresAt, _ := fields[2].(int64)
+			encoded, _ := fields[3].(string)
+			payload, err := base64.StdEncoding.DecodeString(encoded)
+			if err != nil {
+				return fmt.Errorf("restoring %q: %v", key, cache.ErrBadDump)
+			}
+			if err := batch.Restore(key, payload, expiresAt); err != nil {
+				return fmt.Errorf("restoring %q: %v", key, err)
+			}
+		}
+		batches <- batch
+
+		if cursor, _ = page[0].(string); cursor == "0" {
+			return nil
+		}
+	}
+}
+
+// readWarmReply reads a reply of the peer: a string for the simple
+// strings and bulk strings, an int64 for the integers, a []any for the
+// arrays and nil for the nil replies. An error reply is returned as an
+// error
+func readWarmReply(r *bufio.Reader) (any, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, errors.New("protocol error: bad line")
+	}
+	typ, line := line[0], line[1:len(line)-2]
+
+	switch typ {
+	case '+':
+		return line, nil
+	case '-':
+		return nil, errors.New(line)
+	case ':':
+		return strconv.ParseInt(line, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		b := make([]byte, n+2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		return string(b[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		arr := make([]any, n)
+		for i := range arr {
+			if arr[i], err = readWarmReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return arr, nil
+	default:
+		return nil, fmt.Errorf("protocol error: unexpected reply type %q", typ)
+	}
+}
@@ -0,0 +1,72 @@
+package server
+
+// watchBufferLen is the number of events a watcher may lag behind
+// before it is dropped
+const watchBufferLen = 256
+
+// watchEvent reports a key written by a command
+type watchEvent struct {
+	key     string
+	command string
+}
+
+// keyWatcher receives the writes of a set of keys, such as a gRPC Watch
+// stream. Its fields are owned by the event loop, events being closed
+// once the watcher is removed
+type keyWatcher struct {
+	keys   []string
+	events chan watchEvent
+	// lagged is set when the watcher was dropped for not keeping up
+	lagged bool
+}
+
+func newKeyWatcher(keys []string) *keyWatcher {
+	return &keyWatcher{keys: keys, events: make(chan watchEvent, watchBufferLen)}
+}
+
+// watch registers w for the writes of its keys
+func (s *Server) watch(w *keyWatcher) {
+	for _, key := range w.keys {
+		if s.watchers[key] == nil {
+			s.watchers[key] = make(map[*keyWatcher]struct{})
+		}
+		s.watchers[key][w] = struct{}{}
+	}
+}
+
+// unwatch removes w and closes its events, reporting false if it had
+// already been removed
+func (s *Server) unwatch(w *keyWatcher) bool {
+	removed := false
+	for _, key := range w.keys {
+		watchers := s.watchers[key]
+		if _, ok := watchers[w]; !ok {
+			continue
+		}
+		removed = true
+		delete(watchers, w)
+		if len(watchers) == 0 {
+			delete(s.watchers, key)
+		}
+	}
+	if removed {
+		close(w.events)
+	}
+	return removed
+}
+
+// notifyWrite sends an event to the watchers of the keys written by a
+// command that succeeded. Watchers whose buffer is full are dropped rather
+// than blocking the loop
+func (s *Server) notifyWrite(name string, keys []string) {
+	for _, key := range keys {
+		for w := range s.watchers[key] {
+			select {
+			case w.events <- watchEvent{key: key, command: name}:
+			default:
+				w.lagged = true
+				s.unwatch(w)
+			}
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/KavetiRohith/go-cache/cache"
+	"github.com/hashicorp/raft"
+)
+
+const (
+	// DefaultWebhookQueueLen is the default number of events a webhook may
+	// lag behind before the next ones are dropped
+	DefaultWebhookQueueLen = 1024
+	// webhookTimeout bounds every POST of a webhook
+	webhookTimeout = 5 * time.Second
+	// webhookRetries is the number of times a POST is retried, waiting
+	// from webhookMinBackoff, doubled on every attempt, up to
+	// webhookMaxBackoff
+	webhookRetries    = 5
+	webhookMinBackoff = 100 * time.Millisecond
+	webhookMaxBackoff = 10 * time.Second
+)
+
+// Webhook posts the events of the keys matching Pattern to URL, as a JSON
+// object {"event": event, "key": key, "time": unix-time-milliseconds}
+type Webhook struct {
+	URL string
+	// Pattern is a glob-style pattern of the keys, every key matching when
+	// empty
+	Pattern string
+	// Events are the events posted, the lower case names of the commands
+	// writing keys, such as set or del, and expired and evicted for the
+	// keys removed by the server. Every event is posted when empty
+	Events []string
+}
+
+// webhookEvent is the payload posted for an event
+type webhookEvent struct {
+	Event string `json:"event"`
+	Key   string `json:"key"`
+	Time  int64  `json:"time"`
+}
+
+// webhook is a Webhook along with the queue of the events its goroutine
+// posts
+type webhook struct {
+	Webhook
+	events chan webhookEvent
+}
+
+// matches tells whether the webhook posts event for key
+func (w *webhook) matches(event, key string) bool {
+	if len(w.Events) > 0 && !contains(w.Events, event) {
+		return false
+	}
+	return w.Pattern == "" || cache.MatchPattern(w.Pattern, key)
+}
+
+// startWebhooks starts a goroutine per webhook posting its events, and
+// returns the function stopping them, the events queued being dropped
+func (s *Server) startWebhooks() func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.webhooks = make([]*webhook, len(s.Webhooks))
+	for i, w := range s.Webhooks {
+		s.webhooks[i] = &webhook{Webhook: w, events: make(chan webhookEvent, s.WebhookQueueLen)}
+		go s.runWebhook(ctx, s.webhooks[i])
+	}
+	return func() {
+		cancel()
+		for _, w := range s.webhooks {
+			close(w.events)
+		}
+		s.webhooks = nil
+	}
+}
+
+// notifyWebhooks queues event for the keys to the webhooks matching them,
+// dropping it for the webhooks whose queue is full rather than blocking
+// the loop. In Raft mode, only the leader posts the events
+func (s *Server) notifyWebhooks(event string, keys []string) {
+	if s.raft != nil && s.raft.State() != raft.Leader {
+		return
+	}
+	now := s.cache.Now().UnixMilli()
+	for _, w := range s.webhooks {
+		for _, key := range keys {
+			if !w.matches(event, key) {
+				continue
+			}
+			select {
+			case w.events <- webhookEvent{event, key, now}:
+			default:
+				s.stats.webhookDropped++
+			}
+		}
+	}
+}
+
+// runWebhook posts the events of w until ctx is done, retrying the posts
+// that fail with a growing backoff and giving up on the event after
+// webhookRetries retries
+func (s *Server) runWebhook(ctx context.Context, w *webhook) {
+	client := &http.Client{Timeout: webhookTimeout}
+	for event := range w.events {
+		body, _ := json.Marshal(event)
+		backoff := webhookMinBackoff
+		for attempt := 0; ; attempt++ {
+			err := postWebhook(ctx, client, w.URL, body)
+			if err == nil {
+				s.webhookPosted.Add(1)
+				break
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			if attempt == webhookRetries {
+				s.webhookFailed.Add(1)
+				log.Printf("webhook %s: dropping the %s event of %q: %v\n", w.URL, event.Event, event.Key, err)
+				break
+			}
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return
+			}
+			if backoff *= 2; backoff > webhookMaxBackoff {
+				backoff = webhookMaxBackoff
+			}
+		}
+	}
+}
+
+// postWebhook posts body to url, failing unless it replies with a 2xx
+// status
+func postWebhook(ctx context.Context, client *http.Client, url string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("status %s", resp.Status)
+	}
+	return nil
+}
+
+// ParseWebhook parses a webhook given as url[#pattern[#event,...]], the
+// fragment of a URL never being sent to its server
+func ParseWebhook(spec string) (Webhook, error) {
+	parts := strings.SplitN(spec, "#", 3)
+	w := Webhook{URL: parts[0]}
+	if !strings.HasPrefix(w.URL, "http://") && !strings.HasPrefix(w.URL, "https://") {
+		return Webhook{}, fmt.Errorf("invalid webhook %q, the URL must be http or https", spec)
+	}
+	if len(parts) > 1 {
+		w.Pattern = parts[1]
+	}
+	if len(parts) > 2 && parts[2] != "" {
+		for _, event := range strings.Split(parts[2], ",") {
+			w.Events = append(w.Events, strings.ToLower(strings.TrimSpace(event)))
+		}
+	}
+	return w, nil
+}
@@ -0,0 +1,188 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+
+	"golang.org/x/net/websocket"
+)
+
+const (
+	// wsPath is the WebSocket endpoint of the HTTP gateway
+	wsPath = "/ws"
+	// wsBufferLen is the number of messages a WebSocket client may lag
+	// behind before it is disconnected
+	wsBufferLen = 256
+)
+
+// wsClient is a WebSocket connection of the HTTP gateway. Its fields are
+// owned by the event loop, out being closed once the client is closed
+type wsClient struct {
+	out    chan any
+	pubsub *pubsubClient
+	closed bool
+}
+
+// wsMessage is the JSON message of a published message
+type wsMessage struct {
+	Type    string `json:"type"`
+	Pattern string `json:"pattern,omitempty"`
+	Channel string `json:"channel"`
+	Data    string `json:"data"`
+}
+
+// webSocketHandler serves commands sent as JSON arrays of strings in text
+// messages, such as ["GET", "key"] or ["SUBSCRIBE", "channel"], answering
+// each in order with {"reply"} or {"error"}, and pushing the messages of the
+// channels subscribed to as {"type": "message", "channel", "data"}
+func (s *Server) webSocketHandler() http.Handler {
+	return websocket.Server{Handshake: checkWebSocketOrigin, Handler: s.serveWebSocket}
+}
+
+// checkWebSocketOrigin only accepts the browsers on a page served from the
+// host of the gateway, so that other sites cannot issue commands on behalf of
+// their visitors. Clients sending no Origin, which are not browsers, are
+// accepted
+func checkWebSocketOrigin(config *websocket.Config, r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return err
+	}
+	if u.Host != r.Host {
+		return errors.New("cross origin WebSocket request")
+	}
+	config.Origin = u
+	return nil
+}
+
+func (s *Server) serveWebSocket(ws *websocket.Conn) {
+	wc := &wsClient{out: make(chan any, wsBufferLen)}
+	wc.pubsub = newPubsubClient(func(r Reply) { s.pushWebSocket(wc, r) })
+	client := Client{conn: gatewayClient, pubsub: wc.pubsub}
+
+	go func() {
+		defer ws.Close()
+		for msg := range wc.out {
+			if err := websocket.JSON.Send(ws, msg); err != nil {
+				return
+			}
+		}
+	}()
+	defer s.Post(func() { s.closeWebSocket(wc) })
+
+	// the commands are traced as children of the span of the upgrade
+	ctx := ws.Request().Context()
+	if s.tracer != nil {
+		ctx = httpTraceContext(ws.Request())
+	}
+	for {
+		var data string
+		if err := websocket.Message.Receive(ws, &data); err != nil {
+			return
+		}
+
+		var args []string
+		if err := json.Unmarshal([]byte(data), &args); err != nil {
+			s.Post(func() { s.sendWebSocket(wc, wsError(err)) })
+			continue
+		}
+		// the reply is queued on the loop, after the messages published
+		// before the command and before those published after it
+		if err := s.runOnLoop(ctx, func() {
+			if wc.closed {
+				return
+			}
+			r, err := s.dispatch(client, args)
+			if err != nil {
+				s.sendWebSocket(wc, wsError(err))
+				return
+			}
+			if rs, ok := r.(replies); ok {
+				for _, r := range rs {
+					s.sendWebSocket(wc, wsReply(r))
+				}
+				return
+			}
+			s.sendWebSocket(wc, wsReply(r))
+		}); err != nil {
+			return
+		}
+	}
+}
+
+// pushWebSocket sends a published message, r being the array pushed to
+// RESP clients
+func (s *Server) pushWebSocket(wc *wsClient, r Reply) {
+	arr := r.(Array)
+	msg := wsMessage{Type: string(arr[0].(Bulk))}
+	if len(arr) == 4 {
+		msg.Pattern = string(arr[1].(Bulk))
+		arr = arr[1:]
+	}
+	msg.Channel, msg.Data = string(arr[1].(Bulk)), string(arr[2].(Bulk))
+	s.sendWebSocket(wc, msg)
+}
+
+// sendWebSocket queues a message to the client, closing it if it does not
+// keep up rather than blocking the loop
+func (s *Server) sendWebSocket(wc *wsClient, msg any) {
+	if wc.closed {
+		return
+	}
+	select {
+	case wc.out <- msg:
+	default:
+		log.Println("websocket: client lagged behind, closing it")
+		s.closeWebSocket(wc)
+	}
+}
+
+// closeWebSocket drops the subscriptions of the client and stops its writer
+func (s *Server) closeWebSocket(wc *wsClient) {
+	if wc.closed {
+		return
+	}
+	wc.closed = true
+	s.unsubscribeAll(wc.pubsub)
+	close(wc.out)
+}
+
+// wsReply is the message answering a command with r
+func wsReply(r Reply) any {
+	return map[string]any{"reply": replyJSON(r)}
+}
+
+func wsError(err error) any {
+	return map[string]string{"error": formatError(err)}
+}
+
+// replyJSON converts a reply to the value encoding it in JSON
+func replyJSON(r Reply) any {
+	switch r := r.(type) {
+	case statusReply:
+		return r.resp
+	case Bulk:
+		return string(r)
+	case Int:
+		return int64(r)
+	case Array:
+		arr := make([]any, len(r))
+		for i, elem := range r {
+			arr[i] = replyJSON(elem)
+		}
+		return arr
+	case replies:
+		return replyJSON(Array(r))
+	case textReply:
+		return replyJSON(r.Reply)
+	default:
+		return nil
+	}
+}
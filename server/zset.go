@@ -0,0 +1,378 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KavetiRohith/go-cache/cache"
+)
+
+// handleZAdd implements ZADD key [NX|XX] [CH] score member [score member ...]
+// serving the clients blocked in BZPOPMIN or BZPOPMAX on key
+func (s *Server) handleZAdd(args []string) (Reply, error) {
+	key := args[0]
+	opts, rest := parseZAddOpts(args[1:])
+	if len(rest) == 0 || len(rest)%2 != 0 {
+		return nil, ErrSyntax
+	}
+
+	members := make([]cache.ZMember, 0, len(rest)/2)
+	for i := 0; i < len(rest); i += 2 {
+		score, err := parseScore(rest[i])
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, cache.ZMember{Score: score, Member: rest[i+1]})
+	}
+
+	n, err := s.cache.ZAdd(key, opts, members...)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logCommand("ZADD %s %v %d\n", key, members, n)
+	s.serveBlockedClients(key)
+	return Int(n), nil
+}
+
+func (s *Server) handleZScore(args []string) (Reply, error) {
+	score, ok, err := s.cache.ZScore(args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	s.logCommand("ZSCORE %s %s %v\n", args[0], args[1], score)
+	if !ok {
+		return Nil, nil
+	}
+	return Bulk(formatScore(score)), nil
+}
+
+func (s *Server) handleZRem(args []string) (Reply, error) {
+	n, err := s.cache.ZRem(args[0], args[1:]...)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logCommand("ZREM %s %v %d\n", args[0], args[1:], n)
+	return Int(n), nil
+}
+
+func (s *Server) handleZCard(key string) (Reply, error) {
+	n, err := s.cache.ZCard(key)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logCommand("ZCARD %s %d\n", key, n)
+	return Int(n), nil
+}
+
+// handleZRange implements ZRANGE key start stop [WITHSCORES]
+func (s *Server) handleZRange(args []string) (Reply, error) {
+	if len(args) > 4 {
+		return nil, errWrongArgs("zrange")
+	}
+	if len(args) == 4 && !strings.EqualFold(args[3], "WITHSCORES") {
+		return nil, ErrSyntax
+	}
+
+	start, err1 := strconv.Atoi(args[1])
+	stop, err2 := strconv.Atoi(args[2])
+	if err1 != nil || err2 != nil {
+		return nil, errors.New("value is not an integer or out of range")
+	}
+
+	members, err := s.cache.ZRange(args[0], start, stop)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logCommand("ZRANGE %s %d %d %d members\n", args[0], start, stop, len(members))
+	if len(members) == 0 {
+		return Array{}, nil
+	}
+	return formatZMembers(members, len(args) == 4), nil
+}
+
+// parseZAddOpts consumes the leading NX/XX/CH flags of a ZADD style command
+func parseZAddOpts(args []string) (cache.ZAddOpts, []string) {
+	var opts cache.ZAddOpts
+	for len(args) > 0 {
+		switch strings.ToUpper(args[0]) {
+		case "NX":
+			opts.NX = true
+		case "XX":
+			opts.XX = true
+		case "CH":
+			opts.CH = true
+		default:
+			return opts, args
+		}
+		args = args[1:]
+	}
+	return opts, args
+}
+
+func parseScore(s string) (float64, error) {
+	score, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(score) {
+		return 0, errors.New("value is not a valid float")
+	}
+	return score, nil
+}
+
+func formatScore(score float64) string {
+	return strconv.FormatFloat(score, 'f', -1, 64)
+}
+
+// formatZMembers returns the members followed by their score if requested,
+// flattened in RESP and written one "member [score]" line per member in
+// the text protocol
+func formatZMembers(members []cache.ZMember, withScores bool) Reply {
+	if !withScores {
+		arr := make(Array, len(members))
+		for i, m := range members {
+			arr[i] = Bulk(m.Member)
+		}
+		return arr
+	}
+
+	var (
+		buf bytes.Buffer
+		arr = make(Array, 0, 2*len(members))
+	)
+	for i, m := range members {
+		if i > 0 {
+			buf.WriteByte('\n')
+		}
+		score := formatScore(m.Score)
+		fmt.Fprintf(&buf, "%s %s", m.Member, score)
+		arr = append(arr, Bulk(m.Member), Bulk(score))
+	}
+	return withText(arr, buf.Bytes())
+}
+
+// handleZIncrBy implements ZINCRBY key increment member
+func (s *Server) handleZIncrBy(args []string) (Reply, error) {
+	increment, err := parseScore(args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	score, err := s.cache.ZIncrBy(args[0], increment, args[2])
+	if err != nil {
+		return nil, err
+	}
+
+	s.logCommand("ZINCRBY %s %v %s %v\n", args[0], increment, args[2], score)
+	s.serveBlockedClients(args[0])
+	return Bulk(formatScore(score)), nil
+}
+
+// handleZCount implements ZCOUNT key min max
+func (s *Server) handleZCount(args []string) (Reply, error) {
+	r, err := parseScoreRange(args[1], args[2])
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := s.cache.ZCount(args[0], r)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logCommand("ZCOUNT %s %s %s %d\n", args[0], args[1], args[2], n)
+	return Int(n), nil
+}
+
+// zpopHandler implements ZPOPMIN and ZPOPMAX key [count]
+func zpopHandler(max bool) CommandFunc {
+	return func(s *Server, _ Client, args []string) (Reply, error) {
+		if len(args) > 2 {
+			return nil, ErrSyntax
+		}
+		count := 1
+		if len(args) == 2 {
+			var err error
+			if count, err = strconv.Atoi(args[1]); err != nil || count < 0 {
+				return nil, errors.New("value is out of range, must be positive")
+			}
+		}
+
+		members, err := s.cache.ZPop(args[0], count, max)
+		if err != nil {
+			return nil, err
+		}
+
+		s.logCommand("%s %s %d %v\n", zpopCommand(max), args[0], count, members)
+		if len(members) == 0 {
+			return Array{}, nil
+		}
+		return formatZMembers(members, true), nil
+	}
+}
+
+// bzpopHandler implements BZPOPMIN and BZPOPMAX key [key ...] timeout,
+// popping from the first non empty key or blocking until a member is
+// added to one of them, timeout being in seconds and zero blocking forever
+func bzpopHandler(max bool) CommandFunc {
+	return func(s *Server, client Client, args []string) (Reply, error) {
+		keys := args[:len(args)-1]
+		seconds, err := strconv.ParseFloat(args[len(args)-1], 64)
+		if err != nil || seconds < 0 || math.IsInf(seconds, 0) {
+			return nil, errors.New("timeout is not a float or out of range")
+		}
+
+		blocked := false
+		serve := func() (Reply, error) {
+			for _, key := range keys {
+				members, err := s.cache.ZPop(key, 1, max)
+				if err != nil {
+					return nil, err
+				}
+				if len(members) == 0 {
+					continue
+				}
+
+				s.logCommand("B%s %s %v\n", zpopCommand(max), key, members[0])
+				if blocked {
+					// the command already returned, so the pop
+					// is not seen as a write of the dispatcher
+					s.keysWritten("B"+zpopCommand(max), client.conn.Fd, []string{key})
+				}
+				m := members[0]
+				return Array{Bulk(key), Bulk(m.Member), Bulk(formatScore(m.Score))}, nil
+			}
+			return nil, nil
+		}
+		r, err := serve()
+		if err != nil || r != nil {
+			return r, err
+		}
+		if s.raft != nil {
+			// the leader logged the pop seeing a member, which another
+			// pop took first
+			return Nil, nil
+		}
+
+		blocked = true
+		return nil, s.block(client.conn, keys, time.Duration(seconds*float64(time.Second)), serve)
+	}
+}
+
+// zpopCommand returns the name of the ZPOPMIN or ZPOPMAX command
+func zpopCommand(max bool) string {
+	if max {
+		return "ZPOPMAX"
+	}
+	return "ZPOPMIN"
+}
+
+// parseScoreRange parses the min and max of a ZCOUNT style command,
+// scores prefixed by '(' being exclusive
+func parseScoreRange(min, max string) (cache.ScoreRange, error) {
+	var (
+		r          cache.ScoreRange
+		err1, err2 error
+	)
+	r.Min, r.MinExclusive, err1 = parseScoreBound(min)
+	r.Max, r.MaxExclusive, err2 = parseScoreBound(max)
+	if err1 != nil || err2 != nil {
+		return r, errors.New("min or max is not a float")
+	}
+	return r, nil
+}
+
+func parseScoreBound(s string) (float64, bool, error) {
+	exclusive := strings.HasPrefix(s, "(")
+	score, err := strconv.ParseFloat(strings.TrimPrefix(s, "("), 64)
+	if err != nil || math.IsNaN(score) {
+		return 0, false, errors.New("not a float")
+	}
+	return score, exclusive, nil
+}
+
+// handleZRangeByLex implements ZRANGEBYLEX key min max [LIMIT offset count]
+func (s *Server) handleZRangeByLex(args []string) (Reply, error) {
+	r, nonEmpty, err := parseLexRange(args[1], args[2])
+	if err != nil {
+		return nil, err
+	}
+
+	offset, count := 0, -1
+	switch {
+	case len(args) == 6 && strings.EqualFold(args[3], "LIMIT"):
+		var err1, err2 error
+		offset, err1 = strconv.Atoi(args[4])
+		count, err2 = strconv.Atoi(args[5])
+		if err1 != nil || err2 != nil {
+			return nil, errors.New("value is not an integer or out of range")
+		}
+	case len(args) != 3:
+		return nil, ErrSyntax
+	}
+
+	var members []cache.ZMember
+	if nonEmpty && offset >= 0 {
+		if members, err = s.cache.ZRangeByLex(args[0], r, offset, count); err != nil {
+			return nil, err
+		}
+	}
+
+	s.logCommand("ZRANGEBYLEX %s %s %s %d members\n", args[0], args[1], args[2], len(members))
+	if len(members) == 0 {
+		return Array{}, nil
+	}
+	return formatZMembers(members, false), nil
+}
+
+// handleZLexCount implements ZLEXCOUNT key min max
+func (s *Server) handleZLexCount(args []string) (Reply, error) {
+	r, nonEmpty, err := parseLexRange(args[1], args[2])
+	if err != nil {
+		return nil, err
+	}
+
+	n := 0
+	if nonEmpty {
+		if n, err = s.cache.ZLexCount(args[0], r); err != nil {
+			return nil, err
+		}
+	}
+
+	s.logCommand("ZLEXCOUNT %s %s %s %d\n", args[0], args[1], args[2], n)
+	return Int(n), nil
+}
+
+// parseLexRange parses the min and max of a ZRANGEBYLEX style command,
+// each being "-" or "+" for an unbounded side, or a member prefixed by
+// '[' when included and '(' when excluded. It reports whether the range
+// may hold members, "+" as min or "-" as max bounding an empty range
+func parseLexRange(min, max string) (cache.LexRange, bool, error) {
+	var r cache.LexRange
+	if !validLexBound(min) || !validLexBound(max) {
+		return r, false, errors.New("min or max not valid string range item")
+	}
+	if min == "+" || max == "-" {
+		return r, false, nil
+	}
+
+	r.MinUnbounded, r.MaxUnbounded = min == "-", max == "+"
+	if !r.MinUnbounded {
+		r.Min, r.MinExclusive = min[1:], min[0] == '('
+	}
+	if !r.MaxUnbounded {
+		r.Max, r.MaxExclusive = max[1:], max[0] == '('
+	}
+	return r, true, nil
+}
+
+func validLexBound(s string) bool {
+	return s == "-" || s == "+" || strings.HasPrefix(s, "(") || strings.HasPrefix(s, "[")
+}